@@ -1,22 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 
-	"github.com/shubham/recovery/internal/carver"
 	"github.com/shubham/recovery/internal/device"
-	"github.com/shubham/recovery/internal/disk"
-	"github.com/shubham/recovery/internal/fat32"
-	"github.com/shubham/recovery/internal/ntfs"
+	"github.com/shubham/recovery/pkg/recovery"
 )
 
 // Styles
@@ -129,6 +129,10 @@ type model struct {
 	spinner      spinner.Model
 	statusMsg    string
 	progress     float64
+	progressBar  progress.Model
+	detail       string             // What the recovery is working on, or said last
+	updates      chan tea.Msg
+	cancel       context.CancelFunc // Stops the recovery
 	
 	// Results
 	results      []RecoveredFileResult
@@ -175,6 +179,18 @@ type recoveryCompleteMsg struct {
 	err   error
 }
 
+type progressMsg struct {
+	phase   string
+	current int64
+	total   int64
+	found   int64
+	item    string
+}
+
+type messageMsg struct {
+	text string
+}
+
 func initialModel() model {
 	// Source list
 	sourceItems := []list.Item{
@@ -231,6 +247,7 @@ func initialModel() model {
 		pathInput:  pathInput,
 		outputInput: outputInput,
 		spinner:    s,
+		progressBar: progress.New(progress.WithDefaultGradient()),
 		fileTypes:  fileTypes,
 		outputPath: "./recovered",
 	}
@@ -251,8 +268,14 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if m.state != StateRunning {
 				return m, tea.Quit
 			}
+			m.stop()
+			return m, nil
 		case "esc":
-			if m.state > StateWelcome && m.state != StateRunning {
+			if m.state == StateRunning {
+				m.stop()
+				return m, nil
+			}
+			if m.state > StateWelcome {
 				m.state--
 				return m, nil
 			}
@@ -285,7 +308,27 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.state = StateSelectDevice
 		return m, nil
 
+	case progressMsg:
+		m.progress = 0
+		if msg.total > 0 {
+			m.progress = float64(msg.current) / float64(msg.total)
+		}
+		phase := "Working"
+		if msg.phase != "" {
+			phase = strings.ToUpper(msg.phase[:1]) + msg.phase[1:]
+		}
+		m.statusMsg = fmt.Sprintf("%s... found %d files", phase, msg.found)
+		if msg.item != "" {
+			m.detail = msg.item
+		}
+		return m, waitForUpdate(m.updates)
+
+	case messageMsg:
+		m.detail = msg.text
+		return m, waitForUpdate(m.updates)
+
 	case recoveryCompleteMsg:
+		m.cancel()
 		m.state = StateResults
 		m.resultCount = msg.count
 		if msg.err != nil {
@@ -459,7 +502,12 @@ func (m model) updateConfirm(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "y", "Y", "enter":
 			m.state = StateRunning
 			m.statusMsg = "Starting recovery..."
-			return m, tea.Batch(m.spinner.Tick, m.runRecovery())
+			m.progress = 0
+			m.detail = ""
+			m.updates = make(chan tea.Msg, 16)
+			ctx, cancel := context.WithCancel(context.Background())
+			m.cancel = cancel
+			return m, tea.Batch(m.spinner.Tick, m.runRecovery(ctx), waitForUpdate(m.updates))
 		case "n", "N":
 			m.state = StateSelectSource
 		}
@@ -467,6 +515,12 @@ func (m model) updateConfirm(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// stop cancels the recovery, which returns once its current read is done
+func (m *model) stop() {
+	m.cancel()
+	m.statusMsg = "Stopping..."
+}
+
 func (m model) updateRunning(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 	m.spinner, cmd = m.spinner.Update(msg)
@@ -493,38 +547,74 @@ func (m model) loadDevices() tea.Cmd {
 	}
 }
 
-func (m model) runRecovery() tea.Cmd {
+// waitForUpdate delivers the next message sent by the recovery goroutine
+func waitForUpdate(updates chan tea.Msg) tea.Cmd {
 	return func() tea.Msg {
-		reader, err := disk.Open(m.imagePath)
-		if err != nil {
-			return recoveryCompleteMsg{err: err}
-		}
-		defer reader.Close()
+		return <-updates
+	}
+}
 
-		var count int
+// runRecovery starts the recovery in the background. Progress and the final
+// result are delivered through m.updates.
+func (m model) runRecovery(ctx context.Context) tea.Cmd {
+	updates := m.updates
+	return func() tea.Msg {
+		go func() {
+			count, err := m.recover(ctx, reporter{updates})
+			updates <- recoveryCompleteMsg{count: count, err: err}
+		}()
+		return nil
+	}
+}
 
-		if m.mode == ModeCarve {
-			count, err = carver.Recover(reader, m.outputPath, m.mode == ModeScan)
-		} else {
-			fsType, detectErr := disk.DetectFilesystem(reader)
-			if detectErr != nil {
-				return recoveryCompleteMsg{err: detectErr}
-			}
+// reporter is the recovery.ProgressReporter of the TUI: it passes what the
+// recovery reports on as messages
+type reporter struct {
+	updates chan tea.Msg
+}
 
-			switch fsType {
-			case "ntfs":
-				count, err = ntfs.Recover(reader, m.outputPath, m.mode == ModeScan, false)
-			case "fat32":
-				count, err = fat32.Recover(reader, m.outputPath, m.mode == ModeScan, false)
-			default:
-				return recoveryCompleteMsg{err: fmt.Errorf("unsupported filesystem: %s", fsType)}
-			}
-		}
+func (r reporter) Progress(p recovery.Progress) {
+	r.send(progressMsg{phase: p.Phase, current: p.Scanned, total: p.Total, found: p.Found, item: p.Item})
+}
 
-		return recoveryCompleteMsg{count: count, err: err}
+func (r reporter) Message(text string) {
+	if text = strings.TrimSpace(text); text != "" {
+		r.send(messageMsg{text: text})
 	}
 }
 
+// send drops updates rather than stall the recovery when the UI lags
+func (r reporter) send(msg tea.Msg) {
+	select {
+	case r.updates <- msg:
+	default:
+	}
+}
+
+func (m model) recover(ctx context.Context, rep recovery.ProgressReporter) (int, error) {
+	src, err := recovery.Open(m.imagePath)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	src.SetReporter(rep)
+
+	if m.mode == ModeCarve {
+		files, err := src.Carve(ctx, m.outputPath, recovery.CarveOptions{Session: true, Manifest: true})
+		return len(files), err
+	}
+
+	count, err := src.RecoverDeleted(ctx, "", m.outputPath, m.mode == ModeScan)
+	var partial *recovery.PartialRecoveryError
+	if err != nil && !errors.As(err, &partial) {
+		return count, err
+	}
+	if err := src.WriteSession(ctx, m.outputPath, m.mode == ModeScan); err != nil {
+		return count, err
+	}
+	return count, err
+}
+
 func (m model) View() string {
 	var s strings.Builder
 
@@ -667,18 +757,44 @@ func (m model) viewRunning() string {
 	s.WriteString(" ")
 	s.WriteString(m.statusMsg)
 	s.WriteString("\n\n")
+	if m.progress > 0 {
+		s.WriteString(m.progressBar.ViewAs(m.progress))
+		s.WriteString("\n\n")
+	}
+	if m.detail != "" {
+		s.WriteString(helpStyle.Render(m.detail))
+		s.WriteString("\n\n")
+	}
 	s.WriteString("This may take a while for large drives...\n")
-	s.WriteString(helpStyle.Render("Please wait..."))
+	s.WriteString(helpStyle.Render("Please wait... • Esc to stop"))
 	return s.String()
 }
 
 func (m model) viewResults() string {
 	var s strings.Builder
+	var partial *recovery.PartialRecoveryError
 
-	if m.err != nil {
+	if errors.Is(m.err, context.Canceled) {
+		s.WriteString(errorStyle.Render("Recovery Stopped"))
+		s.WriteString("\n\n")
+		if m.mode != ModeScan {
+			s.WriteString(fmt.Sprintf("Files recovered so far are in: %s\n", m.outputPath))
+		}
+	} else if errors.As(m.err, &partial) {
+		s.WriteString(errorStyle.Render("Recovery Incomplete"))
+		s.WriteString("\n\n")
+		s.WriteString(fmt.Sprintf("Recovered %d deleted files; %d could not be recovered, the first %v\n", partial.Recovered, len(partial.Failed), partial.Failed[0]))
+		s.WriteString(fmt.Sprintf("Files saved to: %s\n", m.outputPath))
+		if advice := advise(m.err); advice != "" {
+			s.WriteString("\n" + advice + "\n")
+		}
+	} else if m.err != nil {
 		s.WriteString(errorStyle.Render("Recovery Failed"))
 		s.WriteString("\n\n")
 		s.WriteString(fmt.Sprintf("Error: %v\n", m.err))
+		if advice := advise(m.err); advice != "" {
+			s.WriteString("\n" + advice + "\n")
+		}
 	} else {
 		s.WriteString(successStyle.Render("✓ Recovery Complete!"))
 		s.WriteString("\n\n")
@@ -693,6 +809,18 @@ func (m model) viewResults() string {
 	return s.String()
 }
 
+// advise says what to try after a recovery failed with err, or returns ""
+func advise(err error) string {
+	var readErr *recovery.ReadError
+	switch {
+	case errors.As(err, &readErr):
+		return fmt.Sprintf("The source failed a read at offset %d. If the drive is failing, image it with ddrescue and recover from the image.", readErr.Offset)
+	case errors.Is(err, recovery.ErrCorruptBootSector), errors.Is(err, recovery.ErrUnsupportedFilesystem):
+		return "No readable NTFS or FAT32 filesystem was found. Choose File Carving, which finds files by their content without one."
+	}
+	return ""
+}
+
 func main() {
 	p := tea.NewProgram(initialModel(), tea.WithAltScreen())
 	if _, err := p.Run(); err != nil {
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/shubham/recovery/internal/batch"
+	"github.com/shubham/recovery/internal/output"
+)
+
+// batchMain runs "recover batch": a recovery of each of many sources, a
+// few at a time, each with the command and flags given after --, restore
+// when none is given
+func batchMain(args []string) {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	var (
+		parallel  = fs.Int("j", 1, "Recover this many sources at once")
+		outputDir = fs.String("output", "./recovered", "Directory each source is recovered to a directory of its own below")
+		list      = fs.String("sources", "", "File listing the sources, one a line; # starts a comment")
+	)
+	fs.Parse(args)
+
+	sources, flags := fs.Args(), []string(nil)
+	for i, arg := range sources {
+		if arg == "--" {
+			sources, flags = sources[:i], sources[i+1:]
+			break
+		}
+	}
+	if *list != "" {
+		more, err := readSources(*list)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		sources = append(sources, more...)
+	}
+	if len(sources) == 0 {
+		fmt.Println("Usage: recover batch [-j <n>] [-output <dir>] [-sources <file>] [<source>...] [-- [<command>] <flags>]")
+		fmt.Println("\nExamples:")
+		fmt.Println("  recover batch -j 2 -output /cases/tray-4 /dev/sdb /dev/sdc /dev/sdd /dev/sde -- carve -smart")
+		fmt.Println("  recover batch -sources images.txt -- carve -skip-empty")
+		os.Exit(1)
+	}
+	for _, f := range flags {
+		name, _, _ := strings.Cut(strings.TrimLeft(f, "-"), "=")
+		switch {
+		case !strings.HasPrefix(f, "-"):
+		case name == "device", name == "output":
+			fmt.Fprintf(os.Stderr, "Error: -%s is set by recover batch for each source\n", name)
+			os.Exit(1)
+		case name == "archive", name == "dest", name == "case":
+			fmt.Fprintf(os.Stderr, "Error: -%s would write every source to the same place; run them one at a time\n", name)
+			os.Exit(1)
+		}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(*outputDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating output directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Ctrl-C stops the runs, which keep what they wrote, and starts no more
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	started := time.Now()
+	tasks := batch.Tasks(sources, *outputDir)
+	fmt.Printf("Recovering %d sources, %d at a time, to %s\n", len(tasks), max(*parallel, 1), *outputDir)
+	n := 0
+	results := batch.Run(ctx, tasks, *parallel, batch.Command(exe, flags), func(r batch.Result) {
+		n++
+		s := r.Summary
+		took := s.Finished.Sub(s.Started).Round(time.Second)
+		switch s.Status {
+		case output.StatusCompleted:
+			fmt.Printf("[%d/%d] %s: %d files recovered to %s (%s)\n", n, len(tasks), r.Source, s.Recovered, r.Output, took)
+		default:
+			fmt.Printf("[%d/%d] %s: %s: %s; see %s\n", n, len(tasks), r.Source, s.Status, s.Error, r.Log)
+		}
+	})
+
+	reports, err := batch.WriteSummary(*outputDir, started, results)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	t := batch.Total(results)
+	fmt.Printf("\nBatch complete: %d of %d sources recovered, %d failed, %d interrupted; %d files in all (%s)\n",
+		t.Completed, t.Sources, t.Failed, t.Interrupted, t.Recovered, time.Since(started).Round(time.Second))
+	fmt.Printf("Summary: %s\n", strings.Join(reports, ", "))
+	switch {
+	case t.Interrupted > 0:
+		os.Exit(exitInterrupted)
+	case t.Failed > 0:
+		os.Exit(1)
+	}
+}
+
+// readSources reads a list of sources, one a line, skipping blank lines
+// and comments
+func readSources(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var sources []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line, _, _ := strings.Cut(s.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			sources = append(sources, line)
+		}
+	}
+	return sources, s.Err()
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// command is a subcommand of recover
+type command struct {
+	name    string
+	summary string
+	main    func(args []string)
+}
+
+// commands are the subcommands of recover, in the order usage lists them
+var commands = []command{
+	{"devices", "List the drives that can be recovered from", devicesMain},
+	{"scan", "List the deleted files of a drive or image", scanMain},
+	{"ls", "List every file and directory of a drive or image, as a tree", lsMain},
+	{"stat", "Decode the MFT record or directory entry of a file, by id", statMain},
+	{"cat", "Write the content of a file, by id, to standard output", catMain},
+	{"restore", "Recover deleted files by name from FAT32 and NTFS volumes", restoreMain},
+	{"find", "Recover the deleted files with a name, in one step", findMain},
+	{"carve", "Recover files by their content, with or without a filesystem", carveMain},
+	{"image", "Copy a drive to an image file, zeroing what cannot be read", imageMain},
+	{"report", "Write what a scan found, or a timeline, for other tools", reportMain},
+	{"search", "Search a drive or image for keywords", searchMain},
+	{"mount", "Browse a drive's files, deleted ones included, read-only", mountMain},
+	{"batch", "Recover many drives or images, a few at a time", batchMain},
+	{"serve", "Serve scans and recoveries over gRPC, HTTP and a browser UI", serveMain},
+}
+
+// usage prints the commands of recover
+func usage() {
+	w := os.Stderr
+	fmt.Fprintln(w, "Usage: recover <command> [flags]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w, "\nRun \"recover help <command>\" for the flags of a command.")
+	fmt.Fprintln(w, "\nExamples:")
+	fmt.Fprintln(w, "  recover devices")
+	fmt.Fprintln(w, "  recover image -device /dev/sdb -output disk.img")
+	fmt.Fprintln(w, "  recover scan -device disk.img")
+	fmt.Fprintln(w, "  recover ls -device disk.img -deleted")
+	fmt.Fprintln(w, "  recover restore -device disk.img -output ./recovered")
+	fmt.Fprintln(w, "  recover find -device /dev/sdb1 -name thesis.docx")
+	fmt.Fprintln(w, "  recover carve -device disk.img -smart")
+	fmt.Fprintln(w, "  recover report -device disk.img -format csv")
+}
+
+// flagSet returns the flag set of a subcommand, whose -h, or a missing
+// -device, prints its usage, what it does, its flags and examples
+func flagSet(name, args, about string, examples ...string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		w := fs.Output()
+		fmt.Fprintf(w, "Usage: recover %s %s\n\n%s\n\nFlags:\n", name, args, about)
+		fs.PrintDefaults()
+		if len(examples) > 0 {
+			fmt.Fprintln(w, "\nExamples:")
+			for _, e := range examples {
+				fmt.Fprintln(w, "  "+e)
+			}
+		}
+	}
+	return fs
+}
+
+// runMain parses the flags of a scan, restore, carve or report and runs it
+func runMain(fs *flag.FlagSet, o *options, args []string) {
+	o.parse(fs, args)
+	if o.device == "" || fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	run(o)
+}
+
+// scanMain runs "recover scan": a listing of the deleted files of the
+// source's volumes, recovering nothing
+func scanMain(args []string) {
+	o := &options{scanOnly: true}
+	fs := flagSet("scan", "-device <path> [flags]",
+		"Lists the deleted files of the FAT32 and NTFS volumes of a drive or image, without\n"+
+			"recovering them. What was found is recorded in <output>/session.json.",
+		"recover scan -device /dev/sdb1",
+		"recover scan -device disk.img -fs ntfs -progress json",
+		"recover scan -device /dev/sdb -progress-json /tmp/recover.events")
+	o.sourceFlags(fs)
+	o.filterFlags(fs)
+	o.caseFlags(fs)
+	runMain(fs, o, args)
+}
+
+// restoreMain runs "recover restore": a recovery of the deleted files of
+// the source's volumes, by name
+func restoreMain(args []string) {
+	o := &options{}
+	fs := flagSet("restore", "-device <path> [-output <dir>] [flags]",
+		"Recovers the deleted files of the FAT32 and NTFS volumes of a drive or image, with\n"+
+			"their names and directories, to -output. With -ids or -ids-file, only the files with\n"+
+			"those ids in the session manifest of an earlier scan are, without scanning again; with\n"+
+			"-resume, those of a session that no run has written to -output yet; with -select, those\n"+
+			"chosen at a prompt once it has scanned. With -all, the files in use are recovered too.",
+		"recover restore -device /dev/sdb1 -output ./recovered",
+		"recover restore -device disk.img -identify rename -gallery",
+		"recover restore -device /dev/nvme0n1p2 -j 8 -output /mnt/backup/recovered",
+		"recover restore -device /dev/sdb1 -dry-run -include '*.jpg'",
+		"recover restore -device /dev/sdb -case 2024-017 -examiner anna -hash-source",
+		"recover restore -device disk.img -ids 23,118-120",
+		"recover restore -device /dev/sdb1 -select -output ./recovered",
+		"recover restore -device disk.img -all -output /mnt/backup/everything",
+		"grep -v tmp ids.txt | recover restore -device disk.img -ids-file -")
+	o.sourceFlags(fs)
+	o.filterFlags(fs)
+	fs.BoolVar(&o.dryRun, "dry-run", false, "Scan and print the files, space and time the recovery would take, writing nothing")
+	fs.BoolVar(&o.all, "all", false, "Recover the files in use as well as the deleted ones, to copy everything off a failing drive")
+	o.idFlags(fs)
+	o.writeFlags(fs)
+	o.caseFlags(fs)
+	runMain(fs, o, args)
+}
+
+// findMain runs "recover find": a recovery of the deleted files with a
+// name, or names matching a glob, at once
+func findMain(args []string) {
+	o := &options{}
+	fs := flagSet("find", "-device <path> -name <name> [-output <dir>] [flags]",
+		"Recovers the deleted files of the FAT32 and NTFS volumes of a drive or image whose name is\n"+
+			"-name, in any case, or matches it as a glob, to -output, in one go. It is restore with\n"+
+			"-include, for the file just deleted: the drive is read as restore reads it, and only the\n"+
+			"files matching are written.",
+		"recover find -device /dev/sdb1 -name thesis.docx",
+		"recover find -device /dev/sdb1 -name 'budget*.xlsx,*.pst' -output ~/found",
+		"recover find -device disk.img -name 'Users/*/Desktop/*.txt' -list")
+	o.sourceFlags(fs)
+	fs.StringVar(&o.include, "name", "", "Name of the deleted files to recover, in any case, or a glob such as '*.docx'; comma-separated for several, with a slash to match paths")
+	fs.BoolVar(&o.scanOnly, "list", false, "Only list the deleted files found, recovering nothing")
+	o.parse(fs, args)
+	if o.device == "" || o.include == "" || fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	run(o)
+}
+
+// carveMain runs "recover carve": a recovery of files by their content,
+// or with -smart of the deleted files by name and then the rest by content
+func carveMain(args []string) {
+	o := &options{carveMode: true}
+	fs := flagSet("carve", "-device <path> [-output <dir>] [flags]",
+		"Recovers files by their content (signatures), which needs no filesystem. With -smart,\n"+
+			"deleted files are first recovered by name and only the space left unclaimed is carved.\n"+
+			"-export-free and -slack export raw space for other tools instead.",
+		"recover carve -device /dev/sdb1 -skip-empty",
+		"recover carve -device disk.img -resume",
+		"recover carve -device /dev/sdb -smart -dry-run",
+		"recover carve -device disk.img -smart -hashset NSRLFile.txt",
+		"recover carve -device disk.img -export-free")
+	o.sourceFlags(fs)
+	o.filterFlags(fs)
+	fs.BoolVar(&o.scanOnly, "scan", false, "List what would be carved or exported, without writing it")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "Scan and print the files, space and time the carve would take, writing nothing")
+	o.writeFlags(fs)
+	o.carveFlags(fs)
+	o.exportFlags(fs)
+	o.caseFlags(fs)
+	runMain(fs, o, args)
+}
+
+// reportMain runs "recover report": what a scan found, written for other
+// tools, or the timeline of the source's volumes
+func reportMain(args []string) {
+	o := &options{}
+	fs := flagSet("report", "-device <path> [-output <dir>] [-format json|csv] [-timeline]",
+		"Writes what a scan of a drive or image found (volumes, files, data runs, status) to\n"+
+			"<output>/scan.<format>, or with -timeline a body file (mactime) of the volumes' file\n"+
+			"times, $UsnJrnl and recycle bin to <output>/timeline.body.",
+		"recover report -device disk.img",
+		"recover report -device /dev/sdb1 -format csv -output ./reports",
+		"recover report -device disk.img -timeline")
+	o.sourceFlags(fs)
+	o.filterFlags(fs)
+	fs.StringVar(&o.report, "format", "json", "Format of the report: json, csv")
+	fs.BoolVar(&o.timeline, "timeline", false, "Write a body file (mactime) of the volumes' file times, $UsnJrnl and recycle bin instead")
+	o.caseFlags(fs)
+	o.parse(fs, args)
+	if o.device == "" || fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	o.scanOnly = !o.timeline
+	run(o)
+}
+
+// legacyMain runs recover with the flags of earlier versions, given
+// without a subcommand, as scripts written for them do
+func legacyMain(args []string) {
+	o := &options{}
+	fs := flag.NewFlagSet("recover", flag.ExitOnError)
+	fs.Usage = usage
+	o.sourceFlags(fs)
+	o.filterFlags(fs)
+	fs.BoolVar(&o.scanOnly, "scan", false, "Scan only, don't recover files")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "Scan and print the files, space and time the recovery would take, writing nothing")
+	fs.BoolVar(&o.carveMode, "carve", false, "Use file carving (signature-based recovery)")
+	fs.BoolVar(&o.timeline, "timeline", false, "Write a body file (mactime) of the volumes' file times, $UsnJrnl and recycle bin to <output>/timeline.body")
+	o.writeFlags(fs)
+	o.carveFlags(fs)
+	o.exportFlags(fs)
+	o.caseFlags(fs)
+	o.parse(fs, args)
+	if o.device == "" {
+		usage()
+		os.Exit(1)
+	}
+	run(o)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk/disktest"
+)
+
+func TestFind(t *testing.T) {
+	// A deleted NOTES.TXT and REPORT.DOC, and a KEEP.TXT in use
+	data := disktest.Deleted(disktest.Notes)
+	disktest.Allocate(data, 7)
+	copy(disktest.Cluster(data, 2)[32:], disktest.DirEntry("\xE5EPORT  DOC", 0, 6, 100))
+	copy(disktest.Cluster(data, 2)[64:], disktest.DirEntry("KEEP    TXT", 0, 7, 100))
+	copy(disktest.Cluster(data, 6), strings.Repeat("report ", 20))
+	copy(disktest.Cluster(data, 7), strings.Repeat("keep ", 20))
+	image := disktest.Write(t, "find.img", data)
+
+	for _, c := range []struct {
+		name string
+		want []string // Written
+	}{
+		{"*.txt", []string{"_OTES.TXT"}},
+		{"*EPORT.doc", []string{"_EPORT.DOC"}},
+		{"*.txt,*.doc", []string{"_OTES.TXT", "_EPORT.DOC"}},
+	} {
+		dir := t.TempDir()
+		if got, out := runRecover(t, "find", "-device", image, "-name", c.name, "-output", dir); got != exitOK {
+			t.Fatalf("find -name %s: expected exit status 0, got %d:\n%s", c.name, got, out)
+		}
+		for _, name := range []string{"_OTES.TXT", "_EPORT.DOC", "KEEP.TXT"} {
+			_, err := os.Stat(filepath.Join(dir, name))
+			if wanted := slices.Contains(c.want, name); wanted != (err == nil) {
+				t.Errorf("find -name %s: expected %s written %v, got %v", c.name, name, wanted, err)
+			}
+		}
+	}
+
+	// -list writes nothing
+	dir := t.TempDir()
+	got, out := runRecover(t, "find", "-device", image, "-name", "*.txt", "-list", "-output", dir)
+	if got != exitOK || !strings.Contains(out, "?OTES.TXT") || strings.Contains(out, "EPORT") {
+		t.Errorf("find -list: expected the notes listed, got %d:\n%s", got, out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "_OTES.TXT")); err == nil {
+		t.Error("find -list: expected nothing written")
+	}
+
+	if got, out := runRecover(t, "find", "-device", image, "-name", "*.pdf", "-output", t.TempDir()); got != exitNothing {
+		t.Errorf("find of nothing: expected exit status %d, got %d:\n%s", exitNothing, got, out)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	devices "github.com/shubham/recovery/internal/device"
+)
+
+// deviceJSON is a device in the output of recover devices -json
+type deviceJSON struct {
+	Path       string `json:"path"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Parent     string `json:"parent,omitempty"`
+	Size       int64  `json:"size"`
+	Filesystem string `json:"filesystem,omitempty"`
+	Model      string `json:"model,omitempty"`
+	Serial     string `json:"serial,omitempty"`
+	Removable  bool   `json:"removable"`
+	Mounted    bool   `json:"mounted"`
+	Mountpoint string `json:"mountpoint,omitempty"`
+}
+
+// devicesMain runs "recover devices": a list of the drives and partitions
+// the system has, to pick a -device from
+func devicesMain(args []string) {
+	fs := flagSet("devices", "[-json]",
+		"Lists the drives of this system, each followed by its partitions, with their size,\n"+
+			"filesystem, model, serial number and whether they are removable or mounted.",
+		"recover devices",
+		"recover devices -json | jq -r '.devices[] | select(.removable and .type == \"disk\") | .path'")
+	asJSON := fs.Bool("json", false, "Print the devices as JSON, for scripts")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	list, err := devices.List()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing devices: %v\n", err)
+		os.Exit(1)
+	}
+	if *asJSON {
+		out := []deviceJSON{}
+		for _, d := range list {
+			out = append(out, deviceJSON{
+				Path: d.Path, Name: d.Name, Type: d.Type, Parent: d.Parent, Size: d.Size, Filesystem: d.Filesystem,
+				Model: d.Model, Serial: d.Serial, Removable: d.Removable, Mounted: d.Mountpoint != "", Mountpoint: d.Mountpoint,
+			})
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(map[string]any{"devices": out}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(list) == 0 {
+		fmt.Println("No devices found; you may need to run as root or Administrator")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DEVICE\tSIZE\tTYPE\tFS\tMODEL\tSERIAL\tREMOVABLE\tMOUNTED ON")
+	for _, d := range list {
+		path, model, serial := d.Path, d.Model, d.Serial
+		// A partition is shown below its disk, which gives the model and
+		// serial number
+		if d.Parent != "" {
+			path, model, serial = "  "+path, "", ""
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			path, d.SizeHuman, d.Type, dash(d.Filesystem), dash(model), dash(serial), yesNo(d.Removable), dash(d.Mountpoint))
+	}
+	w.Flush()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
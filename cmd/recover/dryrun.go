@@ -0,0 +1,58 @@
+package main
+
+import (
+	"time"
+
+	"github.com/shubham/recovery/internal/carver"
+	devices "github.com/shubham/recovery/internal/device"
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// dryRun scans as the recovery o describes would, carving with opts, and
+// prints what it would write and how long it would take, writing nothing;
+// it returns the number of files it would write
+func dryRun(reader *disk.Reader, o *options, opts carver.Options) (int, error) {
+	start, read := time.Now(), reader.Stats().Bytes
+	var carved []carver.CarvedFile
+	if o.carveMode || o.smart {
+		// Nor what describes the carved files
+		opts.Report, opts.Session, opts.Manifest, opts.Sidecars, opts.DFXML = carver.ReportOff, false, false, false, false
+		opts.Classify, opts.Fragments, opts.Text = false, nil, carver.TextOptions{}
+		opts.Checkpoint, opts.Resume = "", false
+		opts.Carved = &carved
+		var err error
+		if o.smart {
+			_, err = carver.SmartRecover(reader, o.outputDir, true, opts)
+		} else {
+			_, err = carver.Recover(reader, o.outputDir, true, opts)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	e := carver.EstimateRecovery(reader, !o.carveMode || o.smart, carved, opts, carver.EstimateBlockSize)
+	if err := reader.Err(); err != nil {
+		return 0, err
+	}
+	e.Read, e.Elapsed = reader.Stats().Bytes-read, time.Since(start)
+
+	reader.Println("\nDry run; nothing was written.")
+	reader.Printf("  Files to recover:  %d (%s)\n", e.Files, disk.FormatSize(e.Bytes))
+	if e.LeftOut > 0 {
+		reader.Printf("  Left out:          %d files the filter does not keep\n", e.LeftOut)
+	}
+	reader.Printf("  Space needed:      %s in %d-byte blocks\n", disk.FormatSize(e.Space), carver.EstimateBlockSize)
+	if free, err := devices.FreeSpace(o.outputDir); err == nil {
+		reader.Printf("  Free space:        %s at %s\n", disk.FormatSize(free), o.outputDir)
+		if e.Space > free {
+			reader.Println("  Warning: the files would not fit; choose another -output or narrow the filter")
+		}
+	}
+	reader.Printf("  Scan:              read %s in %s (%s/s)\n", disk.FormatSize(e.Read), e.Elapsed.Round(time.Millisecond), disk.FormatSize(int64(e.Rate())))
+	if d := e.Projected(); d > 0 {
+		reader.Printf("  Recovery would take about %s at that rate\n", max(d.Round(time.Second), time.Second))
+	} else {
+		reader.Println("  The scan read too little to tell how long the recovery would take")
+	}
+	return e.Files, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// execHook runs a command for each recovered file, as -exec gives it: {}
+// in its arguments stands for the file's path, which is added as the last
+// argument when none has it, and the rest of what is known of the file is
+// in the environment. The command is not run through a shell, since the
+// names of recovered files come from the source; one that needs a shell
+// runs it with the path as an argument:
+//
+//	-exec 'sh -c "clamscan --no-summary \"$1\" >> scan.log" _ {}'
+type execHook struct {
+	ctx  context.Context
+	args []string
+}
+
+func newExecHook(ctx context.Context, command string) (*execHook, error) {
+	args, err := splitCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty -exec command")
+	}
+	return &execHook{ctx: ctx, args: args}, nil
+}
+
+func (h *execHook) Recovered(f disk.WrittenFile) error {
+	args := make([]string, 0, len(h.args)+1)
+	placed := false
+	for _, a := range h.args {
+		if strings.Contains(a, "{}") {
+			a = strings.ReplaceAll(a, "{}", f.Path)
+			placed = true
+		}
+		args = append(args, a)
+	}
+	if !placed {
+		args = append(args, f.Path)
+	}
+
+	cmd := exec.CommandContext(h.ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"RECOVER_PATH="+f.Path,
+		"RECOVER_ORIGINAL="+filepath.ToSlash(f.Original),
+		"RECOVER_SOURCE="+f.Source,
+		"RECOVER_TYPE="+f.Type,
+		"RECOVER_OFFSET="+strconv.FormatInt(f.Offset, 10),
+		"RECOVER_SIZE="+strconv.FormatInt(f.Size, 10),
+		"RECOVER_MD5="+f.MD5,
+		"RECOVER_SHA256="+f.SHA256,
+	)
+	// Standard output may carry -progress json events
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	return nil
+}
+
+// splitCommand splits a command line into arguments at spaces outside
+// quotes. Single quotes keep what they hold as it is; in double quotes a
+// backslash escapes a quote or backslash.
+func splitCommand(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case quote == '"':
+			switch {
+			case c == '"':
+				quote = 0
+			case c == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\'):
+				i++
+				arg.WriteRune(runes[i])
+			default:
+				arg.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in -exec command", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
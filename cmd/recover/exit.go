@@ -0,0 +1,28 @@
+package main
+
+// The exit status of a scan, restore, carve or report tells automation how
+// it ended, as the README documents; the other commands exit with those
+// that apply to them. 2 is left to the flag package, which exits with it
+// when the flags cannot be parsed.
+const (
+	exitOK          = 0   // Completed, and recovered or found files
+	exitFailed      = 1   // Failed, or was given flags it cannot run with
+	exitNothing     = 3   // Completed, and found nothing to recover
+	exitPartial     = 4   // Completed, but files failed to recover or verify
+	exitUnsupported = 5   // No filesystem it can read, and not carving
+	exitSource      = 6   // The source could not be opened
+	exitInterrupted = 130 // Stopped by Ctrl-C, keeping what it wrote
+)
+
+// done ends a run that completed, with exitPartial when files failed to be
+// written or did not verify, exitNothing when it found no files, and
+// exitOK otherwise
+func (j *job) done() {
+	switch {
+	case j.failed > 0 || j.reader.Unverified() > 0:
+		j.exit(exitPartial, nil)
+	case j.recovered == 0:
+		j.exit(exitNothing, nil)
+	}
+	j.exit(exitOK, nil)
+}
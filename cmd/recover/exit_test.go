@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shubham/recovery/internal/disk/disktest"
+)
+
+// pdf is a file carving finds by its header and trailer
+var pdf = []byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\ntrailer\n<< /Root 1 0 R >>\n%%EOF\n")
+
+// blocked returns an output directory where a file stands in the way of
+// the directory name, so that nothing can be written below it
+func blocked(t *testing.T, name string) string {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestExitCodes(t *testing.T) {
+	deleted := disktest.Write(t, "deleted.img", disktest.Deleted(disktest.Notes))
+	empty := disktest.FAT32(16)
+	disktest.Allocate(empty, 2)
+	// A PDF in a free cluster of a volume, for smart mode to carve
+	smart := disktest.Deleted(disktest.Notes)
+	copy(disktest.Cluster(smart, 9), pdf)
+	raw := make([]byte, 1<<20)
+	copy(raw[4096:], pdf)
+
+	for _, c := range []struct {
+		name string
+		want int
+		args []string
+	}{
+		{"recovered", exitOK, []string{"restore", "-device", deleted, "-output", t.TempDir()}},
+		{"bad flag value", exitFailed, []string{"carve", "-device", deleted, "-output", t.TempDir(), "-validate", "sometimes"}},
+		{"nothing deleted", exitNothing, []string{"restore", "-device", disktest.Write(t, "empty.img", empty), "-output", t.TempDir()}},
+		{"restore failed to write", exitPartial, []string{"restore", "-device", deleted, "-output", blocked(t, "_OTES.TXT/x")}},
+		{"carve failed to write", exitPartial, []string{"carve", "-device", disktest.Write(t, "raw.img", raw), "-output", blocked(t, "PDF")}},
+		{"smart failed to write", exitPartial, []string{"carve", "-smart", "-device", disktest.Write(t, "smart.img", smart), "-output", blocked(t, "carved/PDF")}},
+		{"no filesystem", exitUnsupported, []string{"restore", "-device", disktest.Write(t, "blank.img", make([]byte, 1<<20)), "-output", t.TempDir()}},
+		{"no source", exitSource, []string{"restore", "-device", filepath.Join(t.TempDir(), "missing.img"), "-output", t.TempDir()}},
+	} {
+		if got, out := runRecover(t, c.args...); got != c.want {
+			t.Errorf("%s: expected exit status %d, got %d:\n%s", c.name, c.want, got, out)
+		}
+	}
+}
+
+func TestExitInterrupted(t *testing.T) {
+	// Enough to carve for a while, with no fill to skip
+	f, err := os.Create(filepath.Join(t.TempDir(), "big.img"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := []byte(strings.Repeat("not a file signature ", 50000))
+	for range 100 {
+		f.Write(block)
+	}
+	f.Close()
+
+	cmd := recoverCmd("carve", "-device", f.Name(), "-output", t.TempDir())
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	cmd.Stdout, cmd.Stderr = w, w
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bufio.NewScanner(r)
+	for lines.Scan() && !strings.HasPrefix(lines.Text(), "Scanning disk") {
+	}
+	cmd.Process.Signal(os.Interrupt)
+	go func() {
+		for lines.Scan() {
+		}
+	}()
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("Expected the carve to stop when interrupted")
+	}
+	if got := cmd.ProcessState.ExitCode(); got != exitInterrupted {
+		t.Errorf("Expected exit status %d, got %d", exitInterrupted, got)
+	}
+}
+
+func TestExitRemovesStaging(t *testing.T) {
+	// An archive of nothing ends the run with exitNothing, which the staging
+	// directory must not outlive
+	tmp := t.TempDir()
+	blank := disktest.Write(t, "blank.img", make([]byte, 1<<20))
+	for _, c := range []struct {
+		name string
+		want int
+		args []string
+	}{
+		{"nothing carved", exitNothing, []string{"carve", "-device", blank, "-archive", filepath.Join(t.TempDir(), "out.zip")}},
+		{"no filesystem", exitUnsupported, []string{"restore", "-device", blank, "-archive", filepath.Join(t.TempDir(), "out.zip")}},
+	} {
+		cmd := recoverCmd(c.args...)
+		cmd.Env = append(cmd.Env, "TMPDIR="+tmp)
+		if got, out := runCmd(t, cmd); got != c.want {
+			t.Fatalf("%s: expected exit status %d, got %d:\n%s", c.name, c.want, got, out)
+		}
+		if left, _ := filepath.Glob(filepath.Join(tmp, "recover-*")); len(left) > 0 {
+			t.Errorf("%s: expected the staging directory removed, found %v", c.name, left)
+		}
+	}
+}
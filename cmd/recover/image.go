@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	devices "github.com/shubham/recovery/internal/device"
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// imageMain runs "recover image": a copy of a drive to an image file to
+// recover from instead, which a failing drive is read for only once
+func imageMain(args []string) {
+	fs := flagSet("image", "-device <path> -output <image> [-block <size>]",
+		"Copies the whole of a drive to an image file. A block that fails to read is read again a\n"+
+			"sector at a time, and the sectors that still fail are written as zeros and listed in\n"+
+			"<image>.bad, so every file keeps its offset. The MD5 and SHA-256 of the image are printed.",
+		"recover image -device /dev/sdb -output sdb.img",
+		"recover image -device /dev/disk2 -output /Volumes/Backup/disk2.img -block 64K")
+	var (
+		device    = fs.String("device", "", "Path to the device to image (e.g., /dev/sdb)")
+		imagePath = fs.String("output", "", "Image file to write; it must not exist")
+		block     = fs.String("block", "1M", "Read this much at a time, e.g. 64K; smaller blocks lose less around a bad sector but are slower")
+		progress  = fs.String("progress", "text", "How to report progress on standard output: text, or json for a JSON event a line")
+		force     = fs.Bool("force", false, "Write the image even when it is on the device being imaged")
+	)
+	fs.Parse(args)
+	if *device == "" || *imagePath == "" || fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	blockSize, err := disk.ParseSize(*block)
+	if err != nil || blockSize <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid -block %q\n", *block)
+		os.Exit(1)
+	}
+
+	reader, err := disk.Open(*device)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening device: %v\n", err)
+		os.Exit(exitSource)
+	}
+	defer reader.Close()
+	switch *progress {
+	case "text":
+	case "json":
+		reader.SetReporter(disk.NewJSONEvents(os.Stdout))
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown progress format %q (want text or json)\n", *progress)
+		os.Exit(1)
+	}
+	if !*force {
+		if same, err := devices.OnDevice(*imagePath, *device); err == nil && same {
+			fmt.Fprintf(os.Stderr, "Error: %s is on %s, the device being imaged; writing there would overwrite the deleted files.\n", *imagePath, *device)
+			os.Exit(1)
+		}
+	}
+	f, err := os.OpenFile(*imagePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating image: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Ctrl-C stops the copy, keeping what was written; a second one kills it
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	reader.SetContext(ctx)
+
+	reader.Printf("Imaging %s (%d bytes) to %s...\n", *device, reader.Size(), *imagePath)
+	w := bufio.NewWriterSize(f, int(min(blockSize, 64<<20)))
+	res, err := disk.Image(reader, w, int(min(blockSize, 1<<30)))
+	err = errors.Join(err, w.Flush(), f.Sync(), f.Close())
+	if len(res.Bad) > 0 {
+		if merr := writeBadMap(*imagePath+".bad", res.Bad); merr != nil {
+			fmt.Fprintf(os.Stderr, "Error writing the map of unreadable sectors: %v\n", merr)
+			os.Exit(1)
+		}
+	}
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintf(os.Stderr, "\nInterrupted: the first %d bytes are in %s\n", res.Size, *imagePath)
+		os.Exit(exitInterrupted)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Imaging error: %v\n", err)
+		os.Exit(1)
+	}
+
+	reader.Printf("\nImaged %d bytes to %s\n", res.Size, *imagePath)
+	reader.Printf("  MD5:     %s\n", res.MD5)
+	reader.Printf("  SHA-256: %s\n", res.SHA256)
+	if len(res.Bad) > 0 {
+		reader.Printf("Warning: %d bytes in %d regions could not be read and are zeros in the image; see %s.bad\n",
+			res.BadBytes(), len(res.Bad), *imagePath)
+	}
+}
+
+// writeBadMap writes the regions an image could not read to path
+func writeBadMap(path string, bad []disk.BadRange) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	return errors.Join(disk.WriteBadRanges(f, bad), f.Close())
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/pkg/recovery"
+)
+
+// lsMain runs "recover ls": every file and directory of the source's
+// volumes, live and deleted, listed as a tree, as fls lists them
+func lsMain(args []string) {
+	fs := flagSet("ls", "-device <path> [-deleted] [-l]",
+		"Lists every file and directory of the FAT32 and NTFS volumes of a drive or image, live\n"+
+			"and deleted, in the order of their directories, with their ids, sizes and times, writing\n"+
+			"nothing. Deleted entries are marked with *. The ids are those of a scan's session, for\n"+
+			"recover restore -ids.",
+		"recover ls -device /dev/sdb1",
+		"recover ls -device disk.img -deleted -l",
+		"recover ls -device /dev/sdb | grep -i '\\.pst$'")
+	var (
+		device      = fs.String("device", "", "Path to device or image file (e.g., /dev/sdb1, disk.img)")
+		deletedOnly = fs.Bool("deleted", false, "List only deleted entries, as fls -d does")
+		long        = fs.Bool("l", false, "Long listing: the MFT record of each entry and all its times, not only when it was modified")
+	)
+	fs.Parse(args)
+	if *device == "" || fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	source, files := scanSource(*device)
+	defer source.Close()
+
+	listed, deleted := 0, 0
+	for _, f := range treeOrder(files) {
+		if *deletedOnly && !f.Deleted {
+			continue
+		}
+		fmt.Println(lsLine(f, *long))
+		listed++
+		if f.Deleted {
+			deleted++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d files and directories, %d of them deleted\n", listed, deleted)
+	if listed == 0 {
+		os.Exit(exitNothing)
+	}
+}
+
+// scanSource opens a source and lists the files of its volumes, printing
+// what the scan reports to standard error; it exits when the source has
+// no volume to list
+func scanSource(device string) (*recovery.Source, []recovery.File) {
+	source, err := recovery.Open(device)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening device: %v\n", err)
+		os.Exit(exitSource)
+	}
+	// The listing alone goes to standard output
+	source.SetReporter(printer{disk.NewPrinter(os.Stderr)})
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	files, err := source.Scan(ctx)
+	stop()
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "Interrupted")
+		os.Exit(exitInterrupted)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Scan error: %v\n", err)
+		os.Exit(exitFailed)
+	}
+	if volumes, _ := source.Volumes(); len(volumes) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no FAT32 or NTFS volume found; use recover carve to recover files by their content")
+		os.Exit(exitUnsupported)
+	}
+	return source, files
+}
+
+// printer prints what the runs of a source report as the recover command
+// prints its own
+type printer struct {
+	p *disk.Printer
+}
+
+func (p printer) Progress(pr recovery.Progress) {
+	p.p.Progress(disk.Progress{Phase: pr.Phase, Current: pr.Scanned, Total: pr.Total, Found: pr.Found, Item: pr.Item})
+}
+
+func (p printer) Message(text string) {
+	p.p.Message(text)
+}
+
+// treeOrder returns files sorted by volume and path, each directory
+// followed by what is in it, as an MFT, in record order, does not list them
+func treeOrder(files []recovery.File) []recovery.File {
+	// A separator sorts before any character a name has, so a directory's
+	// entries are not split by one whose name starts with its own
+	key := func(f recovery.File) string {
+		return strings.ReplaceAll(path.Join(f.Volume, f.Path), "/", "\x00")
+	}
+	sorted := slices.Clone(files)
+	slices.SortStableFunc(sorted, func(a, b recovery.File) int {
+		return strings.Compare(key(a), key(b))
+	})
+	return sorted
+}
+
+// lsLine formats a file as ls lists it: its id, its type as fls gives it
+// (r/r for a file, d/d for a directory), * when deleted, its size, when it
+// was modified and its path, and with long its MFT record and the times
+// it was accessed, changed and created too
+func lsLine(f recovery.File, long bool) string {
+	kind, mark := "r/r", " "
+	if f.Dir {
+		kind = "d/d"
+	}
+	if f.Deleted {
+		mark = "*"
+	}
+	line := fmt.Sprintf("%12d  %s %s", f.ID, kind, mark)
+	if long {
+		inode := "-"
+		if f.Inode > 0 {
+			inode = fmt.Sprint(f.Inode)
+		}
+		line += fmt.Sprintf(" %8s", inode)
+	}
+	line += fmt.Sprintf(" %12d  %s", f.Size, lsTime(f.Modified))
+	if long {
+		line += fmt.Sprintf("  %s  %s  %s", lsTime(f.Accessed), lsTime(f.Changed), lsTime(f.Created))
+	}
+	return line + "  " + path.Join(f.Volume, f.Path)
+}
+
+// lsTime formats a time of a file in UTC, or a dash in its place when the
+// filesystem does not keep it
+func lsTime(t time.Time) string {
+	if t.IsZero() {
+		return fmt.Sprintf("%-19s", "-")
+	}
+	return t.UTC().Format(time.DateTime)
+}
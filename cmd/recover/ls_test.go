@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/binary"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shubham/recovery/internal/disk/disktest"
+	"github.com/shubham/recovery/pkg/recovery"
+)
+
+// lsImage builds a FAT32 volume whose root lists a directory DOCS, a file
+// DOCS.TXT that sorts after what is in it, and a deleted ?OTES.TXT; DOCS
+// holds REPORT.DOC, modified on 2024-05-01 at 10:30, and a deleted ?LD.DOC
+func lsImage(t *testing.T) string {
+	data := disktest.FAT32(16)
+	disktest.Allocate(data, 2, 3, 4, 6)
+	root := disktest.Cluster(data, 2)
+	copy(root[0:], disktest.DirEntry("DOCS       ", 0x10, 3, 0))
+	copy(root[32:], disktest.DirEntry("DOCS    TXT", 0, 4, 10))
+	copy(root[64:], disktest.DirEntry("\xE5OTES   TXT", 0, 5, 1400))
+	docs := disktest.Cluster(data, 3)
+	copy(docs[0:], disktest.DirEntry(".          ", 0x10, 3, 0))
+	copy(docs[32:], disktest.DirEntry("..         ", 0x10, 0, 0))
+	report := disktest.DirEntry("REPORT  DOC", 0, 6, 20)
+	binary.LittleEndian.PutUint16(report[22:], 10<<11|30<<5)
+	binary.LittleEndian.PutUint16(report[24:], (2024-1980)<<9|5<<5|1)
+	copy(docs[64:], report)
+	copy(docs[96:], disktest.DirEntry("\xE5LD     DOC", 0, 7, 30))
+	return disktest.Write(t, "ls.img", data)
+}
+
+func TestLs(t *testing.T) {
+	image := lsImage(t)
+	for _, c := range []struct {
+		args []string
+		want string
+	}{
+		{nil, "" +
+			"       17472  r/r *         1400  -                    ?OTES.TXT\n" +
+			"       17408  d/d              0  -                    DOCS\n" +
+			"       21600  r/r *           30  -                    DOCS/?LD.DOC\n" +
+			"       21568  r/r             20  2024-05-01 10:30:00  DOCS/REPORT.DOC\n" +
+			"       17440  r/r             10  -                    DOCS.TXT\n"},
+		{[]string{"-deleted"}, "" +
+			"       17472  r/r *         1400  -                    ?OTES.TXT\n" +
+			"       21600  r/r *           30  -                    DOCS/?LD.DOC\n"},
+	} {
+		out, err := recoverCmd(append([]string{"ls", "-device", image}, c.args...)...).Output()
+		if err != nil {
+			t.Fatalf("ls %v failed: %v", c.args, err)
+		}
+		if string(out) != c.want {
+			t.Errorf("ls %v: expected\n%s\ngot\n%s", c.args, c.want, out)
+		}
+	}
+}
+
+func TestTreeOrder(t *testing.T) {
+	files := []recovery.File{
+		{ID: 1, Volume: "partition2", Path: "a.txt"},
+		{ID: 2, Volume: "partition1", Path: "b.txt"},
+		{ID: 3, Volume: "partition1", Path: "Docs.txt"},
+		{ID: 4, Volume: "partition1", Path: "Docs", Dir: true},
+		{ID: 5, Volume: "partition1", Path: "Docs/z.txt"},
+		{ID: 6, Volume: "partition1", Path: "Docs/a.txt"},
+	}
+	var got []int
+	for _, f := range treeOrder(files) {
+		got = append(got, f.ID)
+	}
+	if want := []int{4, 6, 5, 3, 2, 1}; !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestLsLine(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	f := recovery.File{ID: 42, Volume: "partition1", Path: "Users/ann/report.docx", Deleted: true, Size: 12345, Inode: 97, Modified: modified, Created: modified.Add(-time.Hour)}
+	if got, want := lsLine(f, false), "          42  r/r *        12345  2024-05-01 10:30:00  partition1/Users/ann/report.docx"; got != want {
+		t.Errorf("Expected\n%q, got\n%q", want, got)
+	}
+	want := "          42  r/r *       97        12345  2024-05-01 10:30:00  -                    -                    2024-05-01 09:30:00  partition1/Users/ann/report.docx"
+	if got := lsLine(f, true); got != want {
+		t.Errorf("Expected\n%q, got\n%q", want, got)
+	}
+	if got := lsLine(recovery.File{ID: 7, Path: "Docs", Dir: true}, true); !strings.HasPrefix(got, "           7  d/d          -") {
+		t.Errorf("Expected a directory with no record, got %q", got)
+	}
+}
@@ -1,79 +1,682 @@
 package main
 
 import (
-	"flag"
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/shubham/recovery/internal/carver"
+	devices "github.com/shubham/recovery/internal/device"
 	"github.com/shubham/recovery/internal/disk"
-	"github.com/shubham/recovery/internal/fat32"
-	"github.com/shubham/recovery/internal/ntfs"
+	"github.com/shubham/recovery/internal/output"
+	"github.com/shubham/recovery/pkg/recovery"
 )
 
 func main() {
-	var (
-		device     = flag.String("device", "", "Path to device or image file (e.g., /dev/sdb1, disk.img)")
-		outputDir  = flag.String("output", "./recovered", "Output directory for recovered files")
-		fsType     = flag.String("fs", "auto", "Filesystem type: auto, ntfs, fat32")
-		scanOnly   = flag.Bool("scan", false, "Scan only, don't recover files")
-		carveMode  = flag.Bool("carve", false, "Use file carving (signature-based recovery)")
-	)
-	flag.Parse()
-
-	if *device == "" {
-		fmt.Println("Usage: recover -device <path> [-output <dir>] [-fs <type>]")
-		fmt.Println("\nExamples:")
-		fmt.Println("  recover -device /dev/sdb1 -output ./recovered")
-		fmt.Println("  recover -device disk.img -fs ntfs -scan")
-		fmt.Println("  recover -device /dev/sdb1 -carve")
+	if len(os.Args) < 2 {
+		usage()
 		os.Exit(1)
 	}
+	name, args := os.Args[1], os.Args[2:]
+	if name == "help" && len(args) > 0 {
+		name, args = args[0], []string{"-h"}
+	}
+	for _, c := range commands {
+		if c.name == name {
+			c.main(args)
+			return
+		}
+	}
+	switch {
+	case name == "help", name == "-h", name == "-help", name == "--help":
+		usage()
+	case strings.HasPrefix(name, "-"):
+		legacyMain(os.Args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "recover: unknown command %q\n\n", name)
+		usage()
+		os.Exit(1)
+	}
+}
 
-	reader, err := disk.Open(*device)
+// onDevice reports whether a path is on a device, as devices.OnDevice
+// does; the tests, which have no device of their own, stand one in
+var onDevice = devices.OnDevice
+
+// run runs the scan, recovery, carve or export o describes, exiting with
+// a status other than 0 when it fails
+func run(o *options) {
+	// A run takes every step of the engine, most of which pkg/recovery does
+	// not offer, so it reads the disk itself
+	reader, err := disk.Open(o.device)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error opening device: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitSource)
 	}
 	defer reader.Close()
+	rep, events, err := o.reporter(reader)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	reader.SetReporter(rep)
+	filter, err := o.filter()
+	if err != nil {
+		reader.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	reader.SetFilter(filter)
+	reader.SetLiveFiles(o.all)
+	if o.dryRun {
+		// A dry run writes nothing, so takes nothing that does
+		if o.restoringIDs() || o.selecting || o.audit || o.caseID != "" || o.archive != "" || o.dest != "" || o.hashSource || o.exportFree || o.slack || o.timeline {
+			reader.Errorf("Error: -dry-run writes nothing; it cannot be combined with -ids, -resume, -select, -audit, -case, -archive, -dest, -hash-source, -export-free, -slack or -timeline\n")
+			os.Exit(1)
+		}
+		o.scanOnly = true
+	}
 
-	detectedFS := *fsType
+	if o.plugins != "" {
+		before := len(recovery.Types())
+		for _, path := range strings.Split(o.plugins, ",") {
+			if err := recovery.LoadPlugin(strings.TrimSpace(path)); err != nil {
+				reader.Errorf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		reader.Printf("Loaded %d formats from plugins\n", len(recovery.Types())-before)
+	}
+
+	// Ctrl-C stops the run between reads, keeping what was written; a
+	// second one kills it
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	reader.SetContext(ctx)
+	if o.execCmd != "" {
+		hook, err := newExecHook(ctx, o.execCmd)
+		if err != nil {
+			reader.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		reader.SetHook(hook)
+	}
+	notifiers, err := loadNotifiers(o.notify, o.notifyConf)
+	if err != nil {
+		reader.Errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	// From here on, a run that fails, is interrupted or completes says so
+	// to the notifiers
+	j := &job{
+		notifiers: notifiers,
+		events:    events,
+		reader:    reader,
+		started:   time.Now(),
+		device:    o.device,
+		outputDir: &o.outputDir,
+		archive:   &o.archive,
+		dest:      &o.dest,
+	}
+	// The staging directory is removed, and the destination and audit log
+	// closed, when the run ends, whatever its exit status
+	defer j.cleanup()
+
+	if o.archive != "" {
+		if _, err := output.ArchiveFormat(o.archive); err != nil {
+			reader.Errorf("Error: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+	}
+	recipients, err := output.ParseEncryption(o.encryptTo)
+	if err != nil {
+		reader.Errorf("Error: %v\n", err)
+		j.exit(exitFailed, err)
+	}
+	if len(recipients) > 0 && o.archive != "" && !strings.HasSuffix(o.archive, output.AgeSuffix) {
+		o.archive += output.AgeSuffix
+	}
+	var destination output.Destination
+	if o.dest != "" {
+		if destination, err = output.OpenDestination(o.dest); err != nil {
+			reader.Errorf("Error: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		j.atExit(func() { destination.Close() })
+	}
+	// Without a directory to keep, an archive or upload is staged in a
+	// temporary one
+	if o.archive != "" || destination != nil {
+		if !o.outputSet && o.caseID == "" {
+			staging, err := os.MkdirTemp("", "recover-")
+			if err != nil {
+				reader.Errorf("Error creating staging directory: %v\n", err)
+				j.exit(exitFailed, err)
+			}
+			j.atExit(func() { os.RemoveAll(staging) })
+			o.outputDir = staging
+			j.staged = true
+		}
+	}
+
+	// A case gives the run an output directory of its own, next to the
+	// earlier runs on the same evidence
+	if o.caseID != "" {
+		root := carver.CasesDir
+		if o.outputSet {
+			root = filepath.Join(o.outputDir, carver.CasesDir)
+		}
+		c, caseDir, err := carver.OpenCase(root, o.caseID)
+		if err != nil {
+			reader.Errorf("Error opening case: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		if o.serial == "" {
+			o.serial = devices.Serial(o.device)
+		}
+		run := c.AddRun(o.device, o.serial, reader.Size(), o.examiner, o.notes, strings.Join(os.Args, " "))
+		o.outputDir = filepath.Join(caseDir, filepath.FromSlash(run))
+		if err := os.MkdirAll(o.outputDir, 0755); err != nil {
+			reader.Errorf("Error creating output directory: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		if err := c.Save(caseDir); err != nil {
+			reader.Errorf("Error writing case file: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		reader.Printf("Case %s: writing to %s\n", c.ID, o.outputDir)
+	}
+
+	// Writing to the device being recovered overwrites the free space the
+	// deleted files are in
+	if !o.scanOnly && !o.force {
+		targets := []string{o.outputDir}
+		if o.archive != "" && destination == nil {
+			targets = append(targets, filepath.Dir(o.archive))
+		}
+		for _, target := range targets {
+			same, err := onDevice(target, o.device)
+			if err != nil {
+				reader.Warnf("Warning: could not check that %s is not on %s: %v\n", target, o.device, err)
+			} else if same {
+				reader.Errorf("Error: %s is on %s, the device being recovered; writing there would overwrite the deleted files.\n", target, o.device)
+				reader.Errorf("Choose an output on another drive, or use -force if you are sure.\n")
+				j.exit(exitFailed, fmt.Errorf("%s is on %s, the device being recovered", target, o.device))
+			}
+		}
+	}
+
+	// The log starts before anything is read, so the output directory is
+	// made early
+	if o.audit {
+		if err := os.MkdirAll(o.outputDir, 0755); err != nil {
+			reader.Errorf("Error creating output directory: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		log, err := os.Create(filepath.Join(o.outputDir, disk.AuditFile))
+		if err != nil {
+			reader.Errorf("Error creating audit log: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		j.atExit(func() {
+			reader.FlushAudit()
+			log.Close()
+		})
+		if err := reader.Audit(log); err != nil {
+			reader.Errorf("Error writing audit log: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+	}
+
+	detectedFS := o.fsType
 	if detectedFS == "auto" {
+		end := reader.Purpose("filesystem detection")
 		detectedFS, err = disk.DetectFilesystem(reader)
+		end()
+		switch {
+		case errors.Is(err, recovery.ErrUnsupportedFilesystem) && (o.carveMode || o.smart):
+			// Carving finds files without one
+		case err != nil:
+			reader.Errorf("Could not detect filesystem: %v\n", err)
+			if hint := advise(err); hint != "" {
+				reader.Errorf("%s\n", hint)
+			}
+			if errors.Is(err, recovery.ErrUnsupportedFilesystem) {
+				j.exit(exitUnsupported, err)
+			}
+			j.exit(exitFailed, err)
+		default:
+			reader.Printf("Detected filesystem: %s\n", detectedFS)
+		}
+	}
+
+	if !o.dryRun {
+		if err := os.MkdirAll(o.outputDir, 0755); err != nil {
+			reader.Errorf("Error creating output directory: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+	}
+
+	// Export the free space, file slack or timeline for other tools instead of recovering files
+	if o.exportFree {
+		if _, err := carver.ExportUnallocated(reader, o.outputDir, o.scanOnly, o.split*1024*1024); err != nil {
+			reader.Errorf("Export error: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		j.exit(exitOK, nil)
+		return
+	}
+	if o.slack {
+		if _, err := carver.ExtractSlack(reader, o.outputDir, o.scanOnly, o.slackBlob); err != nil {
+			reader.Errorf("Slack extraction error: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		j.exit(exitOK, nil)
+		return
+	}
+	if o.timeline {
+		if _, err := carver.WriteTimeline(reader, o.outputDir, o.scanOnly); err != nil {
+			reader.Errorf("Timeline error: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		j.exit(exitOK, nil)
+		return
+	}
+
+	identifyMode, err := carver.ParseIdentifyMode(o.identify)
+	if err != nil {
+		reader.Errorf("Error: %v\n", err)
+		j.exit(exitFailed, err)
+	}
+	compression, err := disk.ParseCompression(o.compress)
+	if err != nil {
+		reader.Errorf("Error: %v\n", err)
+		j.exit(exitFailed, err)
+	}
+	// Both look inside the recovered files as they lie on disk
+	if compression != disk.CompressNone && (identifyMode != carver.IdentifyOff || o.gallery) {
+		err := errors.New("-compress cannot be combined with -identify or -gallery")
+		reader.Errorf("Error: %v\n", err)
+		j.exit(exitFailed, err)
+	}
+	reader.Compress(compression)
+	reader.SyncOutput(o.syncOut)
+	reader.VerifyOutput(o.verifyOut)
+	reader.SetWorkers(o.workers)
+	if o.maxOutput != "" {
+		limit, err := disk.ParseSize(o.maxOutput)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Could not detect filesystem: %v\n", err)
-			os.Exit(1)
+			reader.Errorf("Error: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		reader.LimitOutput(limit)
+	}
+	if !o.scanOnly {
+		if free, err := devices.FreeSpace(o.outputDir); err == nil {
+			reader.PlanSpace(free, o.needSpace)
+		} else if o.needSpace {
+			reader.Errorf("Error measuring free space: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+	}
+	reportFormat, err := carver.ParseReportFormat(o.report)
+	if err != nil {
+		reader.Errorf("Error: %v\n", err)
+		j.exit(exitFailed, err)
+	}
+
+	var known *carver.HashSet
+	if o.hashSets != "" {
+		known, err = carver.LoadHashSet(strings.Split(o.hashSets, ",")...)
+		if err != nil {
+			reader.Errorf("Error loading hash set: %v\n", err)
+			j.exit(exitFailed, err)
 		}
-		fmt.Printf("Detected filesystem: %s\n", detectedFS)
+		reader.Printf("Loaded %d known file hashes\n", known.Len())
 	}
 
-	if err := os.MkdirAll(*outputDir, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating output directory: %v\n", err)
-		os.Exit(1)
+	var before disk.Digest
+	if o.hashSource {
+		reader.Println("Hashing the source before recovery...")
+		if before, err = disk.DigestSource(reader); err != nil {
+			reader.Errorf("Error hashing source: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		reader.Printf("  SHA-256: %s\n", before.SHA256)
+	}
+
+	// Each file is archived, uploaded or encrypted as soon as the run is done
+	// with it, so the copies are not all there for a step that goes back
+	// over them
+	var sender *output.Sender
+	if (o.archive != "" || destination != nil || len(recipients) > 0) && !o.scanOnly {
+		var later []string
+		if o.verifyOut {
+			later = append(later, "-verify")
+		}
+		if identifyMode != carver.IdentifyOff {
+			later = append(later, "-identify")
+		}
+		if o.gallery {
+			later = append(later, "-gallery")
+		}
+		if o.resume || o.resumeFrom != "" {
+			later = append(later, "-resume")
+		}
+		if known != nil && !o.carveMode && !o.smart {
+			later = append(later, "-hashset without -carve or -smart")
+		}
+		if len(later) > 0 {
+			err := fmt.Errorf("%s read the recovered files again once all are written, so cannot be combined with -archive, -dest or -encrypt", strings.Join(later, ", "))
+			reader.Errorf("Error: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+	}
+	switch {
+	case destination != nil && o.archive != "":
+		reader.Printf("Streaming %s to %s as files are recovered\n", filepath.Base(o.archive), destination)
+		if sender, err = output.OpenUploadArchive(o.outputDir, destination, filepath.Base(o.archive), recipients); err != nil {
+			reader.Errorf("Upload error: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+	case destination != nil:
+		reader.Printf("Uploading to %s as files are recovered\n", destination)
+		sender = output.OpenUpload(o.outputDir, destination, recipients)
+	case o.archive != "":
+		if sender, err = output.OpenArchive(o.outputDir, o.archive, recipients); err != nil {
+			reader.Errorf("Archive error: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+	case len(recipients) > 0:
+		sender = output.OpenEncryptDir(o.outputDir, recipients)
+	}
+	if sender != nil {
+		if j.staged {
+			sender.RemoveSent()
+		}
+		j.atExit(sender.Abort)
+		reader.SetSender(sender)
 	}
 
 	var recoveredFiles int
 
-	// Use carving mode if requested (bypasses filesystem parsing)
-	if *carveMode {
-		fmt.Println("Using file carving mode (signature-based recovery)...")
-		recoveredFiles, err = carver.Recover(reader, *outputDir, *scanOnly)
+	// Use carving mode if requested (bypasses filesystem parsing); smart mode
+	// carves with the same options after the filesystem recovery
+	if o.carveMode || o.smart {
+		if o.smart {
+			reader.Println("Using smart mode (filesystem recovery, then carving of unclaimed space)...")
+		} else {
+			reader.Println("Using file carving mode (signature-based recovery)...")
+		}
+		// Declared apart, so that the carve's error is the run's
+		var (
+			validateMode    carver.ValidateMode
+			fragmentClasses []carver.ContentClass
+			patterns        []*regexp.Regexp
+		)
+		validateMode, err = carver.ParseValidateMode(o.validate)
+		if err != nil {
+			reader.Errorf("Error: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		fragmentClasses, err = carver.ParseContentClasses(o.fragments)
+		if err != nil {
+			reader.Errorf("Error: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		patterns, err = carver.ParseKeywords(strings.Split(o.keywords, ","))
+		if err != nil {
+			reader.Errorf("Error: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		if o.kwFile != "" {
+			more, err := carver.LoadKeywords(o.kwFile)
+			if err != nil {
+				reader.Errorf("Error loading keywords: %v\n", err)
+				j.exit(exitFailed, err)
+			}
+			patterns = append(patterns, more...)
+		}
+		if len(patterns) > 0 && o.textMin == 0 {
+			o.textMin = carver.DefaultTextMinLength
+		}
+		opts := carver.Options{
+			SkipEmpty:      o.skipEmpty,
+			Validate:       validateMode,
+			KeepDuplicates: o.keepDups,
+			RepairJPEG:     o.repairJPEG,
+			MinConfidence:  o.minConf,
+			ByDate:         o.byDate,
+			KnownFiles:     known,
+			KeepKnown:      o.keepKnown,
+			SalvageSQLite:  o.salvage,
+			RepairMP4:      o.repairMP4,
+			MP4Reference:   o.mp4Ref,
+			RepairPDF:      o.repairPDF,
+			Depth:          o.depth,
+			FreeOnly:       o.freeOnly,
+			DFXML:          o.dfxml,
+			Report:         reportFormat,
+			Session:        true,
+			Manifest:       true,
+			Sidecars:       o.sidecars,
+			Classify:       o.classify,
+			Fragments:      fragmentClasses,
+			Text:           carver.TextOptions{MinLength: o.textMin, Patterns: patterns, Context: o.textCtx},
+		}
+		if o.checkEvery > 0 || o.resume {
+			opts.Checkpoint = filepath.Join(o.outputDir, carver.CheckpointFileName)
+			opts.CheckpointEvery = o.checkEvery * 1024 * 1024 * 1024
+			opts.Resume = o.resume
+		}
+		if o.sigFile != "" {
+			custom, err := carver.LoadSignatures(o.sigFile)
+			if err != nil {
+				reader.Errorf("Error loading signatures: %v\n", err)
+				j.exit(exitFailed, err)
+			}
+			reader.Printf("Loaded %d custom signatures from %s\n", len(custom), o.sigFile)
+			opts.Signatures = append(append([]carver.FileSignature{}, carver.Signatures...), custom...)
+		}
+		if o.dryRun {
+			recoveredFiles, err = dryRun(reader, o, opts)
+		} else if o.smart {
+			recoveredFiles, err = carver.SmartRecover(reader, o.outputDir, o.scanOnly, opts)
+			err = j.allowPartial(err)
+		} else {
+			recoveredFiles, err = carver.Recover(reader, o.outputDir, o.scanOnly, opts)
+			err = j.allowPartial(err)
+		}
+	} else if o.dryRun {
+		recoveredFiles, err = dryRun(reader, o, carver.Options{})
+	} else if o.selecting {
+		recoveredFiles, err = selectAndRestore(reader, o)
+		err = j.allowPartial(err)
+	} else if o.restoringIDs() {
+		recoveredFiles, err = restoreByID(reader, o)
+		err = j.allowPartial(err)
 	} else {
-		switch detectedFS {
-		case "ntfs":
-			recoveredFiles, err = ntfs.Recover(reader, *outputDir, *scanOnly, *carveMode)
-		case "fat32":
-			recoveredFiles, err = fat32.Recover(reader, *outputDir, *scanOnly, *carveMode)
-		default:
-			fmt.Fprintf(os.Stderr, "Unsupported filesystem: %s\n", detectedFS)
-			os.Exit(1)
+		err = fmt.Errorf("%w: %s", recovery.ErrUnsupportedFilesystem, detectedFS)
+		if fs := disk.LookupFilesystem(detectedFS); fs != nil {
+			recoveredFiles, err = fs.Recover(reader, o.outputDir, o.scanOnly)
+		}
+		if errors.Is(err, recovery.ErrUnsupportedFilesystem) {
+			reader.Errorf("Unsupported filesystem: %s\n", detectedFS)
+			reader.Errorf("%s\n", advise(err))
+			j.exit(exitUnsupported, err)
+		}
+		err = j.allowPartial(err)
+		if err == nil && known != nil && !o.scanOnly {
+			var dropped int
+			dropped, err = carver.DropKnownFiles(reader, o.outputDir, known, o.keepKnown)
+			recoveredFiles -= dropped
+		}
+		if err == nil && o.dfxml && !o.scanOnly {
+			_, err = carver.WriteDFXML(reader, o.outputDir, nil)
+		}
+		if err == nil && reportFormat != carver.ReportOff {
+			_, err = carver.WriteReport(reader, o.outputDir, reportFormat, nil, o.scanOnly)
+		}
+		if err == nil {
+			_, err = carver.WriteSession(reader, o.outputDir, carver.SessionFilesystem, nil, o.scanOnly)
+		}
+		if err == nil && o.sidecars {
+			_, err = carver.WriteSidecars(reader, o.outputDir, carver.SessionFilesystem, nil, o.scanOnly)
+		}
+		if err == nil && o.scanOnly {
+			err = printIDs(reader, o)
 		}
 	}
+	j.recovered = recoveredFiles
 
+	if errors.Is(err, context.Canceled) {
+		reader.FlushAudit()
+		where := o.outputDir
+		if sender != nil {
+			if _, err := sender.Close(); err != nil {
+				reader.Errorf("Error sending the files recovered: %v\n", err)
+			} else {
+				where = sender.String()
+			}
+		}
+		reader.Errorf("\nInterrupted: the files recovered so far are in %s\n", where)
+		j.exit(exitInterrupted, err)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Recovery error: %v\n", err)
-		os.Exit(1)
+		reader.Errorf("Recovery error: %v\n", err)
+		if hint := advise(err); hint != "" {
+			reader.Errorf("%s\n", hint)
+		}
+		j.exit(exitFailed, err)
+	}
+	if o.dryRun {
+		j.done()
+		return
+	}
+	if n, err := reader.WriteSkipped(o.outputDir); err != nil {
+		reader.Errorf("Error listing skipped files: %v\n", err)
+		j.exit(exitFailed, err)
+	} else if n > 0 {
+		reader.Printf("\nReached the output limit of %s: skipped %d files, listed in %s\n", o.maxOutput, n, filepath.Join(o.outputDir, disk.SkippedFile))
+	}
+	if n := reader.Unverified(); n > 0 {
+		reader.Warnf("Warning: %d recovered files did not verify against the source; see %s\n", n, filepath.Join(o.outputDir, disk.ManifestJSON))
+	}
+
+	if o.hashSource {
+		reader.Println("\nHashing the source after recovery...")
+		after, err := disk.DigestSource(reader)
+		if err != nil {
+			reader.Errorf("Error hashing source: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		unchanged, err := carver.RecordSourceHash(o.outputDir, before, after)
+		if err != nil {
+			reader.Errorf("Error recording source hash: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		if !unchanged {
+			err := fmt.Errorf("the source changed during recovery (SHA-256 %s, now %s)", before.SHA256, after.SHA256)
+			reader.Warnf("Warning: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		reader.Printf("  SHA-256: %s (unchanged)\n", after.SHA256)
+	}
+
+	if identifyMode != carver.IdentifyOff && !o.scanOnly {
+		if _, err := carver.Identify(o.outputDir, identifyMode, reader.Reporter()); err != nil {
+			reader.Errorf("Identification error: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+	}
+
+	if o.gallery && !o.scanOnly {
+		if _, err := carver.WriteGallery(o.outputDir, reader.Reporter()); err != nil {
+			reader.Errorf("Gallery error: %v\n", err)
+			j.exit(exitFailed, err)
+		}
 	}
 
-	fmt.Printf("\nRecovery complete. Found %d deleted files.\n", recoveredFiles)
+	reader.FlushAudit()
+	switch {
+	case destination != nil && o.archive != "":
+		n, err := sender.Close()
+		if err != nil {
+			reader.Errorf("Upload error: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		reader.Printf("\nArchived %d files to %s\n", n, destination)
+	case destination != nil:
+		n, err := sender.Close()
+		if err != nil {
+			reader.Errorf("Upload error: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		reader.Printf("\nUploaded %d files to %s\n", n, destination)
+	case o.archive != "":
+		n, err := sender.Close()
+		if err != nil {
+			reader.Errorf("Archive error: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		reader.Printf("\nArchived %d files to %s\n", n, o.archive)
+	case len(recipients) > 0:
+		n, err := sender.Close()
+		if err != nil {
+			reader.Errorf("Encryption error: %v\n", err)
+			j.exit(exitFailed, err)
+		}
+		reader.Printf("\nEncrypted %d files in %s\n", n, o.outputDir)
+	}
+
+	kind := "deleted "
+	if o.all {
+		kind = ""
+	}
+	reader.Printf("\nRecovery complete. Found %d %sfiles.\n", recoveredFiles, kind)
+	j.done()
+}
+
+// allowPartial warns of the files a recovery could not write and returns
+// nil for them: those that could be were, and are reported on as usual,
+// and the run ends with exitPartial
+func (j *job) allowPartial(err error) error {
+	var partial *recovery.PartialRecoveryError
+	if !errors.As(err, &partial) {
+		return err
+	}
+	j.failed = len(partial.Failed)
+	reader := j.reader
+	reader.Warnf("Warning: %d files could not be recovered, the first %v\n", len(partial.Failed), partial.Failed[0])
+	if hint := advise(err); hint != "" {
+		reader.Warnf("%s\n", hint)
+	}
+	return nil
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// advise says what to try after a run failed with err, or returns ""
+func advise(err error) string {
+	var readErr *recovery.ReadError
+	switch {
+	case errors.As(err, &readErr):
+		return fmt.Sprintf("The source failed a read at offset %d. If the drive is failing, image it with ddrescue and run on the image.", readErr.Offset)
+	case errors.Is(err, recovery.ErrCorruptBootSector), errors.Is(err, recovery.ErrUnsupportedFilesystem):
+		return "Use recover carve to recover files by their content, which needs no filesystem."
+	}
+	return ""
 }
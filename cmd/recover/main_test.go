@@ -0,0 +1,143 @@
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shubham/recovery/internal/carver"
+	"github.com/shubham/recovery/internal/disk/disktest"
+)
+
+// TestMain runs the recover command in place of the tests when recoverCmd
+// starts the test binary as it
+func TestMain(m *testing.M) {
+	if os.Getenv("RECOVER_CMD_TEST") == "" {
+		os.Exit(m.Run())
+	}
+	if dir := os.Getenv("RECOVER_CMD_TEST_DEVICE_DIR"); dir != "" {
+		// The paths below dir stand for those on the device recovered
+		onDevice = func(path, device string) (bool, error) {
+			rel, err := filepath.Rel(dir, path)
+			return err == nil && !strings.HasPrefix(rel, ".."), nil
+		}
+	}
+	main()
+	os.Exit(exitOK)
+}
+
+// recoverCmd returns the command that runs recover with args
+func recoverCmd(args ...string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "RECOVER_CMD_TEST=1")
+	return cmd
+}
+
+// runRecover runs recover with args, and returns its exit status and what
+// it wrote to standard output and standard error
+func runRecover(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	return runCmd(t, recoverCmd(args...))
+}
+
+// runCmd runs a command recoverCmd returned, and returns its exit status
+// and what it wrote to standard output and standard error
+func runCmd(t *testing.T, cmd *exec.Cmd) (int, string) {
+	t.Helper()
+	out, err := cmd.CombinedOutput()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return exit.ExitCode(), string(out)
+	}
+	if err != nil {
+		t.Fatalf("Failed to run recover %v: %v", cmd.Args[1:], err)
+	}
+	return exitOK, string(out)
+}
+
+func TestOutputOnSource(t *testing.T) {
+	image := disktest.Write(t, "deleted.img", disktest.Deleted(disktest.Notes))
+	device := t.TempDir() // Stands for the device recovered, which an image cannot
+	for _, c := range []struct {
+		name string
+		want int
+		args []string
+	}{
+		{"output on the device", exitFailed, []string{"restore", "-output", filepath.Join(device, "restored")}},
+		{"archive on the device", exitFailed, []string{"restore", "-output", t.TempDir(), "-archive", filepath.Join(device, "restored.zip")}},
+		{"carve on the device", exitFailed, []string{"carve", "-output", filepath.Join(device, "carved")}},
+		{"forced", exitOK, []string{"restore", "-output", filepath.Join(device, "forced"), "-force"}},
+		{"on another device", exitOK, []string{"restore", "-output", t.TempDir()}},
+		{"writing nothing", exitOK, []string{"find", "-name", "*.txt", "-list", "-output", filepath.Join(device, "listed")}},
+	} {
+		cmd := recoverCmd(append(c.args, "-device", image)...)
+		cmd.Env = append(cmd.Env, "RECOVER_CMD_TEST_DEVICE_DIR="+device)
+		got, out := runCmd(t, cmd)
+		if got != c.want {
+			t.Errorf("%s: expected exit status %d, got %d:\n%s", c.name, c.want, got, out)
+		}
+		if refused := strings.Contains(out, "the device being recovered"); refused != (c.want == exitFailed) {
+			t.Errorf("%s: expected refused %v, got:\n%s", c.name, c.want == exitFailed, out)
+		}
+	}
+	// Nothing was written where it was refused
+	for _, name := range []string{"restored", "restored.zip", "carved"} {
+		if _, err := os.Stat(filepath.Join(device, name)); err == nil {
+			t.Errorf("Expected nothing written to %s", name)
+		}
+	}
+}
+
+func TestArchiveAsRecovered(t *testing.T) {
+	image := disktest.Write(t, "deleted.img", disktest.Deleted(disktest.Notes))
+	tmp := t.TempDir()
+	archive := filepath.Join(t.TempDir(), "out.tar")
+	cmd := recoverCmd("restore", "-device", image, "-archive", archive)
+	cmd.Env = append(cmd.Env, "TMPDIR="+tmp)
+	if got, out := runCmd(t, cmd); got != exitOK {
+		t.Fatalf("Expected exit status %d, got %d:\n%s", exitOK, got, out)
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	files := make(map[string]string)
+	tr := tar.NewReader(f)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Invalid archive: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		files[h.Name] = string(data)
+	}
+	if files["_OTES.TXT"] != string(disktest.Notes) {
+		t.Errorf("Expected the recovered file in the archive, got %v", slices.Collect(maps.Keys(files)))
+	}
+	// The session knows the file was recovered, though its copy was
+	// archived and removed before the session was written
+	if !strings.Contains(files[carver.SessionFile], `"recovery": "recovered"`) {
+		t.Errorf("Expected the archived file recorded as recovered, got %s", files[carver.SessionFile])
+	}
+	if staged, _ := filepath.Glob(filepath.Join(tmp, "recover-*")); len(staged) > 0 {
+		t.Errorf("Expected no staging directory left, got %v", staged)
+	}
+
+	// Nothing is left to go back over once all are written
+	got, out := runRecover(t, "restore", "-device", image, "-archive", filepath.Join(t.TempDir(), "out.zip"), "-verify")
+	if got != exitFailed || !strings.Contains(out, "-verify read the recovered files again") {
+		t.Errorf("Expected -verify with -archive to be refused, got %d:\n%s", got, out)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/shubham/recovery/internal/mount"
+	"github.com/shubham/recovery/pkg/recovery"
+)
+
+// mountMain runs "recover mount": the files of a source, deleted ones
+// included, mounted read-only to browse and copy with the usual tools
+func mountMain(args []string) {
+	fs := flag.NewFlagSet("mount", flag.ExitOnError)
+	var (
+		device      = fs.String("device", "", "Path to device or image file (e.g., /dev/sdb1, disk.img)")
+		deletedOnly = fs.Bool("deleted", false, "Show only deleted files, with the directories that lead to them")
+	)
+	fs.Parse(args)
+	if *device == "" || fs.NArg() != 1 {
+		fmt.Println("Usage: recover mount -device <path> [-deleted] <mountpoint>")
+		fmt.Println("\nExamples:")
+		fmt.Println("  recover mount -device disk.img /mnt/recovered")
+		fmt.Println("  recover mount -device /dev/sdb -deleted /mnt/deleted")
+		os.Exit(1)
+	}
+	dir := fs.Arg(0)
+
+	source, err := recovery.Open(*device)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening device: %v\n", err)
+		os.Exit(exitSource)
+	}
+	defer source.Close()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	files, err := source.Scan(ctx)
+	stop()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Scan error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no FAT32 or NTFS files found; use recover carve to recover files by their content")
+		os.Exit(1)
+	}
+	deleted := 0
+	for _, f := range files {
+		if f.Deleted && !f.Dir {
+			deleted++
+		}
+	}
+
+	server, err := mount.Mount(source, mount.Tree(files, *deletedOnly), dir)
+	if errors.Is(err, mount.ErrUnsupported) {
+		fmt.Fprintf(os.Stderr, "Error: %v; recover the files with recover restore instead\n", err)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error mounting %s: %v\n", dir, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Mounted %d files of %s, %d of them deleted, read-only on %s\n", len(files), *device, deleted, dir)
+	fmt.Println("Press Ctrl-C, or run umount, to unmount")
+
+	// Ctrl-C unmounts once nothing has a file of it open
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for range signals {
+			if err := server.Unmount(); err != nil {
+				fmt.Fprintf(os.Stderr, "Could not unmount %s: %v; close the files open in it and press Ctrl-C again\n", dir, err)
+				continue
+			}
+			return
+		}
+	}()
+	server.Wait()
+}
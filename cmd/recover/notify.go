@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shubham/recovery/internal/carver"
+	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/internal/output"
+)
+
+// job tells the -notify and -notify-config notifiers how a run ended. The
+// run's settings are read when it ends, since a case or staging directory
+// may change where it writes after the job is made.
+type job struct {
+	notifiers []output.Notifier
+	events    []*disk.JSONEvents // Ended with the run
+	reader    *disk.Reader
+	started   time.Time
+	device    string
+	outputDir *string
+	archive   *string
+	dest      *string
+	staged    bool // The output directory is removed when the run ends
+	recovered int
+	failed    int      // Files that could not be recovered
+	cleanups  []func() // Run when the run ends, last first
+}
+
+// reportFiles are the files a run may leave in its output directory that
+// say what it did
+var reportFiles = []string{
+	carver.SessionFile, disk.ManifestJSON, "scan.json", "scan.csv", carver.DFXMLFile,
+	carver.IdentifyReportFile, disk.SkippedFile, carver.TimelineFile, carver.UnallocatedMapFile,
+}
+
+// loadNotifiers returns the notifiers the URLs of -notify and the file of
+// -notify-config set
+func loadNotifiers(urls, config string) ([]output.Notifier, error) {
+	var notifiers []output.Notifier
+	for _, u := range strings.Split(urls, ",") {
+		if u = strings.TrimSpace(u); u == "" {
+			continue
+		}
+		n, err := output.ParseNotifier(u)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	if config != "" {
+		more, err := output.LoadNotifiers(config)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, more...)
+	}
+	return notifiers, nil
+}
+
+// exit tells the event streams and notifiers the run ended with err, or
+// was interrupted for exitInterrupted, and exits with code unless it is
+// exitOK
+func (j *job) exit(code int, err error) {
+	for _, e := range j.events {
+		e.End(status(code), j.recovered, err)
+		if werr := e.Err(); werr != nil {
+			fmt.Fprintf(os.Stderr, "Error writing events: %v\n", werr)
+		}
+	}
+	j.notify(code, err)
+	if code != exitOK {
+		j.cleanup()
+		os.Exit(code)
+	}
+}
+
+// atExit has f run when the run ends, before what was given earlier. The
+// run defers cleanup, and exit runs it, since os.Exit skips deferred calls.
+func (j *job) atExit(f func()) {
+	j.cleanups = append(j.cleanups, f)
+}
+
+// cleanup runs what atExit was given, last first, once
+func (j *job) cleanup() {
+	for len(j.cleanups) > 0 {
+		f := j.cleanups[len(j.cleanups)-1]
+		j.cleanups = j.cleanups[:len(j.cleanups)-1]
+		f()
+	}
+}
+
+// status returns the status of a run that exits with code
+func status(code int) string {
+	switch code {
+	case exitOK, exitNothing, exitPartial:
+		return output.StatusCompleted
+	case exitInterrupted:
+		return output.StatusInterrupted
+	}
+	return output.StatusFailed
+}
+
+func (j *job) notify(code int, err error) {
+	if len(j.notifiers) == 0 {
+		return
+	}
+	s := output.Summary{
+		Status:     status(code),
+		Source:     j.device,
+		Recovered:  j.recovered,
+		Skipped:    len(j.reader.Skipped()),
+		Unverified: j.reader.Unverified(),
+		Started:    j.started,
+		Finished:   time.Now(),
+	}
+	if s.Status == output.StatusFailed && err != nil {
+		s.Error = err.Error()
+	}
+	s.Host, _ = os.Hostname()
+	if !j.staged {
+		s.Output, _ = filepath.Abs(*j.outputDir)
+		for _, name := range reportFiles {
+			if path := filepath.Join(s.Output, name); fileExists(path) {
+				s.Reports = append(s.Reports, path)
+			}
+		}
+	}
+	if *j.archive != "" && *j.dest == "" {
+		s.Archive = *j.archive
+	}
+	if *j.dest != "" {
+		s.Destination = *j.dest
+		if *j.archive != "" {
+			s.Destination += "/" + filepath.Base(*j.archive)
+		}
+	}
+
+	// The run was already stopped by Ctrl-C, so the notifications are not
+	// tied to its context
+	if err := output.Notify(context.Background(), j.notifiers, s); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/pkg/recovery"
+)
+
+// options are the settings of a run of scan, restore, carve or report, or
+// of the flags of earlier versions, given before any subcommand. Each
+// subcommand registers the groups of flags that apply to it.
+type options struct {
+	device        string
+	outputDir     string
+	outputSet     bool // -output was given, rather than left at its default
+	fsType        string
+	progress      string
+	logLevel      string
+	logFile       string
+	progressJSON  string
+	audit         bool
+	force         bool
+	include       string
+	exclude       string
+	pathRegex     string
+	minSize       string
+	maxSize       string
+	modAfter      string
+	modBefore     string
+	createdAfter  string
+	createdBefore string
+
+	// Restoring chosen files of a session, or those left unwritten
+	ids        string
+	idsFile    string
+	session    string
+	resumeFrom string
+
+	// What the run does; set by the subcommand
+	scanOnly   bool
+	dryRun     bool
+	all        bool // Live files are recovered too
+	carveMode  bool
+	smart      bool
+	exportFree bool
+	slack      bool
+	timeline   bool
+	report     string
+
+	// Writing recovered files
+	dfxml      bool
+	sidecars   bool
+	identify   string
+	gallery    bool
+	hashSets   string
+	keepKnown  bool
+	hashSource bool
+	maxOutput  string
+	needSpace  bool
+	compress   string
+	syncOut    bool
+	verifyOut  bool
+	workers    int
+	selecting  bool
+	execCmd    string
+	archive    string
+	dest       string
+	encryptTo  string
+
+	// Carving
+	sigFile    string
+	plugins    string
+	skipEmpty  bool
+	validate   string
+	keepDups   bool
+	repairJPEG bool
+	minConf    int
+	byDate     bool
+	salvage    bool
+	repairMP4  bool
+	repairPDF  bool
+	mp4Ref     string
+	freeOnly   bool
+	depth      int
+	classify   bool
+	fragments  string
+	textMin    int
+	keywords   string
+	kwFile     string
+	textCtx    int
+	checkEvery int64
+	resume     bool
+	split      int64
+	slackBlob  bool
+
+	// Cases and notifications
+	caseID     string
+	examiner   string
+	notes      string
+	serial     string
+	notify     string
+	notifyConf string
+}
+
+// sourceFlags registers the flags every run has: the source, where to
+// write, and how to report
+func (o *options) sourceFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.device, "device", "", "Path to device or image file (e.g., /dev/sdb1, disk.img)")
+	fs.StringVar(&o.outputDir, "output", "./recovered", "Output directory for recovered files")
+	fs.StringVar(&o.fsType, "fs", "auto", "Filesystem type: auto, "+strings.Join(recovery.Filesystems(), ", "))
+	fs.StringVar(&o.progress, "progress", "text", "How to report progress and findings: text on standard error, or json for a JSON event a line on standard output")
+	fs.StringVar(&o.logLevel, "log-level", "normal", "How much to report: quiet (errors and warnings), normal, verbose or debug")
+	fs.StringVar(&o.progressJSON, "progress-json", "", "Also write the progress, messages and end of the run as JSON events, one a line, to this file or FIFO, or - for standard error alone")
+	fs.StringVar(&o.logFile, "log-file", "", "Also log the messages of the run to this file, as JSON a line, at -log-level or normal, whichever shows more")
+	fs.BoolVar(&o.audit, "audit", false, "Log every region read from the source (time, offset, length, purpose) to <output>/audit.tsv")
+	fs.BoolVar(&o.force, "force", false, "Write the output even when it is on the device being recovered")
+}
+
+// filterFlags registers the flags that pick the files a run lists and
+// recovers by name and size
+func (o *options) filterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.include, "include", "", "Only list and recover the files matching these comma-separated globs, e.g. '*.jpg,*.docx' or 'Users/*/Documents'")
+	fs.StringVar(&o.exclude, "exclude", "", "Leave out the files matching these comma-separated globs, e.g. '*.tmp,Windows/*'")
+	fs.StringVar(&o.pathRegex, "path-regex", "", "Only keep the files whose path within their volume matches this regular expression, without case, e.g. '^Users/alice/Documents/'")
+	fs.StringVar(&o.minSize, "min-size", "", "Leave out the files and carvings smaller than this, e.g. 1 or 10K, such as zero-byte stubs")
+	fs.StringVar(&o.maxSize, "max-size", "", "Leave out the files and carvings larger than this, e.g. 2G, such as runaway carvings")
+	fs.StringVar(&o.modAfter, "modified-after", "", "Only keep the files modified on or after this date (2024-05-01, RFC 3339, or 30d for 30 days ago); FAT times are local, compared as if UTC")
+	fs.StringVar(&o.modBefore, "modified-before", "", "Only keep the files modified before this date")
+	fs.StringVar(&o.createdAfter, "created-after", "", "Only keep the files created on or after this date")
+	fs.StringVar(&o.createdBefore, "created-before", "", "Only keep the files created before this date")
+}
+
+// filter returns the filter the flags of filterFlags give
+func (o *options) filter() (*disk.Filter, error) {
+	include, err := disk.ParsePatterns(o.include)
+	if err != nil {
+		return nil, fmt.Errorf("-include: %w", err)
+	}
+	exclude, err := disk.ParsePatterns(o.exclude)
+	if err != nil {
+		return nil, fmt.Errorf("-exclude: %w", err)
+	}
+	f := &disk.Filter{Include: include, Exclude: exclude}
+	if o.pathRegex != "" {
+		if f.Path, err = disk.ParsePathRegex(o.pathRegex); err != nil {
+			return nil, fmt.Errorf("-path-regex: %w", err)
+		}
+	}
+	if o.minSize != "" {
+		if f.MinSize, err = disk.ParseSize(o.minSize); err != nil {
+			return nil, fmt.Errorf("-min-size: %w", err)
+		}
+	}
+	if o.maxSize != "" {
+		if f.MaxSize, err = disk.ParseSize(o.maxSize); err != nil {
+			return nil, fmt.Errorf("-max-size: %w", err)
+		}
+		if f.MaxSize > 0 && f.MaxSize < f.MinSize {
+			return nil, fmt.Errorf("-max-size %s is below -min-size %s", o.maxSize, o.minSize)
+		}
+	}
+	for _, bound := range []struct {
+		flag, value string
+		t           *time.Time
+	}{
+		{"-modified-after", o.modAfter, &f.ModifiedAfter},
+		{"-modified-before", o.modBefore, &f.ModifiedBefore},
+		{"-created-after", o.createdAfter, &f.CreatedAfter},
+		{"-created-before", o.createdBefore, &f.CreatedBefore},
+	} {
+		if bound.value == "" {
+			continue
+		}
+		if *bound.t, err = parseTime(bound.value, time.Now()); err != nil {
+			return nil, fmt.Errorf("%s: %w", bound.flag, err)
+		}
+	}
+	return f, nil
+}
+
+// parseTime parses a bound of a date filter: a date, taken as UTC like the
+// times FAT keeps, a time in RFC 3339, or a number of days before now
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	for _, layout := range []string{time.DateOnly, time.RFC3339, time.DateTime} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q (want 2024-05-01, 2024-05-01T15:04:05Z or 30d)", s)
+}
+
+// idFlags registers the flags of a restore of chosen files of the session
+// manifest of an earlier scan
+func (o *options) idFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.ids, "ids", "", "Only restore the files with these ids in the session manifest, e.g. 23,118-120, without scanning again")
+	fs.StringVar(&o.idsFile, "ids-file", "", "Only restore the files with the ids in this file, one or more a line, or - for standard input")
+	fs.StringVar(&o.session, "session", "", "Session manifest whose ids -ids gives (default <output>/session.json)")
+	fs.BoolVar(&o.selecting, "select", false, "Scan, then choose the deleted files to restore at a prompt, by id, range or search")
+	fs.StringVar(&o.resumeFrom, "resume", "", "Restore the files of this session manifest that no run has written to -output yet, checking the copies there by size and hash")
+}
+
+// restoringIDs reports whether the run restores files of a session
+// manifest, chosen by id or left unwritten, instead of scanning
+func (o *options) restoringIDs() bool {
+	return o.ids != "" || o.idsFile != "" || o.resumeFrom != ""
+}
+
+// caseFlags registers the flags that keep a run with the others of a case
+// and tell how it ended
+func (o *options) caseFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.caseID, "case", "", "Keep this run with the others of a case, in cases/<case-id>/<evidence>/<run> below -output (default .)")
+	fs.StringVar(&o.examiner, "examiner", "", "Examiner to record in the case")
+	fs.StringVar(&o.notes, "notes", "", "Notes to record with the run in the case")
+	fs.StringVar(&o.serial, "serial", "", "Serial number of the source to record in the case (default: read from the drive)")
+	fs.StringVar(&o.notify, "notify", "", "Comma-separated webhooks (https://...), mail servers (smtp://user@host:587?from=...&to=...) and files (file:///path) to tell how the run ended")
+	fs.StringVar(&o.notifyConf, "notify-config", "", "YAML/JSON file of webhooks, with their headers, and mail settings to tell how the run ended")
+}
+
+// writeFlags registers the flags of runs that write recovered files: how
+// they are written, checked, described and delivered
+func (o *options) writeFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.dfxml, "dfxml", false, "Describe every file found (byte runs, hashes, times, deleted flag) in <output>/files.dfxml")
+	fs.BoolVar(&o.sidecars, "sidecar", false, "Write a <file>.meta.json next to each recovered file with its original path, MFT record or clusters, times, deleted flag and hashes")
+	fs.StringVar(&o.report, "report", "off", "Write what the scan found (volumes, files, data runs, status) for other tools to <output>/scan.<format>: off, json, csv")
+	fs.StringVar(&o.identify, "identify", "off", "Check recovered files' extensions against their content: off, report, rename")
+	fs.BoolVar(&o.gallery, "gallery", false, "Write gallery.html to the output directory, previewing the recovered pictures and videos")
+	fs.StringVar(&o.hashSets, "hashset", "", "Comma-separated hash sets of known files (NSRL NSRLFile.txt, md5sum/sha1sum/sha256sum lists) to skip")
+	fs.BoolVar(&o.keepKnown, "keep-known", false, "Keep only the files in -hashset instead of skipping them")
+	fs.BoolVar(&o.hashSource, "hash-source", false, "Hash the whole source before and after recovery and record both in <output>/session.json")
+	fs.StringVar(&o.maxOutput, "max-output-size", "", "Stop writing recovered files once they take this much space, e.g. 500G (default: no limit)")
+	fs.BoolVar(&o.needSpace, "require-space", false, "Stop before recovering when the files found may not fit in the free space of the output, instead of warning")
+	fs.StringVar(&o.compress, "compress", "", "Write each recovered file compressed, with .zst added to its name: zstd or none")
+	fs.BoolVar(&o.syncOut, "sync", false, "Flush each recovered file to the drive before giving it its name, so it survives a power cut")
+	fs.IntVar(&o.workers, "j", 1, "Write up to this many recovered files at once, which is faster from an SSD or image to a fast destination")
+	fs.BoolVar(&o.verifyOut, "verify", false, "Once files are written, read their source and copies again and record in hashes.json whether they still match")
+	fs.StringVar(&o.execCmd, "exec", "", "Run this command for each recovered file, {} standing for its path, with its details in RECOVER_* variables")
+	fs.StringVar(&o.archive, "archive", "", "Add each recovered file to this archive (.zip, .tar, .tar.gz or .tar.zst) as it is written instead of leaving a directory")
+	fs.StringVar(&o.dest, "dest", "", "Upload each recovered file (or the -archive, streamed) to this destination as it is written: s3://bucket/prefix or sftp://user@host/path")
+	fs.StringVar(&o.encryptTo, "encrypt", "", "Encrypt the output or -archive with age: age:<recipient>[,<recipient>...] or passphrase (from $RECOVER_PASSPHRASE)")
+}
+
+// carveFlags registers the flags of carving, and of smart mode, which
+// carves what the filesystem recovery leaves
+func (o *options) carveFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.smart, "smart", false, "Recover deleted files by name, then carve only the space they and live files leave unclaimed")
+	fs.StringVar(&o.sigFile, "signatures", "", "YAML/JSON or scalpel .conf file with additional carving signatures")
+	fs.StringVar(&o.plugins, "plugins", "", "Comma-separated Go plugins (.so) adding carving signatures with their own sizing and validation")
+	fs.BoolVar(&o.skipEmpty, "skip-empty", false, "Skip all-zero and constant-fill regions while carving")
+	fs.StringVar(&o.validate, "validate", "off", "Validate carved files: off, report, quarantine, discard")
+	fs.BoolVar(&o.keepDups, "keep-duplicates", false, "Keep carvings whose content duplicates an earlier one")
+	fs.BoolVar(&o.repairJPEG, "repair-jpeg", false, "Reassemble JPEGs split into two fragments (gap carving)")
+	fs.IntVar(&o.minConf, "min-confidence", 0, "Skip carving hits scored below this confidence (0-100)")
+	fs.BoolVar(&o.byDate, "by-date", false, "File carved photos by the date they were taken (YYYY/MM), from EXIF")
+	fs.BoolVar(&o.salvage, "sqlite-salvage", false, "Salvage rows from orphaned pages of carved SQLite databases")
+	fs.BoolVar(&o.repairMP4, "repair-mp4", false, "Rebuild the missing index (moov) of carved MP4/MOV videos")
+	fs.BoolVar(&o.repairPDF, "repair-pdf", false, "Rebuild the missing cross-reference table of carved PDFs")
+	fs.StringVar(&o.mp4Ref, "mp4-reference", "", "Intact video from the same camera to take codec settings from when repairing MP4/MOV")
+	fs.BoolVar(&o.freeOnly, "free-only", false, "Carve only the clusters the FAT32/NTFS volumes have not allocated")
+	fs.IntVar(&o.depth, "depth", 0, "Carve inside virtual disks and ZIP archives this many levels deep (0 = off)")
+	fs.BoolVar(&o.classify, "classify", false, "Report what the space outside carved files holds: text, compressed, encrypted, ...")
+	fs.StringVar(&o.fragments, "fragments", "", "Write headerless regions of these content classes to _fragments (e.g. text,utf16 or all)")
+	fs.IntVar(&o.textMin, "text", 0, "Carve runs of UTF-8/UTF-16 text at least this many characters long to _text (0 = off)")
+	fs.StringVar(&o.keywords, "keywords", "", "Comma-separated keywords or /regexes/ that carved text must contain")
+	fs.StringVar(&o.kwFile, "keyword-file", "", "File of keywords or /regexes/ that carved text must contain, one per line")
+	fs.IntVar(&o.textCtx, "text-context", 40, "Characters of context to report either side of a keyword hit")
+	fs.Int64Var(&o.checkEvery, "checkpoint-every", 10, "Save a carving checkpoint every N gigabytes (0 = off)")
+	fs.BoolVar(&o.resume, "resume", false, "Resume an interrupted carve from its checkpoint")
+}
+
+// exportFlags registers the flags that export raw space for other tools
+// instead of recovering files
+func (o *options) exportFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.exportFree, "export-free", false, "Export the unallocated clusters to files in <output>/unallocated, with an offset map")
+	fs.Int64Var(&o.split, "export-split", 0, "Start a new export file every N megabytes (0 = one file)")
+	fs.BoolVar(&o.slack, "slack", false, "Extract the slack of files in use (the tail of their last cluster) to <output>/slack")
+	fs.BoolVar(&o.slackBlob, "slack-blob", false, "Write slack to one file with a map of where it came from, instead of a file per file")
+}
+
+// parse parses the arguments of a run, noting whether -output was given
+func (o *options) parse(fs *flag.FlagSet, args []string) {
+	fs.Parse(args)
+	fs.Visit(func(f *flag.Flag) { o.outputSet = o.outputSet || f.Name == "output" })
+}
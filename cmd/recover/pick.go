@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/shubham/recovery/internal/carver"
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// pickShown is how many files a listing of the picker shows; a search
+// narrows a longer one
+const pickShown = 50
+
+// pickHelp is what the picker prints for ? and before its first prompt
+const pickHelp = `Choose the files to restore:
+  23,118-120   choose the files with these ids
+  -23          drop a file from the choice
+  a            choose every file listed (all, or those the last search found)
+  n            choose none
+  /report      list the files whose path has "report" in it, or matches a
+               pattern such as /*.docx; / alone lists them all
+  l            list the files chosen
+  d            done: restore the files chosen
+  q            quit without restoring anything
+`
+
+// pick lets the person at in and out choose among files, by the ids they
+// are listed with, and returns the ids chosen, in order; none when they
+// quit, or the input ends before they are done, as a script cut short or
+// a stray Ctrl-D does
+func pick(in io.Reader, out io.Writer, files []carver.SessionEntry) ([]int, error) {
+	chosen := make(map[int]bool)
+	shown := files // By the last search
+	list := func(entries []carver.SessionEntry) {
+		for i, f := range entries {
+			if i == pickShown {
+				fmt.Fprintf(out, "  ... and %d more; search to narrow them\n", len(entries)-i)
+				break
+			}
+			mark := " "
+			if chosen[f.ID] {
+				mark = "*"
+			}
+			fmt.Fprintf(out, "%s %12d  %s (%s, %s)\n", mark, f.ID, f.Path, disk.FormatSize(f.Size), f.Recoverable)
+		}
+	}
+
+	fmt.Fprint(out, pickHelp)
+	fmt.Fprintln(out)
+	list(files)
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(out, "\n%d of %d chosen> ", len(chosen), len(files))
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return nil, scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case line == "?" || line == "h":
+			fmt.Fprint(out, pickHelp)
+		case line == "q":
+			return nil, nil
+		case line == "d":
+			return sortedIDs(chosen), nil
+		case line == "a":
+			for _, f := range shown {
+				chosen[f.ID] = true
+			}
+		case line == "n":
+			clear(chosen)
+		case line == "l" && len(chosen) == 0:
+			fmt.Fprintln(out, "Nothing is chosen yet")
+		case line == "l":
+			var entries []carver.SessionEntry
+			for _, f := range files {
+				if chosen[f.ID] {
+					entries = append(entries, f)
+				}
+			}
+			list(entries)
+		case strings.HasPrefix(line, "/"):
+			shown = search(files, line[1:])
+			fmt.Fprintf(out, "%d files:\n", len(shown))
+			list(shown)
+		default:
+			drop := strings.HasPrefix(line, "-")
+			ids, err := carver.ParseIDs(strings.NewReader(strings.TrimPrefix(line, "-")))
+			if err != nil {
+				fmt.Fprintf(out, "%v; ? for help\n", err)
+				continue
+			}
+			for _, r := range ids {
+				// A range is matched against the files listed, not spelled out
+				var in []int
+				for _, f := range files {
+					if r.First <= f.ID && f.ID <= r.Last {
+						in = append(in, f.ID)
+					}
+				}
+				switch {
+				case len(in) > 0:
+				case r.First == r.Last:
+					fmt.Fprintf(out, "No file listed has id %d\n", r.First)
+				default:
+					fmt.Fprintf(out, "No file listed has an id in %d-%d\n", r.First, r.Last)
+				}
+				for _, id := range in {
+					if drop {
+						delete(chosen, id)
+					} else {
+						chosen[id] = true
+					}
+				}
+			}
+		}
+	}
+}
+
+// search returns the files whose path has text in it, in any case, or
+// whose name or path matches it as a pattern such as *.docx
+func search(files []carver.SessionEntry, text string) []carver.SessionEntry {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "" {
+		return files
+	}
+	var found []carver.SessionEntry
+	for _, f := range files {
+		p := strings.ToLower(f.Path)
+		if strings.Contains(p, text) {
+			found = append(found, f)
+		} else if ok, _ := path.Match(text, path.Base(p)); ok {
+			found = append(found, f)
+		} else if ok, _ := path.Match(text, p); ok {
+			found = append(found, f)
+		}
+	}
+	return found
+}
+
+func sortedIDs(chosen map[int]bool) []int {
+	ids := make([]int, 0, len(chosen))
+	for id := range chosen {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
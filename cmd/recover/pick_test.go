@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shubham/recovery/internal/carver"
+)
+
+func TestPick(t *testing.T) {
+	var files []carver.SessionEntry
+	for i, p := range []string{"Documents/report.docx", "Documents/budget.xlsx", "Photos/IMG_0001.JPG", "Photos/IMG_0002.JPG", "notes.txt"} {
+		files = append(files, carver.SessionEntry{ReportEntry: carver.ReportEntry{ID: i + 1, Path: p, Size: 1000}})
+	}
+
+	for _, c := range []struct {
+		name  string
+		input string
+		want  []int
+		out   string // Printed
+	}{
+		{"ids and ranges", "2,4-5\nd\n", []int{2, 4, 5}, ""},
+		{"ranges over lines", "1\n3-4\nd\n", []int{1, 3, 4}, ""},
+		{"all", "a\nd\n", []int{1, 2, 3, 4, 5}, ""},
+		{"all but one", "a\n-3\nd\n", []int{1, 2, 4, 5}, ""},
+		{"all of a search", "/img_\na\nd\n", []int{3, 4}, "2 files:"},
+		{"all of a pattern", "/*.docx\na\nd\n", []int{1}, "1 files:"},
+		{"none", "a\nn\nd\n", []int{}, ""},
+		{"listed", "5\nl\nd\n", []int{5}, "*            5  notes.txt"},
+		{"bad input", "one\n2\nd\n", []int{2}, "; ? for help"},
+		{"unknown id", "2,9\nd\n", []int{2}, "No file listed has id 9"},
+		{"unknown range", "2,100-200\nd\n", []int{2}, "No file listed has an id in 100-200"},
+		{"wide range", "3-9000000000000000000\n-4\nd\n", []int{3, 5}, ""},
+		{"empty lines", "\n\n4\n\nd\n", []int{4}, ""},
+		{"empty input", "", nil, ""},
+		{"end of input", "1,2\n", nil, ""},
+		{"end of input on a line", "1,2", nil, ""},
+		{"quit", "1,2\nq\n", nil, ""},
+	} {
+		var out strings.Builder
+		got, err := pick(strings.NewReader(c.input), &out, files)
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: expected %v, got %v (%v)", c.name, c.want, got, err)
+		}
+		if !strings.Contains(out.String(), c.out) {
+			t.Errorf("%s: expected %q printed, got:\n%s", c.name, c.out, out.String())
+		}
+	}
+}
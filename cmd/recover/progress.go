@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// reporter returns what tells the person and the programs following a run
+// what it does, as -progress, -progress-json, -log-level and -log-file
+// say, and the event streams to end when the run ends
+func (o *options) reporter(reader *disk.Reader) (disk.ProgressReporter, []*disk.JSONEvents, error) {
+	level, err := disk.ParseLevel(o.logLevel)
+	if err != nil {
+		return nil, nil, err
+	}
+	var events []*disk.JSONEvents
+	var rep disk.ProgressReporter
+	switch o.progress {
+	case "text":
+		// A terminal shows a bar, redrawn in place; a log gets lines. Events
+		// on standard error are all it gets.
+		switch {
+		case o.progressJSON == "-":
+			rep = disk.NewPrinter(io.Discard)
+		case isTerminal(os.Stderr):
+			rep = disk.NewBar(os.Stderr, func() int64 { return reader.Stats().Bytes })
+		default:
+			rep = disk.NewPrinter(os.Stderr)
+		}
+	case "json":
+		e := disk.NewJSONEvents(os.Stdout)
+		rep, events = e, append(events, e)
+	default:
+		return nil, nil, fmt.Errorf("unknown progress format %q (want text or json)", o.progress)
+	}
+
+	logger := disk.NewLogger(rep, level)
+	if o.logFile != "" {
+		log, err := os.Create(o.logFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("creating log file: %w", err)
+		}
+		logger.LogTo(log)
+	}
+	if o.progressJSON == "" {
+		return logger, events, nil
+	}
+
+	// Opening a FIFO waits for the program that reads it
+	w := os.Stderr
+	if o.progressJSON != "-" {
+		if w, err = os.OpenFile(o.progressJSON, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+			return nil, nil, fmt.Errorf("opening progress stream: %w", err)
+		}
+	}
+	e := disk.NewJSONEvents(w)
+	events = append(events, e)
+	return disk.MultiReporter(logger, disk.NewLogger(e, max(level, disk.LevelInfo))), events, nil
+}
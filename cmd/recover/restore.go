@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shubham/recovery/internal/carver"
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// sessionPath returns the session manifest a run reads ids from
+func (o *options) sessionPath() string {
+	if o.session != "" {
+		return o.session
+	}
+	return filepath.Join(o.outputDir, carver.SessionFile)
+}
+
+// restoreByID restores the files -ids and -ids-file give from the session
+// manifest of an earlier scan, or with -resume those no run has written
+func restoreByID(reader *disk.Reader, o *options) (int, error) {
+	if o.resumeFrom != "" {
+		if o.ids != "" || o.idsFile != "" || o.session != "" {
+			return 0, fmt.Errorf("-resume restores every file left unwritten; it takes no -ids, -ids-file or -session")
+		}
+		return carver.Resume(reader, o.resumeFrom, o.outputDir)
+	}
+	var sources []io.Reader
+	if o.ids != "" {
+		sources = append(sources, strings.NewReader(o.ids+"\n"))
+	}
+	switch o.idsFile {
+	case "":
+	case "-":
+		sources = append(sources, os.Stdin)
+	default:
+		f, err := os.Open(o.idsFile)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		sources = append(sources, f)
+	}
+	ids, err := carver.ParseIDs(io.MultiReader(sources...))
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, fmt.Errorf("no ids given")
+	}
+	return carver.RestoreIDs(reader, o.sessionPath(), o.outputDir, ids)
+}
+
+// selectAndRestore scans the source's volumes, lets the person running it
+// choose among the deleted files found, or with -all among every file, and
+// restores those chosen
+func selectAndRestore(reader *disk.Reader, o *options) (int, error) {
+	if o.restoringIDs() || o.session != "" {
+		return 0, fmt.Errorf("-select chooses the files of its own scan; it takes no -ids, -ids-file, -resume or -session")
+	}
+	if _, err := carver.WriteSession(reader, o.outputDir, carver.SessionFilesystem, nil, true); err != nil {
+		return 0, err
+	}
+	sessionPath := filepath.Join(o.outputDir, carver.SessionFile)
+	session, err := carver.LoadSession(sessionPath)
+	if err != nil {
+		return 0, err
+	}
+	var files []carver.SessionEntry
+	for _, f := range session.Restorable() {
+		if f.Status == "deleted" || o.all {
+			files = append(files, f)
+		}
+	}
+	kind := "deleted "
+	if o.all {
+		kind = ""
+	}
+	if len(files) == 0 {
+		reader.Printf("No %sfiles with data left were found\n", kind)
+		return 0, nil
+	}
+
+	reader.Printf("\nFound %d %sfiles with data left.\n", len(files), kind)
+	ids, err := pick(os.Stdin, os.Stderr, files)
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		reader.Println("Nothing chosen; nothing was restored")
+		return 0, nil
+	}
+	chosen := make(carver.IDs, len(ids))
+	for i, id := range ids {
+		chosen[i] = carver.IDRange{First: id, Last: id}
+	}
+	return carver.RestoreIDs(reader, sessionPath, o.outputDir, chosen)
+}
+
+// printIDs lists the files of the session manifest a scan wrote with the
+// ids to restore them by
+func printIDs(reader *disk.Reader, o *options) error {
+	session, err := carver.LoadSession(o.sessionPath())
+	if err != nil {
+		return err
+	}
+	files := session.Restorable()
+	if len(files) == 0 {
+		return nil
+	}
+	reader.Printf("\nFiles to restore by id, with recover restore -device %s -ids <id>,...:\n\n", o.device)
+	for _, f := range files {
+		status := f.Status
+		if f.Recoverable != "complete" {
+			status += ", " + f.Recoverable
+		}
+		reader.Printf("%12d  %s (%d bytes, %s)\n", f.ID, f.Path, f.Size, status)
+	}
+	return nil
+}
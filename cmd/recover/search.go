@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/shubham/recovery/internal/carver"
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// searchMain runs "recover search": a keyword search of the raw device
+func searchMain(args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	var (
+		device   = fs.String("device", "", "Path to device or image file (e.g., /dev/sdb1, disk.img)")
+		keywords = fs.String("keywords", "", "Comma-separated keywords or /regexes/ to search for")
+		kwFile   = fs.String("keyword-file", "", "File of keywords or /regexes/ to search for, one per line")
+		context  = fs.Int("context", carver.DefaultSearchContext, "Characters of context to show either side of a hit")
+		hexDump  = fs.Bool("hex", false, "Show the context of each hit as a hex dump too")
+		maxHits  = fs.Int("max-hits", 0, "Stop after this many hits (0 = no limit)")
+	)
+	fs.Parse(args)
+
+	if *device == "" || (*keywords == "" && *kwFile == "") {
+		fmt.Println("Usage: recover search -device <path> -keywords <list> [-keyword-file <file>] [-context N] [-hex]")
+		fmt.Println("\nExamples:")
+		fmt.Println("  recover search -device disk.img -keywords password,secret")
+		fmt.Println("  recover search -device /dev/sdb -keywords '/\\d{4}-\\d{4}-\\d{4}-\\d{4}/' -hex")
+		os.Exit(1)
+	}
+
+	patterns, err := carver.ParseKeywords(strings.Split(*keywords, ","))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *kwFile != "" {
+		more, err := carver.LoadKeywords(*kwFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading keywords: %v\n", err)
+			os.Exit(1)
+		}
+		patterns = append(patterns, more...)
+	}
+
+	reader, err := disk.Open(*device)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening device: %v\n", err)
+		os.Exit(exitSource)
+	}
+	defer reader.Close()
+
+	opts := carver.SearchOptions{Patterns: patterns, Context: *context, Hex: *hexDump, MaxHits: *maxHits}
+	if _, err := carver.SearchDisk(reader, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Search error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/shubham/recovery/internal/server"
+)
+
+// serveMain runs "recover serve": the engine as a long-running service,
+// whose clients scan the machine's devices and recover files from them
+func serveMain(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	var (
+		grpcAddr  = fs.String("grpc", "", "Serve the gRPC API (package pkg/rpc) on this address, e.g. :9000")
+		httpAddr  = fs.String("http", "", "Serve the HTTP API (/api/v1) on this address, e.g. :8080")
+		webAddr   = fs.String("web", "", "Serve the browser UI, with the HTTP API it runs on, on this address, e.g. :8080")
+		metrics   = fs.String("metrics", "", "Serve Prometheus metrics at /metrics on this address, e.g. :9100")
+		outputDir = fs.String("output", "./recovered", "Directory recoveries write below, each to a directory of its own")
+		keep      = fs.Duration("keep", 24*time.Hour, "Forget jobs this long after they end, closing the devices of scans; 0 keeps them until the service stops")
+		tlsCert   = fs.String("tls-cert", "", "Certificate to serve over TLS with, in PEM")
+		tlsKey    = fs.String("tls-key", "", "Private key of -tls-cert, in PEM")
+		clientCA  = fs.String("tls-client-ca", "", "Only serve clients with a certificate signed by this CA, in PEM")
+	)
+	fs.Parse(args)
+
+	if *grpcAddr == "" && *httpAddr == "" && *webAddr == "" {
+		fmt.Println("Usage: recover serve [-grpc <address>] [-http <address>] [-web <address>] [-metrics <address>] [-output <dir>] [-keep <duration>] [-tls-cert <file> -tls-key <file> [-tls-client-ca <file>]]")
+		fmt.Println("\nAn address with no host, such as :9000, is served on the loopback interface. Any other")
+		fmt.Println("is only served over TLS, to clients giving the token in $" + server.TokenEnv + " or a certificate")
+		fmt.Println("signed by -tls-client-ca.")
+		fmt.Println("\nExamples:")
+		fmt.Println("  recover serve -grpc :9000 -output /srv/recovered")
+		fmt.Println("  recover serve -grpc :9000 -metrics :9100")
+		fmt.Println("  recover serve -http :8080")
+		fmt.Println("  recover serve -web :8080")
+		fmt.Println("  " + server.TokenEnv + "=... recover serve -grpc 0.0.0.0:9000 -tls-cert lab-3.pem -tls-key lab-3.key")
+		fmt.Println("  recover serve -grpc 0.0.0.0:9000 -tls-cert lab-3.pem -tls-key lab-3.key -tls-client-ca lab-ca.pem")
+		os.Exit(1)
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fmt.Fprintln(os.Stderr, "Error: -tls-cert and -tls-key go together")
+		os.Exit(1)
+	}
+	if *clientCA != "" && *tlsCert == "" {
+		fmt.Fprintln(os.Stderr, "Error: -tls-client-ca needs -tls-cert and -tls-key")
+		os.Exit(1)
+	}
+	token := os.Getenv(server.TokenEnv)
+	var tlsConfig *tls.Config
+	if *tlsCert != "" {
+		var err error
+		if tlsConfig, err = loadTLS(*tlsCert, *tlsKey, *clientCA); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading TLS certificate: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	// Only a service whose clients authenticate, over TLS, is served to
+	// other machines
+	secure := tlsConfig != nil && (token != "" || *clientCA != "")
+	if err := os.MkdirAll(*outputDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating output directory: %v\n", err)
+		os.Exit(1)
+	}
+	m := server.NewManager(*outputDir)
+	if *keep > 0 {
+		go func() {
+			for range time.Tick(min(*keep, time.Minute)) {
+				m.Expire(*keep)
+			}
+		}()
+	}
+
+	// Each API serves until the service stops, and stopping it makes
+	// Serve return
+	var serving []func() error
+	var stopping []func()
+	if *grpcAddr != "" {
+		var opts []grpc.ServerOption
+		if tlsConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+		if token != "" {
+			opts = append(opts, server.GRPCToken(token)...)
+		}
+		srv := server.NewGRPC(m, opts...)
+		lis, err := server.Listen(*grpcAddr, secure)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Serving gRPC on %s\n", lis.Addr())
+		serving = append(serving, func() error { return srv.Serve(lis) })
+		stopping = append(stopping, srv.GracefulStop)
+	}
+	serveHTTP := func(name, addr string, handler http.Handler) {
+		srv := &http.Server{Handler: server.RequireToken(token, handler), TLSConfig: tlsConfig}
+		lis, err := server.Listen(addr, secure)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		scheme := "http"
+		if tlsConfig != nil {
+			scheme = "https"
+		}
+		fmt.Fprintf(os.Stderr, "Serving %s on %s://%s\n", name, scheme, lis.Addr())
+		serving = append(serving, func() error {
+			var err error
+			if tlsConfig != nil {
+				err = srv.ServeTLS(lis, "", "")
+			} else {
+				err = srv.Serve(lis)
+			}
+			if errors.Is(err, http.ErrServerClosed) {
+				return nil
+			}
+			return err
+		})
+		stopping = append(stopping, func() { srv.Shutdown(context.Background()) })
+	}
+	if *httpAddr != "" {
+		serveHTTP("the HTTP API", *httpAddr, server.NewHandler(m))
+	}
+	if *webAddr != "" {
+		serveHTTP("the browser UI", *webAddr, server.NewWebHandler(m))
+	}
+	if *metrics != "" {
+		serveHTTP("metrics", *metrics, server.NewMetricsHandler(m))
+	}
+	fmt.Fprintf(os.Stderr, "Recovering to %s\n", *outputDir)
+
+	// Ctrl-C or SIGTERM cancels the jobs, keeping what they wrote, and
+	// stops once the clients have been answered
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		fmt.Fprintln(os.Stderr, "Stopping: canceling the jobs still running...")
+		m.Close()
+		for _, stop := range stopping {
+			stop()
+		}
+	}()
+
+	errs := make(chan error, len(serving))
+	for _, serve := range serving {
+		go func() { errs <- serve() }()
+	}
+	for range serving {
+		if err := <-errs; err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// loadTLS loads the certificate the service is served with, and the CA
+// its clients' certificates must be signed by, if any
+func loadTLS(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", caFile)
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
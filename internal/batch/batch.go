@@ -0,0 +1,273 @@
+// Package batch runs the recover command over many sources, such as a tray
+// of drives or a folder of images, one after another or a few at a time.
+// Each source is recovered by a run of its own, in a process of its own, so
+// that a drive that hangs or crashes the run takes no other with it. A run
+// writes to a directory of its own below the batch's output, with its log
+// and the summary it ends with, and the batch adds up the summaries in
+// batch.json and batch.csv.
+package batch
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/internal/output"
+)
+
+// Files a batch writes
+const (
+	LogFile     = "recover.log"  // In the directory of each source: what its run printed
+	SummaryFile = "summary.json" // And how it ended
+	JSONFile    = "batch.json"   // In the batch's output: the summaries of all the sources
+	CSVFile     = "batch.csv"
+)
+
+// Task is a source to recover, and the directory its run writes to
+type Task struct {
+	Source string
+	Output string
+}
+
+// Tasks returns the tasks of sources, each writing to a directory below
+// outputDir named after the source: /dev/sdb to sdb, and a second image
+// named disk.img to "disk (2).img"
+func Tasks(sources []string, outputDir string) []Task {
+	names := disk.NewNames()
+	tasks := make([]Task, len(sources))
+	for i, src := range sources {
+		tasks[i] = Task{Source: src, Output: filepath.Join(outputDir, names.Claim(filepath.Base(src)))}
+	}
+	return tasks
+}
+
+// Result is how the run of a task ended
+type Result struct {
+	Task
+	Summary  output.Summary
+	ExitCode int    // Of the run; -1 when it was not started
+	Log      string // What it printed
+}
+
+// Run runs each task with fn, at most parallel at once, starting them in
+// the order given, and returns their results in that order. done, when
+// not nil, is called with each result as its task ends. Once ctx is done,
+// no more tasks are started, and those left are reported interrupted.
+func Run(ctx context.Context, tasks []Task, parallel int, fn func(context.Context, Task) Result, done func(Result)) []Result {
+	parallel = max(parallel, 1)
+	results := make([]Result, len(tasks))
+	slots := make(chan struct{}, parallel)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, t := range tasks {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			now := time.Now()
+			results[i] = Result{Task: t, ExitCode: -1, Summary: output.Summary{
+				Status: output.StatusInterrupted, Error: "not started", Source: t.Source, Started: now, Finished: now,
+			}}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			r := fn(ctx, t)
+			results[i] = r
+			if done != nil {
+				mu.Lock()
+				done(r)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// Command returns a function running a task as the recover command exe,
+// with the flags given, which may start with a subcommand such as carve,
+// and the task's -device and -output. The run is told
+// to write its summary to the task's directory with a file:// notifier,
+// added to those of -notify in flags, if any.
+func Command(exe string, flags []string) func(context.Context, Task) Result {
+	return func(ctx context.Context, t Task) Result {
+		started := time.Now()
+		r := Result{Task: t, ExitCode: -1, Log: filepath.Join(t.Output, LogFile)}
+		fail := func(err error) Result {
+			r.Summary = output.Summary{Status: output.StatusFailed, Error: err.Error(), Source: t.Source, Started: started, Finished: time.Now()}
+			return r
+		}
+		if err := os.MkdirAll(t.Output, 0755); err != nil {
+			return fail(err)
+		}
+		log, err := os.Create(r.Log)
+		if err != nil {
+			return fail(err)
+		}
+		defer log.Close()
+		summary, err := filepath.Abs(filepath.Join(t.Output, SummaryFile))
+		if err != nil {
+			return fail(err)
+		}
+		os.Remove(summary) // Of an earlier batch
+
+		args := append(withNotifier(flags, "file://"+filepath.ToSlash(summary)), "-device", t.Source, "-output", t.Output)
+		cmd := exec.CommandContext(ctx, exe, args...)
+		cmd.Stdout, cmd.Stderr = log, log
+		// Ctrl-C reaches the runs as well, since they share the terminal,
+		// and stops them keeping what they wrote; another would kill them
+		cmd.Cancel = func() error { return nil }
+		runErr := cmd.Run()
+		if cmd.ProcessState != nil {
+			r.ExitCode = cmd.ProcessState.ExitCode()
+		}
+
+		data, err := os.ReadFile(summary)
+		if err == nil {
+			err = json.Unmarshal(data, &r.Summary)
+		}
+		if err == nil {
+			return r
+		}
+		// The run ended before it could say how, such as on a source that
+		// could not be opened: its last line says why
+		r = fail(errors.New(lastLine(r.Log)))
+		if runErr != nil && r.Summary.Error == "" {
+			r.Summary.Error = runErr.Error()
+		}
+		if r.ExitCode == 130 || ctx.Err() != nil {
+			r.Summary.Status = output.StatusInterrupted
+		}
+		return r
+	}
+}
+
+// withNotifier returns flags with url added to their -notify, or a -notify
+// of its own
+func withNotifier(flags []string, url string) []string {
+	out := append([]string(nil), flags...)
+	for i, f := range out {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(f, "-"), "=")
+		if !strings.HasPrefix(f, "-") || name != "notify" {
+			continue
+		}
+		if hasValue {
+			out[i] = "-notify=" + value + "," + url
+			return out
+		}
+		if i+1 < len(out) {
+			out[i+1] += "," + url
+			return out
+		}
+	}
+	return append(out, "-notify", url)
+}
+
+// lastLine returns the last line of a file that is not empty
+func lastLine(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	var last string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" {
+			last = line
+		}
+	}
+	return last
+}
+
+// Totals adds up the results of a batch
+type Totals struct {
+	Sources     int `json:"sources"`
+	Completed   int `json:"completed"`
+	Failed      int `json:"failed"`
+	Interrupted int `json:"interrupted"`
+	Recovered   int `json:"recovered"`
+}
+
+// Total adds up results
+func Total(results []Result) Totals {
+	t := Totals{Sources: len(results)}
+	for _, r := range results {
+		switch r.Summary.Status {
+		case output.StatusCompleted:
+			t.Completed++
+		case output.StatusInterrupted:
+			t.Interrupted++
+		default:
+			t.Failed++
+		}
+		t.Recovered += r.Summary.Recovered
+	}
+	return t
+}
+
+// resultJSON is the form of a Result in batch.json
+type resultJSON struct {
+	output.Summary
+	Dir      string `json:"dir"`
+	Log      string `json:"log,omitempty"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// WriteSummary writes the combined summary of a batch that ran from
+// started to outputDir, as batch.json and batch.csv, and returns their
+// paths
+func WriteSummary(outputDir string, started time.Time, results []Result) ([]string, error) {
+	doc := struct {
+		Started  time.Time    `json:"started"`
+		Finished time.Time    `json:"finished"`
+		Totals   Totals       `json:"totals"`
+		Results  []resultJSON `json:"results"`
+	}{Started: started, Finished: time.Now(), Totals: Total(results), Results: []resultJSON{}}
+	for _, r := range results {
+		doc.Results = append(doc.Results, resultJSON{Summary: r.Summary, Dir: r.Output, Log: r.Log, ExitCode: r.ExitCode})
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	jsonPath := filepath.Join(outputDir, JSONFile)
+	if err := os.WriteFile(jsonPath, append(data, '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write batch summary: %w", err)
+	}
+
+	csvPath := filepath.Join(outputDir, CSVFile)
+	f, err := os.Create(csvPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write batch summary: %w", err)
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"source", "status", "recovered", "skipped", "unverified", "seconds", "dir", "error"})
+	for _, r := range results {
+		s := r.Summary
+		w.Write([]string{
+			s.Source, s.Status, strconv.Itoa(s.Recovered), strconv.Itoa(s.Skipped), strconv.Itoa(s.Unverified),
+			strconv.Itoa(int(s.Finished.Sub(s.Started).Seconds())), r.Output, s.Error,
+		})
+	}
+	w.Flush()
+	if err := errors.Join(w.Error(), f.Close()); err != nil {
+		return nil, fmt.Errorf("failed to write batch summary: %w", err)
+	}
+	return []string{jsonPath, csvPath}, nil
+}
@@ -0,0 +1,130 @@
+package batch
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shubham/recovery/internal/output"
+)
+
+// TestMain stands in for the recover command when the tests run it
+func TestMain(m *testing.M) {
+	if os.Getenv("RECOVER_BATCH_TEST") == "" {
+		os.Exit(m.Run())
+	}
+	var device, notify string
+	args := os.Args[1:]
+	for i, arg := range args {
+		if v, ok := strings.CutPrefix(arg, "-notify="); ok {
+			notify = v
+		} else if arg == "-device" {
+			device = args[i+1]
+		}
+	}
+	if strings.HasPrefix(device, "missing") {
+		fmt.Println("Error opening device: no such file")
+		os.Exit(1)
+	}
+	fmt.Println("Recovering", device, "with", strings.Join(args, " "))
+	for _, u := range strings.Split(notify, ",") {
+		if path, ok := strings.CutPrefix(u, "file://"); ok {
+			data, _ := json.Marshal(output.Summary{Status: output.StatusCompleted, Source: device, Recovered: len(device)})
+			os.WriteFile(path, data, 0644)
+		}
+	}
+	os.Exit(0)
+}
+
+func TestRun(t *testing.T) {
+	tasks := Tasks([]string{"/dev/sdb", "a/disk.img", "b/disk.img", "c", "d"}, "out")
+	names := []string{"sdb", "disk.img", "disk (2).img", "c", "d"}
+	for i, task := range tasks {
+		if task.Output != filepath.Join("out", names[i]) {
+			t.Errorf("Expected %s to go to out/%s, got %s", task.Source, names[i], task.Output)
+		}
+	}
+
+	var running, most atomic.Int32
+	var order []string
+	results := Run(context.Background(), tasks, 2, func(ctx context.Context, task Task) Result {
+		n := running.Add(1)
+		for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+		}
+		time.Sleep(10 * time.Millisecond)
+		running.Add(-1)
+		return Result{Task: task, Summary: output.Summary{Status: output.StatusCompleted, Source: task.Source}}
+	}, func(r Result) { order = append(order, r.Source) })
+	if most.Load() != 2 {
+		t.Errorf("Expected two tasks at once, got %d", most.Load())
+	}
+	if len(order) != len(tasks) {
+		t.Errorf("Expected every task reported, got %v", order)
+	}
+	for i, r := range results {
+		if r.Source != tasks[i].Source || r.Summary.Status != output.StatusCompleted {
+			t.Errorf("Unexpected result %d: %+v", i, r)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results = Run(ctx, tasks, 1, func(ctx context.Context, task Task) Result {
+		cancel()
+		return Result{Task: task, Summary: output.Summary{Status: output.StatusInterrupted}}
+	}, nil)
+	if tot := Total(results); tot.Interrupted != 5 || results[1].ExitCode != -1 {
+		t.Errorf("Expected the tasks after a cancel not started, got %+v", results)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	t.Setenv("RECOVER_BATCH_TEST", "1")
+	dir := t.TempDir()
+	tasks := Tasks([]string{"disk.img", "missing.img"}, dir)
+	results := Run(context.Background(), tasks, 2, Command(os.Args[0], []string{"-smart", "-notify=https://hooks.example.com/x"}), nil)
+
+	ok, missing := results[0], results[1]
+	if ok.Summary.Status != output.StatusCompleted || ok.Summary.Recovered != len("disk.img") || ok.ExitCode != 0 {
+		t.Errorf("Unexpected result %+v", ok)
+	}
+	log, _ := os.ReadFile(ok.Log)
+	if !strings.Contains(string(log), "-smart -notify=https://hooks.example.com/x,file://") ||
+		!strings.Contains(string(log), "-device disk.img -output "+tasks[0].Output) {
+		t.Errorf("Unexpected arguments in %s", log)
+	}
+	if missing.Summary.Status != output.StatusFailed || missing.Summary.Error != "Error opening device: no such file" || missing.ExitCode != 1 {
+		t.Errorf("Unexpected result %+v", missing)
+	}
+
+	reports, err := WriteSummary(dir, time.Now(), results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Totals  Totals
+		Results []struct {
+			Source, Status, Dir string
+		}
+	}
+	data, _ := os.ReadFile(reports[0])
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if want := (Totals{Sources: 2, Completed: 1, Failed: 1, Recovered: 8}); doc.Totals != want || len(doc.Results) != 2 || doc.Results[1].Dir != tasks[1].Output {
+		t.Errorf("Unexpected batch summary %s", data)
+	}
+	f, _ := os.Open(reports[1])
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil || len(rows) != 3 || !reflect.DeepEqual(rows[2][:3], []string{"missing.img", "failed", "0"}) {
+		t.Errorf("Unexpected CSV %v (%v)", rows, err)
+	}
+}
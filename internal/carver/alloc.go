@@ -0,0 +1,112 @@
+package carver
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/internal/fat32"
+	"github.com/shubham/recovery/internal/ntfs"
+)
+
+// A carve of a volume that is still in use finds every live file as well as
+// the deleted ones. The filesystem knows which clusters its files hold, so
+// carving can be limited to the rest: the clusters the FAT or $Bitmap marks
+// free, and the space outside any partition.
+
+// UnallocatedSpace returns the parts of the disk that no filesystem holds
+// files in, in disk order. Partitions without a FAT32 or NTFS volume are
+// returned whole, since nothing tells which of their blocks are in use; it
+// fails when there is no FAT32 or NTFS volume at all.
+func UnallocatedSpace(reader *disk.Reader) ([]disk.Extent, error) {
+	defer reader.Purpose("allocation maps")()
+	var extents []disk.Extent
+	found := false
+	end := int64(0) // Of the partitions so far
+	for _, v := range diskVolumes(reader) {
+		if v.Offset > end {
+			extents = append(extents, disk.Extent{Offset: end, Length: v.Offset - end})
+		}
+		end = max(end, v.Offset+v.Size)
+
+		free, err := volumeFreeSpace(v.reader)
+		if err != nil {
+			extents = append(extents, disk.Extent{Offset: v.Offset, Length: v.Size})
+			continue
+		}
+		found = true
+		extents = append(extents, disk.Shift(free, v.Offset)...)
+	}
+	if end < reader.Size() {
+		extents = append(extents, disk.Extent{Offset: end, Length: reader.Size() - end})
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: no FAT32 or NTFS volume found", disk.ErrUnsupportedFilesystem)
+	}
+	sort.Slice(extents, func(i, j int) bool { return extents[i].Offset < extents[j].Offset })
+	return extents, nil
+}
+
+// volume is a partition of a disk, or the whole disk when it has no
+// partition table
+type volume struct {
+	disk.Partition
+	name   string // partitionN, or "" for the whole disk
+	reader *disk.Reader
+}
+
+// diskVolumes returns the partitions of a disk in disk order, or the disk
+// itself
+func diskVolumes(reader *disk.Reader) []volume {
+	parts := disk.Partitions(reader)
+	if len(parts) == 0 {
+		return []volume{{Partition: disk.Partition{Size: reader.Size()}, reader: reader}}
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Offset < parts[j].Offset })
+	volumes := make([]volume, len(parts))
+	for i, p := range parts {
+		volumes[i] = volume{Partition: p, name: fmt.Sprintf("partition%d", p.Index), reader: reader.Partition(p)}
+	}
+	return volumes
+}
+
+// volumeFreeSpace reads the free clusters of a FAT32 or NTFS volume
+func volumeFreeSpace(volume *disk.Reader) ([]disk.Extent, error) {
+	fs, err := disk.DetectFilesystem(volume)
+	if err != nil {
+		return nil, err
+	}
+	switch fs {
+	case "ntfs":
+		p, err := ntfs.NewParser(volume)
+		if err != nil {
+			return nil, err
+		}
+		return p.FreeSpace()
+	case "fat32":
+		p, err := fat32.NewParser(volume)
+		if err != nil {
+			return nil, err
+		}
+		return p.FreeSpace()
+	}
+	return nil, fmt.Errorf("free space of %s volumes is not supported", fs)
+}
+
+// SetExtents limits Scan to files that start inside the given ranges of the
+// disk, in disk order, such as its unallocated space (nil = the whole disk)
+func (c *Carver) SetExtents(extents []disk.Extent) {
+	c.extents = extents
+}
+
+// nextExtent advances *k past the extents that end at or before pos and
+// returns the start of the next one, or -1 when none is left
+func (c *Carver) nextExtent(k *int, pos int64) int64 {
+	for *k < len(c.extents) && c.extents[*k].Offset+c.extents[*k].Length <= pos {
+		*k++
+	}
+	if *k == len(c.extents) {
+		return -1
+	}
+	return c.extents[*k].Offset
+}
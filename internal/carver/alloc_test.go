@@ -0,0 +1,99 @@
+package carver
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/internal/disk/disktest"
+)
+
+// makeFAT32 builds a FAT32 volume of 4KB clusters, 32 reserved sectors and
+// two one-sector FATs, with the clusters listed in used allocated
+func makeFAT32(clusters int, used ...int) []byte {
+	volume := disktest.FAT32(clusters)
+	disktest.Allocate(volume, used...)
+	return volume
+}
+
+func TestCarveFreeOnly(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "test.img")
+
+	// An MBR disk with a FAT32 partition from 64KB, whose root directory is
+	// in cluster 2 and a live file in cluster 3, then 32KB unpartitioned
+	const partStart = 64 * 1024
+	volume := makeFAT32(16, 2, 3)
+	dataStart := int64(partStart + 34*512)
+	data := make([]byte, partStart+len(volume)+32*1024)
+	le := binary.LittleEndian
+	data[446+4] = 0x0C
+	le.PutUint32(data[446+8:], partStart/512)
+	le.PutUint32(data[446+12:], uint32(len(volume)/512))
+	data[510], data[511] = 0x55, 0xAA
+	copy(data[partStart:], volume)
+
+	jpeg := []byte{0xFF, 0xD8, 0xFF, 0xE0}
+	before := int64(8192)                        // Before the partition
+	live := dataStart + 1*4096                   // Cluster 3
+	deleted := dataStart + 5*4096                // Cluster 7
+	after := int64(partStart + len(volume) + 16) // After the partition
+	for _, off := range []int64{before, live, deleted, after} {
+		copy(data[off:], jpeg)
+	}
+
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	extents, err := UnallocatedSpace(reader)
+	if err != nil {
+		t.Fatalf("UnallocatedSpace failed: %v", err)
+	}
+	want := []disk.Extent{
+		{Offset: 0, Length: partStart},
+		{Offset: dataStart + 2*4096, Length: 14 * 4096},
+		{Offset: int64(partStart + len(volume)), Length: 32 * 1024},
+	}
+	if !reflect.DeepEqual(extents, want) {
+		t.Fatalf("Expected extents %v, got %v", want, extents)
+	}
+
+	carver := NewCarver(reader)
+	carver.SetSignatures([]FileSignature{findSignature(t, "JPEG")})
+	carver.SetExtents(extents)
+	files, err := carver.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	var offsets []int64
+	for _, f := range files {
+		offsets = append(offsets, f.Offset)
+	}
+	if wantOffsets := []int64{before, deleted, after}; !reflect.DeepEqual(offsets, wantOffsets) {
+		t.Errorf("Expected JPEGs at %v, got %v", wantOffsets, offsets)
+	}
+}
+
+func TestUnallocatedSpaceNoFilesystem(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "test.img")
+	if err := os.WriteFile(tmpFile, make([]byte, 64*1024), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	if _, err := UnallocatedSpace(reader); err == nil {
+		t.Error("Expected an error for a disk without a filesystem")
+	}
+}
@@ -0,0 +1,145 @@
+package carver
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// ISO base media files (MP4, MOV, CR3) are a sequence of top-level boxes,
+// each starting with a 32-bit big-endian size and a four-character type.
+// A size of 1 means a 64-bit size follows the type; 0 means "to end of file".
+
+// bmffSize walks the top-level boxes and returns the offset just past the
+// last one with a plausible type, or 0 if the first box is not readable
+func bmffSize(r io.ReaderAt, limit int64) int64 {
+	var hdr [16]byte
+	var pos int64
+	for pos+8 <= limit {
+		if _, err := r.ReadAt(hdr[:8], pos); err != nil {
+			break
+		}
+		size := int64(binary.BigEndian.Uint32(hdr[0:4]))
+		if !isBoxType(hdr[4:8]) {
+			break
+		}
+		switch size {
+		case 0:
+			return 0 // Runs to the end of a file we cannot see the end of
+		case 1:
+			if _, err := r.ReadAt(hdr[8:16], pos+8); err != nil {
+				return 0
+			}
+			size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			if size < 16 {
+				return 0
+			}
+		default:
+			if size < 8 {
+				return 0
+			}
+		}
+		if pos+size > limit {
+			break
+		}
+		pos += size
+	}
+	return pos
+}
+
+// isBoxType reports whether b looks like a box type: four printable ASCII
+// characters, as used by every registered type
+func isBoxType(b []byte) bool {
+	for _, c := range b {
+		if c < 0x20 || c > 0x7E {
+			return false
+		}
+	}
+	return true
+}
+
+// bmffBox is the payload range of a box
+type bmffBox struct {
+	typ        string
+	start, end int64
+}
+
+// bmffChildren returns the boxes between start and end, stopping at the
+// first one that does not fit
+func bmffChildren(r io.ReaderAt, start, end int64) []bmffBox {
+	var boxes []bmffBox
+	var hdr [16]byte
+	pos := start
+	for pos+8 <= end {
+		if _, err := r.ReadAt(hdr[:8], pos); err != nil || !isBoxType(hdr[4:8]) {
+			break
+		}
+		size, head := int64(binary.BigEndian.Uint32(hdr[0:4])), int64(8)
+		switch size {
+		case 0:
+			size = end - pos
+		case 1:
+			if _, err := r.ReadAt(hdr[8:16], pos+8); err != nil {
+				return boxes
+			}
+			size, head = int64(binary.BigEndian.Uint64(hdr[8:16])), 16
+		}
+		if size < head || pos+size > end {
+			break
+		}
+		boxes = append(boxes, bmffBox{string(hdr[4:8]), pos + head, pos + size})
+		pos += size
+	}
+	return boxes
+}
+
+// bmffChild returns the first box of the given type between start and end
+func bmffChild(r io.ReaderAt, start, end int64, typ string) (bmffBox, bool) {
+	for _, box := range bmffChildren(r, start, end) {
+		if box.typ == typ {
+			return box, true
+		}
+	}
+	return bmffBox{}, false
+}
+
+// bmffCodecs returns the sample entry type, such as "avc1", of each track in
+// the movie box
+func bmffCodecs(r io.ReaderAt, size int64) []string {
+	moov, ok := bmffChild(r, 0, size, "moov")
+	if !ok {
+		return nil
+	}
+	var codecs []string
+	for _, trak := range bmffChildren(r, moov.start, moov.end) {
+		if trak.typ != "trak" {
+			continue
+		}
+		box, ok := trak, true
+		for _, typ := range []string{"mdia", "minf", "stbl", "stsd"} {
+			if box, ok = bmffChild(r, box.start, box.end, typ); !ok {
+				break
+			}
+		}
+		// Version and flags, entry count, then the first entry's size and type
+		var entry [16]byte
+		if !ok || box.end-box.start < 16 {
+			continue
+		}
+		if _, err := r.ReadAt(entry[:], box.start); err == nil && isBoxType(entry[12:16]) {
+			codecs = append(codecs, string(entry[12:16]))
+		}
+	}
+	return codecs
+}
+
+// classifyQuickTime files QuickTime movies whose video is Blackmagic RAW,
+// whose codecs ("brxq", "brst", "brvn", ...) all start with "br"
+func classifyQuickTime(r io.ReaderAt, size int64) (string, string) {
+	for _, codec := range bmffCodecs(r, size) {
+		if strings.HasPrefix(codec, "br") {
+			return "BRAW", ".braw"
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,82 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func makeBox(typ string, payload int) []byte {
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+payload))
+	box = append(box, typ...)
+	return append(box, bytes.Repeat([]byte{0x11}, payload)...)
+}
+
+func TestBMFFSize(t *testing.T) {
+	var file []byte
+	file = append(file, makeBox("ftyp", 16)...)
+	copy(file[8:], "crx ")
+	file = append(file, makeBox("moov", 200)...)
+	file = append(file, makeBox("mdat", 3000)...)
+
+	// Trailing bytes that are not a box end the file
+	data := append(append([]byte{}, file...), 0x00, 0x00, 0x10, 0x00, 0xFF, 0xFE, 0x01, 0x02)
+	data = append(data, make([]byte, 64)...)
+
+	if got := bmffSize(bytes.NewReader(data), int64(len(data))); got != int64(len(file)) {
+		t.Errorf("Expected size %d, got %d", len(file), got)
+	}
+
+	// 64-bit box size
+	large := binary.BigEndian.AppendUint32(nil, 1)
+	large = append(large, "mdat"...)
+	large = binary.BigEndian.AppendUint64(large, 40)
+	large = append(large, make([]byte, 24)...)
+	if got := bmffSize(bytes.NewReader(large), int64(len(large))); got != 40 {
+		t.Errorf("Expected 64-bit box size 40, got %d", got)
+	}
+
+	if got := bmffSize(bytes.NewReader(make([]byte, 64)), 64); got != 0 {
+		t.Errorf("Expected 0 for data without boxes, got %d", got)
+	}
+}
+
+// nestBox wraps the children in a box of the given type
+func nestBox(typ string, children ...[]byte) []byte {
+	var payload []byte
+	for _, c := range children {
+		payload = append(payload, c...)
+	}
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(payload)))
+	return append(append(box, typ...), payload...)
+}
+
+// makeMovie builds a QuickTime movie with one track of the given codec
+func makeMovie(codec string) []byte {
+	stsd := append(make([]byte, 4), 0, 0, 0, 1)
+	stsd = append(stsd, makeBox(codec, 78)...)
+	trak := nestBox("trak", makeBox("tkhd", 84), nestBox("mdia", makeBox("mdhd", 24),
+		nestBox("minf", nestBox("stbl", nestBox("stsd", stsd), makeBox("stts", 16)))))
+
+	ftyp := makeBox("ftyp", 12)
+	copy(ftyp[8:], "qt  ")
+	return append(append(ftyp, makeBox("mdat", 4000)...), nestBox("moov", makeBox("mvhd", 100), trak)...)
+}
+
+func TestClassifyQuickTime(t *testing.T) {
+	braw := makeMovie("brxq")
+	if got := bmffCodecs(bytes.NewReader(braw), int64(len(braw))); len(got) != 1 || got[0] != "brxq" {
+		t.Errorf("Expected codec brxq, got %v", got)
+	}
+	if name, ext := classifyQuickTime(bytes.NewReader(braw), int64(len(braw))); name != "BRAW" || ext != ".braw" {
+		t.Errorf("Expected BRAW, got %q %q", name, ext)
+	}
+
+	mov := makeMovie("avc1")
+	if name, _ := classifyQuickTime(bytes.NewReader(mov), int64(len(mov))); name != "" {
+		t.Errorf("Expected an H.264 movie to keep its type, got %q", name)
+	}
+	if got := bmffSize(bytes.NewReader(braw), int64(len(braw))); got != int64(len(braw)) {
+		t.Errorf("Expected size %d, got %d", len(braw), got)
+	}
+}
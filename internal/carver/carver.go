@@ -2,10 +2,12 @@ package carver
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/shubham/recovery/internal/disk"
 )
@@ -15,53 +17,241 @@ type FileSignature struct {
 	Name      string
 	Extension string
 	Header    []byte
-	Footer    []byte    // Optional footer for better detection
-	MaxSize   int64     // Max file size to carve (0 = use default)
-	Offset    int       // Offset where header appears (usually 0)
+	Footer    []byte // Optional footer for better detection
+	MaxSize   int64  // Max file size to carve (0 = use default)
+	Offset    int    // Offset where header appears (usually 0)
+	Alignment int64  // Only match files starting on this boundary (0 = any offset)
+
+	Wildcard        []bool     // Header positions that match any byte (nil = exact match)
+	CaseInsensitive bool       // Compare header and footer ignoring ASCII case
+	FooterMode      FooterMode // How a footer terminates the file
+
+	MinSize int64             // Carvings smaller than this are false positives
+	Verify  func([]byte) bool // Secondary header check on the bytes at a hit (nil = none)
+
+	// Sizer works out the file length from its internal structure. It reads
+	// the file from offset 0 of r, at most limit bytes, and returns 0 when the
+	// length cannot be determined so the footer or MaxSize is used instead.
+	Sizer func(r io.ReaderAt, limit int64) int64
+
+	// Classify inspects a carved file of the given size and returns the name
+	// and extension of the specific format it holds ("" = keep Name and
+	// Extension). The name picks the output directory.
+	Classify func(r io.ReaderAt, size int64) (name, ext string)
+
+	Container string // Hits inside a carving of this signature are part of it and dropped
+
+	// Metadata extracts details worth reporting from a carved file of the
+	// given size, such as the target of a shortcut
+	Metadata func(r io.ReaderAt, size int64) map[string]string
+
+	// Extract pulls files worth saving on their own out of a carved file of
+	// the given size, such as the pictures in a thumbnail cache
+	Extract func(r io.ReaderAt, size int64) []EmbeddedFile
+
+	// Open lays out what a container of the given size holds as a disk for
+	// recursive carving, such as the guest disk of a virtual disk, returning
+	// it with its size, or nil when the contents cannot be laid out
+	Open func(r io.ReaderAt, size int64) (io.ReaderAt, int64)
+
+	// Validate checks the structure of a carved file of the given size, in
+	// place of the built-in check of a format of its Name
+	Validate func(r io.ReaderAt, size int64) error
+}
+
+// EmbeddedFile is a file found inside a carved file by a signature's Extract
+type EmbeddedFile struct {
+	Name string // File name to save it under
+	Data []byte
+}
+
+// FooterMode selects how the footer of a signature ends a carved file
+type FooterMode int
+
+const (
+	FooterFirst   FooterMode = iota // Stop after the first footer, footer included
+	FooterLast                      // Stop after the last footer within MaxSize (scalpel REVERSE)
+	FooterExclude                   // Stop before the first footer (scalpel NEXT)
+)
+
+// matchHeader reports whether data starts with the signature header
+func (s *FileSignature) matchHeader(data []byte) bool {
+	if len(data) < len(s.Header) {
+		return false
+	}
+	if s.Wildcard == nil && !s.CaseInsensitive {
+		return bytes.Equal(data[:len(s.Header)], s.Header)
+	}
+	for i, b := range s.Header {
+		if i < len(s.Wildcard) && s.Wildcard[i] {
+			continue
+		}
+		if data[i] != b && !(s.CaseInsensitive && lower(data[i]) == lower(b)) {
+			return false
+		}
+	}
+	return true
+}
+
+// indexFooter returns the first (or, with last set, the final) footer position in data
+func (s *FileSignature) indexFooter(data []byte, last bool) int {
+	if !s.CaseInsensitive {
+		if last {
+			return bytes.LastIndex(data, s.Footer)
+		}
+		return bytes.Index(data, s.Footer)
+	}
+	found := -1
+	for i := 0; i+len(s.Footer) <= len(data); i++ {
+		if bytes.EqualFold(data[i:i+len(s.Footer)], s.Footer) {
+			if !last {
+				return i
+			}
+			found = i
+		}
+	}
+	return found
+}
+
+func lower(b byte) byte {
+	if b >= 'A' && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+func upper(b byte) byte {
+	if b >= 'a' && b <= 'z' {
+		return b - ('a' - 'A')
+	}
+	return b
 }
 
 // Common file signatures
 var Signatures = []FileSignature{
 	// Images
-	{Name: "JPEG", Extension: ".jpg", Header: []byte{0xFF, 0xD8, 0xFF}, Footer: []byte{0xFF, 0xD9}, MaxSize: 50 * 1024 * 1024},
-	{Name: "PNG", Extension: ".png", Header: []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}, Footer: []byte{0x49, 0x45, 0x4E, 0x44, 0xAE, 0x42, 0x60, 0x82}, MaxSize: 50 * 1024 * 1024},
-	{Name: "GIF", Extension: ".gif", Header: []byte{0x47, 0x49, 0x46, 0x38}, Footer: []byte{0x00, 0x3B}, MaxSize: 20 * 1024 * 1024},
-	{Name: "BMP", Extension: ".bmp", Header: []byte{0x42, 0x4D}, MaxSize: 50 * 1024 * 1024},
-	{Name: "WEBP", Extension: ".webp", Header: []byte{0x52, 0x49, 0x46, 0x46}, MaxSize: 50 * 1024 * 1024}, // RIFF header
-	{Name: "TIFF", Extension: ".tiff", Header: []byte{0x49, 0x49, 0x2A, 0x00}, MaxSize: 100 * 1024 * 1024},
-	{Name: "TIFF-BE", Extension: ".tiff", Header: []byte{0x4D, 0x4D, 0x00, 0x2A}, MaxSize: 100 * 1024 * 1024},
+	{Name: "JPEG", Extension: ".jpg", Header: []byte{0xFF, 0xD8, 0xFF}, Footer: []byte{0xFF, 0xD9}, MaxSize: 50 * 1024 * 1024, MinSize: 128, Metadata: exifMetadata},
+	{Name: "PNG", Extension: ".png", Header: []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}, Footer: []byte{0x49, 0x45, 0x4E, 0x44, 0xAE, 0x42, 0x60, 0x82}, MaxSize: 50 * 1024 * 1024, MinSize: 67},
+	{Name: "GIF", Extension: ".gif", Header: []byte{0x47, 0x49, 0x46, 0x38}, Footer: []byte{0x00, 0x3B}, MaxSize: 20 * 1024 * 1024, MinSize: 32},
+	{Name: "BMP", Extension: ".bmp", Header: []byte{0x42, 0x4D}, MaxSize: 50 * 1024 * 1024, Verify: verifyBMP},
+	{Name: "WEBP", Extension: ".webp", Header: []byte("RIFF"), MaxSize: 50 * 1024 * 1024, Verify: verifyRIFF("WEBP"), Sizer: riffSize}, // RIFF form types tell WEBP, AVI and WAV apart
+	{Name: "TIFF", Extension: ".tiff", Header: []byte{0x49, 0x49, 0x2A, 0x00}, MaxSize: 100 * 1024 * 1024, Verify: verifyTIFF, Sizer: tiffSize, Metadata: exifMetadata},
+	{Name: "TIFF-BE", Extension: ".tiff", Header: []byte{0x4D, 0x4D, 0x00, 0x2A}, MaxSize: 100 * 1024 * 1024, Verify: verifyTIFF, Sizer: tiffSize},
+
+	// Camera RAW
+	{Name: "CR2", Extension: ".cr2", Header: []byte{0x49, 0x49, 0x2A, 0x00, 0x10, 0x00, 0x00, 0x00, 0x43, 0x52}, MaxSize: 200 * 1024 * 1024, Sizer: tiffSize, Metadata: exifMetadata},
+	{Name: "CR3", Extension: ".cr3", Header: []byte("ftypcrx "), Offset: 4, MaxSize: 200 * 1024 * 1024, Sizer: bmffSize},
+	{Name: "NEF", Extension: ".nef", Header: []byte{0x4D, 0x4D, 0x00, 0x2A}, MaxSize: 200 * 1024 * 1024, Verify: verifyNEF, Sizer: tiffSize, Metadata: exifMetadata},
+	{Name: "ARW", Extension: ".arw", Header: []byte{0x49, 0x49, 0x2A, 0x00}, MaxSize: 200 * 1024 * 1024, Verify: verifyARW, Sizer: tiffSize, Metadata: exifMetadata},
+	{Name: "ORF", Extension: ".orf", Header: []byte{0x49, 0x49, 0x52, 0x4F, 0x08, 0x00, 0x00, 0x00}, MaxSize: 200 * 1024 * 1024, Verify: verifyRawIFD, Sizer: tiffSize, Metadata: exifMetadata},
+	{Name: "RW2", Extension: ".rw2", Header: []byte{0x49, 0x49, 0x55, 0x00, 0x18, 0x00, 0x00, 0x00}, MaxSize: 200 * 1024 * 1024, Verify: verifyRawIFD, Sizer: tiffSize, Metadata: exifMetadata},
+	{Name: "DNG", Extension: ".dng", Header: []byte{0x49, 0x49, 0x2A, 0x00}, MaxSize: 200 * 1024 * 1024, Verify: verifyDNG, Sizer: tiffSize, Metadata: exifMetadata},
+	{Name: "DNG-BE", Extension: ".dng", Header: []byte{0x4D, 0x4D, 0x00, 0x2A}, MaxSize: 200 * 1024 * 1024, Verify: verifyDNG, Sizer: tiffSize},
 
 	// Videos
-	{Name: "MP4", Extension: ".mp4", Header: []byte{0x00, 0x00, 0x00}, MaxSize: 4 * 1024 * 1024 * 1024}, // ftyp follows at offset 4
-	{Name: "AVI", Extension: ".avi", Header: []byte{0x52, 0x49, 0x46, 0x46}, MaxSize: 4 * 1024 * 1024 * 1024},
+	{Name: "MP4", Extension: ".mp4", Header: []byte{0x00, 0x00, 0x00}, MaxSize: 4 * 1024 * 1024 * 1024, Verify: verifyMP4, Sizer: bmffSize, Classify: classifyQuickTime}, // ftyp follows at offset 4
+	{Name: "AVI", Extension: ".avi", Header: []byte("RIFF"), MaxSize: 4 * 1024 * 1024 * 1024, Verify: verifyRIFF("AVI "), Sizer: riffSize},
 	{Name: "MKV", Extension: ".mkv", Header: []byte{0x1A, 0x45, 0xDF, 0xA3}, MaxSize: 4 * 1024 * 1024 * 1024},
-	{Name: "MOV", Extension: ".mov", Header: []byte{0x00, 0x00, 0x00, 0x14, 0x66, 0x74, 0x79, 0x70}, MaxSize: 4 * 1024 * 1024 * 1024},
+	{Name: "MOV", Extension: ".mov", Header: []byte{0x00, 0x00, 0x00, 0x14, 0x66, 0x74, 0x79, 0x70}, MaxSize: 4 * 1024 * 1024 * 1024, Sizer: bmffSize, Classify: classifyQuickTime}, // Also Blackmagic RAW
 	{Name: "WMV", Extension: ".wmv", Header: []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11}, MaxSize: 4 * 1024 * 1024 * 1024},
 	{Name: "FLV", Extension: ".flv", Header: []byte{0x46, 0x4C, 0x56, 0x01}, MaxSize: 2 * 1024 * 1024 * 1024},
+	{Name: "MTS", Extension: ".mts", Header: []byte{0x47, 0x40, 0x00}, Offset: 4, Alignment: 512, MaxSize: 4 * 1024 * 1024 * 1024, Verify: verifyTS(m2tsPacketSize), Sizer: tsSizer(m2tsPacketSize)}, // AVCHD and Blu-ray .m2ts
+	{Name: "TS", Extension: ".ts", Header: []byte{0x47, 0x40, 0x00}, Alignment: 512, MaxSize: 4 * 1024 * 1024 * 1024, Verify: verifyTS(tsPacketSize), Sizer: tsSizer(tsPacketSize)},
+	{Name: "MXF", Extension: ".mxf", Header: append(append([]byte{}, mxfPartitionKey...), 0x02), MaxSize: 4 * 1024 * 1024 * 1024, Verify: verifyMXF, Sizer: mxfSize},
 
 	// Audio
-	{Name: "MP3", Extension: ".mp3", Header: []byte{0xFF, 0xFB}, MaxSize: 100 * 1024 * 1024},
-	{Name: "MP3-ID3", Extension: ".mp3", Header: []byte{0x49, 0x44, 0x33}, MaxSize: 100 * 1024 * 1024},
-	{Name: "WAV", Extension: ".wav", Header: []byte{0x52, 0x49, 0x46, 0x46}, MaxSize: 500 * 1024 * 1024},
+	{Name: "MP3", Extension: ".mp3", Header: []byte{0xFF, 0xFB}, MaxSize: 100 * 1024 * 1024, Verify: verifyMP3, Sizer: mp3Size, Container: "MP3"}, // MPEG-1, later frames are part of the stream
+	{Name: "MP3", Extension: ".mp3", Header: []byte{0xFF, 0xFA}, MaxSize: 100 * 1024 * 1024, Verify: verifyMP3, Sizer: mp3Size, Container: "MP3"}, // MPEG-1 with CRC
+	{Name: "MP3", Extension: ".mp3", Header: []byte{0xFF, 0xF3}, MaxSize: 100 * 1024 * 1024, Verify: verifyMP3, Sizer: mp3Size, Container: "MP3"}, // MPEG-2
+	{Name: "MP3", Extension: ".mp3", Header: []byte{0xFF, 0xF2}, MaxSize: 100 * 1024 * 1024, Verify: verifyMP3, Sizer: mp3Size, Container: "MP3"},
+	{Name: "MP3", Extension: ".mp3", Header: []byte{0xFF, 0xE3}, MaxSize: 100 * 1024 * 1024, Verify: verifyMP3, Sizer: mp3Size, Container: "MP3"}, // MPEG-2.5
+	{Name: "MP3", Extension: ".mp3", Header: []byte("ID3"), MaxSize: 100 * 1024 * 1024, Verify: verifyID3, Sizer: mp3Size, Container: "MP3"},
+	{Name: "WAV", Extension: ".wav", Header: []byte("RIFF"), MaxSize: 500 * 1024 * 1024, Verify: verifyRIFF("WAVE"), Sizer: riffSize},
 	{Name: "FLAC", Extension: ".flac", Header: []byte{0x66, 0x4C, 0x61, 0x43}, MaxSize: 500 * 1024 * 1024},
 	{Name: "OGG", Extension: ".ogg", Header: []byte{0x4F, 0x67, 0x67, 0x53}, MaxSize: 200 * 1024 * 1024},
 	{Name: "M4A", Extension: ".m4a", Header: []byte{0x00, 0x00, 0x00, 0x20, 0x66, 0x74, 0x79, 0x70, 0x4D, 0x34, 0x41}, MaxSize: 500 * 1024 * 1024},
 
 	// Documents
-	{Name: "PDF", Extension: ".pdf", Header: []byte{0x25, 0x50, 0x44, 0x46}, Footer: []byte{0x25, 0x25, 0x45, 0x4F, 0x46}, MaxSize: 500 * 1024 * 1024},
-	{Name: "DOCX", Extension: ".docx", Header: []byte{0x50, 0x4B, 0x03, 0x04}, MaxSize: 100 * 1024 * 1024},
-	{Name: "XLSX", Extension: ".xlsx", Header: []byte{0x50, 0x4B, 0x03, 0x04}, MaxSize: 100 * 1024 * 1024},
-	{Name: "PPTX", Extension: ".pptx", Header: []byte{0x50, 0x4B, 0x03, 0x04}, MaxSize: 500 * 1024 * 1024},
-	{Name: "ZIP", Extension: ".zip", Header: []byte{0x50, 0x4B, 0x03, 0x04}, MaxSize: 1024 * 1024 * 1024},
+	{Name: "OLE", Extension: ".ole", Header: []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}, MaxSize: 500 * 1024 * 1024, Verify: verifyCFB, Sizer: cfbSize, Classify: classifyCFB, Metadata: cfbMetadata, Extract: extractCFB}, // .doc/.xls/.ppt/.msg, jump lists, Thumbs.db
+	{Name: "PDF", Extension: ".pdf", Header: []byte{0x25, 0x50, 0x44, 0x46}, Footer: []byte{0x25, 0x25, 0x45, 0x4F, 0x46}, MaxSize: 500 * 1024 * 1024, MinSize: 64, Metadata: pdfMetadata},
+	{Name: "ZIP", Extension: ".zip", Header: []byte{0x50, 0x4B, 0x03, 0x04}, MaxSize: 1024 * 1024 * 1024, Sizer: zipSize, Classify: classifyZIP, Metadata: zipMetadata, Open: zipOpen}, // Also .docx/.xlsx/.pptx/.odt/.epub/.jar/.apk
 	{Name: "RAR", Extension: ".rar", Header: []byte{0x52, 0x61, 0x72, 0x21, 0x1A, 0x07}, MaxSize: 1024 * 1024 * 1024},
 	{Name: "7Z", Extension: ".7z", Header: []byte{0x37, 0x7A, 0xBC, 0xAF, 0x27, 0x1C}, MaxSize: 1024 * 1024 * 1024},
 
+	// Email
+	{Name: "PST", Extension: ".pst", Header: []byte{0x21, 0x42, 0x44, 0x4E}, MaxSize: 50 * 1024 * 1024 * 1024, Verify: verifyPST, Sizer: pstSize, Classify: classifyPST}, // !BDN, also .ost
+	{Name: "EML", Extension: ".eml", Header: []byte("Return-Path:"), CaseInsensitive: true, Alignment: 512, MaxSize: 50 * 1024 * 1024, Verify: verifyEML, Sizer: emlSize},
+	{Name: "EML", Extension: ".eml", Header: []byte("Received:"), CaseInsensitive: true, Alignment: 512, MaxSize: 50 * 1024 * 1024, Verify: verifyEML, Sizer: emlSize},
+	{Name: "EML", Extension: ".eml", Header: []byte("Delivered-To:"), CaseInsensitive: true, Alignment: 512, MaxSize: 50 * 1024 * 1024, Verify: verifyEML, Sizer: emlSize},
+	{Name: "EML", Extension: ".eml", Header: []byte("From:"), CaseInsensitive: true, Alignment: 512, MaxSize: 50 * 1024 * 1024, Verify: verifyEML, Sizer: emlSize},
+	{Name: "EML", Extension: ".eml", Header: []byte("MIME-Version:"), CaseInsensitive: true, Alignment: 512, MaxSize: 50 * 1024 * 1024, Verify: verifyEML, Sizer: emlSize},
+	{Name: "EML", Extension: ".eml", Header: []byte("Message-ID:"), CaseInsensitive: true, Alignment: 512, MaxSize: 50 * 1024 * 1024, Verify: verifyEML, Sizer: emlSize},
+	{Name: "EML", Extension: ".eml", Header: []byte("Date:"), CaseInsensitive: true, Alignment: 512, MaxSize: 50 * 1024 * 1024, Verify: verifyEML, Sizer: emlSize},
+	{Name: "MBOX", Extension: ".mbox", Header: []byte("From "), Alignment: 512, MaxSize: 4 * 1024 * 1024 * 1024, Verify: verifyMBOX, Sizer: textSize},
+
+	// Windows artifacts
+	{Name: "REGISTRY", Extension: ".hive", Header: []byte("regf"), Alignment: 512, MaxSize: 2 * 1024 * 1024 * 1024, Verify: verifyRegistry, Sizer: registrySize},
+
+	{Name: "EVTX", Extension: ".evtx", Header: []byte("ElfFile\x00"), Alignment: 512, MaxSize: 1024 * 1024 * 1024, Verify: verifyEVTX, Sizer: evtxSize},
+	{Name: "EVTX-CHUNK", Extension: ".elfchnk", Header: []byte("ElfChnk\x00"), Alignment: 512, MaxSize: evtxChunkSize, Verify: verifyEVTXChunk, Container: "EVTX"}, // Orphaned chunk
+
+	{Name: "THUMBCACHE", Extension: ".db", Header: []byte("CMMM"), Alignment: 512, MaxSize: 1024 * 1024 * 1024, Verify: verifyThumbcache, Sizer: thumbcacheSize, Extract: extractThumbcache},
+	{Name: "LNK", Extension: ".lnk", Header: append([]byte{0x4C, 0x00, 0x00, 0x00}, lnkCLSID...), MaxSize: lnkMaxSize, Sizer: lnkSize, Metadata: lnkMetadata},
+
+	// Source control
+	{Name: "GIT-OBJECT", Extension: "", Header: []byte{0x78, 0x01}, Alignment: 512, MaxSize: 100 * 1024 * 1024, Verify: verifyGitObject, Sizer: gitObjectSize, Metadata: gitObjectMetadata}, // Loose object, core.looseCompression 1
+	{Name: "GIT-OBJECT", Extension: "", Header: []byte{0x78, 0x5E}, Alignment: 512, MaxSize: 100 * 1024 * 1024, Verify: verifyGitObject, Sizer: gitObjectSize, Metadata: gitObjectMetadata},
+	{Name: "GIT-OBJECT", Extension: "", Header: []byte{0x78, 0x9C}, Alignment: 512, MaxSize: 100 * 1024 * 1024, Verify: verifyGitObject, Sizer: gitObjectSize, Metadata: gitObjectMetadata},
+	{Name: "GIT-OBJECT", Extension: "", Header: []byte{0x78, 0xDA}, Alignment: 512, MaxSize: 100 * 1024 * 1024, Verify: verifyGitObject, Sizer: gitObjectSize, Metadata: gitObjectMetadata},
+	{Name: "GIT-PACK", Extension: ".pack", Header: []byte("PACK"), MaxSize: 4 * 1024 * 1024 * 1024, Verify: verifyGitPack, Sizer: gitPackSize, Metadata: gitPackMetadata},
+	{Name: "GIT-IDX", Extension: ".idx", Header: []byte{0xFF, 't', 'O', 'c', 0x00, 0x00, 0x00, 0x02}, MaxSize: 1024 * 1024 * 1024, Sizer: gitIdxSize},
+
 	// Executables
-	{Name: "EXE", Extension: ".exe", Header: []byte{0x4D, 0x5A}, MaxSize: 500 * 1024 * 1024},
+	{Name: "EXE", Extension: ".exe", Header: []byte{0x4D, 0x5A}, MaxSize: 500 * 1024 * 1024, Verify: verifyEXE},
 	{Name: "ELF", Extension: ".elf", Header: []byte{0x7F, 0x45, 0x4C, 0x46}, MaxSize: 500 * 1024 * 1024},
 
+	// Apple artifacts
+	{Name: "PLIST", Extension: ".plist", Header: []byte("bplist00"), MaxSize: 50 * 1024 * 1024, Verify: verifyBPlist, Sizer: bplistSize},
+	{Name: "PLIST", Extension: ".plist", Header: []byte("<?xml"), Footer: []byte("</plist>"), Alignment: 512, MaxSize: 50 * 1024 * 1024, Verify: verifyXMLPlist},
+
+	// Cryptocurrency wallets
+	{Name: "BDB", Extension: ".db", Header: bdbMagic, Offset: 12, Alignment: 512, MaxSize: 1024 * 1024 * 1024, Verify: verifyBDB, Sizer: bdbSize, Classify: classifyBDB}, // Bitcoin wallet.dat
+	{Name: "ETH-KEYSTORE", Extension: ".json", Header: []byte(`{"address":"`), MaxSize: 64 * 1024, Verify: verifyKeystore, Sizer: jsonSize, Metadata: keystoreMetadata},
+	{Name: "ETH-KEYSTORE", Extension: ".json", Header: []byte(`{"crypto":{`), CaseInsensitive: true, MaxSize: 64 * 1024, Verify: verifyKeystore, Sizer: jsonSize, Metadata: keystoreMetadata},
+	{Name: "ETH-KEYSTORE", Extension: ".json", Header: []byte(`{"version":3,`), MaxSize: 64 * 1024, Verify: verifyKeystore, Sizer: jsonSize, Metadata: keystoreMetadata},
+	{Name: "ELECTRUM", Extension: ".wallet", Header: []byte("QklFMQ"), Alignment: 512, MaxSize: 50 * 1024 * 1024, Verify: verifyBase64, Sizer: textSize}, // Encrypted ("BIE1" in base64)
+	{Name: "ELECTRUM", Extension: ".wallet", Header: []byte("{\n    \"addr_history\": {"), Alignment: 512, MaxSize: 50 * 1024 * 1024, Sizer: jsonSize, Metadata: electrumMetadata},
+
 	// Database
-	{Name: "SQLite", Extension: ".sqlite", Header: []byte{0x53, 0x51, 0x4C, 0x69, 0x74, 0x65, 0x20, 0x66, 0x6F, 0x72, 0x6D, 0x61, 0x74}, MaxSize: 1024 * 1024 * 1024},
+	{Name: "SQLite", Extension: ".sqlite", Header: []byte{0x53, 0x51, 0x4C, 0x69, 0x74, 0x65, 0x20, 0x66, 0x6F, 0x72, 0x6D, 0x61, 0x74}, MaxSize: 1024 * 1024 * 1024, Verify: verifySQLite, Sizer: sqliteSize, Classify: classifySQLite}, // Browser databases by schema
+	{Name: "SQLite-WAL", Extension: ".sqlite-wal", Header: []byte{0x37, 0x7F, 0x06, 0x82}, Alignment: 512, MaxSize: 1024 * 1024 * 1024, Verify: verifyWAL, Sizer: walSize},
+	{Name: "SQLite-WAL", Extension: ".sqlite-wal", Header: []byte{0x37, 0x7F, 0x06, 0x83}, Alignment: 512, MaxSize: 1024 * 1024 * 1024, Verify: verifyWAL, Sizer: walSize},
+	{Name: "SQLite-JOURNAL", Extension: ".sqlite-journal", Header: journalMagic, Alignment: 512, MaxSize: 1024 * 1024 * 1024, Verify: verifyJournal, Sizer: journalSize, Container: "SQLite-JOURNAL"}, // Later segments are part of the journal
+
+	// Virtual disks
+	{Name: "VMDK", Extension: ".vmdk", Header: []byte("KDMV"), Alignment: 512, MaxSize: 64 * 1024 * 1024 * 1024, Verify: verifyVMDK, Sizer: vmdkSize, Open: vmdkOpen},                  // Sparse and stream-optimized extents
+	{Name: "VMDK", Extension: ".vmdk", Header: []byte("# Disk DescriptorFile"), Alignment: 512, MaxSize: 64 * 1024, Sizer: textSize, Container: "VMDK"},                                // Embedded in monolithic sparse extents
+	{Name: "VHD", Extension: ".vhd", Header: []byte("conectix"), Alignment: 512, MaxSize: 64 * 1024 * 1024 * 1024, Verify: verifyVHD, Sizer: vhdSize, Container: "VHD", Open: vhdOpen}, // Dynamic and differencing; the footer copy at the end is part of the disk
+	{Name: "VHDX", Extension: ".vhdx", Header: []byte("vhdxfile"), Alignment: 512, MaxSize: 64 * 1024 * 1024 * 1024, Sizer: vhdxSize, Open: vhdxOpen},
+	{Name: "QCOW2", Extension: ".qcow2", Header: []byte{'Q', 'F', 'I', 0xFB}, Alignment: 512, MaxSize: 64 * 1024 * 1024 * 1024, Verify: verifyQCOW2, Sizer: qcow2Size, Open: qcow2Open},
+	{Name: "VDI", Extension: ".vdi", Header: []byte{0x7F, 0x10, 0xDA, 0xBE}, Offset: 0x40, Alignment: 512, MaxSize: 64 * 1024 * 1024 * 1024, Verify: verifyVDI, Sizer: vdiSize, Open: vdiOpen},
+}
+
+// RegisterSignature adds a signature to Signatures, for every carve that
+// does not choose its own, such as one a plugin brings
+func RegisterSignature(sig FileSignature) error {
+	switch {
+	case sig.Name == "":
+		return fmt.Errorf("signature without a name")
+	case len(sig.Header) == 0:
+		return fmt.Errorf("signature %s has no header", sig.Name)
+	case sig.Offset < 0 || sig.MinSize < 0 || sig.MaxSize < 0 || sig.Alignment < 0:
+		return fmt.Errorf("signature %s has a negative offset or size", sig.Name)
+	case sig.Wildcard != nil && len(sig.Wildcard) != len(sig.Header):
+		return fmt.Errorf("signature %s has a wildcard mask of another length than its header", sig.Name)
+	}
+	Signatures = append(Signatures, sig)
+	return nil
 }
 
 // CarvedFile represents a recovered file
@@ -70,6 +260,72 @@ type CarvedFile struct {
 	Offset    int64
 	Size      int64
 	Path      string
+	Verdict   Verdict           // Validation outcome (Unchecked until Validate runs)
+	Problem   string            // Why validation failed
+	SHA256    string            // Hex digest of the carved content, set once written
+	MD5       string            // Hex MD5 digest of the carved content, set once written
+	Aliases   []string          // Identical carvings collapsed into this file
+	Fragments []Fragment        // Pieces of a reassembled file (nil = contiguous from Offset)
+	Type      string            // Format name picked by the signature's Classify ("" = signature's)
+	Extension string            // Extension picked by the signature's Classify ("" = signature's)
+	Metadata  map[string]string // Details from the signature's Metadata hook
+	Repaired  string            // Copy rebuilt from a damaged file, such as a PDF without its xref table ("" = none)
+	Nested    string            // Directory of the files recursive carving found inside it ("" = none)
+
+	Confidence int // 0-100 estimate that the hit is a real file, set by Score
+}
+
+// typeName returns the format name the carved file is filed under
+func (f CarvedFile) typeName() string {
+	if f.Type != "" {
+		return f.Type
+	}
+	return f.Signature.Name
+}
+
+// extension returns the extension the carved file is written with
+func (f CarvedFile) extension() string {
+	if f.Extension != "" {
+		return f.Extension
+	}
+	return f.Signature.Extension
+}
+
+// Fragment is a contiguous byte range of a fragmented carved file
+type Fragment struct {
+	Offset int64
+	Length int64
+}
+
+// fragmentReader presents the fragments of a file as one contiguous stream
+type fragmentReader struct {
+	r         io.ReaderAt
+	fragments []Fragment
+}
+
+func (f *fragmentReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for _, frag := range f.fragments {
+		if len(p) == 0 {
+			break
+		}
+		if off >= frag.Length {
+			off -= frag.Length
+			continue
+		}
+		toRead := min(int64(len(p)), frag.Length-off)
+		m, err := f.r.ReadAt(p[:toRead], frag.Offset+off)
+		n += m
+		if err != nil && !(err == io.EOF && int64(m) == toRead) {
+			return n, err
+		}
+		p = p[m:]
+		off = 0
+	}
+	if len(p) > 0 {
+		return n, io.EOF
+	}
+	return n, nil
 }
 
 // Carver handles file carving
@@ -77,6 +333,18 @@ type Carver struct {
 	reader     *disk.Reader
 	bufSize    int
 	signatures []FileSignature
+	skipEmpty  bool
+	skipped    int64         // Bytes skipped as empty during the last Scan
+	nested     bool          // Scanning inside a carved container, whose progress is the outer scan's
+	extents    []disk.Extent // Ranges files may start in (nil = anywhere)
+	byDate     bool          // File photos by the date they were taken
+
+	checkpointPath  string
+	checkpointEvery int64
+	checkpoint      *Checkpoint // State of the current run when checkpointing
+	resumeOffset    int64
+	resumeFiles     []CarvedFile
+	resumeProcessed int
 }
 
 func NewCarver(reader *disk.Reader) *Carver {
@@ -92,9 +360,34 @@ func (c *Carver) SetSignatures(sigs []FileSignature) {
 	c.signatures = sigs
 }
 
-// Scan searches for file signatures
+// SetSkipEmpty enables the entropy pre-pass that skips all-zero and
+// constant-fill blocks instead of searching them for signatures
+func (c *Carver) SetSkipEmpty(skip bool) {
+	c.skipEmpty = skip
+}
+
+// SetByDate files photos with an EXIF date below their type directory by
+// year and month, named from the date, instead of by their offset
+func (c *Carver) SetByDate(byDate bool) {
+	c.byDate = byDate
+}
+
+// SetNested marks the carver as scanning inside a carved container: Scan
+// reports no progress of its own, as the outer scan's goes on around it
+func (c *Carver) SetNested(nested bool) {
+	c.nested = nested
+}
+
+// Skipped returns the number of bytes skipped as empty during the last Scan
+func (c *Carver) Skipped() int64 {
+	return c.skipped
+}
+
+// Scan searches for file signatures. After Resume it continues from the
+// checkpointed offset and keeps the candidates found before the interruption.
 func (c *Carver) Scan() ([]CarvedFile, error) {
-	var files []CarvedFile
+	files := c.resumeFiles
+	c.skipped = 0
 
 	diskSize := c.reader.Size()
 	bufSize := c.bufSize
@@ -110,125 +403,488 @@ func (c *Carver) Scan() ([]CarvedFile, error) {
 		overlap = 0
 	}
 
-	fmt.Printf("Scanning disk for file signatures (%d bytes)...\n", diskSize)
+	report := func(offset, found int64) {
+		if !c.nested {
+			c.reader.Report(disk.Progress{Phase: "carving scan", Current: offset, Total: diskSize, Found: found})
+		}
+	}
+	if !c.nested {
+		c.reader.Printf("Scanning disk for file signatures (%d bytes)...\n", diskSize)
+	}
+
+	index := indexSignatures(c.signatures)
+	lead := headerLead(c.signatures)
+	offset := c.resumeOffset
+	lastSave := offset
+	if c.checkpointPath != "" {
+		c.checkpoint = &Checkpoint{Source: c.reader.Path(), SourceSize: diskSize, Processed: c.resumeProcessed}
+	}
 
-	var offset int64
+	ext := 0 // First extent that has not been passed
 	for offset < diskSize {
+		if c.extents != nil {
+			start := c.nextExtent(&ext, offset)
+			if start < 0 {
+				report(diskSize, int64(len(files)))
+				break
+			}
+			offset = max(offset, start)
+		}
+
 		n, err := c.reader.ReadAt(buf, offset)
 		if err != nil && err != io.EOF {
+			if c.checkpoint != nil && c.reader.Err() != nil {
+				c.checkpoint.Offset = offset // A cancelled scan resumes here
+				c.saveCheckpoint(files)
+			}
 			return nil, err
 		}
 		if n == 0 {
 			break
 		}
 
-		// Search for signatures in buffer
+		// Move to next chunk, ensuring we always advance
+		advance := n - overlap
+		if advance <= 0 {
+			advance = n
+		}
+
+		// Search for signatures in buffer. Positions in the overlap are
+		// searched by the next chunk, so stop there unless this is the last one.
 		searchEnd := n - 64
 		if searchEnd < 0 {
 			searchEnd = n
 		}
+		if offset+int64(n) < diskSize && searchEnd > advance {
+			searchEnd = advance
+		}
 		for i := 0; i < searchEnd; i++ {
-			for _, sig := range c.signatures {
-				if len(sig.Header) > n-i {
+			if c.extents != nil {
+				start := c.nextExtent(&ext, offset+int64(i))
+				if start < 0 {
+					break
+				}
+				if start > offset+int64(i) {
+					i = int(min(start-offset, int64(searchEnd))) - 1
 					continue
 				}
+			}
 
-				if bytes.Equal(buf[i:i+len(sig.Header)], sig.Header) {
-					// Additional MP4/MOV validation
-					if sig.Name == "MP4" && i+8 < n {
-						ftyp := string(buf[i+4 : i+8])
-						if ftyp != "ftyp" {
-							continue
+			// Skip blocks of constant fill (an entropy of 0); nothing can
+			// start there but a header whose first bytes are the fill, as
+			// the zero size of an MP4, so the lead of the next block is
+			// searched unless the fill goes on past it
+			if c.skipEmpty && (i == 0 || (offset+int64(i))%EntropyBlockSize == 0) {
+				end := i + int(EntropyBlockSize-(offset+int64(i))%EntropyBlockSize)
+				if end > n {
+					end = n
+				}
+				if isConstant(buf[i:end]) {
+					skip, tail := end, end+lead
+					if tail > n {
+						tail = n
+					}
+					if !isConstant(buf[end-1 : tail]) {
+						skip = max(i, end-lead)
+					}
+					if skip > i {
+						if i < advance {
+							c.skipped += min(int64(skip), int64(advance)) - int64(i)
 						}
+						i = skip - 1
+						continue
+					}
+				}
+			}
+
+			for k := range index {
+				hdr := i + index[k].offset
+				if hdr >= n {
+					continue
+				}
+				for _, sig := range index[k].byByte[buf[hdr]] {
+					if len(sig.Header) > n-hdr {
+						continue
+					}
+					if sig.Alignment > 0 && (offset+int64(i))%sig.Alignment != 0 {
+						continue
 					}
 
-					fileOffset := offset + int64(i)
-					files = append(files, CarvedFile{
-						Signature: &sig,
-						Offset:    fileOffset,
-						Size:      sig.MaxSize,
-					})
+					if sig.matchHeader(buf[hdr:n]) {
+						if sig.Verify != nil && !sig.Verify(buf[i:n]) {
+							continue
+						}
+
+						fileOffset := offset + int64(i)
+						files = append(files, CarvedFile{
+							Signature: sig,
+							Offset:    fileOffset,
+							Size:      sig.MaxSize,
+						})
+					}
 				}
 			}
 		}
 
-		// Progress (only for large scans)
-		if diskSize > 10*1024*1024 && offset%(100*1024*1024) == 0 {
-			pct := float64(offset) / float64(diskSize) * 100
-			fmt.Printf("  %.1f%% scanned, found %d files...\n", pct, len(files))
+		offset += int64(advance)
+		report(min(offset, diskSize), int64(len(files)))
+
+		if c.checkpoint != nil && c.checkpointEvery > 0 && offset-lastSave >= c.checkpointEvery && offset < diskSize {
+			c.checkpoint.Offset = offset
+			if err := c.saveCheckpoint(files); err != nil {
+				return nil, err
+			}
+			lastSave = offset
 		}
+	}
 
-		// Move to next chunk, ensuring we always advance
-		advance := n - overlap
-		if advance <= 0 {
-			advance = n
+	if c.checkpoint != nil {
+		c.checkpoint.Offset = diskSize
+		c.checkpoint.ScanDone = true
+		if err := c.saveCheckpoint(files); err != nil {
+			return nil, err
 		}
-		offset += int64(advance)
+	}
+
+	if !c.nested && c.skipEmpty && c.skipped > 0 {
+		c.reader.Printf("  Skipped %d bytes of empty (constant-fill) space\n", c.skipped)
 	}
 
 	return files, nil
 }
 
+// sigIndex holds the signatures whose header starts Offset bytes into a
+// file, bucketed by the header's first byte
+type sigIndex struct {
+	offset int
+	byByte [256][]*FileSignature
+}
+
+// headerLead returns how many bytes before a block of data a header may
+// start at: the furthest a signature's header ends from its start, and
+// what its Verify looks at past it
+func headerLead(sigs []FileSignature) int {
+	lead := 0
+	for _, sig := range sigs {
+		lead = max(lead, sig.Offset+len(sig.Header))
+	}
+	return lead + verifyLead
+}
+
+// indexSignatures groups signatures so Scan only tries those whose first
+// header byte matches at each position
+func indexSignatures(sigs []FileSignature) []sigIndex {
+	var index []sigIndex
+	for i := range sigs {
+		sig := &sigs[i]
+		if len(sig.Header) == 0 {
+			continue
+		}
+
+		k := 0
+		for k < len(index) && index[k].offset != sig.Offset {
+			k++
+		}
+		if k == len(index) {
+			index = append(index, sigIndex{offset: sig.Offset})
+		}
+
+		first := sig.Header[0]
+		switch {
+		case len(sig.Wildcard) > 0 && sig.Wildcard[0]:
+			for b := range index[k].byByte {
+				index[k].byByte[b] = append(index[k].byByte[b], sig)
+			}
+		case sig.CaseInsensitive && lower(first) != upper(first):
+			index[k].byByte[lower(first)] = append(index[k].byByte[lower(first)], sig)
+			index[k].byByte[upper(first)] = append(index[k].byByte[upper(first)], sig)
+		default:
+			index[k].byByte[first] = append(index[k].byByte[first], sig)
+		}
+	}
+	return index
+}
+
 // RecoverFile extracts a carved file
 func (c *Carver) RecoverFile(file CarvedFile, outputDir string, index int) (string, error) {
-	filename := fmt.Sprintf("carved_%06d%s", index, file.Signature.Extension)
-	outputPath := filepath.Join(outputDir, file.Signature.Name, filename)
-
-	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+	if err := c.recoverFile(&file, outputDir, index); err != nil {
 		return "", err
 	}
+	return file.Path, nil
+}
 
-	outFile, err := os.Create(outputPath)
+// OpenFile returns a reader of a carved file's bytes as RecoverFile writes
+// them, its fragments reassembled, for it to be streamed elsewhere than to
+// a file
+func (c *Carver) OpenFile(file CarvedFile) (io.Reader, error) {
+	content, size, err := c.content(file)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	return io.NewSectionReader(content, 0, size), nil
+}
+
+// carving is the outcome of writing the carved file at index
+type carving struct {
+	index int
+	err   error
+}
+
+// recoverFile extracts a carved file and records its path, size and SHA-256
+func (c *Carver) recoverFile(file *CarvedFile, outputDir string, index int) error {
+	content, size, err := c.content(*file)
+	if err != nil {
+		return err
+	}
+	if file.Type == "" && file.Extension == "" && file.Signature.Classify != nil {
+		file.Type, file.Extension = file.Signature.Classify(content, size)
+	}
+	if file.Metadata == nil && file.Signature.Metadata != nil {
+		file.Metadata = file.Signature.Metadata(content, size)
+	}
+
+	outputPath := filepath.Join(outputDir, c.reader.OutputPath(c.carvedPath(*file, index)))
+	w, err := c.reader.CreateOutput(outputPath)
+	if err != nil {
+		return err
+	}
+	defer w.Discard()
+	if _, err := io.Copy(w, io.NewSectionReader(content, 0, size)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	digest := w.Digest()
+	file.Path = outputPath
+	file.Size = size
+	file.SHA256, file.MD5 = digest.SHA256, digest.MD5
+	return nil
+}
+
+// carvedPath returns where a carved file is written below the output
+// directory
+func (c *Carver) carvedPath(file CarvedFile, index int) string {
+	if c.byDate {
+		if dated := datedPath(file, index); dated != "" {
+			return filepath.Join(file.typeName(), dated)
+		}
+	}
+	return filepath.Join(file.typeName(), carvedName(file, index))
+}
+
+// carvedName returns the generic output file name for a carved file
+func carvedName(file CarvedFile, index int) string {
+	return fmt.Sprintf("carved_%06d%s", index, file.extension())
+}
+
+// content returns the bytes of a carved file as a ReaderAt along with its size,
+// reassembling fragments when the file is not contiguous
+func (c *Carver) content(file CarvedFile) (io.ReaderAt, int64, error) {
+	if len(file.Fragments) > 0 {
+		var size int64
+		for _, frag := range file.Fragments {
+			size += frag.Length
+		}
+		return &fragmentReader{r: c.reader, fragments: file.Fragments}, size, nil
 	}
-	defer outFile.Close()
 
+	size, err := c.carveSize(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	return io.NewSectionReader(c.reader, file.Offset, size), size, nil
+}
+
+// carveSize determines how many bytes to extract for a carved file, honouring
+// the signature's Sizer, footer and footer mode. Without either the file is
+// carved up to MaxSize (or the end of the disk).
+func (c *Carver) carveSize(file CarvedFile) (int64, error) {
 	maxSize := file.Signature.MaxSize
 	if maxSize == 0 {
 		maxSize = 10 * 1024 * 1024 // 10MB default
 	}
+	if remaining := c.reader.Size() - file.Offset; remaining < maxSize {
+		maxSize = remaining
+	}
 
-	buf := make([]byte, 64*1024) // 64KB chunks
-	var written int64
-	offset := file.Offset
+	if file.Signature.Sizer != nil && maxSize > 0 {
+		if size := file.Signature.Sizer(io.NewSectionReader(c.reader, file.Offset, maxSize), maxSize); size > 0 {
+			return size, nil
+		}
+	}
+
+	footer := file.Signature.Footer
+	if len(footer) == 0 || maxSize <= 0 {
+		return max(maxSize, 0), nil
+	}
 
-	for written < maxSize {
-		toRead := min(int64(len(buf)), maxSize-written)
-		n, err := c.reader.ReadAt(buf[:toRead], offset)
+	last := file.Signature.FooterMode == FooterLast
+	buf := make([]byte, 64*1024+len(footer)) // 64KB chunks plus footer overlap
+	found := int64(-1)
+	var pos int64 // Bytes of the file examined so far
+
+	for pos < maxSize {
+		toRead := min(int64(len(buf)), maxSize-pos)
+		n, err := c.reader.ReadAt(buf[:toRead], file.Offset+pos)
 		if err != nil && err != io.EOF {
-			break
+			return 0, err
 		}
 		if n == 0 {
 			break
 		}
 
-		// Look for footer if defined
-		if len(file.Signature.Footer) > 0 {
-			if idx := bytes.Index(buf[:n], file.Signature.Footer); idx >= 0 {
-				// Found footer, write up to and including footer
-				outFile.Write(buf[:idx+len(file.Signature.Footer)])
-				written += int64(idx + len(file.Signature.Footer))
+		// Skip the header itself so a footer equal to the header is not found at 0
+		start := 0
+		if pos == 0 && len(file.Signature.Header) < n {
+			start = len(file.Signature.Header)
+		}
+		if idx := file.Signature.indexFooter(buf[start:n], last); idx >= 0 {
+			found = pos + int64(start+idx)
+			if !last {
 				break
 			}
 		}
 
-		outFile.Write(buf[:n])
-		written += int64(n)
-		offset += int64(n)
+		// Step back so footers spanning chunk boundaries are still found
+		advance := int64(n - (len(footer) - 1))
+		if advance <= 0 || int64(n) < toRead {
+			break
+		}
+		pos += advance
+	}
+
+	if found < 0 {
+		return maxSize, nil
 	}
+	if file.Signature.FooterMode == FooterExclude {
+		return found, nil
+	}
+	return found + int64(len(footer)), nil
+}
+
+// Options controls a carving run started with Recover
+type Options struct {
+	Signatures []FileSignature // Signatures to search for (nil = built-in Signatures)
+	SkipEmpty  bool            // Skip all-zero and constant-fill blocks
+	Validate   ValidateMode    // Structure checks for carved files
+
+	KeepDuplicates bool   // Write every carving even if its content was already recovered
+	RepairJPEG     bool   // Reassemble JPEGs split into two fragments (gap carving)
+	MinSize        int64  // Drop carvings smaller than this many bytes
+	MinConfidence  int    // Drop hits scored below this (0-100, see Score)
+	ByDate         bool   // File photos by the date they were taken (YYYY/MM), from EXIF
+	SalvageSQLite  bool   // Write rows found on orphaned pages of SQLite databases to a .salvaged.tsv file
+	RepairMP4      bool   // Rebuild the index (moov) of MP4/MOV videos that lost theirs, as a .repaired copy
+	MP4Reference   string // Intact video from the same camera to take codec settings from (implies RepairMP4)
+	RepairPDF      bool   // Rebuild the cross-reference table of PDFs that lost theirs, as a .repaired copy
+	Depth          int    // Levels of containers, such as virtual disks and ZIP archives, to carve inside (0 = off)
+	FreeOnly       bool   // Carve only the space the disk's FAT32 and NTFS volumes have not allocated
+	DFXML          bool   // Describe the volumes' files and the carved files in DFXMLFile
+
+	Report   ReportFormat // Report the volumes' files and the carved files for other tools (ReportOff = none)
+	Session  bool         // Record the run in SessionFile
+	Manifest bool         // List the digests of the carved files in hash manifests (disk.ManifestSHA256)
+	Sidecars bool         // Describe each carved file in a sidecar next to it (SidecarSuffix)
 
-	return outputPath, nil
+	KnownFiles *HashSet // Drop files whose digest is in this set, such as the NSRL's (nil = off)
+	KeepKnown  bool     // Keep only the files in KnownFiles instead
+
+	Classify  bool           // Label the space outside the carved files by content and report it
+	Fragments []ContentClass // Write runs of that space in these classes to FragmentsDir (implies Classify)
+	Text      TextOptions    // Carve runs of text to TextDir
+
+	Carved *[]CarvedFile // Receives the carved files once written (nil = not kept)
+
+	Checkpoint      string // Save progress to this file so an interrupted run can resume ("" = off)
+	CheckpointEvery int64  // Bytes scanned or written between checkpoint saves
+	Resume          bool   // Continue from the checkpoint instead of starting over
+
+	// Set by SmartRecover and CarveNested
+	extents    []disk.Extent // Ranges to carve, in place of FreeOnly
+	filesystem []*Recovered  // Files recovered from the filesystems; carvings of them are folded into them
+	nested     bool          // Carving inside a carved container
 }
 
-// Recover is the main carving entry point
-func Recover(reader *disk.Reader, outputDir string, scanOnly bool) (int, error) {
+// Recover is the main carving entry point. Carvings it could not write are
+// returned as a *disk.PartialRecoveryError, once the others and the reports
+// of all have been written.
+func Recover(reader *disk.Reader, outputDir string, scanOnly bool, opts Options) (int, error) {
 	carver := NewCarver(reader)
+	if opts.Signatures != nil {
+		carver.SetSignatures(opts.Signatures)
+	}
+	carver.SetSkipEmpty(opts.SkipEmpty)
+	carver.SetNested(opts.nested)
+	carver.SetByDate(opts.ByDate)
+	if opts.FreeOnly {
+		extents, err := UnallocatedSpace(reader)
+		if err != nil {
+			reader.Printf("Carving the whole disk: %v\n", err)
+		} else {
+			var free int64
+			for _, e := range extents {
+				free += e.Length
+			}
+			reader.Printf("Carving %d bytes of unallocated space in %d extents\n", free, len(extents))
+			carver.SetExtents(extents)
+		}
+	}
+	if opts.extents != nil {
+		carver.SetExtents(opts.extents)
+	}
 
+	var mp4Ref *MP4Reference
+	if opts.MP4Reference != "" {
+		ref, err := LoadMP4Reference(opts.MP4Reference)
+		if err != nil {
+			return 0, err
+		}
+		mp4Ref = ref
+	}
+
+	start := 0 // First file the recovery phase has not handled yet
+	if opts.Checkpoint != "" {
+		carver.SetCheckpoint(opts.Checkpoint, opts.CheckpointEvery)
+		if opts.Resume {
+			cp, err := LoadCheckpoint(opts.Checkpoint)
+			if err != nil {
+				return 0, err
+			}
+			if cp.Source != reader.Path() {
+				reader.Warnf("Warning: checkpoint was taken from %s\n", cp.Source)
+			}
+			if _, err := carver.Resume(cp); err != nil {
+				return 0, err
+			}
+			start = cp.Processed
+			reader.Printf("Resuming at offset %d with %d files already found (%d processed)\n",
+				cp.Offset, len(cp.Files), cp.Processed)
+		}
+	}
+
+	filter := reader.Filter()
+	if filter.Active() {
+		carver.SetSignatures(filterSignatures(carver.signatures, filter))
+	}
+	if filter.Dated() {
+		reader.Println("Carved files have no filesystem times, so the date filters leave none of them out")
+	}
+
+	restore := reader.Purpose("carving scan")
 	files, err := carver.Scan()
+	restore()
 	if err != nil {
 		return 0, err
 	}
+	files = carver.dropContained(files)
+	defer reader.Purpose("carved file extraction")()
+	if filter.Active() {
+		var left int
+		files, left = carver.filterHits(files, filter)
+		reader.Printf("Left out %d hits the filter does not keep\n", left)
+	}
 
 	// Group by type
 	byType := make(map[string]int)
@@ -236,28 +892,426 @@ func Recover(reader *disk.Reader, outputDir string, scanOnly bool) (int, error)
 		byType[f.Signature.Name]++
 	}
 
-	fmt.Printf("\nFound %d potential files:\n", len(files))
+	reader.Printf("\nFound %d potential files:\n", len(files))
 	for name, count := range byType {
-		fmt.Printf("  %s: %d\n", name, count)
+		reader.Printf("  %s: %d\n", name, count)
+	}
+
+	// Score the hits, validating them first when asked since that counts
+	// towards the score
+	scored := scanOnly || opts.MinConfidence > 0
+	if scored {
+		for i := start; i < len(files); i++ {
+			f := &files[i]
+			if opts.Validate != ValidateOff {
+				if err := carver.Validate(f); err != nil {
+					reader.Errorf("  Failed to validate file at offset %d: %v\n", f.Offset, err)
+				}
+			}
+			carver.Score(f)
+		}
 	}
 
 	if scanOnly {
-		return len(files), nil
+		listed := printByConfidence(reader, files, opts.MinConfidence)
+
+		// Report what small artifacts such as shortcuts point to
+		for i := range files {
+			f := &files[i]
+			if f.Signature.Metadata == nil {
+				continue
+			}
+			if content, size, err := carver.content(*f); err == nil {
+				f.Metadata = f.Signature.Metadata(content, size)
+			}
+			if len(f.Metadata) > 0 {
+				reader.Printf("  %s at offset %d\n", f.Signature.Name, f.Offset)
+				printMetadata(reader, f.Metadata)
+			}
+		}
+		if opts.Classify || len(opts.Fragments) > 0 {
+			if err := carver.reportFree(files, outputDir, nil); err != nil {
+				return len(files), err
+			}
+		}
+		if opts.Text.MinLength > 0 {
+			if err := carver.carveText(outputDir, opts.Text, false); err != nil {
+				return len(files), err
+			}
+		}
+		if opts.Report != ReportOff {
+			if _, err := WriteReport(reader, outputDir, opts.Report, files, true); err != nil {
+				return listed, err
+			}
+		}
+		if opts.Session {
+			if _, err := WriteSession(reader, outputDir, SessionCarve, files, true); err != nil {
+				return listed, err
+			}
+		}
+		if opts.Carved != nil {
+			*opts.Carved = files
+		}
+		return listed, nil
 	}
 
-	fmt.Println("\nRecovering files...")
+	reader.Println("\nRecovering files...")
 	recovered := 0
-	for i, f := range files {
-		path, err := carver.RecoverFile(f, outputDir, i)
-		if err != nil {
-			fmt.Printf("  Failed to recover file at offset %d: %v\n", f.Offset, err)
-			continue
+	duplicates := 0
+	tooSmall := 0
+	doubtful := 0
+	known := 0
+	reconstructed := 0
+	verdicts := make(map[Verdict]int)
+	byHash := make(map[string]*CarvedFile)
+	recoveredFS := newFSIndex(opts.filesystem)
+	for i := range files[:start] {
+		if f := &files[i]; f.Path != "" && byHash[f.SHA256] == nil {
+			byHash[f.SHA256] = f
+		}
+	}
+
+	var written, lastSave int64
+	var saveErr error
+	var failed []*disk.FileError
+	stop := -1 // The first file a cancelled run left unwritten, for a resume to start at
+	jobs := func(yield func(func() carving) bool) {
+		for i := start; i < len(files); i++ {
+			f := &files[i]
+			if reader.Err() != nil {
+				if stop < 0 {
+					stop = i
+				}
+				return
+			}
+			if !carver.nested {
+				reader.Report(disk.Progress{
+					Phase:   "carved file extraction",
+					Current: int64(i),
+					Total:   int64(len(files)),
+					Found:   int64(recovered),
+					Item:    fmt.Sprintf("%s at offset %d", f.Signature.Name, f.Offset),
+				})
+			}
+
+			dir := outputDir
+			if f.Confidence < opts.MinConfidence {
+				doubtful++
+				continue
+			}
+			if minSize := max(opts.MinSize, f.Signature.MinSize); minSize > 0 {
+				_, size, err := carver.content(*f)
+				if err == nil && size < minSize {
+					tooSmall++
+					continue
+				}
+			}
+
+			repairable := opts.RepairJPEG && f.Signature.Name == "JPEG"
+			if (opts.Validate != ValidateOff && !scored) || (repairable && opts.Validate == ValidateOff) {
+				if err := carver.Validate(f); err != nil {
+					reader.Errorf("  Failed to validate file at offset %d: %v\n", f.Offset, err)
+					continue
+				}
+			}
+			if repairable && f.Verdict == Invalid {
+				repaired, err := carver.RepairJPEG(f)
+				if err != nil {
+					reader.Errorf("  Failed to repair JPEG at offset %d: %v\n", f.Offset, err)
+				} else if repaired {
+					f.Verdict, f.Problem = Valid, ""
+					reader.Printf("  Reassembled fragmented JPEG at offset %d (second fragment at %d)\n",
+						f.Offset, f.Fragments[1].Offset)
+				}
+			}
+			if opts.Validate != ValidateOff {
+				verdicts[f.Verdict]++
+				if f.Verdict == Invalid {
+					switch opts.Validate {
+					case ValidateDiscard:
+						reader.Printf("  Discarded invalid %s at offset %d: %s\n", f.Signature.Name, f.Offset, f.Problem)
+						continue
+					case ValidateQuarantine:
+						dir = filepath.Join(outputDir, QuarantineDir)
+					}
+				}
+			}
+
+			if !yield(func() carving { return carving{i, carver.recoverFile(f, dir, i)} }) {
+				return
+			}
 		}
-		fmt.Printf("  Recovered: %s\n", path)
+	}
+	disk.InOrder(reader.Workers(), jobs, func(c carving) {
+		i, f := c.index, &files[c.index]
+		// The files before this one are done with
+		if carver.checkpoint != nil && opts.CheckpointEvery > 0 && written-lastSave >= opts.CheckpointEvery && saveErr == nil {
+			carver.checkpoint.Processed = i
+			saveErr = carver.saveCheckpoint(files)
+			lastSave = written
+		}
+		if c.err != nil {
+			if reader.Err() != nil {
+				// Cut short, and written again on resume
+				if stop < 0 || i < stop {
+					stop = i
+				}
+				return
+			}
+			reader.Errorf("  Failed to recover file at offset %d: %v\n", f.Offset, c.err)
+			failed = append(failed, &disk.FileError{Path: carver.carvedPath(*f, i), Err: c.err})
+			return
+		}
+		path := f.Path
+		written += f.Size
+
+		if opts.KnownFiles.filtered(reader, path, f.SHA256, opts.KeepKnown) {
+			os.Remove(path)
+			f.Path = ""
+			known++
+			return
+		}
+
+		// Collapse identical content reached through several signatures, or
+		// already recovered from the filesystem
+		if !opts.KeepDuplicates {
+			if orig := recoveredFS.match(f); orig != nil {
+				os.Remove(path)
+				orig.Also = append(orig.Also, Provenance{Source: "carved", Offset: f.Offset, SHA256: f.SHA256})
+				f.Path = ""
+				reader.Verbosef("  Duplicate: %s is %s, recovered from the filesystem\n",
+					carver.carvedPath(*f, i), orig.Path)
+				duplicates++
+				return
+			}
+			if orig, ok := byHash[f.SHA256]; ok {
+				os.Remove(path)
+				alias := carver.carvedPath(*f, i)
+				orig.Aliases = append(orig.Aliases, alias)
+				f.Path = ""
+				reader.Verbosef("  Duplicate: %s is identical to %s\n", alias, orig.Path)
+				duplicates++
+				return
+			}
+			byHash[f.SHA256] = f
+		}
+
+		switch f.Verdict {
+		case Invalid:
+			reader.Printf("  Recovered: %s [invalid: %s]\n", path, f.Problem)
+		case Valid:
+			reader.Printf("  Recovered: %s [valid]\n", path)
+		default:
+			reader.Printf("  Recovered: %s\n", path)
+		}
+		printMetadata(reader, f.Metadata)
+		reader.Recovered(disk.WrittenFile{
+			Path: path, Source: "carved", Type: f.typeName(), Offset: f.Offset,
+			Digest: disk.Digest{Size: f.Size, MD5: f.MD5, SHA256: f.SHA256},
+		})
 		recovered++
+
+		// What is made from the file is handed on with it, once done
+		made := []string{path}
+		if f.Signature.Extract != nil {
+			extracted, n, err := carver.ExtractEmbedded(f)
+			if err != nil {
+				reader.Errorf("  Failed to extract files from %s: %v\n", path, err)
+			} else if n > 0 {
+				reader.Printf("  Extracted %d embedded files to %s\n", n, extracted)
+				made = append(made, extracted)
+			}
+		}
+		if opts.SalvageSQLite && f.Signature.Name == "SQLite" {
+			salvaged, rows, err := carver.SalvageSQLite(f)
+			if err != nil {
+				reader.Errorf("  Failed to salvage records from %s: %v\n", path, err)
+			} else if rows > 0 {
+				reader.Printf("  Salvaged %d records from orphaned pages to %s\n", rows, salvaged)
+				made = append(made, salvaged)
+			}
+		}
+		if (opts.RepairMP4 || mp4Ref != nil) && (f.Signature.Name == "MP4" || f.Signature.Name == "MOV") {
+			repaired, samples, err := carver.RepairMP4(f, mp4Ref)
+			if err != nil {
+				reader.Errorf("  Failed to repair %s: %v\n", path, err)
+			} else if samples > 0 {
+				f.Repaired = repaired
+				reconstructed++
+				reader.Printf("  Rebuilt the index of %d video frames to %s\n", samples, repaired)
+			}
+		}
+		if opts.RepairPDF && f.Signature.Name == "PDF" {
+			repaired, objects, err := carver.RepairPDF(f)
+			if err != nil {
+				reader.Errorf("  Failed to repair %s: %v\n", path, err)
+			} else if objects > 0 {
+				f.Repaired = repaired
+				reconstructed++
+				reader.Printf("  Rebuilt the cross-reference table of %d objects to %s [reconstructed]\n", objects, repaired)
+			}
+		}
+		if opts.Depth > 0 && f.Signature.Open != nil {
+			nested, n, err := carver.CarveNested(f, opts)
+			var partial *disk.PartialRecoveryError
+			if errors.As(err, &partial) {
+				failed = append(failed, partial.Failed...)
+				err = nil
+			}
+			if err != nil {
+				reader.Errorf("  Failed to carve inside %s: %v\n", path, err)
+			} else if nested != "" {
+				f.Nested = nested
+				recovered += n
+				reader.Printf("  Recovered %d files from inside %s to %s\n", n, path, nested)
+			}
+		}
+		if f.Repaired != "" {
+			made = append(made, f.Repaired)
+		}
+		if f.Nested != "" {
+			made = append(made, f.Nested)
+		}
+		for _, p := range made {
+			reader.Finished(p)
+		}
+	})
+	// A cancelled run can resume from the file it stopped at
+	if stop >= 0 {
+		if carver.checkpoint != nil {
+			carver.checkpoint.Processed = stop
+			carver.saveCheckpoint(files)
+		}
+		return recovered, reader.Err()
+	}
+	if saveErr != nil {
+		return recovered, saveErr
+	}
+
+	if opts.Classify || len(opts.Fragments) > 0 {
+		if err := carver.reportFree(files, outputDir, opts.Fragments); err != nil {
+			return recovered, err
+		}
+	}
+	if opts.Text.MinLength > 0 {
+		if err := carver.carveText(outputDir, opts.Text, true); err != nil {
+			return recovered, err
+		}
 	}
 
-	return recovered, nil
+	if opts.DFXML && !scanOnly {
+		if _, err := WriteDFXML(reader, outputDir, files); err != nil {
+			return recovered, err
+		}
+	}
+	if opts.Report != ReportOff {
+		if _, err := WriteReport(reader, outputDir, opts.Report, files, false); err != nil {
+			return recovered, err
+		}
+	}
+	if opts.Session {
+		if _, err := WriteSession(reader, outputDir, SessionCarve, files, false); err != nil {
+			return recovered, err
+		}
+	}
+	if opts.Manifest {
+		if err := writeManifest(reader, outputDir, nil, files); err != nil {
+			return recovered, err
+		}
+	}
+	if opts.Sidecars {
+		if _, err := WriteSidecars(reader, outputDir, SessionCarve, files, false); err != nil {
+			return recovered, err
+		}
+	}
+	if opts.Carved != nil {
+		*opts.Carved = files
+	}
+
+	// The run is complete; a leftover checkpoint would only resume into nothing
+	if carver.checkpoint != nil {
+		os.Remove(opts.Checkpoint)
+	}
+
+	if tooSmall > 0 {
+		reader.Printf("\nSkipped %d carvings below the minimum size\n", tooSmall)
+	}
+	if doubtful > 0 {
+		reader.Printf("\nSkipped %d hits below confidence %d\n", doubtful, opts.MinConfidence)
+	}
+	if known > 0 {
+		reader.Printf("\nSkipped %d carvings %s\n", known, knownReason(opts.KeepKnown))
+	}
+	if duplicates > 0 {
+		reader.Printf("\nCollapsed %d duplicate carvings\n", duplicates)
+	}
+	if reconstructed > 0 {
+		reader.Printf("\nReconstructed %d damaged files (written as .repaired copies)\n", reconstructed)
+	}
+	if opts.Validate != ValidateOff {
+		reader.Printf("\nValidation: %d valid, %d invalid, %d unchecked\n",
+			verdicts[Valid], verdicts[Invalid], verdicts[Unchecked])
+	}
+
+	return recovered, disk.Partial(recovered, failed)
+}
+
+// printMetadata prints a carved file's metadata below its report line
+func printMetadata(reader *disk.Reader, meta map[string]string) {
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		reader.Printf("      %s: %s\n", k, meta[k])
+	}
+}
+
+// dropContained removes hits that lie inside a carving of their signature's
+// Container, since they belong to that file rather than being files of their own
+func (c *Carver) dropContained(files []CarvedFile) []CarvedFile {
+	containers := make(map[string]bool)
+	for _, f := range files {
+		if f.Signature.Container != "" {
+			containers[f.Signature.Container] = true
+		}
+	}
+	if len(containers) == 0 {
+		return files
+	}
+
+	type span struct {
+		name       string
+		start, end int64
+	}
+	var spans []span
+
+	// In offset order a container is sized before the hits inside it, and
+	// those are dropped without being sized themselves. Formats that contain
+	// themselves, like the frames of an MP3 stream, are then sized once per
+	// file rather than once per hit.
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Offset < files[j].Offset })
+	kept := files[:0]
+	for _, f := range files {
+		inside := false
+		for _, s := range spans {
+			if s.name == f.Signature.Container && f.Offset > s.start && f.Offset < s.end {
+				inside = true
+				break
+			}
+		}
+		if inside {
+			continue
+		}
+		kept = append(kept, f)
+		if containers[f.Signature.Name] {
+			if _, size, err := c.content(f); err == nil {
+				spans = append(spans, span{f.Signature.Name, f.Offset, f.Offset + size})
+			}
+		}
+	}
+	return kept
 }
 
 func min(a, b int64) int64 {
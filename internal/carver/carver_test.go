@@ -2,8 +2,12 @@ package carver
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/shubham/recovery/internal/disk"
@@ -44,8 +48,8 @@ func TestSignatureDetection(t *testing.T) {
 		{
 			name:      "ZIP/DOCX",
 			header:    []byte{0x50, 0x4B, 0x03, 0x04},
-			wantType:  "DOCX", // First match
-			wantCount: 4,      // DOCX, XLSX, PPTX, ZIP all match
+			wantType:  "ZIP", // Office documents are classified after carving
+			wantCount: 1,
 		},
 		{
 			name:      "No signature",
@@ -208,6 +212,15 @@ func TestRecoverFile(t *testing.T) {
 	if !bytes.HasSuffix(recovered, jpegFooter) {
 		t.Errorf("Recovered file missing JPEG footer")
 	}
+
+	// Streamed, it is the same
+	r, err := carver.OpenFile(files[0])
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	if streamed, err := io.ReadAll(r); err != nil || !bytes.Equal(streamed, recovered) {
+		t.Errorf("Expected OpenFile to read what RecoverFile wrote, got %d bytes (%v)", len(streamed), err)
+	}
 }
 
 func TestSetSignatures(t *testing.T) {
@@ -245,3 +258,257 @@ func TestSetSignatures(t *testing.T) {
 		t.Errorf("Expected 0 files with PNG-only filter, got %d", len(files))
 	}
 }
+
+func TestRecoverDeduplicates(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	// One header matched by two signatures produces identical carvings
+	data := make([]byte, 64*1024)
+	copy(data[0:], "DUPE")
+
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	sigs := []FileSignature{
+		{Name: "A", Extension: ".a", Header: []byte("DUPE"), MaxSize: 1024},
+		{Name: "B", Extension: ".b", Header: []byte("DUPE"), MaxSize: 1024},
+	}
+
+	count, err := Recover(reader, outputDir, false, Options{Signatures: sigs})
+	if err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 recovered file, got %d", count)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "B", "carved_000001.b")); !os.IsNotExist(err) {
+		t.Errorf("Duplicate B carving should have been removed")
+	}
+
+	count, err = Recover(reader, filepath.Join(tmpDir, "all"), false, Options{Signatures: sigs, KeepDuplicates: true})
+	if err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 recovered files with KeepDuplicates, got %d", count)
+	}
+}
+
+// senderFunc is a function used as a disk.Sender
+type senderFunc func(path string) error
+
+func (fn senderFunc) Send(path string) error {
+	return fn(path)
+}
+
+func TestRecoverSends(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	outputDir := filepath.Join(tmpDir, "output")
+	data := make([]byte, 64*1024)
+	copy(data[0:], "DUPE")
+	copy(data[8192:], "ONCE")
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	var sent []string
+	reader.SetSender(senderFunc(func(path string) error {
+		sent = append(sent, path)
+		return os.Remove(path)
+	}))
+	sigs := []FileSignature{
+		{Name: "A", Extension: ".a", Header: []byte("DUPE"), MaxSize: 1024},
+		{Name: "B", Extension: ".b", Header: []byte("DUPE"), MaxSize: 1024},
+		{Name: "C", Extension: ".c", Header: []byte("ONCE"), MaxSize: 1024},
+	}
+	var carved []CarvedFile
+	count, err := Recover(reader, outputDir, false, Options{Signatures: sigs, Session: true, Carved: &carved})
+	if err != nil || count != 2 {
+		t.Fatalf("Expected 2 files recovered, got %d (%v)", count, err)
+	}
+	// Each once, and not the duplicate dropped before
+	want := []string{filepath.Join(outputDir, "A", "carved_000000.a"), filepath.Join(outputDir, "C", "carved_000002.c")}
+	if !slices.Equal(sent, want) {
+		t.Errorf("Expected %v sent, got %v", want, sent)
+	}
+	session, err := LoadSession(filepath.Join(outputDir, SessionFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovered := 0
+	for _, f := range session.Files {
+		if f.Recovery == RecoveryRecovered {
+			recovered++
+		}
+	}
+	if recovered != 2 {
+		t.Errorf("Expected the files sent recorded as recovered, got %+v", session.Files)
+	}
+}
+
+// findSignature returns the built-in signature with the given name
+func findSignature(t *testing.T, name string) FileSignature {
+	t.Helper()
+	for _, sig := range Signatures {
+		if sig.Name == name {
+			return sig
+		}
+	}
+	t.Fatalf("No built-in signature named %s", name)
+	return FileSignature{}
+}
+
+func TestRecoverMinSize(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	// A 12-byte "JPEG" is far below JPEG's minimum size
+	data := make([]byte, 64*1024)
+	copy(data[0:], []byte{0xFF, 0xD8, 0xFF, 0xE0})
+	copy(data[10:], []byte{0xFF, 0xD9})
+	copy(data[1024:], []byte{0xFF, 0xD8, 0xFF, 0xE0})
+	copy(data[1024+2000:], []byte{0xFF, 0xD9})
+
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	opts := Options{Signatures: []FileSignature{findSignature(t, "JPEG")}}
+	count, err := Recover(reader, filepath.Join(tmpDir, "out1"), false, opts)
+	if err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 file above JPEG minimum size, got %d", count)
+	}
+
+	opts.MinSize = 4096
+	count, err = Recover(reader, filepath.Join(tmpDir, "out2"), false, opts)
+	if err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected 0 files above 4096 bytes, got %d", count)
+	}
+}
+
+func TestScanProgress(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	data := make([]byte, 3*1024*1024)
+	copy(data[2*1024*1024:], []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A})
+
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	carver := NewCarver(reader)
+	carver.SetSignatures([]FileSignature{findSignature(t, "PNG")})
+
+	var calls int
+	var lastOffset, lastFound int64
+	reader.SetReporter(progressFunc(func(p disk.Progress) {
+		calls++
+		if p.Phase != "carving scan" {
+			t.Errorf("Expected the carving scan, got %q", p.Phase)
+		}
+		if p.Current < lastOffset {
+			t.Errorf("Progress went backwards: %d after %d", p.Current, lastOffset)
+		}
+		if p.Total != int64(len(data)) {
+			t.Errorf("Expected total %d, got %d", len(data), p.Total)
+		}
+		lastOffset, lastFound = p.Current, p.Found
+	}))
+
+	if _, err := carver.Scan(); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	if calls < 3 {
+		t.Errorf("Expected at least 3 progress calls, got %d", calls)
+	}
+	if lastOffset != int64(len(data)) || lastFound != 1 {
+		t.Errorf("Expected final progress %d/1, got %d/%d", len(data), lastOffset, lastFound)
+	}
+}
+
+// progressFunc is a ProgressReporter that passes progress to a function and
+// drops messages
+type progressFunc func(disk.Progress)
+
+func (f progressFunc) Progress(p disk.Progress) { f(p) }
+func (f progressFunc) Message(string)           {}
+
+func TestRecoverWorkers(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	// Eight files, each of its own content, and a copy of the first
+	data := make([]byte, 64*1024)
+	for i := range 9 {
+		copy(data[i*4096:], fmt.Sprintf("FILE%d", i%8))
+	}
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+	var out bytes.Buffer
+	reader.SetReporter(disk.NewPrinter(&out))
+	reader.SetWorkers(4)
+
+	sigs := []FileSignature{{Name: "F", Extension: ".f", Header: []byte("FILE"), MaxSize: 1024}}
+	count, err := Recover(reader, filepath.Join(tmpDir, "out"), false, Options{Signatures: sigs})
+	if err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if count != 8 {
+		t.Errorf("Expected 8 recovered files, got %d", count)
+	}
+	var recovered []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if path, ok := strings.CutPrefix(line, "  Recovered: "); ok {
+			recovered = append(recovered, filepath.Base(path))
+		}
+	}
+	want := []string{"carved_000000.f", "carved_000001.f", "carved_000002.f", "carved_000003.f",
+		"carved_000004.f", "carved_000005.f", "carved_000006.f", "carved_000007.f"}
+	if !slices.Equal(recovered, want) {
+		t.Errorf("Expected the files reported in order, got %v", recovered)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "out", "F", "carved_000008.f")); !os.IsNotExist(err) {
+		t.Errorf("Expected the copy of the first file to be removed")
+	}
+}
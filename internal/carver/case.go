@@ -0,0 +1,147 @@
+package carver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A case keeps the runs of an investigation together, whatever device they
+// read, in one layout:
+//
+//	cases/<case-id>/
+//	  case.json                    examiner, notes, evidence and runs
+//	  evidence1/                   a device or image, by serial number or path
+//	    run-20240301T101502Z/      the output directory of a run: session.json,
+//	                               reports, manifests and recovered files
+//	  evidence2/
+//
+// case.json lists each piece of evidence with its source, serial number and
+// size, and each run with when it started, who ran it and how.
+
+// Case layout names
+const (
+	CasesDir = "cases"
+	CaseFile = "case.json"
+)
+
+// Case is the metadata of a case
+type Case struct {
+	ID       string     `json:"id"`
+	Created  string     `json:"created"`
+	Updated  string     `json:"updated"`
+	Examiner string     `json:"examiner,omitempty"` // Who opened the case
+	Evidence []Evidence `json:"evidence"`
+	Runs     []CaseRun  `json:"runs"`
+}
+
+// Evidence is a device or image examined in a case
+type Evidence struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`           // Path it was read from first
+	Serial string `json:"serial,omitempty"` // Of the drive, when known
+	Size   int64  `json:"size"`
+	Added  string `json:"added"`
+}
+
+// CaseRun is a run of the tool in a case
+type CaseRun struct {
+	ID       string `json:"id"`
+	Evidence string `json:"evidence"`
+	Source   string `json:"source"`
+	Started  string `json:"started"`
+	Examiner string `json:"examiner,omitempty"`
+	Notes    string `json:"notes,omitempty"`
+	Command  string `json:"command"`
+	Output   string `json:"output"` // Relative to the case directory
+}
+
+// OpenCase loads the case with the given id below root, creating it when it
+// does not exist yet, and returns it with its directory
+func OpenCase(root, id string) (*Case, string, error) {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return nil, "", fmt.Errorf("invalid case id %q", id)
+	}
+	dir := filepath.Join(root, id)
+	data, err := os.ReadFile(filepath.Join(dir, CaseFile))
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, "", err
+		}
+		now := time.Now().UTC().Format(time.RFC3339)
+		return &Case{ID: id, Created: now, Updated: now, Evidence: []Evidence{}, Runs: []CaseRun{}}, dir, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	var c Case
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, "", fmt.Errorf("invalid case file %s: %w", filepath.Join(dir, CaseFile), err)
+	}
+	return &c, dir, nil
+}
+
+// AddRun records a run reading source, the drive with the given serial
+// number ("" = unknown) and size, and returns its output directory
+// relative to the case directory. A source is the evidence it was before
+// when its serial number matches, or without one, its path and size do.
+func (c *Case) AddRun(source, serial string, size int64, examiner, notes, command string) string {
+	now := time.Now().UTC()
+	var ev *Evidence
+	for i := range c.Evidence {
+		e := &c.Evidence[i]
+		if serial != "" && e.Serial == serial || serial == "" && e.Serial == "" && e.Source == source && e.Size == size {
+			ev = e
+			break
+		}
+	}
+	if ev == nil {
+		c.Evidence = append(c.Evidence, Evidence{
+			ID:     fmt.Sprintf("evidence%d", len(c.Evidence)+1),
+			Source: source,
+			Serial: serial,
+			Size:   size,
+			Added:  now.Format(time.RFC3339),
+		})
+		ev = &c.Evidence[len(c.Evidence)-1]
+	}
+	if c.Examiner == "" {
+		c.Examiner = examiner
+	}
+
+	// Runs started within the same second get a suffix
+	id := "run-" + now.Format("20060102T150405Z")
+	taken := make(map[string]bool)
+	for _, r := range c.Runs {
+		taken[r.Output] = true
+	}
+	output := filepath.ToSlash(filepath.Join(ev.ID, id))
+	for n := 2; taken[output]; n++ {
+		output = filepath.ToSlash(filepath.Join(ev.ID, fmt.Sprintf("%s-%d", id, n)))
+	}
+
+	c.Runs = append(c.Runs, CaseRun{
+		ID:       filepath.Base(output),
+		Evidence: ev.ID,
+		Source:   source,
+		Started:  now.Format(time.RFC3339),
+		Examiner: examiner,
+		Notes:    notes,
+		Command:  command,
+		Output:   output,
+	})
+	c.Updated = now.Format(time.RFC3339)
+	return output
+}
+
+// Save writes the case file to the case directory dir
+func (c *Case) Save(dir string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, CaseFile), append(data, '\n'), 0644)
+}
@@ -0,0 +1,67 @@
+package carver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCase(t *testing.T) {
+	root := filepath.Join(t.TempDir(), CasesDir)
+
+	for _, id := range []string{"", ".", "..", "a/b", `a\b`} {
+		if _, _, err := OpenCase(root, id); err == nil {
+			t.Errorf("Expected case id %q to be rejected", id)
+		}
+	}
+
+	c, dir, err := OpenCase(root, "2024-017")
+	if err != nil {
+		t.Fatalf("Failed to open case: %v", err)
+	}
+	if dir != filepath.Join(root, "2024-017") {
+		t.Errorf("Unexpected case directory %s", dir)
+	}
+
+	// Two runs on a drive by serial number, even at another path, then an
+	// image without one
+	first := c.AddRun("/dev/sdb", "WD-1234", 1<<30, "anna", "first pass", "recover -case 2024-017")
+	second := c.AddRun("/dev/sdc", "WD-1234", 1<<30, "ben", "", "recover -case 2024-017 -mode carve")
+	image := c.AddRun("usb.img", "", 1<<20, "anna", "", "recover -case 2024-017 -device usb.img")
+	if !strings.HasPrefix(first, "evidence1/run-") || !strings.HasPrefix(second, "evidence1/run-") || first == second {
+		t.Errorf("Expected two runs of evidence1, got %s and %s", first, second)
+	}
+	if !strings.HasPrefix(image, "evidence2/run-") {
+		t.Errorf("Expected a run of evidence2, got %s", image)
+	}
+	if err := c.Save(dir); err != nil {
+		t.Fatalf("Failed to save case: %v", err)
+	}
+
+	// Reopening the case carries on with its evidence
+	c, _, err = OpenCase(root, "2024-017")
+	if err != nil {
+		t.Fatalf("Failed to reopen case: %v", err)
+	}
+	if c.Examiner != "anna" || len(c.Evidence) != 2 || len(c.Runs) != 3 {
+		t.Fatalf("Unexpected case %+v", c)
+	}
+	if e := c.Evidence[0]; e.Source != "/dev/sdb" || e.Serial != "WD-1234" {
+		t.Errorf("Unexpected evidence %+v", e)
+	}
+	if r := c.Runs[1]; r.Examiner != "ben" || r.Evidence != "evidence1" || r.Source != "/dev/sdc" || r.Output != second {
+		t.Errorf("Unexpected run %+v", r)
+	}
+	if again := c.AddRun("usb.img", "", 1<<20, "anna", "", ""); !strings.HasPrefix(again, "evidence2/") {
+		t.Errorf("Expected the image to be evidence2, got %s", again)
+	}
+	if changed := c.AddRun("usb.img", "", 2<<20, "anna", "", ""); !strings.HasPrefix(changed, "evidence3/") {
+		t.Errorf("Expected an image of another size to be new evidence, got %s", changed)
+	}
+
+	os.WriteFile(filepath.Join(dir, CaseFile), []byte("{"), 0644)
+	if _, _, err := OpenCase(root, "2024-017"); err == nil {
+		t.Error("Expected an invalid case file to be an error")
+	}
+}
@@ -0,0 +1,286 @@
+package carver
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// Compound File Binary (OLE2) is the container behind legacy Office
+// documents and Outlook .msg files. The file is a 512-byte header followed by
+// fixed-size sectors; the FAT maps each sector to the next one in its chain,
+// so the highest sector in use marks the end of the file.
+
+const (
+	cfbMaxRegSect   = 0xFFFFFFFA // Higher values mark free, end-of-chain or FAT sectors
+	cfbFreeSect     = 0xFFFFFFFF
+	cfbHeaderFAT    = 109 // DIFAT entries stored in the header
+	cfbDirEntrySize = 128
+	cfbMaxDirSize   = 16 * 1024 * 1024 // Directory streams larger than this are corrupt
+
+	cfbMiniSectorSize = 64
+	cfbMaxStreamSize  = 64 * 1024 * 1024 // Largest stream read for classification
+)
+
+type cfbFile struct {
+	r          io.ReaderAt
+	limit      int64
+	sectorSize int64
+	firstDir   uint32
+	miniCutoff int64
+	firstMini  uint32
+	numMini    int64 // Sectors in the mini FAT
+	fat        []uint32
+}
+
+// cfbEntry is a storage or stream in the directory
+type cfbEntry struct {
+	name  string
+	typ   byte // 1 storage, 2 stream, 5 root
+	start uint32
+	size  int64
+}
+
+// openCFB reads the header and the FAT of a compound file. FAT sectors
+// beyond limit are ignored, leaving the FAT partial for truncated files.
+func openCFB(r io.ReaderAt, limit int64) (*cfbFile, bool) {
+	hdr := make([]byte, 512)
+	if _, err := r.ReadAt(hdr, 0); err != nil || !verifyCFB(hdr) {
+		return nil, false
+	}
+
+	f := &cfbFile{
+		r:          r,
+		limit:      limit,
+		sectorSize: 1 << binary.LittleEndian.Uint16(hdr[0x1E:0x20]),
+		firstDir:   binary.LittleEndian.Uint32(hdr[0x30:0x34]),
+		miniCutoff: int64(binary.LittleEndian.Uint32(hdr[0x38:0x3C])),
+		firstMini:  binary.LittleEndian.Uint32(hdr[0x3C:0x40]),
+		numMini:    int64(binary.LittleEndian.Uint32(hdr[0x40:0x44])),
+	}
+	numFAT := int64(binary.LittleEndian.Uint32(hdr[0x2C:0x30]))
+	if numFAT == 0 || numFAT*f.sectorSize > limit {
+		return nil, false
+	}
+
+	// FAT sector locations: 109 in the header, the rest in a DIFAT chain
+	var fatSectors []uint32
+	for i := int64(0); i < min(numFAT, cfbHeaderFAT); i++ {
+		fatSectors = append(fatSectors, binary.LittleEndian.Uint32(hdr[0x4C+4*i:]))
+	}
+	difat := binary.LittleEndian.Uint32(hdr[0x44:0x48])
+	perSector := f.sectorSize/4 - 1
+	for int64(len(fatSectors)) < numFAT && difat <= cfbMaxRegSect {
+		sector, ok := f.readSector(difat)
+		if !ok {
+			break
+		}
+		for i := int64(0); i < perSector && int64(len(fatSectors)) < numFAT; i++ {
+			fatSectors = append(fatSectors, binary.LittleEndian.Uint32(sector[4*i:]))
+		}
+		difat = binary.LittleEndian.Uint32(sector[4*perSector:])
+	}
+
+	for _, s := range fatSectors {
+		sector, ok := f.readSector(s)
+		if !ok {
+			break
+		}
+		for i := int64(0); i < f.sectorSize; i += 4 {
+			f.fat = append(f.fat, binary.LittleEndian.Uint32(sector[i:]))
+		}
+	}
+	if len(f.fat) == 0 {
+		return nil, false
+	}
+	return f, true
+}
+
+// readSector reads sector s, which follows the header-sized sector 0 slot
+func (f *cfbFile) readSector(s uint32) ([]byte, bool) {
+	off := (int64(s) + 1) * f.sectorSize
+	if s > cfbMaxRegSect || off+f.sectorSize > f.limit {
+		return nil, false
+	}
+	buf := make([]byte, f.sectorSize)
+	if _, err := f.r.ReadAt(buf, off); err != nil {
+		return nil, false
+	}
+	return buf, true
+}
+
+// size returns the end of the highest sector the FAT marks as used
+func (f *cfbFile) size() int64 {
+	for i := len(f.fat) - 1; i >= 0; i-- {
+		if f.fat[i] != cfbFreeSect {
+			return min((int64(i)+2)*f.sectorSize, f.limit)
+		}
+	}
+	return 0
+}
+
+// entries returns the entries of the directory stream
+func (f *cfbFile) entries() []cfbEntry {
+	var entries []cfbEntry
+	s := f.firstDir
+	for steps := 0; s < uint32(len(f.fat)) && steps < len(f.fat); steps++ {
+		sector, ok := f.readSector(s)
+		if !ok || int64(steps)*f.sectorSize > cfbMaxDirSize {
+			break
+		}
+		for off := 0; off+cfbDirEntrySize <= len(sector); off += cfbDirEntrySize {
+			entry := sector[off : off+cfbDirEntrySize]
+			nameLen := int(binary.LittleEndian.Uint16(entry[0x40:0x42]))
+			if entry[0x42] == 0 || nameLen < 2 || nameLen > 64 {
+				continue // Unused entry
+			}
+			u := make([]uint16, nameLen/2-1) // Length includes the terminator
+			for i := range u {
+				u[i] = binary.LittleEndian.Uint16(entry[2*i:])
+			}
+			entries = append(entries, cfbEntry{
+				name:  string(utf16.Decode(u)),
+				typ:   entry[0x42],
+				start: binary.LittleEndian.Uint32(entry[0x74:0x78]),
+				size:  int64(binary.LittleEndian.Uint32(entry[0x78:0x7C])),
+			})
+		}
+		s = f.fat[s]
+	}
+	return entries
+}
+
+// names returns the names of the entries in the directory stream
+func (f *cfbFile) names() []string {
+	var names []string
+	for _, e := range f.entries() {
+		names = append(names, e.name)
+	}
+	return names
+}
+
+// chain reads up to size bytes following a sector chain through fat, where
+// read fetches one sector by number
+func chain(start uint32, size int64, fat []uint32, sectorSize int64, read func(uint32) ([]byte, bool)) ([]byte, bool) {
+	if size > cfbMaxStreamSize {
+		return nil, false
+	}
+	data := make([]byte, 0, size)
+	s := start
+	for steps := 0; int64(len(data)) < size; steps++ {
+		if s >= uint32(len(fat)) || steps > len(fat) {
+			return nil, false
+		}
+		sector, ok := read(s)
+		if !ok {
+			return nil, false
+		}
+		data = append(data, sector[:min(sectorSize, size-int64(len(data)))]...)
+		s = fat[s]
+	}
+	return data, true
+}
+
+// readStream returns the contents of a stream, from the mini stream when it
+// is smaller than the cutoff
+func (f *cfbFile) readStream(e cfbEntry, root cfbEntry) ([]byte, bool) {
+	if e.size >= f.miniCutoff {
+		return chain(e.start, e.size, f.fat, f.sectorSize, f.readSector)
+	}
+
+	// Small streams live in 64-byte mini sectors inside the root entry's stream
+	miniStream, ok := chain(root.start, root.size, f.fat, f.sectorSize, f.readSector)
+	if !ok {
+		return nil, false
+	}
+	fatBytes, ok := chain(f.firstMini, f.numMini*f.sectorSize, f.fat, f.sectorSize, f.readSector)
+	if !ok {
+		return nil, false
+	}
+	miniFAT := make([]uint32, len(fatBytes)/4)
+	for i := range miniFAT {
+		miniFAT[i] = binary.LittleEndian.Uint32(fatBytes[4*i:])
+	}
+
+	readMini := func(s uint32) ([]byte, bool) {
+		off := int64(s) * cfbMiniSectorSize
+		if off+cfbMiniSectorSize > int64(len(miniStream)) {
+			return nil, false
+		}
+		return miniStream[off : off+cfbMiniSectorSize], true
+	}
+	return chain(e.start, e.size, miniFAT, cfbMiniSectorSize, readMini)
+}
+
+// verifyCFB checks the byte order mark and sector sizes of a CFB header
+func verifyCFB(data []byte) bool {
+	if len(data) < 0x4C {
+		return false
+	}
+	byteOrder := binary.LittleEndian.Uint16(data[0x1C:0x1E])
+	sectorShift := binary.LittleEndian.Uint16(data[0x1E:0x20])
+	miniShift := binary.LittleEndian.Uint16(data[0x20:0x22])
+	return byteOrder == 0xFFFE && (sectorShift == 9 || sectorShift == 12) && miniShift == 6
+}
+
+// cfbSize sizes a compound file from its FAT
+func cfbSize(r io.ReaderAt, limit int64) int64 {
+	f, ok := openCFB(r, limit)
+	if !ok {
+		return 0
+	}
+	return f.size()
+}
+
+// classifyCFB names the application a compound file belongs to by the
+// streams in its directory. Documents can embed each other (a workbook inside
+// a Word file, a document attached to a message), so the container's own
+// streams are checked in order of precedence.
+func classifyCFB(r io.ReaderAt, size int64) (string, string) {
+	f, ok := openCFB(r, size)
+	if !ok {
+		return "", ""
+	}
+	streams := make(map[string]bool)
+	msg := false
+	for _, name := range f.names() {
+		streams[name] = true
+		msg = msg || strings.HasPrefix(name, "__substg1.0_")
+	}
+
+	switch {
+	case streams["DestList"]:
+		return "JUMPLIST", ".automaticDestinations-ms"
+	case streams["Catalog"]:
+		return "THUMBSDB", ".db"
+	case msg || streams["__properties_version1.0"]:
+		return "MSG", ".msg"
+	case streams["WordDocument"]:
+		return "DOC", ".doc"
+	case streams["PowerPoint Document"]:
+		return "PPT", ".ppt"
+	case streams["Workbook"] || streams["Book"]:
+		return "XLS", ".xls"
+	}
+	return "", ""
+}
+
+// cfbMetadata lists the shortcut targets recorded in a jump list
+func cfbMetadata(r io.ReaderAt, size int64) map[string]string {
+	f, ok := openCFB(r, size)
+	if !ok {
+		return nil
+	}
+	isJumpList := false
+	for _, name := range f.names() {
+		isJumpList = isJumpList || name == "DestList"
+	}
+	if !isJumpList {
+		return nil
+	}
+	if targets := jumpListTargets(f); len(targets) > 0 {
+		return map[string]string{"targets": strings.Join(targets, "; ")}
+	}
+	return nil
+}
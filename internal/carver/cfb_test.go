@@ -0,0 +1,212 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// makeCFB builds a version 3 compound file with one FAT sector, a directory
+// sector holding the given stream names and three sectors of stream data
+func makeCFB(streams ...string) []byte {
+	le := binary.LittleEndian
+	file := make([]byte, 6*512)
+
+	hdr := file[:512]
+	copy(hdr, []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1})
+	le.PutUint16(hdr[0x18:], 0x003E) // Minor version
+	le.PutUint16(hdr[0x1A:], 3)      // Major version
+	le.PutUint16(hdr[0x1C:], 0xFFFE)
+	le.PutUint16(hdr[0x1E:], 9)
+	le.PutUint16(hdr[0x20:], 6)
+	le.PutUint32(hdr[0x2C:], 1)          // One FAT sector
+	le.PutUint32(hdr[0x30:], 1)          // Directory at sector 1
+	le.PutUint32(hdr[0x44:], 0xFFFFFFFE) // No DIFAT sectors
+	le.PutUint32(hdr[0x4C:], 0)          // FAT at sector 0
+	for i := 1; i < cfbHeaderFAT; i++ {
+		le.PutUint32(hdr[0x4C+4*i:], cfbFreeSect)
+	}
+
+	fat := file[512:1024]
+	chain := []uint32{0xFFFFFFFD, 0xFFFFFFFE, 3, 4, 0xFFFFFFFE}
+	for i := 0; i < 128; i++ {
+		v := uint32(cfbFreeSect)
+		if i < len(chain) {
+			v = chain[i]
+		}
+		le.PutUint32(fat[4*i:], v)
+	}
+
+	dir := file[1024:1536]
+	names := append([]string{"Root Entry"}, streams...)
+	for i, name := range names {
+		entry := dir[i*cfbDirEntrySize : (i+1)*cfbDirEntrySize]
+		u := utf16.Encode([]rune(name))
+		for j, c := range u {
+			le.PutUint16(entry[2*j:], c)
+		}
+		le.PutUint16(entry[0x40:], uint16(2*len(u)+2))
+		entry[0x42] = 2
+		if i == 0 {
+			entry[0x42] = 5
+		}
+	}
+
+	copy(file[1536:], bytes.Repeat([]byte{0x42}, 3*512))
+	return file
+}
+
+// makeMiniCFB builds a version 3 compound file whose streams, given as name
+// and content pairs, are all kept in the root entry's mini stream
+func makeMiniCFB(streams ...[2]string) []byte {
+	le := binary.LittleEndian
+	const sector = 512
+
+	var miniStream []byte
+	var miniFAT, starts []uint32
+	for _, s := range streams {
+		start := uint32(len(miniStream) / 64)
+		n := (len(s[1]) + 63) / 64
+		for i := 0; i < n; i++ {
+			next := start + uint32(i) + 1
+			if i == n-1 {
+				next = 0xFFFFFFFE
+			}
+			miniFAT = append(miniFAT, next)
+		}
+		starts = append(starts, start)
+		miniStream = append(miniStream, s[1]...)
+		miniStream = append(miniStream, make([]byte, n*64-len(s[1]))...)
+	}
+
+	// Sectors: the FAT, the directory, the mini FAT, then the mini stream
+	dirSectors := (len(streams) + 1 + 3) / 4
+	miniFATSectors := (len(miniFAT)*4 + sector - 1) / sector
+	streamSectors := (len(miniStream) + sector - 1) / sector
+	firstMiniFAT := 1 + dirSectors
+	firstStream := firstMiniFAT + miniFATSectors
+	total := firstStream + streamSectors
+	file := make([]byte, (1+total)*sector)
+	at := func(s int) []byte { return file[(s+1)*sector : (s+2)*sector] }
+
+	hdr := file[:sector]
+	copy(hdr, []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1})
+	le.PutUint16(hdr[0x1A:], 3)
+	le.PutUint16(hdr[0x1C:], 0xFFFE)
+	le.PutUint16(hdr[0x1E:], 9)
+	le.PutUint16(hdr[0x20:], 6)
+	le.PutUint32(hdr[0x2C:], 1) // FAT sectors
+	le.PutUint32(hdr[0x30:], 1) // Directory
+	le.PutUint32(hdr[0x38:], 4096)
+	le.PutUint32(hdr[0x3C:], uint32(firstMiniFAT))
+	le.PutUint32(hdr[0x40:], uint32(miniFATSectors))
+	le.PutUint32(hdr[0x44:], 0xFFFFFFFE)
+	for i := 1; i < cfbHeaderFAT; i++ {
+		le.PutUint32(hdr[0x4C+4*i:], cfbFreeSect)
+	}
+
+	fat := at(0)
+	for i := 0; i < sector/4; i++ {
+		le.PutUint32(fat[4*i:], cfbFreeSect)
+	}
+	le.PutUint32(fat, 0xFFFFFFFD)
+	for _, run := range [][2]int{{1, dirSectors}, {firstMiniFAT, miniFATSectors}, {firstStream, streamSectors}} {
+		for i := 0; i < run[1]; i++ {
+			next := uint32(run[0] + i + 1)
+			if i == run[1]-1 {
+				next = 0xFFFFFFFE
+			}
+			le.PutUint32(fat[4*(run[0]+i):], next)
+		}
+	}
+
+	entry := func(i int, name string, typ byte, start uint32, size int) {
+		e := file[2*sector+i*cfbDirEntrySize:]
+		u := utf16.Encode([]rune(name))
+		for j, c := range u {
+			le.PutUint16(e[2*j:], c)
+		}
+		le.PutUint16(e[0x40:], uint16(2*len(u)+2))
+		e[0x42] = typ
+		le.PutUint32(e[0x74:], start)
+		le.PutUint32(e[0x78:], uint32(size))
+	}
+	entry(0, "Root Entry", 5, uint32(firstStream), len(miniStream))
+	for i, s := range streams {
+		entry(i+1, s[0], 2, starts[i], len(s[1]))
+	}
+
+	for i := 0; i < miniFATSectors*sector/4; i++ {
+		v := uint32(cfbFreeSect)
+		if i < len(miniFAT) {
+			v = miniFAT[i]
+		}
+		le.PutUint32(file[(firstMiniFAT+1)*sector+4*i:], v)
+	}
+	copy(file[(firstStream+1)*sector:], miniStream)
+	return file
+}
+
+func TestClassifyCFB(t *testing.T) {
+	tests := []struct {
+		streams  []string
+		wantName string
+		wantExt  string
+	}{
+		{[]string{"WordDocument", "1Table"}, "DOC", ".doc"},
+		{[]string{"Workbook"}, "XLS", ".xls"},
+		{[]string{"PowerPoint Document", "Current User"}, "PPT", ".ppt"},
+		{[]string{"__substg1.0_0037001F", "__properties_version1.0"}, "MSG", ".msg"},
+		{[]string{"__substg1.0_0037001F", "WordDocument"}, "MSG", ".msg"}, // Attached document
+		{[]string{"Contents"}, "", ""},
+	}
+
+	for _, tt := range tests {
+		file := makeCFB(tt.streams...)
+		if name, ext := classifyCFB(bytes.NewReader(file), int64(len(file))); name != tt.wantName || ext != tt.wantExt {
+			t.Errorf("classifyCFB(%v) = %q, %q, want %q, %q", tt.streams, name, ext, tt.wantName, tt.wantExt)
+		}
+	}
+}
+
+func TestCarveCFB(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	doc := makeCFB("WordDocument")
+	data := bytes.Repeat([]byte{0x33}, 64*1024)
+	copy(data[8192:], doc)
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	carver := NewCarver(reader)
+	sig := findSignature(t, "OLE")
+	path, err := carver.RecoverFile(CarvedFile{Signature: &sig, Offset: 8192}, outputDir, 7)
+	if err != nil {
+		t.Fatalf("RecoverFile failed: %v", err)
+	}
+	if want := filepath.Join(outputDir, "DOC", "carved_000007.doc"); path != want {
+		t.Errorf("Expected %s, got %s", want, path)
+	}
+
+	recovered, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read recovered file: %v", err)
+	}
+	if !bytes.Equal(recovered, doc) {
+		t.Errorf("Expected %d bytes sized from the FAT, got %d", len(doc), len(recovered))
+	}
+}
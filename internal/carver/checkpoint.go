@@ -0,0 +1,116 @@
+package carver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultCheckpointInterval is how much of the disk is scanned between checkpoint saves
+const DefaultCheckpointInterval = 10 * 1024 * 1024 * 1024 // 10GB
+
+// CheckpointFileName is the default checkpoint file name inside the output directory
+const CheckpointFileName = "carve-checkpoint.json"
+
+// Checkpoint records the state of an interrupted carving run: how far the
+// scan got, the candidates found so far and how many of them the recovery
+// phase has already written.
+type Checkpoint struct {
+	Source     string           `json:"source"`
+	SourceSize int64            `json:"source_size"`
+	Offset     int64            `json:"offset"` // Next scan offset
+	ScanDone   bool             `json:"scan_done"`
+	Processed  int              `json:"processed"` // Files handled by the recovery phase
+	Files      []checkpointFile `json:"files"`
+}
+
+type checkpointFile struct {
+	Signature string `json:"signature"`
+	Offset    int64  `json:"offset"`
+	Path      string `json:"path,omitempty"`   // Where the recovery phase wrote it
+	SHA256    string `json:"sha256,omitempty"` // Content hash, kept for duplicate detection
+}
+
+// LoadCheckpoint reads a checkpoint written by an earlier run
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	return &cp, nil
+}
+
+// Save writes the checkpoint atomically, so an interruption mid-write leaves
+// the previous checkpoint intact
+func (cp *Checkpoint) Save(path string) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// saveCheckpoint records the candidates found so far in the run's checkpoint,
+// with where those it has processed were written, and writes it out. The
+// files past them may be being written.
+func (c *Carver) saveCheckpoint(files []CarvedFile) error {
+	cp := c.checkpoint
+	cp.Files = cp.Files[:0]
+	for i, f := range files {
+		entry := checkpointFile{Signature: f.Signature.Name, Offset: f.Offset}
+		if i < cp.Processed {
+			entry.Path, entry.SHA256 = f.Path, f.SHA256
+		}
+		cp.Files = append(cp.Files, entry)
+	}
+	if err := cp.Save(c.checkpointPath); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// SetCheckpoint makes Scan save its position to path every interval bytes
+func (c *Carver) SetCheckpoint(path string, interval int64) {
+	c.checkpointPath = path
+	c.checkpointEvery = interval
+}
+
+// Resume continues from a checkpoint: the next Scan starts where the
+// interrupted one stopped and keeps the candidates it had already found. The
+// checkpoint's signatures must be present in the carver's signature set.
+func (c *Carver) Resume(cp *Checkpoint) ([]CarvedFile, error) {
+	if cp.SourceSize != c.reader.Size() {
+		return nil, fmt.Errorf("checkpoint is for a %d byte source, this one is %d bytes", cp.SourceSize, c.reader.Size())
+	}
+
+	byName := make(map[string]*FileSignature)
+	for i := range c.signatures {
+		byName[c.signatures[i].Name] = &c.signatures[i]
+	}
+
+	files := make([]CarvedFile, 0, len(cp.Files))
+	for _, f := range cp.Files {
+		sig, ok := byName[f.Signature]
+		if !ok {
+			return nil, fmt.Errorf("checkpoint uses signature %q which is not loaded", f.Signature)
+		}
+		files = append(files, CarvedFile{Signature: sig, Offset: f.Offset, Size: sig.MaxSize, Path: f.Path, SHA256: f.SHA256})
+	}
+
+	c.resumeOffset = cp.Offset
+	c.resumeFiles = files
+	c.resumeProcessed = cp.Processed
+	return files, nil
+}
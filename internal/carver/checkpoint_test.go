@@ -0,0 +1,141 @@
+package carver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// writeCheckpointImage creates a 256KB image with "HDR1" headers at the given
+// offsets and returns an open reader for it
+func writeCheckpointImage(t *testing.T, offsets []int) *disk.Reader {
+	tmpFile := filepath.Join(t.TempDir(), "test.img")
+	data := make([]byte, 256*1024)
+	for _, off := range offsets {
+		copy(data[off:], "HDR1")
+	}
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	t.Cleanup(func() { reader.Close() })
+	return reader
+}
+
+func TestCheckpointResume(t *testing.T) {
+	// 15360 and 30720 fall inside the 1KB overlap between 16KB scan buffers
+	offsets := []int{100, 15400, 30720, 70000, 140000, 200000}
+	reader := writeCheckpointImage(t, offsets)
+	cpPath := filepath.Join(t.TempDir(), CheckpointFileName)
+	sigs := []FileSignature{{Name: "T", Extension: ".t", Header: []byte("HDR1"), MaxSize: 100}}
+
+	full := NewCarver(reader)
+	full.bufSize = 16 * 1024
+	full.SetSignatures(sigs)
+	full.SetCheckpoint(cpPath, 32*1024)
+
+	files, err := full.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(files) != len(offsets) {
+		t.Fatalf("Expected %d files (no overlap duplicates), got %d", len(offsets), len(files))
+	}
+
+	cp, err := LoadCheckpoint(cpPath)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint failed: %v", err)
+	}
+	if !cp.ScanDone || cp.Offset != reader.Size() || len(cp.Files) != len(offsets) {
+		t.Errorf("Unexpected final checkpoint: %+v", cp)
+	}
+
+	// Resume an interrupted scan from the middle of the disk
+	interrupted := &Checkpoint{SourceSize: reader.Size(), Offset: 61440}
+	for _, f := range files[:3] {
+		interrupted.Files = append(interrupted.Files, checkpointFile{Signature: "T", Offset: f.Offset})
+	}
+
+	resumed := NewCarver(reader)
+	resumed.bufSize = 16 * 1024
+	resumed.SetSignatures(sigs)
+	if _, err := resumed.Resume(interrupted); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	got, err := resumed.Scan()
+	if err != nil {
+		t.Fatalf("Resumed scan failed: %v", err)
+	}
+	if len(got) != len(files) {
+		t.Fatalf("Expected %d files after resume, got %d", len(files), len(got))
+	}
+	for i := range got {
+		if got[i].Offset != files[i].Offset {
+			t.Errorf("File %d: expected offset %d, got %d", i, files[i].Offset, got[i].Offset)
+		}
+	}
+}
+
+func TestResumeMismatch(t *testing.T) {
+	reader := writeCheckpointImage(t, nil)
+	carver := NewCarver(reader)
+
+	if _, err := carver.Resume(&Checkpoint{SourceSize: reader.Size() + 1}); err == nil {
+		t.Error("Expected error for a checkpoint of a different size source")
+	}
+
+	cp := &Checkpoint{SourceSize: reader.Size(), Files: []checkpointFile{{Signature: "NOPE"}}}
+	if _, err := carver.Resume(cp); err == nil {
+		t.Error("Expected error for a checkpoint with an unknown signature")
+	}
+}
+
+func TestRecoverResume(t *testing.T) {
+	reader := writeCheckpointImage(t, []int{1000, 5000})
+	outputDir := t.TempDir()
+	cpPath := filepath.Join(outputDir, CheckpointFileName)
+	sigs := []FileSignature{{Name: "T", Extension: ".t", Header: []byte("HDR1"), MaxSize: 100}}
+
+	// The scan finished and the first file was written before the interruption
+	cp := &Checkpoint{
+		SourceSize: reader.Size(),
+		Offset:     reader.Size(),
+		ScanDone:   true,
+		Processed:  1,
+		Files: []checkpointFile{
+			{Signature: "T", Offset: 1000, Path: filepath.Join(outputDir, "T", "carved_000000.t"), SHA256: "abc"},
+			{Signature: "T", Offset: 5000},
+		},
+	}
+	if err := cp.Save(cpPath); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	count, err := Recover(reader, outputDir, false, Options{
+		Signatures: sigs,
+		Checkpoint: cpPath,
+		Resume:     true,
+	})
+	if err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 file recovered after resume, got %d", count)
+	}
+
+	if _, err := os.Stat(filepath.Join(outputDir, "T", "carved_000000.t")); !os.IsNotExist(err) {
+		t.Error("File processed before the interruption should not be written again")
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "T", "carved_000001.t")); err != nil {
+		t.Errorf("Expected remaining file to be recovered: %v", err)
+	}
+	if _, err := os.Stat(cpPath); !os.IsNotExist(err) {
+		t.Error("Expected checkpoint to be removed after a completed run")
+	}
+}
@@ -0,0 +1,110 @@
+package carver
+
+import (
+	"io"
+	"sort"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// Short headers match by chance: three bytes of a JPEG header turn up every
+// few megabytes of random data. A score from 0 to 100 ranks the hits of a
+// scan by how likely each is to be a real file, from how much of the
+// header was checked, where the hit lies, what follows the header and, when
+// it has run, validation:
+//
+//	header    4 points per exactly matched byte (up to 32), 16 for a Verify check
+//	alignment 16 at the start of a 4KB cluster, 10 at a sector
+//	content   12 when the block after the header varies, -10 when it hardly
+//	          does and -25 when it is one repeated byte
+//	validity  24 when valid, -40 when invalid
+
+// Confidence points
+const (
+	confidenceHeaderByte = 4
+	confidenceHeaderMax  = 32
+	confidenceVerify     = 16
+	confidenceCluster    = 16
+	confidenceSector     = 10
+	confidenceContent    = 12
+	confidenceLowEntropy = -10
+	confidenceConstant   = -25
+	confidenceValid      = 24
+	confidenceInvalid    = -40
+)
+
+// Score rates how likely a hit is to be a real file, from 0 to 100, and
+// sets its Confidence
+func (c *Carver) Score(f *CarvedFile) int {
+	sig := f.Signature
+	var score int64
+
+	exact := 0
+	for i := range sig.Header {
+		if sig.Wildcard == nil || !sig.Wildcard[i] {
+			exact++
+		}
+	}
+	score += min(int64(exact*confidenceHeaderByte), confidenceHeaderMax)
+	if sig.Verify != nil {
+		score += confidenceVerify
+	}
+
+	switch {
+	case f.Offset%4096 == 0:
+		score += confidenceCluster
+	case f.Offset%512 == 0:
+		score += confidenceSector
+	}
+
+	if content, size, err := c.content(*f); err == nil {
+		start := int64(sig.Offset + len(sig.Header))
+		block := make([]byte, min(EntropyBlockSize, size-start))
+		if len(block) > 0 {
+			n, err := content.ReadAt(block, start)
+			if err == nil || err == io.EOF {
+				block = block[:n]
+				switch {
+				case len(block) == 0:
+				case isConstant(block):
+					score += confidenceConstant
+				case Entropy(block) < 1:
+					score += confidenceLowEntropy
+				default:
+					score += confidenceContent
+				}
+			}
+		}
+	}
+
+	switch f.Verdict {
+	case Valid:
+		score += confidenceValid
+	case Invalid:
+		score += confidenceInvalid
+	}
+
+	f.Confidence = int(max(0, min(score, 100)))
+	return f.Confidence
+}
+
+// printByConfidence lists the hits of a scan, most likely first, leaving
+// out those scored below minConfidence. It returns the number listed.
+func printByConfidence(reader *disk.Reader, files []CarvedFile, minConfidence int) int {
+	ranked := make([]*CarvedFile, 0, len(files))
+	for i := range files {
+		if files[i].Confidence >= minConfidence {
+			ranked = append(ranked, &files[i])
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Confidence > ranked[j].Confidence })
+
+	reader.Println("\nBy confidence:")
+	for _, f := range ranked {
+		reader.Printf("  %3d  %s at offset %d\n", f.Confidence, f.typeName(), f.Offset)
+	}
+	if hidden := len(files) - len(ranked); hidden > 0 {
+		reader.Printf("  (%d hits below confidence %d not listed)\n", hidden, minConfidence)
+	}
+	return len(ranked)
+}
@@ -0,0 +1,76 @@
+package carver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func TestScore(t *testing.T) {
+	// A real JPEG on a cluster boundary, and a stray JPEG header followed by
+	// zeros at an odd offset
+	photo := makeJPEG(t)
+	data := make([]byte, 64*1024)
+	copy(data, photo)
+	copy(data[40001:], []byte{0xFF, 0xD8, 0xFF})
+	copy(data[50000:], []byte{0x01, 0x02})
+	c := writeTextImage(t, data)
+
+	jpeg := findSignature(t, "JPEG")
+	hit := CarvedFile{Signature: &jpeg, Offset: 0, Size: jpeg.MaxSize}
+	stray := CarvedFile{Signature: &jpeg, Offset: 40001, Size: jpeg.MaxSize}
+
+	// Header 3*4, cluster 16, varied content 12
+	if got := c.Score(&hit); got != 40 {
+		t.Errorf("Expected the real JPEG to score 40, got %d", got)
+	}
+	if err := c.Validate(&hit); err != nil || hit.Verdict != Valid {
+		t.Fatalf("Expected the real JPEG to validate: %v", err)
+	}
+	if got := c.Score(&hit); got != 64 || hit.Confidence != 64 {
+		t.Errorf("Expected the validated JPEG to score 64, got %d", got)
+	}
+	// Header 12, constant content -25, clamped
+	if got := c.Score(&stray); got != 0 {
+		t.Errorf("Expected the stray header to score 0, got %d", got)
+	}
+	// Header 12, a block of zeros but for two bytes -10
+	stray.Offset = 50000 - 3 - 10
+	copy(data[stray.Offset:], []byte{0xFF, 0xD8, 0xFF})
+	c = writeTextImage(t, data)
+	if got := c.Score(&stray); got != 2 {
+		t.Errorf("Expected the header before little content to score 2, got %d", got)
+	}
+}
+
+func TestMinConfidence(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	photo := makeJPEG(t)
+	data := make([]byte, 64*1024)
+	copy(data, photo)
+	copy(data[40001:], []byte{0xFF, 0xD8, 0xFF})
+	copy(data[50000:], []byte{0xFF, 0xD9})
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	opts := Options{Signatures: []FileSignature{findSignature(t, "JPEG")}, MinConfidence: 20}
+	if n, err := Recover(reader, filepath.Join(tmpDir, "scan"), true, opts); err != nil || n != 1 {
+		t.Errorf("Expected 1 hit listed, got %d (%v)", n, err)
+	}
+	outputDir := filepath.Join(tmpDir, "out")
+	if n, err := Recover(reader, outputDir, false, opts); err != nil || n != 1 {
+		t.Errorf("Expected 1 file recovered, got %d (%v)", n, err)
+	}
+	if jpegs, _ := filepath.Glob(filepath.Join(outputDir, "JPEG", "*")); len(jpegs) != 1 {
+		t.Errorf("Expected only the real JPEG written, got %v", jpegs)
+	}
+}
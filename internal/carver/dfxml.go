@@ -0,0 +1,271 @@
+package carver
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/internal/fat32"
+	"github.com/shubham/recovery/internal/ntfs"
+)
+
+// Digital Forensics XML is what fiwalk writes and bulk_extractor, the
+// DFXML Python tools and most forensic pipelines read: a fileobject per
+// file with its name, size, times, whether it is allocated, where its bytes
+// lie on the image and their hashes. Every file and directory of the disk's
+// FAT32 and NTFS volumes is listed under its volume, live or deleted, and
+// every carved file after the volumes:
+//
+//	<volume offset="1048576">
+//	  <ftype_str>ntfs</ftype_str>
+//	  <fileobject>
+//	    <filename>Users/anna/report.docx</filename>
+//	    <filesize>20480</filesize>
+//	    <unalloc>1</unalloc>
+//	    <byte_runs><byte_run file_offset="0" img_offset="88604672" len="20480"></byte_run></byte_runs>
+//	    <hashdigest type="md5">...</hashdigest>
+
+// DFXMLFile is the DFXML report written below the output directory
+const DFXMLFile = "files.dfxml"
+
+const dfxmlNamespace = "http://www.forensicswiki.org/wiki/Category:Digital_Forensics_XML"
+
+type dfxmlVolume struct {
+	XMLName xml.Name    `xml:"volume"`
+	Offset  int64       `xml:"offset,attr"`
+	Ftype   string      `xml:"ftype_str"`
+	Files   []dfxmlFile `xml:"fileobject"`
+}
+
+type dfxmlFile struct {
+	XMLName  xml.Name       `xml:"fileobject"`
+	Filename string         `xml:"filename"`
+	Filesize int64          `xml:"filesize"`
+	Alloc    int            `xml:"alloc,omitempty"`
+	Unalloc  int            `xml:"unalloc,omitempty"`
+	NameType string         `xml:"name_type,omitempty"` // r or d
+	Inode    uint64         `xml:"inode,omitempty"`
+	Mtime    string         `xml:"mtime,omitempty"`
+	Ctime    string         `xml:"ctime,omitempty"`
+	Atime    string         `xml:"atime,omitempty"`
+	Crtime   string         `xml:"crtime,omitempty"`
+	ByteRuns *dfxmlByteRuns `xml:"byte_runs,omitempty"`
+	Hashes   []dfxmlHash    `xml:"hashdigest"`
+}
+
+type dfxmlByteRuns struct {
+	Runs []dfxmlByteRun `xml:"byte_run"`
+}
+
+type dfxmlByteRun struct {
+	FileOffset int64 `xml:"file_offset,attr"`
+	ImgOffset  int64 `xml:"img_offset,attr"`
+	Len        int64 `xml:"len,attr"`
+}
+
+type dfxmlHash struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// WriteDFXML writes DFXMLFile below outputDir, describing the files of the
+// disk's FAT32 and NTFS volumes, hashed from the disk, and the carved files
+// given, hashed from their copies. It returns the number of files described.
+func WriteDFXML(reader *disk.Reader, outputDir string, carved []CarvedFile) (int, error) {
+	defer reader.Purpose("dfxml")()
+	path := filepath.Join(outputDir, DFXMLFile)
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<dfxml xmloutputversion=\"1.0\" xmlns=%q xmlns:dc=\"http://purl.org/dc/elements/1.1/\">\n", dfxmlNamespace)
+	fmt.Fprintf(w, "  <metadata>\n    <dc:type>File listing</dc:type>\n  </metadata>\n")
+	fmt.Fprintf(w, "  <creator>\n    <program>recover</program>\n    <execution_environment>\n      <start_time>%s</start_time>\n    </execution_environment>\n  </creator>\n",
+		time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "  <source>\n    <image_filename>")
+	xml.EscapeText(w, []byte(reader.Path()))
+	fmt.Fprintf(w, "</image_filename>\n    <image_size>%d</image_size>\n  </source>\n", reader.Size())
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("  ", "  ")
+	count := 0
+	for _, v := range diskVolumes(reader) {
+		fs, err := disk.DetectFilesystem(v.reader)
+		if err != nil {
+			continue
+		}
+		var entries []disk.FileEntry
+		switch fs {
+		case "ntfs":
+			p, err := ntfs.NewParser(v.reader)
+			if err != nil {
+				continue
+			}
+			entries, err = p.Files()
+		case "fat32":
+			p, err := fat32.NewParser(v.reader)
+			if err != nil {
+				continue
+			}
+			entries, err = p.Files()
+		default:
+			continue
+		}
+		if err != nil {
+			reader.Errorf("  Failed to list the files of %s: %v\n", fs, err)
+			continue
+		}
+
+		vol := dfxmlVolume{Offset: v.Offset, Ftype: fs}
+		for _, e := range entries {
+			vol.Files = append(vol.Files, volumeFileObject(v, e))
+		}
+		if err := enc.Encode(vol); err != nil {
+			return count, err
+		}
+		count += len(entries)
+	}
+
+	for _, c := range carved {
+		if c.Path == "" {
+			continue
+		}
+		obj, err := carvedFileObject(reader, outputDir, c)
+		if err != nil {
+			return count, err
+		}
+		if err := enc.Encode(obj); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	fmt.Fprintf(w, "\n</dfxml>\n")
+	if err := w.Flush(); err != nil {
+		return count, err
+	}
+	reader.Printf("\nDescribed %d files in %s\n", count, path)
+	return count, f.Close()
+}
+
+// volumeFileObject describes a file of a volume, hashing its data from the
+// disk
+func volumeFileObject(v volume, e disk.FileEntry) dfxmlFile {
+	obj := dfxmlFile{
+		Filename: filepath.ToSlash(e.Path),
+		Filesize: e.Size,
+		NameType: "r",
+		Inode:    e.Inode,
+		Mtime:    dfxmlTime(e.Modified),
+		Ctime:    dfxmlTime(e.Changed),
+		Atime:    dfxmlTime(e.Accessed),
+		Crtime:   dfxmlTime(e.Created),
+	}
+	if e.Deleted {
+		obj.Unalloc = 1
+	} else {
+		obj.Alloc = 1
+	}
+	if e.Dir {
+		obj.NameType = "d"
+		return obj
+	}
+	if e.Resident == nil && len(e.Extents) == 0 && e.Size > 0 {
+		return obj // Its data is gone; no hash rather than that of nothing
+	}
+
+	sums := newDigests()
+	if e.Resident != nil {
+		sums.Write(e.Resident)
+	}
+	var pos int64
+	for _, ext := range e.Extents {
+		if obj.ByteRuns == nil {
+			obj.ByteRuns = &dfxmlByteRuns{}
+		}
+		obj.ByteRuns.Runs = append(obj.ByteRuns.Runs, dfxmlByteRun{FileOffset: pos, ImgOffset: v.Offset + ext.Offset, Len: ext.Length})
+		io.Copy(sums, io.NewSectionReader(v.reader, ext.Offset, ext.Length))
+		pos += ext.Length
+	}
+	obj.Hashes = sums.hashes()
+	return obj
+}
+
+// carvedFileObject describes a carved file, hashing its copy when it is
+// still there
+func carvedFileObject(reader *disk.Reader, outputDir string, c CarvedFile) (dfxmlFile, error) {
+	rel, err := filepath.Rel(outputDir, c.Path)
+	if err != nil {
+		rel = c.Path
+	}
+	obj := dfxmlFile{Filename: filepath.ToSlash(rel), Filesize: c.Size, ByteRuns: &dfxmlByteRuns{}}
+	fragments := c.Fragments
+	if fragments == nil {
+		fragments = []Fragment{{Offset: c.Offset, Length: c.Size}}
+	}
+	var pos int64
+	for _, fr := range fragments {
+		obj.ByteRuns.Runs = append(obj.ByteRuns.Runs, dfxmlByteRun{FileOffset: pos, ImgOffset: fr.Offset, Len: fr.Length})
+		pos += fr.Length
+	}
+
+	// A copy handed on has only the digests taken as it was written
+	if reader.Sent(c.Path) {
+		if _, err := os.Stat(c.Path); os.IsNotExist(err) {
+			obj.Hashes = []dfxmlHash{{"md5", c.MD5}, {"sha256", c.SHA256}}
+			return obj, nil
+		}
+	}
+	in, err := reader.OpenOutput(c.Path)
+	if err != nil {
+		return obj, err
+	}
+	defer in.Close()
+	sums := newDigests()
+	if _, err := io.Copy(sums, in); err != nil {
+		return obj, err
+	}
+	obj.Hashes = sums.hashes()
+	return obj, nil
+}
+
+// digests computes the MD5, SHA-1 and SHA-256 digests DFXML reports at once
+type digests struct {
+	io.Writer
+	md5, sha1, sha256 hash.Hash
+}
+
+func newDigests() *digests {
+	d := &digests{md5: md5.New(), sha1: sha1.New(), sha256: sha256.New()}
+	d.Writer = io.MultiWriter(d.md5, d.sha1, d.sha256)
+	return d
+}
+
+func (d *digests) hashes() []dfxmlHash {
+	return []dfxmlHash{
+		{"md5", hex.EncodeToString(d.md5.Sum(nil))},
+		{"sha1", hex.EncodeToString(d.sha1.Sum(nil))},
+		{"sha256", hex.EncodeToString(d.sha256.Sum(nil))},
+	}
+}
+
+// dfxmlTime formats Unix seconds as DFXML's ISO 8601 times, "" when unknown
+func dfxmlTime(unix int64) string {
+	if unix == 0 {
+		return ""
+	}
+	return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+}
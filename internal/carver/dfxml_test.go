@@ -0,0 +1,107 @@
+package carver
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func TestWriteDFXML(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	// REPORT.TXT, 11 bytes in cluster 3, and a deleted OLD.TXT
+	volume := makeFAT32(8, 2, 3)
+	dataStart := 34 * 512
+	root := volume[dataStart:]
+	copy(root, "REPORT  TXT")
+	binary.LittleEndian.PutUint16(root[24:], (2021-1980)<<9|7<<5|1)
+	binary.LittleEndian.PutUint16(root[26:], 3)
+	binary.LittleEndian.PutUint32(root[28:], 11)
+	copy(root[32:], "\xE5LD     TXT")
+	copy(volume[dataStart+4096:], "hello world")
+
+	if err := os.WriteFile(tmpFile, volume, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	// A carved copy of the same bytes
+	outputDir := filepath.Join(tmpDir, "out")
+	carvedPath := filepath.Join(outputDir, "TXT", "carved_000001.txt")
+	os.MkdirAll(filepath.Dir(carvedPath), 0755)
+	os.WriteFile(carvedPath, []byte("hello world"), 0644)
+	carved := []CarvedFile{
+		{Path: carvedPath, Offset: int64(dataStart + 4096), Size: 11},
+		{Offset: 99, Size: 1}, // Dropped, never written
+	}
+
+	n, err := WriteDFXML(reader, outputDir, carved)
+	if err != nil || n != 3 {
+		t.Fatalf("Expected 3 files described, got %d (%v)", n, err)
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, DFXMLFile))
+	if err != nil {
+		t.Fatalf("Failed to read DFXML: %v", err)
+	}
+	var doc struct {
+		Image   string        `xml:"source>image_filename"`
+		Volumes []dfxmlVolume `xml:"volume"`
+		Files   []dfxmlFile   `xml:"fileobject"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Failed to parse DFXML: %v\n%s", err, data)
+	}
+	if doc.Image != tmpFile || len(doc.Volumes) != 1 || len(doc.Volumes[0].Files) != 2 || len(doc.Files) != 1 {
+		t.Fatalf("Expected a volume of 2 files and one carved file from %s, got:\n%s", tmpFile, data)
+	}
+
+	sum := md5.Sum([]byte("hello world"))
+	md5sum := hex.EncodeToString(sum[:])
+	report, old, carvedObj := doc.Volumes[0].Files[0], doc.Volumes[0].Files[1], doc.Files[0]
+	if report.Filename != "REPORT.TXT" || report.Alloc != 1 || report.Mtime != "2021-07-01T00:00:00Z" || report.Hashes[0].Value != md5sum {
+		t.Errorf("Unexpected live file %+v", report)
+	}
+	if run := report.ByteRuns.Runs; len(run) != 1 || run[0].ImgOffset != int64(dataStart+4096) || run[0].Len != 11 {
+		t.Errorf("Unexpected byte runs %+v", run)
+	}
+	if old.Filename != "?LD.TXT" || old.Unalloc != 1 || old.Alloc != 0 {
+		t.Errorf("Unexpected deleted file %+v", old)
+	}
+	if carvedObj.Filename != "TXT/carved_000001.txt" || carvedObj.Hashes[0].Value != md5sum || carvedObj.ByteRuns.Runs[0].ImgOffset != int64(dataStart+4096) {
+		t.Errorf("Unexpected carved file %+v", carvedObj)
+	}
+
+	// A copy sent on, and gone, has the digests taken as it was written
+	reader.SetSender(removeSender{})
+	reader.Finished(carvedPath)
+	carved[0].MD5, carved[0].SHA256 = md5sum, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	if _, err := WriteDFXML(reader, outputDir, carved); err != nil {
+		t.Fatalf("Failed to describe a file sent on: %v", err)
+	}
+	data, _ = os.ReadFile(filepath.Join(outputDir, DFXMLFile))
+	doc.Files = nil
+	if err := xml.Unmarshal(data, &doc); err != nil || len(doc.Files) != 1 {
+		t.Fatalf("Expected one carved file, got %v:\n%s", err, data)
+	}
+	if h := doc.Files[0].Hashes; len(h) != 2 || h[0] != (dfxmlHash{"md5", md5sum}) || h[1] != (dfxmlHash{"sha256", carved[0].SHA256}) {
+		t.Errorf("Unexpected digests of a file sent on %+v", h)
+	}
+}
+
+// removeSender stands for a sender that removes each file once sent
+type removeSender struct{}
+
+func (removeSender) Send(path string) error {
+	return os.RemoveAll(path)
+}
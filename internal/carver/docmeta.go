@@ -0,0 +1,290 @@
+package carver
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Documents say who wrote them, what they are called and when they were
+// written: PDFs in the Info dictionary the trailer points to, Office Open
+// XML files in docProps/core.xml and OpenDocument files in meta.xml. These
+// are reported with each carved document, so the relevant ones among
+// thousands of carved_NNNNNN.pdf files can be picked without opening them:
+//
+//	title: Quarterly report
+//	author: Anna Smith
+//	created: 2021-06-14 10:22:01
+
+const (
+	pdfInfoWindow  = 64 * 1024 // Bytes at each end of a PDF searched for the trailer
+	docMetaMaxRead = 1 << 20   // Largest metadata part read from a ZIP
+)
+
+var (
+	pdfInfoRe    = regexp.MustCompile(`/Info\s+(\d+)\s+(\d+)\s+R`)
+	pdfEncryptRe = regexp.MustCompile(`/Encrypt\s`)
+
+	// pdfInfoKeys maps the Info entries reported to their metadata keys
+	pdfInfoKeys = [][2]string{
+		{"Title", "title"},
+		{"Author", "author"},
+		{"CreationDate", "created"},
+		{"ModDate", "modified"},
+	}
+)
+
+// pdfMetadata reports the title, author and dates in a PDF's Info
+// dictionary. Encrypted documents are left alone, as their strings are too.
+func pdfMetadata(r io.ReaderAt, size int64) map[string]string {
+	// The trailer is at the end, or for a linearized file also at the start
+	var ref [][]byte
+	for _, off := range []int64{max(size-pdfInfoWindow, 0), 0} {
+		window := make([]byte, min(pdfInfoWindow, size-off))
+		if n, _ := r.ReadAt(window, off); n > 0 {
+			window = window[:n]
+			if pdfEncryptRe.Match(window) {
+				return nil
+			}
+			if all := pdfInfoRe.FindAllSubmatch(window, -1); len(all) > 0 {
+				ref = all[len(all)-1]
+				break
+			}
+		}
+	}
+	if ref == nil {
+		return nil
+	}
+	num, _ := strconv.Atoi(string(ref[1]))
+
+	objects, _ := pdfObjects(r, size)
+	obj, ok := objects[num]
+	if !ok {
+		return nil
+	}
+	var dict []byte
+	if obj.stream != 0 {
+		raw := make([]byte, min(pdfMaxObjStm, size-obj.offset))
+		n, _ := r.ReadAt(raw, obj.offset)
+		for _, m := range pdfObjStm(raw[:n], obj.stream, obj.offset) {
+			if m.num == num {
+				dict = m.body
+			}
+		}
+	} else {
+		raw := make([]byte, min(2*pdfPeekSize, size-obj.offset))
+		n, _ := r.ReadAt(raw, obj.offset)
+		dict = raw[:n]
+		if i := bytes.Index(dict, []byte("obj")); i >= 0 {
+			dict = dict[i+3:]
+		}
+		if i := bytes.Index(dict, []byte("endobj")); i >= 0 {
+			dict = dict[:i]
+		}
+	}
+
+	meta := make(map[string]string)
+	for _, k := range pdfInfoKeys {
+		i := bytes.Index(dict, []byte("/"+k[0]))
+		if i < 0 {
+			continue
+		}
+		value := strings.TrimSpace(pdfString(bytes.TrimLeft(dict[i+1+len(k[0]):], " \t\r\n")))
+		if k[1] == "created" || k[1] == "modified" {
+			value = pdfDate(value)
+		}
+		if value != "" {
+			meta[k[1]] = value
+		}
+	}
+	if len(meta) == 0 {
+		return nil
+	}
+	return meta
+}
+
+// pdfString decodes the literal (...) or hex <...> string at the start of
+// data, as UTF-16BE when it starts with a byte order mark and as Latin-1
+// otherwise
+func pdfString(data []byte) string {
+	var raw []byte
+	switch {
+	case len(data) > 0 && data[0] == '(':
+		depth := 0
+	literal:
+		for i := 0; i < len(data); i++ {
+			c := data[i]
+			switch c {
+			case '(':
+				if depth++; depth == 1 {
+					continue
+				}
+			case ')':
+				if depth--; depth == 0 {
+					break literal
+				}
+			case '\\':
+				if i++; i >= len(data) {
+					break literal
+				}
+				switch c = data[i]; c {
+				case 'n':
+					c = '\n'
+				case 'r':
+					c = '\r'
+				case 't':
+					c = '\t'
+				case 'b':
+					c = '\b'
+				case 'f':
+					c = '\f'
+				case '\r', '\n':
+					continue // Line continuation
+				case '0', '1', '2', '3', '4', '5', '6', '7':
+					v := 0
+					for j := 0; j < 3 && i < len(data) && data[i] >= '0' && data[i] <= '7'; j++ {
+						v = v*8 + int(data[i]-'0')
+						i++
+					}
+					i--
+					c = byte(v)
+				}
+			}
+			raw = append(raw, c)
+		}
+	case len(data) > 1 && data[0] == '<' && data[1] != '<':
+		end := bytes.IndexByte(data, '>')
+		if end < 0 {
+			return ""
+		}
+		digits := strings.Map(func(r rune) rune {
+			if strings.ContainsRune("0123456789abcdefABCDEF", r) {
+				return r
+			}
+			return -1
+		}, string(data[1:end]))
+		if len(digits)%2 == 1 {
+			digits += "0"
+		}
+		for i := 0; i+1 < len(digits); i += 2 {
+			v, _ := strconv.ParseUint(digits[i:i+2], 16, 8)
+			raw = append(raw, byte(v))
+		}
+	default:
+		return ""
+	}
+
+	if len(raw) >= 2 && raw[0] == 0xFE && raw[1] == 0xFF {
+		units := make([]uint16, (len(raw)-2)/2)
+		for i := range units {
+			units[i] = uint16(raw[2+2*i])<<8 | uint16(raw[3+2*i])
+		}
+		return string(utf16.Decode(units))
+	}
+	return latin1(raw)
+}
+
+// pdfDate reformats a PDF date (D:YYYYMMDDHHmmSS followed by the time zone)
+// as YYYY-MM-DD HH:MM:SS; the parts left out default to their first value
+func pdfDate(s string) string {
+	s = strings.TrimPrefix(s, "D:")
+	digits := 0
+	for digits < len(s) && digits < 14 && s[digits] >= '0' && s[digits] <= '9' {
+		digits++
+	}
+	if digits < 4 {
+		return ""
+	}
+	t, err := time.Parse("20060102150405", s[:digits]+"0101000000"[digits-4:])
+	if err != nil {
+		return ""
+	}
+	return t.Format(time.DateTime)
+}
+
+// docProperties holds the elements of docProps/core.xml and meta.xml that
+// are reported; both use Dublin Core names for most of them
+type docProperties struct {
+	Title          string `xml:"title"`
+	Creator        string `xml:"creator"`
+	InitialCreator string `xml:"initial-creator"`
+	LastModifiedBy string `xml:"lastModifiedBy"`
+	Created        string `xml:"created"`
+	CreationDate   string `xml:"creation-date"`
+	Modified       string `xml:"modified"`
+	Date           string `xml:"date"`
+}
+
+// zipMetadata reports the title, authors and dates of Office Open XML and
+// OpenDocument files; other archives have none
+func zipMetadata(r io.ReaderAt, size int64) map[string]string {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil
+	}
+	var props *docProperties
+	for _, f := range zr.File {
+		if f.Name != "docProps/core.xml" && f.Name != "meta.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil
+		}
+		data, _ := io.ReadAll(io.LimitReader(rc, docMetaMaxRead))
+		rc.Close()
+
+		var doc struct {
+			docProperties
+			Meta docProperties `xml:"meta"` // OpenDocument nests them in office:meta
+		}
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return nil
+		}
+		props = &doc.docProperties
+		if f.Name == "meta.xml" {
+			// dc:creator is whoever saved it last
+			m := doc.Meta
+			props = &docProperties{Title: m.Title, Creator: m.InitialCreator, LastModifiedBy: m.Creator,
+				Created: m.CreationDate, Modified: m.Date}
+		}
+		break
+	}
+	if props == nil {
+		return nil
+	}
+
+	meta := make(map[string]string)
+	for key, value := range map[string]string{
+		"title":            props.Title,
+		"author":           props.Creator,
+		"last_modified_by": props.LastModifiedBy,
+		"created":          xmlDate(props.Created),
+		"modified":         xmlDate(props.Modified),
+	} {
+		if value = strings.TrimSpace(value); value != "" {
+			meta[key] = value
+		}
+	}
+	if len(meta) == 0 {
+		return nil
+	}
+	return meta
+}
+
+// xmlDate reformats an XML Schema date and time as YYYY-MM-DD HH:MM:SS
+func xmlDate(s string) string {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(time.DateTime)
+		}
+	}
+	return ""
+}
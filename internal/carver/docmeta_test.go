@@ -0,0 +1,71 @@
+package carver
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPDFMetadata(t *testing.T) {
+	info := "6 0 obj\n<< /Producer (Writer) /Title (Quarterly \\(draft\\)\\040report) /Author <FEFF0041006E006E0061>" +
+		" /CreationDate (D:20210614102201+02'00') /ModDate (D:2022) >>\nendobj\n"
+	pdf := pdfBody + info + "trailer\n<< /Size 7 /Root 1 0 R /Info 6 0 R >>\n%%EOF\n"
+
+	want := map[string]string{
+		"title":    "Quarterly (draft) report",
+		"author":   "Anna",
+		"created":  "2021-06-14 10:22:01",
+		"modified": "2022-01-01 00:00:00",
+	}
+	if got := pdfMetadata(strings.NewReader(pdf), int64(len(pdf))); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	encrypted := strings.Replace(pdf, "/Info 6 0 R", "/Info 6 0 R /Encrypt 7 0 R", 1)
+	if got := pdfMetadata(strings.NewReader(encrypted), int64(len(encrypted))); got != nil {
+		t.Errorf("Expected no metadata from an encrypted PDF, got %v", got)
+	}
+	if got := pdfMetadata(strings.NewReader(pdfBody), int64(len(pdfBody))); got != nil {
+		t.Errorf("Expected no metadata without an Info dictionary, got %v", got)
+	}
+}
+
+func TestZIPMetadata(t *testing.T) {
+	archive := func(name, content string) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+		zw.Close()
+		return buf.Bytes()
+	}
+
+	docx := archive("docProps/core.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<dc:title>Budget</dc:title><dc:creator>Anna Smith</dc:creator><cp:lastModifiedBy>Ben</cp:lastModifiedBy>
+<dcterms:created xsi:type="dcterms:W3CDTF">2021-06-14T10:22:01Z</dcterms:created><dcterms:modified xsi:type="dcterms:W3CDTF">2021-07-01T08:00:00Z</dcterms:modified>
+</cp:coreProperties>`)
+	odt := archive("meta.xml", `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-meta xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:meta="urn:oasis:names:tc:opendocument:xmlns:meta:1.0" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<office:meta><dc:title>Budget</dc:title><meta:initial-creator>Anna Smith</meta:initial-creator><dc:creator>Ben</dc:creator>
+<meta:creation-date>2021-06-14T10:22:01.123</meta:creation-date><dc:date>2021-07-01T08:00:00</dc:date></office:meta>
+</office:document-meta>`)
+
+	want := map[string]string{
+		"title":            "Budget",
+		"author":           "Anna Smith",
+		"last_modified_by": "Ben",
+		"created":          "2021-06-14 10:22:01",
+		"modified":         "2021-07-01 08:00:00",
+	}
+	for name, data := range map[string][]byte{"DOCX": docx, "ODT": odt} {
+		if got := zipMetadata(bytes.NewReader(data), int64(len(data))); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v", name, want, got)
+		}
+	}
+	if plain := makeZIP(t); zipMetadata(bytes.NewReader(plain), int64(len(plain))) != nil {
+		t.Error("Expected no metadata for a ZIP without document properties")
+	}
+}
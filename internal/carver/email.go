@@ -0,0 +1,244 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// Mail stores: Outlook PST/OST files record their own length in the header.
+// EML messages and MBOX mailboxes are plain text with no magic, so hits are
+// only taken on sector boundaries (where a file would start) and must be
+// followed by a believable block of header fields. They end at the closing
+// MIME boundary or where the text gives way to binary data or zero fill.
+
+// PST header fields ([MS-PST] 2.2.2.6)
+const (
+	pstMagicClient = 8
+	pstVersion     = 10
+	pstANSIEOF     = 0xA8 // ROOT.ibFileEof, 32-bit, in ANSI files
+	pstUnicodeEOF  = 0xB8 // ROOT.ibFileEof, 64-bit, in Unicode files
+)
+
+// emlFields are header fields that commonly open or fill a message header
+var emlFields = map[string]bool{
+	"from": true, "to": true, "cc": true, "subject": true, "date": true,
+	"message-id": true, "received": true, "return-path": true, "delivered-to": true,
+	"mime-version": true, "content-type": true, "reply-to": true, "in-reply-to": true,
+	"references": true, "x-mailer": true, "user-agent": true,
+}
+
+// verifyPST checks the client magic ("SM" for PST, "SO" for OST) and format version
+func verifyPST(data []byte) bool {
+	if len(data) < pstUnicodeEOF+8 {
+		return false
+	}
+	client := string(data[pstMagicClient : pstMagicClient+2])
+	if client != "SM" && client != "SO" {
+		return false
+	}
+	switch binary.LittleEndian.Uint16(data[pstVersion:]) {
+	case 14, 15, 23, 36, 37:
+		return true
+	}
+	return false
+}
+
+// pstSize returns the file length recorded in the header's ROOT structure
+func pstSize(r io.ReaderAt, limit int64) int64 {
+	hdr := make([]byte, pstUnicodeEOF+8)
+	if _, err := r.ReadAt(hdr, 0); err != nil || !verifyPST(hdr) {
+		return 0
+	}
+	var eof int64
+	if binary.LittleEndian.Uint16(hdr[pstVersion:]) >= 23 {
+		eof = int64(binary.LittleEndian.Uint64(hdr[pstUnicodeEOF:]))
+	} else {
+		eof = int64(binary.LittleEndian.Uint32(hdr[pstANSIEOF:]))
+	}
+	if eof <= int64(len(hdr)) || eof > limit {
+		return 0
+	}
+	return eof
+}
+
+// classifyPST tells offline folder files from personal folders
+func classifyPST(r io.ReaderAt, size int64) (string, string) {
+	client := make([]byte, 2)
+	if _, err := r.ReadAt(client, pstMagicClient); err == nil && string(client) == "SO" {
+		return "OST", ".ost"
+	}
+	return "", ""
+}
+
+// verifyEML checks that data opens with a block of RFC 5322 header fields,
+// at least three of them ones that mail headers usually carry
+func verifyEML(data []byte) bool {
+	known := make(map[string]bool)
+	lines := 0
+	for len(data) > 0 && lines < 64 {
+		end := bytes.IndexByte(data, '\n')
+		if end < 0 {
+			break // Header continues past the scan buffer
+		}
+		line := bytes.TrimRight(data[:end], "\r")
+		data = data[end+1:]
+
+		if len(line) == 0 {
+			break // End of header
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if lines == 0 {
+				return false
+			}
+			continue // Folded continuation of the previous field
+		}
+		colon := bytes.IndexByte(line, ':')
+		if colon <= 0 || !isFieldName(line[:colon]) {
+			return false
+		}
+		if name := strings.ToLower(string(line[:colon])); emlFields[name] {
+			known[name] = true
+		}
+		lines++
+	}
+	return len(known) >= 3
+}
+
+// isFieldName reports whether b is a header field name: printable ASCII
+// without spaces
+func isFieldName(b []byte) bool {
+	for _, c := range b {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyMBOX checks for an mbox "From " separator line followed by a header
+func verifyMBOX(data []byte) bool {
+	end := bytes.IndexByte(data, '\n')
+	if end < 0 || end > 256 {
+		return false
+	}
+	line := data[:end]
+	if len(line) < 10 || line[5] == ' ' || !isText(line) {
+		return false
+	}
+	return verifyEML(data[end+1:])
+}
+
+// isText reports whether b holds only text bytes
+func isText(b []byte) bool {
+	for _, c := range b {
+		if !isTextByte(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// isTextByte accepts printable ASCII, common whitespace and 8-bit bytes as
+// found in UTF-8 or legacy-encoded text
+func isTextByte(c byte) bool {
+	return c >= 0x20 && c != 0x7F || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == 0x1B
+}
+
+// textSize returns the length of the run of text at the start of r
+func textSize(r io.ReaderAt, limit int64) int64 {
+	buf := make([]byte, 64*1024)
+	var pos int64
+	for pos < limit {
+		n, err := r.ReadAt(buf[:min(int64(len(buf)), limit-pos)], pos)
+		for i := 0; i < n; i++ {
+			if !isTextByte(buf[i]) {
+				return pos + int64(i)
+			}
+		}
+		if n == 0 || (err != nil && err != io.EOF) {
+			break
+		}
+		pos += int64(n)
+	}
+	return pos
+}
+
+// emlSize ends a message after its closing MIME boundary, or at the end of
+// its text when it is not multipart or the boundary is missing
+func emlSize(r io.ReaderAt, limit int64) int64 {
+	end := textSize(r, limit)
+	if end == 0 {
+		return 0
+	}
+
+	head := make([]byte, min(end, 64*1024))
+	if _, err := r.ReadAt(head, 0); err != nil && err != io.EOF {
+		return end
+	}
+	boundary := mimeBoundary(head)
+	if boundary == "" {
+		return end
+	}
+
+	closing := []byte("--" + boundary + "--")
+	idx := readerIndex(r, end, closing)
+	if idx < 0 {
+		return end
+	}
+	// Include the rest of the closing line
+	stop := idx + int64(len(closing))
+	rest := make([]byte, min(end-stop, 2))
+	r.ReadAt(rest, stop)
+	if nl := bytes.IndexByte(rest, '\n'); nl >= 0 {
+		stop += int64(nl) + 1
+	}
+	return stop
+}
+
+// mimeBoundary extracts the boundary parameter of a multipart Content-Type
+// in the header block at the start of head
+func mimeBoundary(head []byte) string {
+	if end := bytes.Index(head, []byte("\n\r\n")); end >= 0 {
+		head = head[:end]
+	} else if end := bytes.Index(head, []byte("\n\n")); end >= 0 {
+		head = head[:end]
+	}
+
+	lower := bytes.ToLower(head)
+	idx := bytes.Index(lower, []byte("boundary="))
+	if idx < 0 {
+		return ""
+	}
+	value := head[idx+len("boundary="):]
+	if len(value) > 0 && value[0] == '"' {
+		if end := bytes.IndexByte(value[1:], '"'); end >= 0 {
+			return string(value[1 : end+1])
+		}
+		return ""
+	}
+	if end := bytes.IndexAny(value, "; \t\r\n"); end >= 0 {
+		value = value[:end]
+	}
+	return string(value)
+}
+
+// readerIndex returns the offset of the first occurrence of pattern in the
+// first size bytes of r, or -1
+func readerIndex(r io.ReaderAt, size int64, pattern []byte) int64 {
+	overlap := len(pattern) - 1
+	buf := make([]byte, 64*1024+overlap)
+	var pos int64
+	for pos < size {
+		n, err := r.ReadAt(buf[:min(int64(len(buf)), size-pos)], pos)
+		if idx := bytes.Index(buf[:n], pattern); idx >= 0 {
+			return pos + int64(idx)
+		}
+		if n <= overlap || (err != nil && err != io.EOF) {
+			break
+		}
+		pos += int64(n - overlap)
+	}
+	return -1
+}
@@ -0,0 +1,131 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+const testEML = "Return-Path: <alice@example.com>\r\n" +
+	"From: Alice <alice@example.com>\r\n" +
+	"To: bob@example.com\r\n" +
+	"Subject: Report\r\n" +
+	"Date: Mon, 1 Jan 2024 10:00:00 +0000\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed;\r\n" +
+	"\tboundary=\"XYZ\"\r\n" +
+	"\r\n" +
+	"--XYZ\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"See attached.\r\n" +
+	"--XYZ--\r\n"
+
+// makePSTHeader returns a Unicode PST (or OST) header recording the file size
+func makePSTHeader(client string, size uint64) []byte {
+	hdr := make([]byte, 512)
+	copy(hdr, "!BDN")
+	copy(hdr[pstMagicClient:], client)
+	binary.LittleEndian.PutUint16(hdr[pstVersion:], 23)
+	binary.LittleEndian.PutUint64(hdr[pstUnicodeEOF:], size)
+	return hdr
+}
+
+func TestPSTSize(t *testing.T) {
+	pst := append(makePSTHeader("SM", 4096), make([]byte, 8192)...)
+	if got := pstSize(bytes.NewReader(pst), int64(len(pst))); got != 4096 {
+		t.Errorf("Expected size 4096 from the header, got %d", got)
+	}
+	if name, ext := classifyPST(bytes.NewReader(pst), 4096); name != "" || ext != "" {
+		t.Errorf("Expected PST to keep its name and extension, got %q, %q", name, ext)
+	}
+
+	ost := makePSTHeader("SO", 512)
+	if name, ext := classifyPST(bytes.NewReader(ost), 512); name != "OST" || ext != ".ost" {
+		t.Errorf("Expected OST, got %q, %q", name, ext)
+	}
+
+	if verifyPST(makePSTHeader("XX", 4096)) {
+		t.Error("Expected unknown client magic to be rejected")
+	}
+}
+
+func TestVerifyEML(t *testing.T) {
+	if !verifyEML([]byte(testEML)) {
+		t.Error("Expected message header to verify")
+	}
+
+	bad := []string{
+		"From: someone\r\nthis is prose, not a header\r\n\r\n",
+		"Received: by host\r\n\r\nbody",                      // Too few known fields
+		" From: a\r\nTo: b\r\nSubject: c\r\n\r\n",            // Starts with a continuation
+		"From: a\r\nTo: b\r\nSub ject: c\r\nDate: d\r\n\r\n", // Space in field name
+	}
+	for _, b := range bad {
+		if verifyEML([]byte(b)) {
+			t.Errorf("Expected %q to be rejected", b)
+		}
+	}
+
+	if !verifyMBOX([]byte("From alice@example.com Mon Jan  1 10:00:00 2024\n" + testEML)) {
+		t.Error("Expected mbox separator and header to verify")
+	}
+	if verifyMBOX([]byte("From  the start of a letter\n" + testEML)) {
+		t.Error("Expected malformed separator to be rejected")
+	}
+}
+
+func TestEMLSize(t *testing.T) {
+	// The closing boundary ends the message even if text follows
+	data := []byte(testEML + "trailing text from another file\r\n")
+	if got := emlSize(bytes.NewReader(data), int64(len(data))); got != int64(len(testEML)) {
+		t.Errorf("Expected size %d, got %d", len(testEML), got)
+	}
+
+	// Without a boundary the message runs until the zero fill
+	plain := "From: a\r\nTo: b\r\nSubject: c\r\n\r\nHello\r\n"
+	data = append([]byte(plain), make([]byte, 100)...)
+	if got := emlSize(bytes.NewReader(data), int64(len(data))); got != int64(len(plain)) {
+		t.Errorf("Expected size %d, got %d", len(plain), got)
+	}
+}
+
+func TestCarveEML(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	// Only the copy on a sector boundary is a candidate
+	data := make([]byte, 64*1024)
+	copy(data[100:], testEML)
+	copy(data[4096:], testEML)
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	carver := NewCarver(reader)
+	files, err := carver.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(files) != 1 || files[0].Signature.Name != "EML" || files[0].Offset != 4096 {
+		t.Fatalf("Expected one EML at 4096, got %v", files)
+	}
+
+	size, err := carver.carveSize(files[0])
+	if err != nil {
+		t.Fatalf("carveSize failed: %v", err)
+	}
+	if size != int64(len(testEML)) {
+		t.Errorf("Expected carved size %d, got %d", len(testEML), size)
+	}
+}
@@ -0,0 +1,45 @@
+package carver
+
+import "math"
+
+// EntropyBlockSize is the granularity of the empty-region pre-pass
+const EntropyBlockSize = 4096
+
+// verifyLead is how far past its header a signature's Verify may look,
+// such as MP4's for the ftyp after its size
+const verifyLead = 16
+
+// Entropy returns the Shannon entropy of data in bits per byte (0-8).
+// All-zero and constant-fill data has an entropy of 0.
+func Entropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+
+	total := float64(len(data))
+	var h float64
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / total
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// isConstant reports whether every byte in data has the same value. It is a
+// fast path for the zero-entropy case used while scanning.
+func isConstant(data []byte) bool {
+	for _, b := range data {
+		if b != data[0] {
+			return false
+		}
+	}
+	return true
+}
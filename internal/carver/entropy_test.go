@@ -0,0 +1,108 @@
+package carver
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func TestEntropy(t *testing.T) {
+	uniform := make([]byte, 256)
+	for i := range uniform {
+		uniform[i] = byte(i)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected float64
+	}{
+		{"Empty", nil, 0},
+		{"Zeros", make([]byte, 4096), 0},
+		{"Two values", []byte{0, 1, 0, 1}, 1},
+		{"Uniform", uniform, 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Entropy(tt.data); math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("Expected entropy %f, got %f", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestScanSkipEmpty(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	// Mostly zeros with a JPEG in the middle of a block
+	data := make([]byte, 256*1024)
+	copy(data[100*1024+17:], []byte{0xFF, 0xD8, 0xFF, 0xE0})
+
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	carver := NewCarver(reader)
+	carver.SetSignatures([]FileSignature{findSignature(t, "JPEG")})
+	carver.SetSkipEmpty(true)
+
+	files, err := carver.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	if len(files) != 1 || files[0].Offset != 100*1024+17 {
+		t.Fatalf("Expected one JPEG at offset %d, got %+v", 100*1024+17, files)
+	}
+
+	// Everything except the block holding the JPEG, and the lead before it
+	// a header may start in, is empty
+	lead := headerLead(carver.signatures)
+	if want := int64(len(data) - EntropyBlockSize - lead); carver.Skipped() != want {
+		t.Errorf("Expected %d skipped bytes, got %d", want, carver.Skipped())
+	}
+}
+
+func TestScanSkipEmptyUnalignedHeader(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "test.img")
+
+	// An MP4 whose size, 0 for a box up to the end of the file, is the last
+	// bytes of a block of zeros, with its ftyp in the next block
+	data := make([]byte, 64*1024)
+	start := 8*EntropyBlockSize - 4
+	copy(data[start+4:], "ftypisom")
+
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	carver := NewCarver(reader)
+	carver.SetSignatures([]FileSignature{findSignature(t, "MP4")})
+	carver.SetSkipEmpty(true)
+	files, err := carver.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(files) != 1 || files[0].Offset != int64(start) {
+		t.Fatalf("Expected one MP4 at offset %d, got %+v", start, files)
+	}
+	if carver.Skipped() == 0 {
+		t.Error("Expected the zeros around the MP4 to be skipped")
+	}
+}
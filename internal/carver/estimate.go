@@ -0,0 +1,87 @@
+package carver
+
+import (
+	"time"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// A dry run scans as a recovery would and writes nothing: it estimates the
+// files the recovery would write, the space they would take, and how long
+// reading them would take at the rate the scan read the disk.
+
+// EstimateBlockSize is the block size of the destination the space of an
+// estimate is counted in, that of most filesystems
+const EstimateBlockSize = 4096
+
+// Estimate is what a recovery would write, as a dry run measured it
+type Estimate struct {
+	Files int   // Files it would write
+	Bytes int64 // Their total size
+	Space int64 // They would take at the destination, each in whole blocks
+
+	LeftOut int // Files of the volumes the filter left out
+
+	Read    int64         // Bytes the scan read
+	Elapsed time.Duration // Time the scan took
+}
+
+// EstimateRecovery estimates what a recovery would write to a destination
+// of blocks of blockSize: with volumes, the deleted files of the disk's
+// volumes with data left, and those in use when the disk's runs take them
+// too, which the filter keeps, and the carved files a scan found that opts
+// would keep
+func EstimateRecovery(reader *disk.Reader, volumes bool, carved []CarvedFile, opts Options, blockSize int64) Estimate {
+	var e Estimate
+	add := func(size int64) {
+		e.Files++
+		e.Bytes += size
+		e.Space += (size + blockSize - 1) / blockSize * blockSize
+	}
+	if volumes {
+		report := BuildReport(reader, "", nil, true)
+		for _, f := range report.Files {
+			if (f.Status == "deleted" || reader.LiveFiles()) && !f.Dir && f.Recoverable != "none" {
+				add(f.Size)
+			}
+		}
+		if report.Filter != nil {
+			for _, n := range report.Filter.LeftOut {
+				e.LeftOut += n
+			}
+		}
+	}
+
+	c := NewCarver(reader)
+	for _, f := range carved {
+		if f.Confidence < opts.MinConfidence {
+			continue
+		}
+		_, size, err := c.content(f)
+		if err != nil || size < max(opts.MinSize, f.Signature.MinSize) {
+			continue
+		}
+		add(size)
+	}
+	return e
+}
+
+// Rate returns the bytes a second the scan read, or 0 when it read too
+// little to tell
+func (e Estimate) Rate() float64 {
+	if e.Read == 0 || e.Elapsed <= 0 {
+		return 0
+	}
+	return float64(e.Read) / e.Elapsed.Seconds()
+}
+
+// Projected returns how long the recovery would take: the scan again, and
+// the reading of its files at the rate the scan read, or 0 when the rate
+// is not known
+func (e Estimate) Projected() time.Duration {
+	rate := e.Rate()
+	if rate == 0 {
+		return 0
+	}
+	return e.Elapsed + time.Duration(float64(e.Bytes)/rate*float64(time.Second))
+}
@@ -0,0 +1,32 @@
+package carver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimateRecovery(t *testing.T) {
+	reader, _ := scannedFAT32(t, t.TempDir())
+
+	// ?LD.TXT, the one deleted file with data left, and two carvings of
+	// which only one is sure enough
+	carved := []CarvedFile{
+		{Signature: &FileSignature{Name: "TXT"}, Fragments: []Fragment{{Offset: 34*512 + 2*4096, Length: 5000}}, Confidence: 80},
+		{Signature: &FileSignature{Name: "TXT"}, Fragments: []Fragment{{Offset: 34*512 + 2*4096, Length: 5}}, Confidence: 10},
+	}
+	e := EstimateRecovery(reader, true, carved, Options{MinConfidence: 50}, 4096)
+	if e.Files != 2 || e.Bytes != 5005 || e.Space != 3*4096 {
+		t.Errorf("Unexpected estimate %+v", e)
+	}
+	if e := EstimateRecovery(reader, false, nil, Options{}, 4096); e.Files != 0 {
+		t.Errorf("Expected nothing without the volumes, got %+v", e)
+	}
+
+	e = Estimate{Bytes: 100 << 20, Read: 50 << 20, Elapsed: time.Second}
+	if e.Rate() != 50<<20 || e.Projected() != 3*time.Second {
+		t.Errorf("Expected 50 MB/s and 3s, got %v and %v", e.Rate(), e.Projected())
+	}
+	if (Estimate{Bytes: 100}).Projected() != 0 {
+		t.Error("Expected no projection without a rate")
+	}
+}
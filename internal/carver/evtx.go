@@ -0,0 +1,68 @@
+package carver
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// Windows XML event logs (.evtx) are a 4KB "ElfFile" header followed by
+// 64KB "ElfChnk" chunks, each self-contained with its own records and
+// checksums. A log whose header was overwritten still leaves usable chunks
+// behind, so lone chunks are carved too.
+
+const (
+	evtxHeaderSize      = 4096
+	evtxChunkSize       = 64 * 1024
+	evtxChunkHeaderSize = 512
+)
+
+// verifyEVTX checks the file header's size, version and block size fields
+func verifyEVTX(data []byte) bool {
+	if len(data) < 44 {
+		return false
+	}
+	headerSize := binary.LittleEndian.Uint32(data[32:])
+	major := binary.LittleEndian.Uint16(data[38:])
+	blockSize := binary.LittleEndian.Uint16(data[40:])
+	return headerSize == 128 && major == 3 && blockSize == evtxHeaderSize
+}
+
+// verifyEVTXChunk checks a chunk header's CRC-32, which covers the first 120
+// bytes and the 384-byte string/template offset table
+func verifyEVTXChunk(data []byte) bool {
+	if len(data) < evtxChunkHeaderSize || binary.LittleEndian.Uint32(data[40:]) != 128 {
+		return false
+	}
+	crc := crc32.ChecksumIEEE(data[:120])
+	crc = crc32.Update(crc, crc32.IEEETable, data[128:evtxChunkHeaderSize])
+	return crc == binary.LittleEndian.Uint32(data[124:])
+}
+
+// evtxSize counts the chunks that follow the header. Chunks missing from the
+// end (overwritten) shorten the file; without any readable chunk the chunk
+// count in the header is used.
+func evtxSize(r io.ReaderAt, limit int64) int64 {
+	hdr := make([]byte, 128)
+	if _, err := r.ReadAt(hdr, 0); err != nil || !verifyEVTX(hdr) {
+		return 0
+	}
+
+	chunk := make([]byte, evtxChunkHeaderSize)
+	pos := int64(evtxHeaderSize)
+	for pos+evtxChunkSize <= limit {
+		if _, err := r.ReadAt(chunk, pos); err != nil || string(chunk[:8]) != "ElfChnk\x00" || !verifyEVTXChunk(chunk) {
+			break
+		}
+		pos += evtxChunkSize
+	}
+	if pos > evtxHeaderSize {
+		return pos
+	}
+
+	recorded := evtxHeaderSize + int64(binary.LittleEndian.Uint16(hdr[42:]))*evtxChunkSize
+	if recorded > evtxHeaderSize && recorded <= limit {
+		return recorded
+	}
+	return 0
+}
@@ -0,0 +1,93 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// makeEVTXChunk returns a 64KB chunk with a valid header checksum
+func makeEVTXChunk(first uint64) []byte {
+	chunk := make([]byte, evtxChunkSize)
+	copy(chunk, "ElfChnk\x00")
+	binary.LittleEndian.PutUint64(chunk[8:], first)
+	binary.LittleEndian.PutUint32(chunk[40:], 128)
+	copy(chunk[evtxChunkHeaderSize:], bytes.Repeat([]byte{0x2A}, 1000)) // Records
+
+	crc := crc32.ChecksumIEEE(chunk[:120])
+	crc = crc32.Update(crc, crc32.IEEETable, chunk[128:evtxChunkHeaderSize])
+	binary.LittleEndian.PutUint32(chunk[124:], crc)
+	return chunk
+}
+
+// makeEVTX returns a file header recording chunks chunks, followed by them
+func makeEVTX(chunks int) []byte {
+	file := make([]byte, evtxHeaderSize)
+	copy(file, "ElfFile\x00")
+	binary.LittleEndian.PutUint32(file[32:], 128)
+	binary.LittleEndian.PutUint16(file[36:], 1)
+	binary.LittleEndian.PutUint16(file[38:], 3)
+	binary.LittleEndian.PutUint16(file[40:], evtxHeaderSize)
+	binary.LittleEndian.PutUint16(file[42:], uint16(chunks))
+	for i := 0; i < chunks; i++ {
+		file = append(file, makeEVTXChunk(uint64(i*100))...)
+	}
+	return file
+}
+
+func TestEVTXSize(t *testing.T) {
+	evtx := makeEVTX(3)
+	data := append(append([]byte{}, evtx...), make([]byte, evtxChunkSize)...)
+	if got := evtxSize(bytes.NewReader(data), int64(len(data))); got != int64(len(evtx)) {
+		t.Errorf("Expected size %d, got %d", len(evtx), got)
+	}
+
+	// An overwritten last chunk is left out
+	evtx[evtxHeaderSize+2*evtxChunkSize+130] ^= 0xFF
+	if got := evtxSize(bytes.NewReader(evtx), int64(len(evtx))); got != evtxHeaderSize+2*evtxChunkSize {
+		t.Errorf("Expected size %d, got %d", evtxHeaderSize+2*evtxChunkSize, got)
+	}
+
+	if verifyEVTXChunk(evtx[evtxHeaderSize+2*evtxChunkSize:]) {
+		t.Error("Expected chunk with bad checksum to be rejected")
+	}
+}
+
+func TestOrphanedEVTXChunks(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	// A complete log at 0 and a lone chunk further on
+	data := make([]byte, 512*1024)
+	copy(data, makeEVTX(2))
+	copy(data[300*1024:], makeEVTXChunk(500))
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	carver := NewCarver(reader)
+	carver.SetSignatures([]FileSignature{findSignature(t, "EVTX"), findSignature(t, "EVTX-CHUNK")})
+	files, err := carver.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(files) != 4 {
+		t.Fatalf("Expected the log, its two chunks and the orphan, got %d hits", len(files))
+	}
+
+	files = carver.dropContained(files)
+	if len(files) != 2 || files[0].Signature.Name != "EVTX" || files[1].Offset != 300*1024 {
+		t.Errorf("Expected the log and the orphaned chunk, got %v", files)
+	}
+}
@@ -0,0 +1,188 @@
+package carver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Photos record when and with what they were taken in EXIF: a TIFF
+// structure in the APP1 segment of a JPEG, or the IFDs of a TIFF-based
+// camera RAW file itself. The date taken, camera and GPS position are
+// reported with each carved photo, and with -by-date photos are filed
+// by the date they were taken instead of by their offset:
+//
+//	JPEG/2021/06/20210614_102201_000123.jpg
+
+// EXIF tags reported
+const (
+	tagModel            = 0x0110
+	tagDateTime         = 0x0132
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+)
+
+// exifDateLayout is how EXIF records dates
+const exifDateLayout = "2006:01:02 15:04:05"
+
+// exifMaxScan is how far into a JPEG the APP1 segment is looked for
+const exifMaxScan = 256 * 1024
+
+// exifMetadata reports the date taken, camera and GPS position of a JPEG
+// or TIFF-based photo
+func exifMetadata(r io.ReaderAt, size int64) map[string]string {
+	var head [2]byte
+	if _, err := r.ReadAt(head[:], 0); err != nil {
+		return nil
+	}
+	start := int64(0)
+	if head == [2]byte{0xFF, 0xD8} {
+		var ok bool
+		if start, ok = jpegEXIF(r, size); !ok {
+			return nil
+		}
+	}
+	t, first, ok := newTIFFReader(io.NewSectionReader(r, start, size-start), size-start)
+	if !ok {
+		return nil
+	}
+	entries, _, _, ok := t.readIFD(int64(first))
+	if !ok {
+		return nil
+	}
+
+	meta := make(map[string]string)
+	maker := t.ascii(entries, tagMake)
+	model := t.ascii(entries, tagModel)
+	switch {
+	case model == "":
+		model = maker
+	case maker != "" && !strings.HasPrefix(strings.ToUpper(model), strings.ToUpper(strings.Fields(maker)[0])):
+		model = maker + " " + model
+	}
+	if model != "" {
+		meta["camera"] = model
+	}
+
+	date := t.ascii(entries, tagDateTime)
+	if exif, ok := t.subIFD(entries, tagExifIFD); ok {
+		if original := t.ascii(exif, tagDateTimeOriginal); original != "" {
+			date = original
+		}
+	}
+	if taken, err := time.Parse(exifDateLayout, date); err == nil {
+		meta["taken"] = taken.Format(time.DateTime)
+	}
+
+	if gps, ok := t.subIFD(entries, tagGPSIFD); ok {
+		lat, latOK := t.degrees(gps, tagGPSLatitude, tagGPSLatitudeRef, "S")
+		lon, lonOK := t.degrees(gps, tagGPSLongitude, tagGPSLongitudeRef, "W")
+		if latOK && lonOK {
+			meta["gps"] = fmt.Sprintf("%.6f,%.6f", lat, lon)
+		}
+	}
+
+	if len(meta) == 0 {
+		return nil
+	}
+	return meta
+}
+
+// jpegEXIF returns the offset of the TIFF header in a JPEG's EXIF APP1
+// segment, which comes before the image data
+func jpegEXIF(r io.ReaderAt, size int64) (int64, bool) {
+	pos := int64(2)
+	var seg [10]byte
+	for pos+4 <= min(size, exifMaxScan) {
+		if _, err := r.ReadAt(seg[:4], pos); err != nil || seg[0] != 0xFF {
+			return 0, false
+		}
+		marker := seg[1]
+		length := int64(seg[2])<<8 | int64(seg[3])
+		if marker == 0xDA || length < 2 {
+			return 0, false // Start of scan: no EXIF
+		}
+		if marker == 0xE1 && length >= 8 {
+			if _, err := r.ReadAt(seg[4:10], pos+4); err == nil && bytes.Equal(seg[4:10], []byte("Exif\x00\x00")) {
+				return pos + 10, true
+			}
+		}
+		pos += 2 + length
+	}
+	return 0, false
+}
+
+// ascii returns the text of an ASCII entry of an IFD
+func (t *tiffReader) ascii(entries []tiffEntry, tag uint16) string {
+	for _, e := range entries {
+		if e.tag == tag && e.typ == 2 {
+			if data, ok := t.data(e); ok {
+				if i := bytes.IndexByte(data, 0); i >= 0 {
+					data = data[:i]
+				}
+				return strings.TrimSpace(string(data))
+			}
+		}
+	}
+	return ""
+}
+
+// subIFD reads the IFD an entry of another points to
+func (t *tiffReader) subIFD(entries []tiffEntry, tag uint16) ([]tiffEntry, bool) {
+	for _, e := range entries {
+		if e.tag == tag {
+			if v, ok := t.values(e); ok && len(v) == 1 {
+				sub, _, _, ok := t.readIFD(v[0])
+				return sub, ok
+			}
+		}
+	}
+	return nil, false
+}
+
+// degrees reads a GPS coordinate, stored as degrees, minutes and seconds
+// rationals with a reference letter that makes it negative when it is neg
+func (t *tiffReader) degrees(entries []tiffEntry, tag, refTag uint16, neg string) (float64, bool) {
+	for _, e := range entries {
+		if e.tag != tag || e.typ != 5 || e.count != 3 {
+			continue
+		}
+		data, ok := t.data(e)
+		if !ok {
+			return 0, false
+		}
+		var deg float64
+		for i, scale := range []float64{1, 60, 3600} {
+			num := t.order.Uint32(data[i*8:])
+			den := t.order.Uint32(data[i*8+4:])
+			if den == 0 {
+				return 0, false
+			}
+			deg += float64(num) / float64(den) / scale
+		}
+		if t.ascii(entries, refTag) == neg {
+			deg = -deg
+		}
+		return deg, true
+	}
+	return 0, false
+}
+
+// datedPath returns where a photo is filed by the date it was taken, below
+// its type directory, or "" when it has no EXIF date
+func datedPath(file CarvedFile, index int) string {
+	taken, err := time.Parse(time.DateTime, file.Metadata["taken"])
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(taken.Format("2006"), taken.Format("01"),
+		fmt.Sprintf("%s_%06d%s", taken.Format("20060102_150405"), index, file.extension()))
+}
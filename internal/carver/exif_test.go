@@ -0,0 +1,126 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// makeEXIF builds the TIFF structure of an EXIF block: IFD0 with the camera
+// and a modification date, the EXIF IFD with the date taken and the GPS IFD
+func makeEXIF() []byte {
+	type entry struct {
+		tag, typ uint16
+		count    uint32
+		data     []byte
+	}
+	le := binary.LittleEndian
+	buf := make([]byte, 146) // Header, then IFDs at 8, 74 and 92; values follow
+	copy(buf, "II*\x00")
+	le.PutUint32(buf[4:], 8)
+	ifd := func(off int, entries []entry) {
+		le.PutUint16(buf[off:], uint16(len(entries)))
+		for i, e := range entries {
+			p := off + 2 + i*12
+			le.PutUint16(buf[p:], e.tag)
+			le.PutUint16(buf[p+2:], e.typ)
+			le.PutUint32(buf[p+4:], e.count)
+			if len(e.data) <= 4 {
+				copy(buf[p+8:], e.data)
+			} else {
+				le.PutUint32(buf[p+8:], uint32(len(buf)))
+				buf = append(buf, e.data...)
+			}
+		}
+	}
+	ascii := func(tag uint16, s string) entry { return entry{tag, 2, uint32(len(s) + 1), append([]byte(s), 0)} }
+	long := func(tag uint16, v uint32) entry { return entry{tag, 4, 1, le.AppendUint32(nil, v)} }
+	rational := func(tag uint16, vals ...uint32) entry {
+		var data []byte
+		for i := 0; i < len(vals); i += 2 {
+			data = le.AppendUint32(le.AppendUint32(data, vals[i]), vals[i+1])
+		}
+		return entry{tag, 5, uint32(len(vals) / 2), data}
+	}
+
+	ifd(8, []entry{
+		ascii(tagMake, "Canon"),
+		ascii(tagModel, "Canon EOS 80D"),
+		ascii(tagDateTime, "2020:01:01 00:00:00"),
+		long(tagExifIFD, 74),
+		long(tagGPSIFD, 92),
+	})
+	ifd(74, []entry{ascii(tagDateTimeOriginal, "2021:06:14 10:22:01")})
+	ifd(92, []entry{
+		ascii(tagGPSLatitudeRef, "N"),
+		rational(tagGPSLatitude, 48, 1, 51, 1, 2950, 100),
+		ascii(tagGPSLongitudeRef, "W"),
+		rational(tagGPSLongitude, 2, 1, 17, 1, 4000, 100),
+	})
+	return buf
+}
+
+// withEXIF inserts an EXIF APP1 segment after a JPEG's SOI marker
+func withEXIF(photo, tiff []byte) []byte {
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(2+6+len(tiff)))
+	app1 = append(append(app1, "Exif\x00\x00"...), tiff...)
+	return append(append(append([]byte{}, photo[:2]...), app1...), photo[2:]...)
+}
+
+func TestEXIFMetadata(t *testing.T) {
+	tiff := makeEXIF()
+	want := map[string]string{
+		"camera": "Canon EOS 80D",
+		"taken":  "2021-06-14 10:22:01",
+		"gps":    "48.858194,-2.294444",
+	}
+
+	photo := withEXIF(makeJPEG(t), tiff)
+	if got := exifMetadata(bytes.NewReader(photo), int64(len(photo))); !reflect.DeepEqual(got, want) {
+		t.Errorf("JPEG: expected %v, got %v", want, got)
+	}
+	// Camera RAW files are TIFF structures themselves
+	if got := exifMetadata(bytes.NewReader(tiff), int64(len(tiff))); !reflect.DeepEqual(got, want) {
+		t.Errorf("TIFF: expected %v, got %v", want, got)
+	}
+	if plain := makeJPEG(t); exifMetadata(bytes.NewReader(plain), int64(len(plain))) != nil {
+		t.Error("Expected no metadata for a JPEG without EXIF")
+	}
+}
+
+func TestByDate(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	dated := withEXIF(makeJPEG(t), makeEXIF())
+	data := make([]byte, 64*1024)
+	copy(data, dated)
+	copy(data[32*1024:], makeJPEG(t))
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	outputDir := filepath.Join(tmpDir, "out")
+	opts := Options{Signatures: []FileSignature{findSignature(t, "JPEG")}, ByDate: true}
+	if n, err := Recover(reader, outputDir, false, opts); err != nil || n != 2 {
+		t.Fatalf("Expected 2 files, got %d (%v)", n, err)
+	}
+	got, err := os.ReadFile(filepath.Join(outputDir, "JPEG", "2021", "06", "20210614_102201_000000.jpg"))
+	if err != nil || !bytes.Equal(got, dated) {
+		t.Errorf("Expected the photo filed by its date (%v)", err)
+	}
+	// Photos without a date keep their generic name
+	if _, err := os.Stat(filepath.Join(outputDir, "JPEG", "carved_000001.jpg")); err != nil {
+		t.Errorf("Expected the undated photo by offset: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package carver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// Other tools can search the free space of a volume when it is laid out as
+// plain files. The extents are copied one after another into blobs, and a
+// map records where each piece of a blob was on the disk:
+//
+//	file                      offset    source_offset  length
+//	unallocated_000.bin       0         1048576        65536
+
+// UnallocatedDir is the directory, below the output directory, that exported
+// free space goes to
+const UnallocatedDir = "unallocated"
+
+// UnallocatedMapFile maps the blobs of an export back to the disk, in
+// UnallocatedDir
+const UnallocatedMapFile = "unallocated.map"
+
+// ExportExtents copies extents of the disk into blob files in dir, starting
+// a new blob every split bytes (0 = one blob), and writes UnallocatedMapFile
+// next to them. It returns the paths of the blobs.
+func ExportExtents(reader *disk.Reader, extents []disk.Extent, dir string, split int64) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	mf, err := os.Create(filepath.Join(dir, UnallocatedMapFile))
+	if err != nil {
+		return nil, err
+	}
+	defer mf.Close()
+	m := bufio.NewWriter(mf)
+	fmt.Fprintln(m, "file\toffset\tsource_offset\tlength")
+
+	var blobs []string
+	var blob *os.File
+	var written int64 // To the current blob
+	defer func() {
+		if blob != nil {
+			blob.Close()
+		}
+	}()
+
+	for _, e := range extents {
+		for pos := e.Offset; pos < e.Offset+e.Length; {
+			if blob == nil || (split > 0 && written >= split) {
+				if blob != nil {
+					if err := blob.Close(); err != nil {
+						return blobs, err
+					}
+				}
+				path := filepath.Join(dir, fmt.Sprintf("unallocated_%03d.bin", len(blobs)))
+				if blob, err = os.Create(path); err != nil {
+					return blobs, err
+				}
+				blobs = append(blobs, path)
+				written = 0
+			}
+
+			n := e.Offset + e.Length - pos
+			if split > 0 {
+				n = min(n, split-written)
+			}
+			if _, err := io.Copy(blob, io.NewSectionReader(reader, pos, n)); err != nil {
+				return blobs, err
+			}
+			fmt.Fprintf(m, "%s\t%d\t%d\t%d\n", filepath.Base(blob.Name()), written, pos, n)
+			written += n
+			pos += n
+		}
+	}
+
+	if blob != nil {
+		err := blob.Close()
+		blob = nil
+		if err != nil {
+			return blobs, err
+		}
+	}
+	return blobs, m.Flush()
+}
+
+// ExportUnallocated writes the unallocated space of the disk to blobs in
+// UnallocatedDir below outputDir, or only reports its size when scanOnly is
+// set. It returns the number of blobs written.
+func ExportUnallocated(reader *disk.Reader, outputDir string, scanOnly bool, split int64) (int, error) {
+	defer reader.Purpose("free space export")()
+	extents, err := UnallocatedSpace(reader)
+	if err != nil {
+		return 0, err
+	}
+	var free int64
+	for _, e := range extents {
+		free += e.Length
+	}
+	reader.Printf("Unallocated space: %d bytes in %d extents\n", free, len(extents))
+	if scanOnly {
+		return 0, nil
+	}
+
+	dir := filepath.Join(outputDir, UnallocatedDir)
+	blobs, err := ExportExtents(reader, extents, dir, split)
+	if err != nil {
+		return len(blobs), err
+	}
+	reader.Printf("Exported to %d files in %s (offset map: %s)\n", len(blobs), dir, UnallocatedMapFile)
+	return len(blobs), nil
+}
@@ -0,0 +1,105 @@
+package carver
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func TestExportExtents(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	dir := filepath.Join(tmpDir, "export")
+
+	data := make([]byte, 1024)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	// The second extent straddles the split
+	extents := []disk.Extent{{Offset: 10, Length: 100}, {Offset: 500, Length: 300}}
+	blobs, err := ExportExtents(reader, extents, dir, 256)
+	if err != nil {
+		t.Fatalf("ExportExtents failed: %v", err)
+	}
+	if len(blobs) != 2 {
+		t.Fatalf("Expected 2 blobs, got %v", blobs)
+	}
+
+	want := [][]byte{
+		append(append([]byte{}, data[10:110]...), data[500:656]...),
+		data[656:800],
+	}
+	for i, path := range blobs {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read blob: %v", err)
+		}
+		if !bytes.Equal(got, want[i]) {
+			t.Errorf("Blob %d does not hold the extents in order", i)
+		}
+	}
+
+	m, err := os.ReadFile(filepath.Join(dir, UnallocatedMapFile))
+	if err != nil {
+		t.Fatalf("Failed to read map: %v", err)
+	}
+	wantMap := "file\toffset\tsource_offset\tlength\n" +
+		"unallocated_000.bin\t0\t10\t100\n" +
+		"unallocated_000.bin\t100\t500\t156\n" +
+		"unallocated_001.bin\t0\t656\t144\n"
+	if string(m) != wantMap {
+		t.Errorf("Expected map:\n%s\ngot:\n%s", wantMap, m)
+	}
+}
+
+func TestExportUnallocated(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	// A FAT32 volume with clusters 2-4 in use; the free clusters hold text
+	volume := makeFAT32(8, 2, 3, 4)
+	dataStart := 34 * 512
+	free := volume[dataStart+3*4096:]
+	copy(free, bytes.Repeat([]byte("deleted "), len(free)/8))
+	if err := os.WriteFile(tmpFile, volume, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	if n, err := ExportUnallocated(reader, outputDir, false, 0); err != nil || n != 1 {
+		t.Fatalf("Expected one blob, got %d (%v)", n, err)
+	}
+	got, err := os.ReadFile(filepath.Join(outputDir, UnallocatedDir, "unallocated_000.bin"))
+	if err != nil {
+		t.Fatalf("Failed to read blob: %v", err)
+	}
+	if !bytes.Equal(got, free) {
+		t.Errorf("Expected the %d bytes of free clusters, got %d bytes", len(free), len(got))
+	}
+
+	// A scan only reports the size
+	scanDir := filepath.Join(tmpDir, "scan")
+	if _, err := ExportUnallocated(reader, scanDir, true, 0); err != nil {
+		t.Fatalf("ExportUnallocated failed: %v", err)
+	}
+	if _, err := os.Stat(scanDir); !os.IsNotExist(err) {
+		t.Error("Expected nothing written by a scan")
+	}
+}
@@ -0,0 +1,63 @@
+package carver
+
+import (
+	"path/filepath"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// The filter of the disk (see disk.Filter) is applied to carving twice:
+// the signatures whose files it would leave out are not searched for, which
+// makes a carve for a few formats faster, and the hits are matched once
+// their format and size are known, by the names they would be written with.
+
+// filterSignatures returns the signatures of sigs whose files the filter
+// may keep. Those that tell formats apart by content (Classify) are kept,
+// since they may find a format the filter keeps, such as DOCX in ZIP.
+func filterSignatures(sigs []FileSignature, filter *disk.Filter) []FileSignature {
+	// Only the globs are matched: a regular expression may be about the
+	// numbers of the files
+	globs := &disk.Filter{Include: filter.Include, Exclude: filter.Exclude}
+	var kept []FileSignature
+	for _, sig := range sigs {
+		if sig.Classify != nil || globs.MatchName(filepath.ToSlash(filepath.Join(sig.Name, "carved"+sig.Extension))) {
+			kept = append(kept, sig)
+		}
+	}
+	return kept
+}
+
+// filterHits returns the hits the filter keeps, in order, and how many it
+// left out, counting them on the reader for the report
+func (c *Carver) filterHits(files []CarvedFile, filter *disk.Filter) ([]CarvedFile, int) {
+	kept := files[:0]
+	left := 0
+	for i := range files {
+		f := files[i]
+		c.classify(&f)
+		why := filter.LeavesName(filepath.ToSlash(c.carvedPath(f, len(kept))))
+		if why == "" && filter.Sized() {
+			if _, size, err := c.content(f); err == nil {
+				why = filter.LeavesSize(size)
+			}
+		}
+		if why != "" {
+			c.reader.LeaveOut(why)
+			left++
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept, left
+}
+
+// classify names the format of a carved file whose signature tells several
+// apart, as writing it would
+func (c *Carver) classify(file *CarvedFile) {
+	if file.Type != "" || file.Extension != "" || file.Signature.Classify == nil {
+		return
+	}
+	if content, size, err := c.content(*file); err == nil {
+		file.Type, file.Extension = file.Signature.Classify(content, size)
+	}
+}
@@ -0,0 +1,76 @@
+package carver
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func TestFilterSignatures(t *testing.T) {
+	sigs := []FileSignature{
+		{Name: "JPEG", Extension: ".jpg"},
+		{Name: "PNG", Extension: ".png"},
+		{Name: "ZIP", Extension: ".zip", Classify: func(io.ReaderAt, int64) (string, string) { return "DOCX", ".docx" }},
+	}
+	kept := filterSignatures(sigs, &disk.Filter{Include: []string{"*.jpg", "*.docx"}})
+	if len(kept) != 2 || kept[0].Name != "JPEG" || kept[1].Name != "ZIP" {
+		t.Errorf("Expected JPEG and ZIP, which may hold a DOCX, got %+v", kept)
+	}
+	if kept := filterSignatures(sigs, &disk.Filter{Include: []string{"png/*"}}); len(kept) != 2 || kept[0].Name != "PNG" {
+		t.Errorf("Expected PNG and ZIP for its directory, got %+v", kept)
+	}
+}
+
+func TestRecoverFilter(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	data := make([]byte, 64*1024)
+	copy(data[0:], "AAAA")
+	copy(data[4096:], "BBBB")
+	copy(data[8192:], "BBBB")
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	sigs := []FileSignature{
+		{Name: "A", Extension: ".a", Header: []byte("AAAA"), MaxSize: 1024},
+		{Name: "B", Extension: ".b", Header: []byte("BBBB"), MaxSize: 1024},
+	}
+	reader.SetFilter(&disk.Filter{Include: []string{"*.b"}, Exclude: []string{"carved_000001.*"}})
+	count, err := Recover(reader, outputDir, false, Options{Signatures: sigs, KeepDuplicates: true})
+	if err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 recovered file, got %d", count)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "B", "carved_000000.b")); err != nil {
+		t.Errorf("Expected the first B carving: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "A")); !os.IsNotExist(err) {
+		t.Errorf("A is not searched for, yet has a directory")
+	}
+	if left := reader.HitsLeftOut(); left[disk.LeftName] != 1 {
+		t.Errorf("Expected 1 hit left out by name, got %v", left)
+	}
+
+	// The B hits are 1024 bytes long
+	reader.SetFilter(&disk.Filter{MaxSize: 1000})
+	count, err = Recover(reader, filepath.Join(tmpDir, "small"), false, Options{Signatures: sigs, KeepDuplicates: true})
+	if err != nil || count != 0 {
+		t.Errorf("Expected no file below 1000 bytes, got %d (%v)", count, err)
+	}
+	if left := reader.HitsLeftOut(); left[disk.LeftTooLarge] != 3 {
+		t.Errorf("Expected 3 hits left out as too large, got %v", left)
+	}
+}
@@ -0,0 +1,372 @@
+package carver
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Space no carving claims still holds the remains of files whose headers are
+// gone. Each 4KB block of it is labelled by what its bytes look like, from
+// their histogram and from byte pairs: text has no control bytes, UTF-16
+// text a zero byte beside each character, entropy-coded JPEG data escapes
+// every 0xFF with a zero, pixels and audio samples change little from one
+// sample to the next, and compressed and encrypted data are near-random,
+// encrypted data the more uniformly so. Data compressed as tightly as
+// deflate manages at its best cannot be told from encrypted data in a
+// block, and is labelled encrypted.
+
+// ContentClass is what a block of data without a header appears to hold
+type ContentClass int
+
+const (
+	ClassEmpty      ContentClass = iota // Constant fill
+	ClassText                           // ASCII, UTF-8 or legacy 8-bit text
+	ClassUTF16                          // UTF-16 text
+	ClassBinary                         // Structured binary data, such as program code or database pages
+	ClassMedia                          // Uncompressed samples, such as bitmap pixels or PCM audio
+	ClassJPEG                           // Entropy-coded JPEG image data
+	ClassCompressed                     // Compressed data
+	ClassEncrypted                      // Encrypted, random or tightly compressed data
+)
+
+var contentClassNames = []string{"empty", "text", "utf16", "binary", "media", "jpeg", "compressed", "encrypted"}
+
+func (c ContentClass) String() string {
+	if int(c) < len(contentClassNames) {
+		return contentClassNames[c]
+	}
+	return "unknown"
+}
+
+// ParseContentClasses converts a comma-separated -fragments flag value into
+// content classes; "all" selects every class but empty
+func ParseContentClasses(s string) ([]ContentClass, error) {
+	var classes []ContentClass
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if name == "all" {
+			var all []ContentClass
+			for c := ClassText; c <= ClassEncrypted; c++ {
+				all = append(all, c)
+			}
+			return all, nil
+		}
+		found := false
+		for i, n := range contentClassNames {
+			if n == name {
+				classes = append(classes, ContentClass(i))
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown content class %q (want %s or all)", name, strings.Join(contentClassNames, ", "))
+		}
+	}
+	return classes, nil
+}
+
+const (
+	// Entropy above which data is compressed, encrypted or JPEG, in bits per byte
+	highEntropy = 7.2
+	// Entropy of random data in a block, short of 8 bits for a 4KB sample
+	randomEntropy = 7.9
+	// Chi-square of the byte histogram against a uniform one above which
+	// near-random data is taken to be compressed; random data averages 255
+	// with a standard deviation of about 23
+	randomChiSquare = 350
+	// Drop in entropy from bytes to differences between samples that marks
+	// pixels and audio
+	mediaEntropyDrop = 1.0
+)
+
+// ClassifyBlock labels a block of data by its content
+func ClassifyBlock(data []byte) ContentClass {
+	if len(data) == 0 || isConstant(data) {
+		return ClassEmpty
+	}
+
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+	if isUTF16Text(data) {
+		return ClassUTF16
+	}
+	if isTextBlock(data, &counts) {
+		return ClassText
+	}
+
+	h := histogramEntropy(&counts, len(data))
+	if h >= highEntropy {
+		switch {
+		case isJPEGScan(data, &counts):
+			return ClassJPEG
+		case h >= randomEntropy && chiSquare(&counts, len(data)) < randomChiSquare:
+			return ClassEncrypted
+		}
+	}
+	if h >= 4 && deltaEntropy(data) < h-mediaEntropyDrop {
+		return ClassMedia
+	}
+	if h >= highEntropy {
+		return ClassCompressed
+	}
+	return ClassBinary
+}
+
+func histogramEntropy(counts *[256]int, n int) float64 {
+	var h float64
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(n)
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+func chiSquare(counts *[256]int, n int) float64 {
+	expected := float64(n) / 256
+	var chi float64
+	for _, c := range counts {
+		d := float64(c) - expected
+		chi += d * d / expected
+	}
+	return chi
+}
+
+// isTextBlock accepts text bytes only, mostly printable ASCII or else
+// valid UTF-8 as in scripts other than Latin
+func isTextBlock(data []byte, counts *[256]int) bool {
+	if counts[0] > 0 {
+		return false
+	}
+	text, ascii := 0, 0
+	for c, n := range counts {
+		if isTextByte(byte(c)) {
+			text += n
+			if c < 0x80 {
+				ascii += n
+			}
+		}
+	}
+	if text < len(data)*97/100 {
+		return false
+	}
+	if ascii >= len(data)*3/4 {
+		return true
+	}
+	// A block may cut a character in two at either end
+	invalid := 0
+	for i := 4; i < len(data)-4; {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			invalid++
+		}
+		i += size
+	}
+	return invalid <= len(data)/100
+}
+
+// isUTF16Text accepts blocks where every other byte is zero and the rest are
+// text, little-endian or big-endian
+func isUTF16Text(data []byte) bool {
+	for order := 0; order < 2; order++ {
+		zeros, text := 0, 0
+		for i := 0; i+1 < len(data); i += 2 {
+			char, high := data[i+order], data[i+1-order]
+			if high == 0 {
+				zeros++
+			}
+			if isTextByte(char) {
+				text++
+			}
+		}
+		if pairs := len(data) / 2; zeros >= pairs*9/10 && text >= pairs*95/100 {
+			return true
+		}
+	}
+	return false
+}
+
+// isJPEGScan accepts data where 0xFF is followed by the zero that escapes it
+// or by a restart marker
+func isJPEGScan(data []byte, counts *[256]int) bool {
+	if counts[0xFF] < 4 {
+		return false
+	}
+	ff, escaped := 0, 0
+	for i := 0; i+1 < len(data); i++ {
+		if data[i] != 0xFF {
+			continue
+		}
+		ff++
+		if next := data[i+1]; next == 0x00 || next >= 0xD0 && next <= 0xD7 {
+			escaped++
+		}
+	}
+	return escaped >= ff*9/10
+}
+
+// deltaEntropy is the lowest entropy of the differences between bytes one
+// to four apart, which covers 8-bit to 32-bit samples and 24-bit pixels
+func deltaEntropy(data []byte) float64 {
+	lowest := 8.0
+	for stride := 1; stride <= 4 && stride < len(data); stride++ {
+		var counts [256]int
+		for i := stride; i < len(data); i++ {
+			counts[data[i]-data[i-stride]]++
+		}
+		lowest = math.Min(lowest, histogramEntropy(&counts, len(data)-stride))
+	}
+	return lowest
+}
+
+// Region is a run of blocks outside the carved files with the same content
+type Region struct {
+	Offset int64
+	Length int64
+	Class  ContentClass
+}
+
+// FragmentsDir is the directory, below the output directory, that regions
+// written by their content class go to
+const FragmentsDir = "_fragments"
+
+// ClassifyFree labels the blocks that none of the carved files cover, within
+// the extents the carver is limited to, calling fn for each run of blocks of
+// the same class in disk order. Files that have been written are taken at
+// their recovered size, others at the size they would be carved to.
+func (c *Carver) ClassifyFree(files []CarvedFile, fn func(Region) error) error {
+	type span struct{ start, end int64 }
+	var claimed []span
+	for _, f := range files {
+		if len(f.Fragments) > 0 {
+			for _, frag := range f.Fragments {
+				claimed = append(claimed, span{frag.Offset, frag.Offset + frag.Length})
+			}
+			continue
+		}
+		size := f.Size
+		if f.SHA256 == "" {
+			var err error
+			if _, size, err = c.content(f); err != nil {
+				continue
+			}
+		}
+		claimed = append(claimed, span{f.Offset, f.Offset + size})
+	}
+	// So is the space a filesystem holds files in, when carving around it
+	if c.extents != nil {
+		end := int64(0)
+		for _, e := range c.extents {
+			if e.Offset > end {
+				claimed = append(claimed, span{end, e.Offset})
+			}
+			end = e.Offset + e.Length
+		}
+		claimed = append(claimed, span{end, c.reader.Size()})
+	}
+	sort.Slice(claimed, func(i, j int) bool { return claimed[i].start < claimed[j].start })
+
+	diskSize := c.reader.Size()
+	buf := make([]byte, EntropyBlockSize)
+	var cur Region
+	k, claimedTo := 0, int64(0) // Next span, and the end of those before it
+	for off := int64(0); off < diskSize; off += EntropyBlockSize {
+		end := min(off+EntropyBlockSize, diskSize)
+		for k < len(claimed) && claimed[k].start < end {
+			claimedTo = max(claimedTo, claimed[k].end)
+			k++
+		}
+		if claimedTo > off {
+			continue
+		}
+
+		n, err := c.reader.ReadAt(buf[:end-off], off)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		class := ClassifyBlock(buf[:n])
+		if cur.Length > 0 && cur.Class == class && cur.Offset+cur.Length == off {
+			cur.Length += int64(n)
+			continue
+		}
+		if cur.Length > 0 {
+			if err := fn(cur); err != nil {
+				return err
+			}
+		}
+		cur = Region{Offset: off, Length: int64(n), Class: class}
+	}
+	if cur.Length > 0 {
+		return fn(cur)
+	}
+	return nil
+}
+
+// WriteFragment saves a region to FragmentsDir/<class> below outputDir,
+// named after its offset
+func (c *Carver) WriteFragment(region Region, outputDir string) (string, error) {
+	ext := ".bin"
+	if region.Class == ClassText || region.Class == ClassUTF16 {
+		ext = ".txt"
+	}
+	path := filepath.Join(outputDir, FragmentsDir, region.Class.String(), fmt.Sprintf("fragment_%012x%s", region.Offset, ext))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, io.NewSectionReader(c.reader, region.Offset, region.Length)); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// reportFree prints how much of the space outside the carved files holds
+// each class of content, writing the regions of the classes in write to
+// FragmentsDir below outputDir
+func (c *Carver) reportFree(files []CarvedFile, outputDir string, write []ContentClass) error {
+	c.reader.Println("\nClassifying space outside the carved files...")
+	selected := make(map[ContentClass]bool)
+	for _, class := range write {
+		selected[class] = true
+	}
+	var total, runs [ClassEncrypted + 1]int64
+	written := 0
+	err := c.ClassifyFree(files, func(r Region) error {
+		total[r.Class] += r.Length
+		runs[r.Class]++
+		if !selected[r.Class] {
+			return nil
+		}
+		if _, err := c.WriteFragment(r, outputDir); err != nil {
+			return err
+		}
+		written++
+		return nil
+	})
+
+	for class, n := range total {
+		if n > 0 {
+			c.reader.Printf("  %s: %d bytes in %d regions\n", ContentClass(class), n, runs[class])
+		}
+	}
+	if written > 0 {
+		c.reader.Printf("Wrote %d fragments to %s\n", written, filepath.Join(outputDir, FragmentsDir))
+	}
+	return err
+}
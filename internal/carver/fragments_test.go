@@ -0,0 +1,209 @@
+package carver
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+const prose = "The quarterly report was sent to the board on Friday. Revenue grew in every region, " +
+	"although costs rose faster than expected in the second half of the year.\n"
+
+// makeProse builds n bytes of text from words picked at random, which
+// compresses far less than a repeated sentence
+func makeProse(n int) []byte {
+	words := strings.Fields(prose)
+	rng := rand.New(rand.NewSource(3))
+	var b bytes.Buffer
+	for b.Len() < n {
+		b.WriteString(words[rng.Intn(len(words))])
+		if rng.Intn(12) == 0 {
+			b.WriteString(".\n")
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	return b.Bytes()[:n]
+}
+
+func TestClassifyBlock(t *testing.T) {
+	random := make([]byte, EntropyBlockSize)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	// 16-bit PCM: a tone with a little noise
+	rng := rand.New(rand.NewSource(2))
+	var pcm []byte
+	for i := 0; len(pcm) < EntropyBlockSize; i++ {
+		sample := 12000*math.Sin(float64(i)/9) + float64(rng.Intn(200))
+		pcm = binary.LittleEndian.AppendUint16(pcm, uint16(int16(sample)))
+	}
+
+	// Table rows: an increasing id, a small count and padding
+	var rows []byte
+	for i := 0; len(rows) < EntropyBlockSize; i++ {
+		rows = binary.LittleEndian.AppendUint32(rows, uint32(1000+i))
+		rows = binary.LittleEndian.AppendUint16(rows, uint16(i%7))
+		rows = append(rows, 0, 0, 0x01, 0x80, 0, 0, 0, 0, 0, 0)
+	}
+
+	text := []byte(strings.Repeat(prose, EntropyBlockSize/len(prose)+1))
+	// Deflate at its best packs a block as tightly as encryption; entropy
+	// coding alone leaves the skew this tells apart
+	compressed := deflate(t, flate.HuffmanOnly, makeProse(64*1024))
+	jpg := makeNoisyJPEG(t)
+
+	tests := []struct {
+		name string
+		data []byte
+		want ContentClass
+	}{
+		{"Zeros", make([]byte, EntropyBlockSize), ClassEmpty},
+		{"Text", text[:EntropyBlockSize], ClassText},
+		{"UTF-8 text", []byte(strings.Repeat("Отчёт отправлен совету директоров в пятницу. ", 60))[:EntropyBlockSize], ClassText},
+		{"UTF-16 text", utf16le(string(text[:EntropyBlockSize/2])), ClassUTF16},
+		{"Table rows", rows[:EntropyBlockSize], ClassBinary},
+		{"PCM audio", pcm[:EntropyBlockSize], ClassMedia},
+		{"JPEG scan", jpg[len(jpg)/2 : len(jpg)/2+EntropyBlockSize], ClassJPEG},
+		{"Huffman-coded", compressed[len(compressed)/2 : len(compressed)/2+EntropyBlockSize], ClassCompressed},
+		{"Random", random, ClassEncrypted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyBlock(tt.data); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseContentClasses(t *testing.T) {
+	classes, err := ParseContentClasses("text, utf16")
+	if err != nil || len(classes) != 2 || classes[0] != ClassText || classes[1] != ClassUTF16 {
+		t.Errorf("Expected text and utf16, got %v (%v)", classes, err)
+	}
+	if classes, err := ParseContentClasses("all"); err != nil || len(classes) != 7 {
+		t.Errorf("Expected every class but empty, got %v (%v)", classes, err)
+	}
+	if classes, err := ParseContentClasses(""); err != nil || classes != nil {
+		t.Errorf("Expected no classes, got %v (%v)", classes, err)
+	}
+	if _, err := ParseContentClasses("text,pictures"); err == nil {
+		t.Error("Expected an error for an unknown class")
+	}
+}
+
+func TestClassifyFree(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	// A JPEG, then two blocks of text whose header is gone, then random data
+	jpg := makeJPEG(t)
+	text := makeProse(2 * EntropyBlockSize)
+	data := make([]byte, 64*1024)
+	copy(data, jpg)
+	copy(data[16*1024:], text)
+	rand.New(rand.NewSource(1)).Read(data[32*1024 : 40*1024])
+
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	carver := NewCarver(reader)
+	carver.SetSignatures([]FileSignature{findSignature(t, "JPEG")})
+	files, err := carver.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected one JPEG, got %d files", len(files))
+	}
+
+	var regions []Region
+	err = carver.ClassifyFree(files, func(r Region) error {
+		regions = append(regions, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ClassifyFree failed: %v", err)
+	}
+
+	// The blocks the JPEG covers are left out
+	jpegEnd := int64(len(jpg)+EntropyBlockSize-1) / EntropyBlockSize * EntropyBlockSize
+	want := []Region{
+		{jpegEnd, 16*1024 - jpegEnd, ClassEmpty},
+		{16 * 1024, 8 * 1024, ClassText},
+		{24 * 1024, 8 * 1024, ClassEmpty},
+		{32 * 1024, 8 * 1024, ClassEncrypted},
+		{40 * 1024, 24 * 1024, ClassEmpty},
+	}
+	if len(regions) != len(want) {
+		t.Fatalf("Expected regions %v, got %v", want, regions)
+	}
+	for i := range want {
+		if regions[i] != want[i] {
+			t.Errorf("Region %d: expected %+v, got %+v", i, want[i], regions[i])
+		}
+	}
+
+	path, err := carver.WriteFragment(regions[1], outputDir)
+	if err != nil {
+		t.Fatalf("WriteFragment failed: %v", err)
+	}
+	if want := filepath.Join(outputDir, FragmentsDir, "text", "fragment_000000004000.txt"); path != want {
+		t.Errorf("Expected %s, got %s", want, path)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read fragment: %v", err)
+	}
+	if !bytes.Equal(got, text) {
+		t.Error("Fragment does not match the text written")
+	}
+}
+
+func TestRecoverFragments(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	data := make([]byte, 64*1024)
+	copy(data[8*1024:], makeProse(EntropyBlockSize))
+	copy(data[24*1024:], utf16le(string(makeProse(EntropyBlockSize/2))))
+
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	opts := Options{Fragments: []ContentClass{ClassText}}
+	if _, err := Recover(reader, outputDir, false, opts); err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+
+	// Only the class asked for is written
+	written, _ := filepath.Glob(filepath.Join(outputDir, FragmentsDir, "*", "*"))
+	if want := filepath.Join(outputDir, FragmentsDir, "text", "fragment_000000002000.txt"); len(written) != 1 || written[0] != want {
+		t.Errorf("Expected only %s, got %v", want, written)
+	}
+}
@@ -0,0 +1,298 @@
+package carver
+
+import (
+	"fmt"
+	"html/template"
+	"image"
+	"image/draw"
+	_ "image/gif" // Decoders for thumbnails
+	"image/jpeg"
+	_ "image/png"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// A directory of carved_NNNNNN files is hard to review without a file
+// manager that previews them. The gallery is one HTML page next to the
+// recovered files showing each picture and video as a small preview that
+// links to the file, grouped by directory. Thumbnails of JPEG, PNG and GIF
+// pictures are written to GalleryDir; other formats a browser can show are
+// shown scaled down, and videos show their first frame once scrolled to.
+// Nothing is loaded before it is on screen.
+
+// GalleryFile is the page written below the output directory, and
+// GalleryDir holds its thumbnails
+const (
+	GalleryFile = "gallery.html"
+	GalleryDir  = "_gallery"
+)
+
+const (
+	galleryThumbSize = 240               // Longest side of a thumbnail, in pixels
+	galleryMaxDecode = 64 * 1024 * 1024  // Larger pictures are shown without a thumbnail
+	galleryMaxPixels = 100 * 1000 * 1000 // Pictures claiming more are not decoded
+)
+
+// Media kinds in the gallery, by extension
+var (
+	galleryThumbnailed = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+	galleryImages      = map[string]bool{".webp": true, ".bmp": true}
+	galleryVideos      = map[string]bool{".mp4": true, ".m4v": true, ".mov": true, ".webm": true}
+	galleryOther       = map[string]bool{
+		".tif": true, ".tiff": true, ".cr2": true, ".cr3": true, ".nef": true, ".arw": true, ".orf": true,
+		".rw2": true, ".dng": true, ".avi": true, ".wmv": true, ".flv": true, ".mkv": true, ".mts": true,
+		".m2ts": true, ".ts": true, ".mxf": true, ".braw": true,
+	}
+)
+
+// galleryItem is one file in the gallery
+type galleryItem struct {
+	Href    string // Relative to the page
+	Name    string
+	Size    string
+	Thumb   string // Thumbnail or picture to show ("" = none)
+	Video   bool
+	Details []string // Date taken and camera, from EXIF
+}
+
+// gallerySection is the files of one directory
+type gallerySection struct {
+	Dir   string
+	Items []galleryItem
+}
+
+// WriteGallery writes GalleryFile to dir, with a preview of every picture
+// and video below it, and returns the number of files shown, which it
+// tells rep of
+func WriteGallery(dir string, rep disk.ProgressReporter) (int, error) {
+	thumbs := filepath.Join(dir, GalleryDir)
+	if err := os.MkdirAll(thumbs, 0755); err != nil {
+		return 0, err
+	}
+
+	sections := make(map[string]*gallerySection)
+	count := 0
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path == thumbs {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if !galleryThumbnailed[ext] && !galleryImages[ext] && !galleryVideos[ext] && !galleryOther[ext] {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		item := galleryItem{
+			Href:  galleryHref(rel),
+			Name:  filepath.Base(rel),
+			Size:  humanSize(info.Size()),
+			Video: galleryVideos[ext],
+		}
+		switch {
+		case galleryThumbnailed[ext] && info.Size() <= galleryMaxDecode:
+			thumb := filepath.Join(thumbs, fmt.Sprintf("%06d.jpg", count))
+			if err := writeThumbnail(path, thumb); err == nil {
+				item.Thumb = filepath.ToSlash(filepath.Join(GalleryDir, filepath.Base(thumb)))
+			}
+		case galleryImages[ext]:
+			item.Thumb = item.Href
+		}
+		if f, err := os.Open(path); err == nil {
+			meta := exifMetadata(f, info.Size())
+			f.Close()
+			for _, key := range []string{"taken", "camera"} {
+				if meta[key] != "" {
+					item.Details = append(item.Details, meta[key])
+				}
+			}
+		}
+
+		d := filepath.ToSlash(filepath.Dir(rel))
+		if sections[d] == nil {
+			sections[d] = &gallerySection{Dir: d}
+		}
+		sections[d].Items = append(sections[d].Items, item)
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+
+	var page []*gallerySection
+	for _, s := range sections {
+		page = append(page, s)
+	}
+	sort.Slice(page, func(i, j int) bool { return page[i].Dir < page[j].Dir })
+
+	out, err := os.Create(filepath.Join(dir, GalleryFile))
+	if err != nil {
+		return count, err
+	}
+	defer out.Close()
+	if err := galleryTemplate.Execute(out, struct {
+		Count    int
+		Sections []*gallerySection
+	}{count, page}); err != nil {
+		return count, err
+	}
+	printf(rep, "\nWrote a gallery of %d pictures and videos to %s\n", count, filepath.Join(dir, GalleryFile))
+	return count, out.Close()
+}
+
+// writeThumbnail writes a JPEG of the picture at path scaled down to fit
+// galleryThumbSize
+func writeThumbnail(path, thumb string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return err
+	}
+	if cfg.Width*cfg.Height > galleryMaxPixels {
+		return fmt.Errorf("%dx%d is too large to decode", cfg.Width, cfg.Height)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return err
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(thumb)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if err := jpeg.Encode(out, scaleDown(img, galleryThumbSize), &jpeg.Options{Quality: 80}); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// scaleDown shrinks an image to fit in a size by size square, averaging
+// the pixels that make up each new one. Smaller images are kept as they are.
+func scaleDown(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	tw, th := size, max(h*size/w, 1)
+	if h > w {
+		tw, th = max(w*size/h, 1), size
+	}
+
+	src := image.NewRGBA(b)
+	draw.Draw(src, b, img, b.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := y*h/th, max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := x*w/tw, max((x+1)*w/tw, x*w/tw+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(row[sx*4+c])
+					}
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			p := dst.Pix[y*dst.Stride+x*4:]
+			for c := 0; c < 4; c++ {
+				p[c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// humanSize formats a byte count for people
+func humanSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// galleryHref turns a path below the page into a link, escaping each part:
+// the names of deleted FAT32 files start with "?"
+func galleryHref(rel string) string {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
+
+var galleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Recovered pictures and videos</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; background: #f4f4f4; }
+.grid { display: flex; flex-wrap: wrap; gap: 12px; }
+.tile { width: 240px; background: #fff; border: 1px solid #ddd; padding: 6px; font-size: 12px; }
+.tile a { color: #000; text-decoration: none; }
+.preview { width: 240px; height: 240px; display: flex; align-items: center; justify-content: center; background: #eee; color: #888; }
+.preview img, .preview video { max-width: 240px; max-height: 240px; }
+.name { font-weight: bold; word-break: break-all; margin-top: 4px; }
+.details { color: #666; }
+</style>
+</head>
+<body>
+<h1>Recovered pictures and videos</h1>
+<p>{{.Count}} files. Click a preview to open the file.</p>
+{{range .Sections}}
+<h2>{{.Dir}}</h2>
+<div class="grid">
+{{range .Items}}<div class="tile"><a href="{{.Href}}">
+<div class="preview">{{if .Thumb}}<img src="{{.Thumb}}" loading="lazy" alt="">{{else if .Video}}<video data-src="{{.Href}}#t=0.1" preload="none" muted></video>{{else}}No preview{{end}}</div>
+<div class="name">{{.Name}}</div></a>
+<div class="details">{{.Size}}{{range .Details}} &middot; {{.}}{{end}}</div>
+</div>
+{{end}}</div>
+{{end}}
+<script>
+// Load the first frame of a video once it is scrolled to
+const observer = new IntersectionObserver(entries => {
+  for (const e of entries) {
+    if (e.isIntersecting) {
+      e.target.src = e.target.dataset.src;
+      e.target.preload = "metadata";
+      observer.unobserve(e.target);
+    }
+  }
+});
+document.querySelectorAll("video[data-src]").forEach(v => observer.observe(v));
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,88 @@
+package carver
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func TestWriteGallery(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"JPEG/carved_000001.jpg": makeJPEG(t),
+		"PNG/carved_000002.png":  makePNG(t),
+		"filesystem/?HOTO.JPG":   makeJPEG(t),
+		"MP4/carved_000003.mp4":  []byte("\x00\x00\x00\x18ftypmp42"),
+		"ZIP/carved_000004.zip":  makeZIP(t),
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	n, err := WriteGallery(dir, disk.NewPrinter(io.Discard))
+	if err != nil {
+		t.Fatalf("WriteGallery failed: %v", err)
+	}
+	if n != 4 {
+		t.Errorf("Expected 4 pictures and videos, got %d", n)
+	}
+	if thumbs, _ := filepath.Glob(filepath.Join(dir, GalleryDir, "*.jpg")); len(thumbs) != 3 {
+		t.Errorf("Expected 3 thumbnails, got %v", thumbs)
+	}
+
+	page, err := os.ReadFile(filepath.Join(dir, GalleryFile))
+	if err != nil {
+		t.Fatalf("Failed to read gallery: %v", err)
+	}
+	for _, want := range []string{
+		`href="JPEG/carved_000001.jpg"`,
+		`href="filesystem/%3fHOTO.JPG"`,
+		`data-src="MP4/carved_000003.mp4#t=0.1"`,
+		`loading="lazy"`,
+	} {
+		if !strings.Contains(strings.ToLower(string(page)), strings.ToLower(want)) {
+			t.Errorf("Expected %s in the gallery", want)
+		}
+	}
+	if strings.Contains(string(page), "carved_000004.zip") {
+		t.Error("Expected only pictures and videos in the gallery")
+	}
+
+	// A second run does not show the thumbnails of the first
+	if n, err := WriteGallery(dir, disk.NewPrinter(io.Discard)); err != nil || n != 4 {
+		t.Errorf("Expected 4 files again, got %d (%v)", n, err)
+	}
+}
+
+func TestScaleDown(t *testing.T) {
+	// Left half black, right half white
+	img := image.NewRGBA(image.Rect(0, 0, 960, 480))
+	for y := 0; y < 480; y++ {
+		for x := 480; x < 960; x++ {
+			img.Set(x, y, color.White)
+		}
+	}
+	small := scaleDown(img, 240)
+	if b := small.Bounds(); b.Dx() != 240 || b.Dy() != 120 {
+		t.Fatalf("Expected 240x120, got %v", b)
+	}
+	if r, _, _, _ := small.At(10, 10).RGBA(); r != 0 {
+		t.Errorf("Expected black on the left, got %d", r)
+	}
+	if r, _, _, _ := small.At(230, 10).RGBA(); r != 0xFFFF {
+		t.Errorf("Expected white on the right, got %d", r)
+	}
+	if scaleDown(image.NewRGBA(image.Rect(0, 0, 100, 50)), 240).Bounds().Dx() != 100 {
+		t.Error("Expected a small image to be kept as it is")
+	}
+}
@@ -0,0 +1,247 @@
+package carver
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// Git stores each loose object as a zlib stream of "<type> <size>\0" and the
+// content, named after the SHA-1 of the uncompressed bytes. Packfiles are
+// "PACK", a version, an object count and that many entries (a type and size
+// header, a delta base for deltified objects, then a zlib stream), followed
+// by the SHA-1 of everything before it. Pack index (.idx) files map object
+// IDs to offsets in the pack with the same checksum.
+
+const (
+	gitPackHeaderSize = 12
+	gitIdxHeaderSize  = 8
+	gitFanoutSize     = 256 * 4
+)
+
+var gitObjectTypes = []string{"blob", "tree", "commit", "tag"}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// inflatedLen inflates the zlib stream at offset off of r, copying the output
+// to w, and returns the compressed length including the Adler-32 trailer
+func inflatedLen(r io.ReaderAt, off, limit int64, w io.Writer) (int64, error) {
+	cr := &countingReader{r: io.NewSectionReader(r, off, limit-off)}
+	br := bufio.NewReader(cr) // A flate.Reader, so zlib reads no further than the stream
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.Copy(w, zr); err != nil {
+		return 0, err
+	}
+	if err := zr.Close(); err != nil {
+		return 0, err
+	}
+	return cr.n - int64(br.Buffered()), nil
+}
+
+// parseGitObjectHeader splits "<type> <size>\0" off the start of an inflated
+// loose object, returning the header length
+func parseGitObjectHeader(data []byte) (typ string, size int64, n int, ok bool) {
+	sp := bytes.IndexByte(data, ' ')
+	nul := bytes.IndexByte(data, 0)
+	if sp <= 0 || nul <= sp+1 {
+		return "", 0, 0, false
+	}
+	typ = string(data[:sp])
+	found := false
+	for _, t := range gitObjectTypes {
+		found = found || typ == t
+	}
+	size, err := strconv.ParseInt(string(data[sp+1:nul]), 10, 64)
+	if !found || err != nil || size < 0 {
+		return "", 0, 0, false
+	}
+	return typ, size, nul + 1, true
+}
+
+// verifyGitObject inflates the start of a zlib stream and checks for a loose
+// object header
+func verifyGitObject(data []byte) bool {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+	head := make([]byte, 32)
+	n, _ := io.ReadFull(zr, head)
+	_, _, _, ok := parseGitObjectHeader(head[:n])
+	return ok
+}
+
+// readGitObject inflates a loose object and checks its length against the
+// size in its header
+func readGitObject(r io.ReaderAt, limit int64) (content []byte, compressed int64, ok bool) {
+	var buf bytes.Buffer
+	compressed, err := inflatedLen(r, 0, limit, &buf)
+	if err != nil {
+		return nil, 0, false
+	}
+	_, size, n, ok := parseGitObjectHeader(buf.Bytes())
+	if !ok || int64(buf.Len()-n) != size {
+		return nil, 0, false
+	}
+	return buf.Bytes(), compressed, true
+}
+
+// gitObjectSize is the length of the loose object's zlib stream
+func gitObjectSize(r io.ReaderAt, limit int64) int64 {
+	if _, compressed, ok := readGitObject(r, limit); ok {
+		return compressed
+	}
+	return 0
+}
+
+// gitObjectMetadata reports a loose object's type and ID, which give its path
+// under .git/objects
+func gitObjectMetadata(r io.ReaderAt, size int64) map[string]string {
+	content, _, ok := readGitObject(r, size)
+	if !ok {
+		return nil
+	}
+	typ, _, _, _ := parseGitObjectHeader(content)
+	sum := sha1.Sum(content)
+	return map[string]string{"type": typ, "id": hex.EncodeToString(sum[:])}
+}
+
+// verifyGitPack checks a packfile's version and object count
+func verifyGitPack(data []byte) bool {
+	if len(data) < gitPackHeaderSize {
+		return false
+	}
+	version := binary.BigEndian.Uint32(data[4:])
+	return (version == 2 || version == 3) && binary.BigEndian.Uint32(data[8:]) > 0
+}
+
+// gitPackSize walks the objects counted in the header, inflating each one to
+// find where the next starts; the SHA-1 trailer follows the last
+func gitPackSize(r io.ReaderAt, limit int64) int64 {
+	hdr := make([]byte, gitPackHeaderSize)
+	if _, err := r.ReadAt(hdr, 0); err != nil || !verifyGitPack(hdr) {
+		return 0
+	}
+	count := binary.BigEndian.Uint32(hdr[8:])
+
+	pos := int64(gitPackHeaderSize)
+	entry := make([]byte, 32)
+	for i := uint32(0); i < count; i++ {
+		n, _ := r.ReadAt(entry, pos)
+		if n == 0 {
+			return 0
+		}
+
+		// Type and size: 7 bits per byte after the first 4, MSB continues
+		k := 0
+		typ := entry[0] >> 4 & 7
+		for k < n && entry[k]&0x80 != 0 {
+			k++
+		}
+		k++
+		switch typ {
+		case 1, 2, 3, 4:
+		case 6: // Offset delta: a varint distance back to the base
+			for k < n && entry[k]&0x80 != 0 {
+				k++
+			}
+			k++
+		case 7: // Reference delta: the base object's ID
+			k += sha1.Size
+		default:
+			return 0
+		}
+		if k > n {
+			return 0
+		}
+
+		compressed, err := inflatedLen(r, pos+int64(k), limit, io.Discard)
+		if err != nil {
+			return 0
+		}
+		pos += int64(k) + compressed
+	}
+
+	if pos+sha1.Size > limit {
+		return 0
+	}
+	return pos + sha1.Size
+}
+
+// gitPackMetadata reports the checksum that names a pack (pack-<id>.pack)
+func gitPackMetadata(r io.ReaderAt, size int64) map[string]string {
+	sum := make([]byte, sha1.Size)
+	if _, err := r.ReadAt(sum, size-sha1.Size); err != nil {
+		return nil
+	}
+	return map[string]string{"id": hex.EncodeToString(sum)}
+}
+
+// validateGitPack checks the SHA-1 trailer against the pack's content
+func validateGitPack(r io.ReaderAt, size int64) error {
+	if size < gitPackHeaderSize+sha1.Size {
+		return errors.New("git pack: truncated")
+	}
+	h := sha1.New()
+	if _, err := io.Copy(h, io.NewSectionReader(r, 0, size-sha1.Size)); err != nil {
+		return err
+	}
+	sum := make([]byte, sha1.Size)
+	if _, err := r.ReadAt(sum, size-sha1.Size); err != nil {
+		return err
+	}
+	if !bytes.Equal(sum, h.Sum(nil)) {
+		return errors.New("git pack: checksum mismatch")
+	}
+	return nil
+}
+
+// gitIdxSize sizes a version 2 pack index from its object count: the
+// fanout table, then an ID, CRC-32 and offset per object, 8-byte offsets
+// for objects past 2GB and the two checksums
+func gitIdxSize(r io.ReaderAt, limit int64) int64 {
+	last := make([]byte, 4)
+	if _, err := r.ReadAt(last, gitIdxHeaderSize+gitFanoutSize-4); err != nil {
+		return 0
+	}
+	count := int64(binary.BigEndian.Uint32(last))
+	offsets := gitIdxHeaderSize + gitFanoutSize + count*(sha1.Size+4)
+	if offsets+count*4+2*sha1.Size > limit {
+		return 0
+	}
+
+	table := make([]byte, count*4)
+	if _, err := r.ReadAt(table, offsets); err != nil {
+		return 0
+	}
+	var large int64
+	for i := int64(0); i < count; i++ {
+		if table[4*i]&0x80 != 0 {
+			large++
+		}
+	}
+	size := offsets + count*4 + large*8 + 2*sha1.Size
+	if size > limit {
+		return 0
+	}
+	return size
+}
@@ -0,0 +1,144 @@
+package carver
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// deflate compresses data as a zlib stream at the given level
+func deflate(t *testing.T, level int, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&buf, level)
+	if err != nil {
+		t.Fatalf("Failed to create zlib writer: %v", err)
+	}
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// makeGitPack builds a version 2 pack of blobs, the last one stored as an
+// offset delta against the first
+func makeGitPack(t *testing.T, blobs ...string) []byte {
+	pack := []byte("PACK")
+	pack = binary.BigEndian.AppendUint32(pack, 2)
+	pack = binary.BigEndian.AppendUint32(pack, uint32(len(blobs)))
+	for i, blob := range blobs {
+		typ := byte(3)
+		if i == len(blobs)-1 && i > 0 {
+			typ = 6
+		}
+		// Sizes below 16 fit in the first byte
+		pack = append(pack, typ<<4|byte(len(blob)&0x0F))
+		if typ == 6 {
+			pack = append(pack, 0x81, 0x00) // Distance back to the base
+		}
+		pack = append(pack, deflate(t, zlib.DefaultCompression, []byte(blob))...)
+	}
+	sum := sha1.Sum(pack)
+	return append(pack, sum[:]...)
+}
+
+func TestGitObject(t *testing.T) {
+	object := deflate(t, zlib.BestSpeed, []byte("blob 6\x00hello\n"))
+	data := append(append([]byte{}, object...), bytes.Repeat([]byte{0x55}, 1000)...)
+
+	if !verifyGitObject(data) {
+		t.Fatal("Expected loose object to verify")
+	}
+	if verifyGitObject(deflate(t, zlib.BestSpeed, []byte("not a git object"))) {
+		t.Error("Expected other zlib stream to be rejected")
+	}
+	if got := gitObjectSize(bytes.NewReader(data), int64(len(data))); got != int64(len(object)) {
+		t.Errorf("Expected size %d, got %d", len(object), got)
+	}
+
+	meta := gitObjectMetadata(bytes.NewReader(object), int64(len(object)))
+	if meta["type"] != "blob" || meta["id"] != "ce013625030ba8dba906f756967f9e9ca394464a" {
+		t.Errorf("Unexpected metadata %v", meta)
+	}
+
+	// A header size that disagrees with the content
+	wrong := deflate(t, zlib.BestSpeed, []byte("blob 9\x00hello\n"))
+	if got := gitObjectSize(bytes.NewReader(wrong), int64(len(wrong))); got != 0 {
+		t.Errorf("Expected size mismatch to be rejected, got %d", got)
+	}
+}
+
+func TestGitPack(t *testing.T) {
+	pack := makeGitPack(t, "first blob", "second", "delta")
+	data := append(append([]byte{}, pack...), bytes.Repeat([]byte{0x33}, 4096)...)
+
+	if got := gitPackSize(bytes.NewReader(data), int64(len(data))); got != int64(len(pack)) {
+		t.Fatalf("Expected size %d, got %d", len(pack), got)
+	}
+	if err := validateGitPack(bytes.NewReader(pack), int64(len(pack))); err != nil {
+		t.Errorf("Expected valid pack, got %v", err)
+	}
+
+	pack[20] ^= 0xFF
+	if err := validateGitPack(bytes.NewReader(pack), int64(len(pack))); err == nil {
+		t.Error("Expected checksum mismatch")
+	}
+}
+
+func TestGitIdxSize(t *testing.T) {
+	// Three objects, one at an offset past 2GB
+	idx := []byte{0xFF, 't', 'O', 'c', 0, 0, 0, 2}
+	for i := 0; i < 256; i++ {
+		idx = binary.BigEndian.AppendUint32(idx, 3)
+	}
+	idx = append(idx, make([]byte, 3*(sha1.Size+4))...)
+	idx = binary.BigEndian.AppendUint32(idx, 12)
+	idx = binary.BigEndian.AppendUint32(idx, 0x80000000)
+	idx = binary.BigEndian.AppendUint32(idx, 100)
+	idx = append(idx, make([]byte, 8+2*sha1.Size)...)
+
+	data := append(append([]byte{}, idx...), bytes.Repeat([]byte{0x44}, 512)...)
+	if got := gitIdxSize(bytes.NewReader(data), int64(len(data))); got != int64(len(idx)) {
+		t.Errorf("Expected size %d, got %d", len(idx), got)
+	}
+}
+
+func TestCarveGitObjects(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	data := make([]byte, 256*1024)
+	copy(data[4096:], deflate(t, zlib.BestSpeed, []byte("blob 6\x00hello\n")))
+	copy(data[8192:], deflate(t, zlib.BestSpeed, []byte("plain zlib data")))
+	copy(data[16384:], makeGitPack(t, "one", "two"))
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	carver := NewCarver(reader)
+	var sigs []FileSignature
+	for _, sig := range Signatures {
+		if sig.Name == "GIT-OBJECT" || sig.Name == "GIT-PACK" {
+			sigs = append(sigs, sig)
+		}
+	}
+	carver.SetSignatures(sigs)
+	files, err := carver.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(files) != 2 || files[0].Offset != 4096 || files[1].Signature.Name != "GIT-PACK" {
+		t.Errorf("Expected the loose object and the pack, got %v", files)
+	}
+}
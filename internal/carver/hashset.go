@@ -0,0 +1,239 @@
+package carver
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// Most of a recovered system disk is the operating system and the
+// applications installed on it. A hash set of such known files, like the
+// NSRL's Reference Data Set, lets a recovery leave them out, or keep only
+// them when looking for a known file. Any text file of hex digests can be
+// loaded: the RDS NSRLFile.txt, md5sum/sha1sum/sha256sum output, hashdeep
+// lists or one digest per line. Every MD5, SHA-1 and SHA-256 digest on a
+// line is taken, and lines starting with # or % are comments.
+
+// HashSet is a set of MD5, SHA-1 and SHA-256 digests of known files
+type HashSet struct {
+	md5    map[[md5.Size]byte]struct{}
+	sha1   map[[sha1.Size]byte]struct{}
+	sha256 map[[sha256.Size]byte]struct{}
+}
+
+// LoadHashSet reads the digests in the given files into one set
+func LoadHashSet(paths ...string) (*HashSet, error) {
+	s := &HashSet{
+		md5:    make(map[[md5.Size]byte]struct{}),
+		sha1:   make(map[[sha1.Size]byte]struct{}),
+		sha256: make(map[[sha256.Size]byte]struct{}),
+	}
+	for _, path := range paths {
+		if err := s.load(path); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *HashSet) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "%") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == '"' || r == ' ' || r == '\t' || r == '*'
+		})
+		for _, field := range fields {
+			s.add(field)
+		}
+	}
+	return scanner.Err()
+}
+
+// add adds a hex digest to the set, ignoring anything that is not one
+func (s *HashSet) add(digest string) bool {
+	b, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+	switch len(b) {
+	case md5.Size:
+		s.md5[[md5.Size]byte(b)] = struct{}{}
+	case sha1.Size:
+		s.sha1[[sha1.Size]byte(b)] = struct{}{}
+	case sha256.Size:
+		s.sha256[[sha256.Size]byte(b)] = struct{}{}
+	default:
+		return false
+	}
+	return true
+}
+
+// Len returns the number of digests in the set
+func (s *HashSet) Len() int {
+	return len(s.md5) + len(s.sha1) + len(s.sha256)
+}
+
+// Contains reports whether a hex MD5, SHA-1 or SHA-256 digest is in the set
+func (s *HashSet) Contains(digest string) bool {
+	b, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+	var ok bool
+	switch len(b) {
+	case md5.Size:
+		_, ok = s.md5[[md5.Size]byte(b)]
+	case sha1.Size:
+		_, ok = s.sha1[[sha1.Size]byte(b)]
+	case sha256.Size:
+		_, ok = s.sha256[[sha256.Size]byte(b)]
+	}
+	return ok
+}
+
+// MatchFile reports whether the file at path is in the set. sum is its
+// SHA-256 digest if already known; only the digests the set holds that are
+// not known are computed.
+func (s *HashSet) MatchFile(path, sum string) (bool, error) {
+	return s.matchFile(path, sum, func(path string) (io.ReadCloser, error) { return os.Open(path) })
+}
+
+// matchFile is MatchFile, reading the file as open opens it
+func (s *HashSet) matchFile(path, sum string, open func(string) (io.ReadCloser, error)) (bool, error) {
+	if sum != "" && s.Contains(sum) {
+		return true, nil
+	}
+	var hashes []hash.Hash
+	if len(s.md5) > 0 {
+		hashes = append(hashes, md5.New())
+	}
+	if len(s.sha1) > 0 {
+		hashes = append(hashes, sha1.New())
+	}
+	if len(s.sha256) > 0 && sum == "" {
+		hashes = append(hashes, sha256.New())
+	}
+	if len(hashes) == 0 {
+		return false, nil
+	}
+
+	f, err := open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	writers := make([]io.Writer, len(hashes))
+	for i, h := range hashes {
+		writers[i] = h
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), f); err != nil {
+		return false, err
+	}
+	for _, h := range hashes {
+		if s.Contains(hex.EncodeToString(h.Sum(nil))) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// filtered reports whether the file at path, recovered from reader, should
+// be dropped: it is in the set, or with keep, it is not. A nil set filters
+// nothing.
+func (s *HashSet) filtered(reader *disk.Reader, path, sum string, keep bool) bool {
+	if s == nil {
+		return false
+	}
+	known, err := s.matchFile(path, sum, reader.OpenOutput)
+	if err != nil {
+		reader.Errorf("  Failed to hash %s: %v\n", path, err)
+		return false
+	}
+	return known != keep
+}
+
+// dropKnown leaves out the files recovered from reader that opts.KnownFiles
+// filtered out as they were written, and returns the rest
+func dropKnown(reader *disk.Reader, files []Recovered, opts Options) []Recovered {
+	if opts.KnownFiles == nil {
+		return files
+	}
+	kept := files[:0]
+	for _, f := range files {
+		if !f.known {
+			kept = append(kept, f)
+		}
+	}
+	if dropped := len(files) - len(kept); dropped > 0 {
+		reader.Printf("\nSkipped %d recovered files %s\n", dropped, knownReason(opts.KeepKnown))
+	}
+	return kept
+}
+
+// DropKnownFiles removes the files recovered from reader below dir that set
+// filters out (those in it, or with keep, those not in it) and returns how
+// many it removed
+func DropKnownFiles(reader *disk.Reader, dir string, set *HashSet, keep bool) (int, error) {
+	removed := make(map[string]bool)
+	var manifests []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if disk.IsManifest(info.Name()) {
+			if info.Name() == disk.ManifestJSON {
+				manifests = append(manifests, filepath.Dir(path))
+			}
+			return nil
+		}
+		if IsSidecar(info.Name()) {
+			return nil
+		}
+		if info.Mode().IsRegular() && set.filtered(reader, path, "", keep) {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			os.Remove(path + SidecarSuffix)
+			removed[path] = true
+		}
+		return nil
+	})
+	if len(removed) > 0 {
+		reader.Printf("\nSkipped %d recovered files %s\n", len(removed), knownReason(keep))
+		for _, manifest := range manifests {
+			if err := updateManifest(manifest, func(path string) (string, bool) { return path, !removed[path] }); err != nil {
+				return len(removed), err
+			}
+		}
+	}
+	return len(removed), err
+}
+
+// knownReason says why files were dropped by a hash set
+func knownReason(keep bool) string {
+	if keep {
+		return "not in the hash set"
+	}
+	return "in the hash set of known files"
+}
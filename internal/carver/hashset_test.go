@@ -0,0 +1,112 @@
+package carver
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func TestLoadHashSet(t *testing.T) {
+	dir := t.TempDir()
+	nsrl := filepath.Join(dir, "NSRLFile.txt")
+	sums := filepath.Join(dir, "known.sha256")
+	os.WriteFile(nsrl, []byte(`"SHA-1","MD5","CRC32","FileName","FileSize","ProductCode","OpSystemCode","SpecialCode"
+"000000206738748EDD92C4E3D2E823896700F849","392126E756571EBF112CB1C1CDEDF926","EBD105A0","I05002T2.PFB",98865,3095,"WIN",""
+`), 0644)
+	os.WriteFile(sums, []byte(`# sha256sum output
+9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08 *test.txt
+not a digest
+`), 0644)
+
+	set, err := LoadHashSet(nsrl, sums)
+	if err != nil {
+		t.Fatalf("LoadHashSet failed: %v", err)
+	}
+	if set.Len() != 3 {
+		t.Errorf("Expected 3 digests, got %d", set.Len())
+	}
+	for _, digest := range []string{
+		"000000206738748edd92c4e3d2e823896700f849",
+		"392126E756571EBF112CB1C1CDEDF926",
+		"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+	} {
+		if !set.Contains(digest) {
+			t.Errorf("Expected %s in the set", digest)
+		}
+	}
+	if set.Contains("EBD105A0") || set.Contains("d41d8cd98f00b204e9800998ecf8427e") {
+		t.Error("Expected only the listed MD5, SHA-1 and SHA-256 digests in the set")
+	}
+
+	if _, err := LoadHashSet(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Error("Expected an error for a missing hash set")
+	}
+}
+
+func TestKnownFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	photo := makeJPEG(t)
+	png := makePNG(t)
+	data := make([]byte, 64*1024)
+	copy(data, photo)
+	copy(data[32*1024:], png)
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	// The photo is known by its SHA-1, as in the NSRL
+	sum := sha1.Sum(photo)
+	list := filepath.Join(tmpDir, "known.txt")
+	os.WriteFile(list, []byte(hex.EncodeToString(sum[:])+"\n"), 0644)
+	set, err := LoadHashSet(list)
+	if err != nil {
+		t.Fatalf("LoadHashSet failed: %v", err)
+	}
+	if known, err := set.MatchFile(tmpFile, ""); err != nil || known {
+		t.Errorf("Expected the image not to be known (%v)", err)
+	}
+
+	sigs := []FileSignature{findSignature(t, "JPEG"), findSignature(t, "PNG")}
+	for _, tc := range []struct {
+		keep bool
+		want string
+	}{
+		{false, "PNG"},
+		{true, "JPEG"},
+	} {
+		outputDir := filepath.Join(tmpDir, tc.want)
+		opts := Options{Signatures: sigs, KnownFiles: set, KeepKnown: tc.keep}
+		n, err := Recover(reader, outputDir, false, opts)
+		if err != nil || n != 1 {
+			t.Errorf("Keep %v: expected 1 file, got %d (%v)", tc.keep, n, err)
+		}
+		if files, _ := filepath.Glob(filepath.Join(outputDir, "*", "*")); len(files) != 1 || filepath.Base(filepath.Dir(files[0])) != tc.want {
+			t.Errorf("Keep %v: expected only the %s written, got %v", tc.keep, tc.want, files)
+		}
+	}
+
+	// Filesystem recoveries are filtered after they are written
+	dir := filepath.Join(tmpDir, "fs")
+	os.MkdirAll(filepath.Join(dir, "Windows"), 0755)
+	os.WriteFile(filepath.Join(dir, "Windows", "logo.jpg"), photo, 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0644)
+	md5sum := md5.Sum([]byte("notes"))
+	set.add(hex.EncodeToString(md5sum[:]))
+	if n, err := DropKnownFiles(reader, dir, set, false); err != nil || n != 2 {
+		t.Errorf("Expected 2 known files dropped, got %d (%v)", n, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Windows", "logo.jpg")); !os.IsNotExist(err) {
+		t.Error("Expected the known photo to be removed")
+	}
+}
@@ -0,0 +1,318 @@
+package carver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// A recovered file's name is not always right: a deleted file's extension
+// may have been a lie to begin with, and a file recovered from clusters
+// that were reused holds another file's content. Identification reads the
+// start of every recovered file, names its format the way carving would,
+// and lists the files whose extension is missing or does not match:
+//
+//	path                       original                   format  problem
+//	filesystem/budget.docx.jpg filesystem/budget.docx     JPEG    extension .docx
+//	filesystem/History.sqlite  filesystem/History         SQLite  no extension
+//
+// With IdentifyRename the right extension is appended, keeping the original
+// name in front of it, and the paths in smart recovery reports follow.
+
+// IdentifyMode selects what identification does with the files it flags
+type IdentifyMode int
+
+const (
+	IdentifyOff    IdentifyMode = iota
+	IdentifyReport              // List them in IdentifyReportFile
+	IdentifyRename              // List them and append the right extension
+)
+
+// IdentifyReportFile lists the files identification flagged, below the
+// output directory
+const IdentifyReportFile = "identify.tsv"
+
+// identifyHeadSize is how much of a file is read to identify it
+const identifyHeadSize = 64 * 1024
+
+var (
+	// identifyAliases are the other extensions files of a format commonly
+	// have, by the extension the format's signature carves them with
+	identifyAliases = map[string][]string{
+		".jpg":    {".jpeg", ".jpe", ".jfif"},
+		".tiff":   {".tif", ".nef", ".nrw", ".arw", ".dng", ".cr2", ".pef", ".srw", ".erf", ".3fr", ".dcr", ".kdc", ".mos"},
+		".mp4":    {".m4v", ".m4a", ".m4b", ".mov", ".3gp", ".3g2", ".f4v", ".heic", ".heif", ".avif"},
+		".mov":    {".mp4", ".qt"},
+		".m4a":    {".m4b", ".mp4"},
+		".ts":     {".mts", ".m2ts"},
+		".mts":    {".m2ts", ".ts"},
+		".mp3":    {".mp2", ".mpga"},
+		".ogg":    {".oga", ".ogv", ".opus", ".spx"},
+		".mkv":    {".webm", ".mka", ".mk3d"},
+		".wmv":    {".wma", ".asf"},
+		".zip":    {".jar", ".apk", ".docx", ".xlsx", ".pptx", ".odt", ".ods", ".odp", ".epub", ".kmz", ".xpi", ".ipa", ".whl", ".nupkg", ".vsix", ".xps", ".3mf"},
+		".docx":   {".docm", ".dotx", ".dotm"},
+		".xlsx":   {".xlsm", ".xltx", ".xltm"},
+		".pptx":   {".pptm", ".potx", ".ppsx"},
+		".jar":    {".war", ".ear"},
+		".ole":    {".doc", ".xls", ".ppt", ".msg", ".msi", ".pub", ".vsd", ".dot", ".xlt", ".pot", ".db"},
+		".doc":    {".dot"},
+		".xls":    {".xlt", ".xla"},
+		".ppt":    {".pot", ".pps"},
+		".exe":    {".dll", ".sys", ".scr", ".com", ".ocx", ".cpl", ".efi", ".mui", ".drv"},
+		".elf":    {".so", ".o", ".ko", ".axf", ".bin"},
+		".sqlite": {".db", ".sqlite3", ".db3", ".sdb", ".s3db", ".sqlitedb"},
+		".hive":   {".dat", ".hve", ".sav"},
+		".db":     {".cache"},
+		".eml":    {".mht", ".txt"},
+		".mbox":   {".mbx", ".txt"},
+		".wallet": {".dat"},
+	}
+
+	// identifyBare are the formats whose files are often named without an
+	// extension (binaries, registry hives, browser databases, wallets), by
+	// their carved extension; a missing extension is not flagged for them
+	identifyBare = map[string]bool{
+		".elf": true, ".hive": true, ".sqlite": true, ".sqlite-wal": true, ".sqlite-journal": true,
+		".mbox": true, ".json": true, ".wallet": true,
+	}
+)
+
+// ParseIdentifyMode converts a -identify flag value to an IdentifyMode
+func ParseIdentifyMode(s string) (IdentifyMode, error) {
+	switch strings.ToLower(s) {
+	case "", "off":
+		return IdentifyOff, nil
+	case "report":
+		return IdentifyReport, nil
+	case "rename":
+		return IdentifyRename, nil
+	}
+	return IdentifyOff, fmt.Errorf("unknown identify mode %q (want off, report or rename)", s)
+}
+
+// IdentifyFile names the format of a file from its first bytes, as the
+// most specific built-in signature it starts with would carve it: the
+// format's name and extension, or "" when none matches
+func IdentifyFile(path string) (string, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", "", err
+	}
+	head := make([]byte, identifyHeadSize)
+	n, err := f.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return "", "", err
+	}
+	head = head[:n]
+
+	var best *FileSignature
+	for i := range Signatures {
+		sig := &Signatures[i]
+		// A short header alone matches too much by chance
+		if sig.Extension == "" || sig.Offset > len(head) || (len(sig.Header) < 3 && sig.Verify == nil) {
+			continue
+		}
+		if !sig.matchHeader(head[sig.Offset:]) || (sig.Verify != nil && !sig.Verify(head)) {
+			continue
+		}
+		// Formats built on another (DNG on TIFF) follow it in the list
+		if best == nil || len(sig.Header) >= len(best.Header) {
+			best = sig
+		}
+	}
+	if best == nil {
+		return "", "", nil
+	}
+	if best.Classify != nil {
+		if name, ext := best.Classify(f, info.Size()); ext != "" {
+			return name, ext, nil
+		}
+	}
+	return best.Name, best.Extension, nil
+}
+
+// extensionFits reports whether a file named with ext may hold a format
+// carved with the extension want
+func extensionFits(ext, want string) bool {
+	if ext == want {
+		return true
+	}
+	for _, alias := range identifyAliases[want] {
+		if ext == alias {
+			return true
+		}
+	}
+	return false
+}
+
+// Identify checks the extension of every file below dir against its
+// content, lists those missing one or with the wrong one in
+// IdentifyReportFile and, with IdentifyRename, appends the right one,
+// telling rep of each. It returns the number of files flagged.
+func Identify(dir string, mode IdentifyMode, rep disk.ProgressReporter) (int, error) {
+	if mode == IdentifyOff {
+		return 0, nil
+	}
+	type flagged struct {
+		path, original, format, problem string
+	}
+	var found []flagged
+	var reports, sessions, manifests []string
+	renamed := make(map[string]string) // Old path to new
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == GalleryDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch info.Name() {
+		case SmartReportFile:
+			reports = append(reports, path)
+			return nil
+		case SessionFile:
+			sessions = append(sessions, path)
+			return nil
+		case disk.ManifestJSON:
+			manifests = append(manifests, filepath.Dir(path))
+			return nil
+		case disk.ManifestSHA256:
+			return nil
+		}
+		if !info.Mode().IsRegular() || info.Name() == IdentifyReportFile || IsSidecar(info.Name()) {
+			return nil
+		}
+
+		name, want, err := IdentifyFile(path)
+		if err != nil {
+			printf(rep, "  Failed to identify %s: %v\n", path, err)
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		var problem string
+		switch {
+		case want == "" || extensionFits(ext, want):
+			return nil
+		case ext == "":
+			if identifyBare[want] {
+				return nil
+			}
+			problem = "no extension"
+		default:
+			problem = "extension " + ext
+		}
+
+		target := path
+		if mode == IdentifyRename {
+			target = path + want
+			if _, err := os.Lstat(target); err == nil {
+				printf(rep, "  Not renaming %s: %s exists\n", path, target)
+				target = path
+			} else if err := os.Rename(path, target); err != nil {
+				printf(rep, "  Failed to rename %s: %v\n", path, err)
+				target = path
+			} else {
+				renamed[path] = target
+				os.Rename(path+SidecarSuffix, target+SidecarSuffix) // Its sidecar, if it has one
+			}
+		}
+		rel, _ := filepath.Rel(dir, target)
+		original, _ := filepath.Rel(dir, path)
+		found = append(found, flagged{filepath.ToSlash(rel), filepath.ToSlash(original), name, problem})
+		printf(rep, "  %s is %s (%s)\n", original, name, problem)
+		return nil
+	})
+	if err != nil {
+		return len(found), err
+	}
+
+	for _, report := range reports {
+		if err := renameInReport(report, renamed); err != nil {
+			return len(found), err
+		}
+	}
+	for _, session := range sessions {
+		if err := renameInSession(session, renamed); err != nil {
+			return len(found), err
+		}
+	}
+	for _, manifest := range manifests {
+		err := updateManifest(manifest, func(path string) (string, bool) {
+			if target, ok := renamed[path]; ok {
+				return target, true
+			}
+			return path, true
+		})
+		if err != nil {
+			return len(found), err
+		}
+	}
+
+	out, err := os.Create(filepath.Join(dir, IdentifyReportFile))
+	if err != nil {
+		return len(found), err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	fmt.Fprintln(w, "path\toriginal\tformat\tproblem")
+	for _, f := range found {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.path, f.original, f.format, f.problem)
+	}
+	if err := w.Flush(); err != nil {
+		return len(found), err
+	}
+	printf(rep, "\nIdentified %d files whose extension does not match their content (%d renamed), listed in %s\n",
+		len(found), len(renamed), filepath.Join(dir, IdentifyReportFile))
+	return len(found), out.Close()
+}
+
+// printf tells rep of a message formatted as by fmt.Printf
+func printf(rep disk.ProgressReporter, format string, args ...any) {
+	rep.Message(fmt.Sprintf(format, args...))
+}
+
+// renameInReport updates the paths of renamed files in a smart recovery
+// report, which are relative to the report's directory
+func renameInReport(report string, renamed map[string]string) error {
+	if len(renamed) == 0 {
+		return nil
+	}
+	data, err := os.ReadFile(report)
+	if err != nil {
+		return err
+	}
+	base := filepath.Dir(report)
+	lines := strings.Split(string(data), "\n")
+	changed := false
+	for i, line := range lines[1:] {
+		path, rest, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		if target, ok := renamed[filepath.Join(base, filepath.FromSlash(path))]; ok {
+			if rel, err := filepath.Rel(base, target); err == nil {
+				lines[i+1] = filepath.ToSlash(rel) + "\t" + rest
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return os.WriteFile(report, []byte(strings.Join(lines, "\n")), 0644)
+}
@@ -0,0 +1,83 @@
+package carver
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func TestIdentify(t *testing.T) {
+	setup := func() string {
+		dir := t.TempDir()
+		files := map[string][]byte{
+			"JPEG/carved_000001.jpg":  makeJPEG(t),
+			"filesystem/budget.docx":  makeJPEG(t),
+			"filesystem/photo":        makePNG(t),
+			"filesystem/archive.docx": makeZIP(t),
+			"filesystem/notes.txt":    []byte("Nothing to see here\n"),
+			SmartReportFile:           []byte("path\tsource\toffset\tsize\tsha256\talso\nfilesystem/budget.docx\tfilesystem\t0\t1\tab\t\n"),
+		}
+		for name, data := range files {
+			path := filepath.Join(dir, name)
+			os.MkdirAll(filepath.Dir(path), 0755)
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatalf("Failed to write %s: %v", name, err)
+			}
+		}
+		return dir
+	}
+
+	dir := setup()
+	n, err := Identify(dir, IdentifyReport, disk.NewPrinter(io.Discard))
+	if err != nil || n != 2 {
+		t.Fatalf("Expected 2 files flagged, got %d (%v)", n, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "filesystem/budget.docx")); err != nil {
+		t.Error("Expected no renaming when only reporting")
+	}
+	report, _ := os.ReadFile(filepath.Join(dir, IdentifyReportFile))
+	if !strings.Contains(string(report), "filesystem/budget.docx\tfilesystem/budget.docx\tJPEG\textension .docx\n") {
+		t.Errorf("Expected the mismatch in the report, got:\n%s", report)
+	}
+
+	dir = setup()
+	if n, err := Identify(dir, IdentifyRename, disk.NewPrinter(io.Discard)); err != nil || n != 2 {
+		t.Fatalf("Expected 2 files flagged, got %d (%v)", n, err)
+	}
+	for _, name := range []string{"filesystem/budget.docx.jpg", "filesystem/photo.png", "filesystem/archive.docx", "filesystem/notes.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %s: %v", name, err)
+		}
+	}
+	report, _ = os.ReadFile(filepath.Join(dir, IdentifyReportFile))
+	if !strings.Contains(string(report), "filesystem/photo.png\tfilesystem/photo\tPNG\tno extension\n") {
+		t.Errorf("Expected the missing extension in the report, got:\n%s", report)
+	}
+	smart, _ := os.ReadFile(filepath.Join(dir, SmartReportFile))
+	if !strings.Contains(string(smart), "\nfilesystem/budget.docx.jpg\tfilesystem\t") {
+		t.Errorf("Expected the renamed path in the smart report, got:\n%s", smart)
+	}
+}
+
+func TestIdentifyFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, c := range []struct {
+		data      []byte
+		name, ext string
+	}{
+		{makeJPEG(t), "JPEG", ".jpg"},
+		{makePNG(t), "PNG", ".png"},
+		{[]byte("plain text"), "", ""},
+		{[]byte("BM"), "", ""},
+	} {
+		path := filepath.Join(dir, "file")
+		os.WriteFile(path, c.data, 0644)
+		if name, ext, err := IdentifyFile(path); err != nil || name != c.name || ext != c.ext {
+			t.Errorf("Expected %q %q, got %q %q (%v)", c.name, c.ext, name, ext, err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+	"io"
+)
+
+// Bifragment gap carving limits
+const (
+	gapBlockSize    = 512              // Fragments start and end on sector boundaries
+	maxGapWindow    = 32 * 1024 * 1024 // Bytes examined after the JPEG header
+	maxSplitBlocks  = 64               // Split points tried before the first corrupt byte
+	maxGapFooters   = 8                // Footer candidates tried for the second fragment
+	maxResumeBlocks = 8                // Continuation points tried after the last corrupt byte
+	maxGapAttempts  = 2048             // Upper bound on trial decodes per file
+)
+
+// RepairJPEG attempts bifragment gap carving for a JPEG whose contiguous
+// carving does not decode. Many deleted photos are split into two fragments
+// with unrelated data in between. The entropy-coded scan data is searched for
+// the first byte sequence that cannot occur in a JPEG, which places the end of
+// the first fragment shortly before it. Candidate split points and gap sizes
+// are then tested by decoding the reassembled image. On success the pieces are
+// stored in file.Fragments and true is returned.
+func (c *Carver) RepairJPEG(file *CarvedFile) (bool, error) {
+	window := min(file.Signature.MaxSize, maxGapWindow)
+	window = min(window, c.reader.Size()-file.Offset)
+	if window <= 0 {
+		return false, nil
+	}
+
+	data := make([]byte, window)
+	n, err := c.reader.ReadAt(data, file.Offset)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	data = data[:n]
+
+	sos := jpegScanStart(data)
+	if sos < 0 {
+		return false, nil
+	}
+	// Each attempt decodes the whole image, so its size is checked once
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil || checkDimensions(config) != nil {
+		return false, nil
+	}
+
+	firstBad := nextIllegalMarker(data, sos)
+	if firstBad < 0 {
+		return false, nil
+	}
+
+	// Footers after the corrupt region, each with the last corrupt byte before it
+	type footer struct{ end, lastBad int }
+	var footers []footer
+	lastBad := firstBad
+	for pos := firstBad; len(footers) < maxGapFooters; {
+		idx := bytes.Index(data[pos:], []byte{0xFF, 0xD9})
+		if idx < 0 {
+			break
+		}
+		end := pos + idx
+		for bad := nextIllegalMarker(data[:end], lastBad+1); bad >= 0; bad = nextIllegalMarker(data[:end], bad+1) {
+			lastBad = bad
+		}
+		footers = append(footers, footer{end: end + 2, lastBad: lastBad})
+		pos = end + 2
+	}
+
+	align := func(pos int) int {
+		abs := file.Offset + int64(pos)
+		return pos - int(abs%gapBlockSize)
+	}
+
+	attempts := 0
+	candidate := make([]byte, 0, len(data))
+
+	// Split points closest to the corruption first: a split that is too late
+	// keeps foreign bytes and fails, one that is too early loses image data
+	for split, tried := align(firstBad), 0; split > sos && tried < maxSplitBlocks; split, tried = split-gapBlockSize, tried+1 {
+		for _, f := range footers {
+			resume := align(f.lastBad) + gapBlockSize
+			for r := 0; r < maxResumeBlocks && resume < f.end; r, resume = r+1, resume+gapBlockSize {
+				if resume <= split {
+					continue
+				}
+				if attempts++; attempts > maxGapAttempts {
+					return false, nil
+				}
+
+				candidate = append(append(candidate[:0], data[:split]...), data[resume:f.end]...)
+				if _, err := jpeg.Decode(bytes.NewReader(candidate)); err == nil {
+					file.Fragments = []Fragment{
+						{Offset: file.Offset, Length: int64(split)},
+						{Offset: file.Offset + int64(resume), Length: int64(f.end - resume)},
+					}
+					file.Size = int64(len(candidate))
+					return true, nil
+				}
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// jpegScanStart walks the marker segments of a JPEG and returns the offset of
+// the first entropy-coded byte after the first SOS segment, or -1
+func jpegScanStart(data []byte) int {
+	pos := 2 // Skip SOI
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return -1
+		}
+		marker := data[pos+1]
+		if marker == 0xFF { // Fill byte
+			pos++
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 {
+			return -1
+		}
+		pos += 2 + length
+		if marker == 0xDA {
+			if pos > len(data) {
+				return -1
+			}
+			return pos
+		}
+	}
+	return -1
+}
+
+// nextIllegalMarker returns the position of the first 0xFF at or after start
+// that is followed by a byte which cannot appear in JPEG scan data, or -1.
+// Stuffed zeros, restart markers, EOI and the segments found between
+// progressive scans are all legal.
+func nextIllegalMarker(data []byte, start int) int {
+	for i := start; i+1 < len(data); i++ {
+		if data[i] != 0xFF {
+			continue
+		}
+		switch next := data[i+1]; {
+		case next == 0x00, next == 0xFF, next >= 0xD0 && next <= 0xD7, next == 0xD9:
+		case next == 0xC4, next == 0xCC, next == 0xDA, next == 0xDB, next == 0xDD, next == 0xFE:
+		default:
+			return i
+		}
+	}
+	return -1
+}
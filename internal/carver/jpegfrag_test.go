@@ -0,0 +1,106 @@
+package carver
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func makeNoisyJPEG(t *testing.T) []byte {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, 96, 96))
+	rng.Read(img.Pix)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRepairJPEG(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	jpg := makeNoisyJPEG(t)
+	split := 8 * gapBlockSize
+	if len(jpg) < split+4*gapBlockSize {
+		t.Fatalf("Test JPEG too small: %d bytes", len(jpg))
+	}
+
+	// First fragment, three blocks of unrelated data, second fragment
+	gap := make([]byte, 3*gapBlockSize)
+	rand.New(rand.NewSource(2)).Read(gap)
+
+	data := make([]byte, 0, 256*1024)
+	data = append(data, jpg[:split]...)
+	data = append(data, gap...)
+	data = append(data, jpg[split:]...)
+	data = append(data, make([]byte, 256*1024-len(data))...)
+
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	carver := NewCarver(reader)
+	sig := findSignature(t, "JPEG")
+	file := CarvedFile{Signature: &sig, Offset: 0}
+
+	if err := carver.Validate(&file); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if file.Verdict != Invalid {
+		t.Fatalf("Expected contiguous carving to be invalid, got %s", file.Verdict)
+	}
+
+	repaired, err := carver.RepairJPEG(&file)
+	if err != nil {
+		t.Fatalf("RepairJPEG failed: %v", err)
+	}
+	if !repaired {
+		t.Fatal("Expected JPEG to be reassembled")
+	}
+
+	want := []Fragment{
+		{Offset: 0, Length: int64(split)},
+		{Offset: int64(split + len(gap)), Length: int64(len(jpg) - split)},
+	}
+	if len(file.Fragments) != 2 || file.Fragments[0] != want[0] || file.Fragments[1] != want[1] {
+		t.Errorf("Expected fragments %v, got %v", want, file.Fragments)
+	}
+
+	path, err := carver.RecoverFile(file, outputDir, 0)
+	if err != nil {
+		t.Fatalf("RecoverFile failed: %v", err)
+	}
+	recovered, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read recovered file: %v", err)
+	}
+	if !bytes.Equal(recovered, jpg) {
+		t.Errorf("Reassembled JPEG differs from original (%d vs %d bytes)", len(recovered), len(jpg))
+	}
+}
+
+func TestNextIllegalMarker(t *testing.T) {
+	data := []byte{0x12, 0xFF, 0x00, 0xFF, 0xD3, 0x34, 0xFF, 0x17, 0xFF, 0xD9}
+	if got := nextIllegalMarker(data, 0); got != 6 {
+		t.Errorf("Expected illegal marker at 6, got %d", got)
+	}
+	if got := nextIllegalMarker(data, 7); got != -1 {
+		t.Errorf("Expected no illegal marker after 7, got %d", got)
+	}
+}
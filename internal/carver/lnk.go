@@ -0,0 +1,240 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// Windows shortcut (.lnk) files ([MS-SHLLINK]) record the path of the file
+// they point to, so a carved shortcut shows what was on the system even when
+// the target itself is gone. Jump lists (automaticDestinations-ms) are OLE
+// compound files holding one shortcut per stream plus a "DestList" stream.
+
+// LinkFlags that select the optional structures after the header
+const (
+	lnkHasTargetIDList = 1 << iota
+	lnkHasLinkInfo
+	lnkHasName
+	lnkHasRelativePath
+	lnkHasWorkingDir
+	lnkHasArguments
+	lnkHasIconLocation
+	lnkIsUnicode
+)
+
+const (
+	lnkHeaderSize = 0x4C
+	lnkMaxSize    = 1024 * 1024
+)
+
+// lnkCLSID is the shell link class ID that follows the header size
+var lnkCLSID = []byte{0x01, 0x14, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0xC0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46}
+
+// shellLink holds the parts of a shortcut reported for a carved file
+type shellLink struct {
+	size       int64
+	target     string
+	arguments  string
+	workingDir string
+}
+
+// parseLNK walks a shortcut's structures to find its length and target
+func parseLNK(data []byte) (*shellLink, bool) {
+	if len(data) < lnkHeaderSize || binary.LittleEndian.Uint32(data) != lnkHeaderSize {
+		return nil, false
+	}
+	flags := binary.LittleEndian.Uint32(data[20:])
+	link := &shellLink{}
+	pos := lnkHeaderSize
+
+	if flags&lnkHasTargetIDList != 0 {
+		if pos+2 > len(data) {
+			return nil, false
+		}
+		pos += 2 + int(binary.LittleEndian.Uint16(data[pos:]))
+	}
+
+	if flags&lnkHasLinkInfo != 0 {
+		if pos+4 > len(data) {
+			return nil, false
+		}
+		size := int(binary.LittleEndian.Uint32(data[pos:]))
+		if size < 0x1C || pos+size > len(data) {
+			return nil, false
+		}
+		link.target = linkInfoPath(data[pos : pos+size])
+		pos += size
+	}
+
+	// StringData: each present string is a character count and the characters
+	charSize := 1
+	if flags&lnkIsUnicode != 0 {
+		charSize = 2
+	}
+	var relativePath string
+	for _, flag := range []uint32{lnkHasName, lnkHasRelativePath, lnkHasWorkingDir, lnkHasArguments, lnkHasIconLocation} {
+		if flags&flag == 0 {
+			continue
+		}
+		if pos+2 > len(data) {
+			return nil, false
+		}
+		n := int(binary.LittleEndian.Uint16(data[pos:])) * charSize
+		if pos+2+n > len(data) {
+			return nil, false
+		}
+		value := decodeLinkString(data[pos+2:pos+2+n], charSize == 2)
+		switch flag {
+		case lnkHasRelativePath:
+			relativePath = value
+		case lnkHasWorkingDir:
+			link.workingDir = value
+		case lnkHasArguments:
+			link.arguments = value
+		}
+		pos += 2 + n
+	}
+
+	// ExtraData blocks end with a terminal block smaller than 4 bytes
+	for {
+		if pos+4 > len(data) {
+			return nil, false
+		}
+		size := int(binary.LittleEndian.Uint32(data[pos:]))
+		if size < 4 {
+			pos += 4
+			break
+		}
+		pos += size
+	}
+
+	if link.target == "" {
+		link.target = relativePath
+	}
+	link.size = int64(pos)
+	return link, true
+}
+
+// linkInfoPath builds the target path from a LinkInfo structure: the local
+// base path or network share name followed by the common path suffix
+func linkInfoPath(info []byte) string {
+	u32 := func(off int) int { return int(binary.LittleEndian.Uint32(info[off:])) }
+	headerSize := u32(4)
+	flags := u32(8)
+
+	str := func(off int, unicode bool) string {
+		if off <= 0 || off >= len(info) {
+			return ""
+		}
+		b := info[off:]
+		if unicode {
+			for i := 0; i+1 < len(b); i += 2 {
+				if b[i] == 0 && b[i+1] == 0 {
+					return decodeLinkString(b[:i], true)
+				}
+			}
+			return ""
+		}
+		if end := bytes.IndexByte(b, 0); end >= 0 {
+			return string(b[:end])
+		}
+		return ""
+	}
+
+	var base, suffix string
+	if headerSize >= 0x24 && len(info) >= 0x24 {
+		base = str(u32(28), true)
+		suffix = str(u32(32), true)
+	}
+	if base == "" && flags&0x1 != 0 { // VolumeIDAndLocalBasePath
+		base = str(u32(16), false)
+	}
+	if base == "" && flags&0x2 != 0 { // CommonNetworkRelativeLinkAndPathSuffix
+		if netOff := u32(20); netOff > 0 && netOff+12 <= len(info) {
+			base = str(netOff+int(binary.LittleEndian.Uint32(info[netOff+8:])), false)
+		}
+	}
+	if suffix == "" {
+		suffix = str(u32(24), false)
+	}
+
+	if base != "" && suffix != "" && !strings.HasSuffix(base, `\`) {
+		return base + `\` + suffix
+	}
+	return base + suffix
+}
+
+// decodeLinkString decodes a UTF-16LE or ANSI string
+func decodeLinkString(b []byte, unicode bool) string {
+	if !unicode {
+		return string(b)
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
+
+// readLNK parses the shortcut at the start of r
+func readLNK(r io.ReaderAt, limit int64) (*shellLink, bool) {
+	buf := make([]byte, min(limit, lnkMaxSize))
+	n, err := r.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return nil, false
+	}
+	return parseLNK(buf[:n])
+}
+
+// lnkSize sizes a shortcut by walking its structures
+func lnkSize(r io.ReaderAt, limit int64) int64 {
+	if link, ok := readLNK(r, limit); ok {
+		return link.size
+	}
+	return 0
+}
+
+// lnkMetadata reports a shortcut's target, arguments and working directory
+func lnkMetadata(r io.ReaderAt, size int64) map[string]string {
+	link, ok := readLNK(r, size)
+	if !ok {
+		return nil
+	}
+	meta := make(map[string]string)
+	for key, value := range map[string]string{"target": link.target, "arguments": link.arguments, "working_dir": link.workingDir} {
+		if value != "" {
+			meta[key] = value
+		}
+	}
+	return meta
+}
+
+// jumpListTargets returns the targets of the shortcuts stored in a jump
+// list's numbered streams
+func jumpListTargets(f *cfbFile) []string {
+	entries := f.entries()
+	var root cfbEntry
+	for _, e := range entries {
+		if e.typ == 5 {
+			root = e
+		}
+	}
+
+	var targets []string
+	for _, e := range entries {
+		if e.typ != 2 || e.name == "DestList" {
+			continue
+		}
+		data, ok := f.readStream(e, root)
+		if !ok {
+			continue
+		}
+		if link, ok := parseLNK(data); ok && link.target != "" {
+			targets = append(targets, link.target)
+		}
+	}
+	return targets
+}
@@ -0,0 +1,81 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+)
+
+// makeLNK builds a Unicode shortcut with a LinkInfo local base path, a
+// working directory and an empty ExtraData section
+func makeLNK(target, workingDir string) []byte {
+	le := binary.LittleEndian
+	lnk := make([]byte, lnkHeaderSize)
+	le.PutUint32(lnk, lnkHeaderSize)
+	copy(lnk[4:], lnkCLSID)
+	le.PutUint32(lnk[20:], lnkHasLinkInfo|lnkHasWorkingDir|lnkIsUnicode)
+
+	// LinkInfo with a 0x1C byte header, the ANSI base path and an empty suffix
+	info := make([]byte, 0x1C)
+	le.PutUint32(info[4:], 0x1C)
+	le.PutUint32(info[8:], 0x1)                         // VolumeIDAndLocalBasePath
+	le.PutUint32(info[16:], 0x1C)                       // LocalBasePathOffset
+	le.PutUint32(info[24:], uint32(0x1C+len(target)+1)) // CommonPathSuffixOffset
+	info = append(info, target...)
+	info = append(info, 0, 0)
+	le.PutUint32(info, uint32(len(info)))
+	lnk = append(lnk, info...)
+
+	dir := utf16.Encode([]rune(workingDir))
+	lnk = le.AppendUint16(lnk, uint16(len(dir)))
+	for _, c := range dir {
+		lnk = le.AppendUint16(lnk, c)
+	}
+
+	return le.AppendUint32(lnk, 0) // Terminal block
+}
+
+func TestParseLNK(t *testing.T) {
+	lnk := makeLNK(`C:\Users\alice\Documents\plan.docx`, `C:\Users\alice`)
+	data := append(append([]byte{}, lnk...), bytes.Repeat([]byte{0xCC}, 500)...)
+
+	link, ok := parseLNK(data)
+	if !ok {
+		t.Fatal("parseLNK failed")
+	}
+	if link.size != int64(len(lnk)) {
+		t.Errorf("Expected size %d, got %d", len(lnk), link.size)
+	}
+	if link.target != `C:\Users\alice\Documents\plan.docx` {
+		t.Errorf("Unexpected target %q", link.target)
+	}
+
+	meta := lnkMetadata(bytes.NewReader(lnk), int64(len(lnk)))
+	if meta["target"] != link.target || meta["working_dir"] != `C:\Users\alice` {
+		t.Errorf("Unexpected metadata %v", meta)
+	}
+
+	if _, ok := parseLNK(lnk[:len(lnk)-2]); ok {
+		t.Error("Expected truncated shortcut to fail")
+	}
+}
+
+// makeJumpList builds a compound file holding a shortcut stream "1" and a
+// DestList stream
+func makeJumpList(lnk []byte) []byte {
+	return makeMiniCFB([2]string{"1", string(lnk)}, [2]string{"DestList", string(make([]byte, 32))})
+}
+
+func TestJumpList(t *testing.T) {
+	lnk := makeLNK(`D:\Projects\budget.xlsx`, `D:\Projects`)
+	jl := makeJumpList(lnk)
+
+	if name, ext := classifyCFB(bytes.NewReader(jl), int64(len(jl))); name != "JUMPLIST" || ext != ".automaticDestinations-ms" {
+		t.Errorf("Expected jump list, got %q, %q", name, ext)
+	}
+	meta := cfbMetadata(bytes.NewReader(jl), int64(len(jl)))
+	if meta["targets"] != `D:\Projects\budget.xlsx` {
+		t.Errorf("Expected jump list target, got %v", meta)
+	}
+}
@@ -0,0 +1,114 @@
+package carver
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// writeManifest writes the hash manifests of the files a run recovered to
+// outputDir: files recovered by name, with paths below outputDir, and the
+// carved files written. Carvings resumed from a checkpoint were digested by
+// an earlier run, which kept only their SHA-256, so they are digested again.
+// When the reader verifies its output, the files are verified first.
+func writeManifest(reader *disk.Reader, outputDir string, files []Recovered, carved []CarvedFile) error {
+	var entries []disk.ManifestEntry
+	var sources []func() (disk.Digest, error) // Read each file again
+	for _, f := range files {
+		entries = append(entries, disk.ManifestEntry{
+			Path:     filepath.ToSlash(f.Path),
+			Original: filepath.ToSlash(f.Original),
+			Status:   reader.OutputStatus(),
+			Digest:   disk.Digest{Size: f.Size, MD5: f.MD5, SHA256: f.SHA256},
+		})
+		sources = append(sources, f.reread)
+	}
+	for _, c := range carved {
+		if c.Path == "" {
+			continue
+		}
+		rel, err := filepath.Rel(outputDir, c.Path)
+		if err != nil {
+			rel = c.Path
+		}
+		digest := disk.Digest{Size: c.Size, MD5: c.MD5, SHA256: c.SHA256}
+		if digest.MD5 == "" {
+			if digest, err = digestFile(reader, c.Path); err != nil {
+				return err
+			}
+		}
+		entries = append(entries, disk.ManifestEntry{Path: filepath.ToSlash(rel), Status: reader.OutputStatus(), Digest: digest})
+		sources = append(sources, func() (disk.Digest, error) {
+			return carvedDigest(reader, c)
+		})
+	}
+	if reader.Verifying() {
+		reader.Verify(outputDir, entries, func(i int) (disk.Digest, error) {
+			if sources[i] == nil {
+				return disk.Digest{}, errors.New("source not known")
+			}
+			return sources[i]()
+		})
+	}
+	return disk.WriteManifest(outputDir, entries)
+}
+
+// carvedDigest digests the content of a carved file read again from the
+// disk
+func carvedDigest(reader *disk.Reader, file CarvedFile) (disk.Digest, error) {
+	var content io.ReaderAt = reader
+	offset := file.Offset
+	if len(file.Fragments) > 0 {
+		content, offset = &fragmentReader{r: reader, fragments: file.Fragments}, 0
+	}
+	w := disk.NewDigestWriter(io.Discard)
+	_, err := io.Copy(w, io.NewSectionReader(content, offset, file.Size))
+	return w.Digest(), err
+}
+
+// digestFile digests the content of a file recovered from reader
+func digestFile(reader *disk.Reader, path string) (disk.Digest, error) {
+	f, err := reader.OpenOutput(path)
+	if err != nil {
+		return disk.Digest{}, err
+	}
+	defer f.Close()
+	w := disk.NewDigestWriter(io.Discard)
+	if _, err := io.Copy(w, f); err != nil {
+		return disk.Digest{}, err
+	}
+	return w.Digest(), nil
+}
+
+// updateManifest rewrites the hash manifests in dir after files below it
+// were renamed or removed: update returns the new path of a file, or false
+// to drop it
+func updateManifest(dir string, update func(path string) (string, bool)) error {
+	entries, err := disk.LoadManifest(dir)
+	if err != nil {
+		return err
+	}
+	kept := entries[:0]
+	changed := false
+	for _, e := range entries {
+		path := filepath.Join(dir, filepath.FromSlash(e.Path))
+		moved, ok := update(path)
+		if !ok {
+			changed = true
+			continue
+		}
+		if moved != path {
+			if rel, err := filepath.Rel(dir, moved); err == nil {
+				e.Path = filepath.ToSlash(rel)
+				changed = true
+			}
+		}
+		kept = append(kept, e)
+	}
+	if !changed {
+		return nil
+	}
+	return disk.WriteManifest(dir, kept)
+}
@@ -0,0 +1,89 @@
+package carver
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func TestSmartRecoverManifest(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	// A deleted PHOTO.JPG in cluster 5 and a PNG nothing lists in cluster 9
+	volume := makeFAT32(16, 2)
+	dataStart := 34 * 512
+	cluster := func(c int) int { return dataStart + (c-2)*4096 }
+	photo := makeJPEG(t)
+	png := makePNG(t)
+	copy(volume[cluster(2):], []byte("\xE5HOTO   JPG"))
+	volume[cluster(2)+26] = 5
+	volume[cluster(2)+28] = byte(len(photo))
+	volume[cluster(2)+29] = byte(len(photo) >> 8)
+	copy(volume[cluster(5):], photo)
+	copy(volume[cluster(9):], png)
+
+	if err := os.WriteFile(tmpFile, volume, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	outputDir := filepath.Join(tmpDir, "out")
+	opts := Options{Signatures: []FileSignature{findSignature(t, "JPEG"), findSignature(t, "PNG")}, Manifest: true}
+	if _, err := SmartRecover(reader, outputDir, false, opts); err != nil {
+		t.Fatalf("SmartRecover failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, SmartCarvedDir, disk.ManifestJSON)); !os.IsNotExist(err) {
+		t.Error("Expected one manifest for the whole recovery")
+	}
+
+	entries, err := disk.LoadManifest(outputDir)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("Expected 2 files in the manifest, got %+v (%v)", entries, err)
+	}
+	photoSum := md5.Sum(photo)
+	if e := entries[0]; e.Path != "filesystem/_HOTO.JPG" || e.Original != "filesystem/?HOTO.JPG" || e.MD5 != hex.EncodeToString(photoSum[:]) || e.Size != int64(len(photo)) {
+		t.Errorf("Unexpected photo entry %+v", e)
+	}
+	for _, e := range entries {
+		if digest, err := digestFile(reader, filepath.Join(outputDir, e.Path)); err != nil || digest != e.Digest {
+			t.Errorf("%s: manifest says %+v, the copy is %+v (%v)", e.Path, e.Digest, digest, err)
+		}
+	}
+
+	// Renamed copies keep their digests
+	pngPath := filepath.Join(outputDir, filepath.FromSlash(entries[1].Path))
+	err = updateManifest(outputDir, func(path string) (string, bool) {
+		if path == pngPath {
+			return path + ".png", true
+		}
+		return path, true
+	})
+	if entries, _ = disk.LoadManifest(outputDir); err != nil || entries[1].Path != filepath.ToSlash(filepath.Join(SmartCarvedDir, "PNG", filepath.Base(pngPath)+".png")) {
+		t.Errorf("Expected the renamed PNG, got %+v (%v)", entries, err)
+	}
+
+	// Known files dropped after the recovery leave the manifest
+	sum := sha1.Sum(photo)
+	list := filepath.Join(tmpDir, "known.txt")
+	os.WriteFile(list, []byte(hex.EncodeToString(sum[:])+"\n"), 0644)
+	set, err := LoadHashSet(list)
+	if err != nil {
+		t.Fatalf("LoadHashSet failed: %v", err)
+	}
+	if n, err := DropKnownFiles(reader, outputDir, set, false); err != nil || n != 1 {
+		t.Errorf("Expected 1 known file dropped, got %d (%v)", n, err)
+	}
+	if entries, err = disk.LoadManifest(outputDir); err != nil || len(entries) != 1 || entries[0].SHA256 == "" {
+		t.Errorf("Expected only the PNG left in the manifest, got %+v (%v)", entries, err)
+	}
+}
@@ -0,0 +1,124 @@
+package carver
+
+import "io"
+
+// MP3 audio is a run of MPEG Layer III frames with no overall header. Each
+// frame starts with a 4-byte header whose version, bitrate, sample rate and
+// padding bit give the frame's length, so the stream is sized by stepping
+// from frame to frame until a header no longer fits. An ID3v2 tag may come
+// before the frames and a 128-byte ID3v1 tag after them.
+
+// Layer III bitrates in kbit/s by header index, for MPEG-1 and for MPEG-2
+// and 2.5, and sample rates in Hz by version index (2.5, reserved, 2, 1)
+var (
+	mp3Bitrates = [2][16]int{
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	}
+	mp3SampleRates = [4][4]int{
+		{11025, 12000, 8000, 0},
+		{},
+		{22050, 24000, 16000, 0},
+		{44100, 48000, 32000, 0},
+	}
+)
+
+const (
+	mp3CheckFrames = 4   // Frames verifyMP3 wants back to back when they are in the buffer
+	id3v1Size      = 128 // "TAG" and fixed-size fields after the last frame
+)
+
+// mp3Frame returns the length of the Layer III frame whose header starts
+// data, or 0 if the header is not valid, and the stream format (version,
+// CRC flag and sample rate) that every frame of a stream shares
+func mp3Frame(data []byte) (int, int) {
+	if len(data) < 4 || data[0] != 0xFF || data[1]&0xE0 != 0xE0 {
+		return 0, 0
+	}
+	version := (data[1] >> 3) & 0x03
+	if version == 1 || (data[1]>>1)&0x03 != 1 { // Reserved version, or not Layer III
+		return 0, 0
+	}
+	table, scale := 0, 144
+	if version != 3 {
+		table, scale = 1, 72 // MPEG-2 and 2.5 frames hold half the samples
+	}
+	bitrate := mp3Bitrates[table][data[2]>>4]
+	sampleRate := mp3SampleRates[version][(data[2]>>2)&0x03]
+	if bitrate == 0 || sampleRate == 0 || data[3]&0x03 == 0x02 { // Reserved emphasis
+		return 0, 0
+	}
+	padding := int(data[2]>>1) & 0x01
+	return scale*bitrate*1000/sampleRate + padding, int(data[1])<<8 | int(data[2]&0x0C)
+}
+
+// mp3FrameLength returns the length of the Layer III frame whose header
+// starts data, or 0 if the header is not valid
+func mp3FrameLength(data []byte) int {
+	length, _ := mp3Frame(data)
+	return length
+}
+
+// id3Size returns the length of the ID3v2 tag whose header starts data,
+// including the footer when the flags announce one
+func id3Size(data []byte) int64 {
+	var size int64
+	for _, b := range data[6:10] { // Syncsafe: 7 bits per byte
+		size = size<<7 | int64(b&0x7F)
+	}
+	size += 10 // The header itself
+	if data[5]&0x10 != 0 {
+		size += 10
+	}
+	return size
+}
+
+// mp3Frames steps from pos over the frames that share the first one's
+// format, returning the offset past the last and the number of frames
+func mp3Frames(r io.ReaderAt, pos, limit int64) (int64, int) {
+	buf := make([]byte, 64*1024)
+	var frames, format int
+	for pos < limit {
+		n, _ := r.ReadAt(buf[:min(int64(len(buf)), limit-pos)], pos)
+		i := 0
+		for i+4 <= n {
+			length, f := mp3Frame(buf[i:])
+			if length == 0 || (frames > 0 && f != format) || pos+int64(i+length) > limit {
+				return pos + int64(i), frames
+			}
+			format = f
+			frames++
+			i += length
+		}
+		if i == 0 {
+			break
+		}
+		pos += int64(i)
+	}
+	return pos, frames
+}
+
+// mp3Size skips an ID3v2 tag, steps over the frames and takes in an ID3v1
+// tag after them
+func mp3Size(r io.ReaderAt, limit int64) int64 {
+	var start int64
+	hdr := make([]byte, 10)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return 0
+	}
+	if string(hdr[:3]) == "ID3" {
+		start = id3Size(hdr)
+	}
+
+	end, frames := mp3Frames(r, start, limit)
+	if frames == 0 {
+		return 0
+	}
+	tag := make([]byte, 3)
+	if end+id3v1Size <= limit {
+		if _, err := r.ReadAt(tag, end); err == nil && string(tag) == "TAG" {
+			end += id3v1Size
+		}
+	}
+	return end
+}
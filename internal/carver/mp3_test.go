@@ -0,0 +1,111 @@
+package carver
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// makeMP3 builds a stream of count frames with the given header, each
+// filled with its index
+func makeMP3(header []byte, count int) []byte {
+	var stream []byte
+	for i := 0; i < count; i++ {
+		frame := bytes.Repeat([]byte{byte(i)}, mp3FrameLength(header))
+		copy(frame, header)
+		stream = append(stream, frame...)
+	}
+	return stream
+}
+
+// makeID3 builds an ID3v2.3 tag with a body of the given size
+func makeID3(body int) []byte {
+	tag := []byte{'I', 'D', '3', 3, 0, 0, byte(body >> 21 & 0x7F), byte(body >> 14 & 0x7F), byte(body >> 7 & 0x7F), byte(body & 0x7F)}
+	return append(tag, bytes.Repeat([]byte{0x20}, body)...)
+}
+
+func TestMP3Frame(t *testing.T) {
+	// MPEG-2 Layer III, 64 kbit/s, 22.05 kHz: 72 * 64000 / 22050 bytes
+	if got := mp3FrameLength([]byte{0xFF, 0xF3, 0x80, 0x64}); got != 208 {
+		t.Errorf("Expected MPEG-2 frame length 208, got %d", got)
+	}
+	// Layer II is not MP3
+	if got := mp3FrameLength([]byte{0xFF, 0xFD, 0x90, 0x64}); got != 0 {
+		t.Errorf("Expected Layer II to be rejected, got %d", got)
+	}
+
+	// A frame of another sample rate ends the stream
+	stream := append(makeMP3([]byte{0xFF, 0xFB, 0x90, 0x64}, 3), makeMP3([]byte{0xFF, 0xFB, 0x94, 0x64}, 3)...)
+	if verifyMP3(stream) {
+		t.Error("Expected frames of mixed sample rates to be rejected")
+	}
+}
+
+func TestMP3Size(t *testing.T) {
+	frames := makeMP3([]byte{0xFF, 0xFB, 0x90, 0x64}, 30)
+	frames = append(frames, makeMP3([]byte{0xFF, 0xFB, 0x92, 0x64}, 5)...) // Padded frames
+	id3v1 := append([]byte("TAG"), make([]byte, id3v1Size-3)...)
+
+	for _, tc := range []struct {
+		name string
+		file []byte
+	}{
+		{"bare", frames},
+		{"tagged", append(append(makeID3(300), frames...), id3v1...)},
+	} {
+		data := append(append([]byte{}, tc.file...), bytes.Repeat([]byte{0x00}, 5000)...)
+		if got := mp3Size(bytes.NewReader(data), int64(len(data))); got != int64(len(tc.file)) {
+			t.Errorf("%s: expected size %d, got %d", tc.name, len(tc.file), got)
+		}
+	}
+
+	if !verifyID3(append(makeID3(300), frames...)) {
+		t.Error("Expected tag followed by a frame to verify")
+	}
+	if verifyID3(append(makeID3(300), make([]byte, 100)...)) {
+		t.Error("Expected tag followed by zeros to be rejected")
+	}
+}
+
+func TestCarveMP3(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	song := append(makeID3(200), makeMP3([]byte{0xFF, 0xFB, 0x90, 0x64}, 40)...)
+	data := make([]byte, 128*1024)
+	copy(data[4096:], song)
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	var sigs []FileSignature
+	for _, sig := range Signatures {
+		if sig.Name == "MP3" {
+			sigs = append(sigs, sig)
+		}
+	}
+	carver := NewCarver(reader)
+	carver.SetSignatures(sigs)
+	files, err := carver.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	// Every frame is a hit, but they all belong to the one song
+	files = carver.dropContained(files)
+	if len(files) != 1 || files[0].Offset != 4096 {
+		t.Fatalf("Expected one MP3 at 4096, got %v", files)
+	}
+	if _, size, err := carver.content(files[0]); err != nil || size != int64(len(song)) {
+		t.Errorf("Expected %d bytes, got %d (%v)", len(song), size, err)
+	}
+}
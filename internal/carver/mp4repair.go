@@ -0,0 +1,641 @@
+package carver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// Cameras write the sample data (mdat) as they record and the index players
+// need (moov) when they stop, usually at the end of the file. When that end
+// is overwritten the carving is an mdat nothing can play. The video in it is
+// a run of H.264 or HEVC NAL units, each prefixed with its 4-byte length, so
+// the index is rebuilt by walking the NAL units, grouping them into samples
+// at each new picture and skipping the audio chunks in between. The codec
+// settings and frame rate come from a reference file recorded by the same
+// camera with the same settings or, for H.264, from the parameter sets that
+// some cameras repeat in the stream. The audio track is not rebuilt.
+
+const (
+	mp4ResyncLimit = 1024 * 1024 // Gap without video after which the stream is taken to have ended
+	mp4Timescale   = 30000       // Frame rate assumed without a reference: 29.97 fps
+	mp4FrameDelta  = 1001
+)
+
+// MP4Reference holds the video track settings of an intact recording
+type MP4Reference struct {
+	stsd          []byte // Sample description box payload
+	codec         string // Sample entry type, such as "avc1"
+	timescale     uint32
+	delta         uint32 // Duration of a sample in timescale units
+	width, height uint32 // 16.16 fixed point
+}
+
+// LoadMP4Reference reads the video track settings of an intact MP4 or MOV
+// file from the same camera
+func LoadMP4Reference(path string) (*MP4Reference, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	ref, ok := mp4Reference(f, info.Size())
+	if !ok {
+		return nil, fmt.Errorf("%s: no H.264 or HEVC video track", path)
+	}
+	return ref, nil
+}
+
+// mp4Reference takes the settings from the first video track of a movie
+func mp4Reference(r io.ReaderAt, size int64) (*MP4Reference, bool) {
+	moov, ok := bmffChild(r, 0, size, "moov")
+	if !ok {
+		return nil, false
+	}
+	for _, trak := range bmffChildren(r, moov.start, moov.end) {
+		if trak.typ != "trak" {
+			continue
+		}
+		boxes := make(map[string][]byte)
+		var box bmffBox
+		for _, path := range [][]string{{"tkhd"}, {"mdia", "hdlr"}, {"mdia", "mdhd"}, {"mdia", "minf", "stbl", "stsd"}, {"mdia", "minf", "stbl", "stts"}} {
+			box, ok = trak, true
+			for _, typ := range path {
+				if box, ok = bmffChild(r, box.start, box.end, typ); !ok {
+					break
+				}
+			}
+			if !ok || box.end-box.start > 64*1024 {
+				break
+			}
+			payload := make([]byte, box.end-box.start)
+			if _, err := r.ReadAt(payload, box.start); err != nil {
+				break
+			}
+			boxes[box.typ] = payload
+		}
+		if len(boxes) < 5 || len(boxes["hdlr"]) < 12 || string(boxes["hdlr"][8:12]) != "vide" {
+			continue
+		}
+
+		ref := &MP4Reference{stsd: boxes["stsd"]}
+		tkhd, mdhd, stts := boxes["tkhd"], boxes["mdhd"], boxes["stts"]
+		dims, scale := 76, 12 // Version 0 offsets; version 1 has 64-bit times
+		if len(tkhd) > 0 && tkhd[0] == 1 {
+			dims = 88
+		}
+		if len(mdhd) > 0 && mdhd[0] == 1 {
+			scale = 20
+		}
+		if len(tkhd) < dims+8 || len(mdhd) < scale+4 || len(stts) < 16 || len(ref.stsd) < 16 {
+			continue
+		}
+		ref.width = binary.BigEndian.Uint32(tkhd[dims:])
+		ref.height = binary.BigEndian.Uint32(tkhd[dims+4:])
+		ref.timescale = binary.BigEndian.Uint32(mdhd[scale:])
+		ref.delta = binary.BigEndian.Uint32(stts[12:])
+		ref.codec = string(ref.stsd[12:16])
+		if mp4HEVC(ref.codec) || ref.codec == "avc1" || ref.codec == "avc3" {
+			if ref.timescale > 0 && ref.delta > 0 {
+				return ref, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// mp4HEVC reports whether a sample entry type is HEVC
+func mp4HEVC(codec string) bool {
+	return codec == "hvc1" || codec == "hev1"
+}
+
+// nalUnit is what the header of a NAL unit says about it
+type nalUnit struct {
+	typ   byte
+	valid bool
+	vcl   bool // Coded picture data rather than parameter sets or SEI
+	first bool // First slice of a picture
+	key   bool // IDR or other random access picture
+}
+
+// parseNAL reads the header of the NAL unit that starts b (at least 3 bytes)
+func parseNAL(b []byte, hevc bool) nalUnit {
+	if b[0]&0x80 != 0 {
+		return nalUnit{}
+	}
+	if hevc {
+		typ := b[0] >> 1 & 0x3F
+		if b[0]&0x01 != 0 || b[1]&0xF8 != 0 || b[1]&0x07 == 0 { // Layer 0, temporal ID plus 1
+			return nalUnit{}
+		}
+		switch {
+		case typ <= 9 || typ >= 16 && typ <= 21:
+			return nalUnit{typ: typ, valid: true, vcl: true, first: b[2]&0x80 != 0, key: typ >= 16}
+		case typ >= 32 && typ <= 40:
+			return nalUnit{typ: typ, valid: true}
+		}
+		return nalUnit{}
+	}
+
+	typ, ref := b[0]&0x1F, b[0]>>5&0x03
+	switch typ {
+	case 1:
+		return nalUnit{typ: typ, valid: true, vcl: true, first: b[1]&0x80 != 0}
+	case 5:
+		return nalUnit{typ: typ, valid: ref != 0, vcl: true, first: b[1]&0x80 != 0, key: true}
+	case 7, 8: // Parameter sets
+		return nalUnit{typ: typ, valid: ref != 0}
+	case 6, 9, 12: // SEI, access unit delimiter, filler
+		return nalUnit{typ: typ, valid: ref == 0}
+	}
+	return nalUnit{}
+}
+
+// mp4Sample is one picture in the mdat
+type mp4Sample struct {
+	offset, size int64
+	key          bool
+	vcl          bool
+}
+
+// mp4Stream is the video found in an mdat
+type mp4Stream struct {
+	samples  []mp4Sample
+	sps, pps []byte // First H.264 parameter sets, when repeated in the stream
+}
+
+// mp4NAL reads the NAL unit at pos, returning its header and total length
+// including the length prefix, or false if it does not fit before end
+func mp4NAL(r io.ReaderAt, pos, end int64, hevc bool) (nalUnit, int64, bool) {
+	var hdr [7]byte
+	if pos+int64(len(hdr)) > end {
+		return nalUnit{}, 0, false
+	}
+	if _, err := r.ReadAt(hdr[:], pos); err != nil {
+		return nalUnit{}, 0, false
+	}
+	length := 4 + int64(binary.BigEndian.Uint32(hdr[:4]))
+	nal := parseNAL(hdr[4:], hevc)
+	if !nal.valid || length < 7 || pos+length > end {
+		return nalUnit{}, 0, false
+	}
+	return nal, length, true
+}
+
+// mp4Resync finds the next position from pos where two NAL units follow each
+// other, or the last one ends the mdat
+func mp4Resync(r io.ReaderAt, pos, end int64, hevc bool) int64 {
+	buf := make([]byte, 64*1024)
+	limit := min(end, pos+mp4ResyncLimit)
+	for pos < limit {
+		n, _ := r.ReadAt(buf[:min(int64(len(buf)), limit-pos)], pos)
+		if n == 0 {
+			break
+		}
+		for i := 0; i < n; i++ {
+			// Cheap test first: NAL units are far shorter than 16MB
+			if i+1 < n && buf[i] != 0 {
+				continue
+			}
+			at := pos + int64(i)
+			if _, length, ok := mp4NAL(r, at, end, hevc); ok {
+				if at+length == end {
+					return at
+				}
+				if _, _, ok := mp4NAL(r, at+length, end, hevc); ok {
+					return at
+				}
+			}
+		}
+		pos += int64(n)
+	}
+	return -1
+}
+
+// mp4Samples walks the NAL units between start and end and groups them into
+// samples: a picture begins with parameter sets or SEI after the previous
+// picture's slices, or with the first slice of a new picture
+func mp4Samples(r io.ReaderAt, start, end int64, hevc bool) mp4Stream {
+	var stream mp4Stream
+	pos, open := start, false
+	for pos < end {
+		nal, length, ok := mp4NAL(r, pos, end, hevc)
+		if !ok {
+			// Audio or damage; a sample never spans it
+			open = false
+			if pos = mp4Resync(r, pos+1, end, hevc); pos < 0 {
+				break
+			}
+			continue
+		}
+
+		last := len(stream.samples) - 1
+		if !open || last >= 0 && stream.samples[last].vcl && (!nal.vcl || nal.first) {
+			stream.samples = append(stream.samples, mp4Sample{offset: pos})
+			last++
+			open = true
+		}
+		s := &stream.samples[last]
+		s.size += length
+		s.vcl = s.vcl || nal.vcl
+		s.key = s.key || nal.key
+
+		if !hevc && (nal.typ == 7 && stream.sps == nil || nal.typ == 8 && stream.pps == nil) && length <= 1024 {
+			set := make([]byte, length-4)
+			if _, err := r.ReadAt(set, pos+4); err == nil {
+				if nal.typ == 7 {
+					stream.sps = set
+				} else {
+					stream.pps = set
+				}
+			}
+		}
+		pos += length
+	}
+
+	// Parameter sets left at the end belong to no picture
+	pictures := stream.samples[:0]
+	for _, s := range stream.samples {
+		if s.vcl {
+			pictures = append(pictures, s)
+		}
+	}
+	stream.samples = pictures
+	return stream
+}
+
+// bitReader reads the bit fields of an H.264 parameter set
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (b *bitReader) bit() uint {
+	if b.pos >= len(b.data)*8 {
+		b.pos++
+		return 0
+	}
+	v := uint(b.data[b.pos/8]>>(7-b.pos%8)) & 1
+	b.pos++
+	return v
+}
+
+func (b *bitReader) bits(n int) uint {
+	var v uint
+	for i := 0; i < n; i++ {
+		v = v<<1 | b.bit()
+	}
+	return v
+}
+
+// ue reads an unsigned Exp-Golomb code
+func (b *bitReader) ue() uint {
+	zeros := 0
+	for b.bit() == 0 && zeros < 32 {
+		zeros++
+	}
+	return 1<<zeros - 1 + b.bits(zeros)
+}
+
+// se reads a signed Exp-Golomb code
+func (b *bitReader) se() int {
+	v := b.ue()
+	if v&1 != 0 {
+		return int(v+1) / 2
+	}
+	return -int(v / 2)
+}
+
+func (b *bitReader) overrun() bool {
+	return b.pos > len(b.data)*8
+}
+
+// unescapeRBSP removes the emulation prevention bytes from a NAL unit
+func unescapeRBSP(nal []byte) []byte {
+	out := make([]byte, 0, len(nal))
+	zeros := 0
+	for _, c := range nal {
+		if zeros >= 2 && c == 0x03 {
+			zeros = 0
+			continue
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// spsDimensions returns the picture size coded in an H.264 sequence
+// parameter set, after cropping
+func spsDimensions(sps []byte) (width, height uint32, ok bool) {
+	b := &bitReader{data: unescapeRBSP(sps), pos: 8} // Past the NAL header
+	profile := b.bits(8)
+	b.bits(16) // Constraint flags and level
+	b.ue()     // Parameter set ID
+
+	chroma := uint(1)
+	switch profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		if chroma = b.ue(); chroma == 3 {
+			b.bit() // Separate colour planes
+		}
+		b.ue() // Luma and chroma bit depths
+		b.ue()
+		b.bit()
+		if b.bit() != 0 { // Scaling matrices
+			lists := 8
+			if chroma == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if b.bit() == 0 {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				last, next := 8, 8
+				for j := 0; j < size; j++ {
+					if next != 0 {
+						next = (last + b.se() + 256) % 256
+					}
+					if next != 0 {
+						last = next
+					}
+				}
+			}
+		}
+	}
+
+	b.ue()          // log2(max frame number)
+	switch b.ue() { // Picture order count type
+	case 0:
+		b.ue()
+	case 1:
+		b.bit()
+		b.se()
+		b.se()
+		for n := b.ue(); n > 0 && !b.overrun(); n-- {
+			b.se()
+		}
+	}
+	b.ue()  // Reference frames
+	b.bit() // Gaps allowed
+	mbWidth, mbHeight := b.ue()+1, b.ue()+1
+	frameMBsOnly := b.bit()
+	if frameMBsOnly == 0 {
+		b.bit() // Adaptive frame/field
+	}
+	b.bit() // Direct 8x8 inference
+
+	w, h := mbWidth*16, (2-frameMBsOnly)*mbHeight*16
+	if b.bit() != 0 { // Frame cropping, in chroma sample units
+		cropX, cropY := uint(1), 2-frameMBsOnly
+		if chroma == 1 || chroma == 2 {
+			cropX = 2
+		}
+		if chroma == 1 {
+			cropY *= 2
+		}
+		left, right, top, bottom := b.ue(), b.ue(), b.ue(), b.ue()
+		if (left+right)*cropX >= w || (top+bottom)*cropY >= h {
+			return 0, 0, false
+		}
+		w -= (left + right) * cropX
+		h -= (top + bottom) * cropY
+	}
+	if b.overrun() || w > 16384 || h > 16384 {
+		return 0, 0, false
+	}
+	return uint32(w), uint32(h), true
+}
+
+// mp4Box builds a box from its type and payload
+func mp4Box(typ string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+	box := binary.BigEndian.AppendUint32(make([]byte, 0, size), uint32(size))
+	box = append(box, typ...)
+	for _, p := range payload {
+		box = append(box, p...)
+	}
+	return box
+}
+
+// mp4FullBox builds a version 0 box with flags
+func mp4FullBox(typ string, flags uint32, payload ...[]byte) []byte {
+	return mp4Box(typ, append([][]byte{be32(flags & 0xFFFFFF)}, payload...)...)
+}
+
+// be32 encodes values as big-endian 32-bit integers
+func be32(values ...uint32) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+// be16 encodes values as big-endian 16-bit integers
+func be16(values ...uint16) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint16(b, v)
+	}
+	return b
+}
+
+// avcSampleEntry builds an H.264 sample description from the parameter sets
+func avcSampleEntry(sps, pps []byte, width, height uint32) []byte {
+	avcC := []byte{1, sps[1], sps[2], sps[3], 0xFF, 0xE1} // 4-byte lengths, one SPS
+	avcC = append(append(append(avcC, be16(uint16(len(sps)))...), sps...), 1)
+	avcC = append(append(avcC, be16(uint16(len(pps)))...), pps...)
+
+	entry := mp4Box("avc1",
+		make([]byte, 6), be16(1), // Reserved, data reference index
+		make([]byte, 16), be16(uint16(width), uint16(height)),
+		be32(0x00480000, 0x00480000, 0), be16(1), // 72 dpi, one frame per sample
+		make([]byte, 32), be16(0x0018, 0xFFFF), // No compressor name, 24-bit colour
+		mp4Box("avcC", avcC))
+	return append(be32(0, 1), entry...)
+}
+
+// mp4Moov builds a movie box indexing the samples as a single video track
+func mp4Moov(samples []mp4Sample, ref *MP4Reference) []byte {
+	count := uint32(len(samples))
+	duration := count * ref.delta
+	matrix := be32(0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000)
+
+	var sizes, keys, offsets []byte
+	var keyCount uint32
+	large := samples[len(samples)-1].offset > 0xFFFFFFFF
+	for i, s := range samples {
+		sizes = append(sizes, be32(uint32(s.size))...)
+		if s.key {
+			keys = append(keys, be32(uint32(i+1))...)
+			keyCount++
+		}
+		if large {
+			offsets = binary.BigEndian.AppendUint64(offsets, uint64(s.offset))
+		} else {
+			offsets = append(offsets, be32(uint32(s.offset))...)
+		}
+	}
+
+	stbl := [][]byte{
+		mp4Box("stsd", ref.stsd),
+		mp4FullBox("stts", 0, be32(1, count, ref.delta)),
+		mp4FullBox("stsc", 0, be32(1, 1, 1, 1)), // One sample per chunk
+		mp4FullBox("stsz", 0, be32(0, count), sizes),
+	}
+	if keyCount > 0 && keyCount < count { // Without a sync sample table every sample is one
+		stbl = append(stbl, mp4FullBox("stss", 0, be32(keyCount), keys))
+	}
+	if large {
+		stbl = append(stbl, mp4FullBox("co64", 0, be32(count), offsets))
+	} else {
+		stbl = append(stbl, mp4FullBox("stco", 0, be32(count), offsets))
+	}
+
+	return mp4Box("moov",
+		mp4FullBox("mvhd", 0, be32(0, 0, ref.timescale, duration, 0x00010000), be16(0x0100), make([]byte, 10), matrix, make([]byte, 24), be32(2)),
+		mp4Box("trak",
+			mp4FullBox("tkhd", 3, be32(0, 0, 1, 0, duration), make([]byte, 16), matrix, be32(ref.width, ref.height)),
+			mp4Box("mdia",
+				mp4FullBox("mdhd", 0, be32(0, 0, ref.timescale, duration), be16(0x55C4, 0)), // Language "und"
+				mp4FullBox("hdlr", 0, be32(0), []byte("vide"), make([]byte, 12), []byte("VideoHandler\x00")),
+				mp4Box("minf",
+					mp4FullBox("vmhd", 1, make([]byte, 8)),
+					mp4Box("dinf", mp4FullBox("dref", 0, be32(1), mp4FullBox("url ", 1))), // Samples are in this file
+					mp4Box("stbl", stbl...)))))
+}
+
+// mp4Mdat finds the media data box of a carved movie and reports whether its
+// movie box survived. An mdat cut short by the carve, or recorded with size
+// 0 because the camera never finished it, runs to the end of the carving.
+func mp4Mdat(r io.ReaderAt, size int64) (hdr, start, end int64, hasMoov, ok bool) {
+	var buf [16]byte
+	var pos int64
+	for pos+8 <= size {
+		if _, err := r.ReadAt(buf[:8], pos); err != nil || !isBoxType(buf[4:8]) {
+			break
+		}
+		boxSize, head := int64(binary.BigEndian.Uint32(buf[:4])), int64(8)
+		if boxSize == 1 {
+			if _, err := r.ReadAt(buf[8:16], pos+8); err != nil {
+				break
+			}
+			boxSize, head = int64(binary.BigEndian.Uint64(buf[8:16])), 16
+		}
+		switch string(buf[4:8]) {
+		case "moov":
+			hasMoov = true
+		case "mdat":
+			if !ok {
+				hdr, start, end, ok = pos, pos+head, pos+boxSize, true
+				if boxSize < head || end > size {
+					end = size
+				}
+			}
+		}
+		if boxSize < head || pos+boxSize > size {
+			break
+		}
+		pos += boxSize
+	}
+	return hdr, start, end, hasMoov, ok
+}
+
+// RepairMP4 rebuilds the movie box of a recovered MP4 or MOV whose own was
+// lost, writing a playable copy next to it. Codec settings come from ref, or
+// from parameter sets in the stream when ref is nil. It returns the path of
+// the copy and the number of video samples indexed; a file that still has
+// its movie box, or holds no recognisable video, is left alone.
+func (c *Carver) RepairMP4(file *CarvedFile, ref *MP4Reference) (string, int, error) {
+	content, size, err := c.content(*file)
+	if err != nil {
+		return "", 0, err
+	}
+	hdr, start, end, hasMoov, ok := mp4Mdat(content, size)
+	if !ok || hasMoov {
+		return "", 0, nil
+	}
+
+	hevc := ref != nil && mp4HEVC(ref.codec)
+	stream := mp4Samples(content, start, end, hevc)
+	if len(stream.samples) == 0 {
+		return "", 0, nil
+	}
+	if ref == nil {
+		if stream.sps == nil || stream.pps == nil || len(stream.sps) < 4 {
+			return "", 0, nil
+		}
+		width, height, ok := spsDimensions(stream.sps)
+		if !ok {
+			return "", 0, nil
+		}
+		ref = &MP4Reference{
+			stsd:      avcSampleEntry(stream.sps, stream.pps, width, height),
+			codec:     "avc1",
+			timescale: mp4Timescale,
+			delta:     mp4FrameDelta,
+			width:     width << 16,
+			height:    height << 16,
+		}
+	}
+
+	// The mdat ends with the last picture, and its header says so
+	last := stream.samples[len(stream.samples)-1]
+	end = last.offset + last.size
+	head := make([]byte, start-hdr)
+	if _, err := content.ReadAt(head, hdr); err != nil {
+		return "", 0, err
+	}
+	if len(head) == 16 {
+		binary.BigEndian.PutUint64(head[8:], uint64(end-hdr))
+	} else if end-hdr <= 0xFFFFFFFF {
+		binary.BigEndian.PutUint32(head, uint32(end-hdr))
+	} else {
+		return "", 0, nil
+	}
+
+	name := strings.TrimSuffix(file.Path, disk.ZstdSuffix) // The repair is written as it is
+	ext := filepath.Ext(name)
+	path := strings.TrimSuffix(name, ext) + ".repaired" + ext
+	out, err := os.Create(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	if _, err := io.Copy(w, io.NewSectionReader(content, 0, hdr)); err != nil {
+		return "", 0, err
+	}
+	w.Write(head)
+	if _, err := io.Copy(w, io.NewSectionReader(content, start, end-start)); err != nil {
+		return "", 0, err
+	}
+	w.Write(mp4Moov(stream.samples, ref))
+	if err := w.Flush(); err != nil {
+		return "", 0, err
+	}
+	return path, len(stream.samples), nil
+}
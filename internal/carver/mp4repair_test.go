@@ -0,0 +1,236 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// bitWriter assembles the bit fields of an H.264 parameter set
+type bitWriter struct {
+	bits []byte
+}
+
+func (w *bitWriter) put(v uint, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.bits = append(w.bits, byte(v>>i)&1)
+	}
+}
+
+func (w *bitWriter) ue(v uint) {
+	n := 0
+	for (v+1)>>n > 1 {
+		n++
+	}
+	w.put(0, n)
+	w.put(v+1, n+1)
+}
+
+// bytes ends the fields with the stop bit and adds emulation prevention
+func (w *bitWriter) bytes() []byte {
+	w.put(1, 1)
+	var raw []byte
+	for i := 0; i < len(w.bits); i += 8 {
+		var b byte
+		for j := 0; j < 8; j++ {
+			b <<= 1
+			if i+j < len(w.bits) {
+				b |= w.bits[i+j]
+			}
+		}
+		raw = append(raw, b)
+	}
+	var out []byte
+	zeros := 0
+	for _, b := range raw {
+		if zeros >= 2 && b <= 3 {
+			out = append(out, 0x03)
+			zeros = 0
+		}
+		out = append(out, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
+
+// makeSPS builds a baseline H.264 sequence parameter set for 1920x1080,
+// coded as 1088 lines cropped by 8
+func makeSPS() []byte {
+	w := &bitWriter{}
+	w.put(66, 8) // Baseline profile
+	w.put(0, 8)
+	w.put(40, 8) // Level 4
+	w.ue(0)      // Parameter set ID
+	w.ue(0)      // log2(max frame number) - 4
+	w.ue(0)      // Picture order count type
+	w.ue(0)
+	w.ue(1) // Reference frames
+	w.put(0, 1)
+	w.ue(119) // 120 macroblocks wide
+	w.ue(67)  // 68 high
+	w.put(1, 1)
+	w.put(1, 1)
+	w.put(1, 1) // Cropping
+	w.ue(0)
+	w.ue(0)
+	w.ue(0)
+	w.ue(4)
+	w.put(0, 1) // No VUI
+	return append([]byte{0x67}, w.bytes()...)
+}
+
+// nal prefixes a NAL unit with its length
+func nal(header byte, first bool, size int) []byte {
+	unit := bytes.Repeat([]byte{0x5A}, size)
+	unit[0] = header
+	unit[1] = 0x00
+	if first {
+		unit[1] = 0x88 // first_mb_in_slice 0, then the slice type
+	}
+	return append(binary.BigEndian.AppendUint32(nil, uint32(size)), unit...)
+}
+
+// makeVideoMdat builds the payload of an mdat holding an IDR picture of two
+// slices with its parameter sets, then P pictures with AAC audio chunks in
+// between, returning it with the offset and size of each picture
+func makeVideoMdat(pictures int) ([]byte, []mp4Sample) {
+	sps := makeSPS()
+	pps := []byte{0x68, 0xCE, 0x38, 0x80}
+	audio := append([]byte{0xFF, 0xF1, 0x50, 0x80}, bytes.Repeat([]byte{0x21, 0x10}, 150)...)
+
+	var mdat []byte
+	var samples []mp4Sample
+	key := append(binary.BigEndian.AppendUint32(nil, uint32(len(sps))), sps...)
+	key = append(append(key, binary.BigEndian.AppendUint32(nil, uint32(len(pps)))...), pps...)
+	key = append(append(key, nal(0x65, true, 900)...), nal(0x65, false, 700)...)
+	samples = append(samples, mp4Sample{offset: 0, size: int64(len(key)), key: true, vcl: true})
+	mdat = append(mdat, key...)
+
+	for i := 1; i < pictures; i++ {
+		if i%3 == 0 {
+			mdat = append(mdat, audio...)
+		}
+		p := nal(0x41, true, 300+i)
+		samples = append(samples, mp4Sample{offset: int64(len(mdat)), size: int64(len(p)), vcl: true})
+		mdat = append(mdat, p...)
+	}
+	return mdat, samples
+}
+
+func TestSPSDimensions(t *testing.T) {
+	w, h, ok := spsDimensions(makeSPS())
+	if !ok || w != 1920 || h != 1080 {
+		t.Errorf("Expected 1920x1080, got %dx%d (%v)", w, h, ok)
+	}
+}
+
+func TestMP4Samples(t *testing.T) {
+	mdat, want := makeVideoMdat(10)
+	stream := mp4Samples(bytes.NewReader(mdat), 0, int64(len(mdat)), false)
+	if len(stream.samples) != len(want) {
+		t.Fatalf("Expected %d samples, got %d", len(want), len(stream.samples))
+	}
+	for i := range want {
+		if stream.samples[i] != want[i] {
+			t.Errorf("Sample %d: expected %+v, got %+v", i, want[i], stream.samples[i])
+		}
+	}
+	if !bytes.Equal(stream.sps, makeSPS()) || len(stream.pps) != 4 {
+		t.Error("Expected the parameter sets from the stream")
+	}
+}
+
+func TestRepairMP4(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	// A recording whose moov was overwritten: ftyp, then the mdat
+	payload, samples := makeVideoMdat(20)
+	ftyp := makeBox("ftyp", 16)
+	copy(ftyp[8:], "isom")
+	movie := append(ftyp, mp4Box("mdat", payload)...)
+
+	data := make([]byte, 64*1024)
+	copy(data[4096:], movie)
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	carver := NewCarver(reader)
+	sig := findSignature(t, "MP4")
+	file := CarvedFile{Signature: &sig, Offset: 4096}
+	if err := carver.recoverFile(&file, outputDir, 1); err != nil {
+		t.Fatalf("recoverFile failed: %v", err)
+	}
+
+	// From the parameter sets in the stream
+	path, n, err := carver.RepairMP4(&file, nil)
+	if err != nil || n != len(samples) {
+		t.Fatalf("Expected %d samples, got %d (%v)", len(samples), n, err)
+	}
+	if path != filepath.Join(outputDir, "MP4", "carved_000001.repaired.mp4") {
+		t.Errorf("Unexpected path %s", path)
+	}
+	repaired, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read repaired file: %v", err)
+	}
+	if !bytes.HasPrefix(repaired, movie) {
+		t.Error("Expected the repaired file to start with the recovered one")
+	}
+	ref, ok := mp4Reference(bytes.NewReader(repaired), int64(len(repaired)))
+	if !ok || ref.codec != "avc1" || ref.width != 1920<<16 || ref.height != 1080<<16 || ref.timescale != mp4Timescale {
+		t.Fatalf("Unexpected video track %+v", ref)
+	}
+
+	// The index points at every picture in the file
+	mdatStart := int64(len(ftyp) + 8)
+	moov, _ := bmffChild(bytes.NewReader(repaired), 0, int64(len(repaired)), "moov")
+	box := bmffBox{start: moov.start, end: moov.end}
+	for _, typ := range []string{"trak", "mdia", "minf", "stbl", "stco"} {
+		box, _ = bmffChild(bytes.NewReader(repaired), box.start, box.end, typ)
+	}
+	stco := repaired[box.start:box.end]
+	if binary.BigEndian.Uint32(stco[4:]) != uint32(len(samples)) {
+		t.Fatalf("Expected %d chunk offsets", len(samples))
+	}
+	for i, s := range samples {
+		if got := int64(binary.BigEndian.Uint32(stco[8+4*i:])); got != mdatStart+s.offset {
+			t.Errorf("Sample %d: expected offset %d, got %d", i, mdatStart+s.offset, got)
+		}
+	}
+
+	// With a reference, its settings are used
+	reference := &MP4Reference{stsd: ref.stsd, codec: "avc1", timescale: 25000, delta: 1000, width: ref.width, height: ref.height}
+	refFile := filepath.Join(tmpDir, "reference.mp4")
+	if err := os.WriteFile(refFile, append(append([]byte{}, movie...), mp4Moov(samples, reference)...), 0644); err != nil {
+		t.Fatalf("Failed to write reference: %v", err)
+	}
+	loaded, err := LoadMP4Reference(refFile)
+	if err != nil || loaded.timescale != 25000 || loaded.delta != 1000 {
+		t.Fatalf("Unexpected reference %+v (%v)", loaded, err)
+	}
+	if _, n, err := carver.RepairMP4(&file, loaded); err != nil || n != len(samples) {
+		t.Errorf("Expected %d samples with a reference, got %d (%v)", len(samples), n, err)
+	}
+
+	// An intact movie is left alone
+	intact, _ := os.ReadFile(refFile)
+	if _, _, _, hasMoov, ok := mp4Mdat(bytes.NewReader(intact), int64(len(intact))); !ok || !hasMoov {
+		t.Error("Expected the reference to have its movie box")
+	}
+}
@@ -0,0 +1,89 @@
+package carver
+
+import (
+	"errors"
+	"os"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// Virtual disks and archives hold files of their own, and a carving of one
+// is a disk in its own right once its signature's Open hook lays it out.
+// Recursive carving treats it like the device it was found on: deleted files
+// are recovered from the FAT32 and NTFS volumes on it, then it is carved,
+// with each level written below the container it came from:
+//
+//	VMDK/carved_000003.vmdk.nested/partition1-ntfs/...   Deleted files of the guest's volume
+//	VMDK/carved_000003.vmdk.nested/JPEG/carved_000012.jpg
+
+// nestedSuffix names the directory next to a container that holds what was
+// found inside it
+const nestedSuffix = ".nested"
+
+// CarveNested recovers and carves the contents of a recovered container,
+// going opts.Depth levels deep. It returns the directory written to and the
+// number of files recovered, with a *disk.PartialRecoveryError for those it
+// could not write; a file that holds nothing that can be laid out is left
+// alone.
+func (c *Carver) CarveNested(file *CarvedFile, opts Options) (string, int, error) {
+	if opts.Depth <= 0 || file.Signature.Open == nil {
+		return "", 0, nil
+	}
+	content, size, err := c.content(*file)
+	if err != nil {
+		return "", 0, err
+	}
+	inner, innerSize := file.Signature.Open(content, size)
+	if inner == nil || innerSize <= 0 {
+		return "", 0, nil
+	}
+
+	dir := file.Path + nestedSuffix
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, err
+	}
+	nested := disk.NewReader(inner, innerSize, file.Path)
+	nested.WriteLike(c.reader)
+
+	// Deleted files, from each partition or from a volume filling the disk
+	files, err := recoverVolumes(nested, dir, false, opts, func(v volume, fs string) string {
+		name := v.name
+		if name == "" {
+			name = "volume"
+		}
+		return name + "-" + fs
+	})
+	var failed []*disk.FileError
+	var partial *disk.PartialRecoveryError
+	if errors.As(err, &partial) {
+		failed = partial.Failed
+	} else if err != nil {
+		c.reader.Errorf("  Failed to recover deleted files from %s: %v\n", file.Path, err)
+	}
+	files = dropKnown(nested, files, opts)
+
+	// Carving, one level down; progress stays with the outer scan. Carvings
+	// of the deleted files just recovered are folded into them.
+	var carved []CarvedFile
+	inside := opts
+	inside.Depth--
+	inside.Checkpoint, inside.Resume = "", false
+	inside.DFXML, inside.Report, inside.Session = false, ReportOff, false // The outer reports list the containers
+	inside.Sidecars = false
+	inside.extents = nil
+	inside.filesystem = pointers(files)
+	inside.Carved = &carved
+	inside.nested = true
+	n, err := Recover(nested, dir, false, inside)
+	if errors.As(err, &partial) {
+		failed = append(failed, partial.Failed...)
+	} else if err != nil {
+		return dir, len(files) + n, err
+	}
+	if len(files) > 0 {
+		if _, err := writeSmartReport(dir, files, carved); err != nil {
+			return dir, len(files) + n, err
+		}
+	}
+	return dir, len(files) + n, disk.Partial(len(files)+n, failed)
+}
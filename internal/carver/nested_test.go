@@ -0,0 +1,122 @@
+package carver
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// makeGuestVDI builds a VDI holding the guest disk with its 4KB blocks
+// stored in reverse order, as a guest writing from the end of its disk would
+func makeGuestVDI(guest []byte) []byte {
+	blocks := len(guest) / 4096
+	data := make([]byte, 0x400+len(guest))
+	le := binary.LittleEndian
+	copy(data, "<<< Oracle VM VirtualBox Disk Image >>>\n")
+	le.PutUint32(data[0x40:], 0xBEDA107F)
+	le.PutUint32(data[0x44:], 0x00010001)
+	le.PutUint32(data[0x4C:], 1)
+	le.PutUint32(data[0x154:], 0x200)
+	le.PutUint32(data[0x158:], 0x400)
+	le.PutUint64(data[0x170:], uint64(len(guest)))
+	le.PutUint32(data[0x178:], 4096)
+	le.PutUint32(data[0x180:], uint32(blocks))
+	le.PutUint32(data[0x184:], uint32(blocks))
+	for i := 0; i < blocks; i++ {
+		stored := blocks - 1 - i
+		le.PutUint32(data[0x200+4*i:], uint32(stored))
+		copy(data[0x400+stored*4096:], guest[i*4096:(i+1)*4096])
+	}
+	return data
+}
+
+// nestedFiles returns the files carved inside a container, by type
+func nestedFiles(t *testing.T, container, typ string) [][]byte {
+	paths, _ := filepath.Glob(filepath.Join(container+nestedSuffix, typ, "*"))
+	var files [][]byte
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", p, err)
+		}
+		files = append(files, data)
+	}
+	return files
+}
+
+func TestCarveNested(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	// A registry hive on the guest disk of a virtual machine, in pieces on
+	// the host, and another in a ZIP archive
+	hive := makeHive(4096, 4096)
+	guest := make([]byte, 16384)
+	copy(guest, hive)
+	vdi := makeGuestVDI(guest)
+
+	small := makeHive(4096)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("notes.txt")
+	w.Write(bytes.Repeat([]byte("notes "), 300))
+	w, _ = zw.Create("backup/SYSTEM")
+	w.Write(small)
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close zip: %v", err)
+	}
+
+	data := make([]byte, 128*1024)
+	copy(data[4096:], vdi)
+	copy(data[65536:], buf.Bytes())
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	var sigs []FileSignature
+	for _, name := range []string{"VDI", "ZIP", "REGISTRY"} {
+		sigs = append(sigs, findSignature(t, name))
+	}
+	opts := Options{Signatures: sigs, Depth: 1}
+	recovered, err := Recover(reader, outputDir, false, opts)
+	if err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+
+	vdiPath := filepath.Join(outputDir, "VDI", "carved_000000.vdi")
+	if hives := nestedFiles(t, vdiPath, "REGISTRY"); len(hives) != 1 || !bytes.Equal(hives[0], hive) {
+		t.Errorf("Expected the hive from the guest disk, got %d files", len(hives))
+	}
+	zipPath := filepath.Join(outputDir, "ZIP", "carved_000002.zip") // From the start of the archive
+	if hives := nestedFiles(t, zipPath, "REGISTRY"); len(hives) != 1 || !bytes.Equal(hives[0], small) {
+		t.Errorf("Expected the hive from the archive, got %d files", len(hives))
+	}
+
+	// The nested files count towards the total: the VDI, the hive header
+	// among its blocks on the host, and the archive found at each of its two
+	// local headers, then a hive inside each of the three containers
+	if recovered != 7 {
+		t.Errorf("Expected 7 files recovered, got %d", recovered)
+	}
+
+	// Without a depth nothing is carved inside
+	plain := filepath.Join(tmpDir, "plain")
+	opts.Depth = 0
+	if _, err := Recover(reader, plain, false, opts); err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if nested, _ := filepath.Glob(filepath.Join(plain, "*", "*"+nestedSuffix)); len(nested) != 0 {
+		t.Errorf("Expected no nested carving, got %v", nested)
+	}
+}
@@ -0,0 +1,421 @@
+package carver
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// A PDF is a series of numbered objects ("12 0 obj ... endobj") followed by
+// a cross-reference table giving the offset of each object and a trailer
+// naming the document catalog, the root of the page tree. Both sit at the
+// end of the file, so when the tail is lost no reader can find anything,
+// although the objects themselves are intact. The table is rebuilt by
+// scanning the carving for objects, including those packed into compressed
+// object streams, and finding the catalog among them. When the catalog is
+// gone too, a new one is made over the page objects that were found.
+
+const (
+	pdfMaxObjStm = 32 * 1024 * 1024 // Largest object stream decompressed
+	pdfPeekSize  = 2048             // Bytes of an object read to identify it
+)
+
+var (
+	pdfTypeRe   = regexp.MustCompile(`/Type\s*/(Catalog|Pages|Page|ObjStm)\b`)
+	pdfPagesRe  = regexp.MustCompile(`/Pages\s+(\d+)\s+(\d+)\s+R`)
+	pdfNRe      = regexp.MustCompile(`/N\s+(\d+)`)
+	pdfFirstRe  = regexp.MustCompile(`/First\s+(\d+)`)
+	pdfParentRe = regexp.MustCompile(`/Parent\s+\d+\s+\d+\s+R`)
+)
+
+// pdfObject is where an object is defined: at an offset in the file, or as
+// a member of an object stream
+type pdfObject struct {
+	num, gen int
+	offset   int64  // Offset of "num gen obj", or of the object stream holding it
+	stream   int    // Number of the object stream holding it (0 = none)
+	index    int    // Index within the object stream
+	kind     string // Catalog, Pages, Page or ObjStm
+	body     []byte // Start of a catalog or page tree node
+}
+
+// isPDFSpace reports whether c is PDF white space
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+// isPDFDelimiter reports whether c ends a PDF token
+func isPDFDelimiter(c byte) bool {
+	return isPDFSpace(c) || strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// pdfHeader parses the "num gen" before the "obj" keyword at k in buf
+func pdfHeader(buf []byte, k int) (num, gen, start int, ok bool) {
+	j := k
+	digits := func() (int, bool) {
+		end := j
+		for j > 0 && buf[j-1] >= '0' && buf[j-1] <= '9' && end-j < 10 {
+			j--
+		}
+		if j == end {
+			return 0, false
+		}
+		v, err := strconv.Atoi(string(buf[j:end]))
+		return v, err == nil
+	}
+	spaces := func() bool {
+		end := j
+		for j > 0 && isPDFSpace(buf[j-1]) && end-j < 8 {
+			j--
+		}
+		return j < end
+	}
+
+	if !spaces() {
+		return 0, 0, 0, false
+	}
+	if gen, ok = digits(); !ok || !spaces() {
+		return 0, 0, 0, false
+	}
+	if num, ok = digits(); !ok || num == 0 {
+		return 0, 0, 0, false
+	}
+	if j > 0 && !isPDFDelimiter(buf[j-1]) {
+		return 0, 0, 0, false
+	}
+	return num, gen, j, true
+}
+
+// pdfScan finds the object headers and endobj keywords in a carving, up to
+// the header of a following PDF, and returns the offset it stopped at
+func pdfScan(r io.ReaderAt, size int64) (headers []pdfObject, ends []int64, limit int64) {
+	const back = 32 // Room before a chunk for the numbers of an object header
+	buf := make([]byte, back+1024*1024+16)
+	var pos int64
+	for pos < size {
+		base := max(pos-back, 0)
+		n, _ := r.ReadAt(buf[:min(int64(len(buf)), size-base)], base)
+		if n == 0 {
+			break
+		}
+		from, to := int(pos-base), n-16
+		if base+int64(n) >= size {
+			to = n
+		}
+		if to <= from {
+			break
+		}
+
+		for i := from; i < to; {
+			k := bytes.Index(buf[i:n], []byte("obj"))
+			p := bytes.Index(buf[i:n], []byte("%PDF-"))
+			if p >= 0 && (k < 0 || p < k) && i+p < to {
+				if abs := base + int64(i+p); abs > 0 && (buf[i+p-1] == '\n' || buf[i+p-1] == '\r') {
+					return headers, ends, abs
+				}
+			}
+			if k < 0 || i+k >= to {
+				break
+			}
+			k += i
+			i = k + 3
+			if k+3 < n && !isPDFDelimiter(buf[k+3]) {
+				continue
+			}
+			if k >= 3 && string(buf[k-3:k]) == "end" {
+				ends = append(ends, base+int64(k-3))
+				continue
+			}
+			if num, gen, start, ok := pdfHeader(buf, k); ok {
+				headers = append(headers, pdfObject{num: num, gen: gen, offset: base + int64(start)})
+			}
+		}
+		pos = base + int64(to)
+	}
+	return headers, ends, size
+}
+
+// pdfObjStm returns the objects packed into a compressed object stream
+func pdfObjStm(raw []byte, num int, offset int64) []pdfObject {
+	dictEnd := bytes.Index(raw, []byte("stream"))
+	if dictEnd < 0 || !bytes.Contains(raw[:dictEnd], []byte("/FlateDecode")) {
+		return nil
+	}
+	dict := raw[:dictEnd]
+	n, first := pdfNRe.FindSubmatch(dict), pdfFirstRe.FindSubmatch(dict)
+	if n == nil || first == nil {
+		return nil
+	}
+	count, _ := strconv.Atoi(string(n[1]))
+	firstOff, _ := strconv.Atoi(string(first[1]))
+
+	data := raw[dictEnd+len("stream"):]
+	data = bytes.TrimLeft(data, "\r\n")
+	if end := bytes.LastIndex(data, []byte("endstream")); end >= 0 {
+		data = data[:end]
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	decoded, _ := io.ReadAll(io.LimitReader(zr, pdfMaxObjStm))
+	if firstOff > len(decoded) {
+		return nil
+	}
+
+	fields := strings.Fields(string(decoded[:firstOff]))
+	var members []pdfObject
+	for i := 0; i < count && 2*i+1 < len(fields); i++ {
+		memberNum, err1 := strconv.Atoi(fields[2*i])
+		memberOff, err2 := strconv.Atoi(fields[2*i+1])
+		if err1 != nil || err2 != nil || firstOff+memberOff > len(decoded) {
+			break
+		}
+		end := len(decoded)
+		if 2*i+3 < len(fields) {
+			if next, err := strconv.Atoi(fields[2*i+3]); err == nil && firstOff+next <= end && next >= memberOff {
+				end = firstOff + next
+			}
+		}
+		members = append(members, pdfObject{num: memberNum, offset: offset, stream: num, index: i, body: decoded[firstOff+memberOff : end]})
+	}
+	return members
+}
+
+// pdfObjects finds the complete objects in a carving, the later definition
+// of a number replacing the earlier one as in an incremental update. It also
+// returns where the last complete object ends.
+func pdfObjects(r io.ReaderAt, size int64) (map[int]pdfObject, int64) {
+	headers, ends, limit := pdfScan(r, size)
+	objects := make(map[int]pdfObject)
+	var cut int64
+	e := 0
+	for i, h := range headers {
+		next := limit
+		if i+1 < len(headers) {
+			next = headers[i+1].offset
+		}
+		for e < len(ends) && ends[e] < h.offset {
+			e++
+		}
+		if e == len(ends) || ends[e] >= next {
+			continue // Cut off, or overwritten by the next object
+		}
+		end := ends[e] + int64(len("endobj"))
+
+		peek := make([]byte, min(end-h.offset, pdfPeekSize))
+		if _, err := r.ReadAt(peek, h.offset); err != nil {
+			continue
+		}
+		if m := pdfTypeRe.FindSubmatch(peek); m != nil {
+			h.kind = string(m[1])
+		}
+		if h.kind == "Catalog" || h.kind == "Pages" {
+			h.body = peek
+		}
+		if h.kind == "ObjStm" && end-h.offset <= pdfMaxObjStm {
+			raw := make([]byte, end-h.offset)
+			if _, err := r.ReadAt(raw, h.offset); err == nil {
+				for _, m := range pdfObjStm(raw, h.num, h.offset) {
+					if k := pdfTypeRe.FindSubmatch(m.body); k != nil {
+						m.kind = string(k[1])
+					}
+					if m.kind != "Catalog" && m.kind != "Pages" {
+						m.body = nil
+					}
+					objects[m.num] = m
+				}
+			}
+		}
+		objects[h.num] = h
+		cut = end
+	}
+	return objects, cut
+}
+
+// pdfXrefIntact reports whether the startxref at the end of a PDF points at
+// a cross-reference table or stream inside it
+func pdfXrefIntact(r io.ReaderAt, size int64) bool {
+	tail := make([]byte, min(size, 4096))
+	if _, err := r.ReadAt(tail, size-int64(len(tail))); err != nil && err != io.EOF {
+		return false
+	}
+	i := bytes.LastIndex(tail, []byte("startxref"))
+	if i < 0 {
+		return false
+	}
+	fields := strings.Fields(string(tail[i+len("startxref"):]))
+	if len(fields) == 0 {
+		return false
+	}
+	offset, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || offset <= 0 || offset >= size {
+		return false
+	}
+	at := make([]byte, min(32, size-offset))
+	if _, err := r.ReadAt(at, offset); err != nil && err != io.EOF {
+		return false
+	}
+	if bytes.HasPrefix(at, []byte("xref")) {
+		return true
+	}
+	k := bytes.Index(at, []byte("obj"))
+	_, _, start, ok := pdfHeader(at, max(k, 0))
+	return k > 0 && ok && start == 0
+}
+
+// pdfRoot picks the catalog whose page tree survived, or makes new objects
+// for a catalog and page tree over the surviving pages. It returns the
+// catalog's number and generation and any new objects, numbered from next.
+func pdfRoot(objects map[int]pdfObject, next int) (num, gen int, extra []string) {
+	var nums []int
+	for n := range objects {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+
+	var pages, roots []int
+	for _, n := range nums {
+		obj := objects[n]
+		switch obj.kind {
+		case "Catalog":
+			m := pdfPagesRe.FindSubmatch(obj.body)
+			if m == nil {
+				continue
+			}
+			if p, err := strconv.Atoi(string(m[1])); err == nil {
+				if _, ok := objects[p]; ok {
+					num, gen = n, obj.gen
+				}
+			}
+		case "Pages":
+			if !pdfParentRe.Match(obj.body) {
+				roots = append(roots, n)
+			}
+		case "Page":
+			pages = append(pages, n)
+		}
+	}
+	if num > 0 {
+		return num, gen, nil
+	}
+	if len(pages) == 0 {
+		return 0, 0, nil
+	}
+
+	// The page tree root, or a new one listing every page
+	tree := 0
+	if len(roots) > 0 {
+		tree = roots[len(roots)-1]
+	} else {
+		tree = next
+		var kids []string
+		for _, p := range pages {
+			kids = append(kids, fmt.Sprintf("%d %d R", p, objects[p].gen))
+		}
+		extra = append(extra, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+		next++
+	}
+	extra = append(extra, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", tree))
+	return next, 0, extra
+}
+
+// RepairPDF rebuilds the cross-reference table and trailer of a recovered
+// PDF whose own were lost, writing a readable copy next to it. It returns
+// the path of the copy and the number of objects indexed; a PDF whose
+// cross-reference table is intact, or without pages, is left alone.
+func (c *Carver) RepairPDF(file *CarvedFile) (string, int, error) {
+	content, size, err := c.content(*file)
+	if err != nil {
+		return "", 0, err
+	}
+	if pdfXrefIntact(content, size) {
+		return "", 0, nil
+	}
+	objects, cut := pdfObjects(content, size)
+	maxNum := 0
+	compressed := false
+	for n, obj := range objects {
+		maxNum = max(maxNum, n)
+		compressed = compressed || obj.stream != 0
+	}
+	root, rootGen, extra := pdfRoot(objects, maxNum+1)
+	if root == 0 {
+		return "", 0, nil
+	}
+
+	name := strings.TrimSuffix(file.Path, disk.ZstdSuffix) // The repair is written as it is
+	ext := filepath.Ext(name)
+	path := strings.TrimSuffix(name, ext) + ".repaired" + ext
+	out, err := os.Create(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	if _, err := io.Copy(w, io.NewSectionReader(content, 0, cut)); err != nil {
+		return "", 0, err
+	}
+	pos := cut
+	write := func(format string, args ...any) {
+		n, _ := fmt.Fprintf(w, format, args...)
+		pos += int64(n)
+	}
+	write("\n")
+	for i, body := range extra {
+		num := maxNum + 1 + i
+		objects[num] = pdfObject{num: num, offset: pos}
+		write("%d 0 obj\n%s\nendobj\n", num, body)
+	}
+	count := maxNum + 1 + len(extra)
+
+	if compressed {
+		// Members of object streams need a cross-reference stream
+		xref := count
+		objects[xref] = pdfObject{num: xref, offset: pos}
+		var data []byte
+		for n := 0; n <= xref; n++ {
+			obj, ok := objects[n]
+			switch {
+			case n == 0:
+				data = append(data, 0, 0, 0, 0, 0, 0xFF, 0xFF)
+			case !ok:
+				data = append(data, 0, 0, 0, 0, 0, 0, 0)
+			case obj.stream != 0:
+				data = append(append([]byte{2}, be32(uint32(obj.stream))...), be16(uint16(obj.index))...)
+			default:
+				data = append(append([]byte{1}, be32(uint32(obj.offset))...), be16(uint16(obj.gen))...)
+			}
+		}
+		write("%d 0 obj\n<< /Type /XRef /Size %d /W [1 4 2] /Root %d %d R /Length %d >>\nstream\n", xref, xref+1, root, rootGen, len(data))
+		w.Write(data)
+		pos += int64(len(data))
+		write("\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", objects[xref].offset)
+	} else {
+		start := pos
+		write("xref\n0 %d\n0000000000 65535 f \n", count)
+		for n := 1; n < count; n++ {
+			if obj, ok := objects[n]; ok {
+				write("%010d %05d n \n", obj.offset, obj.gen)
+			} else {
+				write("0000000000 00000 f \n")
+			}
+		}
+		write("trailer\n<< /Size %d /Root %d %d R >>\nstartxref\n%d\n%%%%EOF\n", count, root, rootGen, start)
+	}
+	if err := w.Flush(); err != nil {
+		return "", 0, err
+	}
+	return path, len(objects), nil
+}
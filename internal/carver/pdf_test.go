@@ -0,0 +1,139 @@
+package carver
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// pdfBody is a two-page document, without its cross-reference table
+const pdfBody = "%PDF-1.4\n" +
+	"1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n" +
+	"2 0 obj\n<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >>\nendobj\n" +
+	"3 0 obj\n<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>\nendobj\n" +
+	"4 0 obj\n<< /Type /Page /Parent 2 0 R >>\nendobj\n" +
+	"5 0 obj\n<< /Length 9 >>\nstream\nBT ET q Q\nendstream\nendobj\n"
+
+// pdfTrailer is the table and trailer that pdfBody lost
+func pdfTrailer(body string) string {
+	xref := "xref\n0 6\n0000000000 65535 f \n"
+	for n := 1; n <= 5; n++ {
+		xref += fmt.Sprintf("%010d 00000 n \n", strings.Index(body, fmt.Sprintf("\n%d 0 obj", n))+1)
+	}
+	return xref + fmt.Sprintf("trailer\n<< /Size 6 /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(body))
+}
+
+func TestPDFObjects(t *testing.T) {
+	if !pdfXrefIntact(strings.NewReader(pdfBody+pdfTrailer(pdfBody)), int64(len(pdfBody+pdfTrailer(pdfBody)))) {
+		t.Error("Expected an intact PDF to be recognised")
+	}
+
+	// Object 6 is cut off, and another PDF follows
+	data := pdfBody + "6 0 obj\n<< /Type /Page /Parent" + "\n%PDF-1.7\n1 0 obj\n<< >>\nendobj\n"
+	objects, cut := pdfObjects(strings.NewReader(data), int64(len(data)))
+	if len(objects) != 5 || cut != int64(len(pdfBody)-1) {
+		t.Fatalf("Expected 5 objects ending at %d, got %d ending at %d", len(pdfBody)-1, len(objects), cut)
+	}
+	if objects[1].kind != "Catalog" || objects[3].kind != "Page" || objects[2].kind != "Pages" || objects[5].kind != "" {
+		t.Errorf("Unexpected object kinds %+v", objects)
+	}
+	if objects[4].offset != int64(strings.Index(pdfBody, "4 0 obj")) {
+		t.Errorf("Unexpected offset %d for object 4", objects[4].offset)
+	}
+	if pdfXrefIntact(strings.NewReader(data), int64(len(data))) {
+		t.Error("Expected a PDF without startxref to need repair")
+	}
+
+	// Without the catalog and page tree, the pages get new ones
+	delete(objects, 1)
+	delete(objects, 2)
+	root, _, extra := pdfRoot(objects, 6)
+	if root != 7 || len(extra) != 2 || !strings.Contains(extra[0], "/Kids [3 0 R 4 0 R] /Count 2") {
+		t.Errorf("Unexpected new root %d %v", root, extra)
+	}
+}
+
+func TestPDFObjectStream(t *testing.T) {
+	members := "<< /Type /Catalog /Pages 2 0 R >> << /Type /Pages /Kids [3 0 R] /Count 1 >> << /Type /Page /Parent 2 0 R >>"
+	header := "1 0 2 33 3 78 "
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write([]byte(header + members))
+	zw.Close()
+
+	raw := fmt.Sprintf("7 0 obj\n<< /Type /ObjStm /N 3 /First %d /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream\nendobj", len(header), z.Len(), z.String())
+	objects := pdfObjStm([]byte(raw), 7, 100)
+	if len(objects) != 3 {
+		t.Fatalf("Expected 3 members, got %d", len(objects))
+	}
+	if objects[1].num != 2 || objects[1].stream != 7 || objects[1].index != 1 || !bytes.Contains(objects[1].body, []byte("/Count 1")) {
+		t.Errorf("Unexpected member %+v", objects[1])
+	}
+
+	// The members are found when scanning the carving
+	pdf := "%PDF-1.5\n" + raw + "\n"
+	found, _ := pdfObjects(strings.NewReader(pdf), int64(len(pdf)))
+	if len(found) != 4 || found[3].kind != "Page" || found[3].stream != 7 {
+		t.Errorf("Expected the object stream and its 3 members, got %+v", found)
+	}
+	if root, _, extra := pdfRoot(found, 8); root != 1 || extra != nil {
+		t.Errorf("Expected the catalog in the object stream, got %d", root)
+	}
+}
+
+func TestRepairPDF(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	// The tail was overwritten with another file's data
+	data := make([]byte, 64*1024)
+	copy(data[4096:], pdfBody)
+	copy(data[4096+len(pdfBody):], bytes.Repeat([]byte{0xEE}, 1000))
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	carver := NewCarver(reader)
+	sig := findSignature(t, "PDF")
+	sig.MaxSize = 8192
+	file := CarvedFile{Signature: &sig, Offset: 4096}
+	if err := carver.recoverFile(&file, outputDir, 1); err != nil {
+		t.Fatalf("recoverFile failed: %v", err)
+	}
+
+	path, n, err := carver.RepairPDF(&file)
+	if err != nil || n != 5 {
+		t.Fatalf("Expected 5 objects, got %d (%v)", n, err)
+	}
+	if path != filepath.Join(outputDir, "PDF", "carved_000001.repaired.pdf") {
+		t.Errorf("Unexpected path %s", path)
+	}
+	repaired, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read repaired file: %v", err)
+	}
+	body := pdfBody[:len(pdfBody)-1] + "\n"
+	if want := body + pdfTrailer(body); string(repaired) != want {
+		t.Errorf("Unexpected repaired PDF:\n%s\nwant:\n%s", repaired, want)
+	}
+	if err := validatePDF(bytes.NewReader(repaired), int64(len(repaired))); err != nil {
+		t.Errorf("Repaired PDF does not validate: %v", err)
+	}
+
+	// A repaired PDF needs no further repair
+	if !pdfXrefIntact(bytes.NewReader(repaired), int64(len(repaired))) {
+		t.Error("Expected the repaired PDF's table to be found")
+	}
+}
@@ -0,0 +1,75 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// Apple property lists come as XML or in the binary "bplist00" format. A
+// binary plist is the header, the objects, a table of object offsets and a
+// 32-byte trailer giving the offset table's position, its integer size and
+// the object count. The file ends with the trailer, so its length is found
+// by looking for the one trailer whose offset table ends where it starts.
+
+const bplistTrailerSize = 32
+
+// verifyBPlist checks that the first object after the header has a known
+// type marker
+func verifyBPlist(data []byte) bool {
+	if len(data) < 9 {
+		return false
+	}
+	switch data[8] >> 4 {
+	case 0x0, 0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x8, 0xA, 0xC, 0xD:
+		return true
+	}
+	return false
+}
+
+// bplistTrailerAt reports whether t, read at pos, is a trailer whose offset
+// table ends at pos
+func bplistTrailerAt(t []byte, pos int64) bool {
+	for _, b := range t[:5] {
+		if b != 0 {
+			return false
+		}
+	}
+	offsetSize, refSize := int64(t[6]), int64(t[7])
+	objects := binary.BigEndian.Uint64(t[8:])
+	top := binary.BigEndian.Uint64(t[16:])
+	table := binary.BigEndian.Uint64(t[24:])
+	if offsetSize < 1 || offsetSize > 8 || refSize < 1 || refSize > 8 || objects == 0 || top >= objects {
+		return false
+	}
+	if table < 9 || table > uint64(pos) || objects > uint64(pos) {
+		return false
+	}
+	return int64(table)+int64(objects)*offsetSize == pos
+}
+
+// bplistSize searches for the trailer that closes the plist
+func bplistSize(r io.ReaderAt, limit int64) int64 {
+	buf := make([]byte, 64*1024+bplistTrailerSize)
+	var pos int64
+	for pos < limit {
+		n, err := r.ReadAt(buf[:min(int64(len(buf)), limit-pos)], pos)
+		for i := 0; i+bplistTrailerSize <= n; i++ {
+			if at := pos + int64(i); at > 8 && bplistTrailerAt(buf[i:i+bplistTrailerSize], at) {
+				return at + bplistTrailerSize
+			}
+		}
+		if n <= bplistTrailerSize || (err != nil && err != io.EOF) {
+			break
+		}
+		pos += int64(n - bplistTrailerSize)
+	}
+	return 0
+}
+
+// verifyXMLPlist checks for the plist doctype or root element after the XML
+// declaration
+func verifyXMLPlist(data []byte) bool {
+	head := data[:min(int64(len(data)), 512)]
+	return bytes.Contains(head, []byte("<!DOCTYPE plist")) || bytes.Contains(head, []byte("<plist"))
+}
@@ -0,0 +1,100 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// makeBPlist builds a binary plist holding an array of a string and an
+// integer
+func makeBPlist() []byte {
+	plist := []byte("bplist00")
+	var offsets []byte
+	for _, obj := range [][]byte{
+		append([]byte{0x55}, "hello"...), // 5-character ASCII string
+		{0x10, 0x2A},                     // 1-byte integer
+		{0xA2, 0x00, 0x01},               // Array of objects 0 and 1
+	} {
+		offsets = append(offsets, byte(len(plist)))
+		plist = append(plist, obj...)
+	}
+	table := len(plist)
+	plist = append(plist, offsets...)
+
+	trailer := make([]byte, bplistTrailerSize)
+	trailer[6], trailer[7] = 1, 1 // Offset and object reference sizes
+	binary.BigEndian.PutUint64(trailer[8:], 3)
+	binary.BigEndian.PutUint64(trailer[16:], 2) // Top object
+	binary.BigEndian.PutUint64(trailer[24:], uint64(table))
+	return append(plist, trailer...)
+}
+
+func TestBPlistSize(t *testing.T) {
+	plist := makeBPlist()
+	data := append(append([]byte{}, plist...), bytes.Repeat([]byte{0x00}, 70000)...)
+
+	if !verifyBPlist(plist) {
+		t.Fatal("Expected binary plist to verify")
+	}
+	if got := bplistSize(bytes.NewReader(data), int64(len(data))); got != int64(len(plist)) {
+		t.Errorf("Expected size %d, got %d", len(plist), got)
+	}
+
+	// Without its trailer the plist cannot be sized
+	cut := plist[:len(plist)-bplistTrailerSize]
+	if got := bplistSize(bytes.NewReader(cut), int64(len(cut))); got != 0 {
+		t.Errorf("Expected unknown size, got %d", got)
+	}
+}
+
+func TestCarvePlists(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	xmlPlist := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0"><dict><key>CFBundleName</key><string>Notes</string></dict></plist>`
+	otherXML := `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`
+
+	data := make([]byte, 128*1024)
+	copy(data[4096:], xmlPlist)
+	copy(data[8192:], otherXML)
+	copy(data[70000:], makeBPlist())
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	var sigs []FileSignature
+	for _, sig := range Signatures {
+		if sig.Name == "PLIST" {
+			sigs = append(sigs, sig)
+		}
+	}
+	carver := NewCarver(reader)
+	carver.SetSignatures(sigs)
+	files, err := carver.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(files) != 2 || files[0].Offset != 4096 || files[1].Offset != 70000 {
+		t.Fatalf("Expected the XML and binary plists, got %v", files)
+	}
+
+	if _, size, err := carver.content(files[0]); err != nil || size != int64(len(xmlPlist)) {
+		t.Errorf("Expected XML plist of %d bytes, got %d (%v)", len(xmlPlist), size, err)
+	}
+	if _, size, err := carver.content(files[1]); err != nil || size != int64(len(makeBPlist())) {
+		t.Errorf("Expected binary plist of %d bytes, got %d (%v)", len(makeBPlist()), size, err)
+	}
+}
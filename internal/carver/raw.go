@@ -0,0 +1,327 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// Camera RAW formats are TIFF containers (CR2, NEF, ARW, DNG) or close
+// relatives with their own magic (ORF, RW2). They have no footer, so their
+// length is worked out from the IFD structure: the file ends after the last
+// IFD, tag value, image strip, tile or embedded JPEG it references.
+
+const (
+	tiffMaxIFDs    = 64   // IFDs followed per file, guards against loops
+	tiffMaxEntries = 1024 // Entries per IFD; more means we are not in an IFD
+	tiffMaxValues  = 65536
+)
+
+// TIFF tags used for sizing and classification
+const (
+	tagMake          = 0x010F
+	tagStripOffsets  = 0x0111
+	tagStripCounts   = 0x0117
+	tagTileOffsets   = 0x0144
+	tagTileCounts    = 0x0145
+	tagSubIFDs       = 0x014A
+	tagJPEGOffset    = 0x0201
+	tagJPEGLength    = 0x0202
+	tagExifIFD       = 0x8769
+	tagDNGVersion    = 0xC612
+	tiffHeaderLength = 8
+)
+
+// tiffTypeSizes gives the byte size of each TIFF field type
+var tiffTypeSizes = map[uint16]int64{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8, 13: 4,
+}
+
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	raw   []byte // The 4-byte value/offset field
+}
+
+// tiffReader reads IFDs from a TIFF-structured file
+type tiffReader struct {
+	r     io.ReaderAt
+	limit int64
+	order binary.ByteOrder
+}
+
+// newTIFFReader checks the byte order mark. The magic number is not checked
+// because ORF and RW2 replace it with their own.
+func newTIFFReader(r io.ReaderAt, limit int64) (*tiffReader, uint32, bool) {
+	hdr := make([]byte, tiffHeaderLength)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return nil, 0, false
+	}
+	t := &tiffReader{r: r, limit: limit}
+	switch string(hdr[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, 0, false
+	}
+	return t, t.order.Uint32(hdr[4:8]), true
+}
+
+// size returns the byte length of the entry's value
+func (t *tiffReader) size(e tiffEntry) int64 {
+	return tiffTypeSizes[e.typ] * int64(e.count)
+}
+
+// readIFD returns the entries of the IFD at off, the offset just past it and
+// the offset of the next IFD
+func (t *tiffReader) readIFD(off int64) ([]tiffEntry, int64, int64, bool) {
+	if off < tiffHeaderLength || off+2 > t.limit {
+		return nil, 0, 0, false
+	}
+	var countBuf [2]byte
+	if _, err := t.r.ReadAt(countBuf[:], off); err != nil {
+		return nil, 0, 0, false
+	}
+	count := int64(t.order.Uint16(countBuf[:]))
+	if count == 0 || count > tiffMaxEntries {
+		return nil, 0, 0, false
+	}
+
+	end := off + 2 + count*12 + 4
+	if end > t.limit {
+		return nil, 0, 0, false
+	}
+	buf := make([]byte, count*12+4)
+	if _, err := t.r.ReadAt(buf, off+2); err != nil {
+		return nil, 0, 0, false
+	}
+
+	entries := make([]tiffEntry, count)
+	for i := range entries {
+		e := buf[i*12 : i*12+12]
+		entries[i] = tiffEntry{
+			tag:   t.order.Uint16(e[0:2]),
+			typ:   t.order.Uint16(e[2:4]),
+			count: t.order.Uint32(e[4:8]),
+			raw:   e[8:12],
+		}
+	}
+	next := int64(t.order.Uint32(buf[count*12:]))
+	return entries, end, next, true
+}
+
+// data returns the value bytes of an entry, reading them from their offset
+// when they do not fit in the entry itself
+func (t *tiffReader) data(e tiffEntry) ([]byte, bool) {
+	n := t.size(e)
+	if n <= 4 {
+		return e.raw[:n], true
+	}
+	off := int64(t.order.Uint32(e.raw))
+	if n > tiffMaxValues*8 || off+n > t.limit {
+		return nil, false
+	}
+	buf := make([]byte, n)
+	if _, err := t.r.ReadAt(buf, off); err != nil {
+		return nil, false
+	}
+	return buf, true
+}
+
+// values decodes a SHORT, LONG or IFD entry as a list of integers
+func (t *tiffReader) values(e tiffEntry) ([]int64, bool) {
+	if e.count > tiffMaxValues {
+		return nil, false
+	}
+	data, ok := t.data(e)
+	if !ok {
+		return nil, false
+	}
+	vals := make([]int64, e.count)
+	for i := range vals {
+		switch e.typ {
+		case 3:
+			vals[i] = int64(t.order.Uint16(data[i*2:]))
+		case 4, 13:
+			vals[i] = int64(t.order.Uint32(data[i*4:]))
+		default:
+			return nil, false
+		}
+	}
+	return vals, true
+}
+
+// tiffSize walks the IFD chain, SubIFDs and the EXIF IFD and returns the end
+// of the furthest structure referenced, or 0 if the layout cannot be followed
+func tiffSize(r io.ReaderAt, limit int64) int64 {
+	t, first, ok := newTIFFReader(r, limit)
+	if !ok {
+		return 0
+	}
+
+	end := int64(tiffHeaderLength)
+	extend := func(off, length int64) bool {
+		if off < 0 || length < 0 || off+length > limit {
+			return false
+		}
+		end = max(end, off+length)
+		return true
+	}
+
+	queue := []int64{int64(first)}
+	visited := make(map[int64]bool)
+	for len(queue) > 0 && len(visited) < tiffMaxIFDs {
+		off := queue[0]
+		queue = queue[1:]
+		if visited[off] {
+			continue
+		}
+		visited[off] = true
+
+		entries, ifdEnd, next, ok := t.readIFD(off)
+		if !ok {
+			if off == int64(first) {
+				return 0
+			}
+			continue
+		}
+		extend(off, ifdEnd-off)
+
+		var offsets, counts, tileOffsets, tileCounts []int64
+		var jpegOffset, jpegLength int64
+		for _, e := range entries {
+			if n := t.size(e); n > 4 {
+				extend(int64(t.order.Uint32(e.raw)), n)
+			}
+			switch e.tag {
+			case tagStripOffsets:
+				offsets, _ = t.values(e)
+			case tagStripCounts:
+				counts, _ = t.values(e)
+			case tagTileOffsets:
+				tileOffsets, _ = t.values(e)
+			case tagTileCounts:
+				tileCounts, _ = t.values(e)
+			case tagJPEGOffset, tagJPEGLength:
+				if v, ok := t.values(e); ok && len(v) == 1 {
+					if e.tag == tagJPEGOffset {
+						jpegOffset = v[0]
+					} else {
+						jpegLength = v[0]
+					}
+				}
+			case tagSubIFDs, tagExifIFD:
+				if v, ok := t.values(e); ok {
+					queue = append(queue, v...)
+				}
+			}
+		}
+
+		// Image data must be fully accounted for, otherwise the size is a guess
+		if !extendRuns(offsets, counts, extend) || !extendRuns(tileOffsets, tileCounts, extend) {
+			return 0
+		}
+		if jpegLength > 0 {
+			extend(jpegOffset, jpegLength)
+		}
+
+		if next != 0 {
+			queue = append(queue, next)
+		}
+	}
+
+	return end
+}
+
+// extendRuns extends the file end over each offset/length pair. A run with a
+// missing or zero length makes the file size unknown.
+func extendRuns(offsets, counts []int64, extend func(off, length int64) bool) bool {
+	if len(offsets) != len(counts) {
+		return false
+	}
+	for i := range offsets {
+		if counts[i] == 0 || !extend(offsets[i], counts[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ifd0 returns the entries of the first IFD of TIFF data at the start of a
+// scan buffer
+func ifd0(data []byte) (*tiffReader, []tiffEntry, bool) {
+	r := bytes.NewReader(data)
+	t, first, ok := newTIFFReader(r, int64(len(data)))
+	if !ok {
+		return nil, nil, false
+	}
+	entries, _, _, ok := t.readIFD(int64(first))
+	return t, entries, ok
+}
+
+// tiffMake returns the camera manufacturer recorded in IFD0
+func tiffMake(t *tiffReader, entries []tiffEntry) string {
+	for _, e := range entries {
+		if e.tag == tagMake && e.typ == 2 {
+			if data, ok := t.data(e); ok {
+				return strings.ToUpper(strings.TrimRight(string(data), "\x00 "))
+			}
+		}
+	}
+	return ""
+}
+
+// hasTag reports whether an IFD contains the given tag
+func hasTag(entries []tiffEntry, tag uint16) bool {
+	for _, e := range entries {
+		if e.tag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// rawKind classifies TIFF data as a camera RAW format by its IFD0, returning
+// the signature name or "" for a plain TIFF
+func rawKind(data []byte) string {
+	if len(data) >= 10 && string(data[8:10]) == "CR" {
+		return "CR2"
+	}
+	t, entries, ok := ifd0(data)
+	if !ok {
+		return ""
+	}
+	if hasTag(entries, tagDNGVersion) {
+		return "DNG"
+	}
+	switch maker := tiffMake(t, entries); {
+	case strings.HasPrefix(maker, "NIKON"):
+		return "NEF"
+	case strings.HasPrefix(maker, "SONY"):
+		return "ARW"
+	}
+	return ""
+}
+
+// verifyTIFF accepts TIFF files with a readable IFD0 that are not camera RAW,
+// which have signatures of their own
+func verifyTIFF(data []byte) bool {
+	if _, _, ok := ifd0(data); !ok {
+		return false
+	}
+	return rawKind(data) == ""
+}
+
+func verifyNEF(data []byte) bool { return rawKind(data) == "NEF" }
+func verifyARW(data []byte) bool { return rawKind(data) == "ARW" }
+func verifyDNG(data []byte) bool { return rawKind(data) == "DNG" }
+
+// verifyRawIFD checks that a RAW file with its own magic has a readable IFD0
+func verifyRawIFD(data []byte) bool {
+	_, _, ok := ifd0(data)
+	return ok
+}
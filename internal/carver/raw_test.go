@@ -0,0 +1,144 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// makeTIFF builds a little-endian TIFF with a Make tag, optional DNGVersion
+// and one image strip of stripLen bytes placed after the IFD
+func makeTIFF(maker string, dng bool, stripLen int) []byte {
+	return makeOrderedTIFF(binary.LittleEndian, maker, dng, stripLen)
+}
+
+func makeOrderedTIFF(order binary.AppendByteOrder, maker string, dng bool, stripLen int) []byte {
+	type entry struct {
+		tag, typ   uint16
+		count, val uint32
+		data       []byte
+	}
+
+	makeData := append([]byte(maker), 0)
+	entries := []entry{
+		{tag: tagMake, typ: 2, count: uint32(len(makeData)), data: makeData},
+		{tag: tagStripOffsets, typ: 4, count: 1},
+		{tag: tagStripCounts, typ: 4, count: 1, val: uint32(stripLen)},
+	}
+	if dng {
+		entries = append(entries, entry{tag: tagDNGVersion, typ: 1, count: 4, val: 0x00000401})
+	}
+
+	ifdLen := 2 + 12*len(entries) + 4
+	dataOff := 8 + ifdLen
+	stripOff := dataOff + len(makeData)
+
+	buf := []byte{'I', 'I', 0x2A, 0x00}
+	if order == binary.BigEndian {
+		buf = []byte{'M', 'M', 0x00, 0x2A}
+	}
+	buf = order.AppendUint32(buf, 8)
+	buf = order.AppendUint16(buf, uint16(len(entries)))
+	for _, e := range entries {
+		buf = order.AppendUint16(buf, e.tag)
+		buf = order.AppendUint16(buf, e.typ)
+		buf = order.AppendUint32(buf, e.count)
+		switch {
+		case e.data != nil && len(e.data) > 4:
+			buf = order.AppendUint32(buf, uint32(dataOff))
+		case e.tag == tagStripOffsets:
+			buf = order.AppendUint32(buf, uint32(stripOff))
+		default:
+			buf = order.AppendUint32(buf, e.val)
+		}
+	}
+	buf = order.AppendUint32(buf, 0) // No next IFD
+	buf = append(buf, makeData...)
+	buf = append(buf, bytes.Repeat([]byte{0x5A}, stripLen)...)
+	return buf
+}
+
+func TestRawKind(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{makeTIFF("NIKON CORPORATION", false, 16), "NEF"},
+		{makeTIFF("SONY", false, 16), "ARW"},
+		{makeTIFF("Canon", true, 16), "DNG"},
+		{makeTIFF("Scanner Co", false, 16), ""},
+		{append([]byte{'I', 'I', 0x2A, 0x00, 0x10, 0, 0, 0, 'C', 'R'}, make([]byte, 64)...), "CR2"},
+	}
+
+	for _, tt := range tests {
+		if got := rawKind(tt.data); got != tt.want {
+			t.Errorf("rawKind(%q...) = %q, want %q", tt.data[:10], got, tt.want)
+		}
+	}
+
+	if !verifyTIFF(makeTIFF("Scanner Co", false, 16)) {
+		t.Error("Expected plain TIFF to pass verifyTIFF")
+	}
+	if verifyTIFF(makeTIFF("NIKON", false, 16)) {
+		t.Error("Expected NEF to be rejected by verifyTIFF")
+	}
+}
+
+func TestTIFFSize(t *testing.T) {
+	tiff := makeTIFF("SONY", false, 5000)
+	data := append(append([]byte{}, tiff...), bytes.Repeat([]byte{0xEE}, 4096)...)
+
+	if got := tiffSize(bytes.NewReader(data), int64(len(data))); got != int64(len(tiff)) {
+		t.Errorf("Expected size %d, got %d", len(tiff), got)
+	}
+
+	// A strip running past the limit means the size is unknown
+	if got := tiffSize(bytes.NewReader(data), 1000); got != 0 {
+		t.Errorf("Expected unknown size for truncated TIFF, got %d", got)
+	}
+}
+
+func TestCarveRAW(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	nef := makeOrderedTIFF(binary.BigEndian, "NIKON CORPORATION", false, 3000)
+
+	data := make([]byte, 128*1024)
+	copy(data[4096:], nef)
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	carver := NewCarver(reader)
+	files, err := carver.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(files) != 1 || files[0].Signature.Name != "NEF" || files[0].Offset != 4096 {
+		t.Fatalf("Expected one NEF at 4096, got %v", files)
+	}
+
+	path, err := carver.RecoverFile(files[0], outputDir, 0)
+	if err != nil {
+		t.Fatalf("RecoverFile failed: %v", err)
+	}
+	recovered, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read recovered file: %v", err)
+	}
+	if !bytes.Equal(recovered, nef) {
+		t.Errorf("Expected %d byte NEF, got %d bytes", len(nef), len(recovered))
+	}
+}
@@ -0,0 +1,60 @@
+package carver
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Windows registry hives (SYSTEM, SOFTWARE, NTUSER.DAT, ...) start with a
+// 4KB "regf" base block followed by hive bins. Each bin starts with "hbin",
+// its offset from the first bin and its size, so walking the bins gives the
+// hive length even when the base block's own length field is stale.
+
+const (
+	regfBaseBlockSize = 4096
+	regfBinsSize      = 0x28 // Hive bins data size in the base block
+	hbinHeaderSize    = 32
+)
+
+// verifyRegistry checks the base block's version and file type fields
+func verifyRegistry(data []byte) bool {
+	if len(data) < 0x24 {
+		return false
+	}
+	major := binary.LittleEndian.Uint32(data[0x14:])
+	minor := binary.LittleEndian.Uint32(data[0x18:])
+	fileType := binary.LittleEndian.Uint32(data[0x1C:])
+	format := binary.LittleEndian.Uint32(data[0x20:])
+	return major == 1 && minor >= 2 && minor <= 6 && fileType <= 2 && format == 1
+}
+
+// registrySize walks the hive bins following the base block. If no bin can
+// be read the length recorded in the base block is used.
+func registrySize(r io.ReaderAt, limit int64) int64 {
+	base := make([]byte, regfBaseBlockSize)
+	if _, err := r.ReadAt(base, 0); err != nil || !verifyRegistry(base) {
+		return 0
+	}
+
+	var hdr [hbinHeaderSize]byte
+	pos := int64(regfBaseBlockSize)
+	for pos+hbinHeaderSize <= limit {
+		if _, err := r.ReadAt(hdr[:], pos); err != nil || string(hdr[:4]) != "hbin" {
+			break
+		}
+		binOffset := int64(binary.LittleEndian.Uint32(hdr[4:8]))
+		binSize := int64(binary.LittleEndian.Uint32(hdr[8:12]))
+		if binOffset != pos-regfBaseBlockSize || binSize == 0 || binSize%regfBaseBlockSize != 0 || pos+binSize > limit {
+			break
+		}
+		pos += binSize
+	}
+
+	if pos > regfBaseBlockSize {
+		return pos
+	}
+	if recorded := regfBaseBlockSize + int64(binary.LittleEndian.Uint32(base[regfBinsSize:])); recorded > regfBaseBlockSize && recorded <= limit {
+		return recorded
+	}
+	return 0
+}
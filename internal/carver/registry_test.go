@@ -0,0 +1,54 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// makeHive builds a base block followed by hive bins of the given sizes
+func makeHive(binSizes ...int) []byte {
+	hive := make([]byte, regfBaseBlockSize)
+	copy(hive, "regf")
+	binary.LittleEndian.PutUint32(hive[0x14:], 1)
+	binary.LittleEndian.PutUint32(hive[0x18:], 5)
+	binary.LittleEndian.PutUint32(hive[0x20:], 1)
+
+	total := 0
+	for _, size := range binSizes {
+		bin := make([]byte, size)
+		copy(bin, "hbin")
+		binary.LittleEndian.PutUint32(bin[4:], uint32(total))
+		binary.LittleEndian.PutUint32(bin[8:], uint32(size))
+		hive = append(hive, bin...)
+		total += size
+	}
+	binary.LittleEndian.PutUint32(hive[regfBinsSize:], uint32(total))
+	return hive
+}
+
+func TestRegistrySize(t *testing.T) {
+	hive := makeHive(4096, 8192, 4096)
+	data := append(append([]byte{}, hive...), bytes.Repeat([]byte{0xAB}, 8192)...)
+	if got := registrySize(bytes.NewReader(data), int64(len(data))); got != int64(len(hive)) {
+		t.Errorf("Expected size %d, got %d", len(hive), got)
+	}
+
+	// A bin whose offset does not match its position ends the hive
+	broken := makeHive(4096, 4096)
+	binary.LittleEndian.PutUint32(broken[regfBaseBlockSize+4096+4:], 12345)
+	if got := registrySize(bytes.NewReader(broken), int64(len(broken))); got != regfBaseBlockSize+4096 {
+		t.Errorf("Expected size %d, got %d", regfBaseBlockSize+4096, got)
+	}
+
+	// Without readable bins the base block's length is used
+	header := makeHive(4096)[:regfBaseBlockSize]
+	data = append(append([]byte{}, header...), make([]byte, 8192)...)
+	if got := registrySize(bytes.NewReader(data), int64(len(data))); got != regfBaseBlockSize+4096 {
+		t.Errorf("Expected recorded size %d, got %d", regfBaseBlockSize+4096, got)
+	}
+
+	if verifyRegistry(append([]byte("regf"), make([]byte, 60)...)) {
+		t.Error("Expected base block without version fields to be rejected")
+	}
+}
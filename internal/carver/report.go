@@ -0,0 +1,443 @@
+package carver
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// A scan report is what a run found, for tools rather than people: the
+// source, its FAT32 and NTFS volumes, and every file on them and every
+// carved file with an id, where its bytes lie on the source and whether it
+// is live, deleted or carved:
+//
+//	{
+//	  "tool": {"name": "recover", "version": "1.4.0"},
+//	  "source": {"path": "disk.img", "size": 8589934592},
+//	  "volumes": [{"name": "partition1", "offset": 1048576, "filesystem": "ntfs", ...}],
+//	  "files": [
+//	    {"id": 3222440960, "path": "partition1/Users/anna/report.docx", "status": "deleted",
+//	     "size": 20480, "modified": "2021-06-14T09:55:21Z",
+//	     "data_runs": [{"offset": 88604672, "length": 20480}], ...},
+//
+// Paths are below partitionN/ on a partitioned disk, as with the timeline,
+// and carved files' below the output directory. A file's id is the offset
+// on the source of its MFT record or directory entry, and a carved file's
+// where it starts, so it is the same on every run over the same source,
+// whatever was deleted or filtered since.
+//
+// ReportCSV writes the file list alone, a row per file, for reviewing in a
+// spreadsheet:
+//
+//	id,path,source,status,type,size,deleted,created,modified,changed,accessed,recoverable
+//	3222440960,partition1/Users/anna/report.docx,ntfs,deleted,docx,20480,true,...,complete
+//
+// How recoverable a file is is judged from where its data lies: a deleted
+// file is complete when it has all its data runs and no live file has taken
+// them, overwritten when one has, partial when runs are missing and none
+// when it has none left; a carved file is damaged when validation failed.
+
+// Version is the version of the tool written to reports, set when building
+// with -ldflags "-X github.com/shubham/recovery/internal/carver.Version=..."
+var Version = "dev"
+
+// ReportFormat selects the format of the scan report
+type ReportFormat int
+
+const (
+	ReportOff ReportFormat = iota
+	ReportJSON
+	ReportCSV
+)
+
+// ReportName is the scan report written below the output directory, with
+// its format's extension
+const ReportName = "scan"
+
+// ParseReportFormat parses the -report flag
+func ParseReportFormat(s string) (ReportFormat, error) {
+	switch strings.ToLower(s) {
+	case "", "off", "none":
+		return ReportOff, nil
+	case "json":
+		return ReportJSON, nil
+	case "csv":
+		return ReportCSV, nil
+	}
+	return ReportOff, fmt.Errorf("unknown report format %q (want off, json or csv)", s)
+}
+
+// File returns the name of the report file in this format
+func (f ReportFormat) File() string {
+	switch f {
+	case ReportJSON:
+		return ReportName + ".json"
+	case ReportCSV:
+		return ReportName + ".csv"
+	}
+	return ""
+}
+
+// Report is the scan report
+type Report struct {
+	Tool      ReportTool     `json:"tool"`
+	Generated string         `json:"generated"`
+	Source    ReportSource   `json:"source"`
+	Volumes   []ReportVolume `json:"volumes"`
+	Filter    *ReportFilter  `json:"filter,omitempty"`
+	Files     []ReportEntry  `json:"files"`
+}
+
+// ReportFilter is the filter of the files a report lists (see disk.Filter),
+// with how many it left out by why: directory, name, path, too_small,
+// too_large, modified or created
+type ReportFilter struct {
+	Include        []string       `json:"include,omitempty"`
+	Exclude        []string       `json:"exclude,omitempty"`
+	PathRegex      string         `json:"path_regex,omitempty"`
+	MinSize        int64          `json:"min_size,omitempty"`
+	MaxSize        int64          `json:"max_size,omitempty"`
+	ModifiedAfter  string         `json:"modified_after,omitempty"`  // RFC 3339, included
+	ModifiedBefore string         `json:"modified_before,omitempty"` // RFC 3339, not included
+	CreatedAfter   string         `json:"created_after,omitempty"`
+	CreatedBefore  string         `json:"created_before,omitempty"`
+	LeftOut        map[string]int `json:"left_out"`                // Files and directories of the volumes
+	HitsLeftOut    map[string]int `json:"hits_left_out,omitempty"` // Carved hits, never listed
+}
+
+// ReportTool names the tool that wrote a report
+type ReportTool struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// ReportSource is the device or image scanned
+type ReportSource struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// ReportVolume is a FAT32 or NTFS volume of the source
+type ReportVolume struct {
+	Name       string `json:"name,omitempty"` // partitionN, or "" for the whole disk
+	Offset     int64  `json:"offset"`
+	Size       int64  `json:"size"`
+	Filesystem string `json:"filesystem"`
+	Files      int    `json:"files"`
+	Deleted    int    `json:"deleted"`
+}
+
+// ReportEntry is a file of a volume or a carved file
+type ReportEntry struct {
+	ID       int         `json:"id"` // Offset on the source of its MFT record or directory entry, or where a carved file starts
+	Path     string      `json:"path"`
+	Source   string      `json:"source"` // ntfs, fat32 or carved
+	Status   string      `json:"status"` // allocated, deleted, carved, or found by a scan
+	Dir      bool        `json:"dir,omitempty"`
+	Size     int64       `json:"size"`
+	Inode    uint64      `json:"inode,omitempty"`
+	Type     string      `json:"type,omitempty"` // Format of a carved file, extension of another
+	Created  string      `json:"created,omitempty"`
+	Modified string      `json:"modified,omitempty"`
+	Changed  string      `json:"changed,omitempty"`
+	Accessed string      `json:"accessed,omitempty"`
+	Resident bool        `json:"resident,omitempty"` // Data kept in the NTFS MFT record
+	Runs     []ReportRun `json:"data_runs,omitempty"`
+	SHA256   string      `json:"sha256,omitempty"`
+
+	Recoverable string `json:"recoverable,omitempty"` // complete, partial, overwritten, none or damaged; "" for directories
+}
+
+// ReportRun is a contiguous range of a file's data on the source
+type ReportRun struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// BuildReport lists the files of the disk's FAT32 and NTFS volumes and the
+// carved files given, which are only found, not written, with scanOnly
+func BuildReport(reader *disk.Reader, outputDir string, carved []CarvedFile, scanOnly bool) Report {
+	defer reader.Purpose("file listing")()
+	report := Report{
+		Tool:      ReportTool{Name: "recover", Version: Version},
+		Generated: time.Now().UTC().Format(time.RFC3339),
+		Source:    ReportSource{Path: reader.Path(), Size: reader.Size()},
+		Volumes:   []ReportVolume{},
+		Files:     []ReportEntry{},
+	}
+
+	filter := reader.Filter()
+	if filter.Active() {
+		report.Filter = &ReportFilter{
+			Include:        filter.Include,
+			Exclude:        filter.Exclude,
+			PathRegex:      pathRegex(filter.Path),
+			MinSize:        filter.MinSize,
+			MaxSize:        filter.MaxSize,
+			ModifiedAfter:  filterTime(filter.ModifiedAfter),
+			ModifiedBefore: filterTime(filter.ModifiedBefore),
+			CreatedAfter:   filterTime(filter.CreatedAfter),
+			CreatedBefore:  filterTime(filter.CreatedBefore),
+			LeftOut:        make(map[string]int),
+			HitsLeftOut:    reader.HitsLeftOut(),
+		}
+	}
+	for _, v := range ListVolumes(reader) {
+		for i, e := range v.Entries {
+			if why := filter.Leaves(v.Files[i]); why != "" {
+				report.Filter.LeftOut[why]++
+				continue
+			}
+			report.Files = append(report.Files, e)
+		}
+		report.Volumes = append(report.Volumes, v.Volume)
+	}
+
+	for _, c := range carved {
+		if c.Path == "" && !scanOnly {
+			continue // Folded into another file or dropped
+		}
+		report.Files = append(report.Files, carvedEntry(outputDir, c))
+	}
+	return report
+}
+
+// VolumeFiles is a FAT32 or NTFS volume of a disk with the files its
+// filesystem lists
+type VolumeFiles struct {
+	Volume  ReportVolume
+	Reader  *disk.Reader     // Of the volume
+	Files   []disk.FileEntry // Within the volume
+	Entries []ReportEntry    // The files as reported, in the same order
+
+	// Recover writes one of Files to a path, and Open reads it; Inspect
+	// decodes its record, and is nil when the filesystem cannot
+	Recover func(e disk.FileEntry, path string) (disk.Digest, error)
+	Open    func(e disk.FileEntry) (io.Reader, error)
+	Inspect func(e disk.FileEntry) (disk.Record, error)
+}
+
+// ListVolumes lists the files of the disk's FAT32 and NTFS volumes, in the
+// order a report gives them
+func ListVolumes(reader *disk.Reader) []VolumeFiles {
+	var volumes []VolumeFiles
+	for _, v := range diskVolumes(reader) {
+		if reader.Err() != nil {
+			break
+		}
+		fs, err := disk.DetectFilesystem(v.reader)
+		if err != nil {
+			reader.Debugf("  No filesystem listed at offset %d: %v\n", v.Offset, err)
+			continue
+		}
+		filesystem := disk.LookupFilesystem(fs)
+		if filesystem == nil {
+			continue
+		}
+		vf := VolumeFiles{Reader: v.reader}
+		volume, files, err := filesystem.Scan(v.reader)
+		if volume == nil {
+			continue
+		}
+		vf.Files, vf.Recover, vf.Open = files, volume.RecoverEntry, volume.OpenEntry
+		if inspector, ok := volume.(disk.Inspector); ok {
+			vf.Inspect = inspector.Inspect
+		}
+		if err != nil {
+			reader.Errorf("  Failed to list the files of %s: %v\n", fs, err)
+			continue
+		}
+
+		vf.Volume = ReportVolume{Name: v.name, Offset: v.Offset, Size: v.reader.Size(), Filesystem: fs, Files: len(vf.Files)}
+		var live []disk.Extent
+		for _, e := range vf.Files {
+			if !e.Deleted {
+				live = append(live, e.Extents...)
+			}
+		}
+		live = mergeExtents(live)
+		for _, e := range vf.Files {
+			if e.Deleted {
+				vf.Volume.Deleted++
+			}
+			vf.Entries = append(vf.Entries, volumeEntry(v, fs, e, live))
+		}
+		volumes = append(volumes, vf)
+	}
+	return volumes
+}
+
+// volumeEntry reports a file of a volume; live are the extents of its live
+// files, merged
+func volumeEntry(v volume, fs string, e disk.FileEntry, live []disk.Extent) ReportEntry {
+	entry := ReportEntry{
+		ID:       int(v.Offset + e.Record),
+		Path:     filepath.ToSlash(filepath.Join(v.name, e.Path)),
+		Source:   fs,
+		Status:   "allocated",
+		Dir:      e.Dir,
+		Size:     e.Size,
+		Inode:    e.Inode,
+		Created:  dfxmlTime(e.Created),
+		Modified: dfxmlTime(e.Modified),
+		Changed:  dfxmlTime(e.Changed),
+		Accessed: dfxmlTime(e.Accessed),
+		Resident: e.Resident != nil,
+	}
+	if e.Deleted {
+		entry.Status = "deleted"
+	}
+	if !e.Dir {
+		entry.Type = strings.ToLower(strings.TrimPrefix(filepath.Ext(e.Path), "."))
+		entry.Recoverable = recoverability(e, live)
+	}
+	for _, ext := range e.Extents {
+		entry.Runs = append(entry.Runs, ReportRun{Offset: v.Offset + ext.Offset, Length: ext.Length})
+	}
+	return entry
+}
+
+// recoverability judges how much of a file's data is still on its volume
+func recoverability(e disk.FileEntry, live []disk.Extent) string {
+	if !e.Deleted || e.Resident != nil || e.Size == 0 {
+		return "complete"
+	}
+	if len(e.Extents) == 0 {
+		return "none"
+	}
+	var found int64
+	for _, ext := range e.Extents {
+		if covered(ext, live) > 0 {
+			return "overwritten"
+		}
+		found += ext.Length
+	}
+	if found < e.Size {
+		return "partial"
+	}
+	return "complete"
+}
+
+// mergeExtents sorts extents by offset and merges those that overlap or
+// touch
+func mergeExtents(extents []disk.Extent) []disk.Extent {
+	sort.Slice(extents, func(i, j int) bool { return extents[i].Offset < extents[j].Offset })
+	var merged []disk.Extent
+	for _, e := range extents {
+		if n := len(merged); n > 0 && e.Offset <= merged[n-1].Offset+merged[n-1].Length {
+			merged[n-1].Length = max(merged[n-1].Length, e.Offset+e.Length-merged[n-1].Offset)
+			continue
+		}
+		merged = append(merged, e)
+	}
+	return merged
+}
+
+// covered returns how many bytes of ext the merged extents cover
+func covered(ext disk.Extent, merged []disk.Extent) int64 {
+	end := ext.Offset + ext.Length
+	var n int64
+	for k := sort.Search(len(merged), func(k int) bool { return merged[k].Offset+merged[k].Length > ext.Offset }); k < len(merged) && merged[k].Offset < end; k++ {
+		n += min(end, merged[k].Offset+merged[k].Length) - max(ext.Offset, merged[k].Offset)
+	}
+	return n
+}
+
+// carvedEntry reports a carved file
+func carvedEntry(outputDir string, c CarvedFile) ReportEntry {
+	entry := ReportEntry{ID: int(c.Offset), Source: "carved", Status: "found", Size: c.Size, SHA256: c.SHA256, Recoverable: "complete"}
+	if c.Verdict == Invalid {
+		entry.Recoverable = "damaged"
+	}
+	if c.Signature != nil {
+		entry.Type = c.typeName()
+	}
+	if c.Path != "" {
+		entry.Status = "carved"
+		entry.Path = c.Path
+		if rel, err := filepath.Rel(outputDir, c.Path); err == nil {
+			entry.Path = rel
+		}
+		entry.Path = filepath.ToSlash(entry.Path)
+	}
+	fragments := c.Fragments
+	if fragments == nil {
+		fragments = []Fragment{{Offset: c.Offset, Length: c.Size}}
+	}
+	for _, fr := range fragments {
+		entry.Runs = append(entry.Runs, ReportRun{Offset: fr.Offset, Length: fr.Length})
+	}
+	return entry
+}
+
+// WriteReport writes the scan report below outputDir in the format given
+// and returns the number of files in it
+func WriteReport(reader *disk.Reader, outputDir string, format ReportFormat, carved []CarvedFile, scanOnly bool) (int, error) {
+	if format == ReportOff {
+		return 0, nil
+	}
+	report := BuildReport(reader, outputDir, carved, scanOnly)
+	if err := reader.Err(); err != nil {
+		return 0, err // Not listed in full
+	}
+
+	path := filepath.Join(outputDir, format.File())
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	switch format {
+	case ReportJSON:
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	case ReportCSV:
+		err = writeReportCSV(f, report.Files)
+	}
+	if err != nil {
+		return 0, err
+	}
+	reader.Printf("\nListed %d files in %s\n", len(report.Files), path)
+	return len(report.Files), f.Close()
+}
+
+// writeReportCSV writes a row per file
+func writeReportCSV(out io.Writer, files []ReportEntry) error {
+	w := csv.NewWriter(out)
+	w.Write([]string{"id", "path", "source", "status", "type", "size", "deleted", "created", "modified", "changed", "accessed", "recoverable"})
+	for _, e := range files {
+		w.Write([]string{
+			strconv.Itoa(e.ID), e.Path, e.Source, e.Status, e.Type, strconv.FormatInt(e.Size, 10),
+			strconv.FormatBool(e.Status == "deleted"), e.Created, e.Modified, e.Changed, e.Accessed, e.Recoverable,
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// filterTime formats a bound of a filter, or "" for none
+func filterTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// pathRegex returns the expression of a filter's Path, as it was given
+func pathRegex(re *regexp.Regexp) string {
+	if re == nil {
+		return ""
+	}
+	return strings.TrimPrefix(re.String(), "(?i)")
+}
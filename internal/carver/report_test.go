@@ -0,0 +1,189 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func TestWriteReport(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	// REPORT.TXT, 11 bytes in cluster 3, and a deleted OLD.TXT
+	volume := makeFAT32(8, 2, 3)
+	dataStart := 34 * 512
+	root := volume[dataStart:]
+	copy(root, "REPORT  TXT")
+	binary.LittleEndian.PutUint16(root[24:], (2021-1980)<<9|7<<5|1)
+	binary.LittleEndian.PutUint16(root[26:], 3)
+	binary.LittleEndian.PutUint32(root[28:], 11)
+	copy(root[32:], "\xE5LD     TXT")
+	copy(volume[dataStart+4096:], "hello world")
+
+	if err := os.WriteFile(tmpFile, volume, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	outputDir := filepath.Join(tmpDir, "out")
+	os.MkdirAll(outputDir, 0755)
+	txt := &FileSignature{Name: "TXT", Extension: ".txt"}
+	carved := []CarvedFile{
+		{Signature: txt, Path: filepath.Join(outputDir, "TXT", "carved_000001.txt"), Offset: int64(dataStart + 4096), Size: 11, SHA256: "abc"},
+		{Signature: txt, Offset: 99, Size: 1}, // Dropped, never written
+	}
+
+	n, err := WriteReport(reader, outputDir, ReportJSON, carved, false)
+	if err != nil || n != 3 {
+		t.Fatalf("Expected 3 files reported, got %d (%v)", n, err)
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "scan.json"))
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("Failed to parse report: %v\n%s", err, data)
+	}
+	if report.Tool.Version != Version || report.Source.Path != tmpFile || report.Source.Size != int64(len(volume)) {
+		t.Errorf("Unexpected header %+v %+v", report.Tool, report.Source)
+	}
+	if len(report.Volumes) != 1 || report.Volumes[0].Filesystem != "fat32" || report.Volumes[0].Files != 2 || report.Volumes[0].Deleted != 1 {
+		t.Fatalf("Unexpected volumes %+v", report.Volumes)
+	}
+	if len(report.Files) != 3 {
+		t.Fatalf("Expected 3 files, got:\n%s", data)
+	}
+
+	live, old, carvedEntry := report.Files[0], report.Files[1], report.Files[2]
+	if live.ID != dataStart || live.Path != "REPORT.TXT" || live.Status != "allocated" || live.Size != 11 || live.Modified != "2021-07-01T00:00:00Z" {
+		t.Errorf("Unexpected live file %+v", live)
+	}
+	if len(live.Runs) != 1 || live.Runs[0] != (ReportRun{Offset: int64(dataStart + 4096), Length: 11}) {
+		t.Errorf("Unexpected data runs %+v", live.Runs)
+	}
+	if old.ID != dataStart+32 || old.Path != "?LD.TXT" || old.Status != "deleted" {
+		t.Errorf("Unexpected deleted file %+v", old)
+	}
+	if carvedEntry.ID != dataStart+4096 || carvedEntry.Path != "TXT/carved_000001.txt" || carvedEntry.Status != "carved" ||
+		carvedEntry.Type != "TXT" || carvedEntry.SHA256 != "abc" || carvedEntry.Runs[0].Offset != int64(dataStart+4096) {
+		t.Errorf("Unexpected carved file %+v", carvedEntry)
+	}
+
+	// A scan lists every hit, none of them written
+	report = BuildReport(reader, outputDir, carved, true)
+	if len(report.Files) != 4 || report.Files[3].Status != "found" || report.Files[3].Runs[0].Offset != 99 {
+		t.Errorf("Unexpected scan report %+v", report.Files)
+	}
+
+	// A filter leaves out the files of the volumes it does not keep, the
+	// others keeping their ids, which are where their records lie
+	reader.SetFilter(&disk.Filter{Include: []string{"*.txt"}, Exclude: []string{"report.*"}})
+	report = BuildReport(reader, outputDir, carved[:1], false)
+	if len(report.Files) != 2 || report.Files[0].ID != dataStart+32 || report.Files[1].ID != dataStart+4096 {
+		t.Errorf("Unexpected filtered report %+v", report.Files)
+	}
+	if report.Filter == nil || report.Filter.LeftOut[disk.LeftName] != 1 || report.Filter.Exclude[0] != "report.*" {
+		t.Errorf("Unexpected filter %+v", report.Filter)
+	}
+
+	// OLD.TXT has no times, so it is not known to be modified in July
+	reader.SetFilter(&disk.Filter{ModifiedAfter: time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)})
+	report = BuildReport(reader, outputDir, nil, false)
+	if len(report.Files) != 1 || report.Files[0].Path != "REPORT.TXT" || report.Filter.LeftOut[disk.LeftModified] != 1 {
+		t.Errorf("Unexpected report of July %+v %+v", report.Files, report.Filter)
+	}
+	if report.Filter.ModifiedAfter != "2021-07-01T00:00:00Z" {
+		t.Errorf("Unexpected bound %q", report.Filter.ModifiedAfter)
+	}
+}
+
+func TestWriteReportCSV(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	// REPORT.TXT in cluster 3, and deleted files whose data a live file took,
+	// is still there, was never known and runs past the end of the disk
+	volume := makeFAT32(8, 2, 3)
+	le := binary.LittleEndian
+	root := volume[34*512:]
+	for i, f := range []struct {
+		name    string
+		cluster uint16
+		size    uint32
+	}{
+		{"REPORT  TXT", 3, 11},
+		{"\xE5ONE    TXT", 3, 5},
+		{"\xE5REE    TXT", 5, 5},
+		{"\xE5OST    TXT", 0, 5},
+		{"\xE5AST    TXT", 9, 8000},
+	} {
+		copy(root[32*i:], f.name)
+		le.PutUint16(root[32*i+26:], f.cluster)
+		le.PutUint32(root[32*i+28:], f.size)
+	}
+
+	if err := os.WriteFile(tmpFile, volume, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	carved := []CarvedFile{{Signature: &FileSignature{Name: "PNG", Extension: ".png"}, Path: filepath.Join(tmpDir, "PNG", "carved_000001.png"), Offset: 65536, Size: 8, Verdict: Invalid}}
+	if n, err := WriteReport(reader, tmpDir, ReportCSV, carved, false); err != nil || n != 6 {
+		t.Fatalf("Expected 6 files reported, got %d (%v)", n, err)
+	}
+	data, err := os.ReadFile(filepath.Join(tmpDir, "scan.csv"))
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil || len(rows) != 7 {
+		t.Fatalf("Expected a header and 6 rows, got %d (%v):\n%s", len(rows), err, data)
+	}
+	if rows[0][0] != "id" || rows[0][11] != "recoverable" {
+		t.Errorf("Unexpected header %v", rows[0])
+	}
+	want := [][]string{
+		{"17408", "REPORT.TXT", "fat32", "allocated", "txt", "11", "false", "complete"},
+		{"17440", "?ONE.TXT", "fat32", "deleted", "txt", "5", "true", "overwritten"},
+		{"17472", "?REE.TXT", "fat32", "deleted", "txt", "5", "true", "complete"},
+		{"17504", "?OST.TXT", "fat32", "deleted", "txt", "5", "true", "none"},
+		{"17536", "?AST.TXT", "fat32", "deleted", "txt", "8000", "true", "partial"},
+		{"65536", "PNG/carved_000001.png", "carved", "carved", "PNG", "8", "false", "damaged"},
+	}
+	for i, w := range want {
+		row := rows[i+1]
+		got := append(row[:7:7], row[11])
+		if strings.Join(got, ",") != strings.Join(w, ",") {
+			t.Errorf("Row %d: expected %v, got %v", i+1, w, row)
+		}
+	}
+}
+
+func TestParseReportFormat(t *testing.T) {
+	for s, want := range map[string]ReportFormat{"": ReportOff, "off": ReportOff, "JSON": ReportJSON, "csv": ReportCSV} {
+		if got, err := ParseReportFormat(s); err != nil || got != want {
+			t.Errorf("ParseReportFormat(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	if _, err := ParseReportFormat("yaml"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,402 @@
+package carver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/internal/ntfs"
+)
+
+// A restore by id recovers files a scan listed, by the ids its session
+// manifest gave them, without scanning the source again: the data of a
+// FAT32 file is read from the runs the manifest records, and that of an
+// NTFS file from its MFT record, read alone, which gives its sparse runs
+// and resident data. The files are written as a filesystem recovery writes
+// them, added to the hash manifests and marked recovered in the session.
+// A resume restores in the same way the files of a session no run has
+// written yet.
+
+// IDRange is the ids of files from First to Last, both included; a single
+// id is a range of one
+type IDRange struct {
+	First, Last int
+}
+
+// IDs are the ids of files ParseIDs reads, kept as the ranges they were
+// given as, however wide, rather than spelled out
+type IDs []IDRange
+
+// Has reports whether id is in one of the ranges
+func (ids IDs) Has(id int) bool {
+	return slices.ContainsFunc(ids, func(r IDRange) bool { return r.First <= id && id <= r.Last })
+}
+
+// ParseIDs reads the ids of files of a session: numbers and ranges such as
+// 3222440960-3222542336, separated by commas, spaces or lines, a # starting
+// a comment
+func ParseIDs(r io.Reader) (IDs, error) {
+	var ids IDs
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		for _, field := range strings.FieldsFunc(line, func(c rune) bool { return c == ',' || c == ' ' || c == '\t' }) {
+			first, last, isRange := strings.Cut(field, "-")
+			from, err := strconv.Atoi(first)
+			to := from
+			if err == nil && isRange {
+				to, err = strconv.Atoi(last)
+			}
+			if err != nil || from < 0 || to < from {
+				return nil, fmt.Errorf("invalid id %q", field)
+			}
+			ids = append(ids, IDRange{First: from, Last: to})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Restorable returns the files of a session a restore by id can write:
+// those of its volumes that are not directories and have data left
+func (s *Session) Restorable() []SessionEntry {
+	var files []SessionEntry
+	for _, f := range s.Files {
+		if f.restorable() {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// restorable reports whether a restore by id can write a file
+func (f SessionEntry) restorable() bool {
+	return f.Source != "carved" && !f.Dir && f.Recoverable != "none"
+}
+
+// RestoreIDs recovers the files with the ids given of the session manifest
+// at sessionPath, which a scan of the disk wrote, to outputDir, and returns
+// how many it wrote. A range takes the files in it that can be restored,
+// and must have one; a single id must be of such a file. Files that cannot
+// be recovered are listed in a *disk.PartialRecoveryError, the others
+// having been written.
+func RestoreIDs(reader *disk.Reader, sessionPath, outputDir string, ids IDs) (int, error) {
+	defer reader.Purpose("restore by id")()
+	session, err := loadSessionOf(reader, sessionPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var picked []int // Indexes into session.Files
+	taken := make([]bool, len(ids))
+	for i, f := range session.Files {
+		in := false
+		for k, r := range ids {
+			if f.ID < r.First || f.ID > r.Last {
+				continue
+			}
+			switch {
+			case r.First < r.Last:
+			case f.Source == "carved":
+				return 0, fmt.Errorf("id %d is a carved file; carve it with recover carve", f.ID)
+			case f.Dir:
+				return 0, fmt.Errorf("id %d is a directory, %s", f.ID, f.Path)
+			case f.Recoverable == "none":
+				return 0, fmt.Errorf("id %d, %s, has no data left to recover", f.ID, f.Path)
+			}
+			if f.restorable() {
+				taken[k], in = true, true
+			}
+		}
+		if in {
+			picked = append(picked, i)
+		}
+	}
+	for k, r := range ids {
+		switch {
+		case taken[k]:
+		case r.First == r.Last:
+			return 0, fmt.Errorf("%s has no file with id %d", sessionPath, r.First)
+		default:
+			return 0, fmt.Errorf("%s has no file to restore with an id in %d-%d", sessionPath, r.First, r.Last)
+		}
+	}
+	return restoreFiles(reader, session, sessionPath, outputDir, picked)
+}
+
+// Resume recovers the files of the session manifest at sessionPath that a
+// run which stopped short, or wrote only some, left unwritten, and returns
+// how many it wrote. A file is taken as written when its copy in outputDir,
+// or where the session says it was written, has its size and, when the hash
+// manifest there lists it, its SHA-256; any other copy is written again.
+func Resume(reader *disk.Reader, sessionPath, outputDir string) (int, error) {
+	defer reader.Purpose("resume")()
+	session, err := loadSessionOf(reader, sessionPath)
+	if err != nil {
+		return 0, err
+	}
+
+	digests := make(map[string]disk.Digest) // By path below outputDir
+	manifest, _ := disk.LoadManifest(outputDir)
+	for _, e := range manifest {
+		digests[e.Path] = e.Digest
+	}
+	outputs := manifestOutputs(outputDir)
+	var picked []int               // Indexes into session.Files
+	var found []disk.ManifestEntry // Written, but not yet in the hash manifest
+	var done int
+	for i := range session.Files {
+		f := &session.Files[i]
+		// Files in use were skipped unless the run takes them too
+		if f.Source == "carved" || f.Dir || f.Recoverable == "none" || f.Recovery == RecoverySkipped && !reader.LiveFiles() {
+			continue
+		}
+		if err := reader.Err(); err != nil {
+			return 0, err
+		}
+
+		// Where an earlier run wrote it, if it did
+		var path string
+		if f.Recovery == RecoveryRecovered && f.Output != "" {
+			path = filepath.Join(filepath.Dir(sessionPath), filepath.FromSlash(f.Output))
+		} else {
+			rel := filepath.ToSlash(reader.OutputPath(disk.SafePath(f.Path)))
+			if queue := outputs[f.Path]; len(queue) > 0 {
+				rel, outputs[f.Path] = queue[0], queue[1:]
+			}
+			path = filepath.Join(outputDir, filepath.FromSlash(rel))
+		}
+		rel, err := relativeTo(outputDir, path)
+		var digest *disk.Digest
+		listed := false
+		if d, ok := digests[filepath.ToSlash(rel)]; ok && err == nil {
+			digest, listed = &d, true
+		}
+		got, ok := writtenAs(reader, path, f.Size, digest)
+		if !ok {
+			picked = append(picked, i)
+			continue
+		}
+		if !listed && err == nil && filepath.IsLocal(rel) {
+			entry := disk.ManifestEntry{Path: filepath.ToSlash(rel), Status: disk.StatusComplete, Digest: got}
+			if entry.Path != f.Path {
+				entry.Original = f.Path
+			}
+			found = append(found, entry)
+		}
+		done++
+		f.Recovery = RecoveryRecovered
+		if out, err := relativeTo(filepath.Dir(sessionPath), path); err == nil {
+			f.Output = filepath.ToSlash(out)
+		}
+	}
+
+	reader.Printf("%d files of %s were already written, %d are left\n", done, sessionPath, len(picked))
+	if len(found) > 0 {
+		if err := disk.WriteManifest(outputDir, append(manifest, found...)); err != nil {
+			return 0, err
+		}
+	}
+	if len(picked) == 0 {
+		session.Updated = time.Now().UTC().Format(time.RFC3339)
+		return 0, session.Save(sessionPath)
+	}
+	return restoreFiles(reader, session, sessionPath, outputDir, picked)
+}
+
+// writtenAs returns the digest of the copy at path of a file, and whether it
+// has the file's size and, when known, its digest
+func writtenAs(reader *disk.Reader, path string, size int64, digest *disk.Digest) (disk.Digest, bool) {
+	f, err := reader.OpenOutput(path)
+	if err != nil {
+		return disk.Digest{}, false
+	}
+	defer f.Close()
+	w := disk.NewDigestWriter(io.Discard)
+	if _, err := io.Copy(w, f); err != nil {
+		return disk.Digest{}, false
+	}
+	got := w.Digest()
+	return got, got.Size == size && (digest == nil || got.SHA256 == digest.SHA256)
+}
+
+// loadSessionOf reads the session manifest at path, which must be of the
+// source reader reads
+func loadSessionOf(reader *disk.Reader, path string) (*Session, error) {
+	session, err := LoadSession(path)
+	if err != nil {
+		return nil, err
+	}
+	if session.Source.Size != reader.Size() {
+		return nil, fmt.Errorf("%s is of a source of %d bytes, not of %s (%d bytes)", path, session.Source.Size, reader.Path(), reader.Size())
+	}
+	return session, nil
+}
+
+// restoreFiles recovers the files of a session at the indexes picked to
+// outputDir, records them in its hash manifest and marks them recovered in
+// the session, which it saves to sessionPath
+func restoreFiles(reader *disk.Reader, session *Session, sessionPath, outputDir string, picked []int) (int, error) {
+	var total int64
+	for _, i := range picked {
+		total += session.Files[i].Size
+	}
+	if err := reader.PlanOutput(len(picked), total); err != nil {
+		return 0, err
+	}
+
+	reader.Printf("Restoring %d files of %s...\n", len(picked), sessionPath)
+	parsers := make(map[string]*ntfs.Parser) // Of the NTFS volumes, by name
+	var written []disk.ManifestEntry
+	var failed []*disk.FileError
+	var stopped error
+	jobs := func(yield func(func() restored) bool) {
+		for n, i := range picked {
+			if stopped = reader.Err(); stopped != nil {
+				return
+			}
+			f := session.Files[i]
+			reader.Report(disk.Progress{Phase: "restore by id", Current: int64(n), Total: int64(len(picked)), Found: int64(len(written)), Item: f.Path})
+
+			rel := reader.OutputPath(disk.SafePath(f.Path))
+			outPath := filepath.Join(outputDir, rel)
+			parser, err := volumeParser(reader, session, f.ReportEntry, parsers)
+			if !yield(func() restored {
+				if err != nil {
+					return restored{i, rel, outPath, disk.Digest{}, err}
+				}
+				digest, err := restoreEntry(reader, parser, f.ReportEntry, outPath)
+				return restored{i, rel, outPath, digest, err}
+			}) {
+				return
+			}
+		}
+	}
+	disk.InOrder(reader.Workers(), jobs, func(r restored) {
+		f := &session.Files[r.index]
+		if r.err != nil {
+			reader.Errorf("  Failed to restore %d, %s: %v\n", f.ID, f.Path, r.err)
+			if !errors.Is(r.err, disk.ErrOutputFull) {
+				failed = append(failed, &disk.FileError{Path: f.Path, Err: r.err})
+			}
+			return
+		}
+		reader.Printf("  Restored %d: %s\n", f.ID, r.outPath)
+		reader.Recovered(disk.WrittenFile{Path: r.outPath, Original: f.Path, Source: f.Source, Digest: r.digest})
+		reader.Finished(r.outPath)
+		entry := disk.ManifestEntry{Path: filepath.ToSlash(r.rel), Status: reader.OutputStatus(), Digest: r.digest}
+		if entry.Path != f.Path {
+			entry.Original = f.Path
+		}
+		written = append(written, entry)
+
+		// Outputs are relative to the manifest, which may be elsewhere
+		f.Recovery, f.Output = RecoveryRecovered, filepath.ToSlash(r.rel)
+		if out, err := relativeTo(filepath.Dir(sessionPath), r.outPath); err == nil {
+			f.Output = filepath.ToSlash(out)
+		}
+	})
+	if stopped != nil {
+		return len(written), stopped
+	}
+
+	if len(written) > 0 {
+		// Added to what earlier runs wrote there, in place of the copies
+		// written again
+		rewritten := make(map[string]bool, len(written))
+		for _, e := range written {
+			rewritten[e.Path] = true
+		}
+		manifest, _ := disk.LoadManifest(outputDir)
+		manifest = slices.DeleteFunc(manifest, func(e disk.ManifestEntry) bool { return rewritten[e.Path] })
+		if err := disk.WriteManifest(outputDir, append(manifest, written...)); err != nil {
+			return len(written), err
+		}
+	}
+	session.Updated = time.Now().UTC().Format(time.RFC3339)
+	if err := session.Save(sessionPath); err != nil {
+		return len(written), err
+	}
+	reader.Printf("\nRestored %d of %d files\n", len(written), len(picked))
+	if len(failed) > 0 {
+		return len(written), &disk.PartialRecoveryError{Recovered: len(written), Failed: failed}
+	}
+	return len(written), nil
+}
+
+// relativeTo returns the path of target relative to dir, either of which
+// may be relative to the working directory
+func relativeTo(dir, target string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if target, err = filepath.Abs(target); err != nil {
+		return "", err
+	}
+	return filepath.Rel(dir, target)
+}
+
+// restored is a file of a session a restore wrote to outPath, rel below
+// its output directory, or failed to
+type restored struct {
+	index   int // Into the session's files
+	rel     string
+	outPath string
+	digest  disk.Digest
+	err     error
+}
+
+// restoreEntry writes a file of a session's volume to outPath, with the
+// parser of its volume for an NTFS file
+func restoreEntry(reader *disk.Reader, parser *ntfs.Parser, f ReportEntry, outPath string) (disk.Digest, error) {
+	if f.Source != "ntfs" {
+		e := disk.FileEntry{Size: f.Size}
+		for _, run := range f.Runs {
+			e.Extents = append(e.Extents, disk.Extent{Offset: run.Offset, Length: run.Length})
+		}
+		return reader.WriteEntry(e, outPath)
+	}
+	return parser.RecoverRecord(f.Inode, f.Size, outPath)
+}
+
+// volumeParser returns the parser of the NTFS volume of a file of a
+// session, made once for each volume in parsers, or nil for a file of
+// another filesystem
+func volumeParser(reader *disk.Reader, session *Session, f ReportEntry, parsers map[string]*ntfs.Parser) (*ntfs.Parser, error) {
+	if f.Source != "ntfs" {
+		return nil, nil
+	}
+	var volume *ReportVolume
+	for i, v := range session.Volumes {
+		if v.Filesystem == "ntfs" && (v.Name == "" || strings.HasPrefix(f.Path, v.Name+"/")) {
+			volume = &session.Volumes[i]
+			break
+		}
+	}
+	if volume == nil {
+		return nil, errors.New("its volume is not in the session")
+	}
+	parser := parsers[volume.Name]
+	if parser == nil {
+		volumeReader := reader
+		if volume.Name != "" {
+			volumeReader = reader.Partition(disk.Partition{Offset: volume.Offset, Size: volume.Size})
+		}
+		var err error
+		if parser, err = ntfs.NewParser(volumeReader); err != nil {
+			return nil, err
+		}
+		parsers[volume.Name] = parser
+	}
+	return parser, nil
+}
@@ -0,0 +1,159 @@
+package carver
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func TestParseIDs(t *testing.T) {
+	ids, err := ParseIDs(strings.NewReader("23, 118\n# old ones\n5-7 0\t2 # and 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (IDs{{23, 23}, {118, 118}, {5, 7}, {0, 0}, {2, 2}}); !slices.Equal(ids, want) {
+		t.Errorf("Expected %v, got %v", want, ids)
+	}
+	for id, want := range map[int]bool{0: true, 4: false, 6: true, 118: true, 119: false} {
+		if ids.Has(id) != want {
+			t.Errorf("Has(%d): expected %v", id, want)
+		}
+	}
+	for _, bad := range []string{"-1", "x", "7-5", "3-", "99999999999999999999"} {
+		if _, err := ParseIDs(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+
+	// However wide, a range is kept as one
+	ids, err = ParseIDs(strings.NewReader("1-9000000000000000000"))
+	if err != nil || len(ids) != 1 || !ids.Has(8999999999999999999) {
+		t.Errorf("Expected one range, got %v (%v)", ids, err)
+	}
+}
+
+// scannedFAT32 returns a FAT32 volume with a deleted OLD.TXT in cluster 4
+// and a deleted LOST.TXT with nothing left, and the session a scan of it
+// wrote
+func scannedFAT32(t *testing.T, tmpDir string) (*disk.Reader, string) {
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	volume := makeFAT32(8, 2, 3)
+	le := binary.LittleEndian
+	root := volume[34*512:]
+	copy(root, "\xE5LD     TXT")
+	le.PutUint16(root[26:], 4)
+	le.PutUint32(root[28:], 5)
+	copy(root[32:], "\xE5OST    TXT")
+	le.PutUint32(root[32+28:], 5)
+	copy(volume[34*512+2*4096:], "hello")
+	if err := os.WriteFile(tmpFile, volume, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	t.Cleanup(func() { reader.Close() })
+
+	scanDir := filepath.Join(tmpDir, "scan")
+	os.MkdirAll(scanDir, 0755)
+	if _, err := WriteSession(reader, scanDir, SessionFilesystem, nil, true); err != nil {
+		t.Fatalf("Failed to write session: %v", err)
+	}
+	return reader, filepath.Join(scanDir, SessionFile)
+}
+
+func TestRestoreIDs(t *testing.T) {
+	tmpDir := t.TempDir()
+	reader, sessionPath := scannedFAT32(t, tmpDir)
+	s, err := LoadSession(sessionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := s.Restorable(); len(files) != 1 || files[0].ID != 34*512 {
+		t.Fatalf("Expected only ?LD.TXT restorable, got %+v", files)
+	}
+
+	outputDir := filepath.Join(tmpDir, "out")
+	// ?OST.TXT, with nothing left, alone, and ranges with nothing to restore
+	for _, ids := range []IDs{{{9, 9}}, {{34*512 + 32, 34*512 + 32}}, {{34*512 + 1, 1 << 40}}} {
+		if _, err := RestoreIDs(reader, sessionPath, outputDir, ids); err == nil {
+			t.Errorf("Expected an error restoring %v", ids)
+		}
+	}
+	// A range takes the files in it that can be restored
+	n, err := RestoreIDs(reader, sessionPath, outputDir, IDs{{0, 1 << 40}})
+	if err != nil || n != 1 {
+		t.Fatalf("Expected 1 file restored, got %d (%v)", n, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(outputDir, "_LD.TXT")); string(data) != "hello" {
+		t.Errorf("Unexpected content %q", data)
+	}
+	if manifest, err := disk.LoadManifest(outputDir); err != nil || len(manifest) != 1 || manifest[0].Original != "?LD.TXT" {
+		t.Errorf("Unexpected manifest %+v (%v)", manifest, err)
+	}
+	if s, _ = LoadSession(sessionPath); s.Files[0].Recovery != RecoveryRecovered || s.Files[0].Output != "../out/_LD.TXT" {
+		t.Errorf("Expected ?LD.TXT marked recovered, got %+v", s.Files[0])
+	}
+
+	// A session of another source
+	other := filepath.Join(tmpDir, "other.img")
+	os.WriteFile(other, make([]byte, 4096), 0644)
+	otherReader, err := disk.Open(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer otherReader.Close()
+	if _, err := RestoreIDs(otherReader, sessionPath, outputDir, IDs{{34 * 512, 34 * 512}}); err == nil || errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a source mismatch, got %v", err)
+	}
+}
+
+func TestResume(t *testing.T) {
+	tmpDir := t.TempDir()
+	reader, sessionPath := scannedFAT32(t, tmpDir)
+
+	// Nothing written yet
+	outputDir := filepath.Join(tmpDir, "out")
+	os.MkdirAll(outputDir, 0755)
+	if n, err := Resume(reader, sessionPath, outputDir); err != nil || n != 1 {
+		t.Fatalf("Expected 1 file restored, got %d (%v)", n, err)
+	}
+	if n, err := Resume(reader, sessionPath, outputDir); err != nil || n != 0 {
+		t.Errorf("Expected nothing left to restore, got %d (%v)", n, err)
+	}
+
+	// A copy changed since its hash was taken
+	copyPath := filepath.Join(outputDir, "_LD.TXT")
+	os.WriteFile(copyPath, []byte("jello"), 0644)
+	if n, err := Resume(reader, sessionPath, outputDir); err != nil || n != 1 {
+		t.Errorf("Expected the changed copy written again, got %d (%v)", n, err)
+	}
+	if data, _ := os.ReadFile(copyPath); string(data) != "hello" {
+		t.Errorf("Unexpected content %q", data)
+	}
+	if manifest, _ := disk.LoadManifest(outputDir); len(manifest) != 1 {
+		t.Errorf("Expected the copy listed once, got %+v", manifest)
+	}
+
+	// A copy a run wrote before it stopped, unlisted, is taken by its size
+	fresh := filepath.Join(tmpDir, "fresh")
+	os.MkdirAll(fresh, 0755)
+	os.WriteFile(filepath.Join(fresh, "_LD.TXT"), []byte("hello"), 0644)
+	freshReader, freshSession := scannedFAT32(t, fresh)
+	if n, err := Resume(freshReader, freshSession, fresh); err != nil || n != 0 {
+		t.Errorf("Expected the copy kept, got %d (%v)", n, err)
+	}
+	if manifest, _ := disk.LoadManifest(fresh); len(manifest) != 1 || manifest[0].SHA256 == "" {
+		t.Errorf("Expected the kept copy listed, got %+v", manifest)
+	}
+	if s, _ := LoadSession(freshSession); s.Files[0].Recovery != RecoveryRecovered || s.Files[0].Output != "../_LD.TXT" {
+		t.Errorf("Expected the kept copy marked recovered, got %+v", s.Files[0])
+	}
+}
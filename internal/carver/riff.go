@@ -0,0 +1,39 @@
+package carver
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// WEBP images, AVI videos and WAV audio are all RIFF files: "RIFF", the
+// length of what follows, then a four-byte form type. The form type tells
+// them apart, and the length gives the size of the file.
+
+// verifyRIFF returns a check that a RIFF header is followed by the given
+// form type
+func verifyRIFF(form string) func([]byte) bool {
+	return func(data []byte) bool {
+		return len(data) >= 12 && string(data[8:12]) == form && binary.LittleEndian.Uint32(data[4:8]) >= 4
+	}
+}
+
+// riffSize reads the length of the RIFF chunk. AVI files past 1GB continue
+// in further RIFF chunks of form type AVIX, which are part of the file.
+func riffSize(r io.ReaderAt, limit int64) int64 {
+	var size int64
+	header := make([]byte, 12)
+	for size+12 <= limit {
+		if _, err := r.ReadAt(header, size); err != nil {
+			break
+		}
+		if string(header[0:4]) != "RIFF" || (size > 0 && string(header[8:12]) != "AVIX") {
+			break
+		}
+		length := int64(binary.LittleEndian.Uint32(header[4:8]))
+		size += 8 + length + length%2 // Chunks are padded to even lengths
+	}
+	if size > limit {
+		return 0
+	}
+	return size
+}
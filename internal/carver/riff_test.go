@@ -0,0 +1,74 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// riffChunk builds a RIFF chunk of a form type around body
+func riffChunk(form string, body []byte) []byte {
+	chunk := make([]byte, 12, 12+len(body))
+	copy(chunk, "RIFF")
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(4+len(body)))
+	copy(chunk[8:], form)
+	return append(chunk, body...)
+}
+
+func TestRIFFForms(t *testing.T) {
+	// A WAV file followed by noise that must not count towards it
+	data := make([]byte, 64*1024)
+	wav := riffChunk("WAVE", bytes.Repeat([]byte("fmt data"), 100))
+	copy(data[4096:], wav)
+	copy(data[4096+len(wav):], bytes.Repeat([]byte{0xAB}, 512))
+
+	c := writeTextImage(t, data)
+	files, err := c.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	var riff []CarvedFile
+	for _, f := range files {
+		if f.Offset == 4096 {
+			riff = append(riff, f)
+		}
+	}
+	if len(riff) != 1 || riff[0].Signature.Name != "WAV" {
+		t.Fatalf("Expected a single WAV hit, got %d", len(riff))
+	}
+	if _, size, err := c.content(riff[0]); err != nil || size != int64(len(wav)) {
+		t.Errorf("Expected a size of %d, got %d (%v)", len(wav), size, err)
+	}
+
+	for _, tt := range []struct {
+		form string
+		want []string
+	}{{"WEBP", []string{"WEBP"}}, {"AVI ", []string{"AVI"}}, {"WAVE", []string{"WAV"}}, {"ABCD", nil}} {
+		var got []string
+		header := riffChunk(tt.form, make([]byte, 64))
+		for _, sig := range Signatures {
+			if bytes.HasPrefix(header, sig.Header) && (sig.Verify == nil || sig.Verify(header)) {
+				got = append(got, sig.Name)
+			}
+		}
+		if len(got) != len(tt.want) || (len(got) == 1 && got[0] != tt.want[0]) {
+			t.Errorf("RIFF form %q matched %v, want %v", tt.form, got, tt.want)
+		}
+	}
+}
+
+func TestRIFFSizeAVIX(t *testing.T) {
+	// An OpenDML AVI continues in AVIX chunks; an odd length is padded
+	avi := riffChunk("AVI ", make([]byte, 101))
+	avi = append(avi, 0)
+	avi = append(avi, riffChunk("AVIX", make([]byte, 200))...)
+	size := int64(len(avi))
+	avi = append(avi, riffChunk("WAVE", make([]byte, 50))...)
+
+	if got := riffSize(bytes.NewReader(avi), int64(len(avi))); got != size {
+		t.Errorf("Expected %d, got %d", size, got)
+	}
+	if got := riffSize(bytes.NewReader(avi), 100); got != 0 {
+		t.Errorf("Expected 0 past the limit, got %d", got)
+	}
+}
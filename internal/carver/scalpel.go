@@ -0,0 +1,186 @@
+package carver
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseScalpelConfig decodes signatures written in scalpel.conf / foremost.conf
+// syntax. Each non-comment line has the form
+//
+//	extension  case-sensitive(y/n)  size  header  [footer  [REVERSE|NEXT]]
+//
+// Headers and footers may use \xHH, octal \ooo and \s escapes, and the
+// wildcard character ('?' unless changed with a "wildcard" line) matches any
+// byte in a header. A size of "min:max" sets both MinSize and MaxSize.
+func ParseScalpelConfig(data []byte) ([]FileSignature, error) {
+	var sigs []FileSignature
+	wildcard := byte('?')
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if strings.EqualFold(fields[0], "wildcard") {
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("line %d: wildcard needs a character", lineNum)
+			}
+			w, _, err := decodeScalpelString(fields[1], 0)
+			if err != nil || len(w) != 1 {
+				return nil, fmt.Errorf("line %d: invalid wildcard %q", lineNum, fields[1])
+			}
+			wildcard = w[0]
+			continue
+		}
+
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("line %d: expected at least 4 fields, got %d", lineNum, len(fields))
+		}
+
+		sig, err := parseScalpelLine(fields, wildcard)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		sigs = append(sigs, sig)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return sigs, nil
+}
+
+func parseScalpelLine(fields []string, wildcard byte) (FileSignature, error) {
+	ext := fields[0]
+	sig := FileSignature{
+		Name:      strings.ToUpper(ext),
+		Extension: "." + strings.ToLower(ext),
+	}
+	if strings.EqualFold(ext, "NONE") {
+		sig.Extension = ""
+	}
+
+	switch strings.ToLower(fields[1]) {
+	case "y", "yes":
+	case "n", "no":
+		sig.CaseInsensitive = true
+	default:
+		return sig, fmt.Errorf("invalid case-sensitivity %q", fields[1])
+	}
+
+	sizeField := fields[2]
+	if i := strings.IndexByte(sizeField, ':'); i >= 0 {
+		minSize, err := strconv.ParseInt(sizeField[:i], 10, 64)
+		if err != nil || minSize < 0 {
+			return sig, fmt.Errorf("invalid size %q", fields[2])
+		}
+		sig.MinSize = minSize
+		sizeField = sizeField[i+1:]
+	}
+	size, err := strconv.ParseInt(sizeField, 10, 64)
+	if err != nil || size < sig.MinSize {
+		return sig, fmt.Errorf("invalid size %q", fields[2])
+	}
+	sig.MaxSize = size
+
+	header, wild, err := decodeScalpelString(fields[3], wildcard)
+	if err != nil {
+		return sig, fmt.Errorf("header: %w", err)
+	}
+	if len(header) == 0 {
+		return sig, fmt.Errorf("empty header")
+	}
+	sig.Header = header
+	for _, w := range wild {
+		if w {
+			sig.Wildcard = wild
+			break
+		}
+	}
+
+	if len(fields) >= 5 {
+		footer, _, err := decodeScalpelString(fields[4], 0)
+		if err != nil {
+			return sig, fmt.Errorf("footer: %w", err)
+		}
+		sig.Footer = footer
+	}
+
+	if len(fields) >= 6 {
+		switch strings.ToUpper(fields[5]) {
+		case "REVERSE":
+			sig.FooterMode = FooterLast
+		case "NEXT":
+			sig.FooterMode = FooterExclude
+		default:
+			return sig, fmt.Errorf("unknown footer option %q", fields[5])
+		}
+	}
+
+	return sig, nil
+}
+
+// decodeScalpelString expands escape sequences and marks unescaped wildcard
+// characters. A wildcard of 0 disables wildcard handling.
+func decodeScalpelString(s string, wildcard byte) ([]byte, []bool, error) {
+	var out []byte
+	var wild []bool
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			out = append(out, c)
+			wild = append(wild, wildcard != 0 && c == wildcard)
+			continue
+		}
+
+		if i+1 >= len(s) {
+			return nil, nil, fmt.Errorf("trailing backslash in %q", s)
+		}
+		i++
+		switch e := s[i]; {
+		case e == 'x' || e == 'X':
+			if i+2 >= len(s) {
+				return nil, nil, fmt.Errorf("short hex escape in %q", s)
+			}
+			v, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid hex escape in %q", s)
+			}
+			out = append(out, byte(v))
+			i += 2
+		case e >= '0' && e <= '7':
+			end := i
+			for end < len(s) && end < i+3 && s[end] >= '0' && s[end] <= '7' {
+				end++
+			}
+			v, err := strconv.ParseUint(s[i:end], 8, 8)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid octal escape in %q", s)
+			}
+			out = append(out, byte(v))
+			i = end - 1
+		case e == 's':
+			out = append(out, ' ')
+		case e == 't':
+			out = append(out, '\t')
+		case e == 'n':
+			out = append(out, '\n')
+		case e == 'r':
+			out = append(out, '\r')
+		default:
+			out = append(out, e) // \\, \? and friends are literal
+		}
+		wild = append(wild, false)
+	}
+
+	return out, wild, nil
+}
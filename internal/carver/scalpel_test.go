@@ -0,0 +1,126 @@
+package carver
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func TestParseScalpelConfig(t *testing.T) {
+	conf := `
+# extension case size header footer
+	gif	y	5000000		\x47\x49\x46\x38\x37\x61	\x00\x3b
+	htm	n	50000		<html			</html>
+	doc	y	10000000	\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1\x00\x00	\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1\x00\x00 NEXT
+	pdf	y	1000:5000000	%PDF	%EOF\x0d REVERSE
+wildcard *
+	NONE	y	100		\xff*\x01\s
+`
+
+	sigs, err := ParseScalpelConfig([]byte(conf))
+	if err != nil {
+		t.Fatalf("ParseScalpelConfig failed: %v", err)
+	}
+	if len(sigs) != 5 {
+		t.Fatalf("Expected 5 signatures, got %d", len(sigs))
+	}
+
+	gif := sigs[0]
+	if gif.Name != "GIF" || gif.Extension != ".gif" || gif.MaxSize != 5000000 {
+		t.Errorf("Unexpected GIF signature: %+v", gif)
+	}
+	if !bytes.Equal(gif.Header, []byte("GIF87a")) || !bytes.Equal(gif.Footer, []byte{0x00, 0x3B}) {
+		t.Errorf("Unexpected GIF header/footer: % X / % X", gif.Header, gif.Footer)
+	}
+
+	if !sigs[1].CaseInsensitive || string(sigs[1].Footer) != "</html>" {
+		t.Errorf("Expected case-insensitive htm with </html> footer, got %+v", sigs[1])
+	}
+
+	if sigs[2].FooterMode != FooterExclude {
+		t.Errorf("Expected NEXT to map to FooterExclude, got %v", sigs[2].FooterMode)
+	}
+
+	if sigs[3].FooterMode != FooterLast || sigs[3].MinSize != 1000 || sigs[3].MaxSize != 5000000 {
+		t.Errorf("Expected REVERSE pdf with size 1000:5000000, got %+v", sigs[3])
+	}
+
+	wild := sigs[4]
+	if wild.Extension != "" {
+		t.Errorf("Expected NONE to produce no extension, got %q", wild.Extension)
+	}
+	if !bytes.Equal(wild.Header, []byte{0xFF, '*', 0x01, ' '}) {
+		t.Errorf("Unexpected wildcard header: % X", wild.Header)
+	}
+	if len(wild.Wildcard) != 4 || !wild.Wildcard[1] || wild.Wildcard[0] {
+		t.Errorf("Unexpected wildcard mask: %v", wild.Wildcard)
+	}
+	if !wild.matchHeader([]byte{0xFF, 0x42, 0x01, ' '}) {
+		t.Errorf("Wildcard header should match any byte at position 1")
+	}
+}
+
+func TestParseScalpelConfigInvalid(t *testing.T) {
+	inputs := []string{
+		"jpg y 100",
+		"jpg maybe 100 \\xff\\xd8",
+		"jpg y big \\xff\\xd8",
+		"jpg y 100 \\xzz",
+		"jpg y 100 \\xff \\xd9 SIDEWAYS",
+	}
+
+	for _, input := range inputs {
+		if _, err := ParseScalpelConfig([]byte(input)); err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+}
+
+func TestFooterModes(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	// HDR ... END ... END, then padding
+	data := make([]byte, 64*1024)
+	copy(data[0:], "HDR")
+	copy(data[100:], "END")
+	copy(data[200:], "END")
+
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	tests := []struct {
+		mode     FooterMode
+		ci       bool
+		footer   string
+		expected int64
+	}{
+		{FooterFirst, false, "END", 103},
+		{FooterLast, false, "END", 203},
+		{FooterExclude, false, "END", 100},
+		{FooterFirst, true, "end", 103},
+		{FooterFirst, false, "end", 1000}, // No match, falls back to MaxSize
+	}
+
+	carver := NewCarver(reader)
+	for _, tt := range tests {
+		sig := &FileSignature{Name: "T", Header: []byte("HDR"), Footer: []byte(tt.footer), MaxSize: 1000, FooterMode: tt.mode, CaseInsensitive: tt.ci}
+		size, err := carver.carveSize(CarvedFile{Signature: sig})
+		if err != nil {
+			t.Fatalf("carveSize failed: %v", err)
+		}
+		if size != tt.expected {
+			t.Errorf("Mode %d footer %q: expected size %d, got %d", tt.mode, tt.footer, tt.expected, size)
+		}
+	}
+}
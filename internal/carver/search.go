@@ -0,0 +1,313 @@
+package carver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/internal/fat32"
+	"github.com/shubham/recovery/internal/ntfs"
+)
+
+// A keyword search reads every byte of the device for literal strings and
+// regular expressions, as ASCII or UTF-8 and as UTF-16LE, whether they lie
+// in a file, in free space or in slack. Each hit is reported with the bytes
+// around it and, where a FAT32 or NTFS volume says which file holds that
+// part of the disk, with the file:
+//
+//	0x0000a3f21c  ascii  password  partition1/Users/anna/notes.txt
+//	    ...user=anna password=hunter2 host=...
+
+const (
+	searchChunk   = 4 * 1024 * 1024
+	searchOverlap = 4096 // Longest hit found across the boundary of two chunks
+
+	// DefaultSearchContext is the number of characters shown either side of
+	// a hit when none is given
+	DefaultSearchContext = 32
+)
+
+// SearchOptions controls a keyword search
+type SearchOptions struct {
+	Patterns []*regexp.Regexp // From ParseKeywords
+	Context  int              // Characters shown either side of a hit
+	Hex      bool             // Show the context as a hex dump too
+	MaxHits  int              // Stop after this many hits (0 = no limit)
+}
+
+// SearchHit is a match of a keyword on the disk
+type SearchHit struct {
+	Offset  int64
+	Length  int64 // In bytes on the disk
+	UTF16   bool
+	Pattern string // The expression that matched
+	Match   string // As UTF-8
+	Context []byte // The bytes around the hit on the disk
+	Start   int64  // Offset of Context
+	Owner   string // File that holds the hit, below partitionN/ on a partitioned disk ("" = none known)
+	Deleted bool   // The owner is a deleted file
+}
+
+// errSearchLimit stops a search at SearchOptions.MaxHits
+var errSearchLimit = errors.New("hit limit reached")
+
+// Search calls fn with each hit of opts.Patterns on the disk, in disk order.
+// A hit found as ASCII and UTF-16 at once, or by several patterns, is
+// reported for each.
+func Search(reader *disk.Reader, opts SearchOptions, fn func(SearchHit) error) error {
+	defer reader.Purpose("keyword search")()
+	owners := newOwnerIndex(reader)
+	context := max(opts.Context, 0)
+	count := 0
+
+	buf := make([]byte, searchChunk+searchOverlap)
+	size := reader.Size()
+	for pos := int64(0); pos < size; pos += searchChunk {
+		n, err := reader.ReadAt(buf[:min(int64(len(buf)), size-pos)], pos)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		chunk := buf[:n]
+		// Hits starting in the overlap are found again with the next chunk
+		limit := min(int64(n), searchChunk)
+
+		views := [2][]byte{utf16View(chunk, 0), utf16View(chunk, 1)}
+		var hits []SearchHit
+		for _, re := range opts.Patterns {
+			for _, m := range re.FindAllIndex(chunk, -1) {
+				if int64(m[0]) < limit && m[1] > m[0] {
+					hits = append(hits, SearchHit{Offset: pos + int64(m[0]), Length: int64(m[1] - m[0]),
+						Pattern: re.String(), Match: string(chunk[m[0]:m[1]])})
+				}
+			}
+			for parity, view := range views {
+				for _, m := range re.FindAllIndex(view, -1) {
+					if int64(parity+2*m[0]) < limit && m[1] > m[0] {
+						hits = append(hits, SearchHit{Offset: pos + int64(parity+2*m[0]), Length: int64(2 * (m[1] - m[0])),
+							UTF16: true, Pattern: re.String(), Match: latin1(view[m[0]:m[1]])})
+					}
+				}
+			}
+		}
+		sort.SliceStable(hits, func(i, j int) bool { return hits[i].Offset < hits[j].Offset })
+
+		for _, h := range hits {
+			width := int64(context)
+			if h.UTF16 {
+				width *= 2
+			}
+			h.Start = max(h.Offset-width, 0)
+			h.Context = make([]byte, min(h.Offset+h.Length+width, size)-h.Start)
+			if _, err := reader.ReadAt(h.Context, h.Start); err != nil && err != io.EOF {
+				return err
+			}
+			h.Owner, h.Deleted = owners.owner(h.Offset)
+			if err := fn(h); err != nil {
+				return err
+			}
+			if count++; opts.MaxHits > 0 && count >= opts.MaxHits {
+				return errSearchLimit
+			}
+		}
+	}
+	return nil
+}
+
+// utf16View returns the characters of UTF-16LE text starting at parity in
+// data, one byte each: characters with a high byte become their low byte,
+// and anything else becomes 0, which no keyword matches. Hit i of the view
+// is at parity+2*i in data.
+func utf16View(data []byte, parity int) []byte {
+	view := make([]byte, (len(data)-parity)/2)
+	for i := range view {
+		if lo, hi := data[parity+2*i], data[parity+2*i+1]; hi == 0 {
+			view[i] = lo
+		}
+	}
+	return view
+}
+
+// latin1 decodes Latin-1 bytes to UTF-8
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// SearchDisk prints each hit of a keyword search with its context and the
+// file holding it, and returns the number of hits
+func SearchDisk(reader *disk.Reader, opts SearchOptions) (int, error) {
+	reader.Printf("Searching %d bytes for %d keywords...\n", reader.Size(), len(opts.Patterns))
+	count := 0
+	err := Search(reader, opts, func(h SearchHit) error {
+		count++
+		encoding := "ascii"
+		if h.UTF16 {
+			encoding = "utf16"
+		}
+		owner := h.Owner
+		if h.Deleted {
+			owner += " (deleted)"
+		}
+		reader.Printf("\n0x%010x  %s  %s  %s\n", h.Offset, encoding, h.Match, owner)
+		reader.Printf("    %s\n", contextLine(h))
+		if opts.Hex {
+			reader.Printf("%s", hexDump(h.Context, h.Start))
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errSearchLimit):
+		reader.Printf("\nStopped after %d hits\n", count)
+	case err != nil:
+		return count, err
+	default:
+		reader.Printf("\nFound %d hits\n", count)
+	}
+	return count, nil
+}
+
+// contextLine renders the context of a hit as one line of text, reading
+// UTF-16 context two bytes to a character; bytes that are not printable
+// show as dots
+func contextLine(h SearchHit) string {
+	data := h.Context
+	if h.UTF16 {
+		var chars []byte
+		for i := 0; i+1 < len(data); i += 2 {
+			if data[i+1] == 0 {
+				chars = append(chars, data[i])
+			} else {
+				chars = append(chars, '.')
+			}
+		}
+		data = chars
+	}
+	var b strings.Builder
+	for _, c := range data {
+		if c >= 0x20 && c < 0x7F {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('.')
+		}
+	}
+	return b.String()
+}
+
+// hexDump renders data found at offset as lines of 16 bytes in hex and as
+// text
+func hexDump(data []byte, offset int64) string {
+	var b strings.Builder
+	for i := 0; i < len(data); i += 16 {
+		line := data[i:min(int64(i+16), int64(len(data)))]
+		fmt.Fprintf(&b, "    %010x ", offset+int64(i))
+		for j := 0; j < 16; j++ {
+			if j < len(line) {
+				fmt.Fprintf(&b, " %02x", line[j])
+			} else {
+				b.WriteString("   ")
+			}
+		}
+		b.WriteString("  |")
+		for _, c := range line {
+			if c >= 0x20 && c < 0x7F {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteString("|\n")
+	}
+	return b.String()
+}
+
+// ownerIndex maps offsets on the disk to the files of its FAT32 and NTFS
+// volumes that hold them
+type ownerIndex struct {
+	extents []ownedExtent // By offset
+	maxEnd  []int64       // Furthest end of extents[:i+1]
+}
+
+type ownedExtent struct {
+	disk.Extent
+	alloc *disk.Allocation
+}
+
+func newOwnerIndex(reader *disk.Reader) ownerIndex {
+	var x ownerIndex
+	for _, v := range diskVolumes(reader) {
+		allocs, err := volumeAllocations(v.reader)
+		if err != nil {
+			continue
+		}
+		for i := range allocs {
+			a := &allocs[i]
+			a.Path = filepath.Join(v.name, a.Path)
+			for _, e := range a.Extents {
+				x.extents = append(x.extents, ownedExtent{Extent: disk.Extent{Offset: e.Offset + v.Offset, Length: e.Length}, alloc: a})
+			}
+		}
+	}
+	sort.Slice(x.extents, func(i, j int) bool { return x.extents[i].Offset < x.extents[j].Offset })
+	x.maxEnd = make([]int64, len(x.extents))
+	var end int64
+	for i, e := range x.extents {
+		end = max(end, e.Offset+e.Length)
+		x.maxEnd[i] = end
+	}
+	return x
+}
+
+// volumeAllocations reads where the files of a FAT32 or NTFS volume lie
+func volumeAllocations(volume *disk.Reader) ([]disk.Allocation, error) {
+	fs, err := disk.DetectFilesystem(volume)
+	if err != nil {
+		return nil, err
+	}
+	switch fs {
+	case "ntfs":
+		p, err := ntfs.NewParser(volume)
+		if err != nil {
+			return nil, err
+		}
+		return p.Allocations()
+	case "fat32":
+		p, err := fat32.NewParser(volume)
+		if err != nil {
+			return nil, err
+		}
+		return p.Allocations()
+	}
+	return nil, fmt.Errorf("files of %s volumes are not supported", fs)
+}
+
+// owner returns the path of the file holding the byte at offset, preferring
+// a file in use to a deleted one whose clusters may since have been reused,
+// and the smallest extent, such as an MFT record, to a larger one
+func (x ownerIndex) owner(offset int64) (string, bool) {
+	i := sort.Search(len(x.extents), func(i int) bool { return x.extents[i].Offset > offset })
+	var best *ownedExtent
+	for j := i - 1; j >= 0 && x.maxEnd[j] > offset; j-- {
+		e := &x.extents[j]
+		if e.Offset+e.Length <= offset {
+			continue
+		}
+		switch {
+		case best == nil,
+			best.alloc.Deleted && !e.alloc.Deleted,
+			best.alloc.Deleted == e.alloc.Deleted && e.Length < best.Length:
+			best = e
+		}
+	}
+	if best == nil {
+		return "", false
+	}
+	return best.alloc.Path, best.alloc.Deleted
+}
@@ -0,0 +1,111 @@
+package carver
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func TestSearch(t *testing.T) {
+	// NOTES.TXT holds cluster 3; a deleted OLD.TXT starts in cluster 6;
+	// cluster 9 is free
+	volume := makeFAT32(16, 2, 3)
+	dataStart := 34 * 512
+	cluster := func(c int) int { return dataStart + (c-2)*4096 }
+	root := volume[cluster(2):]
+	copy(root, "NOTES   TXT")
+	binary.LittleEndian.PutUint16(root[26:], 3)
+	binary.LittleEndian.PutUint32(root[28:], 100)
+	copy(root[32:], "\xE5OLD    TXT")
+	binary.LittleEndian.PutUint16(root[32+26:], 6)
+	binary.LittleEndian.PutUint32(root[32+28:], 100)
+
+	copy(volume[cluster(3)+10:], "user=anna password=hunter2")
+	copy(volume[cluster(6):], "PassWord")
+	copy(volume[cluster(9)+1:], utf16le("old Password here"))
+
+	tmpFile := filepath.Join(t.TempDir(), "test.img")
+	if err := os.WriteFile(tmpFile, volume, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	patterns, err := ParseKeywords([]string{"password", "/hunter\\d/"})
+	if err != nil {
+		t.Fatalf("ParseKeywords failed: %v", err)
+	}
+	var hits []SearchHit
+	err = Search(reader, SearchOptions{Patterns: patterns, Context: 4}, func(h SearchHit) error {
+		hits = append(hits, h)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	type hit struct {
+		Offset  int64
+		UTF16   bool
+		Match   string
+		Owner   string
+		Deleted bool
+		Context string
+	}
+	var got []hit
+	for _, h := range hits {
+		got = append(got, hit{h.Offset, h.UTF16, h.Match, h.Owner, h.Deleted, contextLine(h)})
+	}
+	want := []hit{
+		{int64(cluster(3) + 20), false, "password", "NOTES.TXT", false, "nna password=hun"},
+		{int64(cluster(3) + 29), false, "hunter2", "NOTES.TXT", false, "ord=hunter2...."},
+		{int64(cluster(6)), false, "PassWord", "?OLD.TXT", true, "....PassWord...."},
+		{int64(cluster(9) + 9), true, "Password", "", false, "old Password her"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected hits\n%+v\ngot\n%+v", want, got)
+	}
+
+	// The hit limit
+	n, err := SearchDisk(reader, SearchOptions{Patterns: patterns, MaxHits: 2, Hex: true})
+	if err != nil || n != 2 {
+		t.Errorf("Expected to stop after 2 hits, got %d (%v)", n, err)
+	}
+}
+
+func TestSearchChunkBoundary(t *testing.T) {
+	// A hit across the boundary of the first two chunks is found once
+	data := make([]byte, searchChunk+8192)
+	copy(data[searchChunk-3:], "secret")
+	c := writeTextImage(t, data)
+
+	patterns, _ := ParseKeywords([]string{"secret"})
+	var offsets []int64
+	err := Search(c.reader, SearchOptions{Patterns: patterns}, func(h SearchHit) error {
+		offsets = append(offsets, h.Offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if want := []int64{searchChunk - 3}; !reflect.DeepEqual(offsets, want) {
+		t.Errorf("Expected hits at %v, got %v", want, offsets)
+	}
+}
+
+func TestHexDump(t *testing.T) {
+	got := hexDump([]byte("0123456789abcdefXY\x00"), 0x100)
+	want := "    0000000100  30 31 32 33 34 35 36 37 38 39 61 62 63 64 65 66  |0123456789abcdef|\n" +
+		"    0000000110  58 59 00" + strings.Repeat("   ", 13) + "  |XY.|\n"
+	if got != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, got)
+	}
+}
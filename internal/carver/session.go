@@ -0,0 +1,244 @@
+package carver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// A session manifest is the record of a run that later runs build on: the
+// scan report of the source, with whether each file has been recovered and
+// where to. Every scan writes one to the output directory, in every mode:
+//
+//	{
+//	  "version": 1,
+//	  "mode": "smart",
+//	  "source": {"path": "disk.img", "size": 8589934592},
+//	  "filesystem": "ntfs",
+//	  "files": [
+//	    {"id": 3221356544, "path": "partition1/Users/anna/report.docx", "status": "deleted", ...,
+//	     "recovery": "recovered", "output": "filesystem/partition1/Users/anna/report.docx"},
+//
+// Deleted files with data left and carving hits are pending until a run
+// writes them, as are live files when the run takes them too (a full
+// extraction); other live files, directories and deleted files with
+// nothing left to read are skipped.
+
+// SessionFile is the session manifest written below the output directory
+const SessionFile = "session.json"
+
+// SessionVersion is the version of the manifest format, raised when a
+// change would mislead an older reader
+const SessionVersion = 1
+
+// Modes a session records
+const (
+	SessionFilesystem = "filesystem"
+	SessionCarve      = "carve"
+	SessionSmart      = "smart"
+)
+
+// Recovery states of a file in a session
+const (
+	RecoveryPending   = "pending"
+	RecoveryRecovered = "recovered"
+	RecoverySkipped   = "skipped"
+)
+
+// Session is a session manifest
+type Session struct {
+	Version    int            `json:"version"`
+	Tool       ReportTool     `json:"tool"`
+	Created    string         `json:"created"`
+	Updated    string         `json:"updated"`
+	Mode       string         `json:"mode"` // filesystem, carve or smart
+	Source     ReportSource   `json:"source"`
+	Filesystem string         `json:"filesystem,omitempty"` // Detected on the source, "" when none was
+	Volumes    []ReportVolume `json:"volumes"`
+	Files      []SessionEntry `json:"files"`
+
+	SourceHash *SourceHash `json:"source_hash,omitempty"` // Set when the source was hashed
+}
+
+// SourceHash is the digest of the whole source taken before and after a
+// run, which match when the run left the source as it found it
+type SourceHash struct {
+	Before    disk.Digest `json:"before"`
+	After     disk.Digest `json:"after"`
+	Unchanged bool        `json:"unchanged"`
+}
+
+// SessionEntry is a file of a session with its recovery state
+type SessionEntry struct {
+	ReportEntry
+	Recovery string `json:"recovery"`         // pending, recovered or skipped
+	Output   string `json:"output,omitempty"` // Copy below the output directory, once recovered
+}
+
+// NewSession records what a run in mode found on the disk and recovered
+// below outputDir, carved being the carved files as Recover returns them
+func NewSession(reader *disk.Reader, outputDir, mode string, carved []CarvedFile, scanOnly bool) Session {
+	defer reader.Purpose("file listing")()
+	report := BuildReport(reader, outputDir, carved, scanOnly)
+	now := time.Now().UTC().Format(time.RFC3339)
+	session := Session{
+		Version: SessionVersion,
+		Tool:    report.Tool,
+		Created: now,
+		Updated: now,
+		Mode:    mode,
+		Source:  report.Source,
+		Volumes: report.Volumes,
+		Files:   make([]SessionEntry, len(report.Files)),
+	}
+	if fs, err := disk.DetectFilesystem(reader); err == nil {
+		session.Filesystem = fs
+	}
+
+	// Where each mode writes the deleted files of the volumes
+	volumeDir, byName := "", mode != SessionCarve
+	if mode == SessionSmart {
+		volumeDir = SmartFilesystemDir
+	}
+	outputs := manifestOutputs(outputDir)
+	for i, e := range report.Files {
+		entry := SessionEntry{ReportEntry: e, Recovery: RecoveryPending}
+		switch {
+		case e.Source == "carved":
+			if e.Status == "carved" {
+				entry.Recovery, entry.Output = RecoveryRecovered, e.Path
+			}
+		case e.Dir || e.Status != "deleted" && !reader.LiveFiles() || e.Recoverable == "none":
+			entry.Recovery = RecoverySkipped
+		case byName && !scanOnly:
+			output := filepath.ToSlash(filepath.Join(volumeDir, filepath.FromSlash(e.Path)))
+			if outputs != nil {
+				// Files with the same path were written in turn
+				queue := outputs[output]
+				if len(queue) == 0 {
+					break
+				}
+				output, outputs[output] = queue[0], queue[1:]
+			} else {
+				output = filepath.ToSlash(disk.SafePath(output))
+			}
+			// A copy handed to the run's sender may be gone from here
+			path := filepath.Join(outputDir, filepath.FromSlash(output))
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() || reader.Sent(path) {
+				entry.Recovery, entry.Output = RecoveryRecovered, output
+			}
+		}
+		session.Files[i] = entry
+	}
+	return session
+}
+
+// manifestOutputs maps the paths of the files in the hash manifest below
+// outputDir, as they were on their volumes, to where they were written, in
+// the order they were; it returns nil when there is no manifest
+func manifestOutputs(outputDir string) map[string][]string {
+	entries, err := disk.LoadManifest(outputDir)
+	if err != nil {
+		return nil
+	}
+	outputs := make(map[string][]string)
+	for _, e := range entries {
+		original := e.Original
+		if original == "" {
+			original = e.Path
+		}
+		outputs[original] = append(outputs[original], e.Path)
+	}
+	return outputs
+}
+
+// WriteSession writes the session manifest of a run to SessionFile below
+// outputDir and returns the number of files in it
+func WriteSession(reader *disk.Reader, outputDir, mode string, carved []CarvedFile, scanOnly bool) (int, error) {
+	session := NewSession(reader, outputDir, mode, carved, scanOnly)
+	if err := reader.Err(); err != nil {
+		return 0, err // Not listed in full
+	}
+	if err := session.Save(filepath.Join(outputDir, SessionFile)); err != nil {
+		return 0, err
+	}
+	return len(session.Files), nil
+}
+
+// LoadSession reads a session manifest
+func LoadSession(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid session manifest %s: %w", path, err)
+	}
+	if s.Version > SessionVersion {
+		return nil, fmt.Errorf("session manifest %s is version %d; this tool reads up to %d", path, s.Version, SessionVersion)
+	}
+	return &s, nil
+}
+
+// Save writes the session manifest to path
+func (s *Session) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// RecordSourceHash adds the digests of the source taken before and after a
+// run to the session manifest below outputDir and reports whether they
+// match
+func RecordSourceHash(outputDir string, before, after disk.Digest) (bool, error) {
+	path := filepath.Join(outputDir, SessionFile)
+	s, err := LoadSession(path)
+	if err != nil {
+		return false, err
+	}
+	s.SourceHash = &SourceHash{Before: before, After: after, Unchanged: before == after}
+	s.Updated = time.Now().UTC().Format(time.RFC3339)
+	return s.SourceHash.Unchanged, s.Save(path)
+}
+
+// renameInSession updates the outputs of renamed files in a session
+// manifest, which are relative to the manifest's directory
+func renameInSession(path string, renamed map[string]string) error {
+	if len(renamed) == 0 {
+		return nil
+	}
+	s, err := LoadSession(path)
+	if err != nil {
+		return err
+	}
+	base := filepath.Dir(path)
+	changed := false
+	for i := range s.Files {
+		f := &s.Files[i]
+		target, ok := renamed[filepath.Join(base, filepath.FromSlash(f.Output))]
+		if f.Output == "" || !ok {
+			continue
+		}
+		rel, err := filepath.Rel(base, target)
+		if err != nil {
+			continue
+		}
+		if f.Path == f.Output {
+			f.Path = filepath.ToSlash(rel) // Carved files are named by their copy
+		}
+		f.Output = filepath.ToSlash(rel)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	s.Updated = time.Now().UTC().Format(time.RFC3339)
+	return s.Save(path)
+}
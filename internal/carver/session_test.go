@@ -0,0 +1,221 @@
+package carver
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/internal/fat32"
+)
+
+func TestWriteSession(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	// REPORT.TXT in cluster 3, a deleted OLD.TXT in cluster 4 and a deleted
+	// LOST.TXT with nothing left
+	volume := makeFAT32(8, 2, 3)
+	le := binary.LittleEndian
+	root := volume[34*512:]
+	for i, f := range []struct {
+		name    string
+		cluster uint16
+		size    uint32
+	}{
+		{"REPORT  TXT", 3, 11},
+		{"\xE5LD     TXT", 4, 5},
+		{"\xE5OST    TXT", 0, 5},
+	} {
+		copy(root[32*i:], f.name)
+		le.PutUint16(root[32*i+26:], f.cluster)
+		le.PutUint32(root[32*i+28:], f.size)
+	}
+	if err := os.WriteFile(tmpFile, volume, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	// What a filesystem recovery and a carve wrote
+	outputDir := filepath.Join(tmpDir, "out")
+	os.MkdirAll(filepath.Join(outputDir, "TXT"), 0755)
+	os.WriteFile(filepath.Join(outputDir, "_LD.TXT"), []byte("hello"), 0644)
+	carvedPath := filepath.Join(outputDir, "TXT", "carved_000001.txt")
+	os.WriteFile(carvedPath, []byte("hello"), 0644)
+	carved := []CarvedFile{{Signature: &FileSignature{Name: "TXT", Extension: ".txt"}, Path: carvedPath, Offset: 34*512 + 2*4096, Size: 5}}
+
+	if n, err := WriteSession(reader, outputDir, SessionFilesystem, carved, false); err != nil || n != 4 {
+		t.Fatalf("Expected 4 files in the session, got %d (%v)", n, err)
+	}
+	path := filepath.Join(outputDir, SessionFile)
+	s, err := LoadSession(path)
+	if err != nil {
+		t.Fatalf("Failed to load session: %v", err)
+	}
+	if s.Version != SessionVersion || s.Mode != SessionFilesystem || s.Filesystem != "fat32" || s.Source.Path != tmpFile || len(s.Volumes) != 1 {
+		t.Errorf("Unexpected session header %+v", s)
+	}
+	want := []struct {
+		id                     int
+		path, recovery, output string
+	}{
+		{34 * 512, "REPORT.TXT", RecoverySkipped, ""},
+		{34*512 + 32, "?LD.TXT", RecoveryRecovered, "_LD.TXT"},
+		{34*512 + 64, "?OST.TXT", RecoverySkipped, ""},
+		{34*512 + 2*4096, "TXT/carved_000001.txt", RecoveryRecovered, "TXT/carved_000001.txt"},
+	}
+	for i, w := range want {
+		f := s.Files[i]
+		if f.ID != w.id || f.Path != w.path || f.Recovery != w.recovery || f.Output != w.output {
+			t.Errorf("File %d: expected %+v, got %+v", i+1, w, f)
+		}
+	}
+
+	// Renaming a copy moves its output
+	renamed := map[string]string{carvedPath: carvedPath + ".log"}
+	if err := renameInSession(path, renamed); err != nil {
+		t.Fatalf("Failed to rename in session: %v", err)
+	}
+	if s, _ = LoadSession(path); s.Files[3].Output != "TXT/carved_000001.txt.log" || s.Files[3].Path != s.Files[3].Output {
+		t.Errorf("Expected the renamed output, got %+v", s.Files[3])
+	}
+
+	// A scan, or a carve, has not recovered the deleted files by name
+	for _, mode := range []string{SessionCarve, SessionSmart} {
+		scanOnly := mode == SessionSmart
+		s := NewSession(reader, outputDir, mode, nil, scanOnly)
+		if len(s.Files) != 3 || s.Files[1].Recovery != RecoveryPending || s.Files[1].Output != "" {
+			t.Errorf("%s: expected OLD.TXT pending, got %+v", mode, s.Files)
+		}
+	}
+
+	// A full extraction has yet to write the live REPORT.TXT
+	reader.SetLiveFiles(true)
+	full := NewSession(reader, outputDir, SessionFilesystem, nil, false)
+	if full.Files[0].Recovery != RecoveryPending || full.Files[2].Recovery != RecoverySkipped {
+		t.Errorf("Expected REPORT.TXT pending and LOST.TXT skipped, got %+v", full.Files)
+	}
+}
+
+func TestLoadSessionVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SessionFile)
+	os.WriteFile(path, []byte(`{"version": 99, "files": []}`), 0644)
+	if _, err := LoadSession(path); err == nil || !strings.Contains(err.Error(), "version 99") {
+		t.Errorf("Expected a version error, got %v", err)
+	}
+}
+
+func TestRecordSourceHash(t *testing.T) {
+	dir := t.TempDir()
+	s := Session{Version: SessionVersion, Mode: SessionCarve}
+	if err := s.Save(filepath.Join(dir, SessionFile)); err != nil {
+		t.Fatalf("Failed to save session: %v", err)
+	}
+
+	digest := disk.Digest{Size: 11, MD5: "m", SHA256: "s"}
+	if unchanged, err := RecordSourceHash(dir, digest, digest); err != nil || !unchanged {
+		t.Errorf("Expected matching digests, got %v (%v)", unchanged, err)
+	}
+	changed := digest
+	changed.SHA256 = "t"
+	if unchanged, err := RecordSourceHash(dir, digest, changed); err != nil || unchanged {
+		t.Errorf("Expected differing digests, got %v (%v)", unchanged, err)
+	}
+	loaded, err := LoadSession(filepath.Join(dir, SessionFile))
+	if err != nil || loaded.SourceHash == nil || loaded.SourceHash.Unchanged || loaded.SourceHash.After.SHA256 != "t" || loaded.Mode != SessionCarve {
+		t.Errorf("Expected the source hashes recorded, got %+v (%v)", loaded, err)
+	}
+}
+
+func TestSessionCollisions(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	// Deleted OLD.TXT and BLD.TXT, which both come back as ?LD.TXT and are
+	// written as _LD.TXT and _LD (2).TXT
+	volume := makeFAT32(8, 2)
+	le := binary.LittleEndian
+	root := volume[34*512:]
+	for i, name := range []string{"\xE5LD     TXT", "\xE5LD     TXT"} {
+		copy(root[32*i:], name)
+		le.PutUint16(root[32*i+26:], uint16(3+i))
+		le.PutUint32(root[32*i+28:], 5)
+	}
+	copy(volume[34*512+4096:], "first")
+	copy(volume[34*512+2*4096:], "other")
+	if err := os.WriteFile(tmpFile, volume, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	outputDir := filepath.Join(tmpDir, "out")
+	if n, err := fat32.Recover(reader, outputDir, false, false); err != nil || n != 2 {
+		t.Fatalf("Expected 2 files recovered, got %d (%v)", n, err)
+	}
+	for path, want := range map[string]string{"_LD.TXT": "first", "_LD (2).TXT": "other"} {
+		if data, err := os.ReadFile(filepath.Join(outputDir, path)); err != nil || string(data) != want {
+			t.Errorf("Expected %s to hold %q, got %q (%v)", path, want, data, err)
+		}
+	}
+	entries, err := disk.LoadManifest(outputDir)
+	if err != nil || len(entries) != 2 || entries[1].Path != "_LD (2).TXT" || entries[1].Original != "?LD.TXT" {
+		t.Errorf("Expected the second file's original path in the manifest, got %+v (%v)", entries, err)
+	}
+
+	s := NewSession(reader, outputDir, SessionFilesystem, nil, false)
+	if len(s.Files) != 2 || s.Files[0].Output != "_LD.TXT" || s.Files[1].Output != "_LD (2).TXT" || s.Files[1].Path != "?LD.TXT" {
+		t.Errorf("Expected each file with its own output, got %+v", s.Files)
+	}
+}
+
+func TestSessionCompressed(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	// A deleted OLD.TXT, written as _LD.TXT.zst
+	volume := makeFAT32(8, 2)
+	le := binary.LittleEndian
+	root := volume[34*512:]
+	copy(root, "\xE5LD     TXT")
+	le.PutUint16(root[26:], 3)
+	le.PutUint32(root[28:], 5)
+	copy(volume[34*512+4096:], "first")
+	if err := os.WriteFile(tmpFile, volume, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+	reader.Compress(disk.CompressZstd)
+
+	outputDir := filepath.Join(tmpDir, "out")
+	if n, err := fat32.Recover(reader, outputDir, false, false); err != nil || n != 1 {
+		t.Fatalf("Expected 1 file recovered, got %d (%v)", n, err)
+	}
+	path := filepath.Join(outputDir, "_LD.TXT.zst")
+	digest, err := digestFile(reader, path)
+	if err != nil || digest.Size != 5 {
+		t.Fatalf("Expected the file to decompress to 5 bytes, got %+v (%v)", digest, err)
+	}
+	entries, err := disk.LoadManifest(outputDir)
+	if err != nil || len(entries) != 1 || entries[0].Original != "?LD.TXT" || entries[0].Digest != digest {
+		t.Errorf("Expected the digest of the recovered content in the manifest, got %+v (%v)", entries, err)
+	}
+
+	s := NewSession(reader, outputDir, SessionFilesystem, nil, false)
+	if len(s.Files) != 1 || s.Files[0].Recovery != RecoveryRecovered || s.Files[0].Output != "_LD.TXT.zst" {
+		t.Errorf("Expected the compressed file as the output, got %+v", s.Files)
+	}
+}
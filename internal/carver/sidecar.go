@@ -0,0 +1,96 @@
+package carver
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// A sidecar is written next to each recovered file, so that where it came
+// from stays with it when it is copied out of the output directory:
+//
+//	report.docx
+//	report.docx.meta.json
+//
+//	{
+//	  "tool": {"name": "recover", "version": "1.4.0"},
+//	  "source": {"path": "/dev/sdb", "size": 8589934592},
+//	  "recovered": "2024-03-01T10:15:02Z",
+//	  "file": {"id": 1, "path": "partition1/Users/anna/report.docx", "source": "ntfs",
+//	           "status": "deleted", "inode": 4711, "modified": "2021-06-14T09:55:21Z",
+//	           "data_runs": [{"offset": 88604672, "length": 20480}], ...},
+//	  "hashes": {"size": 20480, "md5": "...", "sha256": "..."}
+//	}
+//
+// The file is described as in the session manifest: its original path, MFT
+// record (inode) and data runs on the source, times and whether it was
+// deleted; the hashes are those of the copy.
+
+// SidecarSuffix is appended to a recovered file's name to name its sidecar
+const SidecarSuffix = ".meta.json"
+
+// Sidecar describes where a recovered file came from
+type Sidecar struct {
+	Tool      ReportTool   `json:"tool"`
+	Source    ReportSource `json:"source"`
+	Recovered string       `json:"recovered"`
+	File      ReportEntry  `json:"file"`
+	Hashes    disk.Digest  `json:"hashes"`
+}
+
+// IsSidecar reports whether a file name is that of a sidecar
+func IsSidecar(name string) bool {
+	return strings.HasSuffix(name, SidecarSuffix)
+}
+
+// WriteSidecars writes a sidecar next to every file the run in mode
+// recovered below outputDir, carved being the carved files as Recover
+// returns them, and returns the number written. Hashes are taken from the
+// hash manifest below outputDir, or from the file when it has none.
+func WriteSidecars(reader *disk.Reader, outputDir, mode string, carved []CarvedFile, scanOnly bool) (int, error) {
+	if scanOnly {
+		return 0, nil
+	}
+	session := NewSession(reader, outputDir, mode, carved, scanOnly)
+	digests := make(map[string]disk.Digest)
+	if entries, err := disk.LoadManifest(outputDir); err == nil {
+		for _, e := range entries {
+			digests[e.Path] = e.Digest
+		}
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	n := 0
+	for _, f := range session.Files {
+		if f.Recovery != RecoveryRecovered {
+			continue
+		}
+		path := filepath.Join(outputDir, filepath.FromSlash(f.Output))
+		digest, ok := digests[f.Output]
+		if !ok {
+			var err error
+			if digest, err = digestFile(reader, path); err != nil {
+				reader.Errorf("  Failed to digest %s: %v\n", path, err)
+				continue
+			}
+		}
+		sidecar := Sidecar{Tool: session.Tool, Source: session.Source, Recovered: now, File: f.ReportEntry, Hashes: digest}
+		sidecar.File.SHA256 = digest.SHA256
+		data, err := json.MarshalIndent(sidecar, "", "  ")
+		if err != nil {
+			return n, err
+		}
+		if err := os.WriteFile(path+SidecarSuffix, append(data, '\n'), 0644); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if n > 0 {
+		reader.Printf("\nWrote %d sidecars (%s)\n", n, SidecarSuffix)
+	}
+	return n, nil
+}
@@ -0,0 +1,73 @@
+package carver
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func TestWriteSidecars(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	// A deleted OLD.TXT in cluster 4
+	volume := makeFAT32(8, 2)
+	le := binary.LittleEndian
+	root := volume[34*512:]
+	copy(root, "\xE5LD     TXT")
+	le.PutUint16(root[26:], 4)
+	le.PutUint32(root[28:], 5)
+	if err := os.WriteFile(tmpFile, volume, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	// What a filesystem recovery and a carve wrote; only the first is in the
+	// hash manifest
+	outputDir := filepath.Join(tmpDir, "out")
+	os.MkdirAll(filepath.Join(outputDir, "TXT"), 0755)
+	os.WriteFile(filepath.Join(outputDir, "?LD.TXT"), []byte("hello"), 0644)
+	carvedPath := filepath.Join(outputDir, "TXT", "carved_000001.txt")
+	os.WriteFile(carvedPath, []byte("world"), 0644)
+	carved := []CarvedFile{{Signature: &FileSignature{Name: "TXT", Extension: ".txt"}, Path: carvedPath, Offset: 34*512 + 2*4096, Size: 5}}
+	digest := disk.Digest{Size: 5, MD5: "m", SHA256: "s"}
+	disk.WriteManifest(outputDir, []disk.ManifestEntry{{Path: "?LD.TXT", Digest: digest}})
+
+	if n, err := WriteSidecars(reader, outputDir, SessionFilesystem, nil, true); err != nil || n != 0 {
+		t.Errorf("Expected no sidecars for a scan, got %d (%v)", n, err)
+	}
+	if n, err := WriteSidecars(reader, outputDir, SessionFilesystem, carved, false); err != nil || n != 2 {
+		t.Fatalf("Expected 2 sidecars, got %d (%v)", n, err)
+	}
+
+	load := func(path string) Sidecar {
+		var s Sidecar
+		data, err := os.ReadFile(path + SidecarSuffix)
+		if err != nil {
+			t.Fatalf("Failed to read sidecar: %v", err)
+		}
+		if err := json.Unmarshal(data, &s); err != nil {
+			t.Fatalf("Invalid sidecar: %v", err)
+		}
+		return s
+	}
+	s := load(filepath.Join(outputDir, "?LD.TXT"))
+	if s.Source.Path != tmpFile || s.File.Path != "?LD.TXT" || s.File.Source != "fat32" || s.File.Status != "deleted" || s.Hashes != digest {
+		t.Errorf("Unexpected sidecar %+v", s)
+	}
+	if len(s.File.Runs) != 1 || s.File.Runs[0].Offset != 34*512+2*4096 {
+		t.Errorf("Expected the cluster of OLD.TXT, got %+v", s.File.Runs)
+	}
+	want, _ := digestFile(reader, carvedPath)
+	if s := load(carvedPath); s.File.Source != "carved" || s.Hashes != want || s.File.SHA256 != want.SHA256 {
+		t.Errorf("Expected the carved file digested, got %+v", s)
+	}
+}
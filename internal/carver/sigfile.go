@@ -0,0 +1,177 @@
+package carver
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// signatureSpec is the on-disk form of a FileSignature. Headers and footers
+// are written as hex strings so they can be edited by hand.
+type signatureSpec struct {
+	Name      string `yaml:"name"`
+	Extension string `yaml:"extension"`
+	Header    string `yaml:"header"`
+	Footer    string `yaml:"footer"`
+	MaxSize   int64  `yaml:"max_size"`
+	MinSize   int64  `yaml:"min_size"`
+	Offset    int    `yaml:"offset"`
+	Alignment int64  `yaml:"alignment"`
+
+	CaseInsensitive bool   `yaml:"case_insensitive"`
+	FooterMode      string `yaml:"footer_mode"` // "first" (default), "last" or "exclude"
+}
+
+// LoadSignatures reads user-defined signatures from a YAML or JSON file, or
+// from a scalpel/foremost configuration when the file name ends in ".conf".
+//
+// A YAML or JSON file holds either a list of signatures or a mapping with a
+// "signatures" key containing the list:
+//
+//	signatures:
+//	  - name: Canon CRW
+//	    extension: .crw
+//	    header: "49 49 1A 00 ?? ?? 48 45 41 50"
+//	    max_size: 52428800
+//	    alignment: 512
+//
+// "??" in a header matches any byte.
+func LoadSignatures(path string) ([]FileSignature, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signature file: %w", err)
+	}
+
+	var sigs []FileSignature
+	if strings.EqualFold(filepath.Ext(path), ".conf") {
+		sigs, err = ParseScalpelConfig(data)
+	} else {
+		sigs, err = ParseSignatures(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return sigs, nil
+}
+
+// ParseSignatures decodes YAML or JSON signature definitions
+func ParseSignatures(data []byte) ([]FileSignature, error) {
+	var specs []signatureSpec
+	var doc struct {
+		Signatures []signatureSpec `yaml:"signatures"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err == nil && doc.Signatures != nil {
+		specs = doc.Signatures
+	} else if err := yaml.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("invalid signature file: %w", err)
+	}
+
+	sigs := make([]FileSignature, 0, len(specs))
+	for i, spec := range specs {
+		sig, err := spec.toSignature()
+		if err != nil {
+			return nil, fmt.Errorf("signature %d (%s): %w", i+1, spec.Name, err)
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
+
+func (s signatureSpec) toSignature() (FileSignature, error) {
+	if s.Name == "" {
+		return FileSignature{}, fmt.Errorf("missing name")
+	}
+	header, wild, err := parsePattern(s.Header)
+	if err != nil {
+		return FileSignature{}, fmt.Errorf("header: %w", err)
+	}
+	if len(header) == 0 {
+		return FileSignature{}, fmt.Errorf("missing header")
+	}
+	footer, err := parseHex(s.Footer)
+	if err != nil {
+		return FileSignature{}, fmt.Errorf("footer: %w", err)
+	}
+	if s.Offset < 0 || s.MaxSize < 0 || s.MinSize < 0 || s.Alignment < 0 {
+		return FileSignature{}, fmt.Errorf("offset, sizes and alignment must not be negative")
+	}
+
+	var mode FooterMode
+	switch strings.ToLower(s.FooterMode) {
+	case "", "first":
+		mode = FooterFirst
+	case "last", "reverse":
+		mode = FooterLast
+	case "exclude", "next":
+		mode = FooterExclude
+	default:
+		return FileSignature{}, fmt.Errorf("unknown footer_mode %q", s.FooterMode)
+	}
+
+	ext := s.Extension
+	if ext == "" {
+		ext = "." + strings.ToLower(s.Name)
+	} else if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+
+	return FileSignature{
+		Name:      s.Name,
+		Extension: ext,
+		Header:    header,
+		Footer:    footer,
+		MaxSize:   s.MaxSize,
+		MinSize:   s.MinSize,
+		Offset:    s.Offset,
+		Alignment: s.Alignment,
+
+		Wildcard:        wild,
+		CaseInsensitive: s.CaseInsensitive,
+		FooterMode:      mode,
+	}, nil
+}
+
+// hexSeparators strips the separators and prefixes allowed in hex strings
+var hexSeparators = strings.NewReplacer(" ", "", ",", "", "0x", "", "0X", "", "\\x", "")
+
+// parseHex decodes hex strings such as "FFD8FF", "FF D8 FF" or "0xFF,0xD8"
+func parseHex(s string) ([]byte, error) {
+	s = hexSeparators.Replace(s)
+	if s == "" {
+		return nil, nil
+	}
+	return hex.DecodeString(s)
+}
+
+// parsePattern decodes a hex header in which "??" stands for any byte. The
+// wildcard mask is nil when the pattern has no wildcards.
+func parsePattern(s string) ([]byte, []bool, error) {
+	s = hexSeparators.Replace(s)
+	if !strings.Contains(s, "??") {
+		b, err := parseHex(s)
+		return b, nil, err
+	}
+	if len(s)%2 != 0 {
+		return nil, nil, fmt.Errorf("odd length hex string %q", s)
+	}
+
+	out := make([]byte, len(s)/2)
+	wild := make([]bool, len(s)/2)
+	for i := range out {
+		pair := s[i*2 : i*2+2]
+		if pair == "??" {
+			wild[i] = true
+			continue
+		}
+		b, err := hex.DecodeString(pair)
+		if err != nil {
+			return nil, nil, err
+		}
+		out[i] = b[0]
+	}
+	return out, wild, nil
+}
@@ -0,0 +1,126 @@
+package carver
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func TestParseSignatures(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name: "YAML mapping",
+			input: `signatures:
+  - name: CRW
+    extension: crw
+    header: "49 49 1A 00"
+    footer: "FF D9"
+    max_size: 1024
+    offset: 2
+    alignment: 512
+`,
+		},
+		{
+			name: "YAML list",
+			input: `- name: CRW
+  extension: .crw
+  header: 0x49,0x49,0x1A,0x00
+  footer: FFD9
+  max_size: 1024
+  offset: 2
+  alignment: 512
+`,
+		},
+		{
+			name:  "JSON",
+			input: `{"signatures": [{"name": "CRW", "extension": ".crw", "header": "49491A00", "footer": "FFD9", "max_size": 1024, "offset": 2, "alignment": 512}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sigs, err := ParseSignatures([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("ParseSignatures failed: %v", err)
+			}
+			if len(sigs) != 1 {
+				t.Fatalf("Expected 1 signature, got %d", len(sigs))
+			}
+			sig := sigs[0]
+			if sig.Name != "CRW" || sig.Extension != ".crw" {
+				t.Errorf("Unexpected name/extension: %s %s", sig.Name, sig.Extension)
+			}
+			if !bytes.Equal(sig.Header, []byte{0x49, 0x49, 0x1A, 0x00}) {
+				t.Errorf("Unexpected header: % X", sig.Header)
+			}
+			if !bytes.Equal(sig.Footer, []byte{0xFF, 0xD9}) {
+				t.Errorf("Unexpected footer: % X", sig.Footer)
+			}
+			if sig.MaxSize != 1024 || sig.Offset != 2 || sig.Alignment != 512 {
+				t.Errorf("Unexpected sizes: max=%d offset=%d alignment=%d", sig.MaxSize, sig.Offset, sig.Alignment)
+			}
+		})
+	}
+}
+
+func TestParseSignaturesInvalid(t *testing.T) {
+	inputs := []string{
+		`- name: NoHeader`,
+		`- header: "FFD8"`,
+		`- name: BadHex
+  header: "XYZ"`,
+		`- name: Negative
+  header: "FF"
+  offset: -1`,
+	}
+
+	for _, input := range inputs {
+		if _, err := ParseSignatures([]byte(input)); err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+}
+
+func TestScanOffsetAndAlignment(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	// Magic "ABCD" appears 4 bytes into each file; only the copy whose
+	// file start is 512-aligned should match.
+	data := make([]byte, 64*1024)
+	copy(data[1024+4:], "ABCD")
+	copy(data[2000+4:], "ABCD")
+
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	carver := NewCarver(reader)
+	carver.SetSignatures([]FileSignature{
+		{Name: "TEST", Extension: ".test", Header: []byte("ABCD"), Offset: 4, Alignment: 512},
+	})
+
+	files, err := carver.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 file, got %d", len(files))
+	}
+	if files[0].Offset != 1024 {
+		t.Errorf("Expected file at offset 1024, got %d", files[0].Offset)
+	}
+}
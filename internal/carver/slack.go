@@ -0,0 +1,150 @@
+package carver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/internal/fat32"
+	"github.com/shubham/recovery/internal/ntfs"
+)
+
+// A file rarely fills its last cluster, and the rest of that cluster keeps
+// what was written there before: often part of a file since deleted. That
+// slack is read from each file in use on the disk's FAT32 and NTFS volumes
+// and written either next to the file's path or into one blob with a map:
+//
+//	slack/Users/anna/report.docx.slack
+//	slack/slack.bin + slack/slack.map   (path, offset, source_offset, length)
+
+// SlackDir is the directory, below the output directory, that file slack
+// goes to
+const SlackDir = "slack"
+
+const (
+	slackSuffix   = ".slack"
+	SlackBlobFile = "slack.bin" // All the slack, with SlackMapFile
+	SlackMapFile  = "slack.map"
+)
+
+// FileSlack returns the slack of the files in use on the disk's FAT32 and
+// NTFS volumes, with their paths below partitionN/ on a partitioned disk
+func FileSlack(reader *disk.Reader) ([]disk.Slack, error) {
+	defer reader.Purpose("slack")()
+	var slack []disk.Slack
+	found := false
+	for _, v := range diskVolumes(reader) {
+		fs, err := disk.DetectFilesystem(v.reader)
+		if err != nil {
+			continue
+		}
+		var files []disk.Slack
+		switch fs {
+		case "ntfs":
+			p, err := ntfs.NewParser(v.reader)
+			if err != nil {
+				continue
+			}
+			files, err = p.Slack()
+		case "fat32":
+			p, err := fat32.NewParser(v.reader)
+			if err != nil {
+				continue
+			}
+			files, err = p.Slack()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+		for _, f := range files {
+			f.Path = filepath.Join(v.name, f.Path)
+			f.Offset += v.Offset
+			slack = append(slack, f)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no FAT32 or NTFS volume found")
+	}
+	return slack, nil
+}
+
+// ExtractSlack writes the slack of the files in use below outputDir, as a
+// sidecar per file or, when combined is set, as one blob with a map. Slack
+// that is all zeros, as operating systems that clear it leave it, is
+// skipped. With scanOnly only the amount is reported. It returns the number
+// of files whose slack was written.
+func ExtractSlack(reader *disk.Reader, outputDir string, scanOnly, combined bool) (int, error) {
+	defer reader.Purpose("slack")()
+	slack, err := FileSlack(reader)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, s := range slack {
+		total += s.Length
+	}
+	reader.Printf("Found %d bytes of slack in %d files\n", total, len(slack))
+	if scanOnly || len(slack) == 0 {
+		return 0, nil
+	}
+
+	dir := filepath.Join(outputDir, SlackDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+	var blob *os.File
+	var m *bufio.Writer
+	var written int64 // To the blob
+	if combined {
+		if blob, err = os.Create(filepath.Join(dir, SlackBlobFile)); err != nil {
+			return 0, err
+		}
+		defer blob.Close()
+		mf, err := os.Create(filepath.Join(dir, SlackMapFile))
+		if err != nil {
+			return 0, err
+		}
+		defer mf.Close()
+		m = bufio.NewWriter(mf)
+		defer m.Flush()
+		fmt.Fprintln(m, "path\toffset\tsource_offset\tlength")
+	}
+
+	count, zeros := 0, 0
+	for _, s := range slack {
+		data := make([]byte, s.Length)
+		if _, err := reader.ReadAt(data, s.Offset); err != nil && err != io.EOF {
+			return count, err
+		}
+		if isConstant(data) && data[0] == 0 {
+			zeros++
+			continue
+		}
+
+		if combined {
+			if _, err := blob.Write(data); err != nil {
+				return count, err
+			}
+			fmt.Fprintf(m, "%s\t%d\t%d\t%d\n", filepath.ToSlash(s.Path), written, s.Offset, s.Length)
+			written += s.Length
+		} else {
+			path := filepath.Join(dir, disk.SafePath(s.Path+slackSuffix))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return count, err
+			}
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				return count, err
+			}
+		}
+		count++
+	}
+
+	reader.Printf("Wrote the slack of %d files to %s (%d held only zeros)\n", count, dir, zeros)
+	return count, nil
+}
@@ -0,0 +1,69 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func TestExtractSlack(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	// REPORT.TXT holds 100 bytes of cluster 3, whose tail still holds the
+	// text of a deleted file; ZERO.TXT's slack in cluster 4 was cleared
+	volume := makeFAT32(8, 2, 3, 4)
+	dataStart := 34 * 512
+	root := volume[dataStart:]
+	for i, e := range []struct {
+		name    string
+		cluster uint32
+	}{{"REPORT  TXT", 3}, {"ZERO    TXT", 4}} {
+		entry := root[32*i:]
+		copy(entry, e.name)
+		binary.LittleEndian.PutUint16(entry[26:], uint16(e.cluster))
+		binary.LittleEndian.PutUint32(entry[28:], 100)
+	}
+	remnant := bytes.Repeat([]byte("old secret "), 372)[:4096-100]
+	copy(volume[dataStart+4096+100:], remnant)
+
+	if err := os.WriteFile(tmpFile, volume, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	// A sidecar per file
+	outputDir := filepath.Join(tmpDir, "sidecars")
+	if n, err := ExtractSlack(reader, outputDir, false, false); err != nil || n != 1 {
+		t.Fatalf("Expected the slack of one file, got %d (%v)", n, err)
+	}
+	got, err := os.ReadFile(filepath.Join(outputDir, SlackDir, "REPORT.TXT"+slackSuffix))
+	if err != nil {
+		t.Fatalf("Failed to read slack: %v", err)
+	}
+	if !bytes.Equal(got, remnant) {
+		t.Error("Sidecar does not hold the slack of REPORT.TXT")
+	}
+
+	// One blob with a map
+	outputDir = filepath.Join(tmpDir, "blob")
+	if _, err := ExtractSlack(reader, outputDir, false, true); err != nil {
+		t.Fatalf("ExtractSlack failed: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(outputDir, SlackDir, SlackBlobFile)); !bytes.Equal(got, remnant) {
+		t.Error("Blob does not hold the slack of REPORT.TXT")
+	}
+	m, _ := os.ReadFile(filepath.Join(outputDir, SlackDir, SlackMapFile))
+	want := "path\toffset\tsource_offset\tlength\nREPORT.TXT\t0\t21604\t3996\n"
+	if string(m) != want {
+		t.Errorf("Expected map %q, got %q", want, m)
+	}
+}
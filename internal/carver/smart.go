@@ -0,0 +1,375 @@
+package carver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/internal/fat32"
+	"github.com/shubham/recovery/internal/ntfs"
+)
+
+// A smart recovery combines both modes: the deleted files the FAT32 and NTFS
+// volumes still list are recovered with their names first, then only the
+// clusters that neither they nor any live file hold are carved. Carvings of
+// content already recovered are folded into the named file, and everything
+// written is listed in one report:
+//
+//	filesystem/partition1/Users/anna/report.docx
+//	carved/jpg/carved_000012.jpg
+//	report.tsv   (path, source, offset, size, sha256, also)
+
+// Directories below the output directory, and the report of a smart recovery
+const (
+	SmartFilesystemDir = "filesystem"
+	SmartCarvedDir     = "carved"
+	SmartReportFile    = "report.tsv"
+)
+
+// Recovered is a file written by a smart recovery
+type Recovered struct {
+	Path     string // Below the output directory
+	Original string // Path it would have had, when a file before it had taken it (see disk.Names)
+	Source   string // ntfs, fat32 or carved
+	Offset   int64  // Of its first byte on the disk
+	Size     int64
+	MD5      string
+	SHA256   string
+	Extents  []disk.Extent // Where its content was read from, for filesystem files
+	Also     []Provenance  // The same file found by other means, whose copies were dropped
+
+	reread func() (disk.Digest, error) // Recovers it again without writing it, to verify it
+	known  bool                        // Filtered out by the hash set, its copy removed
+}
+
+// Provenance records where a copy of a recovered file was found
+type Provenance struct {
+	Source string // ntfs, fat32 or carved
+	Offset int64  // Of its first byte on the disk
+	SHA256 string // Of the copy, which differs when the two were cut differently
+}
+
+// string formats a provenance record as source@offset, with the copy's
+// digest when it differs from the file's
+func (p Provenance) string(sum string) string {
+	if p.SHA256 != "" && p.SHA256 != sum {
+		return fmt.Sprintf("%s@%d:%s", p.Source, p.Offset, p.SHA256)
+	}
+	return fmt.Sprintf("%s@%d", p.Source, p.Offset)
+}
+
+// SmartRecover recovers the deleted files the disk's filesystems know of,
+// carves the space they leave unclaimed and writes a deduplicated report
+// of both to outputDir. It returns the number of files in the report, with
+// a *disk.PartialRecoveryError for those it could not write.
+func SmartRecover(reader *disk.Reader, outputDir string, scanOnly bool, opts Options) (int, error) {
+	files, err := recoverVolumes(reader, outputDir, scanOnly, opts, func(v volume, fs string) string {
+		return filepath.Join(SmartFilesystemDir, v.name)
+	})
+	var failed []*disk.FileError
+	var partial *disk.PartialRecoveryError
+	if errors.As(err, &partial) {
+		failed = partial.Failed
+	} else if err != nil {
+		return 0, err
+	}
+	free, err := UnallocatedSpace(reader)
+	if err != nil {
+		return 0, err
+	}
+	var claimed []disk.Extent
+	for _, f := range files {
+		claimed = append(claimed, f.Extents...)
+	}
+	unclaimed := disk.Subtract(free, claimed)
+	// Known files stay claimed, so they are not carved again either
+	if !scanOnly {
+		files = dropKnown(reader, files, opts)
+	}
+
+	var total int64
+	for _, e := range unclaimed {
+		total += e.Length
+	}
+	reader.Printf("\nRecovered %d files from filesystems; carving the %d bytes in %d extents they leave unclaimed\n",
+		len(files), total, len(unclaimed))
+
+	var carved []CarvedFile
+	dfxml, report, session, manifest, sidecars, kept := opts.DFXML, opts.Report, opts.Session, opts.Manifest, opts.Sidecars, opts.Carved
+	if len(unclaimed) > 0 {
+		opts.FreeOnly, opts.DFXML, opts.Report, opts.Session = false, false, ReportOff, false
+		opts.Manifest, opts.Sidecars = false, false
+		opts.extents = unclaimed
+		opts.filesystem = pointers(files)
+		opts.Carved = &carved
+		_, err := Recover(reader, filepath.Join(outputDir, SmartCarvedDir), scanOnly, opts)
+		if errors.As(err, &partial) {
+			failed = append(failed, partial.Failed...)
+		} else if err != nil {
+			return len(files), err
+		}
+	}
+	if kept != nil {
+		*kept = carved
+	}
+	if _, err := WriteReport(reader, outputDir, report, carved, scanOnly); err != nil {
+		return len(files), err
+	}
+	if session {
+		if _, err := WriteSession(reader, outputDir, SessionSmart, carved, scanOnly); err != nil {
+			return len(files), err
+		}
+	}
+	if scanOnly {
+		return len(files), nil
+	}
+
+	n, err := writeSmartReport(outputDir, files, carved)
+	if err != nil {
+		return n, err
+	}
+	if manifest {
+		if err := writeManifest(reader, outputDir, files, carved); err != nil {
+			return n, err
+		}
+	}
+	if sidecars {
+		if _, err := WriteSidecars(reader, outputDir, SessionSmart, carved, false); err != nil {
+			return n, err
+		}
+	}
+	if dfxml {
+		if _, err := WriteDFXML(reader, outputDir, carved); err != nil {
+			return n, err
+		}
+	}
+	reader.Printf("\nListed %d recovered files in %s\n", n, filepath.Join(outputDir, SmartReportFile))
+	return n, disk.Partial(n, failed)
+}
+
+// recoverVolumes recovers the deleted files of the disk's FAT32 and NTFS
+// volumes below outputDir, each volume's in the directory dir names. With
+// scanOnly they are only listed, with the clusters they would be read from.
+// Files opts.KnownFiles filters out are removed as they are written and
+// marked known. Files it could not write are left out, and returned as a
+// *disk.PartialRecoveryError.
+func recoverVolumes(reader *disk.Reader, outputDir string, scanOnly bool, opts Options, dir func(v volume, fs string) string) ([]Recovered, error) {
+	defer reader.Purpose("filesystem recovery")()
+	var files []Recovered
+	var failed []*disk.FileError
+	names := disk.NewNames()
+	add := func(v volume, source, path string, size int64, extents []disk.Extent, write func(string) (disk.Digest, error), reread func() (disk.Digest, error)) {
+		// Files with the same path are all kept, the later under a new name
+		original := filepath.Join(dir(v, source), path)
+		f := Recovered{
+			Path:    reader.OutputPath(names.Claim(original)),
+			Source:  source,
+			Size:    size,
+			Extents: disk.Shift(extents, v.Offset),
+			reread:  reread,
+		}
+		if f.Path != original {
+			f.Original = original
+		}
+		if len(f.Extents) > 0 {
+			f.Offset = f.Extents[0].Offset
+		}
+		if !scanOnly {
+			outPath := filepath.Join(outputDir, f.Path)
+			digest, err := write(outPath)
+			if err != nil {
+				reader.Errorf("  Failed to recover %s: %v\n", f.Path, err)
+				failed = append(failed, &disk.FileError{Path: f.Path, Err: err})
+				return
+			}
+			f.MD5, f.SHA256, f.Size = digest.MD5, digest.SHA256, digest.Size
+			if opts.KnownFiles.filtered(reader, outPath, digest.SHA256, opts.KeepKnown) {
+				os.Remove(outPath)
+				f.known = true
+				files = append(files, f)
+				return
+			}
+			reader.Printf("  Recovered: %s\n", outPath)
+			reader.Recovered(disk.WrittenFile{Path: outPath, Original: path, Source: source, Digest: digest})
+			reader.Finished(outPath)
+		}
+		files = append(files, f)
+	}
+
+	for _, v := range diskVolumes(reader) {
+		fs, err := disk.DetectFilesystem(v.reader)
+		if err != nil {
+			continue
+		}
+		switch fs {
+		case "ntfs":
+			p, err := ntfs.NewParser(v.reader)
+			if err != nil {
+				continue
+			}
+			check := p // Recovers the files again without writing them
+			if reader.Verifying() {
+				if check, err = ntfs.NewParser(v.reader.Verifier()); err != nil {
+					return files, err
+				}
+			}
+			deleted, err := p.ScanDeletedFiles(p.RecordCount())
+			if err != nil {
+				return nil, err
+			}
+			var plan []int64
+			for _, f := range deleted {
+				if !f.IsDirectory && len(f.DataRuns) > 0 {
+					plan = append(plan, int64(f.Size))
+				}
+			}
+			if err := planOutput(reader, plan, scanOnly); err != nil {
+				return files, err
+			}
+			for _, f := range deleted {
+				if err := reader.Err(); err != nil {
+					return files, err
+				}
+				if f.IsDirectory || len(f.DataRuns) == 0 {
+					continue
+				}
+				add(v, fs, f.Path, int64(f.Size), p.FileExtents(f), func(path string) (disk.Digest, error) {
+					return p.RecoverFile(f, path)
+				}, func() (disk.Digest, error) {
+					return check.RecoverFile(f, "")
+				})
+			}
+		case "fat32":
+			p, err := fat32.NewParser(v.reader)
+			if err != nil {
+				continue
+			}
+			check := p // Recovers the files again without writing them
+			if reader.Verifying() {
+				if check, err = fat32.NewParser(v.reader.Verifier()); err != nil {
+					return files, err
+				}
+			}
+			deleted, err := p.ScanDeletedFiles()
+			if err != nil {
+				return nil, err
+			}
+			var plan []int64
+			for _, f := range deleted {
+				if !f.IsDirectory {
+					plan = append(plan, int64(f.Size))
+				}
+			}
+			if err := planOutput(reader, plan, scanOnly); err != nil {
+				return files, err
+			}
+			for _, f := range deleted {
+				if err := reader.Err(); err != nil {
+					return files, err
+				}
+				if f.IsDirectory {
+					continue
+				}
+				add(v, fs, f.Path, int64(f.Size), p.FileExtents(f), func(path string) (disk.Digest, error) {
+					return p.RecoverFile(f, path)
+				}, func() (disk.Digest, error) {
+					return check.RecoverFile(f, "")
+				})
+			}
+		}
+	}
+	return files, disk.Partial(len(files), failed)
+}
+
+// planOutput plans the space of the files of the sizes given, before a
+// volume's files are written
+func planOutput(reader *disk.Reader, sizes []int64, scanOnly bool) error {
+	if scanOnly {
+		return nil
+	}
+	var total int64
+	for _, size := range sizes {
+		total += size
+	}
+	return reader.PlanOutput(len(sizes), total)
+}
+
+// pointers returns pointers to the elements of files
+func pointers(files []Recovered) []*Recovered {
+	ptrs := make([]*Recovered, len(files))
+	for i := range files {
+		ptrs[i] = &files[i]
+	}
+	return ptrs
+}
+
+// fsIndex finds the file recovered from a filesystem that a carving is a
+// copy of
+type fsIndex struct {
+	byStart map[int64]*Recovered
+	byHash  map[string]*Recovered
+}
+
+func newFSIndex(files []*Recovered) fsIndex {
+	x := fsIndex{byStart: make(map[int64]*Recovered), byHash: make(map[string]*Recovered)}
+	for _, f := range files {
+		if len(f.Extents) > 0 && x.byStart[f.Extents[0].Offset] == nil {
+			x.byStart[f.Extents[0].Offset] = f
+		}
+		if f.SHA256 != "" && x.byHash[f.SHA256] == nil {
+			x.byHash[f.SHA256] = f
+		}
+	}
+	return x
+}
+
+// match returns the recovered file whose data starts in the cluster the
+// carving starts at, or failing that, the one with the carving's content.
+// A carving cut shorter or longer than the filesystem says the file is
+// still starts where it does.
+func (x fsIndex) match(f *CarvedFile) *Recovered {
+	if r := x.byStart[f.Offset]; r != nil {
+		return r
+	}
+	return x.byHash[f.SHA256]
+}
+
+// writeSmartReport lists the files recovered from the filesystems and the
+// carvings kept in SmartReportFile in dir, as tab-separated lines below a
+// header, and returns how many it listed
+func writeSmartReport(dir string, files []Recovered, carved []CarvedFile) (int, error) {
+	for _, f := range carved {
+		if f.Path == "" {
+			continue // Folded into another file
+		}
+		path, err := filepath.Rel(dir, f.Path)
+		if err != nil {
+			path = f.Path
+		}
+		files = append(files, Recovered{Path: path, Source: "carved", Offset: f.Offset, Size: f.Size, SHA256: f.SHA256})
+	}
+
+	out, err := os.Create(filepath.Join(dir, SmartReportFile))
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	fmt.Fprintln(w, "path\tsource\toffset\tsize\tsha256\talso")
+	for _, f := range files {
+		also := make([]string, len(f.Also))
+		for i, p := range f.Also {
+			also[i] = p.string(f.SHA256)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\n", filepath.ToSlash(f.Path), f.Source, f.Offset, f.Size, f.SHA256,
+			strings.Join(also, ";"))
+	}
+	if err := w.Flush(); err != nil {
+		return len(files), err
+	}
+	return len(files), out.Close()
+}
@@ -0,0 +1,130 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func TestSmartRecover(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	// The root directory lists a deleted PHOTO.JPG in cluster 5; a live file
+	// holds cluster 3. Free cluster 9 holds a PNG nothing lists and free
+	// cluster 12 a copy of the photo.
+	volume := makeFAT32(16, 2, 3)
+	dataStart := 34 * 512
+	cluster := func(c int) int { return dataStart + (c-2)*4096 }
+	photo := makeJPEG(t)
+	png := makePNG(t)
+	copy(volume[cluster(2):], []byte("\xE5HOTO   JPG"))
+	volume[cluster(2)+26] = 5
+	volume[cluster(2)+28] = byte(len(photo))
+	volume[cluster(2)+29] = byte(len(photo) >> 8)
+	copy(volume[cluster(3):], photo)
+	copy(volume[cluster(5):], photo)
+	copy(volume[cluster(9):], png)
+	copy(volume[cluster(12):], photo)
+
+	if err := os.WriteFile(tmpFile, volume, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	outputDir := filepath.Join(tmpDir, "out")
+	opts := Options{Signatures: []FileSignature{findSignature(t, "JPEG"), findSignature(t, "PNG")}}
+	n, err := SmartRecover(reader, outputDir, false, opts)
+	if err != nil {
+		t.Fatalf("SmartRecover failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("Expected 2 files, got %d", n)
+	}
+
+	got, err := os.ReadFile(filepath.Join(outputDir, SmartFilesystemDir, "_HOTO.JPG"))
+	if err != nil || !bytes.Equal(got, photo) {
+		t.Errorf("The deleted photo was not recovered by name (%v)", err)
+	}
+	report, err := os.ReadFile(filepath.Join(outputDir, SmartReportFile))
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(report), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("Expected a header and 2 files, got:\n%s", report)
+	}
+	if want := fmt.Sprintf("filesystem/_HOTO.JPG\tfat32\t%d\t%d\t", cluster(5), len(photo)); !bytes.HasPrefix(lines[1], []byte(want)) {
+		t.Errorf("Expected %q, got %q", want, lines[1])
+	}
+	// The copy in cluster 12 is folded into the photo
+	if want := fmt.Sprintf("\tcarved@%d", cluster(12)); !bytes.HasSuffix(lines[1], []byte(want)) {
+		t.Errorf("Expected the carved copy as provenance, got %q", lines[1])
+	}
+	if want := fmt.Sprintf("\tcarved\t%d\t%d\t", cluster(9), len(png)); !bytes.Contains(lines[2], []byte(want)) {
+		t.Errorf("Expected the PNG to be carved, got %q", lines[2])
+	}
+}
+
+func TestFoldCarvings(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	// A deleted PHOTO.JPG in cluster 5 whose directory entry has lost the
+	// last 100 bytes of its size
+	image := makeFAT32(16, 2)
+	dataStart := 34 * 512
+	cluster := func(c int) int { return dataStart + (c-2)*4096 }
+	photo := makeJPEG(t)
+	copy(image[cluster(2):], []byte("\xE5HOTO   JPG"))
+	image[cluster(2)+26] = 5
+	binary.LittleEndian.PutUint32(image[cluster(2)+28:], uint32(len(photo)-100))
+	copy(image[cluster(5):], photo)
+
+	if err := os.WriteFile(tmpFile, image, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	outputDir := filepath.Join(tmpDir, "out")
+	files, err := recoverVolumes(reader, outputDir, false, Options{}, func(volume, string) string { return "" })
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one deleted file, got %d (%v)", len(files), err)
+	}
+
+	// The whole disk is carved; the carving starts where the file does, so
+	// it is the same file even though it was cut longer
+	var carved []CarvedFile
+	opts := Options{Signatures: []FileSignature{findSignature(t, "JPEG")}, filesystem: pointers(files), Carved: &carved}
+	n, err := Recover(reader, outputDir, false, opts)
+	if err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if n != 0 || len(carved) != 1 || carved[0].Path != "" {
+		t.Fatalf("Expected the carving to be folded, got %d files", n)
+	}
+	if jpegs, _ := filepath.Glob(filepath.Join(outputDir, "JPEG", "*")); len(jpegs) != 0 {
+		t.Errorf("Expected no carved copy on disk, got %v", jpegs)
+	}
+	also := files[0].Also
+	if len(also) != 1 || also[0].Offset != int64(cluster(5)) || also[0].SHA256 != carved[0].SHA256 {
+		t.Fatalf("Expected the carving as provenance, got %+v", also)
+	}
+	want := fmt.Sprintf("carved@%d:%s", cluster(5), carved[0].SHA256)
+	if got := also[0].string(files[0].SHA256); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,642 @@
+package carver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// SQLite databases are a sequence of fixed-size pages whose first page starts
+// with a 100-byte header. Tables and indexes are b-trees whose root pages are
+// listed in the schema table (sqlite_master), itself the b-tree rooted at
+// page 1; pages no b-tree uses are kept on the freelist. The tables in the
+// schema tell which application created the database. Browsers keep history,
+// cookies and saved logins in SQLite databases with distinctive schemas, so
+// these are filed separately and can be recovered even after the profile
+// directory was wiped.
+//
+// Databases in WAL mode keep recent changes in a -wal file of checksummed
+// frames, one page each; databases in rollback mode keep the original pages
+// of an unfinished transaction in a -journal file. Both can hold rows that
+// no longer exist in the database itself.
+
+const (
+	sqliteHeaderSize = 100
+	sqliteMaxDepth   = 20 // B-trees of real databases stay far shallower
+
+	walHeaderSize      = 32
+	walFrameHeaderSize = 24
+	walVersion         = 3007000
+
+	journalHeaderSize = 28
+)
+
+// B-tree page types
+const (
+	sqliteIndexInterior = 0x02
+	sqliteTableInterior = 0x05
+	sqliteIndexLeaf     = 0x0A
+	sqliteTableLeaf     = 0x0D
+)
+
+// journalMagic starts every rollback journal header
+var journalMagic = []byte{0xD9, 0xD5, 0x05, 0xF9, 0x20, 0xA1, 0x63, 0xD7}
+
+// sqliteApps identifies application databases by tables only they create.
+// Firefox tables are prefixed, so they are checked before Chrome's generic
+// table names.
+var sqliteApps = []struct {
+	name   string
+	tables []string
+}{
+	{"FIREFOX-PLACES", []string{"moz_places", "moz_historyvisits"}},
+	{"FIREFOX-COOKIES", []string{"moz_cookies"}},
+	{"FIREFOX-FORMHISTORY", []string{"moz_formhistory"}},
+	{"CHROME-HISTORY", []string{"urls", "visits", "keyword_search_terms"}},
+	{"CHROME-COOKIES", []string{"cookies", "meta"}},
+	{"CHROME-LOGINS", []string{"logins", "meta"}},
+}
+
+// sqliteAppIDs identifies databases by the application ID in the header.
+// Bitcoin Core's descriptor wallets use the network's message start bytes.
+var sqliteAppIDs = map[uint32]string{
+	0xF9BEB4D9: "BITCOIN-WALLET", // Mainnet
+	0x0B110907: "BITCOIN-WALLET", // Testnet
+}
+
+// verifySQLite checks the header's magic string, page size and payload
+// fractions, which are fixed for every database
+func verifySQLite(data []byte) bool {
+	if len(data) < sqliteHeaderSize || string(data[:16]) != "SQLite format 3\x00" {
+		return false
+	}
+	return sqlitePageSize(data) > 0 && data[21] == 64 && data[22] == 32 && data[23] == 32
+}
+
+// sqlitePageSize returns the page size recorded in a database header, or 0
+// if it is not a power of two between 512 and 65536
+func sqlitePageSize(hdr []byte) int64 {
+	pageSize := int64(binary.BigEndian.Uint16(hdr[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return 0
+	}
+	return pageSize
+}
+
+// sqliteSize multiplies the page size by the page count in the header. The
+// page count is only trusted when the version-valid-for number matches the
+// change counter; older writers left it stale.
+func sqliteSize(r io.ReaderAt, limit int64) int64 {
+	hdr := make([]byte, sqliteHeaderSize)
+	if _, err := r.ReadAt(hdr, 0); err != nil || !verifySQLite(hdr) {
+		return 0
+	}
+	if binary.BigEndian.Uint32(hdr[92:]) != binary.BigEndian.Uint32(hdr[24:]) {
+		return 0
+	}
+	size := sqlitePageSize(hdr) * int64(binary.BigEndian.Uint32(hdr[28:32]))
+	if size == 0 || size > limit {
+		return 0
+	}
+	return size
+}
+
+// sqliteDB reads the pages of a carved database
+type sqliteDB struct {
+	r        io.ReaderAt
+	hdr      []byte
+	pageSize int64
+	pages    uint32 // Pages present in the carving
+}
+
+// openSQLite reads the database header at the start of r
+func openSQLite(r io.ReaderAt, size int64) (*sqliteDB, bool) {
+	hdr := make([]byte, sqliteHeaderSize)
+	if _, err := r.ReadAt(hdr, 0); err != nil || !verifySQLite(hdr) {
+		return nil, false
+	}
+	pageSize := sqlitePageSize(hdr)
+	return &sqliteDB{r: r, hdr: hdr, pageSize: pageSize, pages: uint32(min(size/pageSize, math.MaxUint32))}, true
+}
+
+// page reads page n (numbered from 1) and returns it with the offset of its
+// b-tree header, which follows the database header on page 1
+func (db *sqliteDB) page(n uint32) ([]byte, int, error) {
+	if n == 0 || n > db.pages {
+		return nil, 0, fmt.Errorf("page %d out of range", n)
+	}
+	buf := make([]byte, db.pageSize)
+	if _, err := db.r.ReadAt(buf, int64(n-1)*db.pageSize); err != nil {
+		return nil, 0, err
+	}
+	if n == 1 {
+		return buf, sqliteHeaderSize, nil
+	}
+	return buf, 0, nil
+}
+
+// sqliteCells returns the offsets of the cells on a b-tree page
+func sqliteCells(page []byte, h int) ([]int, error) {
+	ptrs := h + 8
+	if page[h] == sqliteTableInterior || page[h] == sqliteIndexInterior {
+		ptrs = h + 12
+	}
+	n := int(binary.BigEndian.Uint16(page[h+3:]))
+	if ptrs+2*n > len(page) {
+		return nil, fmt.Errorf("%d cells do not fit the page", n)
+	}
+	offsets := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		off := int(binary.BigEndian.Uint16(page[ptrs+2*i:]))
+		if off < ptrs+2*n || off+4 > len(page) {
+			return nil, fmt.Errorf("cell offset %d outside the cell content area", off)
+		}
+		offsets = append(offsets, off)
+	}
+	return offsets, nil
+}
+
+// walk visits the b-tree rooted at root, marking its pages in seen and
+// calling leaf for each table leaf page. It stops at the first page that is
+// out of range, already in use or not a b-tree page of the tree's kind.
+func (db *sqliteDB) walk(root uint32, seen map[uint32]bool, leaf func(page []byte, h int)) error {
+	leafType, interiorType := byte(sqliteTableLeaf), byte(sqliteTableInterior)
+	var visit func(n uint32, depth int) error
+	visit = func(n uint32, depth int) error {
+		if seen[n] {
+			return fmt.Errorf("page %d used twice", n)
+		}
+		if depth > sqliteMaxDepth {
+			return fmt.Errorf("b-tree deeper than %d levels at page %d", sqliteMaxDepth, n)
+		}
+		page, h, err := db.page(n)
+		if err != nil {
+			return err
+		}
+		seen[n] = true
+
+		if n == root && (page[h] == sqliteIndexLeaf || page[h] == sqliteIndexInterior) {
+			leafType, interiorType = sqliteIndexLeaf, sqliteIndexInterior
+		}
+		switch page[h] {
+		case leafType:
+			if leaf != nil && leafType == sqliteTableLeaf {
+				leaf(page, h)
+			}
+			return nil
+		case interiorType:
+		default:
+			return fmt.Errorf("page %d has b-tree page type %d", n, page[h])
+		}
+
+		offsets, err := sqliteCells(page, h)
+		if err != nil {
+			return fmt.Errorf("page %d: %v", n, err)
+		}
+		for _, off := range offsets {
+			if err := visit(binary.BigEndian.Uint32(page[off:]), depth+1); err != nil {
+				return err
+			}
+		}
+		return visit(binary.BigEndian.Uint32(page[h+8:]), depth+1)
+	}
+	return visit(root, 0)
+}
+
+// sqliteObject is a table or index listed in the schema
+type sqliteObject struct {
+	typ, name string
+	root      uint32
+}
+
+// schema lists the objects in sqlite_master, marking its pages in seen
+func (db *sqliteDB) schema(seen map[uint32]bool) ([]sqliteObject, error) {
+	var objects []sqliteObject
+	err := db.walk(1, seen, func(page []byte, h int) {
+		offsets, err := sqliteCells(page, h)
+		if err != nil {
+			return
+		}
+		for _, off := range offsets {
+			_, values := sqliteRecord(page[off:])
+			if len(values) < 4 {
+				continue
+			}
+			typ, _ := values[0].(string)
+			name, _ := values[1].(string)
+			root, _ := values[3].(int64)
+			objects = append(objects, sqliteObject{typ, name, uint32(root)})
+		}
+	})
+	return objects, err
+}
+
+// freelist returns the trunk and leaf pages of the freelist, checking the
+// total against the count in the header
+func (db *sqliteDB) freelist() ([]uint32, error) {
+	trunk := binary.BigEndian.Uint32(db.hdr[32:])
+	count := binary.BigEndian.Uint32(db.hdr[36:])
+	var pages []uint32
+	for trunk != 0 {
+		if uint32(len(pages)) >= count {
+			return nil, fmt.Errorf("freelist is longer than the %d pages in the header", count)
+		}
+		page, _, err := db.page(trunk)
+		if err != nil {
+			return nil, fmt.Errorf("freelist trunk: %v", err)
+		}
+		pages = append(pages, trunk)
+
+		leaves := int64(binary.BigEndian.Uint32(page[4:]))
+		if leaves > db.pageSize/4-2 {
+			return nil, fmt.Errorf("freelist trunk page %d lists %d leaves", trunk, leaves)
+		}
+		for i := int64(0); i < leaves; i++ {
+			leaf := binary.BigEndian.Uint32(page[8+4*i:])
+			if leaf < 2 || leaf > db.pages {
+				return nil, fmt.Errorf("freelist leaf page %d out of range", leaf)
+			}
+			pages = append(pages, leaf)
+		}
+		trunk = binary.BigEndian.Uint32(page)
+	}
+	if uint32(len(pages)) != count {
+		return nil, fmt.Errorf("freelist has %d pages, header says %d", len(pages), count)
+	}
+	return pages, nil
+}
+
+// sqliteRecord decodes the row ID and the column values of a table leaf cell
+// as nil, int64, float64, string or []byte. Columns spilling onto overflow
+// pages are left out.
+func sqliteRecord(cell []byte) (int64, []any) {
+	_, n := sqliteVarint(cell) // Payload size
+	if n == 0 {
+		return 0, nil
+	}
+	rowid, m := sqliteVarint(cell[n:])
+	if m == 0 {
+		return 0, nil
+	}
+	rec := cell[n+m:]
+
+	hdrLen, k := sqliteVarint(rec)
+	if k == 0 || hdrLen > uint64(len(rec)) {
+		return int64(rowid), nil
+	}
+	var values []any
+	pos, body := k, int(hdrLen)
+	for pos < int(hdrLen) {
+		serial, k := sqliteVarint(rec[pos:hdrLen])
+		if k == 0 || serial == 10 || serial == 11 {
+			break
+		}
+		pos += k
+
+		var l int
+		switch {
+		case serial >= 12:
+			l = int((serial - 12) / 2)
+		case serial >= 1 && serial <= 4:
+			l = int(serial)
+		case serial == 5:
+			l = 6
+		case serial == 6 || serial == 7:
+			l = 8
+		}
+		if body+l > len(rec) {
+			break
+		}
+		v := rec[body : body+l]
+		body += l
+
+		switch {
+		case serial == 0:
+			values = append(values, nil)
+		case serial == 8 || serial == 9:
+			values = append(values, int64(serial-8))
+		case serial == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(v)))
+		case serial >= 13 && serial%2 == 1:
+			values = append(values, string(v))
+		case serial >= 12:
+			values = append(values, v)
+		default:
+			// Big-endian two's complement of 1 to 8 bytes
+			x := int64(int8(v[0]))
+			for _, b := range v[1:] {
+				x = x<<8 | int64(b)
+			}
+			values = append(values, x)
+		}
+	}
+	return int64(rowid), values
+}
+
+// sqliteVarint decodes a big-endian variable-length integer of up to 9
+// bytes, returning 0 bytes read if b ends first
+func sqliteVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9 && i < len(b); i++ {
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7F)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// sqliteTables returns the names of the tables listed in the schema
+func sqliteTables(r io.ReaderAt, size int64) map[string]bool {
+	db, ok := openSQLite(r, size)
+	if !ok {
+		return nil
+	}
+	objects, _ := db.schema(make(map[uint32]bool))
+	tables := make(map[string]bool)
+	for _, obj := range objects {
+		if obj.typ == "table" {
+			tables[obj.name] = true
+		}
+	}
+	return tables
+}
+
+// classifySQLite names databases by their application ID, or browser
+// databases by the tables in their schema
+func classifySQLite(r io.ReaderAt, size int64) (string, string) {
+	hdr := make([]byte, sqliteHeaderSize)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return "", ""
+	}
+	if name, ok := sqliteAppIDs[binary.BigEndian.Uint32(hdr[68:])]; ok {
+		return name, ".sqlite"
+	}
+
+	tables := sqliteTables(r, size)
+	for _, app := range sqliteApps {
+		found := true
+		for _, table := range app.tables {
+			found = found && tables[table]
+		}
+		if found {
+			return app.name, ".sqlite"
+		}
+	}
+	return "", ""
+}
+
+// checkSQLitePages walks every b-tree in the schema and the freelist,
+// failing on pages of the wrong type, out of range or used twice
+func checkSQLitePages(r io.ReaderAt, size int64) error {
+	db, ok := openSQLite(r, size)
+	if !ok {
+		return errors.New("sqlite: bad header")
+	}
+	seen := make(map[uint32]bool)
+	objects, err := db.schema(seen)
+	if err != nil {
+		return fmt.Errorf("sqlite: schema: %v", err)
+	}
+	for _, obj := range objects {
+		if obj.root == 0 { // Views and triggers
+			continue
+		}
+		if err := db.walk(obj.root, seen, nil); err != nil {
+			return fmt.Errorf("sqlite: %s %s: %v", obj.typ, obj.name, err)
+		}
+	}
+
+	free, err := db.freelist()
+	if err != nil {
+		return fmt.Errorf("sqlite: %v", err)
+	}
+	for _, n := range free {
+		if seen[n] {
+			return fmt.Errorf("sqlite: freelist page %d is in use", n)
+		}
+		seen[n] = true
+	}
+	return nil
+}
+
+// salvagedRecord is a row decoded from an orphaned table leaf page
+type salvagedRecord struct {
+	page   uint32
+	rowid  int64
+	values []any
+}
+
+// salvageSQLite decodes the rows on table leaf pages that no b-tree in the
+// schema reaches: freelist pages and pages of dropped or damaged tables.
+// When the schema cannot be read, every table leaf page is orphaned.
+func salvageSQLite(r io.ReaderAt, size int64) []salvagedRecord {
+	db, ok := openSQLite(r, size)
+	if !ok {
+		return nil
+	}
+	seen := make(map[uint32]bool)
+	if objects, err := db.schema(seen); err == nil {
+		for _, obj := range objects {
+			if obj.root != 0 {
+				db.walk(obj.root, seen, nil)
+			}
+		}
+	}
+
+	var records []salvagedRecord
+	for n := uint32(2); n <= db.pages; n++ {
+		if seen[n] {
+			continue
+		}
+		page, h, err := db.page(n)
+		if err != nil || page[h] != sqliteTableLeaf {
+			continue
+		}
+		offsets, err := sqliteCells(page, h)
+		if err != nil {
+			continue
+		}
+		for _, off := range offsets {
+			if rowid, values := sqliteRecord(page[off:]); len(values) > 0 {
+				records = append(records, salvagedRecord{n, rowid, values})
+			}
+		}
+	}
+	return records
+}
+
+// SalvageSQLite writes the rows found on orphaned pages of a recovered SQLite
+// database to a tab-separated file next to it, returning its path and the
+// number of rows. No file is written when there is nothing to salvage.
+func (c *Carver) SalvageSQLite(file *CarvedFile) (string, int, error) {
+	content, size, err := c.content(*file)
+	if err != nil {
+		return "", 0, err
+	}
+	records := salvageSQLite(content, size)
+	if len(records) == 0 {
+		return "", 0, nil
+	}
+
+	path := strings.TrimSuffix(file.Path, disk.ZstdSuffix) + ".salvaged.tsv"
+	out, err := os.Create(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	fmt.Fprintln(w, "page\trowid\tvalues")
+	for _, rec := range records {
+		fields := []string{strconv.FormatUint(uint64(rec.page), 10), strconv.FormatInt(rec.rowid, 10)}
+		for _, v := range rec.values {
+			fields = append(fields, formatSQLiteValue(v))
+		}
+		fmt.Fprintln(w, strings.Join(fields, "\t"))
+	}
+	if err := w.Flush(); err != nil {
+		return "", 0, err
+	}
+	return path, len(records), nil
+}
+
+// formatSQLiteValue renders a column value for the salvage file on one line
+func formatSQLiteValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return "x'" + hex.EncodeToString(v) + "'"
+	case string:
+		return strings.NewReplacer("\\", `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`).Replace(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// walChecksum continues SQLite's WAL checksum over data, whose length is a
+// multiple of 8, reading words in the byte order the magic number selects
+func walChecksum(order binary.ByteOrder, s0, s1 uint32, data []byte) (uint32, uint32) {
+	for i := 0; i+8 <= len(data); i += 8 {
+		s0 += order.Uint32(data[i:]) + s1
+		s1 += order.Uint32(data[i+4:]) + s0
+	}
+	return s0, s1
+}
+
+// walOrder returns the checksum byte order of a WAL header
+func walOrder(hdr []byte) binary.ByteOrder {
+	if hdr[3] == 0x83 {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// verifyWAL checks a WAL header's version, page size and checksum
+func verifyWAL(data []byte) bool {
+	if len(data) < walHeaderSize || binary.BigEndian.Uint32(data[4:]) != walVersion {
+		return false
+	}
+	pageSize := binary.BigEndian.Uint32(data[8:])
+	if pageSize < 512 || pageSize > 65536 || pageSize&(pageSize-1) != 0 {
+		return false
+	}
+	s0, s1 := walChecksum(walOrder(data), 0, 0, data[:24])
+	return s0 == binary.BigEndian.Uint32(data[24:]) && s1 == binary.BigEndian.Uint32(data[28:])
+}
+
+// walSize follows the frames whose salts match the header and whose
+// cumulative checksums hold. Frames left over from before the last
+// checkpoint carry old salts and end the file.
+func walSize(r io.ReaderAt, limit int64) int64 {
+	hdr := make([]byte, walHeaderSize)
+	if _, err := r.ReadAt(hdr, 0); err != nil || !verifyWAL(hdr) {
+		return 0
+	}
+	order := walOrder(hdr)
+	pageSize := int64(binary.BigEndian.Uint32(hdr[8:]))
+	s0, s1 := binary.BigEndian.Uint32(hdr[24:]), binary.BigEndian.Uint32(hdr[28:])
+
+	frame := make([]byte, walFrameHeaderSize+pageSize)
+	pos := int64(walHeaderSize)
+	for pos+int64(len(frame)) <= limit {
+		if _, err := r.ReadAt(frame, pos); err != nil {
+			break
+		}
+		if string(frame[8:16]) != string(hdr[16:24]) {
+			break
+		}
+		f0, f1 := walChecksum(order, s0, s1, frame[:8])
+		f0, f1 = walChecksum(order, f0, f1, frame[walFrameHeaderSize:])
+		if f0 != binary.BigEndian.Uint32(frame[16:]) || f1 != binary.BigEndian.Uint32(frame[20:]) {
+			break
+		}
+		s0, s1 = f0, f1
+		pos += int64(len(frame))
+	}
+	if pos == walHeaderSize {
+		return 0
+	}
+	return pos
+}
+
+// verifyJournal checks a rollback journal header's sector and page sizes
+func verifyJournal(data []byte) bool {
+	if len(data) < journalHeaderSize {
+		return false
+	}
+	sector := binary.BigEndian.Uint32(data[20:])
+	pageSize := binary.BigEndian.Uint32(data[24:])
+	return sector >= 512 && sector <= 65536 && sector&(sector-1) == 0 &&
+		pageSize >= 512 && pageSize <= 65536 && pageSize&(pageSize-1) == 0
+}
+
+// journalSize sizes a rollback journal from the record counts of its
+// segments: each is a header padded to a sector, then a page number, page and
+// checksum per record. A count of -1 (the journal was not synced) leaves the
+// size unknown.
+func journalSize(r io.ReaderAt, limit int64) int64 {
+	hdr := make([]byte, journalHeaderSize)
+	var pos int64
+	for pos+journalHeaderSize <= limit {
+		if _, err := r.ReadAt(hdr, pos); err != nil || string(hdr[:8]) != string(journalMagic) || !verifyJournal(hdr) {
+			break
+		}
+		records := binary.BigEndian.Uint32(hdr[8:])
+		if records == 0 || records == 0xFFFFFFFF {
+			break
+		}
+		sector := int64(binary.BigEndian.Uint32(hdr[20:]))
+		pageSize := int64(binary.BigEndian.Uint32(hdr[24:]))
+		end := pos + sector + int64(records)*(pageSize+8)
+		if end > limit {
+			break
+		}
+
+		// The next segment starts on a sector boundary
+		pos = (end + sector - 1) / sector * sector
+		if pos >= limit {
+			return end
+		}
+		if _, err := r.ReadAt(hdr[:8], pos); err != nil || string(hdr[:8]) != string(journalMagic) {
+			return end
+		}
+	}
+	return 0
+}
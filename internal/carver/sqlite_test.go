@@ -0,0 +1,340 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// makeSchemaCell returns a table leaf cell holding the sqlite_master row of
+// a table rooted at page root
+func makeSchemaCell(rowid int, table string, root byte) []byte {
+	sql := "CREATE TABLE " + table + "(id INTEGER PRIMARY KEY)"
+	cols := []string{"table", table, table}
+	rec := []byte{0}
+	for _, c := range cols {
+		rec = append(rec, byte(13+2*len(c)))
+	}
+	rec = append(rec, 1) // rootpage as an 8-bit integer
+	sqlSerial := 13 + 2*len(sql)
+	rec = append(rec, byte(0x80|sqlSerial>>7), byte(sqlSerial&0x7F))
+	rec[0] = byte(len(rec))
+	for _, c := range cols {
+		rec = append(rec, c...)
+	}
+	rec = append(rec, root)
+	rec = append(rec, sql...)
+	return append([]byte{byte(len(rec)), byte(rowid)}, rec...)
+}
+
+// makeSQLite builds a database of 1024-byte pages whose schema lists the
+// given tables, each with an empty leaf page as its root. With more than one
+// group of tables page 1 is an interior page whose children are leaf pages
+// holding one group each.
+func makeSQLite(groups ...[]string) []byte {
+	const pageSize = 1024
+	schemaPages := 1
+	if len(groups) > 1 {
+		schemaPages += len(groups)
+	}
+	pages := schemaPages
+	for _, group := range groups {
+		pages += len(group)
+	}
+	db := make([]byte, pages*pageSize)
+	copy(db, makeSQLiteHeader(pageSize, uint32(pages)))
+	binary.BigEndian.PutUint32(db[24:], 7) // Change counter
+	binary.BigEndian.PutUint32(db[92:], 7) // Version-valid-for
+
+	root := schemaPages
+	leaf := func(page []byte, h int, tables []string) {
+		page[h] = sqliteTableLeaf
+		binary.BigEndian.PutUint16(page[h+3:], uint16(len(tables)))
+		end := len(page)
+		for i, table := range tables {
+			root++
+			db[(root-1)*pageSize] = sqliteTableLeaf
+			cell := makeSchemaCell(i+1, table, byte(root))
+			end -= len(cell)
+			copy(page[end:], cell)
+			binary.BigEndian.PutUint16(page[h+8+2*i:], uint16(end))
+		}
+	}
+
+	if len(groups) == 1 {
+		leaf(db[:pageSize], sqliteHeaderSize, groups[0])
+		return db
+	}
+
+	h := sqliteHeaderSize
+	db[h] = sqliteTableInterior
+	binary.BigEndian.PutUint16(db[h+3:], uint16(len(groups)-1))
+	for i, group := range groups {
+		page := uint32(i + 2)
+		leaf(db[int(page-1)*pageSize:int(page)*pageSize], 0, group)
+		if i == len(groups)-1 {
+			binary.BigEndian.PutUint32(db[h+8:], page) // Right-most child
+			break
+		}
+		off := pageSize - 8*(i+1)
+		binary.BigEndian.PutUint32(db[off:], page)
+		db[off+4] = byte(i + 1) // Key
+		binary.BigEndian.PutUint16(db[h+12+2*i:], uint16(off))
+	}
+	return db
+}
+
+func TestClassifySQLite(t *testing.T) {
+	tests := []struct {
+		name string
+		db   []byte
+		want string
+	}{
+		{"Chrome history", makeSQLite([]string{"meta", "urls", "visits", "keyword_search_terms"}), "CHROME-HISTORY"},
+		{"Chrome cookies", makeSQLite([]string{"meta", "cookies"}), "CHROME-COOKIES"},
+		{"Firefox places", makeSQLite([]string{"moz_origins"}, []string{"moz_places"}, []string{"moz_historyvisits", "moz_bookmarks"}), "FIREFOX-PLACES"},
+		{"Firefox cookies", makeSQLite([]string{"moz_cookies"}), "FIREFOX-COOKIES"},
+		{"Other", makeSQLite([]string{"notes"}), ""},
+	}
+
+	for _, tt := range tests {
+		name, ext := classifySQLite(bytes.NewReader(tt.db), int64(len(tt.db)))
+		if name != tt.want {
+			t.Errorf("%s: classifySQLite = %q, want %q", tt.name, name, tt.want)
+		}
+		if name != "" && ext != ".sqlite" {
+			t.Errorf("%s: expected .sqlite, got %q", tt.name, ext)
+		}
+	}
+}
+
+func TestSQLiteSize(t *testing.T) {
+	db := makeSQLite([]string{"a"}, []string{"b"})
+	data := append(append([]byte{}, db...), bytes.Repeat([]byte{0xEE}, 4096)...)
+	if got := sqliteSize(bytes.NewReader(data), int64(len(data))); got != int64(len(db)) {
+		t.Errorf("Expected size %d, got %d", len(db), got)
+	}
+
+	// A stale page count is not trusted
+	binary.BigEndian.PutUint32(data[24:], 8)
+	if got := sqliteSize(bytes.NewReader(data), int64(len(data))); got != 0 {
+		t.Errorf("Expected unknown size for a stale page count, got %d", got)
+	}
+
+	if verifySQLite(makeSQLiteHeader(1000, 1)) {
+		t.Error("Expected invalid page size to be rejected")
+	}
+}
+
+func TestCarveBrowserHistory(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	history := makeSQLite([]string{"meta", "urls"}, []string{"visits", "keyword_search_terms"})
+	data := make([]byte, 64*1024)
+	copy(data[8192:], history)
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	carver := NewCarver(reader)
+	sig := findSignature(t, "SQLite")
+	path, err := carver.RecoverFile(CarvedFile{Signature: &sig, Offset: 8192}, outputDir, 3)
+	if err != nil {
+		t.Fatalf("RecoverFile failed: %v", err)
+	}
+	if want := filepath.Join(outputDir, "CHROME-HISTORY", "carved_000003.sqlite"); path != want {
+		t.Errorf("Expected %s, got %s", want, path)
+	}
+
+	recovered, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read recovered file: %v", err)
+	}
+	if !bytes.Equal(recovered, history) {
+		t.Errorf("Expected %d bytes sized from the header, got %d", len(history), len(recovered))
+	}
+}
+
+// makeRowCell returns a table leaf cell holding a row of a text and an
+// integer column
+func makeRowCell(rowid int, text string, n int8) []byte {
+	rec := []byte{3, byte(13 + 2*len(text)), 1}
+	rec = append(rec, text...)
+	rec = append(rec, byte(n))
+	return append([]byte{byte(len(rec)), byte(rowid)}, rec...)
+}
+
+func TestCheckSQLitePages(t *testing.T) {
+	db := makeSQLite([]string{"a", "b"})
+	if err := checkSQLitePages(bytes.NewReader(db), int64(len(db))); err != nil {
+		t.Fatalf("Expected valid database, got %v", err)
+	}
+
+	// A table root that is not a b-tree page
+	broken := append([]byte{}, db...)
+	broken[2*1024] = 0x07
+	if err := checkSQLitePages(bytes.NewReader(broken), int64(len(broken))); err == nil {
+		t.Error("Expected bad page type to fail")
+	}
+
+	// One freelist trunk page recorded, but the trunk lists a leaf too
+	free := append(append([]byte{}, db...), make([]byte, 2*1024)...)
+	binary.BigEndian.PutUint32(free[28:], 5)
+	binary.BigEndian.PutUint32(free[32:], 4) // First trunk
+	binary.BigEndian.PutUint32(free[36:], 1) // Freelist pages
+	binary.BigEndian.PutUint32(free[3*1024+4:], 1)
+	binary.BigEndian.PutUint32(free[3*1024+8:], 5)
+	if err := checkSQLitePages(bytes.NewReader(free), int64(len(free))); err == nil {
+		t.Error("Expected freelist count mismatch to fail")
+	}
+	binary.BigEndian.PutUint32(free[36:], 2)
+	if err := checkSQLitePages(bytes.NewReader(free), int64(len(free))); err != nil {
+		t.Errorf("Expected consistent freelist to pass, got %v", err)
+	}
+}
+
+func TestSalvageSQLite(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	// A live table with one row and a freed page still holding a deleted row
+	db := makeSQLite([]string{"notes"})
+	live := makeRowCell(1, "kept", 1)
+	copy(db[2*1024-len(live):], live)
+	binary.BigEndian.PutUint16(db[1024+3:], 1)
+	binary.BigEndian.PutUint16(db[1024+8:], uint16(1024-len(live)))
+
+	orphan := make([]byte, 1024)
+	orphan[0] = sqliteTableLeaf
+	deleted := makeRowCell(7, "deleted\tnote", -3)
+	copy(orphan[1024-len(deleted):], deleted)
+	binary.BigEndian.PutUint16(orphan[3:], 1)
+	binary.BigEndian.PutUint16(orphan[8:], uint16(1024-len(deleted)))
+	db = append(db, orphan...)
+	binary.BigEndian.PutUint32(db[28:], 3)
+
+	records := salvageSQLite(bytes.NewReader(db), int64(len(db)))
+	if len(records) != 1 || records[0].page != 3 || records[0].rowid != 7 {
+		t.Fatalf("Expected the deleted row on page 3, got %v", records)
+	}
+	if records[0].values[0] != "deleted\tnote" || records[0].values[1] != int64(-3) {
+		t.Errorf("Unexpected values %v", records[0].values)
+	}
+
+	data := make([]byte, 64*1024)
+	copy(data[4096:], db)
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	carver := NewCarver(reader)
+	sig := findSignature(t, "SQLite")
+	file := CarvedFile{Signature: &sig, Offset: 4096}
+	if err := carver.recoverFile(&file, outputDir, 1); err != nil {
+		t.Fatalf("recoverFile failed: %v", err)
+	}
+	path, rows, err := carver.SalvageSQLite(&file)
+	if err != nil || rows != 1 {
+		t.Fatalf("Expected 1 salvaged row, got %d (%v)", rows, err)
+	}
+	tsv, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read salvage file: %v", err)
+	}
+	if want := "page\trowid\tvalues\n3\t7\tdeleted\\tnote\t-3\n"; string(tsv) != want {
+		t.Errorf("Expected %q, got %q", want, tsv)
+	}
+}
+
+// makeWAL builds a write-ahead log of frames 1024-byte pages with
+// big-endian checksums
+func makeWAL(frames int) []byte {
+	be := binary.BigEndian
+	wal := make([]byte, walHeaderSize)
+	be.PutUint32(wal, 0x377F0683)
+	be.PutUint32(wal[4:], walVersion)
+	be.PutUint32(wal[8:], 1024)
+	be.PutUint32(wal[16:], 0x11111111) // Salts
+	be.PutUint32(wal[20:], 0x22222222)
+	s0, s1 := walChecksum(be, 0, 0, wal[:24])
+	be.PutUint32(wal[24:], s0)
+	be.PutUint32(wal[28:], s1)
+
+	for i := 0; i < frames; i++ {
+		frame := make([]byte, walFrameHeaderSize+1024)
+		be.PutUint32(frame, uint32(i+1))
+		copy(frame[8:16], wal[16:24])
+		copy(frame[walFrameHeaderSize:], bytes.Repeat([]byte{byte(i + 1)}, 1024))
+		s0, s1 = walChecksum(be, s0, s1, frame[:8])
+		s0, s1 = walChecksum(be, s0, s1, frame[walFrameHeaderSize:])
+		be.PutUint32(frame[16:], s0)
+		be.PutUint32(frame[20:], s1)
+		wal = append(wal, frame...)
+	}
+	return wal
+}
+
+func TestWALSize(t *testing.T) {
+	wal := makeWAL(3)
+	if !verifyWAL(wal) {
+		t.Fatal("Expected WAL header to verify")
+	}
+
+	// A stale frame from before the last checkpoint has other salts
+	stale := makeWAL(1)[walHeaderSize:]
+	binary.BigEndian.PutUint32(stale[8:], 0x33333333)
+	data := append(append([]byte{}, wal...), stale...)
+	if got := walSize(bytes.NewReader(data), int64(len(data))); got != int64(len(wal)) {
+		t.Errorf("Expected size %d, got %d", len(wal), got)
+	}
+
+	// A damaged frame ends the log before it
+	wal[walHeaderSize+walFrameHeaderSize+1024+100] ^= 0xFF
+	if got := walSize(bytes.NewReader(wal), int64(len(wal))); got != walHeaderSize+walFrameHeaderSize+1024 {
+		t.Errorf("Expected the log to end after the first frame, got %d", got)
+	}
+}
+
+func TestJournalSize(t *testing.T) {
+	segment := func(records int) []byte {
+		seg := make([]byte, 512+records*(1024+8))
+		copy(seg, journalMagic)
+		binary.BigEndian.PutUint32(seg[8:], uint32(records))
+		binary.BigEndian.PutUint32(seg[20:], 512)
+		binary.BigEndian.PutUint32(seg[24:], 1024)
+		return seg
+	}
+
+	// The first segment ends off a sector boundary, so the second is padded
+	journal := segment(1)
+	journal = append(journal, make([]byte, 512-len(journal)%512)...)
+	journal = append(journal, segment(2)...)
+	data := append(append([]byte{}, journal...), make([]byte, 4096)...)
+	if got := journalSize(bytes.NewReader(data), int64(len(data))); got != int64(len(journal)) {
+		t.Errorf("Expected size %d, got %d", len(journal), got)
+	}
+
+	unsynced := segment(1)
+	binary.BigEndian.PutUint32(unsynced[8:], 0xFFFFFFFF)
+	if got := journalSize(bytes.NewReader(unsynced), int64(len(unsynced))); got != 0 {
+		t.Errorf("Expected unknown size for an unsynced journal, got %d", got)
+	}
+}
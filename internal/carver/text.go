@@ -0,0 +1,306 @@
+package carver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// Documents, logs, source code, mail and keys are text, and runs of text
+// outlive the headers and cluster chains of the files that held them. Text
+// carving extracts every run of printable characters at least so long, as
+// UTF-8 or 8-bit text and as the UTF-16LE that Windows stores, optionally
+// keeping only the runs that match keywords or regular expressions.
+
+// TextDir is the directory, below the output directory, that carved text
+// goes to
+const TextDir = "_text"
+
+// TextHitsFile lists every keyword hit of a text carve, in TextDir
+const TextHitsFile = "hits.txt"
+
+// DefaultTextMinLength is the shortest run searched for keywords when no
+// length is given
+const DefaultTextMinLength = 16
+
+const (
+	maxTextRun  = 16 * 1024 * 1024 // Longer runs are split
+	maxTextHits = 1000             // Per pattern in a run
+)
+
+// TextOptions controls text carving
+type TextOptions struct {
+	MinLength int              // Shortest run kept, in characters (0 = off)
+	Patterns  []*regexp.Regexp // Keep only runs that match one of these (nil = every run)
+	Context   int              // Characters either side of a hit to report with it
+}
+
+// TextRun is a run of printable text found on the disk
+type TextRun struct {
+	Offset int64
+	Length int64 // In bytes on the disk
+	UTF16  bool
+	Text   string // As UTF-8, or as found for 8-bit text
+	Hits   []TextHit
+}
+
+// TextHit is a match of a keyword in a run of text
+type TextHit struct {
+	Offset  int64 // On the disk
+	Match   string
+	Context string // The match and the text around it, on one line
+}
+
+// ParseKeywords compiles keywords into patterns. A keyword between slashes,
+// such as /\d{4}-\d{4}/, is a regular expression; any other is matched
+// literally, regardless of case.
+func ParseKeywords(keywords []string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, k := range keywords {
+		if k == "" {
+			continue
+		}
+		expr := "(?i)" + regexp.QuoteMeta(k)
+		if len(k) > 2 && strings.HasPrefix(k, "/") && strings.HasSuffix(k, "/") {
+			expr = k[1 : len(k)-1]
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid keyword %s: %w", k, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+// LoadKeywords reads keywords from a file, one per line, skipping blank lines
+// and lines starting with #
+func LoadKeywords(path string) ([]*regexp.Regexp, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyword file: %w", err)
+	}
+	var keywords []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keywords = append(keywords, line)
+	}
+	patterns, err := ParseKeywords(keywords)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return patterns, nil
+}
+
+// textRun collects a run of text as it is read
+type textRun struct {
+	utf16 bool
+	start int64
+	size  int64 // Bytes on the disk
+	chars int
+	text  []byte
+}
+
+func (r *textRun) add(off int64, char rune, size int64) {
+	if r.size == 0 {
+		r.start = off
+	}
+	r.text = utf8.AppendRune(r.text, char)
+	r.size += size
+	r.chars++
+}
+
+// ScanText calls fn for each run of text of at least opts.MinLength
+// characters that matches one of opts.Patterns, if any, as each run ends. It
+// reads the whole disk, or the extents the carver is limited to. UTF-16 runs
+// are of ASCII and Latin-1 characters.
+func (c *Carver) ScanText(opts TextOptions, fn func(TextRun) error) error {
+	minLength := max(opts.MinLength, 1)
+	runs := []*textRun{{}, {utf16: true}, {utf16: true}} // 8-bit, and UTF-16 at even and odd offsets
+	end := func(r *textRun) error {
+		defer func() { r.size, r.chars, r.text = 0, 0, r.text[:0] }()
+		if r.chars < minLength {
+			return nil
+		}
+		run := TextRun{Offset: r.start, Length: r.size, UTF16: r.utf16, Text: string(r.text)}
+		if len(opts.Patterns) > 0 {
+			if run.Hits = matchText(run, opts); len(run.Hits) == 0 {
+				return nil
+			}
+		}
+		return fn(run)
+	}
+
+	ranges := c.extents
+	if ranges == nil {
+		ranges = []disk.Extent{{Length: c.reader.Size()}}
+	}
+	buf := make([]byte, 1024*1024)
+	for _, e := range ranges {
+		var prev byte
+		for pos := e.Offset; pos < e.Offset+e.Length; {
+			n, err := c.reader.ReadAt(buf[:min(int64(len(buf)), e.Offset+e.Length-pos)], pos)
+			for i, b := range buf[:n] {
+				off := pos + int64(i)
+
+				// 8-bit text is kept as found; UTF-8 sequences count as one character
+				r := runs[0]
+				if isTextByte(b) {
+					if r.size == 0 {
+						r.start = off
+					}
+					r.text = append(r.text, b)
+					r.size++
+					if utf8.RuneStart(b) {
+						r.chars++
+					}
+				} else if err := end(r); err != nil {
+					return err
+				}
+
+				// A UTF-16 character is the previous byte with a zero high byte
+				if off > e.Offset {
+					r = runs[1+(off-1)%2]
+					if b == 0 && isTextByte(prev) {
+						r.add(off-1, rune(prev), 2)
+					} else if err := end(r); err != nil {
+						return err
+					}
+				}
+				prev = b
+
+				for _, r := range runs {
+					if r.size >= maxTextRun {
+						if err := end(r); err != nil {
+							return err
+						}
+					}
+				}
+			}
+			if err != nil && err != io.EOF {
+				return err
+			}
+			if n == 0 {
+				break
+			}
+			pos += int64(n)
+		}
+
+		// Runs do not carry over the space between extents
+		for _, r := range runs {
+			if err := end(r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// matchText finds the hits of opts.Patterns in a run, in disk order
+func matchText(run TextRun, opts TextOptions) []TextHit {
+	var hits []TextHit
+	for _, re := range opts.Patterns {
+		for _, m := range re.FindAllStringIndex(run.Text, maxTextHits) {
+			offset := run.Offset + int64(m[0])
+			if run.UTF16 {
+				offset = run.Offset + 2*int64(utf8.RuneCountInString(run.Text[:m[0]]))
+			}
+			hits = append(hits, TextHit{
+				Offset:  offset,
+				Match:   run.Text[m[0]:m[1]],
+				Context: textContext(run.Text, m[0], m[1], opts.Context),
+			})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Offset < hits[j].Offset })
+	return hits
+}
+
+// textContext returns text[start:end] with up to n characters either side,
+// with line breaks and tabs turned into spaces
+func textContext(text string, start, end, n int) string {
+	for i := 0; i < n && start > 0; i++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+	for i := 0; i < n && end < len(text); i++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' || r == '\t' || r == '\f' {
+			return ' '
+		}
+		return r
+	}, text[start:end])
+}
+
+// WriteText saves a run of text to TextDir below outputDir, named after its
+// offset; UTF-16 text is written as UTF-8
+func (c *Carver) WriteText(run TextRun, outputDir string) (string, error) {
+	path := filepath.Join(outputDir, TextDir, fmt.Sprintf("text_%012x.txt", run.Offset))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, []byte(run.Text), 0644)
+}
+
+// carveText runs a text carve, writing the runs and TextHitsFile below
+// outputDir, or only printing the hits when write is false
+func (c *Carver) carveText(outputDir string, opts TextOptions, write bool) error {
+	c.reader.Printf("\nCarving runs of text of at least %d characters...\n", opts.MinLength)
+	var hits *bufio.Writer
+	if write && len(opts.Patterns) > 0 {
+		if err := os.MkdirAll(filepath.Join(outputDir, TextDir), 0755); err != nil {
+			return err
+		}
+		f, err := os.Create(filepath.Join(outputDir, TextDir, TextHitsFile))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		hits = bufio.NewWriter(f)
+		defer hits.Flush()
+	}
+
+	var runs, hitCount int
+	var bytes int64
+	err := c.ScanText(opts, func(run TextRun) error {
+		runs++
+		bytes += run.Length
+		hitCount += len(run.Hits)
+		for _, h := range run.Hits {
+			if hits != nil {
+				fmt.Fprintf(hits, "%012x\t%s\t%s\n", h.Offset, h.Match, h.Context)
+			} else if !write {
+				c.reader.Printf("  0x%012x: %s\n", h.Offset, h.Context)
+			}
+		}
+		if !write {
+			return nil
+		}
+		_, err := c.WriteText(run, outputDir)
+		return err
+	})
+
+	c.reader.Printf("Found %d runs of text (%d bytes)", runs, bytes)
+	if len(opts.Patterns) > 0 {
+		c.reader.Printf(" with %d keyword hits", hitCount)
+	}
+	c.reader.Println()
+	if write && runs > 0 {
+		c.reader.Printf("Text saved to %s\n", filepath.Join(outputDir, TextDir))
+	}
+	return err
+}
@@ -0,0 +1,284 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Windows keeps small previews of the pictures it has shown in Explorer, and
+// these often outlive the pictures. Windows XP writes a Thumbs.db in each
+// folder: an OLE compound file whose "Catalog" stream lists the file names
+// and whose numbered streams hold one JPEG each. Vista and later keep
+// central thumbcache_*.db files under the user profile: a "CMMM" header
+// followed by "CMMM" entries, each an identifier hash and the image data.
+
+const (
+	thumbcacheHeaderSize = 24
+	thumbcacheVista      = 20
+	thumbcacheWin7       = 21
+)
+
+// verifyThumbcache checks the header's format version and cache type, which
+// also tells the file header from the entries that share its signature
+func verifyThumbcache(data []byte) bool {
+	if len(data) < thumbcacheHeaderSize {
+		return false
+	}
+	version := binary.LittleEndian.Uint32(data[4:])
+	cacheType := binary.LittleEndian.Uint32(data[8:])
+	return (version == thumbcacheVista || version == thumbcacheWin7 || version >= 30 && version <= 32) && cacheType < 16
+}
+
+// thumbcacheOffsets returns the offsets of the first entry and of the free
+// space after the last one, which Windows 8 moved 4 bytes along
+func thumbcacheOffsets(hdr []byte) (first, end int64) {
+	at := 12
+	if binary.LittleEndian.Uint32(hdr[4:]) >= 30 {
+		at = 16
+	}
+	return int64(binary.LittleEndian.Uint32(hdr[at:])), int64(binary.LittleEndian.Uint32(hdr[at+4:]))
+}
+
+// thumbcacheEntry is a thumbnail stored in a thumbcache file
+type thumbcacheEntry struct {
+	id   string
+	data []byte
+}
+
+// thumbcacheEntries walks the entries from the first one to the end of the
+// used space, stopping at the first damaged entry
+func thumbcacheEntries(r io.ReaderAt, limit int64) ([]thumbcacheEntry, int64) {
+	hdr := make([]byte, thumbcacheHeaderSize)
+	if _, err := r.ReadAt(hdr, 0); err != nil || !verifyThumbcache(hdr) {
+		return nil, 0
+	}
+	version := binary.LittleEndian.Uint32(hdr[4:])
+	first, end := thumbcacheOffsets(hdr)
+	if end < first || end > limit {
+		end = limit
+	}
+
+	// Entry headers: "CMMM", size, hash, then the identifier, padding and
+	// data sizes; Vista adds an extension and Windows 8 the image size
+	headerSize, fields := int64(48), 16
+	switch {
+	case version == thumbcacheVista:
+		headerSize, fields = 56, 24
+	case version >= 30:
+		headerSize = 56
+	}
+
+	var entries []thumbcacheEntry
+	eh := make([]byte, headerSize)
+	pos := first
+	for pos+headerSize <= end {
+		if _, err := r.ReadAt(eh, pos); err != nil || string(eh[:4]) != "CMMM" {
+			break
+		}
+		size := int64(binary.LittleEndian.Uint32(eh[4:]))
+		idSize := int64(binary.LittleEndian.Uint32(eh[fields:]))
+		padding := int64(binary.LittleEndian.Uint32(eh[fields+4:]))
+		dataSize := int64(binary.LittleEndian.Uint32(eh[fields+8:]))
+		if size < headerSize+idSize+padding+dataSize || pos+size > end {
+			break
+		}
+
+		if dataSize > 0 {
+			body := make([]byte, idSize+padding+dataSize)
+			if _, err := r.ReadAt(body, pos+headerSize); err != nil {
+				break
+			}
+			entries = append(entries, thumbcacheEntry{
+				id:   decodeLinkString(body[:idSize], true),
+				data: body[idSize+padding:],
+			})
+		}
+		pos += size
+	}
+	return entries, pos
+}
+
+// thumbcacheSize is the end of the used space recorded in the header, or of
+// the last readable entry when that is out of range
+func thumbcacheSize(r io.ReaderAt, limit int64) int64 {
+	hdr := make([]byte, thumbcacheHeaderSize)
+	if _, err := r.ReadAt(hdr, 0); err != nil || !verifyThumbcache(hdr) {
+		return 0
+	}
+	if first, end := thumbcacheOffsets(hdr); end >= first && end > thumbcacheHeaderSize && end <= limit {
+		return end
+	}
+	if _, end := thumbcacheEntries(r, limit); end > thumbcacheHeaderSize {
+		return end
+	}
+	return 0
+}
+
+// extractThumbcache returns the thumbnails in a thumbcache file, named after
+// their cache identifiers
+func extractThumbcache(r io.ReaderAt, size int64) []EmbeddedFile {
+	entries, _ := thumbcacheEntries(r, size)
+	var files []EmbeddedFile
+	for _, e := range entries {
+		files = append(files, EmbeddedFile{Name: safeName(e.id) + imageExtension(e.data), Data: e.data})
+	}
+	return files
+}
+
+// thumbsDBCatalog maps the stream name of each thumbnail in a Thumbs.db to
+// the name of the file it shows. The Catalog stream starts with its header
+// size, a version, the thumbnail count and size, then holds an entry size,
+// index, timestamp and UTF-16 file name per thumbnail. A thumbnail's stream
+// is named after its index with the digits reversed.
+func thumbsDBCatalog(catalog []byte) map[string]string {
+	names := make(map[string]string)
+	if len(catalog) < 16 {
+		return names
+	}
+	pos := int(binary.LittleEndian.Uint16(catalog))
+	for pos+16 <= len(catalog) {
+		size := int(binary.LittleEndian.Uint32(catalog[pos:]))
+		if size < 16 || pos+size > len(catalog) {
+			break
+		}
+		index := strconv.FormatUint(uint64(binary.LittleEndian.Uint32(catalog[pos+4:])), 10)
+		name := catalog[pos+16 : pos+size]
+		for i := 0; i+1 < len(name); i += 2 {
+			if name[i] == 0 && name[i+1] == 0 {
+				name = name[:i]
+				break
+			}
+		}
+
+		reversed := []byte(index)
+		for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+			reversed[i], reversed[j] = reversed[j], reversed[i]
+		}
+		names[string(reversed)] = decodeLinkString(name, true)
+		pos += size
+	}
+	return names
+}
+
+// extractThumbsDB returns the JPEG thumbnails in a Thumbs.db, named after
+// the files they show
+func extractThumbsDB(f *cfbFile) []EmbeddedFile {
+	entries := f.entries()
+	var root, catalog cfbEntry
+	for _, e := range entries {
+		switch {
+		case e.typ == 5:
+			root = e
+		case e.name == "Catalog":
+			catalog = e
+		}
+	}
+	if catalog.name == "" {
+		return nil
+	}
+	data, ok := f.readStream(catalog, root)
+	if !ok {
+		return nil
+	}
+	names := thumbsDBCatalog(data)
+
+	var files []EmbeddedFile
+	used := make(map[string]bool)
+	for _, e := range entries {
+		name, ok := names[e.name]
+		if e.typ != 2 || !ok {
+			continue
+		}
+		stream, ok := f.readStream(e, root)
+		if !ok {
+			continue
+		}
+		// A short header precedes the JPEG; its length differs by version
+		soi := bytes.Index(stream, []byte{0xFF, 0xD8, 0xFF})
+		if soi < 0 {
+			continue
+		}
+
+		// Thumbnails are JPEGs whatever the picture was: "beach.png.jpg"
+		base := safeName(name)
+		if ext := strings.ToLower(filepath.Ext(base)); ext == ".jpg" || ext == ".jpeg" {
+			base = strings.TrimSuffix(base, filepath.Ext(base))
+		}
+		out := base + ".jpg"
+		if used[out] {
+			out = fmt.Sprintf("%s_%s.jpg", base, e.name)
+		}
+		used[out] = true
+		files = append(files, EmbeddedFile{Name: out, Data: stream[soi:]})
+	}
+	return files
+}
+
+// extractCFB returns the thumbnails of a Thumbs.db
+func extractCFB(r io.ReaderAt, size int64) []EmbeddedFile {
+	if f, ok := openCFB(r, size); ok {
+		return extractThumbsDB(f)
+	}
+	return nil
+}
+
+// imageExtension names the image format of a thumbnail's data
+func imageExtension(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return ".jpg"
+	case bytes.HasPrefix(data, []byte("\x89PNG")):
+		return ".png"
+	case bytes.HasPrefix(data, []byte("BM")):
+		return ".bmp"
+	}
+	return ".bin"
+}
+
+// safeName makes a name recorded inside a carved file usable as a file name
+func safeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == ".." {
+		return "unnamed"
+	}
+	return name
+}
+
+// ExtractEmbedded writes the files the signature's Extract hook finds inside
+// a recovered file to a directory next to it, returning the directory and
+// the number of files written
+func (c *Carver) ExtractEmbedded(file *CarvedFile) (string, int, error) {
+	if file.Signature.Extract == nil {
+		return "", 0, nil
+	}
+	content, size, err := c.content(*file)
+	if err != nil {
+		return "", 0, err
+	}
+	embedded := file.Signature.Extract(content, size)
+	if len(embedded) == 0 {
+		return "", 0, nil
+	}
+
+	dir := file.Path + ".extracted"
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, err
+	}
+	for _, e := range embedded {
+		if err := os.WriteFile(filepath.Join(dir, e.Name), e.Data, 0644); err != nil {
+			return dir, 0, err
+		}
+	}
+	return dir, len(embedded), nil
+}
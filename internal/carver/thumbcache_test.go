@@ -0,0 +1,145 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// utf16le encodes s as UTF-16LE
+func utf16le(s string) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, c)
+	}
+	return b
+}
+
+// makeThumbcache builds a Windows 7 thumbcache file holding the given
+// identifier and image pairs
+func makeThumbcache(thumbs ...[2]string) []byte {
+	le := binary.LittleEndian
+	file := make([]byte, thumbcacheHeaderSize)
+	copy(file, "CMMM")
+	le.PutUint32(file[4:], thumbcacheWin7)
+	le.PutUint32(file[8:], 1) // thumbcache_96.db
+	le.PutUint32(file[12:], thumbcacheHeaderSize)
+
+	for _, thumb := range thumbs {
+		id := utf16le(thumb[0])
+		entry := make([]byte, 48)
+		copy(entry, "CMMM")
+		le.PutUint32(entry[4:], uint32(48+len(id)+len(thumb[1])))
+		le.PutUint32(entry[16:], uint32(len(id)))
+		le.PutUint32(entry[24:], uint32(len(thumb[1])))
+		entry = append(append(entry, id...), thumb[1]...)
+		file = append(file, entry...)
+	}
+	le.PutUint32(file[16:], uint32(len(file)))
+	return file
+}
+
+func TestThumbcache(t *testing.T) {
+	jpg := string(makeJPEG(t))
+	cache := makeThumbcache([2]string{"7e2c83a3d5f9b2e1", jpg}, [2]string{"0b5ef2a0c81f9d3c", "BM" + string(make([]byte, 60))})
+	data := append(append([]byte{}, cache...), bytes.Repeat([]byte{0x11}, 4096)...)
+
+	if !verifyThumbcache(cache) {
+		t.Fatal("Expected thumbcache header to verify")
+	}
+	if verifyThumbcache(cache[thumbcacheHeaderSize:]) {
+		t.Error("Expected an entry not to verify as a file header")
+	}
+	if got := thumbcacheSize(bytes.NewReader(data), int64(len(data))); got != int64(len(cache)) {
+		t.Errorf("Expected size %d, got %d", len(cache), got)
+	}
+
+	files := extractThumbcache(bytes.NewReader(cache), int64(len(cache)))
+	if len(files) != 2 || files[0].Name != "7e2c83a3d5f9b2e1.jpg" || files[1].Name != "0b5ef2a0c81f9d3c.bmp" {
+		t.Fatalf("Unexpected thumbnails %v", files)
+	}
+	if string(files[0].Data) != jpg {
+		t.Error("Expected the first thumbnail to be the JPEG")
+	}
+}
+
+// makeThumbsDB builds an XP Thumbs.db with a thumbnail per file name
+func makeThumbsDB(jpg []byte, names ...string) []byte {
+	le := binary.LittleEndian
+	catalog := make([]byte, 16)
+	le.PutUint16(catalog, 16)
+	le.PutUint16(catalog[2:], 7)
+	le.PutUint32(catalog[4:], uint32(len(names)))
+	le.PutUint32(catalog[8:], 96)
+	le.PutUint32(catalog[12:], 96)
+
+	streams := [][2]string{{"Catalog", ""}}
+	for i, name := range names {
+		entry := make([]byte, 16)
+		entry = append(append(entry, utf16le(name)...), 0, 0, 0, 0)
+		le.PutUint32(entry, uint32(len(entry)))
+		le.PutUint32(entry[4:], uint32(i+9)) // Indexes 9, 10, ...
+		catalog = append(catalog, entry...)
+
+		thumb := make([]byte, 12) // XP stream header
+		le.PutUint32(thumb, 12)
+		le.PutUint32(thumb[8:], uint32(len(jpg)))
+		index := []byte(string(rune('0' + (i+9)%10)))
+		if i+9 >= 10 {
+			index = append(index, '1')
+		}
+		streams = append(streams, [2]string{string(index), string(append(thumb, jpg...))})
+	}
+	streams[0][1] = string(catalog)
+	return makeMiniCFB(streams...)
+}
+
+func TestThumbsDB(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	jpg := makeJPEG(t)
+	thumbs := makeThumbsDB(jpg, "beach.jpg", "party.png")
+	if name, _ := classifyCFB(bytes.NewReader(thumbs), int64(len(thumbs))); name != "THUMBSDB" {
+		t.Errorf("Expected THUMBSDB, got %q", name)
+	}
+
+	data := make([]byte, 64*1024)
+	copy(data[4096:], thumbs)
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	carver := NewCarver(reader)
+	sig := findSignature(t, "OLE")
+	file := CarvedFile{Signature: &sig, Offset: 4096}
+	if err := carver.recoverFile(&file, outputDir, 1); err != nil {
+		t.Fatalf("recoverFile failed: %v", err)
+	}
+	dir, n, err := carver.ExtractEmbedded(&file)
+	if err != nil || n != 2 {
+		t.Fatalf("Expected 2 thumbnails, got %d (%v)", n, err)
+	}
+	if dir != filepath.Join(outputDir, "THUMBSDB", "carved_000001.db.extracted") {
+		t.Errorf("Unexpected directory %s", dir)
+	}
+	for _, name := range []string{"beach.jpg", "party.png.jpg"} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("Expected thumbnail %s: %v", name, err)
+		} else if !bytes.Equal(got, jpg) {
+			t.Errorf("Thumbnail %s does not match", name)
+		}
+	}
+}
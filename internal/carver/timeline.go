@@ -0,0 +1,111 @@
+package carver
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/internal/fat32"
+	"github.com/shubham/recovery/internal/ntfs"
+)
+
+// A timeline puts what happened on a disk in order: when files were
+// created, changed and deleted. The times the disk's FAT32 and NTFS volumes
+// keep, the NTFS change journal and the recycle bins are written as a body
+// file, the Sleuth Kit's format that mactime turns into a timeline and
+// Timesketch and plaso import:
+//
+//	MD5|name|inode|mode|UID|GID|size|atime|mtime|ctime|crtime
+//	0|/Users/anna/report.docx (deleted)|1234|r/rrwxrwxrwx|0|0|20480|1623665000|1623664921|1623664921|1623600000
+//
+// Names carry what a line is: " ($FILE_NAME)" for the times of an NTFS file
+// name attribute, " ($UsnJrnl: FILE_DELETE,CLOSE)" for a change journal
+// record and " (deleted from C:\...)" on a recycle bin's $R file for when it
+// was deleted. Events have their time as ctime.
+
+// TimelineFile is the body file written below the output directory
+const TimelineFile = "timeline.body"
+
+// Timeline returns the timeline entries of the disk's FAT32 and NTFS
+// volumes, with their paths below partitionN/ on a partitioned disk
+func Timeline(reader *disk.Reader) ([]disk.TimelineEntry, error) {
+	defer reader.Purpose("timeline")()
+	var timeline []disk.TimelineEntry
+	found := false
+	for _, v := range diskVolumes(reader) {
+		fs, err := disk.DetectFilesystem(v.reader)
+		if err != nil {
+			continue
+		}
+		var entries []disk.TimelineEntry
+		switch fs {
+		case "ntfs":
+			p, err := ntfs.NewParser(v.reader)
+			if err != nil {
+				continue
+			}
+			entries, err = p.Timeline()
+			if err != nil {
+				reader.Warnf("  %v\n", err) // What was read before is still worth keeping
+			}
+		case "fat32":
+			p, err := fat32.NewParser(v.reader)
+			if err != nil {
+				continue
+			}
+			if entries, err = p.Timeline(); err != nil {
+				return nil, err
+			}
+		default:
+			continue
+		}
+		found = true
+		for _, e := range entries {
+			e.Path = filepath.Join(v.name, e.Path)
+			timeline = append(timeline, e)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no FAT32 or NTFS volume found")
+	}
+	return timeline, nil
+}
+
+// WriteTimeline writes the disk's timeline to TimelineFile below outputDir.
+// With scanOnly only the number of entries is reported. It returns the
+// number of entries.
+func WriteTimeline(reader *disk.Reader, outputDir string, scanOnly bool) (int, error) {
+	timeline, err := Timeline(reader)
+	if err != nil {
+		return 0, err
+	}
+	reader.Printf("Found %d timeline entries\n", len(timeline))
+	if scanOnly {
+		return len(timeline), nil
+	}
+
+	path := filepath.Join(outputDir, TimelineFile)
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	for _, e := range timeline {
+		mode := "r/rrwxrwxrwx"
+		if e.Dir {
+			mode = "d/drwxrwxrwx"
+		}
+		// The format has no escaping, so a | in a name would split it
+		name := "/" + strings.ReplaceAll(filepath.ToSlash(e.Path), "|", "_")
+		fmt.Fprintf(w, "0|%s|%d|%s|0|0|%d|%d|%d|%d|%d\n", name, e.Inode, mode, e.Size, e.Accessed, e.Modified, e.Changed, e.Created)
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	reader.Printf("Wrote %d timeline entries to %s\n", len(timeline), path)
+	return len(timeline), f.Close()
+}
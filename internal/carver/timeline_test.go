@@ -0,0 +1,56 @@
+package carver
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func TestWriteTimeline(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	// NOTES|1.TXT, written 2021-07-01 08:00:00, and a deleted OLD.TXT
+	volume := makeFAT32(8, 2, 3)
+	root := volume[34*512:]
+	copy(root, "NOTES|1 TXT")
+	binary.LittleEndian.PutUint16(root[22:], 8<<11)
+	binary.LittleEndian.PutUint16(root[24:], (2021-1980)<<9|7<<5|1)
+	binary.LittleEndian.PutUint16(root[26:], 3)
+	binary.LittleEndian.PutUint32(root[28:], 100)
+	copy(root[32:], "\xE5LD     TXT")
+
+	if err := os.WriteFile(tmpFile, volume, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	outputDir := filepath.Join(tmpDir, "out")
+	os.MkdirAll(outputDir, 0755)
+	if n, err := WriteTimeline(reader, outputDir, true); err != nil || n != 2 {
+		t.Fatalf("Expected 2 entries when scanning, got %d (%v)", n, err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, TimelineFile)); err == nil {
+		t.Error("Expected no body file when scanning")
+	}
+
+	if n, err := WriteTimeline(reader, outputDir, false); err != nil || n != 2 {
+		t.Fatalf("Expected 2 entries, got %d (%v)", n, err)
+	}
+	body, err := os.ReadFile(filepath.Join(outputDir, TimelineFile))
+	if err != nil {
+		t.Fatalf("Failed to read body file: %v", err)
+	}
+	want := "0|/NOTES_1.TXT|0|r/rrwxrwxrwx|0|0|100|0|1625126400|0|0\n" +
+		"0|/?LD.TXT (deleted)|0|r/rrwxrwxrwx|0|0|0|0|0|0|0\n"
+	if string(body) != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, body)
+	}
+}
@@ -0,0 +1,269 @@
+package carver
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// Verdict is the outcome of validating a carved file
+type Verdict int
+
+const (
+	Unchecked Verdict = iota // No validator for this type, or validation disabled
+	Valid                    // Structure checks passed
+	Invalid                  // Structure checks failed; see CarvedFile.Problem
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Valid:
+		return "valid"
+	case Invalid:
+		return "invalid"
+	default:
+		return "unchecked"
+	}
+}
+
+// ValidateMode controls what happens to carved files that fail validation
+type ValidateMode int
+
+const (
+	ValidateOff        ValidateMode = iota // Don't validate
+	ValidateReport                         // Validate and record the verdict, keep every file
+	ValidateQuarantine                     // Write invalid files under QuarantineDir
+	ValidateDiscard                        // Don't write invalid files at all
+)
+
+// QuarantineDir is the output subdirectory for invalid carvings
+const QuarantineDir = "_invalid"
+
+// ParseValidateMode converts a -validate flag value into a ValidateMode
+func ParseValidateMode(s string) (ValidateMode, error) {
+	switch s {
+	case "", "off":
+		return ValidateOff, nil
+	case "report":
+		return ValidateReport, nil
+	case "quarantine":
+		return ValidateQuarantine, nil
+	case "discard":
+		return ValidateDiscard, nil
+	}
+	return ValidateOff, fmt.Errorf("unknown validation mode %q (want off, report, quarantine or discard)", s)
+}
+
+// validator checks the structure of a carved region
+type validator func(r io.ReaderAt, size int64) error
+
+// validators maps signature names to their structure checks
+var validators = map[string]validator{
+	"JPEG":     validateJPEG,
+	"PNG":      validatePNG,
+	"ZIP":      validateZIP,
+	"PDF":      validatePDF,
+	"SQLite":   validateSQLite,
+	"GIT-PACK": validateGitPack,
+}
+
+// Validate checks a carved candidate's structure and records the verdict in
+// file.Verdict (and the reason in file.Problem). The carved size is stored in
+// file.Size.
+func (c *Carver) Validate(file *CarvedFile) error {
+	content, size, err := c.content(*file)
+	if err != nil {
+		return err
+	}
+	file.Size = size
+
+	check := validator(file.Signature.Validate)
+	if check == nil {
+		check = validators[file.Signature.Name]
+	}
+	if check == nil {
+		file.Verdict = Unchecked
+		return nil
+	}
+
+	if err := check(content, size); err != nil {
+		file.Verdict = Invalid
+		file.Problem = err.Error()
+	} else {
+		file.Verdict = Valid
+		file.Problem = ""
+	}
+	return nil
+}
+
+// maxValidatePixels bounds the images the validators and -repair-jpeg
+// decode: a decode allocates for every pixel, and a carved header can
+// claim any size
+const maxValidatePixels = 100 * 1000 * 1000
+
+func validateJPEG(r io.ReaderAt, size int64) error {
+	config, err := jpeg.DecodeConfig(bufio.NewReader(io.NewSectionReader(r, 0, size)))
+	if err != nil {
+		return fmt.Errorf("jpeg: %w", err)
+	}
+	if err := checkDimensions(config); err != nil {
+		return fmt.Errorf("jpeg: %w", err)
+	}
+	// A full decode walks every marker segment and the entropy-coded scan data
+	if _, err := jpeg.Decode(bufio.NewReader(io.NewSectionReader(r, 0, size))); err != nil {
+		return fmt.Errorf("jpeg: %w", err)
+	}
+	return nil
+}
+
+func validatePNG(r io.ReaderAt, size int64) error {
+	config, err := png.DecodeConfig(bufio.NewReader(io.NewSectionReader(r, 0, size)))
+	if err != nil {
+		return err
+	}
+	if err := checkDimensions(config); err != nil {
+		return fmt.Errorf("png: %w", err)
+	}
+	// The decoder verifies chunk CRCs and the zlib stream
+	_, err = png.Decode(bufio.NewReader(io.NewSectionReader(r, 0, size)))
+	return err
+}
+
+// checkDimensions refuses an image too large to decode, before a decode
+// allocates for it
+func checkDimensions(config image.Config) error {
+	if config.Width <= 0 || config.Height <= 0 {
+		return fmt.Errorf("invalid dimensions %dx%d", config.Width, config.Height)
+	}
+	if int64(config.Width)*int64(config.Height) > maxValidatePixels {
+		return fmt.Errorf("%dx%d pixels, too many to decode", config.Width, config.Height)
+	}
+	return nil
+}
+
+func validateZIP(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("zip: %w", err)
+	}
+	if len(zr.File) == 0 {
+		return errors.New("zip: empty central directory")
+	}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("zip: %s: %w", f.Name, err)
+		}
+		// Reading to EOF makes archive/zip verify the CRC-32
+		_, err = io.Copy(io.Discard, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("zip: %s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func validatePDF(r io.ReaderAt, size int64) error {
+	head := make([]byte, min(size, 1024))
+	if _, err := r.ReadAt(head, 0); err != nil && err != io.EOF {
+		return err
+	}
+	if !bytes.HasPrefix(head, []byte("%PDF-")) {
+		return errors.New("pdf: missing %PDF- header")
+	}
+
+	// The cross-reference pointer and EOF marker live in the last few KB
+	tailLen := min(size, 4096)
+	tail := make([]byte, tailLen)
+	if _, err := r.ReadAt(tail, size-tailLen); err != nil && err != io.EOF {
+		return err
+	}
+	if !bytes.Contains(tail, []byte("%%EOF")) {
+		return errors.New("pdf: missing %%EOF trailer")
+	}
+	if !bytes.Contains(tail, []byte("startxref")) {
+		return errors.New("pdf: missing startxref")
+	}
+
+	// Classic xref table or cross-reference stream
+	found, err := readerContains(r, size, []byte("xref"), []byte("/XRef"))
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.New("pdf: no cross-reference table")
+	}
+	return nil
+}
+
+// readerContains reports whether any of the patterns occurs in the first size
+// bytes of r, reading in chunks so large files are not loaded into memory
+func readerContains(r io.ReaderAt, size int64, patterns ...[]byte) (bool, error) {
+	overlap := 0
+	for _, p := range patterns {
+		overlap = max(overlap, len(p)-1)
+	}
+
+	buf := make([]byte, 64*1024+overlap)
+	var pos int64
+	for pos < size {
+		n, err := r.ReadAt(buf[:min(int64(len(buf)), size-pos)], pos)
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+		for _, p := range patterns {
+			if bytes.Contains(buf[:n], p) {
+				return true, nil
+			}
+		}
+		if n <= overlap {
+			break
+		}
+		pos += int64(n - overlap)
+	}
+	return false, nil
+}
+
+func validateSQLite(r io.ReaderAt, size int64) error {
+	if size < 100 {
+		return errors.New("sqlite: truncated header")
+	}
+	hdr := make([]byte, 100)
+	if _, err := r.ReadAt(hdr, 0); err != nil && err != io.EOF {
+		return err
+	}
+	if string(hdr[:16]) != "SQLite format 3\x00" {
+		return errors.New("sqlite: bad magic")
+	}
+
+	pageSize := int(binary.BigEndian.Uint16(hdr[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize > 65536 || pageSize&(pageSize-1) != 0 {
+		return fmt.Errorf("sqlite: invalid page size %d", pageSize)
+	}
+	if hdr[18] < 1 || hdr[18] > 2 || hdr[19] < 1 || hdr[19] > 2 {
+		return errors.New("sqlite: invalid file format version")
+	}
+	if hdr[21] != 64 || hdr[22] != 32 || hdr[23] != 32 {
+		return errors.New("sqlite: invalid payload fractions")
+	}
+
+	pages := int64(binary.BigEndian.Uint32(hdr[28:32]))
+	if pages == 0 {
+		return errors.New("sqlite: zero page count")
+	}
+	if pages*int64(pageSize) > size {
+		return fmt.Errorf("sqlite: header declares %d pages but only %d bytes were carved", pages, size)
+	}
+	return checkSQLitePages(r, pages*int64(pageSize))
+}
@@ -0,0 +1,161 @@
+package carver
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 7)
+	}
+	return img
+}
+
+func makeJPEG(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func makePNG(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage()); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func makeZIP(t *testing.T) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("word/document.xml")
+	if err != nil {
+		t.Fatalf("Failed to create zip entry: %v", err)
+	}
+	w.Write(bytes.Repeat([]byte("hello "), 100))
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func makeSQLiteHeader(pageSize uint16, pages uint32) []byte {
+	hdr := make([]byte, 100)
+	copy(hdr, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(hdr[16:18], pageSize)
+	hdr[18], hdr[19] = 1, 1
+	hdr[21], hdr[22], hdr[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(hdr[28:32], pages)
+	return hdr
+}
+
+func TestValidators(t *testing.T) {
+	jpg := makeJPEG(t)
+	pngData := makePNG(t)
+	zipData := makeZIP(t)
+
+	corruptPNG := append([]byte{}, pngData...)
+	corruptPNG[len(corruptPNG)/2] ^= 0xFF // Breaks a chunk CRC
+
+	corruptZIP := append([]byte{}, zipData...)
+	corruptZIP[50] ^= 0xFF // Inside the compressed file data
+
+	// Headers claiming 65535x65535 pixels, which a decode would allocate
+	hugeJPEG := append([]byte{}, jpg...)
+	sof := bytes.Index(hugeJPEG, []byte{0xFF, 0xC0})
+	binary.BigEndian.PutUint32(hugeJPEG[sof+5:], 0xFFFFFFFF)
+	hugePNG := append([]byte{}, pngData...)
+	binary.BigEndian.PutUint32(hugePNG[16:], 0xFFFF)
+	binary.BigEndian.PutUint32(hugePNG[20:], 0xFFFF)
+	binary.BigEndian.PutUint32(hugePNG[29:], crc32.ChecksumIEEE(hugePNG[12:29]))
+
+	sqlite := append(makeSQLiteHeader(4096, 2), make([]byte, 2*4096-100)...)
+	sqlite[sqliteHeaderSize] = sqliteTableLeaf // Empty schema
+
+	tests := []struct {
+		name    string
+		check   validator
+		data    []byte
+		wantErr bool
+	}{
+		{"JPEG valid", validateJPEG, jpg, false},
+		{"JPEG truncated", validateJPEG, jpg[:len(jpg)/2], true},
+		{"PNG valid", validatePNG, pngData, false},
+		{"PNG bad CRC", validatePNG, corruptPNG, true},
+		{"JPEG too large", validateJPEG, hugeJPEG, true},
+		{"PNG too large", validatePNG, hugePNG, true},
+		{"ZIP valid", validateZIP, zipData, false},
+		{"ZIP bad data", validateZIP, corruptZIP, true},
+		{"ZIP no central directory", validateZIP, zipData[:len(zipData)-30], true},
+		{"PDF valid", validatePDF, []byte("%PDF-1.4\n1 0 obj\nendobj\nxref\n0 1\ntrailer\nstartxref\n9\n%%EOF"), false},
+		{"PDF no xref", validatePDF, []byte("%PDF-1.4\n1 0 obj\nendobj\n%%EOF"), true},
+		{"SQLite valid", validateSQLite, sqlite, false},
+		{"SQLite bad page size", validateSQLite, append(makeSQLiteHeader(1000, 1), make([]byte, 1000)...), true},
+		{"SQLite truncated", validateSQLite, makeSQLiteHeader(4096, 10), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.check(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if tt.wantErr && err == nil {
+				t.Errorf("Expected validation error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Unexpected validation error: %v", err)
+			}
+		})
+	}
+}
+
+func TestRecoverQuarantine(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	pngData := makePNG(t)
+	corrupt := append([]byte{}, pngData...)
+	corrupt[len(corrupt)/2] ^= 0xFF
+
+	data := make([]byte, 64*1024)
+	copy(data[0:], pngData)
+	copy(data[32*1024:], corrupt)
+
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	opts := Options{
+		Signatures: []FileSignature{findSignature(t, "PNG")},
+		Validate:   ValidateQuarantine,
+	}
+	if _, err := Recover(reader, outputDir, false, opts); err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(outputDir, "PNG", "carved_000000.png")); err != nil {
+		t.Errorf("Valid PNG not written: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, QuarantineDir, "PNG", "carved_000001.png")); err != nil {
+		t.Errorf("Invalid PNG not quarantined: %v", err)
+	}
+}
@@ -0,0 +1,601 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// Virtual machine disks are sparse: the header is followed by tables that
+// map the guest's blocks to where they were allocated in the file, and each
+// new block is appended. The file therefore ends with the highest block the
+// tables point at, plus any trailing footer. Fixed-size VHDs and flat VMDK
+// extents are raw disk data with nothing to find at their start, and are
+// left to the signatures of the files inside them.
+
+const vdiskSector = 512
+
+// VMDK sparse extents ("KDMV") map grains through a grain directory of
+// grain tables. Stream-optimized extents, as exported in OVA appliances,
+// hold compressed grains and metadata markers instead, ending with an
+// end-of-stream marker.
+
+const (
+	vmdkCompressed = 1 << 16
+	vmdkMarkers    = 1 << 17
+	vmdkGDAtEnd    = 0xFFFFFFFFFFFFFFFF
+)
+
+// verifyVMDK checks the version and the line ending characters the header
+// stores to detect transfer in text mode
+func verifyVMDK(data []byte) bool {
+	if len(data) < 80 {
+		return false
+	}
+	version := binary.LittleEndian.Uint32(data[4:])
+	grain := binary.LittleEndian.Uint64(data[20:])
+	return version >= 1 && version <= 3 && grain >= 8 && grain&(grain-1) == 0 &&
+		string(data[73:77]) == "\n \r\n"
+}
+
+// vmdkSize follows the grain directory, or walks the markers of a
+// stream-optimized extent, to the last grain
+func vmdkSize(r io.ReaderAt, limit int64) int64 {
+	hdr := make([]byte, 80)
+	if _, err := r.ReadAt(hdr, 0); err != nil || !verifyVMDK(hdr) {
+		return 0
+	}
+	le := binary.LittleEndian
+	flags := le.Uint32(hdr[8:])
+	capacity, grain := le.Uint64(hdr[12:]), le.Uint64(hdr[20:])
+	gtes := uint64(le.Uint32(hdr[44:]))
+	gd, overhead := le.Uint64(hdr[56:]), int64(le.Uint64(hdr[64:]))
+	if overhead <= 0 || overhead*vdiskSector > limit {
+		return 0
+	}
+
+	if gd == vmdkGDAtEnd || flags&(vmdkCompressed|vmdkMarkers) == vmdkCompressed|vmdkMarkers {
+		// Grains (LBA, compressed size, data) and markers (sector count,
+		// zero, type) each padded to a sector; type 0 ends the stream
+		pos := overhead * vdiskSector
+		m := make([]byte, 16)
+		for pos+vdiskSector <= limit {
+			if _, err := r.ReadAt(m, pos); err != nil {
+				return 0
+			}
+			if size := int64(le.Uint32(m[8:])); size > 0 {
+				pos += (12 + size + vdiskSector - 1) / vdiskSector * vdiskSector
+				continue
+			}
+			if le.Uint32(m[12:]) == 0 {
+				return pos + vdiskSector
+			}
+			pos += vdiskSector + int64(le.Uint64(m))*vdiskSector
+		}
+		return 0
+	}
+
+	if gtes == 0 || gtes > 4096 || gd == 0 {
+		return 0
+	}
+	entries := (capacity + grain*gtes - 1) / (grain * gtes)
+	if entries > 1<<20 {
+		return 0
+	}
+	dir := make([]byte, entries*4)
+	if _, err := r.ReadAt(dir, int64(gd)*vdiskSector); err != nil {
+		return 0
+	}
+	end := overhead
+	table := make([]byte, gtes*4)
+	for i := 0; i < len(dir); i += 4 {
+		gt := int64(le.Uint32(dir[i:]))
+		if gt == 0 {
+			continue
+		}
+		if _, err := r.ReadAt(table, gt*vdiskSector); err != nil {
+			return 0
+		}
+		end = max(end, gt+int64(len(table)+vdiskSector-1)/vdiskSector)
+		for j := 0; j < len(table); j += 4 {
+			if g := int64(le.Uint32(table[j:])); g > 1 { // 1 marks a zeroed grain
+				end = max(end, g+int64(grain))
+			}
+		}
+	}
+	if end*vdiskSector > limit {
+		return 0
+	}
+	return end * vdiskSector
+}
+
+// Dynamic and differencing VHDs start with a copy of the 512-byte "conectix"
+// footer, which points at a "cxsparse" header and its block allocation
+// table. Each allocated block is a sector bitmap followed by the data, and
+// the footer itself ends the file.
+
+// verifyVHD checks that the footer copy describes a dynamic or differencing
+// disk
+func verifyVHD(data []byte) bool {
+	if len(data) < 64 {
+		return false
+	}
+	diskType := binary.BigEndian.Uint32(data[60:])
+	offset := binary.BigEndian.Uint64(data[16:])
+	if diskType != 3 && diskType != 4 || offset < vdiskSector || offset%vdiskSector != 0 {
+		return false
+	}
+	// The footer that ends the disk is the same, but not followed by the header
+	return offset+8 > uint64(len(data)) || string(data[offset:offset+8]) == "cxsparse"
+}
+
+// vhdSize finds the block the allocation table places last
+func vhdSize(r io.ReaderAt, limit int64) int64 {
+	be := binary.BigEndian
+	var footer [64]byte
+	if _, err := r.ReadAt(footer[:], 0); err != nil || !verifyVHD(footer[:]) {
+		return 0
+	}
+	dyn := int64(be.Uint64(footer[16:]))
+	hdr := make([]byte, 36)
+	if _, err := r.ReadAt(hdr, dyn); err != nil || string(hdr[:8]) != "cxsparse" {
+		return 0
+	}
+	table := int64(be.Uint64(hdr[16:]))
+	entries := int64(be.Uint32(hdr[28:]))
+	block := int64(be.Uint32(hdr[32:]))
+	if entries > 1<<24 || block < vdiskSector || table <= 0 {
+		return 0
+	}
+	bat := make([]byte, entries*4)
+	if _, err := r.ReadAt(bat, table); err != nil {
+		return 0
+	}
+
+	bitmap := (block/vdiskSector/8 + vdiskSector - 1) / vdiskSector * vdiskSector
+	end := max(dyn+1024, table+(entries*4+vdiskSector-1)/vdiskSector*vdiskSector)
+	for i := 0; i < len(bat); i += 4 {
+		if b := be.Uint32(bat[i:]); b != 0xFFFFFFFF {
+			end = max(end, int64(b)*vdiskSector+bitmap+block)
+		}
+	}
+	end += vdiskSector // Footer
+	if end > limit {
+		return 0
+	}
+	return end
+}
+
+// VHDX files ("vhdxfile") keep a region table at 192KB locating the block
+// allocation table and the metadata region, which holds the block size and
+// logical sector size. Allocation table entries give a block's state and
+// its offset in megabytes; every chunk of payload blocks is followed by an
+// entry for its sector bitmap block.
+
+var (
+	vhdxBATRegion     = []byte{0x66, 0x77, 0xC2, 0x2D, 0x23, 0xF6, 0x00, 0x42, 0x9D, 0x64, 0x11, 0x5E, 0x9B, 0xFD, 0x4A, 0x08}
+	vhdxMetadata      = []byte{0x06, 0xA2, 0x7C, 0x8B, 0x90, 0x47, 0x9A, 0x4B, 0xB8, 0xFE, 0x57, 0x5F, 0x05, 0x0F, 0x88, 0x6E}
+	vhdxFileParams    = []byte{0x37, 0x67, 0xA1, 0xCA, 0x36, 0xFA, 0x43, 0x4D, 0xB3, 0xB6, 0x33, 0xF0, 0xAA, 0x44, 0xE7, 0x6B}
+	vhdxLogicalSector = []byte{0x1D, 0xBF, 0x41, 0x81, 0x6F, 0xA9, 0x09, 0x47, 0xBA, 0x47, 0xF2, 0x33, 0xA8, 0xFA, 0xAB, 0x5F}
+	vhdxVirtualSize   = []byte{0x24, 0x42, 0xA5, 0x2F, 0x1B, 0xCD, 0x76, 0x48, 0xB2, 0x11, 0x5D, 0xBE, 0xD8, 0x3B, 0xF4, 0xB8}
+)
+
+const (
+	vhdxRegionTable = 192 * 1024
+	vhdxMB          = 1024 * 1024
+)
+
+// vhdxLayout is what the region table and metadata say about a VHDX file
+type vhdxLayout struct {
+	bat     []byte
+	block   int64 // Payload block size
+	chunk   int64 // Payload blocks per sector bitmap block
+	virtual int64 // Guest disk size
+	end     int64 // End of the headers, log and regions
+}
+
+// vhdxParse reads the region table, the allocation table and the metadata
+func vhdxParse(r io.ReaderAt) (*vhdxLayout, bool) {
+	le := binary.LittleEndian
+	regions := make([]byte, 16+32*16)
+	if _, err := r.ReadAt(regions, vhdxRegionTable); err != nil || string(regions[:4]) != "regi" {
+		return nil, false
+	}
+	count := min(int64(le.Uint32(regions[8:])), 16)
+
+	// The log, from the first header
+	l := &vhdxLayout{end: vhdxRegionTable + 64*1024}
+	hdr := make([]byte, 80)
+	if _, err := r.ReadAt(hdr, 64*1024); err == nil && string(hdr[:4]) == "head" {
+		l.end = max(l.end, int64(le.Uint64(hdr[72:]))+int64(le.Uint32(hdr[68:])))
+	}
+
+	var meta []byte
+	for i := int64(0); i < count; i++ {
+		e := regions[16+32*i : 48+32*i]
+		offset, length := int64(le.Uint64(e[16:])), int64(le.Uint32(e[24:]))
+		l.end = max(l.end, offset+length)
+		if length <= 0 || length > 256*vhdxMB {
+			continue
+		}
+		switch {
+		case bytes.Equal(e[:16], vhdxBATRegion):
+			l.bat = make([]byte, length)
+			if _, err := r.ReadAt(l.bat, offset); err != nil {
+				return nil, false
+			}
+		case bytes.Equal(e[:16], vhdxMetadata):
+			meta = make([]byte, length)
+			if _, err := r.ReadAt(meta, offset); err != nil {
+				return nil, false
+			}
+		}
+	}
+	if l.bat == nil || len(meta) < 32 || string(meta[:8]) != "metadata" {
+		return nil, false
+	}
+
+	// Metadata table entries: item ID, offset into the region and length
+	var sector int64
+	for i := 0; i < int(le.Uint16(meta[10:])) && 32+32*i+32 <= len(meta); i++ {
+		e := meta[32+32*i:]
+		off := int(le.Uint32(e[16:]))
+		if off+8 > len(meta) {
+			continue
+		}
+		switch {
+		case bytes.Equal(e[:16], vhdxFileParams):
+			l.block = int64(le.Uint32(meta[off:]))
+		case bytes.Equal(e[:16], vhdxLogicalSector):
+			sector = int64(le.Uint32(meta[off:]))
+		case bytes.Equal(e[:16], vhdxVirtualSize):
+			l.virtual = int64(le.Uint64(meta[off:]))
+		}
+	}
+	if l.block < vhdxMB || sector == 0 || (1<<23)*sector%l.block != 0 {
+		return nil, false
+	}
+	l.chunk = (1 << 23) * sector / l.block
+	return l, true
+}
+
+// vhdxSize finds the end of the last region, log or allocated block
+func vhdxSize(r io.ReaderAt, limit int64) int64 {
+	l, ok := vhdxParse(r)
+	if !ok {
+		return 0
+	}
+	end := l.end
+	for i := 0; i+8 <= len(l.bat); i += 8 {
+		e := binary.LittleEndian.Uint64(l.bat[i:])
+		state, offset := e&7, int64(e>>20)*vhdxMB
+		size := l.block
+		if int64(i/8+1)%(l.chunk+1) == 0 {
+			size = vhdxMB // Sector bitmap block
+		}
+		if state == 6 || state == 7 { // Fully or partially present
+			end = max(end, offset+size)
+		}
+	}
+	if end > limit {
+		return 0
+	}
+	return end
+}
+
+// QCOW2 images ("QFI\xfb") count references to each cluster in refcount
+// blocks listed by a refcount table. The image ends with the last cluster
+// in use.
+
+// verifyQCOW2 checks the version and cluster size
+func verifyQCOW2(data []byte) bool {
+	if len(data) < 72 {
+		return false
+	}
+	version := binary.BigEndian.Uint32(data[4:])
+	bits := binary.BigEndian.Uint32(data[20:])
+	return (version == 2 || version == 3) && bits >= 9 && bits <= 21
+}
+
+var zeroRefcount [8]byte
+
+// qcow2Size finds the last cluster with a reference
+func qcow2Size(r io.ReaderAt, limit int64) int64 {
+	hdr := make([]byte, 104)
+	if _, err := r.ReadAt(hdr, 0); err != nil || !verifyQCOW2(hdr) {
+		return 0
+	}
+	be := binary.BigEndian
+	bits := be.Uint32(hdr[20:])
+	cluster := int64(1) << bits
+	table, tableClusters := int64(be.Uint64(hdr[48:])), int64(be.Uint32(hdr[56:]))
+	order := uint32(4)
+	if be.Uint32(hdr[4:]) == 3 {
+		order = be.Uint32(hdr[96:])
+	}
+	if order > 6 || table <= 0 || tableClusters <= 0 || tableClusters*cluster > 64*vhdxMB {
+		return 0
+	}
+	refBits := int64(1) << order
+	perBlock := cluster * 8 / refBits
+
+	offsets := make([]byte, tableClusters*cluster)
+	if _, err := r.ReadAt(offsets, table); err != nil {
+		return 0
+	}
+	last := int64(-1)
+	block := make([]byte, cluster)
+	for i := 0; i+8 <= len(offsets); i += 8 {
+		at := int64(be.Uint64(offsets[i:]) &^ 0x1FF)
+		if at == 0 {
+			continue
+		}
+		if _, err := r.ReadAt(block, at); err != nil {
+			return 0
+		}
+		for j := perBlock - 1; j >= 0; j-- {
+			bit := j * refBits
+			var used bool
+			if refBits >= 8 {
+				used = !bytes.Equal(block[bit/8:(bit+refBits)/8], zeroRefcount[:refBits/8])
+			} else {
+				used = block[bit/8]>>(bit%8)&(1<<refBits-1) != 0
+			}
+			if used {
+				last = max(last, int64(i/8)*perBlock+j)
+				break
+			}
+		}
+	}
+	if last < 0 || (last+1)*cluster > limit {
+		return 0
+	}
+	return (last + 1) * cluster
+}
+
+// VirtualBox VDI images have a text banner, then a header with the block
+// size and the number of blocks allocated after the data offset.
+
+// verifyVDI checks the header version and image type
+func verifyVDI(data []byte) bool {
+	if len(data) < 0x188 {
+		return false
+	}
+	imageType := binary.LittleEndian.Uint32(data[0x4C:])
+	return binary.LittleEndian.Uint32(data[0x44:])>>16 == 1 && imageType >= 1 && imageType <= 4
+}
+
+// vdiSize is the data offset plus the allocated blocks
+func vdiSize(r io.ReaderAt, limit int64) int64 {
+	hdr := make([]byte, 0x188)
+	if _, err := r.ReadAt(hdr, 0); err != nil || !verifyVDI(hdr) {
+		return 0
+	}
+	le := binary.LittleEndian
+	data := int64(le.Uint32(hdr[0x158:]))
+	block, extra := int64(le.Uint32(hdr[0x178:])), int64(le.Uint32(hdr[0x17C:]))
+	allocated := int64(le.Uint32(hdr[0x184:]))
+	end := data + allocated*(block+extra)
+	if data == 0 || block == 0 || end > limit {
+		return 0
+	}
+	return end
+}
+
+// The guest disk inside a virtual disk is laid out from the same tables, so
+// that recursive carving and filesystem detection see the disk the virtual
+// machine saw. Blocks that were never written, or that live in a parent
+// image, read as zeros. Compressed grains of stream-optimized VMDKs and
+// compressed or encrypted QCOW2 clusters are not decoded.
+
+const maxGuestBlocks = 1 << 22 // Bound on the block map of a guest disk
+
+// blockDisk presents a guest disk from the file offset of each of its blocks
+type blockDisk struct {
+	r      io.ReaderAt
+	block  int64
+	size   int64
+	blocks []int64 // File offset of each block, -1 when it reads as zeros
+}
+
+// newBlockDisk returns a map of unallocated blocks for a guest disk, or nil
+// when it would be too large
+func newBlockDisk(r io.ReaderAt, block, size int64) *blockDisk {
+	if block <= 0 || size <= 0 || (size+block-1)/block > maxGuestBlocks {
+		return nil
+	}
+	blocks := make([]int64, (size+block-1)/block)
+	for i := range blocks {
+		blocks[i] = -1
+	}
+	return &blockDisk{r: r, block: block, size: size, blocks: blocks}
+}
+
+func (d *blockDisk) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) && off < d.size {
+		i, within := off/d.block, off%d.block
+		chunk := min(min(int64(len(p)-n), d.block-within), d.size-off)
+		if d.blocks[i] < 0 {
+			for j := n; j < n+int(chunk); j++ {
+				p[j] = 0
+			}
+		} else if m, err := d.r.ReadAt(p[n:n+int(chunk)], d.blocks[i]+within); err != nil && !(err == io.EOF && int64(m) == chunk) {
+			return n + m, err
+		}
+		n += int(chunk)
+		off += chunk
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// vmdkOpen lays out the guest disk of a sparse extent from its grain tables
+func vmdkOpen(r io.ReaderAt, size int64) (io.ReaderAt, int64) {
+	hdr := make([]byte, 80)
+	if _, err := r.ReadAt(hdr, 0); err != nil || !verifyVMDK(hdr) {
+		return nil, 0
+	}
+	le := binary.LittleEndian
+	capacity, grain := int64(le.Uint64(hdr[12:])), int64(le.Uint64(hdr[20:]))
+	gtes, gd := int64(le.Uint32(hdr[44:])), le.Uint64(hdr[56:])
+	if gd == vmdkGDAtEnd || le.Uint32(hdr[8:])&vmdkCompressed != 0 || gtes == 0 || gtes > 4096 {
+		return nil, 0
+	}
+	d := newBlockDisk(r, grain*vdiskSector, capacity*vdiskSector)
+	if d == nil {
+		return nil, 0
+	}
+	dir := make([]byte, (int64(len(d.blocks))+gtes-1)/gtes*4)
+	if _, err := r.ReadAt(dir, int64(gd)*vdiskSector); err != nil {
+		return nil, 0
+	}
+	table := make([]byte, gtes*4)
+	for i := 0; i < len(dir); i += 4 {
+		gt := int64(le.Uint32(dir[i:]))
+		if gt == 0 {
+			continue
+		}
+		if _, err := r.ReadAt(table, gt*vdiskSector); err != nil {
+			return nil, 0
+		}
+		for j := int64(0); j < gtes; j++ {
+			idx := int64(i/4)*gtes + j
+			if g := int64(le.Uint32(table[4*j:])); g > 1 && idx < int64(len(d.blocks)) {
+				d.blocks[idx] = g * vdiskSector
+			}
+		}
+	}
+	return d, d.size
+}
+
+// vhdOpen lays out the guest disk of a dynamic VHD from its allocation table
+func vhdOpen(r io.ReaderAt, size int64) (io.ReaderAt, int64) {
+	be := binary.BigEndian
+	footer := make([]byte, 64)
+	if _, err := r.ReadAt(footer, 0); err != nil || !verifyVHD(footer) {
+		return nil, 0
+	}
+	hdr := make([]byte, 36)
+	if _, err := r.ReadAt(hdr, int64(be.Uint64(footer[16:]))); err != nil || string(hdr[:8]) != "cxsparse" {
+		return nil, 0
+	}
+	block := int64(be.Uint32(hdr[32:]))
+	d := newBlockDisk(r, block, int64(be.Uint64(footer[48:])))
+	if d == nil || block < vdiskSector {
+		return nil, 0
+	}
+	entries := min(int64(be.Uint32(hdr[28:])), int64(len(d.blocks)))
+	bat := make([]byte, entries*4)
+	if _, err := r.ReadAt(bat, int64(be.Uint64(hdr[16:]))); err != nil {
+		return nil, 0
+	}
+	bitmap := (block/vdiskSector/8 + vdiskSector - 1) / vdiskSector * vdiskSector
+	for i := int64(0); i < entries; i++ {
+		if b := be.Uint32(bat[4*i:]); b != 0xFFFFFFFF {
+			d.blocks[i] = int64(b)*vdiskSector + bitmap
+		}
+	}
+	return d, d.size
+}
+
+// vhdxOpen lays out the guest disk of a VHDX from the payload block entries
+// of its allocation table
+func vhdxOpen(r io.ReaderAt, size int64) (io.ReaderAt, int64) {
+	l, ok := vhdxParse(r)
+	if !ok {
+		return nil, 0
+	}
+	d := newBlockDisk(r, l.block, l.virtual)
+	if d == nil {
+		return nil, 0
+	}
+	for i := int64(0); i < int64(len(d.blocks)); i++ {
+		at := (i + i/l.chunk) * 8 // Skipping the sector bitmap entries
+		if at+8 > int64(len(l.bat)) {
+			break
+		}
+		e := binary.LittleEndian.Uint64(l.bat[at:])
+		if state := e & 7; state == 6 || state == 7 {
+			d.blocks[i] = int64(e>>20) * vhdxMB
+		}
+	}
+	return d, d.size
+}
+
+const (
+	qcow2Compressed = 1 << 62
+	qcow2OffsetMask = 0x00FFFFFFFFFFFE00
+)
+
+// qcow2Open lays out the guest disk of a QCOW2 image from its L1 and L2
+// tables
+func qcow2Open(r io.ReaderAt, size int64) (io.ReaderAt, int64) {
+	hdr := make([]byte, 72)
+	if _, err := r.ReadAt(hdr, 0); err != nil || !verifyQCOW2(hdr) {
+		return nil, 0
+	}
+	be := binary.BigEndian
+	if be.Uint32(hdr[32:]) != 0 { // Encrypted
+		return nil, 0
+	}
+	cluster := int64(1) << be.Uint32(hdr[20:])
+	d := newBlockDisk(r, cluster, int64(be.Uint64(hdr[24:])))
+	if d == nil {
+		return nil, 0
+	}
+	perTable := cluster / 8
+	l1 := make([]byte, min(int64(be.Uint32(hdr[36:])), (int64(len(d.blocks))+perTable-1)/perTable)*8)
+	if _, err := r.ReadAt(l1, int64(be.Uint64(hdr[40:]))); err != nil {
+		return nil, 0
+	}
+	l2 := make([]byte, cluster)
+	for i := 0; i < len(l1); i += 8 {
+		at := int64(be.Uint64(l1[i:]) & qcow2OffsetMask)
+		if at == 0 {
+			continue
+		}
+		if _, err := r.ReadAt(l2, at); err != nil {
+			return nil, 0
+		}
+		for j := int64(0); j < perTable; j++ {
+			idx := int64(i/8)*perTable + j
+			e := be.Uint64(l2[8*j:])
+			if idx >= int64(len(d.blocks)) {
+				break
+			}
+			if e&qcow2Compressed == 0 && e&1 == 0 && e&qcow2OffsetMask != 0 {
+				d.blocks[idx] = int64(e & qcow2OffsetMask)
+			}
+		}
+	}
+	return d, d.size
+}
+
+// vdiOpen lays out the guest disk of a VDI image from its block map
+func vdiOpen(r io.ReaderAt, size int64) (io.ReaderAt, int64) {
+	hdr := make([]byte, 0x188)
+	if _, err := r.ReadAt(hdr, 0); err != nil || !verifyVDI(hdr) {
+		return nil, 0
+	}
+	le := binary.LittleEndian
+	data := int64(le.Uint32(hdr[0x158:]))
+	block, extra := int64(le.Uint32(hdr[0x178:])), int64(le.Uint32(hdr[0x17C:]))
+	d := newBlockDisk(r, block, int64(le.Uint64(hdr[0x170:])))
+	if d == nil {
+		return nil, 0
+	}
+	count := min(int64(le.Uint32(hdr[0x180:])), int64(len(d.blocks)))
+	blocks := make([]byte, count*4)
+	if _, err := r.ReadAt(blocks, int64(le.Uint32(hdr[0x154:]))); err != nil {
+		return nil, 0
+	}
+	for i := int64(0); i < count; i++ {
+		if b := le.Uint32(blocks[4*i:]); b < 0xFFFFFFFE { // Free and zeroed blocks are marked
+			d.blocks[i] = data + int64(b)*(block+extra) + extra
+		}
+	}
+	return d, d.size
+}
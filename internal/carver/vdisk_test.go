@@ -0,0 +1,335 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// vmdkHeader builds a sparse extent header
+func vmdkHeader(flags uint32, capacity, gd, overhead uint64) []byte {
+	hdr := make([]byte, 512)
+	copy(hdr, "KDMV")
+	le := binary.LittleEndian
+	le.PutUint32(hdr[4:], 1)
+	le.PutUint32(hdr[8:], flags)
+	le.PutUint64(hdr[12:], capacity)
+	le.PutUint64(hdr[20:], 8) // 4KB grains
+	le.PutUint32(hdr[44:], 512)
+	le.PutUint64(hdr[56:], gd)
+	le.PutUint64(hdr[64:], overhead)
+	copy(hdr[73:], "\n \r\n")
+	return hdr
+}
+
+// makeVMDK builds a monolithic sparse extent with an embedded descriptor and
+// the first, second and fourth grains of its 1MB guest disk at sectors 8,
+// 16 and 40, filled with the sector number; it ends at sector 48
+func makeVMDK() []byte {
+	data := make([]byte, 48*512)
+	copy(data, vmdkHeader(3, 2048, 1, 8))
+	binary.LittleEndian.PutUint32(data[512:], 2) // Grain table at sector 2
+	for i, grain := range []uint32{8, 16, 1, 40} {
+		binary.LittleEndian.PutUint32(data[1024+4*i:], grain)
+	}
+	copy(data[6*512:], "# Disk DescriptorFile\nversion=1\n")
+	for _, sector := range []int{8, 16, 40} {
+		copy(data[sector*512:], bytes.Repeat([]byte{byte(sector)}, 4096))
+	}
+	return data
+}
+
+// makeStreamVMDK builds a stream-optimized extent: a grain, a grain table
+// marker and the end-of-stream marker
+func makeStreamVMDK() []byte {
+	data := make([]byte, 2560)
+	copy(data, vmdkHeader(vmdkCompressed|vmdkMarkers|3, 2048, vmdkGDAtEnd, 1))
+	le := binary.LittleEndian
+	le.PutUint32(data[512+8:], 100)
+	copy(data[512+12:], bytes.Repeat([]byte{0x78}, 100))
+	le.PutUint64(data[1024:], 1)
+	le.PutUint32(data[1024+12:], 2)
+	return data
+}
+
+// makeVHD builds a dynamic VHD with 4KB blocks, the first and third of four
+// allocated and filled with 0xB0 and 0xB2
+func makeVHD() []byte {
+	data := make([]byte, 11776)
+	be := binary.BigEndian
+	footer := make([]byte, 512)
+	copy(footer, "conectix")
+	be.PutUint64(footer[16:], 512)
+	be.PutUint64(footer[48:], 4*4096)
+	be.PutUint32(footer[60:], 3)
+	copy(data, footer)
+	copy(data[512:], "cxsparse")
+	be.PutUint64(data[512+16:], 1536)
+	be.PutUint32(data[512+28:], 4)
+	be.PutUint32(data[512+32:], 4096)
+	for i, sector := range []uint32{4, 0xFFFFFFFF, 13, 0xFFFFFFFF} {
+		be.PutUint32(data[1536+4*i:], sector)
+	}
+	copy(data[2048+512:], bytes.Repeat([]byte{0xB0}, 4096))
+	copy(data[6656+512:], bytes.Repeat([]byte{0xB2}, 4096))
+	copy(data[11264:], footer)
+	return data
+}
+
+// makeVHDX builds a VHDX of a 3MB guest disk with 1MB blocks, the first
+// and third allocated at 4MB and 6MB and filled with 0x44 and 0x66
+func makeVHDX() []byte {
+	data := make([]byte, 7*vhdxMB)
+	le := binary.LittleEndian
+	copy(data, "vhdxfile")
+	copy(data[64*1024:], "head")
+	le.PutUint32(data[64*1024+68:], vhdxMB)
+	le.PutUint64(data[64*1024+72:], vhdxMB)
+
+	regions := data[vhdxRegionTable:]
+	copy(regions, "regi")
+	le.PutUint32(regions[8:], 2)
+	copy(regions[16:], vhdxBATRegion)
+	le.PutUint64(regions[32:], 3*vhdxMB)
+	le.PutUint32(regions[40:], vhdxMB)
+	copy(regions[48:], vhdxMetadata)
+	le.PutUint64(regions[64:], 2*vhdxMB)
+	le.PutUint32(regions[72:], vhdxMB)
+
+	meta := data[2*vhdxMB:]
+	copy(meta, "metadata")
+	le.PutUint16(meta[10:], 3)
+	copy(meta[32:], vhdxFileParams)
+	le.PutUint32(meta[48:], 65536)
+	copy(meta[64:], vhdxLogicalSector)
+	le.PutUint32(meta[80:], 65544)
+	le.PutUint32(meta[65536:], vhdxMB)
+	le.PutUint32(meta[65544:], 512)
+	copy(meta[96:], vhdxVirtualSize)
+	le.PutUint32(meta[112:], 65552)
+	le.PutUint64(meta[65552:], 3*vhdxMB)
+
+	bat := data[3*vhdxMB:]
+	le.PutUint64(bat, 4<<20|6)
+	le.PutUint64(bat[16:], 6<<20|7)
+	copy(data[4*vhdxMB:], bytes.Repeat([]byte{0x44}, vhdxMB))
+	copy(data[6*vhdxMB:], bytes.Repeat([]byte{0x66}, vhdxMB))
+	return data
+}
+
+// makeQCOW2 builds a version 3 image of 512-byte clusters whose last
+// referenced cluster is the given one (at least 7). Its 2KB guest disk maps
+// the first cluster to cluster 5, filled with 0x55, and the fourth to
+// cluster 7, filled with 0x77; the second is compressed and the third
+// unallocated.
+func makeQCOW2(order uint32, last int) []byte {
+	data := make([]byte, (last+1)*512)
+	be := binary.BigEndian
+	copy(data, "QFI\xfb")
+	be.PutUint32(data[4:], 3)
+	be.PutUint32(data[20:], 9)
+	be.PutUint64(data[24:], 2048)
+	be.PutUint32(data[36:], 1)
+	be.PutUint64(data[40:], 1536)
+	be.PutUint64(data[48:], 512)
+	be.PutUint32(data[56:], 1)
+	be.PutUint32(data[96:], order)
+	be.PutUint32(data[100:], 104)
+	be.PutUint64(data[512:], 1024)
+	be.PutUint64(data[1536:], 2048)
+	be.PutUint64(data[2048:], 2560)
+	be.PutUint64(data[2056:], qcow2Compressed|3072)
+	be.PutUint64(data[2072:], 3584)
+	copy(data[2560:], bytes.Repeat([]byte{0x55}, 512))
+	copy(data[3584:], bytes.Repeat([]byte{0x77}, 512))
+	for _, cluster := range []int{0, 1, 2, last} {
+		switch order {
+		case 4:
+			be.PutUint16(data[1024+2*cluster:], 1)
+		case 0:
+			data[1024+cluster/8] |= 1 << (cluster % 8)
+		}
+	}
+	return data
+}
+
+// makeVDI builds a dynamic VDI of a 32KB guest disk whose first three 4KB
+// blocks are stored in reverse order, each filled with 0xB0 plus the
+// guest block number
+func makeVDI() []byte {
+	data := make([]byte, 0x400+3*4096)
+	le := binary.LittleEndian
+	copy(data, "<<< Oracle VM VirtualBox Disk Image >>>\n")
+	le.PutUint32(data[0x40:], 0xBEDA107F)
+	le.PutUint32(data[0x44:], 0x00010001)
+	le.PutUint32(data[0x48:], 0x190)
+	le.PutUint32(data[0x4C:], 1)
+	le.PutUint32(data[0x154:], 0x200)
+	le.PutUint32(data[0x158:], 0x400)
+	le.PutUint64(data[0x170:], 8*4096)
+	le.PutUint32(data[0x178:], 4096)
+	le.PutUint32(data[0x180:], 8)
+	le.PutUint32(data[0x184:], 3)
+	for i, block := range []uint32{2, 1, 0, 0xFFFFFFFF, 0xFFFFFFFF, 0xFFFFFFFF, 0xFFFFFFFF, 0xFFFFFFFF} {
+		le.PutUint32(data[0x200+4*i:], block)
+		if block < 3 {
+			copy(data[0x400+int(block)*4096:], bytes.Repeat([]byte{0xB0 + byte(i)}, 4096))
+		}
+	}
+	return data
+}
+
+func TestVirtualDiskSize(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		data  []byte
+		sizer func(io.ReaderAt, int64) int64
+	}{
+		{"VMDK", makeVMDK(), vmdkSize},
+		{"stream-optimized VMDK", makeStreamVMDK(), vmdkSize},
+		{"VHD", makeVHD(), vhdSize},
+		{"VHDX", makeVHDX(), vhdxSize},
+		{"QCOW2", makeQCOW2(4, 7), qcow2Size},
+		{"QCOW2 with 1-bit refcounts", makeQCOW2(0, 9), qcow2Size},
+		{"VDI", makeVDI(), vdiSize},
+	} {
+		// Trailing data past the end of the disk is not part of it
+		padded := append(append([]byte{}, tc.data...), bytes.Repeat([]byte{0xA5}, 4096)...)
+		if got := tc.sizer(bytes.NewReader(padded), int64(len(padded))); got != int64(len(tc.data)) {
+			t.Errorf("%s: expected size %d, got %d", tc.name, len(tc.data), got)
+		}
+		// A disk cut short cannot be sized
+		half := tc.data[:len(tc.data)/2]
+		if got := tc.sizer(bytes.NewReader(half), int64(len(half))); got != 0 {
+			t.Errorf("%s: expected 0 for a truncated disk, got %d", tc.name, got)
+		}
+	}
+}
+
+func TestVirtualDiskOpen(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		data   []byte
+		open   func(io.ReaderAt, int64) (io.ReaderAt, int64)
+		size   int64
+		block  int64
+		blocks []byte // Fill of the first guest blocks, 0 for zeros; the rest are zeros
+	}{
+		{"VMDK", makeVMDK(), vmdkOpen, 1024 * 1024, 4096, []byte{8, 16, 0, 40}},
+		{"VHD", makeVHD(), vhdOpen, 4 * 4096, 4096, []byte{0xB0, 0, 0xB2, 0}},
+		{"VHDX", makeVHDX(), vhdxOpen, 3 * vhdxMB, vhdxMB, []byte{0x44, 0, 0x66}},
+		{"QCOW2", makeQCOW2(4, 7), qcow2Open, 2048, 512, []byte{0x55, 0, 0, 0x77}},
+		{"VDI", makeVDI(), vdiOpen, 8 * 4096, 4096, []byte{0xB0, 0xB1, 0xB2}},
+	} {
+		guest, size := tc.open(bytes.NewReader(tc.data), int64(len(tc.data)))
+		if guest == nil {
+			t.Errorf("%s: expected a guest disk", tc.name)
+			continue
+		}
+		if size != tc.size {
+			t.Errorf("%s: expected a guest disk of %d bytes, got %d", tc.name, tc.size, size)
+			continue
+		}
+		got := make([]byte, size)
+		if _, err := guest.ReadAt(got, 0); err != nil {
+			t.Errorf("%s: failed to read the guest disk: %v", tc.name, err)
+			continue
+		}
+		for i, fill := range tc.blocks {
+			start := int64(i) * tc.block
+			if !bytes.Equal(got[start:start+tc.block], bytes.Repeat([]byte{fill}, int(tc.block))) {
+				t.Errorf("%s: expected block %d to be filled with %#x", tc.name, i, fill)
+			}
+		}
+		if rest := got[int64(len(tc.blocks))*tc.block:]; !bytes.Equal(rest, make([]byte, len(rest))) {
+			t.Errorf("%s: expected the unallocated blocks to read as zeros", tc.name)
+		}
+	}
+
+	// Reads across block boundaries, and past the end
+	guest, size := vdiOpen(bytes.NewReader(makeVDI()), int64(len(makeVDI())))
+	buf := make([]byte, 4)
+	if n, err := guest.ReadAt(buf, 4094); err != nil || n != 4 || !bytes.Equal(buf, []byte{0xB0, 0xB0, 0xB1, 0xB1}) {
+		t.Errorf("Expected a read across blocks, got %x (%d, %v)", buf, n, err)
+	}
+	if n, err := guest.ReadAt(buf, size-2); n != 2 || err != io.EOF {
+		t.Errorf("Expected a short read at the end, got %d (%v)", n, err)
+	}
+
+	// Stream-optimized grains are compressed
+	if guest, _ := vmdkOpen(bytes.NewReader(makeStreamVMDK()), 2560); guest != nil {
+		t.Error("Expected no guest disk for a stream-optimized VMDK")
+	}
+}
+
+func TestCarveVirtualDisks(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	descriptor := "# Disk DescriptorFile\nversion=1\ncreateType=\"monolithicFlat\"\nRW 2048 FLAT \"disk-flat.vmdk\" 0\n"
+	fixed := make([]byte, 512) // Footer of a fixed VHD, which has no header
+	copy(fixed, "conectix")
+	binary.BigEndian.PutUint64(fixed[16:], 0xFFFFFFFFFFFFFFFF)
+	binary.BigEndian.PutUint32(fixed[60:], 2)
+
+	data := make([]byte, 128*1024)
+	copy(data[4096:], makeVMDK())
+	copy(data[32768:], makeVHD())
+	copy(data[49152:], makeQCOW2(4, 7))
+	copy(data[65536:], makeVDI())
+	copy(data[90112:], descriptor)
+	copy(data[100352:], fixed)
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	var sigs []FileSignature
+	for _, sig := range Signatures {
+		switch sig.Name {
+		case "VMDK", "VHD", "VHDX", "QCOW2", "VDI":
+			sigs = append(sigs, sig)
+		}
+	}
+	carver := NewCarver(reader)
+	carver.SetSignatures(sigs)
+	files, err := carver.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	files = carver.dropContained(files)
+
+	want := []struct {
+		name   string
+		offset int64
+		size   int
+	}{
+		{"VMDK", 4096, len(makeVMDK())},
+		{"VHD", 32768, len(makeVHD())},
+		{"QCOW2", 49152, len(makeQCOW2(4, 7))},
+		{"VDI", 65536, len(makeVDI())},
+		{"VMDK", 90112, len(descriptor)},
+	}
+	if len(files) != len(want) {
+		t.Fatalf("Expected %d disks, got %v", len(want), files)
+	}
+	for i, w := range want {
+		if files[i].Signature.Name != w.name || files[i].Offset != w.offset {
+			t.Errorf("File %d: expected %s at %d, got %s at %d", i, w.name, w.offset, files[i].Signature.Name, files[i].Offset)
+			continue
+		}
+		if _, size, err := carver.content(files[i]); err != nil || size != int64(w.size) {
+			t.Errorf("%s at %d: expected %d bytes, got %d (%v)", w.name, w.offset, w.size, size, err)
+		}
+	}
+}
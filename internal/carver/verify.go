@@ -0,0 +1,89 @@
+package carver
+
+import "encoding/binary"
+
+// Secondary header checks run on every signature hit. Short magic numbers
+// such as "BM" or 0xFFFB occur constantly in random data, so a hit is only
+// kept when the surrounding header fields are plausible. Each check receives
+// the bytes starting at the candidate file offset; at least 64 bytes are
+// available, more when the hit is not near the end of the scan buffer.
+
+// verifyBMP checks the BITMAPFILEHEADER and DIB header fields
+func verifyBMP(data []byte) bool {
+	if len(data) < 30 {
+		return false
+	}
+	fileSize := binary.LittleEndian.Uint32(data[2:6])
+	reserved := binary.LittleEndian.Uint32(data[6:10])
+	pixelOffset := binary.LittleEndian.Uint32(data[10:14])
+	dibSize := binary.LittleEndian.Uint32(data[14:18])
+	planes := binary.LittleEndian.Uint16(data[26:28])
+	bpp := binary.LittleEndian.Uint16(data[28:30])
+
+	switch dibSize {
+	case 12, 40, 52, 56, 64, 108, 124:
+	default:
+		return false
+	}
+	switch bpp {
+	case 1, 4, 8, 16, 24, 32:
+	default:
+		return false
+	}
+	return reserved == 0 && planes == 1 &&
+		fileSize > 14+dibSize && pixelOffset >= 14+dibSize && pixelOffset < fileSize
+}
+
+// verifyMP3 checks the frame header and, as far as they are in the buffer,
+// that the next frames follow it back to back in the same format
+func verifyMP3(data []byte) bool {
+	length, format := mp3Frame(data)
+	if length == 0 {
+		return false
+	}
+	for i := 1; i < mp3CheckFrames && length+4 <= len(data); i++ {
+		next, f := mp3Frame(data[length:])
+		if next == 0 || f != format {
+			return false
+		}
+		length += next
+	}
+	return true
+}
+
+// verifyID3 checks the ID3v2 tag header and, when it is in the buffer, that
+// an MPEG audio frame follows the tag
+func verifyID3(data []byte) bool {
+	if len(data) < 10 || data[3] < 2 || data[3] > 4 || data[4] == 0xFF || data[5]&0x0F != 0 {
+		return false
+	}
+	for _, b := range data[6:10] {
+		if b >= 0x80 {
+			return false
+		}
+	}
+	if end := id3Size(data); end+4 <= int64(len(data)) {
+		return mp3FrameLength(data[end:]) > 0
+	}
+	return true
+}
+
+// verifyEXE checks that the DOS header points at a PE signature
+func verifyEXE(data []byte) bool {
+	if len(data) < 64 {
+		return false
+	}
+	peOffset := int(binary.LittleEndian.Uint32(data[0x3C:0x40]))
+	if peOffset < 64 || peOffset > 64*1024 {
+		return false
+	}
+	if peOffset+4 <= len(data) {
+		return string(data[peOffset:peOffset+4]) == "PE\x00\x00"
+	}
+	return true
+}
+
+// verifyMP4 checks for the "ftyp" box type following the box size
+func verifyMP4(data []byte) bool {
+	return len(data) >= 8 && string(data[4:8]) == "ftyp"
+}
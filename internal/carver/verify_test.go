@@ -0,0 +1,80 @@
+package carver
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func makeBMPHeader() []byte {
+	hdr := make([]byte, 64)
+	copy(hdr, "BM")
+	binary.LittleEndian.PutUint32(hdr[2:6], 14+40+16*16*3)
+	binary.LittleEndian.PutUint32(hdr[10:14], 14+40)
+	binary.LittleEndian.PutUint32(hdr[14:18], 40)
+	binary.LittleEndian.PutUint32(hdr[18:22], 16)
+	binary.LittleEndian.PutUint32(hdr[22:26], 16)
+	binary.LittleEndian.PutUint16(hdr[26:28], 1)
+	binary.LittleEndian.PutUint16(hdr[28:30], 24)
+	return hdr
+}
+
+func TestVerifyBMP(t *testing.T) {
+	if !verifyBMP(makeBMPHeader()) {
+		t.Errorf("Valid BMP header rejected")
+	}
+
+	junk := makeBMPHeader()
+	binary.LittleEndian.PutUint32(junk[14:18], 77) // Unknown DIB header size
+	if verifyBMP(junk) {
+		t.Errorf("BMP with bad DIB header size accepted")
+	}
+
+	junk = makeBMPHeader()
+	binary.LittleEndian.PutUint16(junk[28:30], 7) // Impossible bit depth
+	if verifyBMP(junk) {
+		t.Errorf("BMP with bad bit depth accepted")
+	}
+}
+
+func TestVerifyMP3(t *testing.T) {
+	// 128 kbit/s, 44.1 kHz, no padding: 417-byte frames
+	frame := []byte{0xFF, 0xFB, 0x90, 0x64}
+	if got := mp3FrameLength(frame); got != 417 {
+		t.Fatalf("Expected frame length 417, got %d", got)
+	}
+
+	stream := make([]byte, 2*417)
+	copy(stream, frame)
+	copy(stream[417:], frame)
+	if !verifyMP3(stream) {
+		t.Errorf("Two consecutive frames rejected")
+	}
+
+	broken := make([]byte, 2*417)
+	copy(broken, frame)
+	if verifyMP3(broken) {
+		t.Errorf("Frame without a following frame accepted")
+	}
+
+	if verifyMP3([]byte{0xFF, 0xFB, 0xF0, 0x00}) { // Bad bitrate index
+		t.Errorf("Invalid bitrate accepted")
+	}
+	if verifyMP3([]byte{0xFF, 0xFB, 0x9C, 0x00}) { // Reserved sample rate
+		t.Errorf("Invalid sample rate accepted")
+	}
+}
+
+func TestVerifyEXE(t *testing.T) {
+	data := make([]byte, 256)
+	copy(data, "MZ")
+	binary.LittleEndian.PutUint32(data[0x3C:], 0x80)
+	copy(data[0x80:], "PE\x00\x00")
+	if !verifyEXE(data) {
+		t.Errorf("Valid PE header rejected")
+	}
+
+	copy(data[0x80:], "XX")
+	if verifyEXE(data) {
+		t.Errorf("MZ without PE signature accepted")
+	}
+}
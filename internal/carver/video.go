@@ -0,0 +1,130 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// Camcorders write MPEG transport streams: a run of fixed-size packets that
+// each start with the sync byte 0x47. Broadcast and HDV streams (.ts) use
+// 188-byte packets; AVCHD (.mts) and Blu-ray (.m2ts) prefix each packet with
+// a 4-byte timestamp, making them 192 bytes. A stream starts with the
+// program association table, PID 0, and ends where the packets stop.
+
+const (
+	tsPacketSize   = 188
+	m2tsPacketSize = 192
+	tsCheckPackets = 5 // Packets checked before a hit is believed (fits the scan overlap)
+)
+
+// tsSync returns the offset of the sync byte within a packet
+func tsSync(packet int) int {
+	return packet - tsPacketSize
+}
+
+// verifyTS returns a Verify hook that checks the sync bytes of the first
+// packets of a stream
+func verifyTS(packet int) func([]byte) bool {
+	return func(data []byte) bool {
+		if len(data) < tsCheckPackets*packet {
+			return false
+		}
+		for i := 0; i < tsCheckPackets; i++ {
+			if data[i*packet+tsSync(packet)] != 0x47 {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// tsSizer returns a Sizer that counts packets until one loses sync
+func tsSizer(packet int) func(io.ReaderAt, int64) int64 {
+	return func(r io.ReaderAt, limit int64) int64 {
+		buf := make([]byte, 4096*packet)
+		var pos int64
+		for pos < limit {
+			n, err := r.ReadAt(buf[:min(int64(len(buf)), limit-pos)], pos)
+			for i := 0; i+packet <= n; i += packet {
+				if buf[i+tsSync(packet)] != 0x47 {
+					return pos + int64(i)
+				}
+			}
+			if n < len(buf) || (err != nil && err != io.EOF) {
+				return pos + int64(n/packet*packet)
+			}
+			pos += int64(n)
+		}
+		return pos
+	}
+}
+
+// MXF, the container of professional cameras, is a sequence of KLV triplets:
+// a 16-byte SMPTE key, a BER-encoded length and the value. The file opens
+// with a header partition pack whose value records the offset of the footer
+// partition, from where the remaining KLVs lead to the end of the file.
+
+// mxfPartitionKey is the start of the partition pack keys; the next byte is
+// 0x02 for the header, 0x03 for a body and 0x04 for the footer partition
+var mxfPartitionKey = []byte{0x06, 0x0E, 0x2B, 0x34, 0x02, 0x05, 0x01, 0x01, 0x0D, 0x01, 0x02, 0x01, 0x01}
+
+// verifyMXF checks the status byte of the header partition key: open or
+// closed, complete or incomplete
+func verifyMXF(data []byte) bool {
+	return len(data) >= 16 && data[14] >= 1 && data[14] <= 4
+}
+
+// mxfKLV reads the key of the KLV at pos, returning the key and the offsets
+// of its value and of the next KLV
+func mxfKLV(r io.ReaderAt, pos int64) (key []byte, value, next int64, ok bool) {
+	buf := make([]byte, 25)
+	n, _ := r.ReadAt(buf, pos)
+	if n < 17 || !bytes.HasPrefix(buf, mxfPartitionKey[:4]) {
+		return nil, 0, 0, false
+	}
+	length, head := int64(buf[16]), int64(17)
+	if buf[16] >= 0x80 {
+		size := int(buf[16] & 0x7F)
+		if size < 1 || size > 8 || n < 17+size {
+			return nil, 0, 0, false
+		}
+		length = 0
+		for _, b := range buf[17 : 17+size] {
+			length = length<<8 | int64(b)
+		}
+		if length < 0 {
+			return nil, 0, 0, false
+		}
+		head += int64(size)
+	}
+	return buf[:16], pos + head, pos + head + length, true
+}
+
+// mxfSize walks the KLVs from the footer partition, or from the start when
+// the footer is unknown, to the last one that fits
+func mxfSize(r io.ReaderAt, limit int64) int64 {
+	_, value, next, ok := mxfKLV(r, 0)
+	if !ok || next <= 0 || next > limit {
+		return 0
+	}
+
+	// Versions and KAG size, this and the previous partition, then the footer
+	pos := int64(0)
+	var footer [8]byte
+	if _, err := r.ReadAt(footer[:], value+24); err == nil {
+		at := int64(binary.BigEndian.Uint64(footer[:]))
+		if key, _, _, ok := mxfKLV(r, at); at > 0 && at < limit && ok && bytes.HasPrefix(key, mxfPartitionKey) && key[13] == 0x04 {
+			pos = at
+		}
+	}
+
+	for pos < limit {
+		_, _, next, ok := mxfKLV(r, pos)
+		if !ok || next <= pos || next > limit {
+			break
+		}
+		pos = next
+	}
+	return pos
+}
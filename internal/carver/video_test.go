@@ -0,0 +1,133 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// makeTS builds a transport stream of count packets, opening with the
+// program association table
+func makeTS(packet, count int) []byte {
+	var stream []byte
+	for i := 0; i < count; i++ {
+		p := bytes.Repeat([]byte{0xFF}, packet)
+		sync := tsSync(packet)
+		if sync > 0 {
+			binary.BigEndian.PutUint32(p, uint32(i*1000)) // Arrival timestamp
+		}
+		p[sync], p[sync+1], p[sync+2] = 0x47, 0x01, 0x00
+		if i == 0 {
+			p[sync+1] = 0x40
+		}
+		stream = append(stream, p...)
+	}
+	return stream
+}
+
+func TestTransportStreamSize(t *testing.T) {
+	for _, packet := range []int{tsPacketSize, m2tsPacketSize} {
+		stream := makeTS(packet, 700)
+		data := append(append([]byte{}, stream...), bytes.Repeat([]byte{0x00}, 5000)...)
+
+		if !verifyTS(packet)(stream) {
+			t.Errorf("Expected %d-byte packets to verify", packet)
+		}
+		if got := tsSizer(packet)(bytes.NewReader(data), int64(len(data))); got != int64(len(stream)) {
+			t.Errorf("Expected %d-byte packet stream of %d bytes, got %d", packet, len(stream), got)
+		}
+	}
+
+	// Packets of the other size fall out of step
+	if verifyTS(tsPacketSize)(makeTS(m2tsPacketSize, 10)[4:]) {
+		t.Error("Expected 192-byte packets not to verify as 188-byte ones")
+	}
+}
+
+// mxfPack builds a partition pack KLV of the given kind recording the
+// footer partition's offset
+func mxfPack(kind byte, footer int) []byte {
+	value := make([]byte, 88)
+	binary.BigEndian.PutUint16(value, 1)
+	binary.BigEndian.PutUint16(value[2:], 3)
+	binary.BigEndian.PutUint64(value[24:], uint64(footer))
+	return mxfItem(append(append([]byte{}, mxfPartitionKey...), kind, 0x04, 0x00), value)
+}
+
+// mxfItem builds a KLV with a 4-byte BER length
+func mxfItem(key, value []byte) []byte {
+	item := append(append([]byte{}, key...), 0x83, byte(len(value)>>16), byte(len(value)>>8), byte(len(value)))
+	return append(item, value...)
+}
+
+// makeMXF builds an MXF file of a header partition, essence and a footer
+// partition, recording the footer's offset when known
+func makeMXF(footerKnown bool) []byte {
+	essence := []byte{0x06, 0x0E, 0x2B, 0x34, 0x01, 0x02, 0x01, 0x01, 0x0D, 0x01, 0x03, 0x01, 0x15, 0x01, 0x05, 0x00}
+	var body []byte
+	for i := 0; i < 20; i++ {
+		body = append(body, mxfItem(essence, bytes.Repeat([]byte{byte(i)}, 1000))...)
+	}
+	header := mxfPack(0x02, 0)
+	footer := len(header) + len(body)
+	if footerKnown {
+		header = mxfPack(0x02, footer)
+	}
+	file := append(append(header, body...), mxfPack(0x04, footer)...)
+	return file
+}
+
+func TestMXFSize(t *testing.T) {
+	for _, known := range []bool{true, false} {
+		file := makeMXF(known)
+		data := append(append([]byte{}, file...), bytes.Repeat([]byte{0x11}, 4096)...)
+
+		if !verifyMXF(file) {
+			t.Fatal("Expected header partition to verify")
+		}
+		if got := mxfSize(bytes.NewReader(data), int64(len(data))); got != int64(len(file)) {
+			t.Errorf("Expected size %d (footer known %v), got %d", len(file), known, got)
+		}
+	}
+}
+
+func TestCarveCameraVideo(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "test.img")
+
+	m2ts := makeTS(m2tsPacketSize, 300)
+	mxf := makeMXF(true)
+
+	data := make([]byte, 256*1024)
+	copy(data[4096:], m2ts)
+	copy(data[128*1024:], mxf)
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reader, err := disk.Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	carver := NewCarver(reader)
+	carver.SetSignatures([]FileSignature{findSignature(t, "MTS"), findSignature(t, "TS"), findSignature(t, "MXF")})
+	files, err := carver.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(files) != 2 || files[0].Signature.Name != "MTS" || files[0].Offset != 4096 || files[1].Signature.Name != "MXF" {
+		t.Fatalf("Expected the MTS and MXF files, got %v", files)
+	}
+
+	for i, want := range []int{len(m2ts), len(mxf)} {
+		if _, size, err := carver.content(files[i]); err != nil || size != int64(want) {
+			t.Errorf("Expected %s of %d bytes, got %d (%v)", files[i].Signature.Name, want, size, err)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Cryptocurrency wallets hold the only copy of the keys to the funds they
+// control. Bitcoin Core's legacy wallet.dat is a Berkeley DB B-tree whose
+// records are keyed by type strings ("key", "ckey", "mkey", ...); Ethereum
+// clients keep each key in a JSON keystore; Electrum keeps its wallet as
+// JSON (encrypted to base64 when it has a password) and records hardware
+// wallets (Trezor, Ledger, Coldcard, ...) in its keystores.
+
+const (
+	bdbMetaSize  = 512
+	bdbBtreeMeta = 9 // Page type of a B-tree metadata page
+)
+
+// bdbMagic is the B-tree magic number at offset 12, little-endian
+var bdbMagic = []byte{0x62, 0x31, 0x05, 0x00}
+
+// walletRecords are the length-prefixed type strings that key wallet.dat records
+var walletRecords = []string{"\x07version", "\x0aminversion", "\x04name", "\x03key", "\x04ckey", "\x04mkey", "\x0adefaultkey", "\x04pool", "\x07keymeta", "\x07hdchain"}
+
+// verifyBDB checks a Berkeley DB B-tree metadata page's page size, version
+// and page type
+func verifyBDB(data []byte) bool {
+	if len(data) < 36 {
+		return false
+	}
+	version := binary.LittleEndian.Uint32(data[16:])
+	pageSize := binary.LittleEndian.Uint32(data[20:])
+	return version >= 8 && version <= 10 && pageSize >= 512 && pageSize <= 65536 &&
+		pageSize&(pageSize-1) == 0 && data[25] == bdbBtreeMeta
+}
+
+// bdbSize multiplies the page size by the last page number plus one
+func bdbSize(r io.ReaderAt, limit int64) int64 {
+	meta := make([]byte, 36)
+	if _, err := r.ReadAt(meta, 0); err != nil || !verifyBDB(meta) {
+		return 0
+	}
+	pageSize := int64(binary.LittleEndian.Uint32(meta[20:]))
+	size := (int64(binary.LittleEndian.Uint32(meta[32:])) + 1) * pageSize
+	if size > limit {
+		return 0
+	}
+	return size
+}
+
+// classifyBDB files Berkeley DB files holding at least two kinds of wallet
+// records as Bitcoin wallets
+func classifyBDB(r io.ReaderAt, size int64) (string, string) {
+	kinds := 0
+	for _, record := range walletRecords {
+		if readerIndex(r, size, []byte(record)) >= 0 {
+			kinds++
+		}
+		if kinds >= 2 {
+			return "BITCOIN-WALLET", ".dat"
+		}
+	}
+	return "", ""
+}
+
+// verifyKeystore looks for the fields of an encrypted key near the start of
+// an Ethereum keystore
+func verifyKeystore(data []byte) bool {
+	head := data[:min(int64(len(data)), 4096)]
+	for _, field := range []string{`"ciphertext"`, `"kdf"`, `"mac"`} {
+		if !bytes.Contains(head, []byte(field)) {
+			return false
+		}
+	}
+	return true
+}
+
+// keystoreMetadata reports the address a keystore holds the key for
+func keystoreMetadata(r io.ReaderAt, size int64) map[string]string {
+	var ks struct {
+		Address string `json:"address"`
+	}
+	if err := json.NewDecoder(io.NewSectionReader(r, 0, size)).Decode(&ks); err != nil || ks.Address == "" {
+		return nil
+	}
+	return map[string]string{"address": ks.Address}
+}
+
+// verifyBase64 checks that the data starts with a run of base64 characters
+func verifyBase64(data []byte) bool {
+	if len(data) < 64 {
+		return false
+	}
+	for _, b := range data[:64] {
+		if !(b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b == '+' || b == '/') {
+			return false
+		}
+	}
+	return true
+}
+
+// electrumMetadata reports the wallet type and any hardware wallets in the
+// keystores of an unencrypted Electrum wallet
+func electrumMetadata(r io.ReaderAt, size int64) map[string]string {
+	var wallet map[string]json.RawMessage
+	if err := json.NewDecoder(io.NewSectionReader(r, 0, size)).Decode(&wallet); err != nil {
+		return nil
+	}
+
+	meta := make(map[string]string)
+	var walletType string
+	if json.Unmarshal(wallet["wallet_type"], &walletType) == nil && walletType != "" {
+		meta["wallet_type"] = walletType
+	}
+
+	// Standard wallets have a "keystore", multisig ones "x1/", "x2/", ...
+	var hardware []string
+	for key, value := range wallet {
+		if key != "keystore" && !(strings.HasPrefix(key, "x") && strings.HasSuffix(key, "/")) {
+			continue
+		}
+		var ks struct {
+			HWType string `json:"hw_type"`
+		}
+		if json.Unmarshal(value, &ks) == nil && ks.HWType != "" {
+			hardware = append(hardware, ks.HWType)
+		}
+	}
+	if len(hardware) > 0 {
+		sort.Strings(hardware)
+		meta["hardware"] = strings.Join(hardware, ", ")
+	}
+	return meta
+}
+
+// jsonSize ends a JSON document after the brace that closes its top-level
+// object, skipping braces inside strings
+func jsonSize(r io.ReaderAt, limit int64) int64 {
+	buf := make([]byte, 64*1024)
+	depth := 0
+	inString, escaped := false, false
+	var pos int64
+	for pos < limit {
+		n, err := r.ReadAt(buf[:min(int64(len(buf)), limit-pos)], pos)
+		for i, b := range buf[:n] {
+			switch {
+			case escaped:
+				escaped = false
+			case inString:
+				escaped = b == '\\'
+				inString = b != '"'
+			case b == '"':
+				inString = true
+			case b == '{' || b == '[':
+				depth++
+			case b == '}' || b == ']':
+				depth--
+				if depth == 0 {
+					return pos + int64(i) + 1
+				}
+			case b == 0:
+				return 0 // Ran into something other than JSON
+			}
+		}
+		if n == 0 || (err != nil && err != io.EOF) {
+			break
+		}
+		pos += int64(n)
+	}
+	return 0
+}
@@ -0,0 +1,90 @@
+package carver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// makeBDB builds a Berkeley DB B-tree with a metadata page and pages more
+// 4096-byte pages, the first of which holds the given records
+func makeBDB(pages int, records ...string) []byte {
+	const pageSize = 4096
+	db := make([]byte, (pages+1)*pageSize)
+	copy(db[12:], bdbMagic)
+	binary.LittleEndian.PutUint32(db[16:], 9) // Version
+	binary.LittleEndian.PutUint32(db[20:], pageSize)
+	db[25] = bdbBtreeMeta
+	binary.LittleEndian.PutUint32(db[32:], uint32(pages)) // Last page number
+
+	pos := pageSize + 26
+	for _, record := range records {
+		pos += copy(db[pos:], record) + 8
+	}
+	return db
+}
+
+func TestBitcoinWallet(t *testing.T) {
+	wallet := makeBDB(3, "\x07version", "\x04name1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", "\x04ckey")
+	data := append(append([]byte{}, wallet...), bytes.Repeat([]byte{0xAA}, 8192)...)
+
+	if !verifyBDB(data) {
+		t.Fatal("Expected B-tree metadata page to verify")
+	}
+	if got := bdbSize(bytes.NewReader(data), int64(len(data))); got != int64(len(wallet)) {
+		t.Errorf("Expected size %d, got %d", len(wallet), got)
+	}
+	if name, ext := classifyBDB(bytes.NewReader(wallet), int64(len(wallet))); name != "BITCOIN-WALLET" || ext != ".dat" {
+		t.Errorf("Expected Bitcoin wallet, got %q, %q", name, ext)
+	}
+
+	other := makeBDB(1, "\x07version")
+	if name, _ := classifyBDB(bytes.NewReader(other), int64(len(other))); name != "" {
+		t.Errorf("Expected other Berkeley DB file to keep its type, got %q", name)
+	}
+
+	// Descriptor wallets are SQLite databases with the network's application ID
+	db := makeSQLite([]string{"main"})
+	binary.BigEndian.PutUint32(db[68:], 0xF9BEB4D9)
+	if name, _ := classifySQLite(bytes.NewReader(db), int64(len(db))); name != "BITCOIN-WALLET" {
+		t.Errorf("Expected SQLite Bitcoin wallet, got %q", name)
+	}
+}
+
+func TestEthereumKeystore(t *testing.T) {
+	keystore := []byte(`{"address":"008aeeda4d805471df9b2a5b0f38a0c3bcba786b","crypto":{"cipher":"aes-128-ctr","ciphertext":"5318b4d5bcd28de64ee5559e671353e16f075ecae9f99c7a79a38af5f869aa46","cipherparams":{"iv":"6087dab2f9fdbbfaddc31a909735c1e6"},"kdf":"scrypt","kdfparams":{"dklen":32,"n":262144,"p":8,"r":1,"salt":"ab0c7876052600dd703518d6fc3fe8984592145b591fc8fb5c6d43190334ba19"},"mac":"517ead924a9d0dc3124507e3393d175ce3ff7c1e96529c6c555ce9e51205e9b2"},"id":"3198bc9c-6672-5ab3-d995-4942343ae5b6","version":3}`)
+	data := append(append([]byte{}, keystore...), make([]byte, 512)...)
+
+	if !verifyKeystore(data) {
+		t.Fatal("Expected keystore to verify")
+	}
+	if verifyKeystore([]byte(`{"address":"008aeeda4d805471df9b2a5b0f38a0c3bcba786b","balance":"0"}`)) {
+		t.Error("Expected JSON without an encrypted key to be rejected")
+	}
+	if got := jsonSize(bytes.NewReader(data), int64(len(data))); got != int64(len(keystore)) {
+		t.Errorf("Expected size %d, got %d", len(keystore), got)
+	}
+	if meta := keystoreMetadata(bytes.NewReader(keystore), int64(len(keystore))); meta["address"] != "008aeeda4d805471df9b2a5b0f38a0c3bcba786b" {
+		t.Errorf("Unexpected metadata %v", meta)
+	}
+}
+
+func TestElectrumWallet(t *testing.T) {
+	wallet := []byte("{\n    \"addr_history\": {},\n    \"keystore\": {\n        \"hw_type\": \"trezor\",\n        \"label\": \"{my} \\\"trezor\\\"\",\n        \"type\": \"hardware\"\n    },\n    \"seed_version\": 18,\n    \"wallet_type\": \"standard\"\n}")
+	data := append(append([]byte{}, wallet...), make([]byte, 100)...)
+
+	if got := jsonSize(bytes.NewReader(data), int64(len(data))); got != int64(len(wallet)) {
+		t.Errorf("Expected size %d, got %d", len(wallet), got)
+	}
+	meta := electrumMetadata(bytes.NewReader(wallet), int64(len(wallet)))
+	if meta["wallet_type"] != "standard" || meta["hardware"] != "trezor" {
+		t.Errorf("Unexpected metadata %v", meta)
+	}
+
+	if !verifyBase64(bytes.Repeat([]byte("QklFMQ"), 20)) {
+		t.Error("Expected base64 wallet to verify")
+	}
+	if got := jsonSize(bytes.NewReader(wallet[:40]), 40); got != 0 {
+		t.Errorf("Expected unknown size for a truncated wallet, got %d", got)
+	}
+}
@@ -0,0 +1,220 @@
+package carver
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// Office Open XML, OpenDocument, EPUB, JAR and APK files are all ZIP
+// archives starting with the same local file header, so they are carved by a
+// single signature and told apart afterwards by the entries they contain.
+
+const (
+	zipLocalHeaderLen = 30
+	zipEOCDLen        = 22
+	zipMaxEntries     = 64      // Local headers examined when the central directory is missing
+	zipMaxPeek        = 1 << 20 // Largest [Content_Types].xml or mimetype entry read
+	zipUnpackLimit    = 1 << 28 // Bound on the entries unpacked for recursive carving
+	zipUnpackAlign    = 4096
+)
+
+var (
+	zipLocalSig   = []byte("PK\x03\x04")
+	zipEOCDSig    = []byte("PK\x05\x06")
+	zip64LocSig   = []byte("PK\x06\x07")
+	zipTypeByMime = map[string][2]string{
+		"application/vnd.oasis.opendocument.text":         {"ODT", ".odt"},
+		"application/vnd.oasis.opendocument.spreadsheet":  {"ODS", ".ods"},
+		"application/vnd.oasis.opendocument.presentation": {"ODP", ".odp"},
+		"application/epub+zip":                            {"EPUB", ".epub"},
+	}
+)
+
+// zipSize searches for the end of central directory record whose directory
+// ends right before it, which marks the end of the archive
+func zipSize(r io.ReaderAt, limit int64) int64 {
+	buf := make([]byte, 64*1024+zipEOCDLen)
+	var pos int64
+	for pos < limit {
+		n, err := r.ReadAt(buf[:min(int64(len(buf)), limit-pos)], pos)
+		if n == 0 || (err != nil && err != io.EOF) {
+			break
+		}
+
+		for i := 0; ; i++ {
+			idx := bytes.Index(buf[i:n], zipEOCDSig)
+			if idx < 0 {
+				break
+			}
+			i += idx
+			if end := zipEOCDEnd(r, pos+int64(i), limit); end > 0 {
+				return end
+			}
+		}
+
+		if n < len(buf) {
+			break
+		}
+		pos += int64(n - (zipEOCDLen - 1))
+	}
+	return 0
+}
+
+// zipEOCDEnd checks the end of central directory record at off and returns
+// the end of the archive, or 0 if the record does not close this archive
+func zipEOCDEnd(r io.ReaderAt, off, limit int64) int64 {
+	var eocd [zipEOCDLen]byte
+	if off+zipEOCDLen > limit {
+		return 0
+	}
+	if _, err := r.ReadAt(eocd[:], off); err != nil {
+		return 0
+	}
+	cdSize := int64(binary.LittleEndian.Uint32(eocd[12:16]))
+	cdOffset := int64(binary.LittleEndian.Uint32(eocd[16:20]))
+	end := off + zipEOCDLen + int64(binary.LittleEndian.Uint16(eocd[20:22]))
+
+	if cdOffset == 0xFFFFFFFF {
+		// ZIP64: the real offsets live in the ZIP64 record, located just before
+		var loc [4]byte
+		if off < 20 {
+			return 0
+		}
+		if _, err := r.ReadAt(loc[:], off-20); err != nil || !bytes.Equal(loc[:], zip64LocSig) {
+			return 0
+		}
+		return min(end, limit)
+	}
+
+	if cdOffset+cdSize != off {
+		return 0
+	}
+	return min(end, limit)
+}
+
+// classifyZIP returns the name and extension of the ZIP-based format a carved archive
+// holds, from its [Content_Types].xml, mimetype entry or entry names
+func classifyZIP(r io.ReaderAt, size int64) (string, string) {
+	names, peek := zipEntries(r, size)
+
+	if format, ok := zipTypeByMime[strings.TrimSpace(string(peek["mimetype"]))]; ok {
+		return format[0], format[1]
+	}
+	if ct := string(peek["[Content_Types].xml"]); ct != "" {
+		switch {
+		case strings.Contains(ct, "wordprocessingml"):
+			return "DOCX", ".docx"
+		case strings.Contains(ct, "spreadsheetml"):
+			return "XLSX", ".xlsx"
+		case strings.Contains(ct, "presentationml"):
+			return "PPTX", ".pptx"
+		}
+	}
+
+	for _, name := range names {
+		switch {
+		case strings.HasPrefix(name, "word/"):
+			return "DOCX", ".docx"
+		case strings.HasPrefix(name, "xl/"):
+			return "XLSX", ".xlsx"
+		case strings.HasPrefix(name, "ppt/"):
+			return "PPTX", ".pptx"
+		case name == "AndroidManifest.xml":
+			return "APK", ".apk"
+		}
+	}
+	for _, name := range names {
+		if name == "META-INF/MANIFEST.MF" {
+			return "JAR", ".jar"
+		}
+	}
+	return "", ""
+}
+
+// zipEntries lists the entry names of an archive and the contents of the
+// entries used for classification. The central directory is used when it is
+// intact; otherwise the local file headers are walked from the start.
+func zipEntries(r io.ReaderAt, size int64) ([]string, map[string][]byte) {
+	peek := make(map[string][]byte)
+	var names []string
+
+	if zr, err := zip.NewReader(r, size); err == nil {
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+			if f.Name == "mimetype" || f.Name == "[Content_Types].xml" {
+				if rc, err := f.Open(); err == nil {
+					peek[f.Name], _ = io.ReadAll(io.LimitReader(rc, zipMaxPeek))
+					rc.Close()
+				}
+			}
+		}
+		return names, peek
+	}
+
+	var hdr [zipLocalHeaderLen]byte
+	var pos int64
+	for len(names) < zipMaxEntries && pos+zipLocalHeaderLen <= size {
+		if _, err := r.ReadAt(hdr[:], pos); err != nil || !bytes.Equal(hdr[:4], zipLocalSig) {
+			break
+		}
+		flags := binary.LittleEndian.Uint16(hdr[6:8])
+		method := binary.LittleEndian.Uint16(hdr[8:10])
+		compSize := int64(binary.LittleEndian.Uint32(hdr[18:22]))
+		nameLen := int64(binary.LittleEndian.Uint16(hdr[26:28]))
+		extraLen := int64(binary.LittleEndian.Uint16(hdr[28:30]))
+
+		name := make([]byte, nameLen)
+		if _, err := r.ReadAt(name, pos+zipLocalHeaderLen); err != nil {
+			break
+		}
+		names = append(names, string(name))
+
+		dataOff := pos + zipLocalHeaderLen + nameLen + extraLen
+		if string(name) == "mimetype" && method == zip.Store && compSize <= zipMaxPeek {
+			data := make([]byte, compSize)
+			if _, err := r.ReadAt(data, dataOff); err == nil {
+				peek["mimetype"] = data
+			}
+		}
+
+		// Sizes are only in a trailing data descriptor; the next header cannot be found
+		if flags&0x08 != 0 {
+			break
+		}
+		pos = dataOff + compSize
+	}
+	return names, peek
+}
+
+// zipOpen unpacks the entries of an archive one after another, each from a
+// 4KB boundary, so that recursive carving finds the files inside it as it
+// would on a disk. Entries that do not fit in zipUnpackLimit are left out;
+// a damaged entry keeps what could be inflated.
+func zipOpen(r io.ReaderAt, size int64) (io.ReaderAt, int64) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, 0
+	}
+	var buf bytes.Buffer
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || f.UncompressedSize64 == 0 || uint64(buf.Len())+f.UncompressedSize64 > zipUnpackLimit {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			continue
+		}
+		io.Copy(&buf, io.LimitReader(rc, int64(f.UncompressedSize64)))
+		rc.Close()
+		if pad := buf.Len() % zipUnpackAlign; pad > 0 {
+			buf.Write(make([]byte, zipUnpackAlign-pad))
+		}
+	}
+	if buf.Len() == 0 {
+		return nil, 0
+	}
+	return bytes.NewReader(buf.Bytes()), int64(buf.Len())
+}
@@ -0,0 +1,78 @@
+package carver
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+// makeArchive builds a ZIP with the given entries, storing them uncompressed
+// when store is set (as OpenDocument requires for mimetype)
+func makeArchive(t *testing.T, store bool, entries ...[2]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e[0], Method: zip.Deflate}
+		if store {
+			hdr.Method = zip.Store
+		}
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatalf("Failed to create entry: %v", err)
+		}
+		w.Write([]byte(e[1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close archive: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestClassifyZIP(t *testing.T) {
+	contentTypes := func(kind string) [2]string {
+		return [2]string{"[Content_Types].xml", `<Types><Override ContentType="application/vnd.openxmlformats-officedocument.` + kind + `+xml"/></Types>`}
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"docx", makeArchive(t, false, contentTypes("wordprocessingml.document.main"), [2]string{"word/document.xml", "<w/>"}), ".docx"},
+		{"xlsx", makeArchive(t, false, contentTypes("spreadsheetml.sheet.main"), [2]string{"xl/workbook.xml", "<x/>"}), ".xlsx"},
+		{"pptx", makeArchive(t, false, contentTypes("presentationml.presentation.main")), ".pptx"},
+		{"odt", makeArchive(t, true, [2]string{"mimetype", "application/vnd.oasis.opendocument.text"}), ".odt"},
+		{"jar", makeArchive(t, false, [2]string{"META-INF/MANIFEST.MF", "Manifest-Version: 1.0"}), ".jar"},
+		{"zip", makeArchive(t, false, [2]string{"notes.txt", "hello"}), ""},
+	}
+
+	for _, tt := range tests {
+		if _, got := classifyZIP(bytes.NewReader(tt.data), int64(len(tt.data))); got != tt.want {
+			t.Errorf("%s: classifyZIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// Without the central directory the local headers are walked instead
+	xlsx := makeArchive(t, true, [2]string{"xl/workbook.xml", "<x/>"}, [2]string{"xl/styles.xml", "<s/>"})
+	truncated := xlsx[:bytes.Index(xlsx, []byte("PK\x01\x02"))]
+	if name, ext := classifyZIP(bytes.NewReader(truncated), int64(len(truncated))); name != "XLSX" || ext != ".xlsx" {
+		t.Errorf("Truncated xlsx: classifyZIP = %q, %q, want XLSX, .xlsx", name, ext)
+	}
+}
+
+func TestZIPSize(t *testing.T) {
+	archive := makeArchive(t, false, [2]string{"a.txt", "first"}, [2]string{"b.txt", "second"})
+	data := append(append([]byte{}, archive...), bytes.Repeat([]byte{0x77}, 4096)...)
+
+	if got := zipSize(bytes.NewReader(data), int64(len(data))); got != int64(len(archive)) {
+		t.Errorf("Expected size %d, got %d", len(archive), got)
+	}
+
+	// An end record that does not close this archive's directory is ignored
+	stray := append([]byte("PK\x03\x04"), make([]byte, 100)...)
+	stray = append(stray, "PK\x05\x06"...)
+	stray = append(stray, make([]byte, 200)...)
+	if got := zipSize(bytes.NewReader(stray), int64(len(stray))); got != 0 {
+		t.Errorf("Expected unknown size for stray end record, got %d", got)
+	}
+}
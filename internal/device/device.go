@@ -3,8 +3,12 @@ package device
 import (
 	"bufio"
 	"bytes"
+	"cmp"
+	"encoding/json"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -19,9 +23,20 @@ type Device struct {
 	Filesystem string
 	Mountpoint string
 	Removable  bool
+	Type       string // TypeDisk, TypePartition, or another kind lsblk reports, such as "loop" or "rom"
+	Parent     string // Path of the disk a partition is on; "" for a disk
+	Model      string // Of the drive, for its partitions too; "" when the system does not say
+	Serial     string
 }
 
-// List returns available storage devices
+// Types of devices
+const (
+	TypeDisk      = "disk"
+	TypePartition = "part"
+)
+
+// List returns available storage devices: the drives, each followed by
+// its partitions
 func List() ([]Device, error) {
 	switch runtime.GOOS {
 	case "darwin":
@@ -35,6 +50,168 @@ func List() ([]Device, error) {
 	}
 }
 
+// Serial returns the serial number of the drive a device path is on, or ""
+// when it is not known, as for image files. Only Linux reports it.
+func Serial(path string) string {
+	if runtime.GOOS != "linux" || !strings.HasPrefix(path, "/dev/") {
+		return ""
+	}
+	lsblk := func(column, path string) string {
+		out, err := exec.Command("lsblk", "-ndo", column, path).Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(out))
+	}
+	if serial := lsblk("SERIAL", path); serial != "" {
+		return serial
+	}
+	// Partitions have theirs on the disk they belong to
+	if parent := lsblk("PKNAME", path); parent != "" {
+		return lsblk("SERIAL", "/dev/"+parent)
+	}
+	return ""
+}
+
+// FreeSpace returns the bytes free for the current user on the filesystem
+// that holds path, or the nearest directory above it that exists
+func FreeSpace(path string) (int64, error) {
+	path, err := existing(path)
+	if err != nil {
+		return 0, err
+	}
+	switch runtime.GOOS {
+	case "darwin", "linux", "freebsd", "openbsd", "netbsd":
+		fields, err := df(path)
+		if err != nil {
+			return 0, err
+		}
+		kb, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("unexpected df output %q", strings.Join(fields, " "))
+		}
+		return kb * 1024, nil
+	case "windows":
+		out, err := exec.Command("powershell", "-Command",
+			"(Get-Item -LiteralPath '"+strings.ReplaceAll(path, "'", "''")+"').PSDrive.Free").Output()
+		if err != nil {
+			return 0, fmt.Errorf("failed to query free space: %w", err)
+		}
+		return strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	default:
+		return 0, fmt.Errorf("unsupported OS: %s", runtime.GOOS)
+	}
+}
+
+// OnDevice reports whether path, or the nearest directory above it that
+// exists, is on the device a device path names: on the partition itself,
+// on a partition of the disk, or on the disk a partition belongs to. An
+// image file is not a device, and nothing is on it.
+func OnDevice(path, device string) (bool, error) {
+	info, err := os.Stat(device)
+	if err != nil {
+		return false, err
+	}
+	if info.Mode().IsRegular() {
+		return false, nil
+	}
+	if path, err = existing(path); err != nil {
+		return false, err
+	}
+
+	switch runtime.GOOS {
+	case "darwin", "linux", "freebsd", "openbsd", "netbsd":
+		fields, err := df(path)
+		if err != nil {
+			return false, err
+		}
+		fs := fields[0]
+		if !strings.HasPrefix(fs, "/dev/") {
+			return false, nil // tmpfs, a network share, ...
+		}
+		fs, device = resolveDevice(fs), resolveDevice(device)
+		return fs == device || parentDisk(fs) == device || fs == parentDisk(device), nil
+	case "windows":
+		letter := strings.TrimSuffix(filepath.VolumeName(path), ":")
+		target := strings.TrimPrefix(strings.ToUpper(device), `\\.\`)
+		if len(letter) != 1 {
+			return false, nil // A UNC share
+		}
+		if strings.TrimSuffix(target, ":") == strings.ToUpper(letter) {
+			return true, nil
+		}
+		if !strings.HasPrefix(target, "PHYSICALDRIVE") {
+			return false, nil
+		}
+		out, err := exec.Command("powershell", "-Command",
+			"(Get-Partition -DriveLetter "+letter+").DiskNumber").Output()
+		if err != nil {
+			return false, fmt.Errorf("failed to query the disk of %s: %w", letter, err)
+		}
+		return strings.TrimSpace(string(out)) == strings.TrimPrefix(target, "PHYSICALDRIVE"), nil
+	default:
+		return false, fmt.Errorf("unsupported OS: %s", runtime.GOOS)
+	}
+}
+
+// existing returns the absolute form of path, or of the nearest directory
+// above it that exists
+func existing(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(path); err == nil || filepath.Dir(path) == path {
+			return path, nil
+		}
+		path = filepath.Dir(path)
+	}
+}
+
+// df returns the fields df reports for the filesystem that holds path:
+// Filesystem 1024-blocks Used Available Capacity Mounted on
+func df(path string) ([]string, error) {
+	out, err := exec.Command("df", "-Pk", path).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run df: %w", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(lines) < 2 || len(fields) < 6 {
+		return nil, fmt.Errorf("unexpected df output %q", out)
+	}
+	return fields, nil
+}
+
+// resolveDevice returns the device node a device path leads to, through
+// links such as /dev/disk/by-id, and the block device of a macOS raw one
+func resolveDevice(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return strings.Replace(path, "/dev/rdisk", "/dev/disk", 1)
+}
+
+// parentDisk returns the disk a partition belongs to, or "" for a disk
+func parentDisk(path string) string {
+	switch runtime.GOOS {
+	case "linux":
+		out, err := exec.Command("lsblk", "-ndo", "PKNAME", path).Output()
+		if parent := strings.TrimSpace(string(out)); err == nil && parent != "" {
+			return "/dev/" + parent
+		}
+	case "darwin":
+		// disk2s1 is the first partition of disk2
+		if name, ok := strings.CutPrefix(path, "/dev/disk"); ok {
+			if i := strings.IndexByte(name, 's'); i > 0 {
+				return "/dev/disk" + name[:i]
+			}
+		}
+	}
+	return ""
+}
+
 func listDarwin() ([]Device, error) {
 	cmd := exec.Command("diskutil", "list", "-plist")
 	output, err := cmd.Output()
@@ -56,16 +233,13 @@ func listDarwinSimple() ([]Device, error) {
 	var devices []Device
 	scanner := bufio.NewScanner(bytes.NewReader(output))
 
-	var currentDisk string
+	var internal bool // The disk being listed, from "/dev/disk0 (internal, physical):"
 	for scanner.Scan() {
 		line := scanner.Text()
 
 		// Main disk line: /dev/disk0 (internal):
 		if strings.HasPrefix(line, "/dev/disk") {
-			parts := strings.Fields(line)
-			if len(parts) >= 1 {
-				currentDisk = strings.TrimSuffix(parts[0], ":")
-			}
+			internal = strings.Contains(line, "(internal")
 			continue
 		}
 
@@ -133,14 +307,19 @@ func listDarwinSimple() ([]Device, error) {
 			name = deviceID
 		}
 
-		devices = append(devices, Device{
+		d := Device{
 			Path:       "/dev/" + deviceID,
 			Name:       name,
 			Size:       sizeBytes,
 			SizeHuman:  sizeStr,
 			Filesystem: fsType,
-			Removable:  !strings.Contains(currentDisk, "internal"),
-		})
+			Removable:  !internal,
+			Type:       TypeDisk,
+		}
+		if parent := parentDisk(d.Path); parent != "" {
+			d.Type, d.Parent = TypePartition, parent
+		}
+		devices = append(devices, d)
 	}
 
 	// Also add the raw disk devices
@@ -151,87 +330,143 @@ func listDarwinSimple() ([]Device, error) {
 }
 
 func listLinux() ([]Device, error) {
-	cmd := exec.Command("lsblk", "-b", "-o", "NAME,SIZE,FSTYPE,MOUNTPOINT,RM", "-n", "-l")
-	output, err := cmd.Output()
+	out, err := exec.Command("lsblk", "-b", "-J", "-l", "-o", "NAME,SIZE,FSTYPE,MOUNTPOINT,RM,MODEL,SERIAL,TYPE,PKNAME").Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to run lsblk: %w", err)
 	}
+	return parseLsblk(out)
+}
 
-	var devices []Device
-	scanner := bufio.NewScanner(bytes.NewReader(output))
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.Fields(line)
-		if len(parts) < 2 {
-			continue
-		}
-
-		name := parts[0]
-		sizeBytes, _ := strconv.ParseInt(parts[1], 10, 64)
-
-		fsType := ""
-		if len(parts) >= 3 {
-			fsType = parts[2]
+// lsblkValue is a column of lsblk's JSON, which versions before 2.33 give
+// as strings, numbers in quotes and "1" for true, and later ones as null,
+// numbers and booleans
+type lsblkValue string
+
+func (v *lsblkValue) UnmarshalJSON(data []byte) error {
+	switch s := string(data); {
+	case s == "null":
+		*v = ""
+	case s == "true":
+		*v = "1"
+	case s == "false":
+		*v = "0"
+	case strings.HasPrefix(s, `"`):
+		var str string
+		if err := json.Unmarshal(data, &str); err != nil {
+			return err
 		}
+		*v = lsblkValue(strings.TrimSpace(str))
+	default:
+		*v = lsblkValue(s)
+	}
+	return nil
+}
 
-		mountpoint := ""
-		if len(parts) >= 4 {
-			mountpoint = parts[3]
+// parseLsblk parses the output of lsblk -b -J -l, giving partitions the
+// model and serial number of their disk
+func parseLsblk(data []byte) ([]Device, error) {
+	var out struct {
+		Blockdevices []map[string]lsblkValue `json:"blockdevices"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("unexpected lsblk output: %w", err)
+	}
+	var devices []Device
+	byName := make(map[string]Device)
+	for _, b := range out.Blockdevices {
+		size, _ := strconv.ParseInt(string(b["size"]), 10, 64)
+		d := Device{
+			Path:       "/dev/" + string(b["name"]),
+			Name:       string(b["name"]),
+			Size:       size,
+			SizeHuman:  humanSize(size),
+			Filesystem: string(b["fstype"]),
+			Mountpoint: string(b["mountpoint"]),
+			Removable:  b["rm"] == "1",
+			Type:       string(b["type"]),
+			Model:      string(b["model"]),
+			Serial:     string(b["serial"]),
 		}
-
-		removable := false
-		if len(parts) >= 5 {
-			removable = parts[4] == "1"
+		if parent, ok := byName[string(b["pkname"])]; ok {
+			d.Parent = parent.Path
+			d.Model = cmp.Or(d.Model, parent.Model)
+			d.Serial = cmp.Or(d.Serial, parent.Serial)
 		}
-
-		devices = append(devices, Device{
-			Path:       "/dev/" + name,
-			Name:       name,
-			Size:       sizeBytes,
-			SizeHuman:  humanSize(sizeBytes),
-			Filesystem: fsType,
-			Mountpoint: mountpoint,
-			Removable:  removable,
-		})
+		devices = append(devices, d)
+		byName[d.Name] = d
 	}
-
 	return devices, nil
 }
 
+// windowsQuery lists the disks and partitions of Windows as JSON, drive
+// letters as strings
+const windowsQuery = `@{
+  disks = @(Get-Disk | Select-Object Number,FriendlyName,Model,SerialNumber,Size,BusType);
+  partitions = @(Get-Partition | Select-Object DiskNumber,PartitionNumber,Size,
+    @{n='DriveLetter';e={[string]$_.DriveLetter}},
+    @{n='FileSystem';e={($_ | Get-Volume -ErrorAction SilentlyContinue).FileSystem}})
+} | ConvertTo-Json -Depth 3`
+
 func listWindows() ([]Device, error) {
-	cmd := exec.Command("powershell", "-Command",
-		"Get-Disk | Select-Object Number,FriendlyName,Size,PartitionStyle | ConvertTo-Json")
-	output, err := cmd.Output()
+	out, err := exec.Command("powershell", "-NoProfile", "-Command", windowsQuery).Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to run Get-Disk: %w", err)
 	}
+	return parseWindows(out)
+}
 
-	// Simple parsing - in production you'd use proper JSON parsing
+// parseWindows parses the output of windowsQuery. Partitions are listed by
+// their drive letters, opened as \\.\X:; those without one are read
+// through their disk.
+func parseWindows(data []byte) ([]Device, error) {
+	var out struct {
+		Disks []struct {
+			Number       int
+			FriendlyName string
+			Model        string
+			SerialNumber string
+			Size         int64
+			BusType      string
+		}
+		Partitions []struct {
+			DiskNumber      int
+			PartitionNumber int
+			Size            int64
+			DriveLetter     string
+			FileSystem      string
+		}
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("unexpected Get-Disk output: %w", err)
+	}
 	var devices []Device
-	lines := strings.Split(string(output), "\n")
-	for i, line := range lines {
-		if strings.Contains(line, "Number") {
-			// Extract disk number
-			numStr := strings.TrimSpace(strings.Split(line, ":")[1])
-			numStr = strings.Trim(numStr, ",")
-			num, _ := strconv.Atoi(numStr)
-
-			// Get name from next line
-			name := "Unknown"
-			if i+1 < len(lines) && strings.Contains(lines[i+1], "FriendlyName") {
-				name = strings.TrimSpace(strings.Split(lines[i+1], ":")[1])
-				name = strings.Trim(name, `",`)
+	for _, d := range out.Disks {
+		disk := Device{
+			Path:      fmt.Sprintf(`\\.\PhysicalDrive%d`, d.Number),
+			Name:      d.FriendlyName,
+			Size:      d.Size,
+			SizeHuman: humanSize(d.Size),
+			Removable: d.BusType == "USB" || d.BusType == "SD" || d.BusType == "MMC",
+			Type:      TypeDisk,
+			Model:     strings.TrimSpace(d.Model),
+			Serial:    strings.TrimSpace(d.SerialNumber),
+		}
+		devices = append(devices, disk)
+		for _, p := range out.Partitions {
+			letter := strings.Trim(p.DriveLetter, "\x00 ")
+			if p.DiskNumber != d.Number || letter == "" {
+				continue
 			}
-
-			devices = append(devices, Device{
-				Path:      fmt.Sprintf(`\\.\PhysicalDrive%d`, num),
-				Name:      name,
-				SizeHuman: "Unknown",
-			})
+			part := disk
+			part.Path = `\\.\` + letter + ":"
+			part.Name = fmt.Sprintf("Disk %d partition %d", d.Number, p.PartitionNumber)
+			part.Size, part.SizeHuman = p.Size, humanSize(p.Size)
+			part.Filesystem = p.FileSystem
+			part.Mountpoint = letter + `:\`
+			part.Type, part.Parent = TypePartition, disk.Path
+			devices = append(devices, part)
 		}
 	}
-
 	return devices, nil
 }
 
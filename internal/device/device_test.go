@@ -0,0 +1,74 @@
+package device
+
+import "testing"
+
+func TestParseLsblk(t *testing.T) {
+	// lsblk 2.38; 2.32 gives every value as a string
+	for name, out := range map[string]string{
+		"current": `{"blockdevices": [
+			{"name":"sda","size":500107862016,"fstype":null,"mountpoint":null,"rm":false,"model":"Samsung SSD 860","serial":"S3Z9NB0K123456","type":"disk","pkname":null},
+			{"name":"sda1","size":536870912,"fstype":"vfat","mountpoint":"/boot/efi","rm":false,"model":null,"serial":null,"type":"part","pkname":"sda"},
+			{"name":"sdb","size":31914983424,"fstype":null,"mountpoint":null,"rm":true,"model":"Cruzer Blade","serial":"4C530001","type":"disk","pkname":null},
+			{"name":"sdb1","size":31913934848,"fstype":"ntfs","mountpoint":null,"rm":true,"model":null,"serial":null,"type":"part","pkname":"sdb"}
+		]}`,
+		"old": `{"blockdevices": [
+			{"name":"sda","size":"500107862016","fstype":null,"mountpoint":null,"rm":"0","model":"Samsung SSD 860 ","serial":"S3Z9NB0K123456","type":"disk","pkname":null},
+			{"name":"sda1","size":"536870912","fstype":"vfat","mountpoint":"/boot/efi","rm":"0","model":null,"serial":null,"type":"part","pkname":"sda"},
+			{"name":"sdb","size":"31914983424","fstype":null,"mountpoint":null,"rm":"1","model":"Cruzer Blade","serial":"4C530001","type":"disk","pkname":null},
+			{"name":"sdb1","size":"31913934848","fstype":"ntfs","mountpoint":null,"rm":"1","model":null,"serial":null,"type":"part","pkname":"sdb"}
+		]}`,
+	} {
+		devices, err := parseLsblk([]byte(out))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(devices) != 4 {
+			t.Fatalf("%s: expected 4 devices, got %+v", name, devices)
+		}
+		sda, efi, usb := devices[0], devices[1], devices[3]
+		if sda.Path != "/dev/sda" || sda.Type != TypeDisk || sda.Size != 500107862016 || sda.Model != "Samsung SSD 860" || sda.Removable {
+			t.Errorf("%s: unexpected disk %+v", name, sda)
+		}
+		if efi.Type != TypePartition || efi.Parent != "/dev/sda" || efi.Mountpoint != "/boot/efi" || efi.Filesystem != "vfat" {
+			t.Errorf("%s: unexpected partition %+v", name, efi)
+		}
+		// A partition has the model and serial number of its disk
+		if usb.Serial != "4C530001" || usb.Model != "Cruzer Blade" || !usb.Removable || usb.Mountpoint != "" {
+			t.Errorf("%s: unexpected partition %+v", name, usb)
+		}
+	}
+
+	if _, err := parseLsblk([]byte("NAME SIZE\nsda 1")); err == nil {
+		t.Error("Expected an error for output that is not JSON")
+	}
+}
+
+func TestParseWindows(t *testing.T) {
+	out := `{
+		"disks": [
+			{"Number": 0, "FriendlyName": "NVMe SSD", "Model": "NVMe SSD", "SerialNumber": "0025_38B1 ", "Size": 512110190592, "BusType": "NVMe"},
+			{"Number": 1, "FriendlyName": "SanDisk Ultra", "Model": "Ultra", "SerialNumber": "4C5300", "Size": 31914983424, "BusType": "USB"}
+		],
+		"partitions": [
+			{"DiskNumber": 0, "PartitionNumber": 1, "Size": 104857600, "DriveLetter": "\u0000", "FileSystem": "FAT32"},
+			{"DiskNumber": 0, "PartitionNumber": 2, "Size": 511000000000, "DriveLetter": "C", "FileSystem": "NTFS"},
+			{"DiskNumber": 1, "PartitionNumber": 1, "Size": 31913934848, "DriveLetter": "E", "FileSystem": null}
+		]
+	}`
+	devices, err := parseWindows([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 4 {
+		t.Fatalf("Expected 2 disks and their 2 partitions with drive letters, got %+v", devices)
+	}
+	if d := devices[0]; d.Path != `\\.\PhysicalDrive0` || d.Serial != "0025_38B1" || d.Removable || d.Type != TypeDisk {
+		t.Errorf("Unexpected disk %+v", d)
+	}
+	if c := devices[1]; c.Path != `\\.\C:` || c.Parent != `\\.\PhysicalDrive0` || c.Filesystem != "NTFS" || c.Mountpoint != `C:\` || c.Type != TypePartition {
+		t.Errorf("Unexpected partition %+v", c)
+	}
+	if e := devices[3]; e.Path != `\\.\E:` || !e.Removable || e.Serial != "4C5300" {
+		t.Errorf("Unexpected removable partition %+v", e)
+	}
+}
@@ -0,0 +1,114 @@
+package disk
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// An audit log records every read of a disk, so that what a run examined
+// can be shown and reproduced, and that it only ever read. Reads are
+// tagged with the purpose set when they were made, and a read that carries
+// on where the last one of the same purpose ended is merged into it, so
+// a scan of the whole disk is one line rather than a line per block:
+//
+//	time                                 offset    length      purpose
+//	2024-03-01T10:15:02.118734Z          0         4096        filesystem detection
+//	2024-03-01T10:15:02.119020Z          0         8589934592  carving scan
+//
+// Offsets are on the disk opened, also for reads of its partitions.
+
+// AuditFile is the audit log written below the output directory
+const AuditFile = "audit.tsv"
+
+// AuditHeader is the first line of an audit log
+const AuditHeader = "time\toffset\tlength\tpurpose"
+
+// auditLog is the audit log a disk and its partitions share
+type auditLog struct {
+	mu      sync.Mutex
+	w       io.Writer
+	purpose string
+	pending auditRegion // Not written yet, as the next read may extend it
+	err     error       // First write error
+}
+
+type auditRegion struct {
+	time        time.Time
+	offset, end int64
+	purpose     string
+}
+
+// Audit starts recording every read of the disk, and of readers of its
+// partitions made after, to w
+func (r *Reader) Audit(w io.Writer) error {
+	r.audit, r.audited = &auditLog{w: w}, true
+	_, err := fmt.Fprintln(w, AuditHeader)
+	return err
+}
+
+// Purpose tags the reads that follow in the audit log with purpose, until
+// the function it returns restores the previous one. It does nothing when
+// the disk is not audited.
+func (r *Reader) Purpose(purpose string) func() {
+	a := r.audit
+	if a == nil {
+		return func() {}
+	}
+	a.mu.Lock()
+	previous := a.purpose
+	a.purpose = purpose
+	a.mu.Unlock()
+	return func() {
+		a.mu.Lock()
+		a.purpose = previous
+		a.mu.Unlock()
+	}
+}
+
+// FlushAudit writes the read the audit log holds back and returns the first
+// error writing the log met
+func (r *Reader) FlushAudit() error {
+	a := r.audit
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.flush()
+	return a.err
+}
+
+// record logs a read of n bytes at offset
+func (a *auditLog) record(offset int64, n int) {
+	if n <= 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	p := &a.pending
+	if p.end == offset && p.purpose == a.purpose && !p.time.IsZero() {
+		p.end += int64(n)
+		return
+	}
+	a.flush()
+	a.pending = auditRegion{time: time.Now().UTC(), offset: offset, end: offset + int64(n), purpose: a.purpose}
+}
+
+// flush writes the pending read
+func (a *auditLog) flush() {
+	p := a.pending
+	if p.time.IsZero() {
+		return
+	}
+	a.pending = auditRegion{}
+	purpose := p.purpose
+	if purpose == "" {
+		purpose = "-"
+	}
+	_, err := fmt.Fprintf(a.w, "%s\t%d\t%d\t%s\n", p.time.Format(time.RFC3339Nano), p.offset, p.end-p.offset, purpose)
+	if a.err == nil {
+		a.err = err
+	}
+}
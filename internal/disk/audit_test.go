@@ -0,0 +1,65 @@
+package disk
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "test.img")
+	os.WriteFile(tmpFile, make([]byte, 8192), 0644)
+	reader, err := Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	var log bytes.Buffer
+	if err := reader.Audit(&log); err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+	buf := make([]byte, 512)
+
+	// Reads that carry on where the last ended are one region
+	restore := reader.Purpose("scan")
+	reader.ReadAt(buf, 0)
+	reader.ReadAt(buf, 512)
+	reader.ReadAt(buf, 4096)
+
+	// A partition's reads are at their offset on the disk
+	part := reader.Partition(Partition{Index: 1, Offset: 1024, Size: 2048})
+	func() {
+		defer part.Purpose("partition")()
+		part.ReadAt(buf, 0)
+	}()
+	restore()
+
+	reader.Seek(2048, 0)
+	reader.Read(buf)
+	reader.ReadAt(buf, 9000) // Past the end: nothing read
+	if err := reader.FlushAudit(); err != nil {
+		t.Fatalf("FlushAudit failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(log.String()), "\n")
+	want := []string{"0\t1024\tscan", "4096\t512\tscan", "1024\t512\tpartition", "2048\t512\t-"}
+	if len(lines) != len(want)+1 || lines[0] != AuditHeader {
+		t.Fatalf("Expected a header and %d reads, got:\n%s", len(want), log.String())
+	}
+	for i, w := range want {
+		if _, rest, _ := strings.Cut(lines[i+1], "\t"); rest != w {
+			t.Errorf("Line %d: expected %q, got %q", i+1, w, lines[i+1])
+		}
+	}
+}
+
+func TestAuditOff(t *testing.T) {
+	reader := NewReader(bytes.NewReader(make([]byte, 1024)), 1024, "mem")
+	reader.Purpose("scan")()
+	if _, err := reader.ReadAt(make([]byte, 16), 0); err != nil || reader.FlushAudit() != nil {
+		t.Errorf("Expected reads without an audit log to work (%v)", err)
+	}
+}
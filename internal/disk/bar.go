@@ -0,0 +1,106 @@
+package disk
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BarInterval is how often a Bar redraws the progress of a phase
+const BarInterval = 200 * time.Millisecond
+
+// barWidth is the number of cells of a Bar's bar
+const barWidth = 30
+
+// Bar is the ProgressReporter of a terminal: it keeps the progress of the
+// phase under way on the last line, redrawn in place, as a bar with how
+// much is done, the rate the disk is read at, the time left and the files
+// found, and prints messages above it:
+//
+//	carving scan [=============>                ]  45.2%  38.1 MB/s  ETA 2m10s  found 12
+type Bar struct {
+	w    io.Writer
+	now  func() time.Time
+	read func() int64 // Bytes read from the disk so far; nil = no rate
+
+	mu        sync.Mutex
+	phase     string
+	started   time.Time // Of the phase
+	startRead int64     // Bytes read when the phase started
+	last      time.Time // Of the last redraw
+	shown     int       // Length of the line drawn, 0 when none is
+	current   Progress  // Last reported, redrawn after messages
+}
+
+// NewBar returns a Bar drawing to w, with the rate of the reads read
+// reports the total of
+func NewBar(w io.Writer, read func() int64) *Bar {
+	return &Bar{w: w, now: time.Now, read: read}
+}
+
+func (b *Bar) Message(text string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clear()
+	fmt.Fprint(b.w, text)
+}
+
+func (b *Bar) Progress(p Progress) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if p.Phase != b.phase {
+		b.phase, b.started = p.Phase, now
+		if b.read != nil {
+			b.startRead = b.read()
+		}
+	} else if now.Sub(b.last) < BarInterval && b.shown > 0 && (p.Total == 0 || p.Current < p.Total) {
+		b.current = p
+		return
+	}
+	b.current, b.last = p, now
+	b.draw()
+}
+
+// clear erases the line drawn
+func (b *Bar) clear() {
+	if b.shown > 0 {
+		fmt.Fprintf(b.w, "\r%s\r", strings.Repeat(" ", b.shown))
+		b.shown = 0
+	}
+}
+
+// draw redraws the line of the progress last reported
+func (b *Bar) draw() {
+	p := b.current
+	elapsed := b.now().Sub(b.started)
+	var line strings.Builder
+	line.WriteString(p.Phase)
+	if p.Total > 0 {
+		done := min(float64(p.Current)/float64(p.Total), 1)
+		filled := int(done * barWidth)
+		bar := strings.Repeat("=", filled)
+		if filled < barWidth {
+			bar += ">" + strings.Repeat(" ", barWidth-filled-1)
+		}
+		fmt.Fprintf(&line, " [%s] %5.1f%%", bar, done*100)
+	} else {
+		fmt.Fprintf(&line, "  %d done", p.Current)
+	}
+	if b.read != nil && elapsed >= time.Second {
+		rate := float64(b.read()-b.startRead) / elapsed.Seconds()
+		fmt.Fprintf(&line, "  %s/s", FormatSize(int64(rate)))
+	}
+	if p.Total > 0 && p.Current > 0 && p.Current < p.Total && elapsed >= time.Second {
+		left := time.Duration(float64(elapsed) * float64(p.Total-p.Current) / float64(p.Current))
+		fmt.Fprintf(&line, "  ETA %s", left.Round(time.Second))
+	}
+	fmt.Fprintf(&line, "  found %d", p.Found)
+
+	text := line.String()
+	pad := max(b.shown-len(text), 0)
+	fmt.Fprintf(b.w, "\r%s%s", text, strings.Repeat(" ", pad))
+	b.shown = len(text) + pad
+}
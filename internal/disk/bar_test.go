@@ -0,0 +1,55 @@
+package disk
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBar(t *testing.T) {
+	var out bytes.Buffer
+	var read int64
+	b := NewBar(&out, func() int64 { return read })
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+
+	b.Progress(Progress{Phase: "carving scan", Total: 1000})
+	if got := out.String(); got != "\rcarving scan [>                             ]   0.0%  found 0" {
+		t.Errorf("Unexpected first line %q", got)
+	}
+
+	// Halfway after 10 seconds, at 5 MiB/s
+	out.Reset()
+	now, read = now.Add(10*time.Second), 50<<20
+	b.Progress(Progress{Phase: "carving scan", Current: 500, Total: 1000, Found: 3})
+	line := out.String()
+	for _, want := range []string{"\rcarving scan [===============>", " 50.0%", "5.0 MB/s", "ETA 10s", "found 3"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("Expected %q in %q", want, line)
+		}
+	}
+
+	// Too soon to redraw
+	out.Reset()
+	now = now.Add(BarInterval / 2)
+	b.Progress(Progress{Phase: "carving scan", Current: 510, Total: 1000, Found: 3})
+	if out.Len() != 0 {
+		t.Errorf("Expected no redraw, got %q", out.String())
+	}
+
+	// A message clears the bar and is printed in its place
+	out.Reset()
+	b.Message("  Recovered: a.jpg\n")
+	blank := "\r" + strings.Repeat(" ", len(line)-1) + "\r"
+	if out.String() != blank+"  Recovered: a.jpg\n" {
+		t.Errorf("Unexpected message %q", out.String())
+	}
+
+	// A phase without a total counts what is done
+	out.Reset()
+	b.Progress(Progress{Phase: "MFT scan", Current: 20, Found: 1})
+	if got := out.String(); got != "\rMFT scan  20 done  found 1" {
+		t.Errorf("Unexpected line %q", got)
+	}
+}
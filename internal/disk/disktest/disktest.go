@@ -0,0 +1,96 @@
+// Package disktest builds the small FAT32 volumes the tests of this module
+// scan and recover from: 4KB clusters after 32 reserved sectors and two
+// one-sector FATs, the root directory in cluster 2.
+package disktest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	ClusterSize = 4096
+	DataStart   = 34 * 512   // Where cluster 2 starts
+	EndOfChain  = 0x0FFFFFFF // FAT entry of a chain's last cluster
+	fatStart    = 32 * 512
+)
+
+// NotesID is the id scans give the NOTES.TXT of Deleted: the offset of its
+// directory entry, the first of the root directory
+const NotesID = DataStart
+
+// Notes is the content of the deleted NOTES.TXT of Deleted
+var Notes = bytes.Repeat([]byte("meeting notes "), 100)
+
+// FAT32 returns a volume of clusters clusters, all free but the two the
+// FAT reserves; SetFAT and Allocate give them files
+func FAT32(clusters int) []byte {
+	le := binary.LittleEndian
+	sectors := 34 + clusters*8
+	data := make([]byte, sectors*512)
+	le.PutUint16(data[11:], 512)
+	data[13] = 8
+	le.PutUint16(data[14:], 32)
+	data[16] = 2
+	le.PutUint32(data[32:], uint32(sectors))
+	le.PutUint32(data[36:], 1)
+	le.PutUint32(data[44:], 2)
+	copy(data[82:], "FAT32   ")
+	data[510], data[511] = 0x55, 0xAA
+	SetFAT(data, 0, 0x0FFFFFF8)
+	SetFAT(data, 1, EndOfChain)
+	return data
+}
+
+// Deleted returns a volume of 16 clusters whose root directory lists a
+// deleted NOTES.TXT, as ?OTES.TXT, holding content from cluster 5
+func Deleted(content []byte) []byte {
+	data := FAT32(16)
+	Allocate(data, 2)
+	copy(Cluster(data, 2), DirEntry("\xE5OTES   TXT", 0, 5, uint32(len(content))))
+	copy(Cluster(data, 5), content)
+	return data
+}
+
+// SetFAT sets the FAT entry of a cluster: the next of its chain, or
+// EndOfChain
+func SetFAT(data []byte, cluster int, next uint32) {
+	binary.LittleEndian.PutUint32(data[fatStart+4*cluster:], next)
+}
+
+// Allocate marks clusters in use, each a chain of its own
+func Allocate(data []byte, clusters ...int) {
+	for _, c := range clusters {
+		SetFAT(data, c, EndOfChain)
+	}
+}
+
+// Cluster returns the bytes of a cluster, and those after it
+func Cluster(data []byte, c int) []byte {
+	return data[DataStart+(c-2)*ClusterSize:]
+}
+
+// DirEntry builds a short-name directory entry
+func DirEntry(name string, attr byte, cluster, size uint32) []byte {
+	e := make([]byte, 32)
+	copy(e, name)
+	e[11] = attr
+	binary.LittleEndian.PutUint16(e[20:], uint16(cluster>>16))
+	binary.LittleEndian.PutUint16(e[26:], uint16(cluster))
+	binary.LittleEndian.PutUint32(e[28:], size)
+	return e
+}
+
+// Write writes an image to a file of a test's temporary directory and
+// returns its path
+func Write(t testing.TB, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+	return path
+}
@@ -0,0 +1,37 @@
+package disktest
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/internal/fat32"
+)
+
+func TestDeleted(t *testing.T) {
+	reader, err := disk.Open(Write(t, "fat32.img", Deleted(Notes)))
+	if err != nil {
+		t.Fatalf("Failed to open image: %v", err)
+	}
+	defer reader.Close()
+	parser, err := fat32.NewParser(reader)
+	if err != nil {
+		t.Fatalf("NewParser failed: %v", err)
+	}
+	files, err := parser.ScanDeletedFiles()
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one deleted file, got %+v (%v)", files, err)
+	}
+	f := files[0]
+	if f.Name != "?OTES.TXT" || int(f.Size) != len(Notes) || f.FirstCluster != 5 {
+		t.Errorf("Unexpected file %+v", f)
+	}
+	r, err := parser.OpenFile(f)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, Notes) {
+		t.Errorf("Expected the notes back, got %d bytes (%v)", len(got), err)
+	}
+}
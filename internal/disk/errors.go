@@ -0,0 +1,95 @@
+package disk
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The failures a caller may act on have types of their own, for errors.Is
+// and errors.As to tell apart however they were wrapped: a source with no
+// filesystem that can be read, whose files can still be carved; a volume
+// whose boot sector is damaged; a read the drive failed, which imaging the
+// drive first may get past; and a recovery that wrote some of its files
+// but not all.
+
+// ErrUnsupportedFilesystem is the error of a source or volume with no
+// FAT32 or NTFS filesystem to recover from
+var ErrUnsupportedFilesystem = errors.New("unsupported filesystem")
+
+// ErrCorruptBootSector matches every BootSectorError under errors.Is
+var ErrCorruptBootSector = errors.New("corrupt boot sector")
+
+// BootSectorError is the error of a volume whose boot sector does not
+// describe a filesystem that can be read
+type BootSectorError struct {
+	Filesystem string // NTFS or FAT32
+	Details    string // What is wrong with it, such as "invalid cluster size"
+}
+
+func (e *BootSectorError) Error() string {
+	return fmt.Sprintf("corrupt %s boot sector: %s", e.Filesystem, e.Details)
+}
+
+func (e *BootSectorError) Is(target error) bool {
+	return target == ErrCorruptBootSector
+}
+
+// ReadError is the error of a read of the disk that failed, other than
+// one past its end or of a run that was cancelled
+type ReadError struct {
+	Offset int64 // On the disk opened, also for reads of its partitions
+	Len    int
+	Err    error
+}
+
+func (e *ReadError) Error() string {
+	return fmt.Sprintf("failed to read %d bytes at offset %d: %v", e.Len, e.Offset, e.Err)
+}
+
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+// FileError is why a file could not be recovered
+type FileError struct {
+	Path string // Within its volume
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// PartialRecoveryError is the error of a recovery that wrote some of its
+// files, with their manifests, but could not recover others
+type PartialRecoveryError struct {
+	Recovered int
+	Failed    []*FileError
+}
+
+func (e *PartialRecoveryError) Error() string {
+	return fmt.Sprintf("recovered %d files, %d failed (first %v)", e.Recovered, len(e.Failed), e.Failed[0])
+}
+
+// Unwrap returns the errors of the files that failed, so that errors.As
+// finds a ReadError among them
+func (e *PartialRecoveryError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, f := range e.Failed {
+		errs[i] = f
+	}
+	return errs
+}
+
+// Partial returns the error of a recovery that wrote recovered files and
+// failed on failed, or nil when none failed
+func Partial(recovered int, failed []*FileError) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	return &PartialRecoveryError{Recovered: recovered, Failed: failed}
+}
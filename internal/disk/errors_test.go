@@ -0,0 +1,82 @@
+package disk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"syscall"
+	"testing"
+)
+
+// failingReaderAt fails reads that reach bad
+type failingReaderAt struct {
+	data []byte
+	bad  int64
+}
+
+func (f failingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off <= f.bad && f.bad < off+int64(len(p)) {
+		return 0, syscall.EIO
+	}
+	return bytes.NewReader(f.data).ReadAt(p, off)
+}
+
+func TestReadError(t *testing.T) {
+	reader := NewReader(failingReaderAt{data: make([]byte, 8192), bad: 5000}, 8192, "bad.img")
+	buf := make([]byte, 512)
+
+	if _, err := reader.ReadAt(buf, 0); err != nil {
+		t.Fatalf("Read of a good sector failed: %v", err)
+	}
+	if _, err := reader.ReadAt(buf, 8000); err != io.EOF {
+		t.Errorf("Expected io.EOF past the end, got %v", err)
+	}
+
+	// A partition's failed read is at its offset on the disk
+	part := reader.Partition(Partition{Index: 1, Offset: 4096, Size: 4096})
+	_, err := part.ReadAt(buf, 512)
+	var re *ReadError
+	if !errors.As(err, &re) || re.Offset != 4608 || re.Len != 512 || !errors.Is(err, syscall.EIO) {
+		t.Errorf("Expected a ReadError of 512 bytes at 4608, got %#v", err)
+	}
+	part.ReadAt(buf, 0)
+	if stats := part.Stats(); stats != (ReadStats{Bytes: 512 + 192 + 512, Errors: 1}) {
+		t.Errorf("Expected 1216 bytes read and one failed read, counted once, got %+v", stats)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	reader.SetContext(ctx)
+	if _, err := reader.ReadAt(buf, 0); err != context.Canceled {
+		t.Errorf("Expected the context's error as it is, got %v", err)
+	}
+}
+
+func TestPartialRecoveryError(t *testing.T) {
+	if err := Partial(3, nil); err != nil {
+		t.Errorf("Expected no error when nothing failed, got %v", err)
+	}
+
+	read := &ReadError{Offset: 4096, Len: 512, Err: syscall.EIO}
+	err := Partial(3, []*FileError{{Path: "a.txt", Err: ErrOutputFull}, {Path: "b.txt", Err: read}})
+	var partial *PartialRecoveryError
+	if !errors.As(err, &partial) || partial.Recovered != 3 || len(partial.Failed) != 2 {
+		t.Fatalf("Expected a PartialRecoveryError, got %v", err)
+	}
+	var re *ReadError
+	if !errors.As(err, &re) || re.Offset != 4096 {
+		t.Errorf("Expected the read error of b.txt to be found, got %v", re)
+	}
+	if want := "recovered 3 files, 2 failed (first a.txt: output size limit reached)"; err.Error() != want {
+		t.Errorf("Expected %q, got %q", want, err.Error())
+	}
+
+	boot := &BootSectorError{Filesystem: "FAT32", Details: "invalid cluster size"}
+	if !errors.Is(boot, ErrCorruptBootSector) || errors.Is(boot, ErrUnsupportedFilesystem) {
+		t.Errorf("Expected a BootSectorError to be ErrCorruptBootSector only")
+	}
+	if _, err := DetectFilesystem(NewReader(bytes.NewReader(make([]byte, 4096)), 4096, "zero.img")); !errors.Is(err, ErrUnsupportedFilesystem) {
+		t.Errorf("Expected ErrUnsupportedFilesystem for a blank disk, got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package disk
+
+import "sort"
+
+// Extent is a range of bytes on a disk
+type Extent struct {
+	Offset int64
+	Length int64
+}
+
+// FreeExtents returns the runs of clusters that allocated reports as free,
+// as byte ranges in disk order, for a volume whose cluster 0 starts at base
+func FreeExtents(clusters int64, allocated func(cluster int64) bool, base, clusterSize int64) []Extent {
+	var extents []Extent
+	for c := int64(0); c < clusters; c++ {
+		if allocated(c) {
+			continue
+		}
+		offset := base + c*clusterSize
+		if n := len(extents); n > 0 && extents[n-1].Offset+extents[n-1].Length == offset {
+			extents[n-1].Length += clusterSize
+			continue
+		}
+		extents = append(extents, Extent{Offset: offset, Length: clusterSize})
+	}
+	return extents
+}
+
+// Shift moves extents of a partition to where the partition lies on its disk
+func Shift(extents []Extent, offset int64) []Extent {
+	shifted := make([]Extent, len(extents))
+	for i, e := range extents {
+		shifted[i] = Extent{Offset: e.Offset + offset, Length: e.Length}
+	}
+	return shifted
+}
+
+// Slack is the part of a file's last cluster past the end of its data,
+// which holds whatever the cluster held before
+type Slack struct {
+	Path string // Of the file, within its volume
+	Extent
+}
+
+// Subtract returns the parts of extents, which are in disk order, that none
+// of holes covers
+func Subtract(extents, holes []Extent) []Extent {
+	holes = append([]Extent(nil), holes...)
+	sort.Slice(holes, func(i, j int) bool { return holes[i].Offset < holes[j].Offset })
+
+	var rest []Extent
+	k := 0
+	for _, e := range extents {
+		pos, end := e.Offset, e.Offset+e.Length
+		for k < len(holes) && holes[k].Offset+holes[k].Length <= pos {
+			k++
+		}
+		for h := k; h < len(holes) && holes[h].Offset < end; h++ {
+			if holes[h].Offset > pos {
+				rest = append(rest, Extent{Offset: pos, Length: holes[h].Offset - pos})
+			}
+			pos = max(pos, holes[h].Offset+holes[h].Length)
+		}
+		if pos < end {
+			rest = append(rest, Extent{Offset: pos, Length: end - pos})
+		}
+	}
+	return rest
+}
+
+// Allocation is where the data of a file or directory on a volume lies
+type Allocation struct {
+	Path    string // Within its volume
+	Deleted bool
+	Extents []Extent
+}
+
+// Limit cuts extents, which are in file order, down to their first size
+// bytes
+func Limit(extents []Extent, size int64) []Extent {
+	var limited []Extent
+	for _, e := range extents {
+		if size <= 0 {
+			break
+		}
+		e.Length = min(e.Length, size)
+		limited = append(limited, e)
+		size -= e.Length
+	}
+	return limited
+}
+
+// FileEntry is a file or directory as its volume's filesystem lists it:
+// where its data lies and its times, in Unix seconds (0 = unknown)
+type FileEntry struct {
+	Path     string // Within its volume
+	Inode    uint64 // MFT record, 0 on FAT32
+	Record   int64  // Offset on the volume of its MFT record or directory entry
+	Dir      bool
+	Deleted  bool
+	Size     int64
+	Extents  []Extent // Data in file order, sparse runs left out
+	Resident []byte   // Data kept in the NTFS MFT record, in place of Extents
+	Accessed int64
+	Modified int64
+	Changed  int64
+	Created  int64
+}
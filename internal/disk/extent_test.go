@@ -0,0 +1,56 @@
+package disk
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFreeExtents(t *testing.T) {
+	// Clusters 0-1 and 4 in use, 2-3 and 5-7 free
+	used := map[int64]bool{0: true, 1: true, 4: true}
+	extents := FreeExtents(8, func(c int64) bool { return used[c] }, 1000, 512)
+
+	want := []Extent{{Offset: 1000 + 2*512, Length: 2 * 512}, {Offset: 1000 + 5*512, Length: 3 * 512}}
+	if !reflect.DeepEqual(extents, want) {
+		t.Errorf("Expected %v, got %v", want, extents)
+	}
+
+	if all := FreeExtents(8, func(int64) bool { return true }, 0, 512); all != nil {
+		t.Errorf("Expected no free extents, got %v", all)
+	}
+}
+
+func TestShift(t *testing.T) {
+	extents := []Extent{{Offset: 0, Length: 10}, {Offset: 20, Length: 5}}
+	shifted := Shift(extents, 100)
+	want := []Extent{{Offset: 100, Length: 10}, {Offset: 120, Length: 5}}
+	if !reflect.DeepEqual(shifted, want) {
+		t.Errorf("Expected %v, got %v", want, shifted)
+	}
+	if extents[0].Offset != 0 {
+		t.Error("Shift modified its input")
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	extents := []Extent{{Offset: 0, Length: 100}, {Offset: 200, Length: 100}}
+	holes := []Extent{{Offset: 250, Length: 100}, {Offset: 10, Length: 10}, {Offset: 15, Length: 10}, {Offset: 90, Length: 120}}
+	want := []Extent{{Offset: 0, Length: 10}, {Offset: 25, Length: 65}, {Offset: 210, Length: 40}}
+	if got := Subtract(extents, holes); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if got := Subtract(extents, nil); !reflect.DeepEqual(got, extents) {
+		t.Errorf("Expected %v unchanged, got %v", extents, got)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	extents := []Extent{{Offset: 0, Length: 4096}, {Offset: 8192, Length: 4096}, {Offset: 20000, Length: 4096}}
+	want := []Extent{{Offset: 0, Length: 4096}, {Offset: 8192, Length: 904}}
+	if got := Limit(extents, 5000); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if got := Limit(extents, 0); got != nil {
+		t.Errorf("Expected nothing of an empty file, got %v", got)
+	}
+}
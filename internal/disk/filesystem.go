@@ -0,0 +1,87 @@
+package disk
+
+import (
+	"fmt"
+	"io"
+)
+
+// Filesystems are found and read through a registry, so that the commands
+// and the library recover from every filesystem linked in without naming
+// each: the ntfs and fat32 packages register themselves when imported, and
+// a new one does the same from an init function.
+//
+//	func init() {
+//		disk.RegisterFilesystem(exfat{})
+//	}
+
+// Filesystem is a filesystem that files can be recovered from
+type Filesystem interface {
+	// Name is how the filesystem is detected and chosen, such as "ntfs"
+	Name() string
+	// Detect reports whether the first 4KB of a volume are of the filesystem
+	Detect(boot []byte) bool
+	// Scan lists every file and directory of a volume, live or deleted
+	Scan(volume *Reader) (Volume, []FileEntry, error)
+	// Recover recovers every deleted file of a volume to outputDir, with
+	// hash manifests, or with scanOnly only lists them, and returns how
+	// many it recovered
+	Recover(volume *Reader, outputDir string, scanOnly bool) (int, error)
+}
+
+// Volume reads the files a Filesystem's Scan listed
+type Volume interface {
+	// RecoverEntry writes a file to path
+	RecoverEntry(e FileEntry, path string) (Digest, error)
+	// OpenEntry returns a reader of a file, as RecoverEntry writes it
+	OpenEntry(e FileEntry) (io.Reader, error)
+}
+
+// Inspector is a Volume that decodes what its filesystem records of a
+// file, for checking a parser against an odd volume
+type Inspector interface {
+	// Inspect decodes the record of a file Scan listed: its MFT record,
+	// or its directory entry
+	Inspect(e FileEntry) (Record, error)
+}
+
+// Record is what a filesystem records of a file, decoded
+type Record struct {
+	Kind   string  // Such as "MFT record 42" or "directory entry"
+	Offset int64   // Of the record on its volume
+	Raw    []byte  // As read, with NTFS fixups applied
+	Fields []Field // In the order they are in Raw
+}
+
+// Field is a decoded field of a Record
+type Field struct {
+	Offset int // In Raw; -1 for what is worked out from several fields
+	Name   string
+	Value  string
+}
+
+var filesystems []Filesystem
+
+// RegisterFilesystem adds a filesystem to those DetectFilesystem and
+// LookupFilesystem know. Registering two with the same name panics.
+func RegisterFilesystem(fs Filesystem) {
+	if LookupFilesystem(fs.Name()) != nil {
+		panic(fmt.Sprintf("disk: filesystem %s registered twice", fs.Name()))
+	}
+	filesystems = append(filesystems, fs)
+}
+
+// Filesystems returns the registered filesystems, in the order they were
+// registered
+func Filesystems() []Filesystem {
+	return append([]Filesystem(nil), filesystems...)
+}
+
+// LookupFilesystem returns the registered filesystem of a name, or nil
+func LookupFilesystem(name string) Filesystem {
+	for _, fs := range filesystems {
+		if fs.Name() == name {
+			return fs
+		}
+	}
+	return nil
+}
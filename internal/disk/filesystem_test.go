@@ -0,0 +1,49 @@
+package disk
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testFS is a filesystem whose volumes start with "TESTFS"
+type testFS struct{}
+
+func (testFS) Name() string {
+	return "testfs"
+}
+
+func (testFS) Detect(boot []byte) bool {
+	return bytes.HasPrefix(boot, []byte("TESTFS"))
+}
+
+func (testFS) Scan(volume *Reader) (Volume, []FileEntry, error) {
+	return nil, nil, nil
+}
+
+func (testFS) Recover(volume *Reader, outputDir string, scanOnly bool) (int, error) {
+	return 0, nil
+}
+
+func TestRegisterFilesystem(t *testing.T) {
+	RegisterFilesystem(testFS{})
+	defer func() { filesystems = filesystems[:len(filesystems)-1] }()
+
+	boot := make([]byte, 4096)
+	copy(boot, "TESTFS")
+	if fs, err := DetectFilesystem(NewReader(bytes.NewReader(boot), int64(len(boot)), "test.img")); err != nil || fs != "testfs" {
+		t.Errorf("Expected testfs to be detected, got %q (%v)", fs, err)
+	}
+	if LookupFilesystem("testfs") == nil || LookupFilesystem("exfat") != nil {
+		t.Error("Expected only testfs to be found")
+	}
+	if all := Filesystems(); len(all) == 0 || all[len(all)-1].Name() != "testfs" {
+		t.Errorf("Expected testfs among the filesystems, got %v", all)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering testfs twice to panic")
+		}
+	}()
+	RegisterFilesystem(testFS{})
+}
@@ -0,0 +1,233 @@
+package disk
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Filter picks the files a run lists and recovers, by their names, sizes
+// and times: a file is kept when it matches one of Include, if there are
+// any, none of Exclude and Path, if set, and its size and times are within
+// the bounds given. A pattern is a glob, as path.Match takes, matched
+// without case against the file's name, or when it holds a slash against
+// its path within its volume and the directories the path is in:
+//
+//	*.jpg,*.docx          JPEGs and Word documents, anywhere
+//	Users/*/Documents     everything in the documents of each user
+//
+// Path is a regular expression matched without case against the path, for
+// what globs cannot say, such as ^Users/alice/(Documents|Desktop)/.
+//
+// Carved files are matched by the names they are written with, such as
+// carved_000012.jpg, and have no times to match. Directories are listed
+// only when the filter keeps every file.
+//
+// FAT keeps the local time of the machine that wrote a file, with no zone,
+// and it is matched as if it were UTC: a bound on a FAT volume is off by
+// that machine's offset from UTC, which no scan can know.
+type Filter struct {
+	Include []string
+	Exclude []string
+	Path    *regexp.Regexp // Matched against the path without its leading slash; nil = any
+	MinSize int64          // Bytes; 0 = no minimum
+	MaxSize int64          // Bytes; 0 = no maximum
+
+	// The times a file is kept for, After included and Before not; zero
+	// for no bound. A file whose time is unknown is left out.
+	ModifiedAfter, ModifiedBefore time.Time
+	CreatedAfter, CreatedBefore   time.Time
+}
+
+// Why a filter leaves a file out
+const (
+	LeftDirectory = "directory" // Directories, when the filter leaves any file out
+	LeftName      = "name"      // Not in Include, or in Exclude
+	LeftPath      = "path"      // Path does not match
+	LeftTooSmall  = "too_small" // Below MinSize
+	LeftTooLarge  = "too_large" // Above MaxSize
+	LeftModified  = "modified"  // Modified outside the bounds, or when unknown
+	LeftCreated   = "created"   // Created outside the bounds, or when unknown
+)
+
+// ParsePatterns parses a comma-separated list of globs
+func ParsePatterns(list string) ([]string, error) {
+	var patterns []string
+	for _, p := range strings.Split(list, ",") {
+		p = strings.TrimSpace(strings.ReplaceAll(p, `\`, "/"))
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		patterns = append(patterns, strings.ToLower(strings.Trim(p, "/")))
+	}
+	return patterns, nil
+}
+
+// Active reports whether the filter leaves out any file
+func (f *Filter) Active() bool {
+	return f != nil && (len(f.Include) > 0 || len(f.Exclude) > 0 || f.Path != nil || f.Sized() || f.Dated())
+}
+
+// Match reports whether the filter keeps a file; a nil filter keeps all
+func (f *Filter) Match(e FileEntry) bool {
+	return f.Leaves(e) == ""
+}
+
+// Leaves returns why the filter leaves a file out (LeftName, ...), or ""
+// when it keeps it
+func (f *Filter) Leaves(e FileEntry) string {
+	switch {
+	case !f.Active():
+		return ""
+	case e.Dir:
+		return LeftDirectory
+	case f.LeavesName(e.Path) != "":
+		return f.LeavesName(e.Path)
+	case f.LeavesSize(e.Size) != "":
+		return f.LeavesSize(e.Size)
+	case !within(e.Modified, f.ModifiedAfter, f.ModifiedBefore):
+		return LeftModified
+	case !within(e.Created, f.CreatedAfter, f.CreatedBefore):
+		return LeftCreated
+	}
+	return ""
+}
+
+// MatchName reports whether the filter keeps a file at a path, with
+// slashes, within its volume, whatever its size
+func (f *Filter) MatchName(name string) bool {
+	return f.LeavesName(name) == ""
+}
+
+// LeavesName returns why the filter leaves out a file at a path (LeftName
+// or LeftPath), or "" when it keeps the path
+func (f *Filter) LeavesName(name string) string {
+	if f == nil {
+		return ""
+	}
+	name = strings.Trim(strings.ReplaceAll(name, `\`, "/"), "/")
+	if f.Path != nil && !f.Path.MatchString(name) {
+		return LeftPath
+	}
+	name = strings.ToLower(name)
+	if len(f.Include) > 0 && !matchAny(f.Include, name) || matchAny(f.Exclude, name) {
+		return LeftName
+	}
+	return ""
+}
+
+// ParsePathRegex compiles the regular expression of a Filter's Path, which
+// matches without case, as paths do on FAT and NTFS
+func ParsePathRegex(expr string) (*regexp.Regexp, error) {
+	// Compiled as given first, for errors that quote it as given
+	if _, err := regexp.Compile(expr); err != nil {
+		return nil, err
+	}
+	return regexp.Compile("(?i)" + expr)
+}
+
+// LeavesSize returns why the filter leaves out a file of size bytes
+// (LeftTooSmall or LeftTooLarge), or "" when its size is kept
+func (f *Filter) LeavesSize(size int64) string {
+	switch {
+	case f == nil:
+		return ""
+	case size < f.MinSize:
+		return LeftTooSmall
+	case f.MaxSize > 0 && size > f.MaxSize:
+		return LeftTooLarge
+	}
+	return ""
+}
+
+// Sized reports whether the filter bounds the sizes of the files it keeps
+func (f *Filter) Sized() bool {
+	return f != nil && (f.MinSize > 0 || f.MaxSize > 0)
+}
+
+// Dated reports whether the filter bounds the times of the files it keeps
+func (f *Filter) Dated() bool {
+	return f != nil && !(f.ModifiedAfter.IsZero() && f.ModifiedBefore.IsZero() &&
+		f.CreatedAfter.IsZero() && f.CreatedBefore.IsZero())
+}
+
+// within reports whether a time in Unix seconds (0 = unknown) is within
+// after and before, which may be zero for no bound
+func within(t int64, after, before time.Time) bool {
+	switch {
+	case after.IsZero() && before.IsZero():
+		return true
+	case t == 0:
+		return false
+	case !after.IsZero() && t < after.Unix():
+		return false
+	}
+	return before.IsZero() || t < before.Unix()
+}
+
+func matchAny(patterns []string, name string) bool {
+	base := path.Base(name)
+	for _, p := range patterns {
+		if !strings.Contains(p, "/") {
+			if ok, _ := path.Match(p, base); ok {
+				return true
+			}
+			continue
+		}
+		// A directory's pattern matches what is below it
+		for dir := name; dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if ok, _ := path.Match(p, dir); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetFilter sets the filter of the files a run on the disk lists and
+// recovers, or keeps them all with nil. The readers of its partitions
+// share it.
+func (r *Reader) SetFilter(f *Filter) {
+	r.run.filter = f
+}
+
+// Filter returns the filter SetFilter gave the disk, or nil
+func (r *Reader) Filter() *Filter {
+	return r.run.filter
+}
+
+// SetLiveFiles makes a run on the disk, and on the readers of its
+// partitions, list and recover the files in use as well as the deleted
+// ones: a full extraction, to copy everything off a failing drive
+func (r *Reader) SetLiveFiles(live bool) {
+	r.run.live = live
+}
+
+// LiveFiles reports whether a run on the disk takes the files in use too
+func (r *Reader) LiveFiles() bool {
+	return r.run.live
+}
+
+// LeaveOut counts a carved hit the filter left out, for why. No volume
+// lists the hits, so a report takes their counts from the run.
+func (r *Reader) LeaveOut(why string) {
+	r.run.mu.Lock()
+	defer r.run.mu.Unlock()
+	if r.run.hitsLeft == nil {
+		r.run.hitsLeft = make(map[string]int)
+	}
+	r.run.hitsLeft[why]++
+}
+
+// HitsLeftOut returns how many carved hits LeaveOut counted, by why
+func (r *Reader) HitsLeftOut() map[string]int {
+	r.run.mu.Lock()
+	defer r.run.mu.Unlock()
+	return maps.Clone(r.run.hitsLeft)
+}
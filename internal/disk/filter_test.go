@@ -0,0 +1,117 @@
+package disk
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePatterns(t *testing.T) {
+	patterns, err := ParsePatterns(` *.JPG, ,Users\*\Documents/ `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patterns) != 2 || patterns[0] != "*.jpg" || patterns[1] != "users/*/documents" {
+		t.Errorf("Unexpected patterns %q", patterns)
+	}
+	if _, err := ParsePatterns("*.jpg,[a-"); err == nil {
+		t.Error("Expected an error for a malformed pattern")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	var none *Filter
+	if none.Active() || !none.Match(FileEntry{Path: "a", Dir: true}) {
+		t.Error("A nil filter should keep everything")
+	}
+
+	f := &Filter{Include: []string{"*.jpg", "users/*/documents"}, Exclude: []string{"*/thumbs/*"}}
+	for name, want := range map[string]bool{
+		"DCIM/IMG_0001.JPG":                true,
+		"dcim/thumbs/img_0001.jpg":         false,
+		"Users/ann/Documents/cv.docx":      true,
+		"Users/ann/Documents/old/cv.docx":  true,
+		"Users/ann/Downloads/setup.exe":    false,
+		`Users\bob\Documents\notes.txt`:    true,
+		"/Users/ann/Documents/report.docx": true,
+	} {
+		if got := f.MatchName(name); got != want {
+			t.Errorf("MatchName(%q) = %v, want %v", name, got, want)
+		}
+	}
+	if f.Match(FileEntry{Path: "Users/ann/Documents", Dir: true}) {
+		t.Error("A filter that leaves files out should not list directories")
+	}
+
+	sized := &Filter{Include: []string{"*.jpg"}, MinSize: 1, MaxSize: 1 << 20}
+	for _, c := range []struct {
+		e    FileEntry
+		want string
+	}{
+		{FileEntry{Path: "a.jpg", Size: 100}, ""},
+		{FileEntry{Path: "a.jpg"}, LeftTooSmall},
+		{FileEntry{Path: "a.jpg", Size: 2 << 20}, LeftTooLarge},
+		{FileEntry{Path: "a.png", Size: 100}, LeftName},
+		{FileEntry{Path: "dcim", Dir: true}, LeftDirectory},
+	} {
+		if got := sized.Leaves(c.e); got != c.want {
+			t.Errorf("Leaves(%+v) = %q, want %q", c.e, got, c.want)
+		}
+	}
+	if !(&Filter{MaxSize: 10}).Active() || !(&Filter{MinSize: 10}).MatchName("any") {
+		t.Error("A size filter should be active and keep every name")
+	}
+
+	may := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC).Unix()
+	dated := &Filter{ModifiedAfter: time.Unix(may, 0), ModifiedBefore: time.Unix(may+31*86400, 0), CreatedBefore: time.Unix(may, 0)}
+	for _, c := range []struct {
+		e    FileEntry
+		want string
+	}{
+		{FileEntry{Modified: may, Created: may - 1}, ""},
+		{FileEntry{Modified: may - 1, Created: may - 1}, LeftModified},
+		{FileEntry{Modified: may + 31*86400, Created: may - 1}, LeftModified},
+		{FileEntry{Modified: may, Created: may}, LeftCreated},
+		{FileEntry{Modified: may}, LeftCreated},
+	} {
+		if got := dated.Leaves(c.e); got != c.want {
+			t.Errorf("Leaves(%+v) = %q, want %q", c.e, got, c.want)
+		}
+	}
+	if !dated.Active() || dated.Sized() {
+		t.Error("A date filter should be active, without bounding sizes")
+	}
+
+	re, err := ParsePathRegex(`^users/alice/documents/`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPath := &Filter{Path: re, Exclude: []string{"*.tmp"}}
+	for name, want := range map[string]string{
+		"/Users/Alice/Documents/cv.docx": "",
+		`Users\alice\Documents\a\b.txt`:  "",
+		"Users/alice/Documents/~cv.tmp":  LeftName,
+		"Users/bob/Documents/cv.docx":    LeftPath,
+		"Old/Users/alice/Documents/a":    LeftPath,
+	} {
+		if got := byPath.LeavesName(name); got != want {
+			t.Errorf("LeavesName(%q) = %q, want %q", name, got, want)
+		}
+	}
+	if _, err := ParsePathRegex("(unclosed"); err == nil {
+		t.Error("Expected an error for a malformed regex")
+	}
+
+	exclude := &Filter{Exclude: []string{"*.tmp"}}
+	if !exclude.MatchName("a.txt") || exclude.MatchName("dir/a.TMP") {
+		t.Error("Expected only the .tmp file left out")
+	}
+
+	var r Reader
+	r.run = &run{}
+	r.LeaveOut(LeftName)
+	r.LeaveOut(LeftName)
+	r.LeaveOut(LeftTooLarge)
+	if left := r.HitsLeftOut(); left[LeftName] != 2 || left[LeftTooLarge] != 1 {
+		t.Errorf("Unexpected counts %v", left)
+	}
+}
@@ -0,0 +1,34 @@
+package disk
+
+// WrittenFile is a file a run recovered, as a Hook is told of it
+type WrittenFile struct {
+	Path     string // Written to
+	Original string // Path within its volume; "" for a carved file
+	Source   string // Filesystem it was recovered from, or "carved"
+	Type     string // Format of a carved file, such as JPEG
+	Offset   int64  // Of its first byte on the disk, for a carved file
+	Digest
+}
+
+// Hook is told of each file a run recovers once it is written, to pass it
+// on to an antivirus scan, OCR or an evidence system
+type Hook interface {
+	Recovered(f WrittenFile) error
+}
+
+// SetHook has h told of each file recovered from the disk, or no hook with
+// nil. The readers of its partitions share it.
+func (r *Reader) SetHook(h Hook) {
+	r.run.hook = h
+}
+
+// Recovered tells the disk's hook of a file recovered from it. A hook that
+// fails is reported and the run goes on.
+func (r *Reader) Recovered(f WrittenFile) {
+	if r.run.hook == nil {
+		return
+	}
+	if err := r.run.hook.Recovered(f); err != nil {
+		r.Errorf("  Hook failed for %s: %v\n", f.Path, err)
+	}
+}
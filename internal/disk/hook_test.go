@@ -0,0 +1,40 @@
+package disk
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// hookFunc is a function used as a Hook
+type hookFunc func(WrittenFile) error
+
+func (fn hookFunc) Recovered(f WrittenFile) error {
+	return fn(f)
+}
+
+func TestHook(t *testing.T) {
+	var out bytes.Buffer
+	reader := NewReader(bytes.NewReader(make([]byte, 4096)), 4096, "mem")
+	reader.SetReporter(NewPrinter(&out))
+	reader.Recovered(WrittenFile{Path: "a.txt"}) // No hook
+
+	part := reader.Partition(Partition{Index: 1, Offset: 1024, Size: 2048})
+	var got []string
+	reader.SetHook(hookFunc(func(f WrittenFile) error {
+		got = append(got, f.Path)
+		if f.Path == "b.txt" {
+			return errors.New("scanner unavailable")
+		}
+		return nil
+	}))
+	part.Recovered(WrittenFile{Path: "a.txt", Source: "ntfs"})
+	part.Recovered(WrittenFile{Path: "b.txt", Source: "ntfs"})
+
+	if len(got) != 2 || got[0] != "a.txt" || got[1] != "b.txt" {
+		t.Errorf("Expected the partition's files to reach the disk's hook, got %v", got)
+	}
+	if want := "  Hook failed for b.txt: scanner unavailable\n"; out.String() != want {
+		t.Errorf("Expected %q, got %q", want, out.String())
+	}
+}
@@ -0,0 +1,110 @@
+package disk
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// BadRange is a region of a disk that could not be read
+type BadRange struct {
+	Offset int64
+	Length int64
+}
+
+// ImageResult is what Image copied
+type ImageResult struct {
+	Digest            // Of the image written, the unreadable sectors as zeros
+	Bad    []BadRange // In order, adjacent sectors merged
+}
+
+// BadBytes returns how many bytes of the disk could not be read
+func (res ImageResult) BadBytes() int64 {
+	var n int64
+	for _, b := range res.Bad {
+		n += b.Length
+	}
+	return n
+}
+
+// Image copies the whole of a disk to w, blockSize bytes at a time, as dd
+// with conv=noerror,sync would: a block that fails to read is read again a
+// sector at a time, and the sectors that fail again are written as zeros
+// and listed in the result, so that the image keeps every offset of the
+// disk. Its progress is reported as the phase "imaging". Once the disk's
+// context is done it stops with its error.
+func Image(r *Reader, w io.Writer, blockSize int) (ImageResult, error) {
+	defer r.Purpose("image")()
+	if blockSize <= 0 {
+		blockSize = DefaultBufSize
+	}
+	sector := r.SectorSize()
+	blockSize = max(blockSize/sector, 1) * sector
+
+	var res ImageResult
+	dw := NewDigestWriter(w)
+	buf := make([]byte, blockSize)
+	size := r.Size()
+	for offset := int64(0); offset < size; {
+		block := buf[:min(int64(blockSize), size-offset)]
+		n, err := r.ReadAt(block, offset)
+		if err != nil && err != io.EOF || n < len(block) {
+			if ctxErr := r.Err(); ctxErr != nil {
+				res.Digest = dw.Digest()
+				return res, ctxErr
+			}
+			res.Bad = append(res.Bad, r.rescue(block, offset)...)
+		}
+		if _, err := dw.Write(block); err != nil {
+			res.Digest = dw.Digest()
+			return res, fmt.Errorf("failed to write image: %w", err)
+		}
+		offset += int64(len(block))
+		r.Report(Progress{Phase: "imaging", Current: offset, Total: size})
+	}
+	res.Bad = mergeBad(res.Bad)
+	res.Digest = dw.Digest()
+	return res, nil
+}
+
+// rescue reads a block that failed to read a sector at a time, zeroing the
+// sectors that fail again, and returns them
+func (r *Reader) rescue(block []byte, offset int64) []BadRange {
+	var found []BadRange
+	sector := r.SectorSize()
+	for i := 0; i < len(block); i += sector {
+		s := block[i:min(i+sector, len(block))]
+		n, err := r.ReadAt(s, offset+int64(i))
+		if n == len(s) && (err == nil || err == io.EOF) {
+			continue
+		}
+		clear(s)
+		found = append(found, BadRange{Offset: offset + int64(i), Length: int64(len(s))})
+	}
+	return found
+}
+
+// mergeBad merges ranges that follow one another
+func mergeBad(bad []BadRange) []BadRange {
+	var merged []BadRange
+	for _, b := range bad {
+		if n := len(merged); n > 0 && merged[n-1].Offset+merged[n-1].Length == b.Offset {
+			merged[n-1].Length += b.Length
+			continue
+		}
+		merged = append(merged, b)
+	}
+	return merged
+}
+
+// WriteBadRanges writes the regions an image could not read, a line each
+// with their offset and length in bytes, in hex as ddrescue's map files
+// give them
+func WriteBadRanges(w io.Writer, bad []BadRange) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# offset  length  (unreadable, written as zeros)")
+	for _, b := range bad {
+		fmt.Fprintf(bw, "0x%08X  0x%08X\n", b.Offset, b.Length)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,56 @@
+package disk
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestImage(t *testing.T) {
+	data := bytes.Repeat([]byte{0xAB}, 10000)
+	reader := NewReader(failingReaderAt{data: data, bad: 5000}, int64(len(data)), "bad.img")
+
+	var out bytes.Buffer
+	res, err := Image(reader, &out, 4096)
+	if err != nil {
+		t.Fatalf("Image failed: %v", err)
+	}
+	if out.Len() != len(data) || res.Size != int64(len(data)) {
+		t.Fatalf("Expected an image of %d bytes, got %d (digest %d)", len(data), out.Len(), res.Size)
+	}
+	// Only the sector holding the bad byte is lost
+	if len(res.Bad) != 1 || res.Bad[0] != (BadRange{Offset: 4608, Length: 512}) || res.BadBytes() != 512 {
+		t.Fatalf("Expected the sector at 4608 to be unreadable, got %+v", res.Bad)
+	}
+	want := append([]byte(nil), data...)
+	clear(want[4608:5120])
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Error("Expected the image to be the disk with the bad sector zeroed")
+	}
+	d := NewDigestWriter(&bytes.Buffer{})
+	d.Write(want)
+	if d.Digest() != res.Digest {
+		t.Errorf("Expected the digest of the image written, got %+v", res.Digest)
+	}
+
+	var m strings.Builder
+	if err := WriteBadRanges(&m, res.Bad); err != nil || !strings.Contains(m.String(), "0x00001200  0x00000200\n") {
+		t.Errorf("Unexpected map %q (%v)", m.String(), err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	reader.SetContext(ctx)
+	if _, err := Image(reader, &out, 4096); err != context.Canceled {
+		t.Errorf("Expected the context's error, got %v", err)
+	}
+}
+
+func TestMergeBad(t *testing.T) {
+	got := mergeBad([]BadRange{{0, 512}, {512, 512}, {2048, 512}})
+	want := []BadRange{{0, 1024}, {2048, 512}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,163 @@
+package disk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The messages of a run have levels: errors of the files or steps that
+// failed, warnings, what a run prints by default, the details a verbose
+// run adds, and what only helps find a fault in the tool. A Logger shows
+// those of its level and above, and can keep them, never fewer than a
+// normal run shows, in a JSON log, one a line, where they outlast the
+// terminal's scrollback:
+//
+//	{"time":"2024-03-01T10:15:09Z","level":"error","text":"Failed to recover Users/anna/cv.docx: read error at offset 1048576"}
+
+// Level is how much a message of a run matters, and the verbosity of a
+// Logger: how much of them it shows
+type Level int
+
+// Levels, from the messages that matter most
+const (
+	LevelError   Level = iota // A file or step that failed
+	LevelWarn                 // Something to look at, which the run got past
+	LevelInfo                 // What a run shows by default
+	LevelVerbose              // Details, such as the geometry of a filesystem
+	LevelDebug                // What helps find a fault, such as failed reads
+)
+
+var levelNames = [...]string{"error", "warn", "info", "verbose", "debug"}
+
+func (l Level) String() string {
+	if l < 0 || int(l) >= len(levelNames) {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses a verbosity: quiet (errors and warnings only), normal,
+// verbose or debug
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "quiet":
+		return LevelWarn, nil
+	case "", "normal":
+		return LevelInfo, nil
+	case "verbose":
+		return LevelVerbose, nil
+	case "debug":
+		return LevelDebug, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q (want quiet, normal, verbose or debug)", s)
+}
+
+// LevelReporter is a ProgressReporter that tells messages apart by level;
+// other reporters are given only those of LevelInfo and above, as
+// messages
+type LevelReporter interface {
+	ProgressReporter
+	Log(level Level, text string)
+}
+
+// Logger is a ProgressReporter that passes on the messages of its level
+// and above, and progress unless it is quiet, to another reporter, and
+// can log messages as JSON
+type Logger struct {
+	rep   ProgressReporter
+	level Level
+
+	mu  sync.Mutex
+	log *json.Encoder // nil = no log
+	now func() time.Time
+	err error // First write error of the log
+}
+
+type logEntry struct {
+	Time  time.Time `json:"time"`
+	Level string    `json:"level"`
+	Text  string    `json:"text"`
+}
+
+// NewLogger returns a Logger passing what it is given at level to rep
+func NewLogger(rep ProgressReporter, level Level) *Logger {
+	return &Logger{rep: rep, level: level, now: time.Now}
+}
+
+// LogTo logs the messages of the logger's level and above, and never
+// fewer than LevelInfo, to w as JSON, one a line
+func (l *Logger) LogTo(w io.Writer) {
+	l.mu.Lock()
+	l.log = json.NewEncoder(w)
+	l.mu.Unlock()
+}
+
+// Err returns the first error writing the log
+func (l *Logger) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+func (l *Logger) Log(level Level, text string) {
+	if level <= l.level {
+		if lr, ok := l.rep.(LevelReporter); ok {
+			lr.Log(level, text)
+		} else {
+			l.rep.Message(text)
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	text = strings.TrimSpace(text)
+	if l.log == nil || l.err != nil || text == "" || level > max(l.level, LevelInfo) {
+		return
+	}
+	l.err = l.log.Encode(logEntry{Time: l.now().UTC(), Level: level.String(), Text: text})
+}
+
+func (l *Logger) Message(text string) {
+	l.Log(LevelInfo, text)
+}
+
+func (l *Logger) Progress(p Progress) {
+	if l.level >= LevelInfo {
+		l.rep.Progress(p)
+	}
+}
+
+// Logf reports a message of a run at a level, formatted as by fmt.Printf
+func (r *Reader) Logf(level Level, format string, args ...any) {
+	text := fmt.Sprintf(format, args...)
+	rep := r.Reporter()
+	if lr, ok := rep.(LevelReporter); ok {
+		lr.Log(level, text)
+	} else if level <= LevelInfo {
+		rep.Message(text)
+	}
+}
+
+// Errorf reports a file or step of a run that failed
+func (r *Reader) Errorf(format string, args ...any) {
+	r.Logf(LevelError, format, args...)
+}
+
+// Warnf reports something a run got past that is worth a look
+func (r *Reader) Warnf(format string, args ...any) {
+	r.Logf(LevelWarn, format, args...)
+}
+
+// Verbosef reports a detail only a verbose run shows
+func (r *Reader) Verbosef(format string, args ...any) {
+	r.Logf(LevelVerbose, format, args...)
+}
+
+// Debugf reports what only helps find a fault in the tool
+func (r *Reader) Debugf(format string, args ...any) {
+	r.Logf(LevelDebug, format, args...)
+}
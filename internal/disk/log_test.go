@@ -0,0 +1,77 @@
+package disk
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLevel(t *testing.T) {
+	for s, want := range map[string]Level{"quiet": LevelWarn, "": LevelInfo, "Normal": LevelInfo, "verbose": LevelVerbose, "debug": LevelDebug} {
+		if got, err := ParseLevel(s); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var out, log bytes.Buffer
+	reader := NewReader(bytes.NewReader(make([]byte, 4096)), 4096, "mem")
+	logger := NewLogger(NewPrinter(&out), LevelWarn)
+	logger.now = func() time.Time { return time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC) }
+	logger.LogTo(&log)
+	reader.SetReporter(logger)
+
+	reader.Printf("Found %d deleted files\n", 2)
+	reader.Verbosef("  Cluster size: %d bytes\n", 4096)
+	reader.Errorf("  Failed to recover %s: %v\n", "a.txt", "read error")
+	reader.Warnf("Warning: %s\n", "low on space")
+	reader.Report(Progress{Phase: "carving scan", Current: 1, Total: 2})
+	if err := logger.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Quiet shows only the failure and the warning; the log keeps what a
+	// normal run shows
+	if want := "  Failed to recover a.txt: read error\nWarning: low on space\n"; out.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, out.String())
+	}
+	var levels []string
+	for _, line := range strings.Split(strings.TrimSpace(log.String()), "\n") {
+		var e struct{ Time, Level, Text string }
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("Log line is not JSON: %v", err)
+		}
+		if e.Time != "2024-03-01T10:00:00Z" {
+			t.Errorf("Unexpected time %q", e.Time)
+		}
+		levels = append(levels, e.Level+": "+e.Text)
+	}
+	want := []string{"info: Found 2 deleted files", "error: Failed to recover a.txt: read error", "warn: Warning: low on space"}
+	if strings.Join(levels, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected log:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(levels, "\n"))
+	}
+
+	// A reporter that does not tell levels apart gets the usual messages
+	out.Reset()
+	reader.SetReporter(NewPrinter(&out))
+	reader.Debugf("  Read failed\n")
+	reader.Errorf("  Failed to recover b.txt\n")
+	if out.String() != "  Failed to recover b.txt\n" {
+		t.Errorf("Unexpected messages %q", out.String())
+	}
+
+	// JSON events carry the level
+	out.Reset()
+	events := NewJSONEvents(&out)
+	reader.SetReporter(NewLogger(events, LevelDebug))
+	reader.Debugf("  Read failed\n")
+	if !strings.Contains(out.String(), `"level":"debug","text":"Read failed"`) {
+		t.Errorf("Expected a debug event, got %s", out.String())
+	}
+}
@@ -0,0 +1,152 @@
+package disk
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A hash manifest lists the digests of the files a run recovered, taken as
+// they were written, so that copies can be shown to be what was read from
+// the disk. It is written twice below the output directory: for sha256sum,
+//
+//	sha256sum -c hashes.sha256
+//
+// and as JSON with the MD5, SHA-256 and size of each file. Paths are
+// relative to the output directory. A file written under another name than
+// its own, because a file before it had the same path, has that path in the
+// JSON as its original. Only files written in full are listed, and the JSON
+// says of each whether it was also flushed to the drive ("synced") or only
+// written ("complete"); a run stopped in the middle of a file leaves it
+// under a .part name, unlisted. Files verified after the run (see Verify)
+// say how that went.
+
+// Hash manifests written below an output directory
+const (
+	ManifestSHA256 = "hashes.sha256"
+	ManifestJSON   = "hashes.json"
+)
+
+// Digest is the size and digests of a file's content
+type Digest struct {
+	Size   int64  `json:"size"`
+	MD5    string `json:"md5"`
+	SHA256 string `json:"sha256"`
+}
+
+// DigestWriter passes writes on to a writer and digests what it wrote
+type DigestWriter struct {
+	w           io.Writer
+	md5, sha256 hash.Hash
+	size        int64
+}
+
+// NewDigestWriter returns a DigestWriter writing to w
+func NewDigestWriter(w io.Writer) *DigestWriter {
+	return &DigestWriter{w: w, md5: md5.New(), sha256: sha256.New()}
+}
+
+func (d *DigestWriter) Write(p []byte) (int, error) {
+	n, err := d.w.Write(p)
+	d.md5.Write(p[:n])
+	d.sha256.Write(p[:n])
+	d.size += int64(n)
+	return n, err
+}
+
+// Digest returns the digest of what has been written
+func (d *DigestWriter) Digest() Digest {
+	return Digest{
+		Size:   d.size,
+		MD5:    hex.EncodeToString(d.md5.Sum(nil)),
+		SHA256: hex.EncodeToString(d.sha256.Sum(nil)),
+	}
+}
+
+// DigestSource reads the whole of a disk and returns its digest
+func DigestSource(r *Reader) (Digest, error) {
+	defer r.Purpose("source hash")()
+	w := NewDigestWriter(io.Discard)
+	_, err := io.CopyBuffer(w, io.NewSectionReader(r, 0, r.Size()), make([]byte, DefaultBufSize))
+	return w.Digest(), err
+}
+
+// ManifestEntry is a file in a hash manifest
+type ManifestEntry struct {
+	Path     string `json:"path"`               // Relative to the manifest, with forward slashes
+	Original string `json:"original,omitempty"` // Path it would have had, when another file had taken it (see Names)
+	Status   string `json:"status,omitempty"`   // StatusComplete or StatusSynced; none in manifests of earlier versions
+	Verified string `json:"verified,omitempty"` // VerifyOK, VerifyMismatch or VerifyUnreadable, when verified
+	Digest
+}
+
+type manifest struct {
+	Created string          `json:"created"`
+	Files   []ManifestEntry `json:"files"`
+}
+
+// IsManifest reports whether a file name is that of a hash manifest
+func IsManifest(name string) bool {
+	return name == ManifestSHA256 || name == ManifestJSON
+}
+
+// WriteManifest writes the hash manifests of files to dir
+func WriteManifest(dir string, files []ManifestEntry) error {
+	if files == nil {
+		files = []ManifestEntry{}
+	}
+	data, err := json.MarshalIndent(manifest{Created: time.Now().UTC().Format(time.RFC3339), Files: files}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, ManifestJSON), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(dir, ManifestSHA256))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	for _, e := range files {
+		fmt.Fprintln(w, sumLine(e.SHA256, e.Path))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// LoadManifest reads the JSON hash manifest in dir
+func LoadManifest(dir string) ([]ManifestEntry, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestJSON))
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid hash manifest: %w", err)
+	}
+	return m.Files, nil
+}
+
+// sumLine formats a line of sha256sum output, which escapes backslashes and
+// newlines in the name and then marks the line with a leading backslash
+func sumLine(sum, path string) string {
+	if !strings.ContainsAny(path, "\\\n") {
+		return sum + "  " + path
+	}
+	path = strings.ReplaceAll(path, "\\", "\\\\")
+	path = strings.ReplaceAll(path, "\n", "\\n")
+	return "\\" + sum + "  " + path
+}
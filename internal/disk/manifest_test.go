@@ -0,0 +1,67 @@
+package disk
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDigestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewDigestWriter(&buf)
+	w.Write([]byte("hello "))
+	w.Write([]byte("world"))
+
+	want := Digest{
+		Size:   11,
+		MD5:    "5eb63bbbe01eeed093cb22bb8f5acdc3",
+		SHA256: "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+	}
+	if got := w.Digest(); got != want || buf.String() != "hello world" {
+		t.Errorf("Expected %+v after writing through, got %+v (%q)", want, got, buf.String())
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	dir := t.TempDir()
+	files := []ManifestEntry{
+		{Path: "jpg/carved_000001.jpg", Digest: Digest{Size: 3, MD5: "m1", SHA256: "aa"}},
+		{Path: `odd\name`, Digest: Digest{Size: 4, MD5: "m2", SHA256: "bb"}},
+	}
+	if err := WriteManifest(dir, files); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+
+	sums, err := os.ReadFile(filepath.Join(dir, ManifestSHA256))
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", ManifestSHA256, err)
+	}
+	if want := "aa  jpg/carved_000001.jpg\n\\bb  odd\\\\name\n"; string(sums) != want {
+		t.Errorf("Expected sha256sum lines %q, got %q", want, sums)
+	}
+
+	loaded, err := LoadManifest(dir)
+	if err != nil || !reflect.DeepEqual(loaded, files) {
+		t.Errorf("Expected %+v back, got %+v (%v)", files, loaded, err)
+	}
+	if !IsManifest(ManifestJSON) || IsManifest("report.tsv") {
+		t.Error("IsManifest does not recognize the manifests")
+	}
+}
+
+func TestDigestSource(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "test.img")
+	os.WriteFile(tmpFile, []byte("hello world"), 0644)
+	reader, err := Open(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer reader.Close()
+
+	digest, err := DigestSource(reader)
+	if err != nil || digest.Size != 11 || digest.SHA256 != "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9" {
+		t.Errorf("Unexpected digest %+v (%v)", digest, err)
+	}
+}
@@ -0,0 +1,109 @@
+package disk
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Names hands out the paths recovered files are written to, so that every
+// file can be written wherever the output directory lies and files with the
+// same path are all kept rather than each overwriting the last.
+//
+// A path is first made safe (see SafePath): a name NTFS allows but Windows,
+// exFAT or a Samba share would refuse, such as "a:b", "CON" or "notes.",
+// is changed, and no name can lead out of the output directory. Deleted
+// FAT32 files lose the first letter of their short name, which comes back
+// as "?", so OLD.TXT and BLD.TXT deleted from one directory both become
+// _LD.TXT; the second is written as "_LD (2).TXT". Paths are compared
+// without case, as the output may be on a filesystem that ignores it, and
+// are handed out in the order asked for, so the same scan names files the
+// same way every time.
+type Names struct {
+	taken map[string]bool
+}
+
+// NewNames returns Names with no path taken
+func NewNames() *Names {
+	return &Names{taken: make(map[string]bool)}
+}
+
+// Claim returns the safe form of path if no file has taken it, or else the
+// first of "name (2).ext", "name (3).ext", ... that is free, and takes it
+func (n *Names) Claim(path string) string {
+	path = SafePath(path)
+	claimed := path
+	ext := filepath.Ext(path)
+	if ext == filepath.Base(path) {
+		ext = "" // A dot file, such as .bashrc, is all name
+	}
+	base := strings.TrimSuffix(path, ext)
+	for i := 2; n.taken[strings.ToLower(claimed)]; i++ {
+		claimed = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	n.taken[strings.ToLower(claimed)] = true
+	return claimed
+}
+
+// maxName is the longest name, in bytes, most filesystems take
+const maxName = 255
+
+// reservedNames are the device names Windows reserves, with any extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SafePath returns a relative path, with the separators of this system,
+// that can be created below a directory on any common filesystem and stays
+// below it. Both / and \ separate names; in each, control characters and
+// <>:"|?* become "_", as do bytes that are not UTF-8, trailing dots and
+// spaces are dropped, a reserved device name gets a leading "_", and a
+// name longer than 255 bytes is cut, keeping its extension. Empty names,
+// "." and ".." become "_".
+func SafePath(path string) string {
+	var names []string
+	for _, name := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '\\' }) {
+		names = append(names, safeName(name))
+	}
+	if len(names) == 0 {
+		return "_"
+	}
+	return filepath.Join(names...)
+}
+
+// safeName makes a single name safe
+func safeName(name string) string {
+	name = strings.ToValidUTF8(name, "_")
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7F || strings.ContainsRune(`<>:"|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimRight(name, ". ")
+	if name == "" {
+		return "_"
+	}
+	stem := name
+	if i := strings.IndexByte(stem, '.'); i >= 0 {
+		stem = stem[:i]
+	}
+	if reservedNames[strings.ToUpper(strings.TrimRight(stem, " "))] {
+		name = "_" + name
+	}
+	if len(name) > maxName {
+		ext := filepath.Ext(name)
+		if len(ext) > maxName/2 {
+			ext = ""
+		}
+		stem := name[:maxName-len(ext)]
+		for !utf8.ValidString(stem) {
+			stem = stem[:len(stem)-1] // Cut at a character
+		}
+		name = stem + ext
+	}
+	return name
+}
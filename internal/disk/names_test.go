@@ -0,0 +1,53 @@
+package disk
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNames(t *testing.T) {
+	n := NewNames()
+	for _, c := range []struct{ path, want string }{
+		{"docs/?LD.TXT", "docs/_LD.TXT"},
+		{"docs/?LD.TXT", "docs/_LD (2).TXT"},
+		{"docs/_ld.txt", "docs/_ld (3).txt"}, // Case does not tell paths apart
+		{"docs/_LD (2).TXT", "docs/_LD (2) (2).TXT"},
+		{"other/?LD.TXT", "other/_LD.TXT"},
+		{"home/.bashrc", "home/.bashrc"},
+		{"home/.bashrc", "home/.bashrc (2)"},
+		{"Makefile", "Makefile"},
+		{"Makefile", "Makefile (2)"},
+	} {
+		if got := n.Claim(c.path); got != filepath.FromSlash(c.want) {
+			t.Errorf("Claim(%q) = %q, want %q", c.path, got, c.want)
+		}
+	}
+}
+
+func TestSafePath(t *testing.T) {
+	long := strings.Repeat("é", 200) + ".docx"
+	for _, c := range []struct{ path, want string }{
+		{"Users/anna/report.docx", "Users/anna/report.docx"},
+		{"/Users/anna//report.docx", "Users/anna/report.docx"},
+		{"../../etc/passwd", "_/_/etc/passwd"},
+		{`..\..\Windows\win.ini`, "_/_/Windows/win.ini"},
+		{"a/./b", "a/_/b"},
+		{"", "_"},
+		{"/", "_"},
+		{`file:stream`, "file_stream"},
+		{`what?<>"|*.txt`, "what______.txt"},
+		{"tab\there", "tab_here"},
+		{"notes. ", "notes"},
+		{"CON", "_CON"},
+		{"nul.txt", "_nul.txt"},
+		{"lpt1 .log", "_lpt1 .log"},
+		{"CONFIG.SYS", "CONFIG.SYS"},
+		{"bad\xffname", "bad_name"},
+		{long, strings.Repeat("é", 125) + ".docx"},
+	} {
+		if got := SafePath(c.path); got != filepath.FromSlash(c.want) {
+			t.Errorf("SafePath(%q) = %q, want %q", c.path, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package disk
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Recovered files can be written compressed, so that a database or virtual
+// disk image that is mostly empty, or the whole of a large volume, fits on
+// an output drive smaller than it. Each file is compressed on its own with
+// zstd and named with .zst added, so one file can be opened without the
+// others:
+//
+//	zstd -d Users/anna/mail.pst.zst
+//
+// The compression is set on the disk, and holds for the readers of its
+// partitions, so every recovery reading from it writes the same way. The
+// digests kept of a file, in hash manifests, reports and sessions, are of
+// what was recovered, not of the compressed file, so they match the file
+// once decompressed and any copy of it found elsewhere.
+//
+// Files written as they are are written sparse: a block of zeros, such as
+// a sparse NTFS run or the unused space of a virtual disk or database, is
+// left as a hole rather than written, on the filesystems that have them
+// (NTFS, ext4, XFS, APFS, Btrfs, ...). A hole reads as zeros, so the file
+// is the same to anything reading it, but it takes only the space of the
+// blocks that hold data. Copying a file with a tool that does not keep
+// holes fills them in.
+//
+// A file is written under a temporary name, .recover-*.part in the same
+// directory, and renamed to its own once it is complete, so a run that is
+// interrupted or fails to read a file never leaves part of it looking
+// like the whole. With SyncOutput, each file is flushed to the drive
+// before it is renamed, and its directory after, so a file with its own
+// name has also survived a power cut.
+
+// Compressions of recovered files
+const (
+	CompressNone = ""
+	CompressZstd = "zstd"
+)
+
+// ZstdSuffix is added to the names of files written compressed with zstd
+const ZstdSuffix = ".zst"
+
+// PartPattern names the files being written, as os.CreateTemp takes it
+const PartPattern = ".recover-*.part"
+
+// ParseCompression checks the name of a compression, "" or "none" for none
+func ParseCompression(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return CompressNone, nil
+	case CompressZstd:
+		return CompressZstd, nil
+	}
+	return "", fmt.Errorf("unknown compression %q (want zstd or none)", s)
+}
+
+// Compress makes the files recovered from the disk, and from the readers of
+// its partitions, be written with compression
+func (r *Reader) Compress(compression string) {
+	r.output.compression = compression
+}
+
+// WriteLike makes the files recovered from the disk be written as those
+// recovered from other are, within the same limits, and its run stop with
+// other's
+func (r *Reader) WriteLike(other *Reader) {
+	r.output = other.output
+	r.run = other.run
+}
+
+// OutputPath returns the name a file recovered from the disk to path is
+// written under
+func (r *Reader) OutputPath(path string) string {
+	if r.output.compression == CompressZstd {
+		return path + ZstdSuffix
+	}
+	return path
+}
+
+// Completion of the files in a hash manifest
+const (
+	StatusComplete = "complete" // Written in full
+	StatusSynced   = "synced"   // Written in full and flushed to the drive
+)
+
+// SyncOutput makes every file recovered from the disk, and from the readers
+// of its partitions, be flushed to the drive before it is given its name
+func (r *Reader) SyncOutput(sync bool) {
+	r.output.sync = sync
+}
+
+// OutputStatus returns the completion of a file recovered from the disk
+// once it has been written
+func (r *Reader) OutputStatus() string {
+	if r.output.sync {
+		return StatusSynced
+	}
+	return StatusComplete
+}
+
+// OutputFile is a recovered file being written, compressed as the disk it
+// was recovered from says or else sparse, digesting what is written to it
+type OutputFile struct {
+	*DigestWriter
+	path   string // Given once complete
+	f      *limitedFile
+	enc    *zstd.Encoder
+	sparse *sparseFile
+}
+
+// CreateOutput starts a file for what is recovered from the disk, and the
+// directories it is in; Close gives it path, which OutputPath gives, and
+// Discard drops it. Past the limit on the output, it fails with
+// ErrOutputFull.
+func (r *Reader) CreateOutput(path string) (*OutputFile, error) {
+	if r.output.discard {
+		return &OutputFile{DigestWriter: NewDigestWriter(io.Discard)}, nil
+	}
+	if r.output.isFull() {
+		r.output.skip(path)
+		return nil, ErrOutputFull
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), PartPattern)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	f := &limitedFile{File: file, output: r.output}
+	out := &OutputFile{path: path, f: f}
+	var w io.Writer
+	if r.output.compression == CompressZstd {
+		// One file at a time is written, and many are small
+		if out.enc, err = zstd.NewWriter(f, zstd.WithEncoderConcurrency(1)); err != nil {
+			out.Discard()
+			return nil, err
+		}
+		w = out.enc
+	} else {
+		out.sparse = &sparseFile{f: f}
+		w = out.sparse
+	}
+	out.DigestWriter = NewDigestWriter(w)
+	return out, nil
+}
+
+// WriteZeros writes n zeros, as for a sparse run, without holding them
+func (o *OutputFile) WriteZeros(n int64) error {
+	for n > 0 {
+		chunk := min(n, int64(len(zeroBlock)))
+		if _, err := o.Write(zeroBlock[:chunk]); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// OpenEntry returns a reader of a file of a volume on the disk, as its
+// filesystem lists it: its resident data, or its extents in turn
+func (r *Reader) OpenEntry(e FileEntry) io.Reader {
+	parts := []io.Reader{bytes.NewReader(e.Resident)}
+	for _, ext := range Limit(e.Extents, e.Size) {
+		parts = append(parts, io.NewSectionReader(r, ext.Offset, ext.Length))
+	}
+	return io.MultiReader(parts...)
+}
+
+// WriteEntry writes a file of a volume on the disk, as OpenEntry reads it,
+// to path
+func (r *Reader) WriteEntry(e FileEntry, path string) (Digest, error) {
+	out, err := r.CreateOutput(path)
+	if err != nil {
+		return Digest{}, err
+	}
+	defer out.Discard()
+	if _, err := io.Copy(out, r.OpenEntry(e)); err != nil {
+		return Digest{}, err
+	}
+	return out.Digest(), out.Close()
+}
+
+// Zeros returns a reader of n zeros, as for a sparse run
+func Zeros(n int64) io.Reader {
+	return io.LimitReader(zeroReader{}, n)
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// Close finishes the file and gives it its name, or drops it if it went
+// past the limit on the output; closing it again does nothing
+func (o *OutputFile) Close() error {
+	if o.f == nil {
+		return nil
+	}
+	f := o.f
+	var err error
+	if o.enc != nil {
+		err = o.enc.Close()
+	}
+	if o.sparse != nil {
+		err = o.sparse.finish()
+	}
+	if err == nil && f.output.sync {
+		err = f.Sync()
+	}
+	if f.full {
+		o.Discard()
+		f.output.skip(o.path)
+		return ErrOutputFull
+	}
+	if err != nil {
+		o.Discard()
+		return err
+	}
+	o.f = nil
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), o.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if f.output.sync {
+		syncDir(filepath.Dir(o.path))
+	}
+	return nil
+}
+
+// Discard drops the file unless it has been closed, as when reading what
+// it was to hold failed
+func (o *OutputFile) Discard() {
+	if o.f == nil {
+		return
+	}
+	o.f.Close()
+	os.Remove(o.f.Name())
+	o.f = nil
+}
+
+// syncDir flushes the names in a directory to the drive, where the system
+// allows it
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// OpenOutput opens a file recovered from the disk to read what was
+// recovered, decompressing it if it was written compressed
+func (r *Reader) OpenOutput(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if r.output.compression != CompressZstd || !strings.HasSuffix(path, ZstdSuffix) {
+		return f, nil
+	}
+	dec, err := zstd.NewReader(f, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &decompressed{dec, f}, nil
+}
+
+type decompressed struct {
+	*zstd.Decoder
+	f *os.File
+}
+
+func (d *decompressed) Close() error {
+	d.Decoder.Close()
+	return d.f.Close()
+}
+
+// sparseBlock is the size of the blocks of zeros left as holes, the block
+// size of most filesystems
+const sparseBlock = 4096
+
+// zeroBlock is a run of zeros to write from
+var zeroBlock [64 * sparseBlock]byte
+
+// sparseTarget is what a sparse file is written to
+type sparseTarget interface {
+	io.WriterAt
+	Truncate(size int64) error
+}
+
+// sparseFile writes a file, skipping over the blocks of it that would be
+// all zeros. A block written in pieces is held until it is whole.
+type sparseFile struct {
+	f       sparseTarget
+	size    int64  // Of the file so far
+	written int64  // End of the last data written
+	pending []byte // Start of the last block, not written yet
+}
+
+func (s *sparseFile) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(s.pending) > 0 {
+		fill := min(len(p), sparseBlock-len(s.pending))
+		s.pending = append(s.pending, p[:fill]...)
+		s.size += int64(fill)
+		p = p[fill:]
+		if len(s.pending) < sparseBlock {
+			return n, nil
+		}
+		if !isZero(s.pending) {
+			if err := s.writeAt(s.pending, s.size-sparseBlock); err != nil {
+				return 0, err
+			}
+		}
+		s.pending = s.pending[:0]
+	}
+
+	// Data between blocks of zeros goes out in one write
+	whole := len(p) - len(p)%sparseBlock
+	data := 0
+	for i := 0; i < whole; i += sparseBlock {
+		if isZero(p[i : i+sparseBlock]) {
+			if err := s.writeAt(p[data:i], s.size+int64(data)); err != nil {
+				return 0, err
+			}
+			data = i + sparseBlock
+		}
+	}
+	if err := s.writeAt(p[data:whole], s.size+int64(data)); err != nil {
+		return 0, err
+	}
+	s.pending = append(s.pending, p[whole:]...)
+	s.size += int64(len(p))
+	return n, nil
+}
+
+func (s *sparseFile) writeAt(p []byte, off int64) error {
+	if len(p) == 0 {
+		return nil
+	}
+	if _, err := s.f.WriteAt(p, off); err != nil {
+		return err
+	}
+	s.written = off + int64(len(p))
+	return nil
+}
+
+// finish writes the last block and gives the file its full size when it
+// ends in a hole
+func (s *sparseFile) finish() error {
+	if err := s.writeAt(s.pending, s.size-int64(len(s.pending))); err != nil {
+		return err
+	}
+	s.pending = nil
+	if s.written < s.size {
+		return s.f.Truncate(s.size)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package disk
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateOutput(t *testing.T) {
+	content := bytes.Repeat([]byte("mostly empty database page "), 4096)
+	dir := t.TempDir()
+
+	for _, compression := range []string{CompressNone, CompressZstd} {
+		r := NewReader(bytes.NewReader(make([]byte, 1<<20)), 1<<20, "test.img")
+		r.Compress(compression)
+		// The partitions of a disk are written the same way
+		r = r.Partition(Partition{Index: 1, Offset: 0, Size: 1 << 19})
+
+		path := r.OutputPath(filepath.Join(dir, compression, "Users", "mail.pst"))
+		out, err := r.CreateOutput(path)
+		if err != nil {
+			t.Fatalf("%q: failed to create %s: %v", compression, path, err)
+		}
+		out.Write(content)
+		if err := out.Close(); err != nil {
+			t.Fatalf("%q: failed to write %s: %v", compression, path, err)
+		}
+		if err := out.Close(); err != nil {
+			t.Errorf("%q: expected closing again to do nothing, got %v", compression, err)
+		}
+		if d := out.Digest(); d.Size != int64(len(content)) {
+			t.Errorf("%q: expected the digest of %d bytes, got %+v", compression, len(content), d)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("%q: %v", compression, err)
+		}
+		switch compression {
+		case CompressNone:
+			if filepath.Ext(path) != ".pst" || info.Size() != int64(len(content)) {
+				t.Errorf("Expected %s to be written as it is, got %d bytes", path, info.Size())
+			}
+		case CompressZstd:
+			if filepath.Ext(path) != ZstdSuffix || info.Size() >= int64(len(content))/10 {
+				t.Errorf("Expected %s to be compressed, got %d bytes", path, info.Size())
+			}
+		}
+
+		in, err := r.OpenOutput(path)
+		if err != nil {
+			t.Fatalf("%q: failed to open %s: %v", compression, path, err)
+		}
+		data, err := io.ReadAll(in)
+		in.Close()
+		if err != nil || !bytes.Equal(data, content) {
+			t.Errorf("%q: expected the recovered content back, got %d bytes (%v)", compression, len(data), err)
+		}
+	}
+}
+
+func TestOutputAtomic(t *testing.T) {
+	dir := t.TempDir()
+	r := NewReader(bytes.NewReader(make([]byte, 1<<20)), 1<<20, "test.img")
+	parts := func() []string {
+		matches, _ := filepath.Glob(filepath.Join(dir, PartPattern))
+		return matches
+	}
+
+	path := filepath.Join(dir, "report.docx")
+	out, err := r.CreateOutput(path)
+	if err != nil {
+		t.Fatalf("Failed to create %s: %v", path, err)
+	}
+	out.Write([]byte("half a report"))
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to have no name before it is complete", path)
+	}
+	if len(parts()) != 1 {
+		t.Errorf("Expected one file being written, got %v", parts())
+	}
+	// A failed read drops what was written
+	out.Discard()
+	if _, err := os.Stat(path); !os.IsNotExist(err) || len(parts()) != 0 {
+		t.Errorf("Expected a discarded file to leave nothing, got %v", parts())
+	}
+
+	r.SyncOutput(true)
+	if r.OutputStatus() != StatusSynced {
+		t.Errorf("Expected synced files, got %q", r.OutputStatus())
+	}
+	out, _ = r.CreateOutput(path)
+	out.Write([]byte("the whole report"))
+	if err := out.Close(); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+	out.Discard() // Once closed, the file stays
+	if data, err := os.ReadFile(path); err != nil || string(data) != "the whole report" {
+		t.Errorf("Expected the whole report, got %q (%v)", data, err)
+	}
+	if info, _ := os.Stat(path); info != nil && info.Mode().Perm() != 0644 {
+		t.Errorf("Expected %s to be readable by all, got %v", path, info.Mode())
+	}
+	if len(parts()) != 0 {
+		t.Errorf("Expected no file left being written, got %v", parts())
+	}
+}
+
+func TestOpenEntry(t *testing.T) {
+	data := []byte("....hello, ....world!....")
+	reader := NewReader(bytes.NewReader(data), int64(len(data)), "mem")
+
+	e := FileEntry{Path: "a.txt", Size: 12, Extents: []Extent{{Offset: 4, Length: 7}, {Offset: 15, Length: 10}}}
+	if got, err := io.ReadAll(reader.OpenEntry(e)); err != nil || string(got) != "hello, world" {
+		t.Errorf("Expected the extents cut to the size, got %q (%v)", got, err)
+	}
+	e = FileEntry{Path: "b.txt", Size: 5, Resident: []byte("small")}
+	if got, err := io.ReadAll(reader.OpenEntry(e)); err != nil || string(got) != "small" {
+		t.Errorf("Expected the resident data, got %q (%v)", got, err)
+	}
+	if got, err := io.ReadAll(Zeros(5)); err != nil || !bytes.Equal(got, make([]byte, 5)) {
+		t.Errorf("Expected 5 zeros, got %v (%v)", got, err)
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for s, want := range map[string]string{"": CompressNone, "none": CompressNone, "zstd": CompressZstd, "ZSTD": CompressZstd} {
+		if got, err := ParseCompression(s); err != nil || got != want {
+			t.Errorf("ParseCompression(%q) = %q, %v; want %q", s, got, err, want)
+		}
+	}
+	if _, err := ParseCompression("gzip"); err == nil {
+		t.Error("Expected an unknown compression to be rejected")
+	}
+}
+
+// recordedFile keeps what is written to it and where
+type recordedFile struct {
+	data   []byte
+	writes [][2]int64 // Offset and length
+}
+
+func (r *recordedFile) WriteAt(p []byte, off int64) (int, error) {
+	if end := off + int64(len(p)); end > int64(len(r.data)) {
+		r.data = append(r.data, make([]byte, end-int64(len(r.data)))...)
+	}
+	copy(r.data[off:], p)
+	r.writes = append(r.writes, [2]int64{off, int64(len(p))})
+	return len(p), nil
+}
+
+func (r *recordedFile) Truncate(size int64) error {
+	r.data = append(r.data, make([]byte, size-int64(len(r.data)))...)
+	return nil
+}
+
+func TestSparseFile(t *testing.T) {
+	// Data, a hole of two blocks that arrives in pieces, data that is not
+	// a whole block, and a hole at the end
+	content := make([]byte, 10*sparseBlock)
+	copy(content, "header")
+	copy(content[3*sparseBlock+100:], "middle")
+	copy(content[5*sparseBlock-1:], "x")
+
+	f := &recordedFile{}
+	s := &sparseFile{f: f}
+	for _, cut := range []int{100, sparseBlock + 50, 3 * sparseBlock, 10 * sparseBlock} {
+		if _, err := s.Write(content[s.size:cut]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.finish(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.data, content) {
+		t.Fatalf("Expected the content back, got %d bytes", len(f.data))
+	}
+	var written int64
+	for _, w := range f.writes {
+		written += w[1]
+	}
+	if written != 3*sparseBlock {
+		t.Errorf("Expected only the 3 blocks with data written, got %d bytes in %v", written, f.writes)
+	}
+
+	// Through an output file, with the zeros of a sparse run
+	path := filepath.Join(t.TempDir(), "disk.vhd")
+	r := NewReader(bytes.NewReader(nil), 0, "test.img")
+	out, err := r.CreateOutput(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Write([]byte("header"))
+	out.WriteZeros(1 << 20)
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if len(data) != 6+1<<20 || string(data[:6]) != "header" || out.Digest().Size != int64(len(data)) {
+		t.Errorf("Expected the header and 1MB of zeros, got %d bytes", len(data))
+	}
+}
@@ -0,0 +1,176 @@
+package disk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Partition is an entry of a disk's partition table
+type Partition struct {
+	Index  int    // Position in the table, from 1; logical MBR partitions follow the primary ones
+	Offset int64  // Start in bytes
+	Size   int64  // Length in bytes
+	Type   string // MBR partition type in hex, or the GPT partition type GUID
+}
+
+const (
+	gptProtective = 0xEE
+	maxLogical    = 128 // Bound on the chain of extended boot records
+)
+
+// Partitions reads the GPT or MBR partition table of a disk. It returns nil
+// when the disk starts with a filesystem or has no valid table.
+func Partitions(r *Reader) []Partition {
+	mbr := make([]byte, SectorSize)
+	if _, err := r.ReadAt(mbr, 0); err != nil || mbr[510] != 0x55 || mbr[511] != 0xAA {
+		return nil
+	}
+	// Boot sectors of FAT and NTFS volumes end with the same marker
+	if _, err := DetectFilesystem(r); err == nil {
+		return nil
+	}
+
+	entries := mbrEntries(mbr)
+	for _, e := range entries {
+		if e.typ == gptProtective {
+			return gptPartitions(r)
+		}
+	}
+
+	var parts []Partition
+	var extended []mbrEntry
+	for _, e := range entries {
+		if isExtended(e.typ) {
+			extended = append(extended, e)
+			continue
+		}
+		parts = append(parts, e.partition(len(parts)+1, 0))
+	}
+	if len(parts) == 0 && len(extended) == 0 {
+		return nil
+	}
+
+	// Logical partitions: each extended boot record describes one, relative
+	// to itself, and links to the next relative to the extended partition
+	for _, ext := range extended {
+		base := int64(ext.start) * SectorSize
+		ebr := base
+		for i := 0; i < maxLogical; i++ {
+			if _, err := r.ReadAt(mbr, ebr); err != nil || mbr[510] != 0x55 || mbr[511] != 0xAA {
+				break
+			}
+			links := mbrEntries(mbr)
+			if len(links) == 0 {
+				break
+			}
+			parts = append(parts, links[0].partition(len(parts)+1, ebr))
+			if len(links) < 2 || !isExtended(links[1].typ) {
+				break
+			}
+			ebr = base + int64(links[1].start)*SectorSize
+		}
+	}
+
+	for _, p := range parts {
+		if p.Offset+p.Size > r.Size() {
+			return nil
+		}
+	}
+	return parts
+}
+
+// mbrEntry is a used slot of an MBR or extended boot record
+type mbrEntry struct {
+	typ          byte
+	start, count uint32 // In sectors
+}
+
+func (e mbrEntry) partition(index int, base int64) Partition {
+	return Partition{
+		Index:  index,
+		Offset: base + int64(e.start)*SectorSize,
+		Size:   int64(e.count) * SectorSize,
+		Type:   fmt.Sprintf("0x%02X", e.typ),
+	}
+}
+
+// mbrEntries returns the used slots of the table in a boot record, or nil
+// when a slot has an invalid status byte
+func mbrEntries(sector []byte) []mbrEntry {
+	var entries []mbrEntry
+	for i := 0; i < 4; i++ {
+		e := sector[446+16*i : 462+16*i]
+		if e[0] != 0x00 && e[0] != 0x80 {
+			return nil
+		}
+		entry := mbrEntry{typ: e[4], start: binary.LittleEndian.Uint32(e[8:]), count: binary.LittleEndian.Uint32(e[12:])}
+		if entry.typ != 0 && entry.start > 0 && entry.count > 0 {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func isExtended(typ byte) bool {
+	return typ == 0x05 || typ == 0x0F || typ == 0x85
+}
+
+// gptPartitions reads the GUID partition table header at LBA 1 and its entries
+func gptPartitions(r *Reader) []Partition {
+	hdr := make([]byte, 92)
+	if _, err := r.ReadAt(hdr, SectorSize); err != nil || string(hdr[:8]) != "EFI PART" {
+		return nil
+	}
+	le := binary.LittleEndian
+	table := int64(le.Uint64(hdr[72:])) * SectorSize
+	count, size := int64(le.Uint32(hdr[80:])), int64(le.Uint32(hdr[84:]))
+	if count > 1024 || size < 128 || size > 4096 {
+		return nil
+	}
+	entries := make([]byte, count*size)
+	if _, err := r.ReadAt(entries, table); err != nil && err != io.EOF {
+		return nil
+	}
+
+	var parts []Partition
+	for i := int64(0); i < count; i++ {
+		e := entries[i*size : (i+1)*size]
+		first, last := int64(le.Uint64(e[32:])), int64(le.Uint64(e[40:]))
+		if isZero(e[:16]) || first == 0 || last < first || (last+1)*SectorSize > r.Size() {
+			continue
+		}
+		parts = append(parts, Partition{
+			Index:  int(i) + 1,
+			Offset: first * SectorSize,
+			Size:   (last - first + 1) * SectorSize,
+			Type:   guidString(e[:16]),
+		})
+	}
+	return parts
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// guidString formats a GUID stored with its first three fields little-endian
+func guidString(b []byte) string {
+	le := binary.LittleEndian
+	return fmt.Sprintf("%08X-%04X-%04X-%X-%X", le.Uint32(b), le.Uint16(b[4:]), le.Uint16(b[6:]), b[8:10], b[10:16])
+}
+
+// Partition opens a partition of the disk as a disk of its own
+func (r *Reader) Partition(p Partition) *Reader {
+	part := NewReader(io.NewSectionReader(r, p.Offset, p.Size), p.Size, fmt.Sprintf("%s#%d", r.Path(), p.Index))
+	part.audit = r.audit // Its reads are recorded by r, tagged with the purposes it sets
+	part.output = r.output
+	part.run = r.run
+	part.counted = false // Its reads are counted by r
+	return part
+}
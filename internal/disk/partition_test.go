@@ -0,0 +1,82 @@
+package disk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// mbrSlot fills slot i of the partition table in a boot record
+func mbrSlot(sector []byte, i int, typ byte, start, count uint32) {
+	e := sector[446+16*i:]
+	e[4] = typ
+	binary.LittleEndian.PutUint32(e[8:], start)
+	binary.LittleEndian.PutUint32(e[12:], count)
+	sector[510], sector[511] = 0x55, 0xAA
+}
+
+func TestPartitionsMBR(t *testing.T) {
+	data := make([]byte, 4096*SectorSize)
+	mbrSlot(data, 0, 0x07, 2048, 1024)
+	mbrSlot(data, 1, 0x0F, 3072, 1024) // Extended, with two logical partitions
+	mbrSlot(data[3072*SectorSize:], 0, 0x0B, 63, 200)
+	mbrSlot(data[3072*SectorSize:], 1, 0x05, 512, 300)
+	mbrSlot(data[3584*SectorSize:], 0, 0x83, 63, 100)
+
+	got := Partitions(NewReader(bytes.NewReader(data), int64(len(data)), "mbr.img"))
+	want := []Partition{
+		{Index: 1, Offset: 2048 * SectorSize, Size: 1024 * SectorSize, Type: "0x07"},
+		{Index: 2, Offset: 3135 * SectorSize, Size: 200 * SectorSize, Type: "0x0B"},
+		{Index: 3, Offset: 3647 * SectorSize, Size: 100 * SectorSize, Type: "0x83"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d partitions, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Partition %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+
+	// A FAT32 volume without a partition table
+	data = make([]byte, 64*SectorSize)
+	copy(data[82:], "FAT32   ")
+	data[510], data[511] = 0x55, 0xAA
+	if got := Partitions(NewReader(bytes.NewReader(data), int64(len(data)), "fat.img")); got != nil {
+		t.Errorf("Expected no partitions for a bare volume, got %+v", got)
+	}
+}
+
+func TestPartitionsGPT(t *testing.T) {
+	data := make([]byte, 4096*SectorSize)
+	mbrSlot(data, 0, gptProtective, 1, 4095)
+	hdr := data[SectorSize:]
+	copy(hdr, "EFI PART")
+	binary.LittleEndian.PutUint64(hdr[72:], 2)
+	binary.LittleEndian.PutUint32(hdr[80:], 128)
+	binary.LittleEndian.PutUint32(hdr[84:], 128)
+
+	// Microsoft basic data, EBD0A0A2-B9E5-4433-87C0-68B6B72699C7
+	basic := []byte{0xA2, 0xA0, 0xD0, 0xEB, 0xE5, 0xB9, 0x33, 0x44, 0x87, 0xC0, 0x68, 0xB6, 0xB7, 0x26, 0x99, 0xC7}
+	entry := data[2*SectorSize+128:] // Second slot; the first is unused
+	copy(entry, basic)
+	binary.LittleEndian.PutUint64(entry[32:], 2048)
+	binary.LittleEndian.PutUint64(entry[40:], 4000)
+
+	reader := NewReader(bytes.NewReader(data), int64(len(data)), "gpt.img")
+	got := Partitions(reader)
+	want := Partition{Index: 2, Offset: 2048 * SectorSize, Size: 1953 * SectorSize, Type: "EBD0A0A2-B9E5-4433-87C0-68B6B72699C7"}
+	if len(got) != 1 || got[0] != want {
+		t.Fatalf("Expected %+v, got %+v", want, got)
+	}
+
+	part := reader.Partition(got[0])
+	if part.Size() != want.Size || part.Path() != "gpt.img#2" {
+		t.Errorf("Unexpected partition reader %s of %d bytes", part.Path(), part.Size())
+	}
+	copy(data[2048*SectorSize:], "volume")
+	buf := make([]byte, 6)
+	if _, err := part.ReadAt(buf, 0); err != nil || string(buf) != "volume" {
+		t.Errorf("Expected to read the start of the partition, got %q (%v)", buf, err)
+	}
+}
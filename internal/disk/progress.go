@@ -0,0 +1,249 @@
+package disk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A run tells what it is doing through the ProgressReporter of the disk it
+// reads: how far each phase has come, and the lines a person following it
+// would read. The recover command prints them, the TUI draws them as a
+// progress bar, and JSONEvents writes them for other programs, one event a
+// line:
+//
+//	{"time":"2024-03-01T10:15:02Z","event":"progress","phase":"carving scan","current":1048576,"total":8589934592,"found":3}
+//	{"time":"2024-03-01T10:15:09Z","event":"message","level":"info","text":"Recovered: recovered/JPEG/carved_000001.jpg"}
+//	{"time":"2024-03-01T10:42:17Z","event":"end","status":"completed","recovered":1832}
+//
+// Progress is reported as often as it is made, once a buffer or a record,
+// and left to the reporter to thin out.
+
+// Progress is how far a phase of a run has come
+type Progress struct {
+	Phase   string // What the run is doing, such as "carving scan" or "MFT scan"
+	Current int64  // Done so far of Total, in the phase's unit: bytes, records or files
+	Total   int64  // 0 when not known
+	Found   int64  // Files found, or recovered, so far
+	Item    string // What is being worked on, such as the file being written; "" for none
+}
+
+// ProgressReporter receives what a run does as it goes
+type ProgressReporter interface {
+	Progress(p Progress)
+	Message(text string) // A line, or lines, as printed, with their newlines
+}
+
+// PrintInterval is how often a Printer prints the progress of a phase
+const PrintInterval = 5 * time.Second
+
+// EventInterval is how often JSONEvents writes the progress of a phase,
+// besides when it starts and ends
+const EventInterval = time.Second
+
+// Printer is the ProgressReporter of a disk none was given: it writes
+// messages as they come and the progress of a long phase every
+// PrintInterval
+type Printer struct {
+	w     io.Writer
+	now   func() time.Time
+	mu    sync.Mutex
+	phase string
+	last  time.Time // Of the phase's start or last line
+}
+
+// NewPrinter returns a Printer writing to w
+func NewPrinter(w io.Writer) *Printer {
+	return &Printer{w: w, now: time.Now}
+}
+
+func (p *Printer) Message(text string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprint(p.w, text)
+}
+
+func (p *Printer) Progress(pr Progress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	if pr.Phase != p.phase {
+		p.phase, p.last = pr.Phase, now
+		return
+	}
+	if now.Sub(p.last) < PrintInterval {
+		return
+	}
+	p.last = now
+	if pr.Total > 0 {
+		pct := float64(pr.Current) / float64(pr.Total) * 100
+		fmt.Fprintf(p.w, "  %s: %.1f%%, found %d files...\n", pr.Phase, pct, pr.Found)
+	} else {
+		fmt.Fprintf(p.w, "  %s: %d done, found %d files...\n", pr.Phase, pr.Current, pr.Found)
+	}
+}
+
+// JSONEvents is the ProgressReporter for other programs: it writes every
+// message, and the progress of a phase when it starts, when it ends and
+// every EventInterval between, as a JSON object on a line of its own
+type JSONEvents struct {
+	enc   *json.Encoder
+	now   func() time.Time
+	mu    sync.Mutex
+	phase string
+	last  time.Time // Of the last progress event
+	err   error     // First write error
+}
+
+type jsonEvent struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"` // progress, message or end
+	*jsonProgress
+	Level string `json:"level,omitempty"` // Of a message
+	Text  string `json:"text,omitempty"`
+	*jsonEnd
+}
+
+type jsonEnd struct {
+	Status    string `json:"status"` // completed, failed or interrupted
+	Recovered int    `json:"recovered"`
+	Error     string `json:"error,omitempty"`
+}
+
+type jsonProgress struct {
+	Phase   string `json:"phase"`
+	Current int64  `json:"current"`
+	Total   int64  `json:"total"`
+	Found   int64  `json:"found"`
+	Item    string `json:"item,omitempty"`
+}
+
+// NewJSONEvents returns a JSONEvents writing to w
+func NewJSONEvents(w io.Writer) *JSONEvents {
+	return &JSONEvents{enc: json.NewEncoder(w), now: time.Now}
+}
+
+// Message writes a message event of the text without the blank lines and
+// indentation that lay it out in print; it writes nothing for a blank line
+func (j *JSONEvents) Message(text string) {
+	j.Log(LevelInfo, text)
+}
+
+// Log writes a message event of the text at a level, as Message does
+func (j *JSONEvents) Log(level Level, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	j.write(jsonEvent{Time: j.now().UTC(), Event: "message", Level: level.String(), Text: text})
+}
+
+func (j *JSONEvents) Progress(p Progress) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := j.now()
+	start := p.Phase != j.phase
+	done := p.Total > 0 && p.Current >= p.Total
+	if !start && !done && now.Sub(j.last) < EventInterval {
+		return
+	}
+	j.phase, j.last = p.Phase, now
+	j.writeLocked(jsonEvent{Time: now.UTC(), Event: "progress", jsonProgress: &jsonProgress{
+		Phase:   p.Phase,
+		Current: p.Current,
+		Total:   p.Total,
+		Found:   p.Found,
+		Item:    p.Item,
+	}})
+}
+
+// End writes the event that ends the stream: how the run ended, with
+// status, the files it recovered and the error it failed with, if any
+func (j *JSONEvents) End(status string, recovered int, err error) {
+	end := &jsonEnd{Status: status, Recovered: recovered}
+	if err != nil {
+		end.Error = err.Error()
+	}
+	j.write(jsonEvent{Time: j.now().UTC(), Event: "end", jsonEnd: end})
+}
+
+// Err returns the first error writing an event
+func (j *JSONEvents) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+func (j *JSONEvents) write(e jsonEvent) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.writeLocked(e)
+}
+
+// writeLocked writes an event with j.mu held
+func (j *JSONEvents) writeLocked(e jsonEvent) {
+	if j.err == nil {
+		j.err = j.enc.Encode(e)
+	}
+}
+
+// MultiReporter returns a ProgressReporter that reports to each of reps,
+// and tells those that are LevelReporters the levels of messages
+func MultiReporter(reps ...ProgressReporter) LevelReporter {
+	return multiReporter(reps)
+}
+
+type multiReporter []ProgressReporter
+
+func (m multiReporter) Progress(p Progress) {
+	for _, rep := range m {
+		rep.Progress(p)
+	}
+}
+
+func (m multiReporter) Message(text string) {
+	m.Log(LevelInfo, text)
+}
+
+func (m multiReporter) Log(level Level, text string) {
+	for _, rep := range m {
+		if lr, ok := rep.(LevelReporter); ok {
+			lr.Log(level, text)
+		} else if level <= LevelInfo {
+			rep.Message(text)
+		}
+	}
+}
+
+// SetReporter makes the disk, and the readers of its partitions, report
+// what runs do to rep; nil restores a Printer to standard output
+func (r *Reader) SetReporter(rep ProgressReporter) {
+	r.run.reporter = rep
+}
+
+// Reporter returns the ProgressReporter of the disk
+func (r *Reader) Reporter() ProgressReporter {
+	if r.run.reporter == nil {
+		r.run.reporter = NewPrinter(os.Stdout)
+	}
+	return r.run.reporter
+}
+
+// Report reports the progress of a phase of a run
+func (r *Reader) Report(p Progress) {
+	r.Reporter().Progress(p)
+}
+
+// Printf reports a message of a run, formatted as by fmt.Printf
+func (r *Reader) Printf(format string, args ...any) {
+	r.Logf(LevelInfo, format, args...)
+}
+
+// Println reports a message of a run, formatted as by fmt.Println
+func (r *Reader) Println(args ...any) {
+	r.Logf(LevelInfo, "%s", fmt.Sprintln(args...))
+}
@@ -0,0 +1,131 @@
+package disk
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrinter(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPrinter(&out)
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+
+	p.Message("  Recovered: a.txt\n")
+	p.Progress(Progress{Phase: "carving scan", Current: 0, Total: 1000})
+	now = now.Add(time.Second)
+	p.Progress(Progress{Phase: "carving scan", Current: 100, Total: 1000, Found: 1})
+	now = now.Add(PrintInterval)
+	p.Progress(Progress{Phase: "carving scan", Current: 500, Total: 1000, Found: 2})
+	p.Progress(Progress{Phase: "carving scan", Current: 600, Total: 1000, Found: 2}) // Too soon
+	now = now.Add(PrintInterval)
+	p.Progress(Progress{Phase: "directory scan", Current: 10}) // A new phase starts its clock
+	now = now.Add(PrintInterval)
+	p.Progress(Progress{Phase: "directory scan", Current: 20, Found: 3})
+
+	want := "  Recovered: a.txt\n" +
+		"  carving scan: 50.0%, found 2 files...\n" +
+		"  directory scan: 20 done, found 3 files...\n"
+	if out.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, out.String())
+	}
+}
+
+func TestJSONEvents(t *testing.T) {
+	var out bytes.Buffer
+	j := NewJSONEvents(&out)
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	j.now = func() time.Time { return now }
+
+	j.Progress(Progress{Phase: "NTFS recovery", Current: 0, Total: 3, Item: "a.txt"})
+	j.Progress(Progress{Phase: "NTFS recovery", Current: 1, Total: 3, Found: 1, Item: "b.txt"}) // Too soon
+	j.Message("\nRecovering files...\n")
+	j.Message("\n") // Blank
+	now = now.Add(EventInterval)
+	j.Progress(Progress{Phase: "NTFS recovery", Current: 2, Total: 3, Found: 2, Item: "c.txt"})
+	j.Progress(Progress{Phase: "NTFS recovery", Current: 3, Total: 3, Found: 3}) // Done
+	if err := j.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	type event struct {
+		Event   string
+		Phase   string
+		Current int64
+		Found   int64
+		Item    string
+		Text    string
+	}
+	want := []event{
+		{Event: "progress", Phase: "NTFS recovery", Item: "a.txt"},
+		{Event: "message", Text: "Recovering files..."},
+		{Event: "progress", Phase: "NTFS recovery", Current: 2, Found: 2, Item: "c.txt"},
+		{Event: "progress", Phase: "NTFS recovery", Current: 3, Found: 3},
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("Expected %d events, got:\n%s", len(want), out.String())
+	}
+	for i, line := range lines {
+		var e event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("Event %d is not JSON: %v", i, err)
+		}
+		if e != want[i] {
+			t.Errorf("Event %d: expected %+v, got %+v", i, want[i], e)
+		}
+	}
+	if !strings.Contains(lines[0], `"time":"2024-03-01T10:00:00Z"`) || !strings.Contains(lines[0], `"total":3`) {
+		t.Errorf("Expected the time and total in %s", lines[0])
+	}
+}
+
+func TestReporterShared(t *testing.T) {
+	var out bytes.Buffer
+	reader := NewReader(bytes.NewReader(make([]byte, 4096)), 4096, "mem")
+	part := reader.Partition(Partition{Index: 1, Offset: 1024, Size: 2048})
+	reader.SetReporter(NewPrinter(&out))
+
+	part.Printf("Found %d deleted files\n", 2)
+	part.Println("done")
+	if got := out.String(); got != "Found 2 deleted files\ndone\n" {
+		t.Errorf("Expected the partition's messages on the disk's reporter, got %q", got)
+	}
+}
+
+func TestJSONEventsEnd(t *testing.T) {
+	var out bytes.Buffer
+	j := NewJSONEvents(&out)
+	j.now = func() time.Time { return time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC) }
+
+	j.End("completed", 12, nil)
+	j.End("failed", 3, errors.New("disk full"))
+	want := `{"time":"2024-03-01T10:00:00Z","event":"end","status":"completed","recovered":12}` + "\n" +
+		`{"time":"2024-03-01T10:00:00Z","event":"end","status":"failed","recovered":3,"error":"disk full"}` + "\n"
+	if out.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, out.String())
+	}
+}
+
+func TestMultiReporter(t *testing.T) {
+	var text, events bytes.Buffer
+	j := NewJSONEvents(&events)
+	m := MultiReporter(NewPrinter(&text), NewLogger(j, LevelInfo))
+
+	m.Log(LevelError, "Failed to recover a.txt\n")
+	m.Log(LevelVerbose, "Cluster size: 4096\n") // Above the levels of both
+	m.Message("Recovered: b.txt\n")
+	m.Progress(Progress{Phase: "carving scan", Current: 1, Total: 2})
+
+	if want := "Failed to recover a.txt\nRecovered: b.txt\n"; text.String() != want {
+		t.Errorf("Expected the printer to get %q, got %q", want, text.String())
+	}
+	lines := strings.Split(strings.TrimSpace(events.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], `"level":"error"`) || !strings.Contains(lines[1], `"level":"info"`) || !strings.Contains(lines[2], `"event":"progress"`) {
+		t.Errorf("Expected an error, a message and progress, got:\n%s", events.String())
+	}
+}
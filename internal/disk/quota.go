@@ -0,0 +1,196 @@
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The space recovered files take can be planned and bounded. Before a
+// recovery writes the files it found, it plans their total size against
+// the free space of the destination, measured when the run started, and
+// warns when they may not fit, or with a strict plan, stops before
+// writing any. A limit on the output is a quota: a file that would take
+// the output past it is removed, and no file is written after it, so a run
+// on a large disk fills the output drive up to the limit and ends as it
+// would have, with its reports and manifests, and the files it left out
+// listed in SkippedFile.
+//
+// Sizes are of what is written: compressed files count their compressed
+// size and holes in sparse files count for nothing, so more fits than the
+// plan, which is of the files as they were, says.
+
+// SkippedFile lists the files left out for the limit on the output, below
+// the output directory
+const SkippedFile = "skipped.txt"
+
+// ErrOutputFull is the error writing a recovered file past the limit on
+// the output
+var ErrOutputFull = errors.New("output size limit reached")
+
+// outputConfig is how the files recovered from a disk are written, and
+// the space they have taken
+type outputConfig struct {
+	compression string
+	sync        bool
+	verify      bool
+	discard     bool // Files are only digested, by a Verifier
+	workers     int  // Files written at once
+
+	mu      sync.Mutex
+	limit   int64 // 0 = none
+	used    int64
+	full    bool
+	skipped []string
+	free    int64 // Free space of the destination; -1 = not known
+	strict  bool  // Refuse to start what may not fit in free
+	planned int64
+
+	unverified int // Files that failed verification
+}
+
+// LimitOutput stops the files recovered from the disk, and from the
+// readers of its partitions, from taking more than limit bytes; 0 is no
+// limit
+func (r *Reader) LimitOutput(limit int64) {
+	r.output.mu.Lock()
+	r.output.limit = limit
+	r.output.mu.Unlock()
+}
+
+// PlanSpace sets the free space of the destination that PlanOutput plans
+// against; with strict, a plan that does not fit fails rather than warns
+func (r *Reader) PlanSpace(free int64, strict bool) {
+	r.output.mu.Lock()
+	r.output.free, r.output.strict = free, strict
+	r.output.mu.Unlock()
+}
+
+// PlanOutput adds files of total bytes to the output planned so far, and
+// warns, or with a strict plan fails, when the output may not fit on the
+// destination or within its limit
+func (r *Reader) PlanOutput(files int, total int64) error {
+	o := r.output
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.planned += total
+	if o.free >= 0 && o.planned > o.free {
+		if o.strict {
+			return fmt.Errorf("%d files of %s to recover, but only %s free at the destination", files, FormatSize(total), FormatSize(o.free))
+		}
+		r.Warnf("Warning: %s to recover, but only %s free at the destination\n", FormatSize(o.planned), FormatSize(o.free))
+	}
+	if o.limit > 0 && o.planned > o.limit {
+		r.Warnf("Warning: %s to recover, more than the output limit of %s; files past it will be skipped\n", FormatSize(o.planned), FormatSize(o.limit))
+	}
+	return nil
+}
+
+// Skipped returns the paths of the files left out for the limit on the
+// output, in the order they were
+func (r *Reader) Skipped() []string {
+	r.output.mu.Lock()
+	defer r.output.mu.Unlock()
+	return append([]string(nil), r.output.skipped...)
+}
+
+// WriteSkipped lists the files left out for the limit on the output in
+// SkippedFile below dir, with paths relative to it, and returns how many
+// there were; it writes nothing when none were
+func (r *Reader) WriteSkipped(dir string) (int, error) {
+	skipped := r.Skipped()
+	if len(skipped) == 0 {
+		return 0, nil
+	}
+	var b strings.Builder
+	for _, path := range skipped {
+		if rel, err := filepath.Rel(dir, path); err == nil {
+			path = rel
+		}
+		b.WriteString(filepath.ToSlash(path) + "\n")
+	}
+	return len(skipped), os.WriteFile(filepath.Join(dir, SkippedFile), []byte(b.String()), 0644)
+}
+
+func (o *outputConfig) isFull() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.full
+}
+
+func (o *outputConfig) skip(path string) {
+	o.mu.Lock()
+	o.skipped = append(o.skipped, path)
+	o.mu.Unlock()
+}
+
+// reserve takes n bytes of the output, or reports that they would take it
+// past its limit, which ends the output
+func (o *outputConfig) reserve(n int64) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.full || (o.limit > 0 && o.used+n > o.limit) {
+		o.full = true
+		return false
+	}
+	o.used += n
+	return true
+}
+
+// limitedFile is a recovered file whose writes count against the limit on
+// the output
+type limitedFile struct {
+	*os.File
+	output *outputConfig
+	full   bool // A write went past the limit
+}
+
+func (f *limitedFile) Write(p []byte) (int, error) {
+	if !f.output.reserve(int64(len(p))) {
+		f.full = true
+		return 0, ErrOutputFull
+	}
+	return f.File.Write(p)
+}
+
+func (f *limitedFile) WriteAt(p []byte, off int64) (int, error) {
+	if !f.output.reserve(int64(len(p))) {
+		f.full = true
+		return 0, ErrOutputFull
+	}
+	return f.File.WriteAt(p, off)
+}
+
+// ParseSize parses a size in bytes, with an optional K, M, G or T suffix
+// for binary kilobytes and up, such as 500G
+func ParseSize(size string) (int64, error) {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(size)), "B")
+	shift := 0
+	if i := strings.IndexAny(s, "KMGT"); i >= 0 && i == len(s)-1 {
+		shift = 10 * (1 + strings.IndexByte("KMGT", s[i]))
+		s = s[:i]
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q (want bytes, or a number with K, M, G or T)", size)
+	}
+	return int64(v * float64(int64(1)<<shift)), nil
+}
+
+// FormatSize formats a size in bytes for people, such as 1.5 GB
+func FormatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
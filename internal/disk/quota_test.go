@@ -0,0 +1,82 @@
+package disk
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLimitOutput(t *testing.T) {
+	dir := t.TempDir()
+	r := NewReader(bytes.NewReader(make([]byte, 1<<20)), 1<<20, "test.img")
+	r.LimitOutput(10000)
+	part := r.Partition(Partition{Index: 1, Size: 1 << 19})
+
+	write := func(r *Reader, name string, size int) error {
+		out, err := r.CreateOutput(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		if _, err := out.Write(bytes.Repeat([]byte{'x'}, size)); err != nil {
+			return err
+		}
+		return out.Close()
+	}
+	if err := write(r, "first.txt", 6000); err != nil {
+		t.Fatalf("Expected the first file to fit, got %v", err)
+	}
+	// The partition shares the limit of its disk
+	if err := write(part, "second.txt", 6000); !errors.Is(err, ErrOutputFull) {
+		t.Errorf("Expected the second file to go past the limit, got %v", err)
+	}
+	if err := write(r, "third.txt", 10); !errors.Is(err, ErrOutputFull) {
+		t.Errorf("Expected no file after the limit, got %v", err)
+	}
+	for name, want := range map[string]bool{"first.txt": true, "second.txt": false, "third.txt": false} {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != want {
+			t.Errorf("Expected %s to exist: %v, got %v", name, want, err)
+		}
+	}
+
+	if n, err := r.WriteSkipped(dir); err != nil || n != 2 {
+		t.Fatalf("Expected 2 files skipped, got %d (%v)", n, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, SkippedFile)); string(data) != "second.txt\nthird.txt\n" {
+		t.Errorf("Unexpected list of skipped files %q", data)
+	}
+}
+
+func TestPlanOutput(t *testing.T) {
+	r := NewReader(bytes.NewReader(nil), 0, "test.img")
+	if err := r.PlanOutput(3, 1<<30); err != nil {
+		t.Errorf("Expected no plan without the free space known, got %v", err)
+	}
+	r.PlanSpace(2<<30, false)
+	if err := r.PlanOutput(3, 1<<30); err != nil {
+		t.Errorf("Expected a warning only, got %v", err)
+	}
+	r.PlanSpace(2<<30, true)
+	// Plans add up, as for the volumes of one disk
+	if err := r.PlanOutput(3, 1<<30); err == nil {
+		t.Error("Expected a strict plan past the free space to fail")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for s, want := range map[string]int64{"1000": 1000, "4K": 4096, "1.5M": 3 << 19, "500G": 500 << 30, "2tb": 2 << 40} {
+		if got, err := ParseSize(s); err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "G", "-1K", "10X"} {
+		if _, err := ParseSize(s); err == nil {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+	if got := FormatSize(3 << 29); got != "1.5 GB" {
+		t.Errorf("Expected 1.5 GB, got %s", got)
+	}
+}
@@ -1,10 +1,13 @@
 package disk
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"sync"
+	"sync/atomic"
 )
 
 const (
@@ -13,9 +16,40 @@ const (
 )
 
 type Reader struct {
-	file       *os.File
+	stream     *io.SectionReader // Bounds reads to the disk, with a position for Read and Seek
+	closer     io.Closer
+	name       string
 	size       int64
 	sectorSize int
+	audit      *auditLog     // Shared with the readers of its partitions
+	audited    bool          // Reads are recorded here, not by the disk of a partition
+	counted    bool          // Reads are counted in run.stats here, not by the disk a partition reads
+	output     *outputConfig // How files recovered from it are written, shared with the readers of its partitions
+	run        *run          // Shared with the readers of its partitions
+}
+
+// run is the context the reads of a disk stop with, and where what they
+// do and the files recovered from it are reported
+type run struct {
+	ctx      atomic.Pointer[context.Context] // Of SetContext, read while it changes; nil = never
+	reporter ProgressReporter                // nil = a Printer to standard output, made when first needed
+	hook     Hook                            // Told of each file recovered; nil = none
+	sender   Sender                          // Takes each file recovered once done with; nil = none
+	failed   atomic.Pointer[error]           // Of the sender, which stops the run
+	filter   *Filter                         // Of the files listed and recovered; nil = all
+	live     bool                            // Files in use are listed and recovered too
+	mu       sync.Mutex                      // Guards hitsLeft and sent
+	hitsLeft map[string]int                  // Carved hits the filter left out, by why
+	sent     map[string]bool                 // Paths handed to the sender
+	bytes    atomic.Int64                    // Read from the disk
+	errors   atomic.Int64                    // Reads of it that failed
+}
+
+// ReadStats is what the reads of a disk have done since it was opened,
+// those of its partitions included
+type ReadStats struct {
+	Bytes  int64 // Read
+	Errors int64 // Reads that failed, other than past its end or cancelled
 }
 
 func Open(path string) (*Reader, error) {
@@ -42,27 +76,122 @@ func Open(path string) (*Reader, error) {
 		file.Seek(0, io.SeekStart)
 	}
 
+	reader := NewReader(file, size, file.Name())
+	reader.closer = file
+	return reader, nil
+}
+
+// NewReader presents size bytes of r as a disk, such as a partition of
+// another disk or the guest disk inside a carved virtual disk. The name
+// stands in for the path it was opened with.
+func NewReader(r io.ReaderAt, size int64, name string) *Reader {
 	return &Reader{
-		file:       file,
+		stream:     io.NewSectionReader(r, 0, size),
+		name:       name,
 		size:       size,
 		sectorSize: SectorSize,
-	}, nil
+		output:     &outputConfig{free: -1},
+		run:        &run{},
+		counted:    true,
+	}
 }
 
 func (r *Reader) Close() error {
-	return r.file.Close()
+	err := r.FlushAudit()
+	if r.closer == nil {
+		return err
+	}
+	if cerr := r.closer.Close(); cerr != nil {
+		return cerr
+	}
+	return err
 }
 
 func (r *Reader) Size() int64 {
 	return r.size
 }
 
+// Path returns the path the reader was opened with
+func (r *Reader) Path() string {
+	return r.name
+}
+
 func (r *Reader) SectorSize() int {
 	return r.sectorSize
 }
 
+// SetContext makes reads of the disk fail with the error of ctx once it is
+// done, and Err return it, so that a run can be cancelled or given a
+// deadline. The readers of its partitions share it, taken before or after.
+func (r *Reader) SetContext(ctx context.Context) {
+	if ctx == nil {
+		r.run.ctx.Store(nil)
+		return
+	}
+	r.run.ctx.Store(&ctx)
+}
+
+// Context returns the context SetContext gave the disk, or nil
+func (r *Reader) Context() context.Context {
+	if ctx := r.run.ctx.Load(); ctx != nil {
+		return *ctx
+	}
+	return nil
+}
+
+// Stats returns what the reads of the disk have done so far. It may be
+// called while a run reads it.
+func (r *Reader) Stats() ReadStats {
+	return ReadStats{Bytes: r.run.bytes.Load(), Errors: r.run.errors.Load()}
+}
+
+// count adds a read of n bytes that returned err to the disk's stats
+func (r *Reader) count(n int, err error) {
+	if !r.counted {
+		return
+	}
+	r.run.bytes.Add(int64(n))
+	if err != nil && err != io.EOF {
+		r.run.errors.Add(1)
+	}
+}
+
+// Err returns the error of the disk's context once it is done, or of its
+// sender once it failed, for long loops to stop on, or nil
+func (r *Reader) Err() error {
+	if err := r.run.failed.Load(); err != nil {
+		return *err
+	}
+	ctx := r.Context()
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Err()
+}
+
 func (r *Reader) ReadAt(buf []byte, offset int64) (int, error) {
-	return r.file.ReadAt(buf, offset)
+	if err := r.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.stream.ReadAt(buf, offset)
+	if r.audited {
+		r.audit.record(offset, n)
+	}
+	r.count(n, err)
+	if r.counted && err != nil && err != io.EOF {
+		r.Debugf("  Read of %d bytes at offset %d failed: %v\n", len(buf), offset, err)
+	}
+	return n, r.readError(err, offset, len(buf))
+}
+
+// readError wraps an error of the disk's stream in a ReadError, unless it
+// is io.EOF or a ReadError already, of the disk a partition is read from
+func (r *Reader) readError(err error, offset int64, n int) error {
+	var re *ReadError
+	if err == nil || err == io.EOF || errors.As(err, &re) {
+		return err
+	}
+	return &ReadError{Offset: offset, Len: n, Err: err}
 }
 
 func (r *Reader) ReadSector(sector int64) ([]byte, error) {
@@ -92,17 +221,31 @@ func (r *Reader) ReadCluster(clusterStart int64, clusterSize int) ([]byte, error
 	return buf, nil
 }
 
-// Seek wraps file.Seek
+// Seek sets the position for Read
 func (r *Reader) Seek(offset int64, whence int) (int64, error) {
-	return r.file.Seek(offset, whence)
+	return r.stream.Seek(offset, whence)
 }
 
-// Read wraps file.Read
+// Read reads from the current position
 func (r *Reader) Read(buf []byte) (int, error) {
-	return r.file.Read(buf)
+	if err := r.Err(); err != nil {
+		return 0, err
+	}
+	offset, _ := r.stream.Seek(0, io.SeekCurrent)
+	n, err := r.stream.Read(buf)
+	if r.audited {
+		r.audit.record(offset, n)
+	}
+	r.count(n, err)
+	if r.counted && err != nil && err != io.EOF {
+		r.Debugf("  Read of %d bytes at offset %d failed: %v\n", len(buf), offset, err)
+	}
+	return n, r.readError(err, offset, len(buf))
 }
 
-// DetectFilesystem attempts to identify the filesystem type
+// DetectFilesystem attempts to identify the filesystem type: among the
+// registered filesystems, or by the signatures of NTFS and FAT, which
+// partition tables are told apart from without their parsers
 func DetectFilesystem(r *Reader) (string, error) {
 	// Read first few sectors
 	buf := make([]byte, 4096)
@@ -111,6 +254,12 @@ func DetectFilesystem(r *Reader) (string, error) {
 		return "", err
 	}
 
+	for _, fs := range filesystems {
+		if fs.Detect(buf) {
+			return fs.Name(), nil
+		}
+	}
+
 	// Check for NTFS signature at offset 3
 	if string(buf[3:7]) == "NTFS" {
 		return "ntfs", nil
@@ -132,5 +281,5 @@ func DetectFilesystem(r *Reader) (string, error) {
 		return "fat16", nil
 	}
 
-	return "", errors.New("unknown filesystem")
+	return "", fmt.Errorf("%w: none detected", ErrUnsupportedFilesystem)
 }
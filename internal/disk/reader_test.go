@@ -1,6 +1,9 @@
 package disk
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -208,3 +211,31 @@ func TestDetectFilesystem(t *testing.T) {
 		})
 	}
 }
+
+func TestReaderContext(t *testing.T) {
+	reader := NewReader(bytes.NewReader(make([]byte, 4096)), 4096, "disk.img")
+	part := reader.Partition(Partition{Index: 1, Offset: 1024, Size: 2048})
+	buf := make([]byte, 512)
+	if _, err := part.ReadAt(buf, 0); err != nil {
+		t.Fatalf("Read without a context failed: %v", err)
+	}
+
+	// Partitions taken before the context is set stop with the disk
+	ctx, cancel := context.WithCancel(context.Background())
+	reader.SetContext(ctx)
+	if _, err := reader.ReadAt(buf, 0); err != nil {
+		t.Fatalf("Read before cancelling failed: %v", err)
+	}
+	cancel()
+	for _, r := range []*Reader{reader, part, reader.Verifier()} {
+		if _, err := r.ReadAt(buf, 0); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected %s to be cancelled, got %v", r.Path(), err)
+		}
+		if !errors.Is(r.Err(), context.Canceled) {
+			t.Errorf("Expected Err of %s to be context.Canceled, got %v", r.Path(), r.Err())
+		}
+	}
+	if _, err := reader.Read(buf); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Read to be cancelled, got %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package disk
+
+import "fmt"
+
+// Sender takes each file a run recovered once the run is done with it, to
+// add it to an archive, upload or encrypt it as the run goes rather than
+// once it ends
+type Sender interface {
+	// Send takes the file or directory at path, which may be removed once
+	// it returns
+	Send(path string) error
+}
+
+// SetSender has s take each file recovered from the disk once the run is
+// done with it, or no sender with nil. The readers of its partitions share
+// it.
+func (r *Reader) SetSender(s Sender) {
+	r.run.sender = s
+}
+
+// Finished hands a file or directory recovered from the disk to its
+// sender, once nothing more of the run reads or changes it: after the
+// hook has been told of it, and whatever is made from it has been. A
+// sender that fails stops the run, whose reads then fail with its error,
+// since the copies it would have taken pile up.
+func (r *Reader) Finished(path string) {
+	s := r.run.sender
+	if s == nil || r.Err() != nil {
+		return
+	}
+	if err := s.Send(path); err != nil {
+		err = fmt.Errorf("sending %s: %w", path, err)
+		r.run.failed.CompareAndSwap(nil, &err)
+		return
+	}
+	r.run.mu.Lock()
+	defer r.run.mu.Unlock()
+	if r.run.sent == nil {
+		r.run.sent = make(map[string]bool)
+	}
+	r.run.sent[path] = true
+}
+
+// Sent reports whether the file at path, recovered from the disk, was
+// handed to its sender, which may have left no copy of it there
+func (r *Reader) Sent(path string) bool {
+	r.run.mu.Lock()
+	defer r.run.mu.Unlock()
+	return r.run.sent[path]
+}
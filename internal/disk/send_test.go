@@ -0,0 +1,56 @@
+package disk
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// senderFunc is a function used as a Sender
+type senderFunc func(path string) error
+
+func (fn senderFunc) Send(path string) error {
+	return fn(path)
+}
+
+func TestFinished(t *testing.T) {
+	reader := NewReader(bytes.NewReader(make([]byte, 4096)), 4096, "mem")
+	reader.Finished("a.txt") // No sender
+	if reader.Sent("a.txt") {
+		t.Error("Expected nothing sent without a sender")
+	}
+
+	part := reader.Partition(Partition{Index: 1, Offset: 1024, Size: 2048})
+	var got []string
+	full := errors.New("share full")
+	reader.SetSender(senderFunc(func(path string) error {
+		if path == "c.txt" {
+			return full
+		}
+		got = append(got, path)
+		return nil
+	}))
+	part.Finished("a.txt")
+	part.Finished("b.txt")
+	if len(got) != 2 || got[0] != "a.txt" || got[1] != "b.txt" {
+		t.Errorf("Expected the partition's files to reach the disk's sender, got %v", got)
+	}
+	if !reader.Sent("b.txt") || reader.Sent("c.txt") {
+		t.Error("Expected the files sent to be known as sent")
+	}
+	if err := reader.Err(); err != nil {
+		t.Fatalf("Expected the run to go on, got %v", err)
+	}
+
+	part.Finished("c.txt")
+	if err := reader.Err(); !errors.Is(err, full) {
+		t.Errorf("Expected the run to stop with the sender's error, got %v", err)
+	}
+	if _, err := part.ReadAt(make([]byte, 512), 0); !errors.Is(err, full) {
+		t.Errorf("Expected reads to fail once the sender failed, got %v", err)
+	}
+	part.Finished("d.txt")
+	if len(got) != 2 || reader.Sent("c.txt") {
+		t.Errorf("Expected nothing sent once the sender failed, got %v", got)
+	}
+}
@@ -0,0 +1,95 @@
+package disk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+// TimelineEntry is a line of a filesystem timeline: a file or directory with
+// its times, or an event such as a change journal record or a deletion to
+// the recycle bin, which only has the time it happened (as Changed). Times
+// are Unix seconds, 0 when unknown.
+type TimelineEntry struct {
+	Path     string // Within its volume, with a note such as " (deleted)"
+	Inode    uint64 // MFT record, 0 on FAT32
+	Dir      bool
+	Size     int64
+	Accessed int64
+	Modified int64
+	Changed  int64 // Metadata changed
+	Created  int64
+}
+
+// filetimeEpoch is 1601-01-01, where Windows FILETIMEs count from, in Unix
+// seconds
+const filetimeEpoch = -11644473600
+
+// FiletimeUnix converts a Windows FILETIME (100ns intervals since 1601) to
+// Unix seconds, keeping 0 as unknown
+func FiletimeUnix(ft uint64) int64 {
+	if ft == 0 {
+		return 0
+	}
+	return int64(ft/10000000) + filetimeEpoch
+}
+
+// RecycleBinEntry reads a $I file of a Windows Vista or later recycle bin,
+// which records where the file next to it ($R...) was deleted from, its size
+// and when, into an entry for the deletion of the $R file. path is the $I
+// file's path.
+func RecycleBinEntry(path string, data []byte) (TimelineEntry, bool) {
+	le := binary.LittleEndian
+	if len(data) < 24 {
+		return TimelineEntry{}, false
+	}
+	var name []byte
+	switch le.Uint64(data) {
+	case 1: // Vista to 8.1: a fixed MAX_PATH name
+		if len(data) < 24+520 {
+			return TimelineEntry{}, false
+		}
+		name = data[24 : 24+520]
+	case 2: // 10 and later: a counted name
+		if len(data) < 28 {
+			return TimelineEntry{}, false
+		}
+		n := int(le.Uint32(data[24:]))
+		if n == 0 || 28+2*n > len(data) {
+			return TimelineEntry{}, false
+		}
+		name = data[28 : 28+2*n]
+	default:
+		return TimelineEntry{}, false
+	}
+
+	units := make([]uint16, 0, len(name)/2)
+	for i := 0; i+1 < len(name); i += 2 {
+		u := le.Uint16(name[i:])
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	original := string(utf16.Decode(units))
+	deleted := FiletimeUnix(le.Uint64(data[16:]))
+	if original == "" || deleted == 0 {
+		return TimelineEntry{}, false
+	}
+
+	dir, base := filepath.Split(path)
+	return TimelineEntry{
+		Path:    fmt.Sprintf("%s (deleted from %s)", filepath.Join(dir, "$R"+strings.TrimPrefix(base, "$I")), original),
+		Size:    int64(le.Uint64(data[8:])),
+		Changed: deleted,
+	}, true
+}
+
+// IsRecycleBinInfo reports whether a path is a $I file in a recycle bin
+func IsRecycleBinInfo(path string) bool {
+	base := filepath.Base(path)
+	return len(base) > 2 && strings.HasPrefix(base, "$I") &&
+		strings.Contains(strings.ToLower(filepath.ToSlash(path)), "$recycle.bin/")
+}
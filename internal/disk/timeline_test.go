@@ -0,0 +1,55 @@
+package disk
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+// recycleInfo builds a $I file of the given version
+func recycleInfo(version uint64, path string, size uint64, deleted int64) []byte {
+	le := binary.LittleEndian
+	chars := utf16.Encode([]rune(path))
+	data := make([]byte, 24+520)
+	if version == 2 {
+		data = make([]byte, 28+2*len(chars)+2)
+		le.PutUint32(data[24:], uint32(len(chars)+1))
+	}
+	le.PutUint64(data[0:], version)
+	le.PutUint64(data[8:], size)
+	le.PutUint64(data[16:], uint64(deleted-filetimeEpoch)*10000000)
+	name := data[24:]
+	if version == 2 {
+		name = data[28:]
+	}
+	for i, c := range chars {
+		le.PutUint16(name[2*i:], c)
+	}
+	return data
+}
+
+func TestRecycleBinEntry(t *testing.T) {
+	info := filepath.Join("$Recycle.Bin", "S-1-5-21", "$IAB12CD.docx")
+	want := TimelineEntry{
+		Path:    filepath.Join("$Recycle.Bin", "S-1-5-21", "$RAB12CD.docx") + ` (deleted from C:\Users\anna\report.docx)`,
+		Size:    20480,
+		Changed: 1623664921,
+	}
+	for _, version := range []uint64{1, 2} {
+		e, ok := RecycleBinEntry(info, recycleInfo(version, `C:\Users\anna\report.docx`, 20480, 1623664921))
+		if !ok || e != want {
+			t.Errorf("Version %d: expected %+v, got %+v (%v)", version, want, e, ok)
+		}
+	}
+
+	if _, ok := RecycleBinEntry(info, recycleInfo(3, `C:\a.txt`, 1, 1623664921)); ok {
+		t.Error("Expected an unknown version to be rejected")
+	}
+	if _, ok := RecycleBinEntry(info, recycleInfo(2, `C:\a.txt`, 1, 1623664921)[:30]); ok {
+		t.Error("Expected a truncated $I file to be rejected")
+	}
+	if !IsRecycleBinInfo(info) || IsRecycleBinInfo(filepath.Join("Users", "$IAB12CD.docx")) {
+		t.Error("Expected only $I files in $Recycle.Bin to be recycle bin information")
+	}
+}
@@ -0,0 +1,107 @@
+package disk
+
+import (
+	"io"
+	"path/filepath"
+)
+
+// A recovered file can differ from its source without any read failing: a
+// drive with weak sectors may return other data each time it is read, and
+// a copy can be damaged on its way to the output drive. With VerifyOutput,
+// once the files of a volume or carve are written, each is recovered again
+// from the disk without being written, and its copy is read back, and the
+// hash manifest records whether both still match the digest taken as it
+// was written. The second read is from the same disk, so a drive that
+// serves it from its own cache, or a system from the page cache, can agree
+// with itself; imaging a failing drive first makes the check meaningful.
+
+// Verification of the files in a hash manifest
+const (
+	VerifyOK         = "ok"         // Source and copy match what was written
+	VerifyMismatch   = "mismatch"   // The source read differently, or the copy does not hold what was written
+	VerifyUnreadable = "unreadable" // The source or the copy could not be read again
+)
+
+// VerifyOutput makes every run recovering from the disk, and from the
+// readers of its partitions, verify the files it wrote
+func (r *Reader) VerifyOutput(verify bool) {
+	r.output.verify = verify
+}
+
+// Verifying reports whether the files recovered from the disk are verified
+func (r *Reader) Verifying() bool {
+	return r.output.verify
+}
+
+// Verifier returns the disk as read to verify what was recovered from it:
+// files recovered from it are digested but not written. Its reads are
+// audited with the disk's.
+func (r *Reader) Verifier() *Reader {
+	v := NewReader(io.NewSectionReader(r, 0, r.size), r.size, r.Path())
+	v.audit = r.audit
+	v.output = &outputConfig{discard: true, free: -1}
+	v.run = r.run
+	v.counted = false
+	return v
+}
+
+// Unverified returns the number of files recovered from the disk that
+// failed verification
+func (r *Reader) Unverified() int {
+	r.output.mu.Lock()
+	defer r.output.mu.Unlock()
+	return r.output.unverified
+}
+
+// Verify verifies the files of a hash manifest of outputDir that were
+// recovered from the disk, source(i) recovering entries[i] again from the
+// reader Verifier returns, and records the outcome in each entry
+func (r *Reader) Verify(outputDir string, entries []ManifestEntry, source func(i int) (Digest, error)) {
+	defer r.Purpose("verification")()
+	r.Printf("\nVerifying %d recovered files against the source...\n", len(entries))
+	failed := 0
+	for i := range entries {
+		if r.Err() != nil {
+			break // Left unverified
+		}
+		e := &entries[i]
+		r.Report(Progress{Phase: "verification", Current: int64(i), Total: int64(len(entries)), Item: e.Path})
+		e.Verified = r.verifyFile(filepath.Join(outputDir, filepath.FromSlash(e.Path)), e.Digest, func() (Digest, error) {
+			return source(i)
+		})
+		if e.Verified != VerifyOK {
+			r.Errorf("  Verification %s: %s\n", e.Verified, e.Path)
+			failed++
+		}
+	}
+	r.Printf("  %d verified, %d failed\n", len(entries)-failed, failed)
+
+	r.output.mu.Lock()
+	r.output.unverified += failed
+	r.output.mu.Unlock()
+}
+
+// verifyFile checks the source and the copy at path of a file recovered as
+// written
+func (r *Reader) verifyFile(path string, written Digest, source func() (Digest, error)) string {
+	read, err := source()
+	if err != nil {
+		return VerifyUnreadable
+	}
+	if read != written {
+		return VerifyMismatch
+	}
+	f, err := r.OpenOutput(path)
+	if err != nil {
+		return VerifyUnreadable
+	}
+	defer f.Close()
+	w := NewDigestWriter(io.Discard)
+	if _, err := io.Copy(w, f); err != nil {
+		return VerifyUnreadable
+	}
+	if w.Digest() != written {
+		return VerifyMismatch
+	}
+	return VerifyOK
+}
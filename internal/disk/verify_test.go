@@ -0,0 +1,59 @@
+package disk
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	source := bytes.Repeat([]byte("report "), 1000)
+	r := NewReader(bytes.NewReader(source), int64(len(source)), "test.img")
+	r.VerifyOutput(true)
+	dir := t.TempDir()
+
+	// copyFile copies the source through a reader, as a filesystem would
+	copyFile := func(r *Reader, path string) (Digest, error) {
+		out, err := r.CreateOutput(path)
+		if err != nil {
+			return Digest{}, err
+		}
+		defer out.Discard()
+		buf := make([]byte, len(source))
+		if _, err := r.ReadAt(buf, 0); err != nil {
+			return Digest{}, err
+		}
+		out.Write(buf)
+		return out.Digest(), out.Close()
+	}
+	var entries []ManifestEntry
+	for _, name := range []string{"good.txt", "damaged.txt", "unreadable.txt"} {
+		digest, err := copyFile(r, filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Failed to recover %s: %v", name, err)
+		}
+		entries = append(entries, ManifestEntry{Path: name, Digest: digest})
+	}
+	os.WriteFile(filepath.Join(dir, "damaged.txt"), []byte("not the report"), 0644)
+
+	verifier := r.Verifier()
+	r.Verify(dir, entries, func(i int) (Digest, error) {
+		if entries[i].Path == "unreadable.txt" {
+			return Digest{}, errors.New("read error")
+		}
+		return copyFile(verifier, filepath.Join(dir, "again", entries[i].Path))
+	})
+	for i, want := range []string{VerifyOK, VerifyMismatch, VerifyUnreadable} {
+		if entries[i].Verified != want {
+			t.Errorf("Expected %s to verify %q, got %q", entries[i].Path, want, entries[i].Verified)
+		}
+	}
+	if n := r.Unverified(); n != 2 {
+		t.Errorf("Expected 2 files to fail verification, got %d", n)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "again")); !os.IsNotExist(err) {
+		t.Error("Expected the verifier to write nothing")
+	}
+}
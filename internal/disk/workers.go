@@ -0,0 +1,51 @@
+package disk
+
+import "iter"
+
+// A recovery can write several files at once: reads of the disk are at
+// any offset, and a fast destination keeps up with more than one file, so
+// reading and writing them in parallel takes less time on an SSD or a
+// disk image. The files are still taken up in order and what is reported
+// of them, messages, progress, hooks and manifests, is reported in that
+// order, from the goroutine of the run; only the writing of each is done
+// on a worker.
+
+// SetWorkers makes the runs recovering from the disk, and from the readers
+// of its partitions, write up to n files at once; 1 or less writes one at
+// a time
+func (r *Reader) SetWorkers(n int) {
+	r.output.workers = n
+}
+
+// Workers returns how many files the runs recovering from the disk write
+// at once
+func (r *Reader) Workers() int {
+	return max(r.output.workers, 1)
+}
+
+// InOrder runs each job of jobs, taken up in turn, on up to workers
+// goroutines, and gives done the result of each, in the order of the jobs,
+// on the goroutine that called it, as is jobs itself. A job must share
+// nothing with the others or with done but what it returns.
+func InOrder[T any](workers int, jobs iter.Seq[func() T], done func(T)) {
+	if workers <= 1 {
+		for job := range jobs {
+			done(job())
+		}
+		return
+	}
+	var pending []chan T // Of the jobs under way, in order
+	for job := range jobs {
+		// A job waits for the oldest to be done once all workers are busy
+		if len(pending) == workers {
+			done(<-pending[0])
+			pending = pending[1:]
+		}
+		result := make(chan T, 1)
+		pending = append(pending, result)
+		go func() { result <- job() }()
+	}
+	for _, result := range pending {
+		done(<-result)
+	}
+}
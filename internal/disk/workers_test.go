@@ -0,0 +1,50 @@
+package disk
+
+import (
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInOrder(t *testing.T) {
+	for _, workers := range []int{1, 3} {
+		var running, most atomic.Int32
+		jobs := func(yield func(func() int) bool) {
+			for i := range 10 {
+				if !yield(func() int {
+					n := running.Add(1)
+					for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+					}
+					// The first jobs take longest, so later ones finish first
+					time.Sleep(time.Duration(10-i) * time.Millisecond)
+					running.Add(-1)
+					return i
+				}) {
+					return
+				}
+			}
+		}
+		var got []int
+		InOrder(workers, jobs, func(i int) { got = append(got, i) })
+
+		if want := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}; !slices.Equal(got, want) {
+			t.Errorf("%d workers: expected the results in order, got %v", workers, got)
+		}
+		if m := most.Load(); m > int32(workers) || (workers > 1 && m < 2) {
+			t.Errorf("%d workers: %d jobs ran at once", workers, m)
+		}
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	reader := NewReader(nil, 0, "mem")
+	if n := reader.Workers(); n != 1 {
+		t.Errorf("Expected 1 worker by default, got %d", n)
+	}
+	reader.SetWorkers(4)
+	part := reader.Partition(Partition{Index: 1})
+	if n := part.Workers(); n != 4 {
+		t.Errorf("Expected a partition to write with its disk's 4 workers, got %d", n)
+	}
+}
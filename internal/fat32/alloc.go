@@ -0,0 +1,92 @@
+package fat32
+
+import (
+	"fmt"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// FreeSpace returns the clusters of the data region that the FAT marks free,
+// as byte ranges in volume order
+func (p *Parser) FreeSpace() ([]disk.Extent, error) {
+	if p.clusterSz == 0 {
+		return nil, &disk.BootSectorError{Filesystem: "FAT32", Details: "invalid cluster size"}
+	}
+	if p.fatTable == nil {
+		if err := p.loadFAT(); err != nil {
+			return nil, err
+		}
+	}
+
+	total := int64(p.bootSector.TotalSectors32) * int64(p.bootSector.BytesPerSector)
+	total = min(total, p.reader.Size())
+	clusters := (total - p.dataStart) / int64(p.clusterSz)
+	// The first two FAT entries are reserved; cluster 2 is the first one
+	clusters = min(clusters, int64(len(p.fatTable)-2))
+	if clusters <= 0 {
+		return nil, fmt.Errorf("no data region")
+	}
+
+	return disk.FreeExtents(clusters, func(c int64) bool {
+		return p.fatTable[c+2]&0x0FFFFFFF != 0
+	}, p.dataStart, int64(p.clusterSz)), nil
+}
+
+// FileExtents returns where RecoverFile reads a deleted file's data from:
+// the clusters that follow its first one, since its chain was cleared
+func (p *Parser) FileExtents(file RecoveredFile) []disk.Extent {
+	if file.FirstCluster < 2 || file.Size == 0 {
+		return nil
+	}
+	clusterSz := int64(p.clusterSz)
+	length := (int64(file.Size) + clusterSz - 1) / clusterSz * clusterSz
+	length = min(length, p.reader.Size()-p.clusterToOffset(file.FirstCluster))
+	if length <= 0 {
+		return nil
+	}
+	return []disk.Extent{{Offset: p.clusterToOffset(file.FirstCluster), Length: length}}
+}
+
+// Allocations returns where each file and directory below the root lies:
+// the cluster chain of those in use, and for deleted files the clusters
+// RecoverFile would read
+func (p *Parser) Allocations() ([]disk.Allocation, error) {
+	if p.clusterSz == 0 {
+		return nil, &disk.BootSectorError{Filesystem: "FAT32", Details: "invalid cluster size"}
+	}
+	if p.fatTable == nil {
+		if err := p.loadFAT(); err != nil {
+			return nil, err
+		}
+	}
+
+	var allocs []disk.Allocation
+	err := p.scanDirectory(p.bootSector.RootCluster, "", func(file RecoveredFile) error {
+		extents := p.FileExtents(file)
+		if !file.IsDeleted {
+			extents = p.chainExtents(file.FirstCluster)
+		}
+		if len(extents) > 0 {
+			allocs = append(allocs, disk.Allocation{Path: file.Path, Deleted: file.IsDeleted, Extents: extents})
+		}
+		return nil
+	}, make(map[uint32]bool))
+	return allocs, err
+}
+
+// chainExtents follows a cluster chain through the FAT and returns its
+// clusters as byte ranges, runs of consecutive clusters merged
+func (p *Parser) chainExtents(cluster uint32) []disk.Extent {
+	var extents []disk.Extent
+	clusterSz := int64(p.clusterSz)
+	for n := 0; cluster >= 2 && cluster < ClusterEndMarker && int(cluster) < len(p.fatTable) && n < len(p.fatTable); n++ {
+		offset := p.clusterToOffset(cluster)
+		if k := len(extents); k > 0 && extents[k-1].Offset+extents[k-1].Length == offset {
+			extents[k-1].Length += clusterSz
+		} else {
+			extents = append(extents, disk.Extent{Offset: offset, Length: clusterSz})
+		}
+		cluster = p.fatTable[cluster] & 0x0FFFFFFF
+	}
+	return extents
+}
@@ -0,0 +1,97 @@
+package fat32
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/internal/disk/disktest"
+)
+
+func TestFreeSpace(t *testing.T) {
+	// 20 clusters: the root directory, a file in clusters 3-5 and another
+	// in cluster 10
+	data := disktest.FAT32(20)
+	disktest.Allocate(data, 2, 5, 10)
+	disktest.SetFAT(data, 3, 4)
+	disktest.SetFAT(data, 4, 5)
+
+	reader, err := disk.Open(disktest.Write(t, "fat32.img", data))
+	if err != nil {
+		t.Fatalf("Failed to open image: %v", err)
+	}
+	defer reader.Close()
+
+	parser, err := NewParser(reader)
+	if err != nil {
+		t.Fatalf("NewParser failed: %v", err)
+	}
+	extents, err := parser.FreeSpace()
+	if err != nil {
+		t.Fatalf("FreeSpace failed: %v", err)
+	}
+
+	dataStart := int64(34 * 512)
+	// Clusters 6-9 and 11-21
+	want := []disk.Extent{
+		{Offset: dataStart + 4*4096, Length: 4 * 4096},
+		{Offset: dataStart + 9*4096, Length: 11 * 4096},
+	}
+	if !reflect.DeepEqual(extents, want) {
+		t.Errorf("Expected %v, got %v", want, extents)
+	}
+}
+
+func TestFileExtents(t *testing.T) {
+	reader, err := disk.Open(disktest.Write(t, "fat32.img", disktest.FAT32(20)))
+	if err != nil {
+		t.Fatalf("Failed to open image: %v", err)
+	}
+	defer reader.Close()
+	parser, err := NewParser(reader)
+	if err != nil {
+		t.Fatalf("NewParser failed: %v", err)
+	}
+
+	dataStart := int64(34 * 512)
+	for _, tt := range []struct {
+		file RecoveredFile
+		want []disk.Extent
+	}{
+		{RecoveredFile{FirstCluster: 5, Size: 5000}, []disk.Extent{{Offset: dataStart + 3*4096, Length: 2 * 4096}}},
+		{RecoveredFile{FirstCluster: 21, Size: 10000}, []disk.Extent{{Offset: dataStart + 19*4096, Length: 4096}}}, // Clipped to the disk
+		{RecoveredFile{FirstCluster: 0, Size: 100}, nil},
+		{RecoveredFile{FirstCluster: 5}, nil},
+	} {
+		if got := parser.FileExtents(tt.file); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("FileExtents(%+v) = %v, want %v", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestAllocations(t *testing.T) {
+	// A.TXT in clusters 3, 4 and 7, SUB in 5, and a deleted OLD.TXT of 5000
+	// bytes from cluster 9
+	fat := []uint32{0x0FFFFFF8, 0x0FFFFFFF, 0x0FFFFFFF, 4, 7, 0x0FFFFFFF, 0, 0x0FFFFFFF}
+	parser := newVolume(t, fat, func(cluster func(int) []byte) {
+		root := cluster(2)
+		copy(root[0:], disktest.DirEntry("A       TXT", 0, 3, 10000))
+		copy(root[32:], disktest.DirEntry("SUB        ", AttrDirectory, 5, 0))
+		copy(root[64:], disktest.DirEntry("\xE5OLD    TXT", 0, 9, 5000))
+	})
+	allocs, err := parser.Allocations()
+	if err != nil {
+		t.Fatalf("Allocations failed: %v", err)
+	}
+
+	dataStart := int64(34 * 512)
+	cluster := func(c int64) int64 { return dataStart + (c-2)*4096 }
+	want := []disk.Allocation{
+		{Path: "A.TXT", Extents: []disk.Extent{{Offset: cluster(3), Length: 2 * 4096}, {Offset: cluster(7), Length: 4096}}},
+		{Path: "SUB", Extents: []disk.Extent{{Offset: cluster(5), Length: 4096}}},
+		{Path: "?OLD.TXT", Deleted: true, Extents: []disk.Extent{{Offset: cluster(9), Length: 2 * 4096}}},
+	}
+	if !reflect.DeepEqual(allocs, want) {
+		t.Errorf("Expected %+v, got %+v", want, allocs)
+	}
+}
@@ -2,11 +2,13 @@ package fat32
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 	"unicode/utf16"
 
 	"github.com/shubham/recovery/internal/disk"
@@ -90,6 +92,10 @@ type RecoveredFile struct {
 	Size         uint32
 	IsDirectory  bool
 	IsDeleted    bool
+	Created      time.Time // Local time, as FAT keeps it; zero when unset
+	Modified     time.Time
+	Accessed     time.Time // Date only
+	Entry        int64     // Offset of its directory entry on the volume
 }
 
 // FAT32 parser
@@ -133,6 +139,9 @@ func (p *Parser) readBootSector() error {
 	p.dataStart = p.fatStart + int64(p.bootSector.NumFATs)*fatSize
 	p.clusterSz = int(p.bootSector.SectorsPerCluster) * int(p.bootSector.BytesPerSector)
 
+	if p.clusterSz == 0 {
+		return &disk.BootSectorError{Filesystem: "FAT32", Details: "invalid cluster size"}
+	}
 	return nil
 }
 
@@ -167,22 +176,60 @@ func (p *Parser) readCluster(cluster uint32) ([]byte, error) {
 
 // ScanDeletedFiles scans directory entries for deleted files
 func (p *Parser) ScanDeletedFiles() ([]RecoveredFile, error) {
-	if err := p.loadFAT(); err != nil {
+	return p.scanFiles(false)
+}
+
+// scanFiles scans directory entries for deleted files, and with live for
+// the files and directories in use too
+func (p *Parser) scanFiles(live bool) ([]RecoveredFile, error) {
+	var files []RecoveredFile
+	err := p.walkFiles(live, func(file RecoveredFile) error {
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
+	return files, nil
+}
 
-	var files []RecoveredFile
-	visited := make(map[uint32]bool)
+// WalkDeletedFiles scans directory entries and calls visit with each
+// deleted file as it is found, so that a volume of millions of files can be
+// filtered, shown or saved as it is scanned. The scan stops at the first
+// error visit returns, and returns it.
+func (p *Parser) WalkDeletedFiles(visit func(RecoveredFile) error) error {
+	return p.walkFiles(false, visit)
+}
 
-	// Start from root cluster
-	if err := p.scanDirectory(p.bootSector.RootCluster, "", &files, visited); err != nil {
-		return nil, err
+// walkFiles is WalkDeletedFiles, visiting with live the files and
+// directories in use too
+func (p *Parser) walkFiles(live bool, visit func(RecoveredFile) error) error {
+	if err := p.loadFAT(); err != nil {
+		return err
 	}
 
-	return files, nil
+	visited := make(map[uint32]bool)
+
+	// Start from root cluster; how many entries there are is not known
+	// until they are all read
+	var entries, found int64
+	return p.scanDirectory(p.bootSector.RootCluster, "", func(file RecoveredFile) error {
+		if file.IsDeleted || live {
+			if err := visit(file); err != nil {
+				return err
+			}
+			found++
+		}
+		entries++
+		p.reader.Report(disk.Progress{Phase: "directory scan", Current: entries, Found: found, Item: file.Path})
+		return nil
+	}, visited)
 }
 
-func (p *Parser) scanDirectory(cluster uint32, path string, files *[]RecoveredFile, visited map[uint32]bool) error {
+// scanDirectory calls visit for each entry of a directory and, recursively,
+// of the directories in use below it. A directory below it that cannot be
+// read is skipped, but an error of visit or of a cancelled run stops it.
+func (p *Parser) scanDirectory(cluster uint32, path string, visit func(RecoveredFile) error, visited map[uint32]bool) error {
 	for cluster != 0 && cluster < ClusterEndMarker {
 		if visited[cluster] {
 			break
@@ -248,16 +295,21 @@ func (p *Parser) scanDirectory(cluster uint32, path string, files *[]RecoveredFi
 				Size:         fileSize,
 				IsDirectory:  isDir,
 				IsDeleted:    isDeleted,
+				Created:      dosTime(binary.LittleEndian.Uint16(entry[16:18]), binary.LittleEndian.Uint16(entry[14:16]), entry[13]),
+				Modified:     dosTime(binary.LittleEndian.Uint16(entry[24:26]), binary.LittleEndian.Uint16(entry[22:24]), 0),
+				Accessed:     dosTime(binary.LittleEndian.Uint16(entry[18:20]), 0, 0),
+				Entry:        p.clusterToOffset(cluster) + int64(i),
 			}
 
-			if isDeleted {
-				*files = append(*files, file)
+			if err := visit(file); err != nil {
+				return err
 			}
 
 			// Recurse into directories (but not deleted ones - clusters may be reused)
 			if isDir && !isDeleted && firstCluster >= 2 {
-				if err := p.scanDirectory(firstCluster, file.Path, files, visited); err != nil {
-					// Continue on error
+				var readErr *disk.ReadError
+				if err := p.scanDirectory(firstCluster, file.Path, visit, visited); err != nil && err != io.EOF && !errors.As(err, &readErr) {
+					return err
 				}
 			}
 		}
@@ -273,6 +325,16 @@ func (p *Parser) scanDirectory(cluster uint32, path string, files *[]RecoveredFi
 	return nil
 }
 
+// dosTime decodes a directory entry's date and time, with its hundredths of
+// a second, or returns the zero time for an unset date
+func dosTime(date, tm uint16, hundredths uint8) time.Time {
+	if date == 0 {
+		return time.Time{}
+	}
+	return time.Date(1980+int(date>>9), time.Month(date>>5&0x0F), int(date&0x1F),
+		int(tm>>11), int(tm>>5&0x3F), int(tm&0x1F)*2, int(hundredths)*10*int(time.Millisecond), time.UTC)
+}
+
 func (p *Parser) parseLFNEntry(entry []byte) string {
 	var chars []uint16
 
@@ -321,82 +383,102 @@ func (p *Parser) parseShortName(name []byte, isDeleted bool) string {
 	return baseName
 }
 
-// RecoverFile extracts a deleted file's data
-func (p *Parser) RecoverFile(file RecoveredFile, outputPath string) error {
+// RecoverFile extracts a file's data, returning the digest of what it
+// wrote
+func (p *Parser) RecoverFile(file RecoveredFile, outputPath string) (disk.Digest, error) {
 	if file.IsDirectory {
-		return os.MkdirAll(outputPath, 0755)
+		return disk.Digest{}, os.MkdirAll(outputPath, 0755)
 	}
 
-	// For deleted files, we can only recover the first cluster chain
-	// since FAT entries are zeroed. We estimate clusters needed.
-	clustersNeeded := (file.Size + uint32(p.clusterSz) - 1) / uint32(p.clusterSz)
-	if clustersNeeded == 0 {
-		clustersNeeded = 1
-	}
-
-	// Create output directory
-	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
-		return err
+	data, err := p.OpenFile(file)
+	if err != nil {
+		return disk.Digest{}, err
 	}
-
-	outFile, err := os.Create(outputPath)
+	outFile, err := p.reader.CreateOutput(outputPath)
 	if err != nil {
-		return err
+		return disk.Digest{}, err
 	}
-	defer outFile.Close()
-
-	var bytesWritten uint32
-	cluster := file.FirstCluster
-
-	for i := uint32(0); i < clustersNeeded && bytesWritten < file.Size; i++ {
-		data, err := p.readCluster(cluster)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
-
-		toWrite := uint32(len(data))
-		remaining := file.Size - bytesWritten
-		if toWrite > remaining {
-			toWrite = remaining
-		}
-
-		if _, err := outFile.Write(data[:toWrite]); err != nil {
-			return err
-		}
-
-		bytesWritten += toWrite
+	defer outFile.Discard()
+	if _, err := io.Copy(outFile, data); err != nil {
+		return disk.Digest{}, err
+	}
+	return outFile.Digest(), outFile.Close()
+}
 
-		// For deleted files, assume contiguous clusters
-		cluster++
+// OpenFile returns a reader of a file's data as RecoverFile writes it, for
+// it to be streamed elsewhere than to a file. A live file's data is read
+// along its cluster chain. For deleted files, we can only recover the
+// first cluster chain since FAT entries are zeroed, so the clusters are
+// assumed contiguous.
+func (p *Parser) OpenFile(file RecoveredFile) (io.Reader, error) {
+	if file.IsDirectory {
+		return nil, fmt.Errorf("%s is a directory", file.Name)
 	}
+	extents := p.FileExtents(file)
+	if !file.IsDeleted {
+		extents = p.chainExtents(file.FirstCluster)
+	}
+	var parts []io.Reader
+	for _, ext := range disk.Limit(extents, int64(file.Size)) {
+		parts = append(parts, io.NewSectionReader(p.reader, ext.Offset, ext.Length))
+	}
+	return io.MultiReader(parts...), nil
+}
 
-	return nil
+// recovered is a file a recovery wrote to outPath, rel below its output
+// directory, or failed to
+type recovered struct {
+	file    RecoveredFile
+	rel     string
+	outPath string
+	digest  disk.Digest
+	err     error
 }
 
-// Recover is the main entry point for FAT32 recovery
+// Recover is the main entry point for FAT32 recovery.
+// When files could not be recovered, the error is a
+// *disk.PartialRecoveryError listing them, the others having been written
 func Recover(reader *disk.Reader, outputDir string, scanOnly bool, carveMode bool) (int, error) {
+	defer reader.Purpose("FAT32 recovery")()
+
 	parser, err := NewParser(reader)
 	if err != nil {
 		return 0, err
 	}
 
-	fmt.Printf("FAT32 filesystem detected\n")
-	fmt.Printf("  Bytes per sector: %d\n", parser.bootSector.BytesPerSector)
-	fmt.Printf("  Sectors per cluster: %d\n", parser.bootSector.SectorsPerCluster)
-	fmt.Printf("  Cluster size: %d bytes\n", parser.clusterSz)
-	fmt.Printf("  Root cluster: %d\n", parser.bootSector.RootCluster)
-	fmt.Println()
-
-	files, err := parser.ScanDeletedFiles()
+	reader.Printf("FAT32 filesystem detected\n")
+	reader.Verbosef("  Bytes per sector: %d\n", parser.bootSector.BytesPerSector)
+	reader.Verbosef("  Sectors per cluster: %d\n", parser.bootSector.SectorsPerCluster)
+	reader.Verbosef("  Cluster size: %d bytes\n", parser.clusterSz)
+	reader.Verbosef("  Root cluster: %d\n", parser.bootSector.RootCluster)
+	reader.Println()
+
+	// A full extraction takes the files in use too
+	live, kind := reader.LiveFiles(), "deleted "
+	if live {
+		kind = ""
+	}
+	files, err := parser.scanFiles(live)
 	if err != nil {
 		return 0, err
 	}
+	if filter := reader.Filter(); filter.Active() {
+		kept := files[:0]
+		for _, f := range files {
+			e := disk.FileEntry{
+				Path: f.Path, Dir: f.IsDirectory, Deleted: f.IsDeleted, Size: int64(f.Size),
+				Created: unixTime(f.Created), Modified: unixTime(f.Modified),
+			}
+			if filter.Match(e) {
+				kept = append(kept, f)
+			}
+		}
+		reader.Printf("Left out %d %sfiles and directories the filter does not keep\n", len(files)-len(kept), kind)
+		files = kept
+	}
 
-	fmt.Printf("Found %d deleted files:\n\n", len(files))
-	for i, f := range files {
+	reader.Printf("Found %d %sfiles:\n\n", len(files), kind)
+	for _, f := range files {
 		name := f.LongName
 		if name == "" {
 			name = f.Name
@@ -405,33 +487,94 @@ func Recover(reader *disk.Reader, outputDir string, scanOnly bool, carveMode boo
 		if f.IsDirectory {
 			fileType = "DIR "
 		}
-		fmt.Printf("[%d] %s %s (%d bytes)\n", i+1, fileType, f.Path, f.Size)
+		state := ""
+		if live && f.IsDeleted {
+			state = ", deleted"
+		}
+		reader.Printf("  %s %s (%d bytes%s)\n", fileType, f.Path, f.Size, state)
 	}
 
 	if scanOnly {
 		return len(files), nil
 	}
 
-	fmt.Println("\nRecovering files...")
-	recovered := 0
+	count, total := 0, int64(0)
 	for _, f := range files {
-		if f.IsDirectory {
-			continue
+		if !f.IsDirectory {
+			count, total = count+1, total+int64(f.Size)
 		}
+	}
+	if err := reader.PlanOutput(count, total); err != nil {
+		return 0, err
+	}
 
-		name := f.LongName
-		if name == "" {
-			name = f.Name
+	reader.Println("\nRecovering files...")
+	var written []disk.ManifestEntry
+	var sources []RecoveredFile // Of the files written
+	var failed []*disk.FileError
+	names := disk.NewNames()
+	attempted := 0
+	var stopped error
+	jobs := func(yield func(func() recovered) bool) {
+		for _, f := range files {
+			if stopped = reader.Err(); stopped != nil {
+				return
+			}
+			if f.IsDirectory {
+				continue
+			}
+			reader.Report(disk.Progress{Phase: "FAT32 recovery", Current: int64(attempted), Total: int64(count), Found: int64(len(written)), Item: f.Path})
+			attempted++
+
+			// Files with the same path are all kept, the later under a new name
+			rel := reader.OutputPath(names.Claim(f.Path))
+			outPath := filepath.Join(outputDir, rel)
+			if !yield(func() recovered {
+				digest, err := parser.RecoverFile(f, outPath)
+				return recovered{f, rel, outPath, digest, err}
+			}) {
+				return
+			}
 		}
-		outPath := filepath.Join(outputDir, f.Path)
-
-		if err := parser.RecoverFile(f, outPath); err != nil {
-			fmt.Printf("  Failed to recover %s: %v\n", name, err)
-			continue
+	}
+	disk.InOrder(reader.Workers(), jobs, func(r recovered) {
+		f := r.file
+		if r.err != nil {
+			name := f.LongName
+			if name == "" {
+				name = f.Name
+			}
+			reader.Errorf("  Failed to recover %s: %v\n", name, r.err)
+			if !errors.Is(r.err, disk.ErrOutputFull) { // Left out on purpose, and listed
+				failed = append(failed, &disk.FileError{Path: f.Path, Err: r.err})
+			}
+			return
+		}
+		reader.Printf("  Recovered: %s\n", r.outPath)
+		reader.Recovered(disk.WrittenFile{Path: r.outPath, Original: f.Path, Source: "fat32", Digest: r.digest})
+		reader.Finished(r.outPath)
+		entry := disk.ManifestEntry{Path: filepath.ToSlash(r.rel), Status: reader.OutputStatus(), Digest: r.digest}
+		if r.rel != f.Path {
+			entry.Original = filepath.ToSlash(f.Path)
 		}
-		fmt.Printf("  Recovered: %s\n", outPath)
-		recovered++
+		written = append(written, entry)
+		sources = append(sources, f)
+	})
+	if stopped != nil {
+		return len(written), stopped
 	}
 
-	return recovered, nil
+	if reader.Verifying() {
+		verifier, err := NewParser(reader.Verifier())
+		if err != nil {
+			return len(written), err
+		}
+		reader.Verify(outputDir, written, func(i int) (disk.Digest, error) {
+			return verifier.RecoverFile(sources[i], "")
+		})
+	}
+	if err := disk.WriteManifest(outputDir, written); err != nil {
+		return len(written), err
+	}
+	return len(written), disk.Partial(len(written), failed)
 }
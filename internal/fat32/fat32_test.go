@@ -1,12 +1,18 @@
 package fat32
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/internal/disk/disktest"
 )
 
 func createFAT32Image(t *testing.T) string {
@@ -128,6 +134,90 @@ func TestNewParser(t *testing.T) {
 	}
 }
 
+func TestNewParserCorrupt(t *testing.T) {
+	boot := make([]byte, 4096)
+	copy(boot[82:], "FAT32   ")
+	_, err := NewParser(disk.NewReader(bytes.NewReader(boot), int64(len(boot)), "blank.img"))
+	var bse *disk.BootSectorError
+	if !errors.As(err, &bse) || bse.Filesystem != "FAT32" || !errors.Is(err, disk.ErrCorruptBootSector) {
+		t.Errorf("Expected a corrupt FAT32 boot sector, got %v", err)
+	}
+}
+
+func TestWalkDeletedFiles(t *testing.T) {
+	// A deleted A.TXT in the root, and SUB in cluster 3 holding a deleted
+	// B.BIN and C.BIN
+	fat := []uint32{0x0FFFFFF8, 0x0FFFFFFF, 0x0FFFFFFF, 0x0FFFFFFF}
+	parser := newVolume(t, fat, func(cluster func(int) []byte) {
+		root := cluster(2)
+		copy(root[0:], disktest.DirEntry("\xE5       TXT", 0, 5, 10))
+		copy(root[32:], disktest.DirEntry("SUB        ", AttrDirectory, 3, 0))
+		copy(cluster(3)[0:], disktest.DirEntry("\xE5       BIN", 0, 6, 10))
+		copy(cluster(3)[32:], disktest.DirEntry("\xE5       BIN", 0, 7, 10))
+	})
+
+	var paths []string
+	err := parser.WalkDeletedFiles(func(file RecoveredFile) error {
+		paths = append(paths, file.Path)
+		return nil
+	})
+	want := []string{"?.TXT", filepath.Join("SUB", "?.BIN"), filepath.Join("SUB", "?.BIN")}
+	if err != nil || !reflect.DeepEqual(paths, want) {
+		t.Errorf("Expected %v, got %v (%v)", want, paths, err)
+	}
+
+	// The first error of visit stops the walk, in a directory below the
+	// root too
+	stop := errors.New("stop")
+	paths = nil
+	err = parser.WalkDeletedFiles(func(file RecoveredFile) error {
+		paths = append(paths, file.Path)
+		if len(paths) == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || !reflect.DeepEqual(paths, want[:2]) {
+		t.Errorf("Expected the walk to stop after two files, got %v (%v)", paths, err)
+	}
+}
+
+func TestRecoverLiveFiles(t *testing.T) {
+	// A.TXT in clusters 3 and 6, and a deleted B.TXT in cluster 8
+	fat := []uint32{0x0FFFFFF8, 0x0FFFFFFF, 0x0FFFFFFF, 6, 0, 0, 0x0FFFFFFF}
+	parser := newVolume(t, fat, func(cluster func(int) []byte) {
+		root := cluster(2)
+		copy(root[0:], disktest.DirEntry("A       TXT", 0, 3, 5000))
+		copy(root[32:], disktest.DirEntry("\xE5       TXT", 0, 8, 100))
+		copy(cluster(3), bytes.Repeat([]byte("a"), 4096))
+		copy(cluster(4), bytes.Repeat([]byte("x"), 4096))
+		copy(cluster(6), bytes.Repeat([]byte("b"), 904))
+		copy(cluster(8), bytes.Repeat([]byte("c"), 100))
+	})
+	reader := parser.reader
+	reader.SetReporter(disk.NewPrinter(io.Discard))
+
+	for _, live := range []bool{false, true} {
+		reader.SetLiveFiles(live)
+		dir := t.TempDir()
+		want := map[string]string{"?.TXT": strings.Repeat("c", 100)}
+		if live {
+			// Along its chain, not the clusters after its first
+			want["A.TXT"] = strings.Repeat("a", 4096) + strings.Repeat("b", 904)
+		}
+		n, err := Recover(reader, dir, false, false)
+		if err != nil || n != len(want) {
+			t.Fatalf("Recover with live %v = %d, %v; want %d files", live, n, err, len(want))
+		}
+		for name, content := range want {
+			got, err := os.ReadFile(filepath.Join(dir, disk.SafePath(name)))
+			if err != nil || string(got) != content {
+				t.Errorf("With live %v, %s holds %d bytes (%v), want %d", live, name, len(got), err, len(content))
+			}
+		}
+	}
+}
+
 func TestParseShortName(t *testing.T) {
 	p := &Parser{}
 
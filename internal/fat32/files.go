@@ -0,0 +1,90 @@
+package fat32
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func init() {
+	disk.RegisterFilesystem(filesystem{})
+}
+
+// filesystem is FAT32 as the registry of filesystems knows it
+type filesystem struct{}
+
+func (filesystem) Name() string {
+	return "fat32"
+}
+
+func (filesystem) Detect(boot []byte) bool {
+	return len(boot) >= 87 && (string(boot[82:87]) == "FAT32" || string(boot[54:59]) == "FAT32")
+}
+
+// Scan lists the files of a volume through Files
+func (filesystem) Scan(volume *disk.Reader) (disk.Volume, []disk.FileEntry, error) {
+	p, err := NewParser(volume)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err := p.Files()
+	return p, files, err
+}
+
+func (filesystem) Recover(volume *disk.Reader, outputDir string, scanOnly bool) (int, error) {
+	return Recover(volume, outputDir, scanOnly, false)
+}
+
+// Files returns every file and directory below the root, live or deleted,
+// with where its data lies (for deleted files, where RecoverFile reads it
+// from) and the times in its directory entry
+func (p *Parser) Files() ([]disk.FileEntry, error) {
+	if p.clusterSz == 0 {
+		return nil, &disk.BootSectorError{Filesystem: "FAT32", Details: "invalid cluster size"}
+	}
+	if p.fatTable == nil {
+		if err := p.loadFAT(); err != nil {
+			return nil, err
+		}
+	}
+
+	var entries []disk.FileEntry
+	err := p.scanDirectory(p.bootSector.RootCluster, "", func(file RecoveredFile) error {
+		e := disk.FileEntry{
+			Path:     file.Path,
+			Record:   file.Entry,
+			Dir:      file.IsDirectory,
+			Deleted:  file.IsDeleted,
+			Size:     int64(file.Size),
+			Accessed: unixTime(file.Accessed),
+			Modified: unixTime(file.Modified),
+			Created:  unixTime(file.Created),
+		}
+		switch {
+		case file.IsDirectory:
+		case file.IsDeleted:
+			e.Extents = disk.Limit(p.FileExtents(file), e.Size)
+		default:
+			e.Extents = disk.Limit(p.chainExtents(file.FirstCluster), e.Size)
+		}
+		entries = append(entries, e)
+		return nil
+	}, make(map[uint32]bool))
+	return entries, err
+}
+
+// RecoverEntry writes a file Files listed to outputPath, following its
+// cluster chain when it is live
+func (p *Parser) RecoverEntry(e disk.FileEntry, outputPath string) (disk.Digest, error) {
+	return p.reader.WriteEntry(e, outputPath)
+}
+
+// OpenEntry returns a reader of a file Files listed, as RecoverEntry writes
+// it
+func (p *Parser) OpenEntry(e disk.FileEntry) (io.Reader, error) {
+	if e.Dir {
+		return nil, fmt.Errorf("%s is a directory", e.Path)
+	}
+	return p.reader.OpenEntry(e), nil
+}
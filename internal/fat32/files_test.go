@@ -0,0 +1,39 @@
+package fat32
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/internal/disk/disktest"
+)
+
+func TestFiles(t *testing.T) {
+	// A.TXT in clusters 3 and 6, SUB in 4 holding a deleted B.BIN that
+	// started in cluster 8
+	dataStart := int64(34 * 512)
+	fat := []uint32{0x0FFFFFF8, 0x0FFFFFFF, 0x0FFFFFFF, 6, 0x0FFFFFFF, 0, 0x0FFFFFFF}
+	parser := newVolume(t, fat, func(cluster func(int) []byte) {
+		root := cluster(2)
+		copy(root[0:], disktest.DirEntry("A       TXT", 0, 3, 5000))
+		copy(root[32:], disktest.DirEntry("SUB        ", AttrDirectory, 4, 0))
+		copy(cluster(4), disktest.DirEntry("\xE5       BIN", 0, 8, 100))
+	})
+	files, err := parser.Files()
+	if err != nil {
+		t.Fatalf("Files failed: %v", err)
+	}
+
+	want := []disk.FileEntry{
+		{Path: "A.TXT", Record: dataStart, Size: 5000, Extents: []disk.Extent{
+			{Offset: dataStart + 1*4096, Length: 4096},
+			{Offset: dataStart + 4*4096, Length: 5000 - 4096},
+		}},
+		{Path: "SUB", Record: dataStart + 32, Dir: true},
+		{Path: filepath.Join("SUB", "?.BIN"), Record: dataStart + 2*4096, Deleted: true, Size: 100, Extents: []disk.Extent{{Offset: dataStart + 6*4096, Length: 100}}},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("Expected %+v, got %+v", want, files)
+	}
+}
@@ -0,0 +1,123 @@
+package fat32
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// attributeNames are the names of the bits of a directory entry's
+// attributes, from the lowest
+var attributeNames = [...]string{"read-only", "hidden", "system", "volume label", "directory", "archive"}
+
+// errFound stops the walk of Inspect at the entry it looks for
+var errFound = errors.New("found")
+
+// Inspect decodes the directory entry of a file Files listed, found again
+// by its path, state, size and first cluster
+func (p *Parser) Inspect(e disk.FileEntry) (disk.Record, error) {
+	if p.fatTable == nil {
+		if err := p.loadFAT(); err != nil {
+			return disk.Record{}, err
+		}
+	}
+	var found *RecoveredFile
+	err := p.scanDirectory(p.bootSector.RootCluster, "", func(file RecoveredFile) error {
+		if file.Path != e.Path || file.IsDeleted != e.Deleted || file.IsDirectory != e.Dir || int64(file.Size) != e.Size {
+			return nil
+		}
+		if len(e.Extents) > 0 && e.Extents[0].Offset != p.clusterToOffset(file.FirstCluster) {
+			return nil
+		}
+		found = &file
+		return errFound
+	}, make(map[uint32]bool))
+	if err != nil && err != errFound {
+		return disk.Record{}, err
+	}
+	if found == nil {
+		return disk.Record{}, fmt.Errorf("no directory entry of %s found", e.Path)
+	}
+	return p.InspectEntry(*found)
+}
+
+// InspectEntry decodes the directory entry of a file a walk found: its
+// fields, and the clusters its data is read from
+func (p *Parser) InspectEntry(file RecoveredFile) (disk.Record, error) {
+	entry := make([]byte, DirEntrySize)
+	if _, err := p.reader.ReadAt(entry, file.Entry); err != nil {
+		return disk.Record{}, err
+	}
+	le := binary.LittleEndian
+	r := disk.Record{Kind: "directory entry", Offset: file.Entry, Raw: entry}
+	add := func(offset int, name, format string, args ...any) {
+		r.Fields = append(r.Fields, disk.Field{Offset: offset, Name: name, Value: fmt.Sprintf(format, args...)})
+	}
+
+	name := fmt.Sprintf("%q", entry[0:11])
+	if entry[0] == DeletedMarker {
+		name += " (0xE5: deleted)"
+	}
+	add(0x00, "Short name", "%s", name)
+	if file.LongName != "" {
+		add(-1, "Long name", "%s", file.LongName)
+	}
+	add(0x0B, "Attributes", "0x%02x (%s)", entry[11], entryAttributes(entry[11]))
+	add(0x0D, "Created, 10 ms", "%d", entry[13])
+	add(0x0E, "Created", "%s", dosTimestamp(dosTime(le.Uint16(entry[16:]), le.Uint16(entry[14:]), entry[13])))
+	add(0x12, "Accessed", "%s", dosTimestamp(dosTime(le.Uint16(entry[18:]), 0, 0)))
+	add(0x14, "First cluster, high", "0x%04x", le.Uint16(entry[20:]))
+	add(0x16, "Modified", "%s", dosTimestamp(dosTime(le.Uint16(entry[24:]), le.Uint16(entry[22:]), 0)))
+	add(0x1A, "First cluster, low", "0x%04x", le.Uint16(entry[26:]))
+	add(0x1C, "Size", "%d", le.Uint32(entry[28:]))
+	add(-1, "First cluster", "%d", file.FirstCluster)
+
+	// Where RecoverFile reads the data from
+	extents := p.FileExtents(file)
+	how := "assumed to follow the first, as the chain was cleared"
+	if !file.IsDeleted {
+		extents, how = p.chainExtents(file.FirstCluster), "along the chain in the FAT"
+	}
+	if file.IsDirectory || len(extents) == 0 {
+		return r, nil
+	}
+	var runs []string
+	for _, ext := range extents {
+		first := (ext.Offset-p.dataStart)/int64(p.clusterSz) + 2
+		last := first + ext.Length/int64(p.clusterSz) - 1
+		if last > first {
+			runs = append(runs, fmt.Sprintf("%d-%d", first, last))
+		} else {
+			runs = append(runs, fmt.Sprint(first))
+		}
+	}
+	add(-1, "Clusters", "%s, %s", strings.Join(runs, ", "), how)
+	return r, nil
+}
+
+// entryAttributes names the attributes set of a directory entry
+func entryAttributes(attr byte) string {
+	var names []string
+	for bit, name := range attributeNames {
+		if attr&(1<<bit) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// dosTimestamp formats a time of a directory entry, which FAT keeps in the
+// local time of the machine that wrote it
+func dosTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return "not set"
+	}
+	return t.Format("2006-01-02 15:04:05.00") + " (local time)"
+}
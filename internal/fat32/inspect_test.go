@@ -0,0 +1,71 @@
+package fat32
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/internal/disk/disktest"
+)
+
+func TestInspect(t *testing.T) {
+	// A.TXT in clusters 3, 4 and 7, and SUB in 5 holding a deleted B.BIN
+	// of 5000 bytes from cluster 9
+	dataStart := int64(34 * 512)
+	fat := []uint32{0x0FFFFFF8, 0x0FFFFFFF, 0x0FFFFFFF, 4, 7, 0x0FFFFFFF, 0, 0x0FFFFFFF}
+	parser := newVolume(t, fat, func(cluster func(int) []byte) {
+		root := cluster(2)
+		a := disktest.DirEntry("A       TXT", 0x20, 3, 10000)
+		a[16], a[17] = 0x61, 0x58 // 2024-03-01
+		copy(root[0:], a)
+		copy(root[32:], disktest.DirEntry("SUB        ", AttrDirectory, 5, 0))
+		copy(cluster(5), disktest.DirEntry("\xE5       BIN", 0, 9, 5000))
+	})
+	files, err := parser.Files()
+	if err != nil {
+		t.Fatalf("Files failed: %v", err)
+	}
+
+	for _, tt := range []struct {
+		file   disk.FileEntry
+		offset int64
+		fields map[string]string
+	}{
+		{files[0], dataStart, map[string]string{
+			"Short name": `"A       TXT"`,
+			"Attributes": "0x20 (archive)",
+			"Created":    "2024-03-01 00:00:00.00 (local time)",
+			"Modified":   "not set",
+			"Size":       "10000",
+			"Clusters":   "3-4, 7, along the chain in the FAT",
+		}},
+		{files[2], dataStart + 3*4096, map[string]string{
+			"Short name":    `"\xe5       BIN" (0xE5: deleted)`,
+			"Attributes":    "0x00 (none)",
+			"First cluster": "9",
+			"Clusters":      "9-10, assumed to follow the first, as the chain was cleared",
+		}},
+	} {
+		r, err := parser.Inspect(tt.file)
+		if err != nil {
+			t.Fatalf("Inspect(%s) failed: %v", tt.file.Path, err)
+		}
+		if r.Kind != "directory entry" || r.Offset != tt.offset || len(r.Raw) != DirEntrySize {
+			t.Errorf("%s: unexpected record %q at %d of %d bytes", tt.file.Path, r.Kind, r.Offset, len(r.Raw))
+		}
+		got := make(map[string]string)
+		for _, f := range r.Fields {
+			got[f.Name] = f.Value
+		}
+		for name, want := range tt.fields {
+			if got[name] != want {
+				t.Errorf("%s: expected %s %q, got %q", tt.file.Path, name, want, got[name])
+			}
+		}
+	}
+
+	missing := disk.FileEntry{Path: filepath.Join("SUB", "C.BIN")}
+	if _, err := parser.Inspect(missing); err == nil {
+		t.Error("Expected an error for a file with no directory entry")
+	}
+}
@@ -0,0 +1,39 @@
+package fat32
+
+import "github.com/shubham/recovery/internal/disk"
+
+// Slack returns the slack of each file in use: the rest of the cluster that
+// holds the end of its data, found by following its cluster chain
+func (p *Parser) Slack() ([]disk.Slack, error) {
+	if p.clusterSz == 0 {
+		return nil, &disk.BootSectorError{Filesystem: "FAT32", Details: "invalid cluster size"}
+	}
+	if err := p.loadFAT(); err != nil {
+		return nil, err
+	}
+
+	var slack []disk.Slack
+	clusterSz := uint32(p.clusterSz)
+	err := p.scanDirectory(p.bootSector.RootCluster, "", func(file RecoveredFile) error {
+		if file.IsDeleted || file.IsDirectory || file.Size%clusterSz == 0 || file.FirstCluster < 2 {
+			return nil
+		}
+		cluster := file.FirstCluster
+		for i := file.Size / clusterSz; i > 0; i-- {
+			if int(cluster) >= len(p.fatTable) {
+				return nil
+			}
+			cluster = p.fatTable[cluster] & 0x0FFFFFFF
+			if cluster < 2 || cluster >= ClusterEndMarker {
+				return nil // The chain ends before the data does
+			}
+		}
+		tail := file.Size % clusterSz
+		slack = append(slack, disk.Slack{
+			Path:   file.Path,
+			Extent: disk.Extent{Offset: p.clusterToOffset(cluster) + int64(tail), Length: int64(clusterSz - tail)},
+		})
+		return nil
+	}, make(map[uint32]bool))
+	return slack, err
+}
@@ -0,0 +1,61 @@
+package fat32
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/internal/disk/disktest"
+)
+
+// newVolume writes a volume of 16 clusters, as disktest builds them, with
+// the given FAT entries, lets build fill in its clusters and returns a
+// parser for it
+func newVolume(t *testing.T, entries []uint32, build func(cluster func(int) []byte)) *Parser {
+	t.Helper()
+	data := disktest.FAT32(16)
+	for i, v := range entries {
+		disktest.SetFAT(data, i, v)
+	}
+	build(func(c int) []byte { return disktest.Cluster(data, c) })
+
+	reader, err := disk.Open(disktest.Write(t, "fat32.img", data))
+	if err != nil {
+		t.Fatalf("Failed to open image: %v", err)
+	}
+	t.Cleanup(func() { reader.Close() })
+
+	parser, err := NewParser(reader)
+	if err != nil {
+		t.Fatalf("NewParser failed: %v", err)
+	}
+	return parser
+}
+
+func TestSlack(t *testing.T) {
+	// Root directory in cluster 2, A.TXT in clusters 3-4, SUB in 5 holding
+	// B.BIN in 6, and FULL.BIN filling clusters 7-8 exactly
+	dataStart := 34 * 512
+	fat := []uint32{0x0FFFFFF8, 0x0FFFFFFF, 0x0FFFFFFF, 4, 0x0FFFFFFF, 0x0FFFFFFF, 0x0FFFFFFF, 8, 0x0FFFFFFF}
+	parser := newVolume(t, fat, func(cluster func(int) []byte) {
+		root := cluster(2)
+		copy(root[0:], disktest.DirEntry("A       TXT", 0, 3, 5000))
+		copy(root[32:], disktest.DirEntry("SUB        ", AttrDirectory, 5, 0))
+		copy(root[64:], disktest.DirEntry("FULL    BIN", 0, 7, 8192))
+		copy(root[96:], disktest.DirEntry("\xE5OLD    TXT", 0, 9, 10)) // Deleted
+		copy(cluster(5), disktest.DirEntry("B       BIN", 0, 6, 100))
+	})
+	slack, err := parser.Slack()
+	if err != nil {
+		t.Fatalf("Slack failed: %v", err)
+	}
+
+	want := []disk.Slack{
+		{Path: "A.TXT", Extent: disk.Extent{Offset: int64(dataStart + 2*4096 + 904), Length: 4096 - 904}},
+		{Path: filepath.Join("SUB", "B.BIN"), Extent: disk.Extent{Offset: int64(dataStart + 4*4096 + 100), Length: 4096 - 100}},
+	}
+	if !reflect.DeepEqual(slack, want) {
+		t.Errorf("Expected %+v, got %+v", want, slack)
+	}
+}
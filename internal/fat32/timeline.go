@@ -0,0 +1,58 @@
+package fat32
+
+import (
+	"time"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// Timeline returns an entry for each file and directory with the times in
+// its directory entry, and one for each file in the recycle bin with when
+// it was deleted. FAT keeps local times without a zone, so they are
+// reported as if they were UTC; FAT has no change time.
+func (p *Parser) Timeline() ([]disk.TimelineEntry, error) {
+	if p.clusterSz == 0 {
+		return nil, &disk.BootSectorError{Filesystem: "FAT32", Details: "invalid cluster size"}
+	}
+	if err := p.loadFAT(); err != nil {
+		return nil, err
+	}
+
+	var entries []disk.TimelineEntry
+	err := p.scanDirectory(p.bootSector.RootCluster, "", func(file RecoveredFile) error {
+		name := file.Path
+		if file.IsDeleted {
+			name += " (deleted)"
+		}
+		entries = append(entries, disk.TimelineEntry{
+			Path:     name,
+			Dir:      file.IsDirectory,
+			Size:     int64(file.Size),
+			Accessed: unixTime(file.Accessed),
+			Modified: unixTime(file.Modified),
+			Created:  unixTime(file.Created),
+		})
+
+		// $I files are a few hundred bytes, in their first cluster
+		if file.IsDeleted || file.IsDirectory || file.FirstCluster < 2 || !disk.IsRecycleBinInfo(file.Path) {
+			return nil
+		}
+		data, err := p.readCluster(file.FirstCluster)
+		if err != nil {
+			return nil
+		}
+		if e, ok := disk.RecycleBinEntry(file.Path, data[:min(int(file.Size), len(data))]); ok {
+			entries = append(entries, e)
+		}
+		return nil
+	}, make(map[uint32]bool))
+	return entries, err
+}
+
+// unixTime returns t in Unix seconds, or 0 for the zero time
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
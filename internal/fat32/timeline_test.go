@@ -0,0 +1,60 @@
+package fat32
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/internal/disk/disktest"
+)
+
+func TestTimeline(t *testing.T) {
+	le := binary.LittleEndian
+	// 2021-06-14 10:22:04.5 and 2021-07-01 08:00:00
+	date := func(y, m, d int) uint16 { return uint16((y-1980)<<9 | m<<5 | d) }
+	created, modified := time.Date(2021, 6, 14, 10, 22, 4, 0, time.UTC), time.Date(2021, 7, 1, 8, 0, 0, 0, time.UTC)
+	deleted := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// A deleted REPORT.DOC with its times, and $RECYCLE.BIN in cluster 3
+	// holding a $I file in cluster 4
+	fat := []uint32{0x0FFFFFF8, 0x0FFFFFFF, 0x0FFFFFFF, 0x0FFFFFFF, 0x0FFFFFFF}
+	parser := newVolume(t, fat, func(cluster func(int) []byte) {
+		root := cluster(2)
+		report := disktest.DirEntry("\xE5EPORT  DOC", 0, 9, 20480)
+		report[13] = 50
+		le.PutUint16(report[14:], 10<<11|22<<5|2)
+		le.PutUint16(report[16:], date(2021, 6, 14))
+		le.PutUint16(report[18:], date(2021, 7, 1))
+		le.PutUint16(report[22:], 8<<11)
+		le.PutUint16(report[24:], date(2021, 7, 1))
+		copy(root[0:], report)
+		copy(root[32:], disktest.DirEntry("$RECYCLEBIN", AttrDirectory, 3, 0))
+		copy(cluster(3), disktest.DirEntry("$IAB12CDTXT", 0, 4, 44))
+
+		info := cluster(4)
+		le.PutUint64(info[0:], 2)
+		le.PutUint64(info[8:], 20480)
+		le.PutUint64(info[16:], uint64(deleted.Unix()+11644473600)*10000000)
+		le.PutUint32(info[24:], 8)
+		for i, c := range `C:\a.txt` {
+			le.PutUint16(info[28+2*i:], uint16(c))
+		}
+	})
+
+	entries, err := parser.Timeline()
+	if err != nil {
+		t.Fatalf("Timeline failed: %v", err)
+	}
+	want := []disk.TimelineEntry{
+		{Path: "?EPORT.DOC (deleted)", Size: 20480, Accessed: time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC).Unix(), Modified: modified.Unix(), Created: created.Unix()},
+		{Path: "$RECYCLE.BIN", Dir: true},
+		{Path: filepath.Join("$RECYCLE.BIN", "$IAB12CD.TXT"), Size: 44},
+		{Path: filepath.Join("$RECYCLE.BIN", "$RAB12CD.TXT") + ` (deleted from C:\a.txt)`, Size: 20480, Changed: deleted.Unix()},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("Expected %+v, got %+v", want, entries)
+	}
+}
@@ -0,0 +1,125 @@
+//go:build linux || darwin || freebsd
+
+package mount
+
+import (
+	"context"
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"github.com/shubham/recovery/pkg/recovery"
+)
+
+// Mount mounts the tree of files of src on dir, an empty directory, read
+// only, and serves it until it is unmounted
+func Mount(src *recovery.Source, root *Node, dir string) (*Server, error) {
+	var ino uint64
+	var build func(ctx context.Context, parent *fs.Inode, n *Node)
+	build = func(ctx context.Context, parent *fs.Inode, n *Node) {
+		for _, c := range n.Children {
+			ino++
+			if c.Dir() {
+				child := parent.NewPersistentInode(ctx, &dirNode{node: c}, fs.StableAttr{Mode: syscall.S_IFDIR, Ino: ino})
+				parent.AddChild(c.Name, child, false)
+				build(ctx, child, c)
+				continue
+			}
+			f := &fileNode{src: src, file: *c.File}
+			parent.AddChild(c.Name, parent.NewPersistentInode(ctx, f, fs.StableAttr{Mode: syscall.S_IFREG, Ino: ino}), false)
+		}
+	}
+	top := &dirNode{node: root}
+	server, err := fs.Mount(dir, top, &fs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName:  src.Path(),
+			Name:    "recover",
+			Options: []string{"ro"},
+			// As root, which reading a device takes, no fusermount is
+			// needed
+			DirectMount: true,
+		},
+		OnAdd: func(ctx context.Context) { build(ctx, &top.Inode, root) },
+		UID:   uint32(os.Getuid()),
+		GID:   uint32(os.Getgid()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Server{wait: server.Wait, unmount: server.Unmount}, nil
+}
+
+// dirNode is a directory of the tree
+type dirNode struct {
+	fs.Inode
+	node *Node
+}
+
+var _ = (fs.NodeGetattrer)((*dirNode)(nil))
+
+func (d *dirNode) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Mode = syscall.S_IFDIR | 0555
+	if d.node.File != nil {
+		setTimes(&out.Attr, d.node.File)
+	}
+	return fs.OK
+}
+
+// fileNode is a file of the tree, whose data is read from the source as it
+// is read
+type fileNode struct {
+	fs.Inode
+	src  *recovery.Source
+	file recovery.File
+}
+
+var (
+	_ = (fs.NodeGetattrer)((*fileNode)(nil))
+	_ = (fs.NodeOpener)((*fileNode)(nil))
+	_ = (fs.NodeReader)((*fileNode)(nil))
+	_ = (fs.NodeReleaser)((*fileNode)(nil))
+)
+
+func (f *fileNode) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Mode = syscall.S_IFREG | 0444
+	out.Size = uint64(f.file.Size)
+	out.Blocks = (out.Size + 511) / 512
+	setTimes(&out.Attr, &f.file)
+	return fs.OK
+}
+
+func (f *fileNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR|syscall.O_TRUNC|syscall.O_APPEND) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	// The data does not change, so the kernel may keep it between opens
+	return openFile(f.src, f.file), fuse.FOPEN_KEEP_CACHE, fs.OK
+}
+
+func (f *fileNode) Read(ctx context.Context, fh fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	n, err := fh.(fileReader).ReadAt(dest, off)
+	if err != nil && err != io.EOF {
+		return nil, syscall.EIO
+	}
+	return fuse.ReadResultData(dest[:n]), fs.OK
+}
+
+func (f *fileNode) Release(ctx context.Context, fh fs.FileHandle) syscall.Errno {
+	fh.(fileReader).Close()
+	return fs.OK
+}
+
+func setTimes(a *fuse.Attr, f *recovery.File) {
+	if !f.Modified.IsZero() {
+		a.SetTimes(nil, &f.Modified, nil)
+	}
+	if !f.Accessed.IsZero() {
+		a.SetTimes(&f.Accessed, nil, nil)
+	}
+	if !f.Changed.IsZero() {
+		a.SetTimes(nil, nil, &f.Changed)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package mount
+
+import "github.com/shubham/recovery/pkg/recovery"
+
+// Mount returns ErrUnsupported: this system has no FUSE support here
+func Mount(src *recovery.Source, root *Node, dir string) (*Server, error) {
+	return nil, ErrUnsupported
+}
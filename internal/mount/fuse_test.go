@@ -0,0 +1,51 @@
+//go:build linux
+
+package mount
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk/disktest"
+	"github.com/shubham/recovery/pkg/recovery"
+)
+
+// TestMount mounts a FAT32 image with a deleted file, where FUSE can be
+// mounted without fusermount
+func TestMount(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("mounting without fusermount needs root")
+	}
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		t.Skip("no /dev/fuse")
+	}
+	notes := bytes.Repeat([]byte("meeting notes "), 1000)
+	data := disktest.Deleted(notes)
+
+	src := recovery.NewSource(bytes.NewReader(data), int64(len(data)), "usb.img")
+	files, err := src.Scan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	server, err := Mount(src, Tree(files, false), dir)
+	if err != nil {
+		t.Skipf("FUSE cannot be mounted here: %v", err)
+	}
+	defer server.Unmount()
+
+	got, err := os.ReadFile(filepath.Join(dir, "_OTES.TXT"))
+	if err != nil || !bytes.Equal(got, notes) {
+		t.Errorf("Expected the deleted notes, got %d bytes (%v)", len(got), err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new.txt"), nil, 0644); err == nil {
+		t.Error("Expected the filesystem to be read-only")
+	}
+	if err := server.Unmount(); err != nil {
+		t.Fatal(err)
+	}
+	server.Wait()
+}
@@ -0,0 +1,257 @@
+// Package mount presents the files a scan of a source lists, deleted ones
+// included, as a read-only filesystem, for "recover mount": a file manager,
+// cp or rsync can then browse them and copy out only what is wanted. The
+// data of a file is read from the source when it is read, as a recovery
+// would write it, so nothing is written anywhere until it is copied.
+//
+// Files are at their paths in their volumes, below the name of the volume
+// when the source is partitioned, with names made safe as a recovery
+// makes them (see disk.SafePath). A deleted file whose name a live one, or
+// another deleted one, has taken in the same directory gets a number:
+// "report (2).docx".
+package mount
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/shubham/recovery/internal/disk"
+	"github.com/shubham/recovery/pkg/recovery"
+)
+
+// ErrUnsupported is the error of Mount on a system without FUSE support
+// in this build, such as Windows
+var ErrUnsupported = errors.New("mounting is not supported on this system")
+
+// Node is a file or directory of the filesystem
+type Node struct {
+	Name     string
+	File     *recovery.File // nil for a directory the scan did not list, such as that of a volume
+	Children []*Node        // Of a directory, by name
+
+	byName map[string]*Node // Children by their names without case
+	dirs   map[string]*Node // Children that are directories, by the names they were asked for without case
+}
+
+// Dir reports whether the node is a directory
+func (n *Node) Dir() bool {
+	return n.File == nil || n.File.Dir
+}
+
+// child returns the child of a directory named name, without case
+func (n *Node) child(name string) *Node {
+	return n.byName[strings.ToLower(name)]
+}
+
+// add adds a child named name, or the first of "name (2).ext",
+// "name (3).ext", ... that is free, and returns it
+func (n *Node) add(name string, f *recovery.File) *Node {
+	if n.byName == nil {
+		n.byName = make(map[string]*Node)
+	}
+	unique := name
+	ext := filepath.Ext(name)
+	if ext == name {
+		ext = ""
+	}
+	for i := 2; n.child(unique) != nil; i++ {
+		unique = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	c := &Node{Name: unique, File: f}
+	n.byName[strings.ToLower(unique)] = c
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// subdir returns the directory named name in a directory, adding it when
+// there is none. One that a file has taken the name of is added with a
+// number, and found again by name.
+func (n *Node) subdir(name string) *Node {
+	key := strings.ToLower(name)
+	if d := n.dirs[key]; d != nil {
+		return d
+	}
+	d := n.child(name)
+	if d == nil || !d.Dir() {
+		d = n.add(name, nil)
+	}
+	if n.dirs == nil {
+		n.dirs = make(map[string]*Node)
+	}
+	n.dirs[key] = d
+	return d
+}
+
+// Tree arranges files a scan listed into directories, and returns the
+// root. With deletedOnly, only deleted files are kept, with the
+// directories that lead to them.
+func Tree(files []recovery.File, deletedOnly bool) *Node {
+	root := &Node{}
+	for i := range files {
+		f := &files[i]
+		if deletedOnly && !f.Deleted {
+			continue
+		}
+		names := strings.Split(disk.SafePath(filepath.Join(f.Volume, filepath.FromSlash(f.Path))), string(filepath.Separator))
+		dir := root
+		for _, name := range names[:len(names)-1] {
+			dir = dir.subdir(name)
+		}
+		name := names[len(names)-1]
+		if !f.Dir {
+			dir.add(name, f)
+			continue
+		}
+		// A directory listed twice, live and deleted, or after a file in
+		// it, holds the files of both
+		if d := dir.subdir(name); d.File == nil {
+			d.File = f
+		}
+	}
+	sortTree(root)
+	return root
+}
+
+func sortTree(n *Node) {
+	sort.Slice(n.Children, func(i, j int) bool { return n.Children[i].Name < n.Children[j].Name })
+	for _, c := range n.Children {
+		sortTree(c)
+	}
+}
+
+// fileReader reads a file of the tree at any offset, until it is closed
+type fileReader interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// openFile returns a reader of the data of a file the last scan of src
+// listed. When its extents hold all of it, as they do but for a file kept
+// in its MFT record or one with sparse holes, it is read from the source
+// where they put each offset; otherwise it is read in order through Open.
+func openFile(src *recovery.Source, f recovery.File) fileReader {
+	var total int64
+	for _, e := range f.Extents {
+		total += e.Length
+	}
+	if len(f.Extents) > 0 && total == f.Size {
+		return extentReader{src: src, extents: f.Extents}
+	}
+	return newReader(func() (io.Reader, error) { return src.Open(f) })
+}
+
+// extentReader reads a file from the source at its extents, which hold it
+// in order
+type extentReader struct {
+	src     io.ReaderAt
+	extents []recovery.Extent
+}
+
+func (r extentReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for _, e := range r.extents {
+		if n == len(p) {
+			break
+		}
+		if off >= e.Length {
+			off -= e.Length
+			continue
+		}
+		want := int(min(int64(len(p)-n), e.Length-off))
+		m, err := r.src.ReadAt(p[n:n+want], e.Offset+off)
+		n += m
+		if err != nil && (err != io.EOF || m < want) {
+			return n, err
+		}
+		off = 0
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (extentReader) Close() error {
+	return nil
+}
+
+// reader reads a file at the offsets asked for from the reader of its
+// data Open gives, which reads it in order: a read goes on from where the
+// last one ended, skipping ahead if it must, and a read further back opens
+// the file again. Copying a file reads it once.
+type reader struct {
+	open func() (io.Reader, error)
+
+	mu  sync.Mutex
+	r   io.Reader
+	pos int64
+}
+
+func newReader(open func() (io.Reader, error)) *reader {
+	return &reader{open: open}
+}
+
+func (r *reader) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.r == nil || off < r.pos {
+		r.close()
+		data, err := r.open()
+		if err != nil {
+			return 0, err
+		}
+		r.r, r.pos = data, 0
+	}
+	if off > r.pos {
+		n, err := io.CopyN(io.Discard, r.r, off-r.pos)
+		r.pos += n
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := io.ReadFull(r.r, p)
+	r.pos += int64(n)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Close closes the reader Open gave, when it is one that closes
+func (r *reader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.close()
+}
+
+func (r *reader) close() error {
+	c, ok := r.r.(io.Closer)
+	r.r = nil
+	if !ok {
+		return nil
+	}
+	return c.Close()
+}
+
+// Server serves a mounted filesystem until it is unmounted
+type Server struct {
+	wait    func()
+	unmount func() error
+}
+
+// Wait waits until the filesystem is unmounted, by Unmount or by the
+// system's umount or fusermount -u
+func (s *Server) Wait() {
+	s.wait()
+}
+
+// Unmount unmounts the filesystem; it fails while a program has a file or
+// directory of it open
+func (s *Server) Unmount() error {
+	return s.unmount()
+}
@@ -0,0 +1,196 @@
+package mount
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk/disktest"
+	"github.com/shubham/recovery/pkg/recovery"
+)
+
+// names lists the paths of a tree, directories with a / after them
+func names(n *Node, prefix string) []string {
+	var out []string
+	for _, c := range n.Children {
+		path := prefix + c.Name
+		if c.Dir() {
+			out = append(out, path+"/")
+			out = append(out, names(c, path+"/")...)
+		} else {
+			out = append(out, path)
+		}
+	}
+	return out
+}
+
+func TestTree(t *testing.T) {
+	files := []recovery.File{
+		{Path: "Docs", Dir: true},
+		{Path: "Docs/report.docx"},
+		{Path: "Docs/report.docx", Deleted: true},
+		{Path: "Docs/Report.docx", Deleted: true},
+		{Path: "Old", Dir: true, Deleted: true},
+		{Path: "Old/?OTES.TXT", Deleted: true},
+		{Path: "a:b.txt"},
+		{Path: "Photos/x.jpg", Volume: "partition2", Deleted: true},
+	}
+	want := []string{
+		"Docs/", "Docs/Report (3).docx", "Docs/report (2).docx", "Docs/report.docx",
+		"Old/", "Old/_OTES.TXT", "a_b.txt",
+		"partition2/", "partition2/Photos/", "partition2/Photos/x.jpg",
+	}
+	got := names(Tree(files, false), "")
+	for i := range got {
+		got[i] = filepath.ToSlash(got[i])
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	root := Tree(files, true)
+	want = []string{"Docs/", "Docs/Report (2).docx", "Docs/report.docx", "Old/", "Old/_OTES.TXT", "partition2/", "partition2/Photos/", "partition2/Photos/x.jpg"}
+	if got := names(root, ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected only the deleted files %q, got %q", want, got)
+	}
+	if root.Children[0].File != nil || root.Children[1].File == nil || root.Children[1].File.Path != "Old" {
+		t.Errorf("Expected only the deleted directory to keep its file, got %+v", root.Children[:2])
+	}
+
+	// A file taking the name of a directory leaves the directory a number
+	files = []recovery.File{{Path: "a"}, {Path: "a/b"}, {Path: "a/c"}}
+	if got, want := names(Tree(files, false), ""), []string{"a", "a (2)/", "a (2)/b", "a (2)/c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestReader(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	opens := 0
+	r := newReader(func() (io.Reader, error) {
+		opens++
+		return bytes.NewReader(data), nil
+	})
+	buf := make([]byte, 5)
+	for _, read := range []struct {
+		off  int64
+		want string
+		err  error
+	}{
+		{0, "01234", nil},
+		{5, "56789", nil},
+		{15, "fghij", nil},
+		{2, "23456", nil},
+		{18, "ij", io.EOF},
+	} {
+		n, err := r.ReadAt(buf, read.off)
+		if string(buf[:n]) != read.want || err != read.err {
+			t.Errorf("Read at %d: expected %q (%v), got %q (%v)", read.off, read.want, read.err, buf[:n], err)
+		}
+	}
+	if opens != 2 {
+		t.Errorf("Expected the file opened again only to go back, got %d opens", opens)
+	}
+
+	// A reader that closes is closed when it is dropped, and by Close
+	var closed []*closer
+	r = newReader(func() (io.Reader, error) {
+		c := &closer{Reader: bytes.NewReader(data)}
+		closed = append(closed, c)
+		return c, nil
+	})
+	r.ReadAt(buf, 10)
+	r.ReadAt(buf, 0)
+	if len(closed) != 2 || !closed[0].closed || closed[1].closed {
+		t.Errorf("Expected the first reader closed on going back, got %+v", closed)
+	}
+	if err := r.Close(); err != nil || !closed[1].closed {
+		t.Errorf("Expected Close to close the second reader, got %v", err)
+	}
+
+	failed := errors.New("bad sector")
+	r = newReader(func() (io.Reader, error) { return nil, failed })
+	if _, err := r.ReadAt(buf, 0); err != failed {
+		t.Errorf("Expected the error of opening, got %v", err)
+	}
+}
+
+// closer is a reader that records being closed
+type closer struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closer) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestExtentReader(t *testing.T) {
+	// The file is "abcdefghij", in three extents out of order
+	source := bytes.NewReader([]byte("..hij..abcd..efg.."))
+	r := extentReader{src: source, extents: []recovery.Extent{{Offset: 7, Length: 4}, {Offset: 13, Length: 3}, {Offset: 2, Length: 3}}}
+	buf := make([]byte, 4)
+	for _, read := range []struct {
+		off  int64
+		want string
+		err  error
+	}{
+		{0, "abcd", nil},
+		{3, "defg", nil},
+		{6, "ghij", nil},
+		{1, "bcde", nil},
+		{8, "ij", io.EOF},
+		{10, "", io.EOF},
+	} {
+		n, err := r.ReadAt(buf, read.off)
+		if string(buf[:n]) != read.want || err != read.err {
+			t.Errorf("Read at %d: expected %q (%v), got %q (%v)", read.off, read.want, read.err, buf[:n], err)
+		}
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	data := disktest.Deleted(disktest.Notes)
+	src := recovery.NewSource(bytes.NewReader(data), int64(len(data)), "usb.img")
+	src.SetReporter(quiet{})
+	files, err := src.Scan(context.Background())
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected the notes, got %+v (%v)", files, err)
+	}
+
+	// Its extents hold all of it, so it is read from them, in any order
+	r := openFile(src, files[0])
+	if _, ok := r.(extentReader); !ok {
+		t.Fatalf("Expected the notes read at their extents, got %T", r)
+	}
+	got := make([]byte, len(disktest.Notes))
+	for _, off := range []int{1000, 0, 500} {
+		if n, err := r.ReadAt(got[off:], int64(off)); n != len(got)-off || (err != nil && err != io.EOF) {
+			t.Fatalf("Read at %d: got %d bytes (%v)", off, n, err)
+		}
+	}
+	if !bytes.Equal(got, disktest.Notes) {
+		t.Errorf("Expected the notes, got %q", got)
+	}
+
+	// One without extents is read in order
+	if r := openFile(src, recovery.File{Size: 10}); !isReader(r) {
+		t.Errorf("Expected a file without extents read in order, got %T", r)
+	}
+}
+
+func isReader(r fileReader) bool {
+	_, ok := r.(*reader)
+	return ok
+}
+
+// quiet is a ProgressReporter that drops what it is told
+type quiet struct{}
+
+func (quiet) Progress(recovery.Progress) {}
+func (quiet) Message(string)             {}
@@ -0,0 +1,131 @@
+package ntfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// bitmapRecord is the MFT record of $Bitmap, which holds a bit per cluster
+// of the volume, set when the cluster is in use
+const bitmapRecord = 6
+
+// FreeSpace returns the clusters of the volume that $Bitmap marks free, as
+// byte ranges in volume order
+func (p *Parser) FreeSpace() ([]disk.Extent, error) {
+	if p.clusterSize == 0 {
+		return nil, &disk.BootSectorError{Filesystem: "NTFS", Details: "invalid cluster size"}
+	}
+	boot := make([]byte, 512)
+	if _, err := p.reader.ReadAt(boot, 0); err != nil {
+		return nil, fmt.Errorf("failed to read boot sector: %w", err)
+	}
+	clusters := int64(binary.LittleEndian.Uint64(boot[40:48]) / uint64(p.bootSector.SectorsPerCluster))
+	if fit := p.reader.Size() / int64(p.clusterSize); clusters > fit {
+		clusters = fit
+	}
+
+	record, err := p.readMFTRecord(bitmapRecord)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read $Bitmap: %w", err)
+	}
+	file, err := p.parseAttributes(record)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.DataRuns) == 0 || file.Size < uint64(clusters+7)/8 {
+		return nil, fmt.Errorf("$Bitmap does not cover the volume")
+	}
+	bitmap, err := p.readRuns(file.DataRuns, uint64(clusters+7)/8)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read $Bitmap: %w", err)
+	}
+
+	return disk.FreeExtents(clusters, func(c int64) bool {
+		return bitmap[c/8]&(1<<(c%8)) != 0
+	}, 0, int64(p.clusterSize)), nil
+}
+
+// readRuns reads the first size bytes held in a list of data runs
+func (p *Parser) readRuns(runs []DataRun, size uint64) ([]byte, error) {
+	data := make([]byte, 0, size)
+	for _, run := range runs {
+		if uint64(len(data)) >= size {
+			break
+		}
+		buf := make([]byte, min(run.Length*uint64(p.clusterSize), size-uint64(len(data))))
+		if _, err := p.reader.ReadAt(buf, run.Offset*int64(p.clusterSize)); err != nil && err != io.EOF {
+			return nil, err
+		}
+		data = append(data, buf...)
+	}
+	if uint64(len(data)) < size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, nil
+}
+
+// FileExtents returns where a file's data lies on the volume, as byte ranges
+// in file order; sparse runs and clusters past its size are left out
+func (p *Parser) FileExtents(file RecoveredFile) []disk.Extent {
+	var extents []disk.Extent
+	clusterSize := int64(p.clusterSize)
+	left := int64(file.Size)
+	for _, run := range file.DataRuns {
+		if left <= 0 {
+			break
+		}
+		length := int64(run.Length) * clusterSize
+		if length > left {
+			length = left
+		}
+		if run.Offset > 0 {
+			extents = append(extents, disk.Extent{Offset: run.Offset * clusterSize, Length: length})
+		}
+		left -= length
+	}
+	return extents
+}
+
+// Allocations returns where each file and directory outside the system
+// files lies: its MFT record, which holds the data of small files itself,
+// and the clusters of its data runs
+func (p *Parser) Allocations() ([]disk.Allocation, error) {
+	if p.clusterSize == 0 || p.mftRecSize == 0 {
+		return nil, &disk.BootSectorError{Filesystem: "NTFS", Details: "invalid cluster size"}
+	}
+
+	var allocs []disk.Allocation
+	var indexes []uint64
+	records := p.RecordCount()
+	for i := uint64(0); i < records; i++ {
+		record, err := p.readMFTRecord(i)
+		if err != nil {
+			continue
+		}
+		file, err := p.parseAttributes(record)
+		if err != nil || file.Name == "" || file.Name == "." || strings.HasPrefix(file.Name, "$") {
+			continue
+		}
+		file.MFTIndex = i
+		p.mftRecords[i] = file
+
+		extents := []disk.Extent{{Offset: p.mftStart + int64(i)*int64(p.mftRecSize), Length: int64(p.mftRecSize)}}
+		for _, run := range file.DataRuns {
+			if run.Offset > 0 {
+				extents = append(extents, disk.Extent{Offset: run.Offset * int64(p.clusterSize), Length: int64(run.Length) * int64(p.clusterSize)})
+			}
+		}
+		allocs = append(allocs, disk.Allocation{Deleted: file.IsDeleted, Extents: extents})
+		indexes = append(indexes, i)
+	}
+
+	// Paths need every record's parent, so they come last
+	for k, i := range indexes {
+		allocs[k].Path = p.reconstructPath(i)
+	}
+	return allocs, nil
+}
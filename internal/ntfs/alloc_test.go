@@ -0,0 +1,113 @@
+package ntfs
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// createBitmapImage builds a 64-cluster NTFS volume with 4KB clusters whose
+// $Bitmap, at cluster 10, marks the given bytes of clusters in use
+func createBitmapImage(t *testing.T, bitmap []byte) string {
+	le := binary.LittleEndian
+	data := make([]byte, 64*4096)
+	copy(data[3:], "NTFS    ")
+	le.PutUint16(data[11:], 512)
+	data[13] = 8
+	le.PutUint64(data[40:], 64*8) // Total sectors
+	le.PutUint64(data[48:], 4)    // MFT cluster
+	data[64] = 0xF6               // 1KB MFT records
+	data[510], data[511] = 0x55, 0xAA
+
+	// $Bitmap's record, with a non-resident $DATA attribute of one run
+	putRecord(data[4*4096:], bitmapRecord, 0x01, dataAttr(uint64(len(bitmap)), 10, 1))
+	copy(data[10*4096:], bitmap)
+
+	path := filepath.Join(t.TempDir(), "ntfs.img")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to create NTFS image: %v", err)
+	}
+	return path
+}
+
+func TestFreeSpace(t *testing.T) {
+	// Clusters 0-15 and 32-39 in use
+	path := createBitmapImage(t, []byte{0xFF, 0xFF, 0x00, 0x00, 0xFF, 0x00, 0x00, 0x00})
+	reader, err := disk.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open image: %v", err)
+	}
+	defer reader.Close()
+
+	parser, err := NewParser(reader)
+	if err != nil {
+		t.Fatalf("NewParser failed: %v", err)
+	}
+	extents, err := parser.FreeSpace()
+	if err != nil {
+		t.Fatalf("FreeSpace failed: %v", err)
+	}
+
+	want := []disk.Extent{{Offset: 16 * 4096, Length: 16 * 4096}, {Offset: 40 * 4096, Length: 24 * 4096}}
+	if !reflect.DeepEqual(extents, want) {
+		t.Errorf("Expected %v, got %v", want, extents)
+	}
+}
+
+func TestFreeSpaceShortBitmap(t *testing.T) {
+	// Four bytes cannot cover 64 clusters
+	path := createBitmapImage(t, []byte{0xFF, 0xFF, 0x00, 0x00})
+	reader, err := disk.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open image: %v", err)
+	}
+	defer reader.Close()
+
+	parser, err := NewParser(reader)
+	if err != nil {
+		t.Fatalf("NewParser failed: %v", err)
+	}
+	if _, err := parser.FreeSpace(); err == nil {
+		t.Error("Expected an error for a bitmap shorter than the volume")
+	}
+}
+
+func TestFileExtents(t *testing.T) {
+	p := &Parser{clusterSize: 4096}
+	// 10 clusters at 100, 2 sparse ones and 10 at 50, of which the file's
+	// 40000 bytes reach 2 and a bit
+	file := RecoveredFile{Size: 40000, DataRuns: []DataRun{{Offset: 100, Length: 6}, {Offset: 0, Length: 2}, {Offset: 50, Length: 10}}}
+	want := []disk.Extent{{Offset: 100 * 4096, Length: 6 * 4096}, {Offset: 50 * 4096, Length: 40000 - 8*4096}}
+	if got := p.FileExtents(file); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestAllocations(t *testing.T) {
+	// docs/a.bin in clusters 30-31 and a deleted old.txt in cluster 40
+	parser := newVolume(t, func(mft []byte) {
+		putRecord(mft, 0, 0x01, fileNameAttr("$MFT", 5), dataAttr(16*1024, 4, 4))
+		putRecord(mft, 5, 0x03, fileNameAttr(".", 5))
+		putRecord(mft, 11, 0x03, fileNameAttr("docs", 5))
+		putRecord(mft, 12, 0x01, fileNameAttr("a.bin", 11), dataAttr(5000, 30, 2))
+		putRecord(mft, 13, 0x00, fileNameAttr("old.txt", 5), dataAttr(10, 40, 1))
+	})
+	allocs, err := parser.Allocations()
+	if err != nil {
+		t.Fatalf("Allocations failed: %v", err)
+	}
+
+	record := func(i int64) disk.Extent { return disk.Extent{Offset: 4*4096 + i*1024, Length: 1024} }
+	want := []disk.Allocation{
+		{Path: "docs", Extents: []disk.Extent{record(11)}},
+		{Path: filepath.Join("docs", "a.bin"), Extents: []disk.Extent{record(12), {Offset: 30 * 4096, Length: 2 * 4096}}},
+		{Path: "old.txt", Deleted: true, Extents: []disk.Extent{record(13), {Offset: 40 * 4096, Length: 4096}}},
+	}
+	if !reflect.DeepEqual(allocs, want) {
+		t.Errorf("Expected %+v, got %+v", want, allocs)
+	}
+}
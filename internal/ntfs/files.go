@@ -0,0 +1,129 @@
+package ntfs
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func init() {
+	disk.RegisterFilesystem(filesystem{})
+}
+
+// filesystem is NTFS as the registry of filesystems knows it
+type filesystem struct{}
+
+func (filesystem) Name() string {
+	return "ntfs"
+}
+
+func (filesystem) Detect(boot []byte) bool {
+	return len(boot) >= 7 && string(boot[3:7]) == "NTFS"
+}
+
+// Scan lists the files of a volume through Files
+func (filesystem) Scan(volume *disk.Reader) (disk.Volume, []disk.FileEntry, error) {
+	p, err := NewParser(volume)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err := p.Files()
+	return p, files, err
+}
+
+func (filesystem) Recover(volume *disk.Reader, outputDir string, scanOnly bool) (int, error) {
+	return Recover(volume, outputDir, scanOnly, false)
+}
+
+// Files returns every file and directory in the MFT, live or deleted and
+// system files included, with where its data lies and the times in its
+// $STANDARD_INFORMATION
+func (p *Parser) Files() ([]disk.FileEntry, error) {
+	if p.clusterSize == 0 || p.mftRecSize == 0 {
+		return nil, &disk.BootSectorError{Filesystem: "NTFS", Details: "invalid cluster size"}
+	}
+
+	var entries []disk.FileEntry
+	var indexes []uint64
+	records := p.RecordCount()
+	for i := uint64(0); i < records; i++ {
+		if err := p.reader.Err(); err != nil {
+			return nil, err
+		}
+		record, err := p.readMFTRecord(i)
+		if err != nil {
+			continue
+		}
+		file, err := p.parseAttributes(record)
+		if err != nil || file.Name == "" || file.Name == "." {
+			continue
+		}
+		file.MFTIndex = i
+		p.mftRecords[i] = file
+
+		si, _ := attributeTimes(record)
+		e := disk.FileEntry{
+			Inode: i, Record: p.mftStart + int64(i)*int64(p.mftRecSize), Dir: file.IsDirectory, Deleted: file.IsDeleted, Size: int64(file.Size),
+			Created: si[0], Modified: si[1], Changed: si[2], Accessed: si[3],
+		}
+		if !file.IsDirectory {
+			if len(file.DataRuns) > 0 {
+				e.Extents = p.FileExtents(*file)
+			} else {
+				e.Resident = residentData(record)
+			}
+		}
+		entries = append(entries, e)
+		indexes = append(indexes, i)
+	}
+
+	// Paths need every record's parent, so they come last
+	for k, i := range indexes {
+		entries[k].Path = p.reconstructPath(i)
+	}
+	return entries, nil
+}
+
+// RecoverEntry writes a file Files listed to outputPath, with the holes of
+// its sparse runs
+func (p *Parser) RecoverEntry(e disk.FileEntry, outputPath string) (disk.Digest, error) {
+	if file := p.mftRecords[e.Inode]; file != nil && !e.Dir && e.Resident == nil {
+		return p.RecoverFile(*file, outputPath)
+	}
+	return p.reader.WriteEntry(e, outputPath)
+}
+
+// RecoverRecord writes the file of an MFT record to outputPath as
+// RecoverEntry would, reading that record alone, for a file picked from an
+// earlier listing; size is the size it was listed with, which the record
+// must still give
+func (p *Parser) RecoverRecord(index uint64, size int64, outputPath string) (disk.Digest, error) {
+	record, err := p.readMFTRecord(index)
+	if err != nil {
+		return disk.Digest{}, err
+	}
+	file, err := p.parseAttributes(record)
+	if err != nil {
+		return disk.Digest{}, err
+	}
+	if file.IsDirectory || int64(file.Size) != size {
+		return disk.Digest{}, fmt.Errorf("MFT record %d no longer holds the file listed", index)
+	}
+	if len(file.DataRuns) == 0 {
+		return p.reader.WriteEntry(disk.FileEntry{Size: size, Resident: residentData(record)}, outputPath)
+	}
+	return p.RecoverFile(*file, outputPath)
+}
+
+// OpenEntry returns a reader of a file Files listed, as RecoverEntry writes
+// it
+func (p *Parser) OpenEntry(e disk.FileEntry) (io.Reader, error) {
+	if e.Dir {
+		return nil, fmt.Errorf("%s is a directory", e.Path)
+	}
+	if file := p.mftRecords[e.Inode]; file != nil && e.Resident == nil {
+		return p.OpenFile(*file)
+	}
+	return p.reader.OpenEntry(e), nil
+}
@@ -0,0 +1,76 @@
+package ntfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func TestFiles(t *testing.T) {
+	// docs/a.bin in clusters 30-31, a small note held in its record and a
+	// deleted old.txt in cluster 40
+	note := streamAttr("", 5)
+	copy(note[0x28:], "hello")
+	parser := newVolume(t, func(mft []byte) {
+		putRecord(mft, 0, 0x01, fileNameAttr("$MFT", 5), dataAttr(16*1024, 4, 4))
+		putRecord(mft, 5, 0x03, fileNameAttr(".", 5))
+		putRecord(mft, 11, 0x03, fileNameAttr("docs", 5))
+		putRecord(mft, 12, 0x01, standardInfoAttr(1600000000, 1610000000, 1620000000, 1630000000), fileNameAttr("a.bin", 11), dataAttr(5000, 30, 2))
+		putRecord(mft, 13, 0x01, fileNameAttr("note.txt", 11), note)
+		putRecord(mft, 14, 0x00, fileNameAttr("old.txt", 5), dataAttr(10, 40, 1))
+	})
+	files, err := parser.Files()
+	if err != nil {
+		t.Fatalf("Files failed: %v", err)
+	}
+
+	record := func(i int64) int64 { return 4*4096 + i*1024 }
+	want := []disk.FileEntry{
+		{Path: "$MFT", Record: record(0), Size: 16 * 1024, Extents: []disk.Extent{{Offset: 4 * 4096, Length: 16 * 1024}}},
+		{Path: "docs", Inode: 11, Record: record(11), Dir: true},
+		{Path: filepath.Join("docs", "a.bin"), Inode: 12, Record: record(12), Size: 5000, Extents: []disk.Extent{{Offset: 30 * 4096, Length: 5000}},
+			Created: 1600000000, Modified: 1610000000, Changed: 1620000000, Accessed: 1630000000},
+		{Path: filepath.Join("docs", "note.txt"), Inode: 13, Record: record(13), Size: 5, Resident: []byte("hello")},
+		{Path: "old.txt", Inode: 14, Record: record(14), Deleted: true, Size: 10, Extents: []disk.Extent{{Offset: 40 * 4096, Length: 10}}},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("Expected %+v, got %+v", want, files)
+	}
+}
+
+func TestRecoverRecord(t *testing.T) {
+	// A note held in its record and a deleted old.txt in cluster 40
+	note := streamAttr("", 5)
+	copy(note[0x28:], "hello")
+	parser := newVolume(t, func(mft []byte) {
+		putRecord(mft, 5, 0x03, fileNameAttr(".", 5))
+		putRecord(mft, 11, 0x03, fileNameAttr("docs", 5))
+		putRecord(mft, 13, 0x01, fileNameAttr("note.txt", 11), note)
+		putRecord(mft, 14, 0x00, fileNameAttr("old.txt", 5), dataAttr(10, 40, 1))
+		copy(mft[(40-4)*4096:], "0123456789")
+	})
+
+	dir := t.TempDir()
+	for index, want := range map[uint64]string{13: "hello", 14: "0123456789"} {
+		path := filepath.Join(dir, fmt.Sprint(index))
+		digest, err := parser.RecoverRecord(index, int64(len(want)), path)
+		if err != nil || digest.Size != int64(len(want)) {
+			t.Fatalf("RecoverRecord(%d) failed: %v", index, err)
+		}
+		if got, _ := os.ReadFile(path); string(got) != want {
+			t.Errorf("Expected record %d to hold %q, got %q", index, want, got)
+		}
+	}
+
+	// A record that no longer holds the file listed
+	if _, err := parser.RecoverRecord(14, 11, filepath.Join(dir, "x")); err == nil {
+		t.Error("Expected an error for a size the record does not give")
+	}
+	if _, err := parser.RecoverRecord(11, 0, filepath.Join(dir, "docs")); err == nil {
+		t.Error("Expected an error for a directory")
+	}
+}
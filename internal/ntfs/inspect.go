@@ -0,0 +1,171 @@
+package ntfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// attributeNames are the names NTFS gives the types of attribute
+var attributeNames = map[uint32]string{
+	0x10:  "$STANDARD_INFORMATION",
+	0x20:  "$ATTRIBUTE_LIST",
+	0x30:  "$FILE_NAME",
+	0x40:  "$OBJECT_ID",
+	0x50:  "$SECURITY_DESCRIPTOR",
+	0x60:  "$VOLUME_NAME",
+	0x70:  "$VOLUME_INFORMATION",
+	0x80:  "$DATA",
+	0x90:  "$INDEX_ROOT",
+	0xA0:  "$INDEX_ALLOCATION",
+	0xB0:  "$BITMAP",
+	0xC0:  "$REPARSE_POINT",
+	0xD0:  "$EA_INFORMATION",
+	0xE0:  "$EA",
+	0x100: "$LOGGED_UTILITY_STREAM",
+}
+
+// namespaces are the namespaces of a $FILE_NAME
+var namespaces = [...]string{"POSIX", "Win32", "DOS", "Win32 and DOS"}
+
+// Inspect decodes the MFT record of a file Files listed
+func (p *Parser) Inspect(e disk.FileEntry) (disk.Record, error) {
+	return p.InspectRecord(e.Inode)
+}
+
+// InspectRecord decodes an MFT record: its header, the header of each of
+// its attributes, and the fields of $STANDARD_INFORMATION, $FILE_NAME and
+// $DATA, with the runs of a non-resident one
+func (p *Parser) InspectRecord(index uint64) (disk.Record, error) {
+	record, err := p.readMFTRecord(index)
+	if err != nil {
+		return disk.Record{}, err
+	}
+	le := binary.LittleEndian
+	r := disk.Record{
+		Kind:   fmt.Sprintf("MFT record %d", index),
+		Offset: p.mftStart + int64(index)*int64(p.mftRecSize),
+		Raw:    record,
+	}
+	add := func(offset int, name, format string, args ...any) {
+		r.Fields = append(r.Fields, disk.Field{Offset: offset, Name: name, Value: fmt.Sprintf(format, args...)})
+	}
+
+	flags := le.Uint16(record[0x16:])
+	add(0x00, "Signature", "%s", record[0:4])
+	add(0x10, "Sequence number", "%d", le.Uint16(record[0x10:]))
+	add(0x12, "Hard links", "%d", le.Uint16(record[0x12:]))
+	add(0x14, "First attribute", "0x%x", le.Uint16(record[0x14:]))
+	add(0x16, "Flags", "0x%04x (%s)", flags, recordFlags(flags))
+	add(0x18, "Used size", "%d", le.Uint32(record[0x18:]))
+	add(0x1C, "Allocated size", "%d", le.Uint32(record[0x1C:]))
+	add(0x20, "Base record", "%s", fileReference(le.Uint64(record[0x20:])))
+	add(0x28, "Next attribute id", "%d", le.Uint16(record[0x28:]))
+
+	// As attributes walks them, with the offset of each
+	offset := int(le.Uint16(record[0x14:]))
+	for offset+16 < len(record) {
+		typ := le.Uint32(record[offset:])
+		if typ == AttrEnd || typ == 0 {
+			add(offset, "End of attributes", "0x%08x", typ)
+			break
+		}
+		length := int(le.Uint32(record[offset+4:]))
+		if length < 24 || length > len(record)-offset {
+			add(offset, "Attribute", "type 0x%x with a length of %d, past the record; stopped", typ, length)
+			break
+		}
+		attr := record[offset : offset+length]
+		name := attributeNames[typ]
+		if name == "" {
+			name = fmt.Sprintf("type 0x%x", typ)
+		}
+		if n := int(attr[9]); n > 0 {
+			nameOff := int(le.Uint16(attr[10:]))
+			if nameOff+2*n <= len(attr) {
+				name += ":" + decodeUTF16(attr[nameOff:nameOff+2*n])
+			}
+		}
+		residence := "resident"
+		if attr[8] != 0 {
+			residence = "non-resident"
+		}
+		add(offset, "Attribute", "%s, %s, %d bytes, id %d", name, residence, length, le.Uint16(attr[14:]))
+
+		value := residentValue(attr)
+		valueOff := offset + int(le.Uint16(attr[20:]))
+		switch {
+		case typ == AttrStandardInfo && len(value) >= 36:
+			for k, label := range []string{"Created", "Modified", "MFT changed", "Accessed"} {
+				add(valueOff+8*k, "  "+label, "%s", formatFiletime(le.Uint64(value[8*k:])))
+			}
+			add(valueOff+32, "  File attributes", "0x%08x", le.Uint32(value[32:]))
+		case typ == AttrFileName && len(value) >= 66:
+			add(valueOff, "  Parent", "%s", fileReference(le.Uint64(value)))
+			for k, label := range []string{"Created", "Modified", "MFT changed", "Accessed"} {
+				add(valueOff+8+8*k, "  "+label, "%s", formatFiletime(le.Uint64(value[8+8*k:])))
+			}
+			add(valueOff+40, "  Allocated size", "%d", le.Uint64(value[40:]))
+			add(valueOff+48, "  Size", "%d", le.Uint64(value[48:]))
+			add(valueOff+56, "  File attributes", "0x%08x", le.Uint32(value[56:]))
+			namespace := fmt.Sprint(value[65])
+			if int(value[65]) < len(namespaces) {
+				namespace = namespaces[value[65]]
+			}
+			add(valueOff+65, "  Namespace", "%s", namespace)
+			if n := int(value[64]); 66+2*n <= len(value) {
+				add(valueOff+66, "  Name", "%s", decodeUTF16(value[66:66+2*n]))
+			}
+		case typ == AttrData && attr[8] == 0:
+			add(valueOff, "  Size", "%d, held in the record", len(value))
+		case typ == AttrData && len(attr) >= 64:
+			add(offset+0x10, "  Start VCN", "%d", le.Uint64(attr[0x10:]))
+			add(offset+0x18, "  End VCN", "%d", le.Uint64(attr[0x18:]))
+			add(offset+0x28, "  Allocated size", "%d", le.Uint64(attr[0x28:]))
+			add(offset+0x30, "  Size", "%d", le.Uint64(attr[0x30:]))
+			add(offset+0x38, "  Initialized size", "%d", le.Uint64(attr[0x38:]))
+			runs := p.parseDataRuns(attr)
+			add(offset+int(le.Uint16(attr[0x20:])), "  Data runs", "%d", len(runs))
+			for k, run := range runs {
+				if run.Offset == 0 {
+					add(-1, fmt.Sprintf("  Run %d", k+1), "%d clusters, sparse", run.Length)
+				} else {
+					add(-1, fmt.Sprintf("  Run %d", k+1), "%d clusters from cluster %d", run.Length, run.Offset)
+				}
+			}
+		}
+		offset += length
+	}
+	return r, nil
+}
+
+// recordFlags names the flags of an MFT record's header
+func recordFlags(flags uint16) string {
+	var names []string
+	if flags&0x01 != 0 {
+		names = append(names, "in use")
+	} else {
+		names = append(names, "deleted")
+	}
+	if flags&0x02 != 0 {
+		names = append(names, "directory")
+	}
+	return strings.Join(names, ", ")
+}
+
+// fileReference formats a file reference: an MFT record and the sequence
+// number it must have
+func fileReference(ref uint64) string {
+	return fmt.Sprintf("record %d, sequence %d", ref&0x0000FFFFFFFFFFFF, ref>>48)
+}
+
+// formatFiletime formats a FILETIME in UTC
+func formatFiletime(ft uint64) string {
+	if ft == 0 {
+		return "not set"
+	}
+	return time.Unix(disk.FiletimeUnix(ft), int64(ft%10000000)*100).UTC().Format(time.RFC3339Nano)
+}
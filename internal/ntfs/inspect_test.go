@@ -0,0 +1,68 @@
+package ntfs
+
+import (
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+func TestInspectRecord(t *testing.T) {
+	// A deleted old.txt in clusters 40-41, with a stream named ads
+	parser := newVolume(t, func(mft []byte) {
+		putRecord(mft, 14, 0x00, standardInfoAttr(1600000000, 1610000000, 1620000000, 1630000000),
+			fileNameAttr("old.txt", 5), dataAttr(5000, 40, 2), streamAttr("ads", 8))
+	})
+	r, err := parser.Inspect(disk.FileEntry{Inode: 14})
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if r.Kind != "MFT record 14" || r.Offset != 4*4096+14*1024 || len(r.Raw) != 1024 {
+		t.Errorf("Unexpected record %q at %d of %d bytes", r.Kind, r.Offset, len(r.Raw))
+	}
+
+	fields := make(map[string]disk.Field)
+	var attrs []string
+	for _, f := range r.Fields {
+		if f.Name == "Attribute" {
+			attrs = append(attrs, f.Value)
+		}
+		if _, ok := fields[f.Name]; !ok {
+			fields[f.Name] = f
+		}
+	}
+	for name, want := range map[string]string{
+		"Signature":   "FILE",
+		"Flags":       "0x0000 (deleted)",
+		"  Created":   "2020-09-13T12:26:40Z",
+		"  Accessed":  "2021-08-26T17:46:40Z",
+		"  Parent":    "record 5, sequence 0",
+		"  Namespace": "Win32",
+		"  Name":      "old.txt",
+		"  Run 1":     "2 clusters from cluster 40",
+	} {
+		if got := fields[name].Value; got != want {
+			t.Errorf("%s: expected %q, got %q", name, want, got)
+		}
+	}
+	if f := fields["  Name"]; f.Offset != 0x38+96+24+66 {
+		t.Errorf("Expected the name at 0x%x, got 0x%x", 0x38+96+24+66, f.Offset)
+	}
+	want := []string{
+		"$STANDARD_INFORMATION, resident, 96 bytes, id 0",
+		"$FILE_NAME, resident, 104 bytes, id 0",
+		"$DATA, non-resident, 72 bytes, id 0",
+		"$DATA:ads, resident, 48 bytes, id 0",
+	}
+	if len(attrs) != len(want) {
+		t.Fatalf("Expected attributes %q, got %q", want, attrs)
+	}
+	for i := range want {
+		if attrs[i] != want[i] {
+			t.Errorf("Attribute %d: expected %q, got %q", i, want[i], attrs[i])
+		}
+	}
+
+	if _, err := parser.InspectRecord(20); err == nil {
+		t.Error("Expected an error for a record never written")
+	}
+}
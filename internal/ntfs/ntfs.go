@@ -2,6 +2,7 @@ package ntfs
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -119,6 +120,8 @@ type RecoveredFile struct {
 	IsDirectory  bool
 	IsDeleted    bool
 	DataRuns     []DataRun
+	Created      int64 // Unix seconds, from $STANDARD_INFORMATION; 0 = unknown
+	Modified     int64
 }
 
 // DataRun represents a cluster run
@@ -158,7 +161,7 @@ func (p *Parser) readBootSector() error {
 
 	// Verify NTFS signature
 	if string(buf[3:7]) != "NTFS" {
-		return fmt.Errorf("not an NTFS filesystem")
+		return &disk.BootSectorError{Filesystem: "NTFS", Details: "no NTFS signature"}
 	}
 
 	p.bootSector = &BootSector{}
@@ -178,6 +181,12 @@ func (p *Parser) readBootSector() error {
 
 	p.mftStart = int64(p.bootSector.MFTCluster) * int64(p.clusterSize)
 
+	if p.clusterSize == 0 {
+		return &disk.BootSectorError{Filesystem: "NTFS", Details: "invalid cluster size"}
+	}
+	if p.mftRecSize <= 0 || p.mftRecSize > 64*1024 {
+		return &disk.BootSectorError{Filesystem: "NTFS", Details: fmt.Sprintf("invalid MFT record size %d", p.mftRecSize)}
+	}
 	return nil
 }
 
@@ -261,6 +270,10 @@ func (p *Parser) parseAttributes(record []byte) (*RecoveredFile, error) {
 			}
 
 		case AttrData:
+			// Named streams are alternate data streams, not the file's content
+			if record[offset+9] != 0 {
+				break
+			}
 			if nonResident == 1 {
 				file.DataRuns = p.parseDataRuns(record[offset : offset+int(attrLen)])
 				realSize := binary.LittleEndian.Uint64(record[offset+48:])
@@ -378,17 +391,43 @@ func decodeUTF16(b []byte) string {
 
 // ScanDeletedFiles scans MFT for deleted files
 func (p *Parser) ScanDeletedFiles(maxRecords uint64) ([]RecoveredFile, error) {
+	return p.scanFiles(maxRecords, false)
+}
+
+// scanFiles scans MFT for deleted files, and with live for the files and
+// directories in use too
+func (p *Parser) scanFiles(maxRecords uint64, live bool) ([]RecoveredFile, error) {
 	var files []RecoveredFile
+	err := p.walkFiles(maxRecords, live, func(file RecoveredFile) error {
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
 
-	fmt.Printf("Scanning MFT records (this may take a while)...\n")
+// WalkDeletedFiles scans the MFT and calls visit with each deleted file as
+// it is found, with its path, so that a volume of millions of files can be
+// filtered, shown or saved as it is scanned. Only directories are kept to
+// give the paths of the files below them. The scan stops at the first error
+// visit returns, and returns it.
+func (p *Parser) WalkDeletedFiles(maxRecords uint64, visit func(RecoveredFile) error) error {
+	return p.walkFiles(maxRecords, false, visit)
+}
+
+// walkFiles is WalkDeletedFiles, visiting with live the files and
+// directories in use too
+func (p *Parser) walkFiles(maxRecords uint64, live bool, visit func(RecoveredFile) error) error {
+	p.reader.Printf("Scanning MFT records (this may take a while)...\n")
 
+	var found int64
 	for i := uint64(0); i < maxRecords; i++ {
-		record, err := p.readMFTRecord(i)
-		if err != nil {
-			continue
+		if err := p.reader.Err(); err != nil {
+			return err
 		}
-
-		file, err := p.parseAttributes(record)
+		file, err := p.readFile(i)
 		if err != nil {
 			continue
 		}
@@ -402,25 +441,62 @@ func (p *Parser) ScanDeletedFiles(maxRecords uint64) ([]RecoveredFile, error) {
 			continue
 		}
 
-		file.MFTIndex = i
-		p.mftRecords[i] = file
-
-		if file.IsDeleted {
-			files = append(files, *file)
+		if file.IsDirectory {
+			p.mftRecords[i] = file
 		}
 
-		// Progress
-		if i > 0 && i%10000 == 0 {
-			fmt.Printf("  Scanned %d records, found %d deleted files...\n", i, len(files))
+		if file.IsDeleted || live {
+			file.Path = p.filePath(file)
+			if err := visit(*file); err != nil {
+				return err
+			}
+			found++
 		}
+		p.reader.Report(disk.Progress{Phase: "MFT scan", Current: int64(i + 1), Total: int64(maxRecords), Found: found})
 	}
+	return nil
+}
 
-	// Reconstruct paths
-	for i := range files {
-		files[i].Path = p.reconstructPath(files[i].MFTIndex)
+// readFile reads and parses an MFT record
+func (p *Parser) readFile(index uint64) (*RecoveredFile, error) {
+	record, err := p.readMFTRecord(index)
+	if err != nil {
+		return nil, err
+	}
+	file, err := p.parseAttributes(record)
+	if err != nil {
+		return nil, err
 	}
+	file.MFTIndex = index
+	si, _ := attributeTimes(record)
+	file.Created, file.Modified = si[0], si[1]
+	return file, nil
+}
 
-	return files, nil
+// filePath returns the path of a file found while the MFT is scanned,
+// reading the records of the directories above it the scan has not reached
+func (p *Parser) filePath(file *RecoveredFile) string {
+	parent := file.ParentRef
+	for depth := 0; parent != 5 && parent != file.MFTIndex && depth < 256; depth++ {
+		dir, ok := p.mftRecords[parent]
+		if !ok {
+			read, err := p.readFile(parent)
+			if err != nil || !read.IsDirectory || read.Name == "" || strings.HasPrefix(read.Name, "$") {
+				break
+			}
+			p.mftRecords[parent] = read
+			dir = read
+		}
+		if dir.ParentRef == parent {
+			break
+		}
+		parent = dir.ParentRef
+	}
+
+	if _, ok := p.mftRecords[file.ParentRef]; !ok || file.ParentRef == 5 || file.ParentRef == file.MFTIndex {
+		return file.Name
+	}
+	return filepath.Join(p.reconstructPath(file.ParentRef), file.Name)
 }
 
 func (p *Parser) reconstructPath(mftIndex uint64) string {
@@ -461,68 +537,81 @@ func (p *Parser) reconstructPath(mftIndex uint64) string {
 	return filepath.Join(parts...)
 }
 
-// RecoverFile extracts file data
-func (p *Parser) RecoverFile(file RecoveredFile, outputPath string) error {
+// RecoverFile extracts file data, returning the digest of what it wrote
+func (p *Parser) RecoverFile(file RecoveredFile, outputPath string) (disk.Digest, error) {
 	if file.IsDirectory {
-		return os.MkdirAll(outputPath, 0755)
+		return disk.Digest{}, os.MkdirAll(outputPath, 0755)
 	}
 
-	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
-		return err
+	data, err := p.OpenFile(file)
+	if err != nil {
+		return disk.Digest{}, err
 	}
-
-	outFile, err := os.Create(outputPath)
+	outFile, err := p.reader.CreateOutput(outputPath)
 	if err != nil {
-		return err
+		return disk.Digest{}, err
+	}
+	defer outFile.Discard()
+	if _, err := io.Copy(outFile, data); err != nil {
+		return disk.Digest{}, err
+	}
+	return outFile.Digest(), outFile.Close()
+}
+
+// OpenFile returns a reader of a file's data as RecoverFile writes it, its
+// runs in turn and zeros for its sparse runs, for it to be streamed
+// elsewhere than to a file
+func (p *Parser) OpenFile(file RecoveredFile) (io.Reader, error) {
+	if file.IsDirectory {
+		return nil, fmt.Errorf("%s is a directory", file.Name)
 	}
-	defer outFile.Close()
 
-	var written uint64
+	var parts []io.Reader
+	remaining := file.Size
 	for _, run := range file.DataRuns {
-		if run.Offset == 0 {
-			// Sparse run, write zeros
-			zeros := make([]byte, run.Length*uint64(p.clusterSize))
-			toWrite := min(uint64(len(zeros)), file.Size-written)
-			outFile.Write(zeros[:toWrite])
-			written += toWrite
-			continue
+		n := min(run.Length*uint64(p.clusterSize), remaining)
+		if n == 0 {
+			break
 		}
-
-		offset := run.Offset * int64(p.clusterSize)
-		for c := uint64(0); c < run.Length && written < file.Size; c++ {
-			buf := make([]byte, p.clusterSize)
-			if _, err := p.reader.ReadAt(buf, offset+int64(c)*int64(p.clusterSize)); err != nil {
-				if err == io.EOF {
-					break
-				}
-				return err
-			}
-
-			toWrite := min(uint64(len(buf)), file.Size-written)
-			if _, err := outFile.Write(buf[:toWrite]); err != nil {
-				return err
-			}
-			written += toWrite
+		if run.Offset == 0 {
+			// Sparse run, a hole in the file
+			parts = append(parts, disk.Zeros(int64(n)))
+		} else {
+			parts = append(parts, io.NewSectionReader(p.reader, run.Offset*int64(p.clusterSize), int64(n)))
 		}
+		remaining -= n
 	}
+	return io.MultiReader(parts...), nil
+}
 
-	return nil
+// recovered is a file a recovery wrote to outPath, rel below its output
+// directory, or failed to
+type recovered struct {
+	file    RecoveredFile
+	rel     string
+	outPath string
+	digest  disk.Digest
+	err     error
 }
 
-// Recover is the main entry point for NTFS recovery
+// Recover is the main entry point for NTFS recovery.
+// When files could not be recovered, the error is a
+// *disk.PartialRecoveryError listing them, the others having been written
 func Recover(reader *disk.Reader, outputDir string, scanOnly bool, carveMode bool) (int, error) {
+	defer reader.Purpose("NTFS recovery")()
+
 	parser, err := NewParser(reader)
 	if err != nil {
 		return 0, err
 	}
 
-	fmt.Printf("NTFS filesystem detected\n")
-	fmt.Printf("  Bytes per sector: %d\n", parser.bootSector.BytesPerSector)
-	fmt.Printf("  Sectors per cluster: %d\n", parser.bootSector.SectorsPerCluster)
-	fmt.Printf("  Cluster size: %d bytes\n", parser.clusterSize)
-	fmt.Printf("  MFT record size: %d bytes\n", parser.mftRecSize)
-	fmt.Printf("  MFT location: cluster %d\n", parser.bootSector.MFTCluster)
-	fmt.Println()
+	reader.Printf("NTFS filesystem detected\n")
+	reader.Verbosef("  Bytes per sector: %d\n", parser.bootSector.BytesPerSector)
+	reader.Verbosef("  Sectors per cluster: %d\n", parser.bootSector.SectorsPerCluster)
+	reader.Verbosef("  Cluster size: %d bytes\n", parser.clusterSize)
+	reader.Verbosef("  MFT record size: %d bytes\n", parser.mftRecSize)
+	reader.Verbosef("  MFT location: cluster %d\n", parser.bootSector.MFTCluster)
+	reader.Println()
 
 	// Estimate max MFT records (use disk size / record size as upper bound)
 	diskSize := reader.Size()
@@ -531,41 +620,122 @@ func Recover(reader *disk.Reader, outputDir string, scanOnly bool, carveMode boo
 		maxRecords = 10000000 // Cap at 10M records
 	}
 
-	files, err := parser.ScanDeletedFiles(maxRecords)
+	// A full extraction takes the files in use too
+	live, kind := reader.LiveFiles(), "deleted "
+	if live {
+		kind = ""
+	}
+	files, err := parser.scanFiles(maxRecords, live)
 	if err != nil {
 		return 0, err
 	}
+	if filter := reader.Filter(); filter.Active() {
+		kept := files[:0]
+		for _, f := range files {
+			e := disk.FileEntry{
+				Path: f.Path, Dir: f.IsDirectory, Deleted: f.IsDeleted, Size: int64(f.Size),
+				Created: f.Created, Modified: f.Modified,
+			}
+			if filter.Match(e) {
+				kept = append(kept, f)
+			}
+		}
+		reader.Printf("Left out %d %sfiles and directories the filter does not keep\n", len(files)-len(kept), kind)
+		files = kept
+	}
 
-	fmt.Printf("\nFound %d deleted files:\n\n", len(files))
-	for i, f := range files {
+	reader.Printf("\nFound %d %sfiles:\n\n", len(files), kind)
+	for _, f := range files {
 		fileType := "FILE"
 		if f.IsDirectory {
 			fileType = "DIR "
 		}
-		fmt.Printf("[%d] %s %s (%d bytes)\n", i+1, fileType, f.Path, f.Size)
+		state := ""
+		if live && f.IsDeleted {
+			state = ", deleted"
+		}
+		reader.Printf("  %s %s (%d bytes%s)\n", fileType, f.Path, f.Size, state)
 	}
 
 	if scanOnly {
 		return len(files), nil
 	}
 
-	fmt.Println("\nRecovering files...")
-	recovered := 0
+	count, total := 0, int64(0)
 	for _, f := range files {
-		if f.IsDirectory || len(f.DataRuns) == 0 {
-			continue
+		if !f.IsDirectory && len(f.DataRuns) > 0 {
+			count, total = count+1, total+int64(f.Size)
 		}
+	}
+	if err := reader.PlanOutput(count, total); err != nil {
+		return 0, err
+	}
 
-		outPath := filepath.Join(outputDir, f.Path)
-		if err := parser.RecoverFile(f, outPath); err != nil {
-			fmt.Printf("  Failed to recover %s: %v\n", f.Name, err)
-			continue
+	reader.Println("\nRecovering files...")
+	var written []disk.ManifestEntry
+	var sources []RecoveredFile // Of the files written
+	var failed []*disk.FileError
+	names := disk.NewNames()
+	attempted := 0
+	var stopped error
+	jobs := func(yield func(func() recovered) bool) {
+		for _, f := range files {
+			if stopped = reader.Err(); stopped != nil {
+				return
+			}
+			if f.IsDirectory || len(f.DataRuns) == 0 {
+				continue
+			}
+			reader.Report(disk.Progress{Phase: "NTFS recovery", Current: int64(attempted), Total: int64(count), Found: int64(len(written)), Item: f.Path})
+			attempted++
+
+			// Files with the same path are all kept, the later under a new name
+			rel := reader.OutputPath(names.Claim(f.Path))
+			outPath := filepath.Join(outputDir, rel)
+			if !yield(func() recovered {
+				digest, err := parser.RecoverFile(f, outPath)
+				return recovered{f, rel, outPath, digest, err}
+			}) {
+				return
+			}
+		}
+	}
+	disk.InOrder(reader.Workers(), jobs, func(r recovered) {
+		f := r.file
+		if r.err != nil {
+			reader.Errorf("  Failed to recover %s: %v\n", f.Name, r.err)
+			if !errors.Is(r.err, disk.ErrOutputFull) { // Left out on purpose, and listed
+				failed = append(failed, &disk.FileError{Path: f.Path, Err: r.err})
+			}
+			return
+		}
+		reader.Printf("  Recovered: %s\n", r.outPath)
+		reader.Recovered(disk.WrittenFile{Path: r.outPath, Original: f.Path, Source: "ntfs", Digest: r.digest})
+		reader.Finished(r.outPath)
+		entry := disk.ManifestEntry{Path: filepath.ToSlash(r.rel), Status: reader.OutputStatus(), Digest: r.digest}
+		if r.rel != f.Path {
+			entry.Original = filepath.ToSlash(f.Path)
 		}
-		fmt.Printf("  Recovered: %s\n", outPath)
-		recovered++
+		written = append(written, entry)
+		sources = append(sources, f)
+	})
+	if stopped != nil {
+		return len(written), stopped
 	}
 
-	return recovered, nil
+	if reader.Verifying() {
+		verifier, err := NewParser(reader.Verifier())
+		if err != nil {
+			return len(written), err
+		}
+		reader.Verify(outputDir, written, func(i int) (disk.Digest, error) {
+			return verifier.RecoverFile(sources[i], "")
+		})
+	}
+	if err := disk.WriteManifest(outputDir, written); err != nil {
+		return len(written), err
+	}
+	return len(written), disk.Partial(len(written), failed)
 }
 
 func min(a, b uint64) uint64 {
@@ -1,9 +1,13 @@
 package ntfs
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/shubham/recovery/internal/disk"
@@ -116,6 +120,83 @@ func TestNTFSNewParser(t *testing.T) {
 	}
 }
 
+func TestNTFSNewParserCorrupt(t *testing.T) {
+	boot := make([]byte, 4096)
+	for _, tc := range []struct {
+		signature string
+		details   string
+	}{
+		{"", "no NTFS signature"},
+		{"NTFS", "invalid cluster size"},
+	} {
+		copy(boot[3:], tc.signature)
+		_, err := NewParser(disk.NewReader(bytes.NewReader(boot), int64(len(boot)), "blank.img"))
+		var bse *disk.BootSectorError
+		if !errors.As(err, &bse) || bse.Details != tc.details || !errors.Is(err, disk.ErrCorruptBootSector) {
+			t.Errorf("Expected a corrupt boot sector (%s), got %v", tc.details, err)
+		}
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	data := make([]byte, 4*4096)
+	copy(data[4096:], bytes.Repeat([]byte("a"), 4096))
+	copy(data[3*4096:], "0123456789")
+	p := &Parser{reader: disk.NewReader(bytes.NewReader(data), int64(len(data)), "mem"), clusterSize: 4096}
+
+	// A cluster of data, a sparse one and 10 bytes of the last
+	file := RecoveredFile{Name: "a.bin", Size: 2*4096 + 10, DataRuns: []DataRun{{Offset: 1, Length: 1}, {Offset: 0, Length: 1}, {Offset: 3, Length: 1}}}
+	r, err := p.OpenFile(file)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	want := append(append(bytes.Repeat([]byte("a"), 4096), make([]byte, 4096)...), "0123456789"...)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Errorf("Expected the runs with a hole between them, got %d bytes (%v)", len(got), err)
+	}
+
+	if _, err := p.OpenFile(RecoveredFile{Name: "docs", IsDirectory: true}); err == nil {
+		t.Error("Expected an error opening a directory")
+	}
+}
+
+func TestWalkDeletedFiles(t *testing.T) {
+	// A deleted old.txt in docs, whose record comes after it, a deleted
+	// gone.txt in the root and a live a.bin
+	parser := newVolume(t, func(mft []byte) {
+		putRecord(mft, 0, 0x01, fileNameAttr("$MFT", 5), dataAttr(16*1024, 4, 4))
+		putRecord(mft, 5, 0x03, fileNameAttr(".", 5))
+		putRecord(mft, 11, 0x00, fileNameAttr("old.txt", 14), dataAttr(10, 40, 1))
+		putRecord(mft, 12, 0x00, fileNameAttr("gone.txt", 5), dataAttr(10, 41, 1))
+		putRecord(mft, 13, 0x01, fileNameAttr("a.bin", 5), dataAttr(5000, 30, 2))
+		putRecord(mft, 14, 0x03, fileNameAttr("docs", 5))
+	})
+
+	var paths []string
+	err := parser.WalkDeletedFiles(parser.RecordCount(), func(file RecoveredFile) error {
+		paths = append(paths, file.Path)
+		return nil
+	})
+	if want := []string{filepath.Join("docs", "old.txt"), "gone.txt"}; err != nil || !reflect.DeepEqual(paths, want) {
+		t.Errorf("Expected %v, got %v (%v)", want, paths, err)
+	}
+	if _, ok := parser.mftRecords[11]; ok {
+		t.Error("Expected only directories to be kept")
+	}
+
+	// The first error of visit stops the walk
+	stop := errors.New("stop")
+	paths = nil
+	err = parser.WalkDeletedFiles(parser.RecordCount(), func(file RecoveredFile) error {
+		paths = append(paths, file.Path)
+		return stop
+	})
+	if err != stop || len(paths) != 1 {
+		t.Errorf("Expected the walk to stop after one file, got %v (%v)", paths, err)
+	}
+}
+
 func TestDecodeUTF16(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,74 @@
+package ntfs
+
+import (
+	"strings"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// Slack returns the slack of each file in use: the rest of the cluster that
+// holds the end of its data. Files small enough to be stored in their MFT
+// record have none.
+func (p *Parser) Slack() ([]disk.Slack, error) {
+	if p.clusterSize == 0 || p.mftRecSize == 0 {
+		return nil, &disk.BootSectorError{Filesystem: "NTFS", Details: "invalid cluster size"}
+	}
+
+	var live []*RecoveredFile
+	records := p.RecordCount()
+	for i := uint64(0); i < records; i++ {
+		record, err := p.readMFTRecord(i)
+		if err != nil {
+			continue
+		}
+		file, err := p.parseAttributes(record)
+		if err != nil || file.Name == "" || file.Name == "." || strings.HasPrefix(file.Name, "$") {
+			continue
+		}
+		file.MFTIndex = i
+		p.mftRecords[i] = file
+		if !file.IsDeleted && !file.IsDirectory && len(file.DataRuns) > 0 {
+			live = append(live, file)
+		}
+	}
+
+	var slack []disk.Slack
+	clusterSize := uint64(p.clusterSize)
+	for _, f := range live {
+		tail := f.Size % clusterSize
+		if tail == 0 {
+			continue
+		}
+		lcn, ok := clusterAt(f.DataRuns, f.Size/clusterSize)
+		if !ok || lcn <= 0 {
+			continue
+		}
+		slack = append(slack, disk.Slack{
+			Path:   p.reconstructPath(f.MFTIndex),
+			Extent: disk.Extent{Offset: lcn*int64(clusterSize) + int64(tail), Length: int64(clusterSize - tail)},
+		})
+	}
+	return slack, nil
+}
+
+// RecordCount returns the number of records in the MFT, from the size of
+// $MFT's data, or a bound from the size of the disk
+func (p *Parser) RecordCount() uint64 {
+	if record, err := p.readMFTRecord(0); err == nil {
+		if mft, err := p.parseAttributes(record); err == nil && mft.Size > 0 {
+			return mft.Size / uint64(p.mftRecSize)
+		}
+	}
+	return min(uint64(p.reader.Size())/uint64(p.mftRecSize), 10000000)
+}
+
+// clusterAt maps a cluster of a file's data to its cluster on the volume
+func clusterAt(runs []DataRun, vcn uint64) (int64, bool) {
+	for _, run := range runs {
+		if vcn < run.Length {
+			return run.Offset + int64(vcn), true
+		}
+		vcn -= run.Length
+	}
+	return 0, false
+}
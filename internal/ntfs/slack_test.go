@@ -0,0 +1,132 @@
+package ntfs
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// fileNameAttr builds a resident $FILE_NAME attribute
+func fileNameAttr(name string, parent uint64) []byte {
+	le := binary.LittleEndian
+	chars := utf16.Encode([]rune(name))
+	attr := make([]byte, (24+66+2*len(chars)+7)&^7)
+	le.PutUint32(attr[0:], AttrFileName)
+	le.PutUint32(attr[4:], uint32(len(attr)))
+	le.PutUint32(attr[16:], uint32(66+2*len(chars)))
+	le.PutUint16(attr[20:], 24)
+	value := attr[24:]
+	le.PutUint64(value[0:], parent)
+	value[64] = byte(len(chars))
+	value[65] = 1 // Win32 name
+	for i, c := range chars {
+		le.PutUint16(value[66+2*i:], c)
+	}
+	return attr
+}
+
+// dataAttr builds a non-resident $DATA attribute of size bytes in one run of
+// clusters starting at lcn
+func dataAttr(size uint64, lcn, clusters byte) []byte {
+	le := binary.LittleEndian
+	attr := make([]byte, 0x48)
+	le.PutUint32(attr[0:], AttrData)
+	le.PutUint32(attr[4:], uint32(len(attr)))
+	attr[8] = 1
+	le.PutUint16(attr[32:], 0x40)
+	le.PutUint64(attr[48:], size)
+	copy(attr[0x40:], []byte{0x11, clusters, lcn, 0})
+	return attr
+}
+
+// streamAttr builds a resident $DATA attribute of a named stream
+func streamAttr(name string, size int) []byte {
+	le := binary.LittleEndian
+	attr := make([]byte, 0x28+size)
+	le.PutUint32(attr[0:], AttrData)
+	le.PutUint32(attr[4:], uint32(len(attr)))
+	attr[9] = byte(len(name))
+	le.PutUint16(attr[10:], 0x18)
+	for i, c := range utf16.Encode([]rune(name)) {
+		le.PutUint16(attr[0x18+2*i:], c)
+	}
+	le.PutUint32(attr[16:], uint32(size))
+	le.PutUint16(attr[20:], 0x28)
+	return attr
+}
+
+// putRecord writes an MFT record holding the attributes at index
+func putRecord(mft []byte, index int, flags uint16, attrs ...[]byte) {
+	rec := mft[index*1024 : (index+1)*1024]
+	copy(rec, MFTRecordMagic)
+	binary.LittleEndian.PutUint16(rec[20:], 0x38)
+	binary.LittleEndian.PutUint16(rec[22:], flags)
+	off := 0x38
+	for _, a := range attrs {
+		off += copy(rec[off:], a)
+	}
+	binary.LittleEndian.PutUint32(rec[off:], AttrEnd)
+}
+
+// newVolume writes a 64-cluster volume of 4KB clusters whose MFT, at
+// cluster 4, build fills in, and returns a parser for it
+func newVolume(t *testing.T, build func(mft []byte)) *Parser {
+	t.Helper()
+	le := binary.LittleEndian
+	data := make([]byte, 64*4096)
+	copy(data[3:], "NTFS    ")
+	le.PutUint16(data[11:], 512)
+	data[13] = 8
+	le.PutUint64(data[40:], 64*8)
+	le.PutUint64(data[48:], 4) // MFT cluster
+	data[64] = 0xF6
+	data[510], data[511] = 0x55, 0xAA
+	build(data[4*4096:])
+
+	path := filepath.Join(t.TempDir(), "ntfs.img")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to create NTFS image: %v", err)
+	}
+	reader, err := disk.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open image: %v", err)
+	}
+	t.Cleanup(func() { reader.Close() })
+
+	parser, err := NewParser(reader)
+	if err != nil {
+		t.Fatalf("NewParser failed: %v", err)
+	}
+	return parser
+}
+
+func TestSlack(t *testing.T) {
+	// A 16-record MFT: notes.txt in clusters 20-21, docs/a.bin in cluster 30
+	// with a Zone.Identifier stream, a deleted file and an empty one
+	parser := newVolume(t, func(mft []byte) {
+		putRecord(mft, 0, 0x01, fileNameAttr("$MFT", 5), dataAttr(16*1024, 4, 4))
+		putRecord(mft, 5, 0x03, fileNameAttr(".", 5))
+		putRecord(mft, 10, 0x01, fileNameAttr("notes.txt", 5), dataAttr(5000, 20, 2))
+		putRecord(mft, 11, 0x03, fileNameAttr("docs", 5))
+		putRecord(mft, 12, 0x01, fileNameAttr("a.bin", 11), dataAttr(100, 30, 1), streamAttr("Zone.Identifier", 26))
+		putRecord(mft, 13, 0x00, fileNameAttr("old.txt", 5), dataAttr(10, 40, 1))
+		putRecord(mft, 14, 0x01, fileNameAttr("empty.txt", 5))
+	})
+	slack, err := parser.Slack()
+	if err != nil {
+		t.Fatalf("Slack failed: %v", err)
+	}
+
+	want := []disk.Slack{
+		{Path: "notes.txt", Extent: disk.Extent{Offset: 21*4096 + 904, Length: 4096 - 904}},
+		{Path: filepath.Join("docs", "a.bin"), Extent: disk.Extent{Offset: 30*4096 + 100, Length: 4096 - 100}},
+	}
+	if !reflect.DeepEqual(slack, want) {
+		t.Errorf("Expected %+v, got %+v", want, slack)
+	}
+}
@@ -0,0 +1,293 @@
+package ntfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+const (
+	// extendRecord is the MFT record of $Extend, the directory holding
+	// $UsnJrnl
+	extendRecord = 11
+	// usnMaxRead bounds how much of $UsnJrnl:$J is read; Windows keeps 32MB
+	// of it by default
+	usnMaxRead = 512 * 1024 * 1024
+)
+
+// usnReasons names the bits of a change journal record's reason
+var usnReasons = []struct {
+	bit  uint32
+	name string
+}{
+	{0x00000001, "DATA_OVERWRITE"},
+	{0x00000002, "DATA_EXTEND"},
+	{0x00000004, "DATA_TRUNCATION"},
+	{0x00000010, "NAMED_DATA_OVERWRITE"},
+	{0x00000020, "NAMED_DATA_EXTEND"},
+	{0x00000040, "NAMED_DATA_TRUNCATION"},
+	{0x00000100, "FILE_CREATE"},
+	{0x00000200, "FILE_DELETE"},
+	{0x00000400, "EA_CHANGE"},
+	{0x00000800, "SECURITY_CHANGE"},
+	{0x00001000, "RENAME_OLD_NAME"},
+	{0x00002000, "RENAME_NEW_NAME"},
+	{0x00004000, "INDEXABLE_CHANGE"},
+	{0x00008000, "BASIC_INFO_CHANGE"},
+	{0x00010000, "HARD_LINK_CHANGE"},
+	{0x00020000, "COMPRESSION_CHANGE"},
+	{0x00040000, "ENCRYPTION_CHANGE"},
+	{0x00080000, "OBJECT_ID_CHANGE"},
+	{0x00100000, "REPARSE_POINT_CHANGE"},
+	{0x00200000, "STREAM_CHANGE"},
+	{0x80000000, "CLOSE"},
+}
+
+// recordTimes holds the creation, modification, MFT change and access times
+// of a record, in Unix seconds
+type recordTimes [4]int64
+
+// Timeline returns an entry for each file and directory with the times in
+// its $STANDARD_INFORMATION, another with those in its $FILE_NAME, which
+// tools rarely update and so survive timestamp tampering, an entry for each
+// record of the change journal ($UsnJrnl:$J) and one for each file in the
+// recycle bin with when it was deleted
+func (p *Parser) Timeline() ([]disk.TimelineEntry, error) {
+	if p.clusterSize == 0 || p.mftRecSize == 0 {
+		return nil, &disk.BootSectorError{Filesystem: "NTFS", Details: "invalid cluster size"}
+	}
+
+	type timed struct {
+		file     *RecoveredFile
+		si, fn   recordTimes
+		resident []byte // Data of small $I files
+	}
+	var files []timed
+	var journal []byte // $UsnJrnl's record
+	records := p.RecordCount()
+	for i := uint64(0); i < records; i++ {
+		record, err := p.readMFTRecord(i)
+		if err != nil {
+			continue
+		}
+		file, err := p.parseAttributes(record)
+		if err != nil || file.Name == "" || file.Name == "." {
+			continue
+		}
+		file.MFTIndex = i
+		p.mftRecords[i] = file
+		if file.Name == "$UsnJrnl" && file.ParentRef == extendRecord {
+			journal = record
+		}
+		t := timed{file: file}
+		t.si, t.fn = attributeTimes(record)
+		if strings.HasPrefix(file.Name, "$I") && !file.IsDirectory {
+			t.resident = residentData(record)
+		}
+		files = append(files, t)
+	}
+
+	var entries []disk.TimelineEntry
+	for _, t := range files {
+		path := p.reconstructPath(t.file.MFTIndex)
+		note := ""
+		if t.file.IsDeleted {
+			note = " (deleted)"
+		}
+		for k, times := range []recordTimes{t.si, t.fn} {
+			name := path + note
+			if k == 1 {
+				name += " ($FILE_NAME)"
+			}
+			entries = append(entries, disk.TimelineEntry{
+				Path: name, Inode: t.file.MFTIndex, Dir: t.file.IsDirectory, Size: int64(t.file.Size),
+				Created: times[0], Modified: times[1], Changed: times[2], Accessed: times[3],
+			})
+		}
+		if disk.IsRecycleBinInfo(path) && !t.file.IsDeleted {
+			data := t.resident
+			if data == nil && len(t.file.DataRuns) > 0 && t.file.Size < 4096 {
+				data, _ = p.readRuns(t.file.DataRuns, t.file.Size)
+			}
+			if e, ok := disk.RecycleBinEntry(path, data); ok {
+				e.Inode = t.file.MFTIndex
+				entries = append(entries, e)
+			}
+		}
+	}
+
+	if journal != nil {
+		events, err := p.journalEntries(journal)
+		if err != nil {
+			return entries, fmt.Errorf("failed to read $UsnJrnl: %w", err)
+		}
+		entries = append(entries, events...)
+	}
+	return entries, nil
+}
+
+// attributes calls visit with the type and bytes of each attribute in a
+// record
+func attributes(record []byte, visit func(typ uint32, attr []byte)) {
+	offset := int(binary.LittleEndian.Uint16(record[20:22]))
+	for offset+16 < len(record) {
+		typ := binary.LittleEndian.Uint32(record[offset:])
+		if typ == AttrEnd || typ == 0 {
+			break
+		}
+		length := int(binary.LittleEndian.Uint32(record[offset+4:]))
+		if length == 0 || length > len(record)-offset {
+			break
+		}
+		visit(typ, record[offset:offset+length])
+		offset += length
+	}
+}
+
+// residentValue returns the value of a resident attribute, or nil
+func residentValue(attr []byte) []byte {
+	if len(attr) < 24 || attr[8] != 0 {
+		return nil
+	}
+	length := int(binary.LittleEndian.Uint32(attr[16:]))
+	offset := int(binary.LittleEndian.Uint16(attr[20:]))
+	if offset+length > len(attr) {
+		return nil
+	}
+	return attr[offset : offset+length]
+}
+
+// attributeTimes reads the times of $STANDARD_INFORMATION and of the
+// record's Win32 or POSIX $FILE_NAME
+func attributeTimes(record []byte) (si, fn recordTimes) {
+	read := func(t *recordTimes, b []byte) {
+		for k := range t {
+			t[k] = disk.FiletimeUnix(binary.LittleEndian.Uint64(b[8*k:]))
+		}
+	}
+	fnType := -1
+	attributes(record, func(typ uint32, attr []byte) {
+		value := residentValue(attr)
+		switch {
+		case typ == AttrStandardInfo && len(value) >= 32:
+			read(&si, value)
+		case typ == AttrFileName && len(value) >= 66:
+			// DOS names only when there is nothing better
+			if nameType := int(value[65]); fnType == -1 || (fnType == 2 && nameType != 2) {
+				read(&fn, value[8:])
+				fnType = nameType
+			}
+		}
+	})
+	return si, fn
+}
+
+// residentData returns the data of a record's unnamed $DATA attribute when
+// the record holds it
+func residentData(record []byte) []byte {
+	var data []byte
+	attributes(record, func(typ uint32, attr []byte) {
+		if typ == AttrData && attr[9] == 0 {
+			data = residentValue(attr)
+		}
+	})
+	return data
+}
+
+// journalEntries reads the records of the change journal, $UsnJrnl's $J
+// stream. Its start is sparse, as Windows frees the oldest records, so only
+// the allocated runs are read.
+func (p *Parser) journalEntries(record []byte) ([]disk.TimelineEntry, error) {
+	var runs []DataRun
+	attributes(record, func(typ uint32, attr []byte) {
+		if typ != AttrData || attr[8] != 1 || attr[9] != 2 {
+			return
+		}
+		nameOff := int(binary.LittleEndian.Uint16(attr[10:]))
+		if nameOff+4 <= len(attr) && decodeUTF16(attr[nameOff:nameOff+4]) == "$J" {
+			runs = p.parseDataRuns(attr)
+		}
+	})
+
+	var entries []disk.TimelineEntry
+	var read int64
+	for _, run := range runs {
+		length := int64(run.Length) * int64(p.clusterSize)
+		if run.Offset <= 0 || read+length > usnMaxRead {
+			continue
+		}
+		data := make([]byte, length)
+		n, err := p.reader.ReadAt(data, run.Offset*int64(p.clusterSize))
+		if err != nil && err != io.EOF {
+			return entries, err
+		}
+		read += length
+		entries = append(entries, p.usnEntries(data[:n])...)
+	}
+	return entries, nil
+}
+
+// usnEntries parses USN_RECORD_V2 and V3 records, skipping the zeros that
+// pad them to the end of each page
+func (p *Parser) usnEntries(data []byte) []disk.TimelineEntry {
+	le := binary.LittleEndian
+	var entries []disk.TimelineEntry
+	for pos := 0; pos+8 <= len(data); {
+		length := int(le.Uint32(data[pos:]))
+		if length < 60 || pos+length > len(data) {
+			pos += 8
+			continue
+		}
+		rec := data[pos : pos+length]
+		pos += (length + 7) &^ 7
+
+		var ref, parent uint64
+		var fields []byte // From the timestamp on
+		switch le.Uint16(rec[4:]) {
+		case 2:
+			ref, parent, fields = le.Uint64(rec[8:]), le.Uint64(rec[16:]), rec[32:]
+		case 3:
+			if length < 76 {
+				continue
+			}
+			ref, parent, fields = le.Uint64(rec[8:]), le.Uint64(rec[24:]), rec[48:]
+		default:
+			continue
+		}
+		nameLen, nameOff := int(le.Uint16(fields[24:])), int(le.Uint16(fields[26:]))
+		if nameOff+nameLen > length {
+			continue
+		}
+
+		var reasons []string
+		reason := le.Uint32(fields[8:])
+		for _, r := range usnReasons {
+			if reason&r.bit != 0 {
+				reasons = append(reasons, r.name)
+			}
+		}
+		name := decodeUTF16(rec[nameOff : nameOff+nameLen])
+		entries = append(entries, disk.TimelineEntry{
+			Path:    fmt.Sprintf("%s ($UsnJrnl: %s)", filepath.Join(p.parentPath(parent&0x0000FFFFFFFFFFFF), name), strings.Join(reasons, ",")),
+			Inode:   ref & 0x0000FFFFFFFFFFFF,
+			Changed: disk.FiletimeUnix(le.Uint64(fields)),
+		})
+	}
+	return entries
+}
+
+// parentPath returns the path of a directory a journal record names, ""
+// for the root and $OrphanFiles for directories no longer in the MFT
+func (p *Parser) parentPath(index uint64) string {
+	if index == 5 {
+		return ""
+	}
+	if _, ok := p.mftRecords[index]; !ok {
+		return "$OrphanFiles"
+	}
+	return p.reconstructPath(index)
+}
@@ -0,0 +1,119 @@
+package ntfs
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// filetime converts Unix seconds to a FILETIME
+func filetime(unix int64) uint64 {
+	return uint64(unix+11644473600) * 10000000
+}
+
+// standardInfoAttr builds a resident $STANDARD_INFORMATION attribute with
+// the creation, modification, MFT change and access times
+func standardInfoAttr(times ...int64) []byte {
+	le := binary.LittleEndian
+	attr := make([]byte, 24+72)
+	le.PutUint32(attr[0:], AttrStandardInfo)
+	le.PutUint32(attr[4:], uint32(len(attr)))
+	le.PutUint32(attr[16:], 72)
+	le.PutUint16(attr[20:], 24)
+	for i, t := range times {
+		le.PutUint64(attr[24+8*i:], filetime(t))
+	}
+	return attr
+}
+
+// journalAttr builds $UsnJrnl's $J stream: two sparse clusters, then one
+// at lcn
+func journalAttr(lcn byte) []byte {
+	le := binary.LittleEndian
+	attr := make([]byte, 0x50)
+	le.PutUint32(attr[0:], AttrData)
+	le.PutUint32(attr[4:], uint32(len(attr)))
+	attr[8] = 1
+	attr[9] = 2
+	le.PutUint16(attr[10:], 0x40)
+	copy(attr[0x40:], []byte{'$', 0, 'J', 0})
+	le.PutUint16(attr[32:], 0x48)
+	le.PutUint64(attr[48:], 3*4096)
+	copy(attr[0x48:], []byte{0x01, 2, 0x11, 1, lcn, 0})
+	return attr
+}
+
+// usnRecord builds a USN_RECORD_V2
+func usnRecord(ref, parent uint64, when int64, reason uint32, name string) []byte {
+	le := binary.LittleEndian
+	chars := utf16.Encode([]rune(name))
+	rec := make([]byte, (60+2*len(chars)+7)&^7)
+	le.PutUint32(rec[0:], uint32(len(rec)))
+	le.PutUint16(rec[4:], 2)
+	le.PutUint64(rec[8:], ref)
+	le.PutUint64(rec[16:], parent)
+	le.PutUint64(rec[32:], filetime(when))
+	le.PutUint32(rec[40:], reason)
+	le.PutUint16(rec[56:], uint16(2*len(chars)))
+	le.PutUint16(rec[58:], 60)
+	for i, c := range chars {
+		le.PutUint16(rec[60+2*i:], c)
+	}
+	return rec
+}
+
+func TestTimeline(t *testing.T) {
+	const created, modified, changed, accessed, deleted = 1600000000, 1610000000, 1620000000, 1630000000, 1640000000
+
+	// report.docx, deleted, whose $FILE_NAME keeps an older creation time; a
+	// $I file in the recycle bin and a journal record of the deletion
+	original := `C:\a.txt`
+	info := make([]byte, 28+2*len(original))
+	le := binary.LittleEndian
+	le.PutUint64(info[0:], 2)
+	le.PutUint64(info[8:], 20480)
+	le.PutUint64(info[16:], filetime(deleted))
+	le.PutUint32(info[24:], uint32(len(original)))
+	for i, c := range original {
+		le.PutUint16(info[28+2*i:], uint16(c))
+	}
+	recycled := streamAttr("", len(info))
+	copy(recycled[0x28:], info)
+
+	parser := newVolume(t, func(mft []byte) {
+		putRecord(mft, 0, 0x01, fileNameAttr("$MFT", 5), dataAttr(16*1024, 4, 4))
+		putRecord(mft, 5, 0x03, fileNameAttr(".", 5))
+		putRecord(mft, 11, 0x03, fileNameAttr("$Extend", 5))
+		putRecord(mft, 12, 0x01, fileNameAttr("$UsnJrnl", 11), journalAttr(20))
+		name := fileNameAttr("report.docx", 5)
+		le.PutUint64(name[24+8:], filetime(created-1000))
+		putRecord(mft, 13, 0x00, standardInfoAttr(created, modified, changed, accessed), name, dataAttr(20480, 30, 5))
+		putRecord(mft, 14, 0x03, fileNameAttr("$Recycle.Bin", 5))
+		putRecord(mft, 15, 0x01, fileNameAttr("$IAB12CD.txt", 14), recycled)
+		copy(mft[(20-4)*4096:], usnRecord(13|3<<48, 5|1<<48, deleted, 0x80000200, "report.docx"))
+	})
+
+	entries, err := parser.Timeline()
+	if err != nil {
+		t.Fatalf("Timeline failed: %v", err)
+	}
+	byPath := make(map[string]disk.TimelineEntry)
+	for _, e := range entries {
+		byPath[e.Path] = e
+	}
+	want := []disk.TimelineEntry{
+		{Path: "report.docx (deleted)", Inode: 13, Size: 20480, Created: created, Modified: modified, Changed: changed, Accessed: accessed},
+		{Path: "report.docx (deleted) ($FILE_NAME)", Inode: 13, Size: 20480, Created: created - 1000},
+		{Path: "$Recycle.Bin", Inode: 14, Dir: true},
+		{Path: filepath.Join("$Recycle.Bin", "$RAB12CD.txt") + ` (deleted from C:\a.txt)`, Inode: 15, Size: 20480, Changed: deleted},
+		{Path: "report.docx ($UsnJrnl: FILE_DELETE,CLOSE)", Inode: 13, Changed: deleted},
+	}
+	for _, w := range want {
+		if got, ok := byPath[w.Path]; !ok || got != w {
+			t.Errorf("Expected %+v, got %+v", w, got)
+		}
+	}
+}
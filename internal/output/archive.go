@@ -0,0 +1,311 @@
+// Package output delivers what a run recovered to where it is wanted, when
+// that is not a plain directory.
+package output
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/klauspost/compress/zstd"
+)
+
+// An archive holds a whole output directory in one file: recovered files,
+// reports, manifests and all, with their modification times and modes. A
+// network share or USB stick takes one large file far faster than millions
+// of small ones, and one file is easier to hand over. The format follows
+// the archive's name:
+//
+//	out.zip                ZIP, deflated except for formats that are compressed already
+//	out.tar                tar (PAX, so long and non-ASCII names are kept)
+//	out.tar.gz, out.tgz    gzip-compressed tar
+//	out.tar.zst            zstd-compressed tar
+//
+// Each file is added as soon as the run is done with it, from where it was
+// written, and the reports and manifests written last once the run ends.
+// The archive is written under a .part name and renamed once complete, so
+// one with its final name is never cut short.
+
+// Archive formats
+const (
+	FormatZip    = "zip"
+	FormatTar    = "tar"
+	FormatTarGz  = "tar.gz"
+	FormatTarZst = "tar.zst"
+)
+
+// partSuffix marks an archive still being written
+const partSuffix = ".part"
+
+// ArchiveFormat returns the format of an archive from its name, which may
+// end in AgeSuffix when it is encrypted
+func ArchiveFormat(path string) (string, error) {
+	name := strings.TrimSuffix(strings.ToLower(filepath.Base(path)), AgeSuffix)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return FormatZip, nil
+	case strings.HasSuffix(name, ".tar"):
+		return FormatTar, nil
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return FormatTarGz, nil
+	case strings.HasSuffix(name, ".tar.zst"), strings.HasSuffix(name, ".tzst"):
+		return FormatTarZst, nil
+	}
+	return "", fmt.Errorf("unknown archive format %q (want .zip, .tar, .tar.gz or .tar.zst)", path)
+}
+
+// stored are the extensions of formats compressed already, which ZIP
+// stores rather than deflating again
+var stored = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true,
+	".mp4": true, ".mov": true, ".m4v": true, ".mkv": true, ".avi": true, ".mp3": true, ".m4a": true, ".ogg": true, ".flac": true,
+	".zip": true, ".docx": true, ".xlsx": true, ".pptx": true, ".odt": true, ".jar": true, ".apk": true,
+	".gz": true, ".bz2": true, ".xz": true, ".zst": true, ".7z": true, ".rar": true, ".pdf": true,
+}
+
+// Archive writes everything below dir to the archive at path, which must
+// not be inside dir, encrypted for the recipients if there are any, and
+// returns the number of files in it
+func Archive(dir, path string, recipients []age.Recipient) (int, error) {
+	s, err := OpenArchive(dir, path, recipients)
+	if err != nil {
+		return 0, err
+	}
+	return s.Close()
+}
+
+// OpenArchive starts the archive at path, which must not be inside dir, of
+// the files below dir, encrypted for the recipients if there are any. Each
+// file is added to it as it is sent, and it is renamed to path once closed.
+func OpenArchive(dir, path string, recipients []age.Recipient) (*Sender, error) {
+	format, err := ArchiveFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(absDir, absPath); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("archive %s is inside the directory it archives", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	part := path + partSuffix
+	f, err := os.Create(part)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := encrypt(f, recipients)
+	if err != nil {
+		f.Close()
+		os.Remove(part)
+		return nil, err
+	}
+	aw, err := newArchiveWriter(enc, format)
+	if err != nil {
+		f.Close()
+		os.Remove(part)
+		return nil, err
+	}
+	return &Sender{
+		dir:   dir,
+		where: path,
+		send:  aw.add,
+		finish: func() error {
+			if err := aw.close(); err != nil {
+				return err
+			}
+			if err := enc.Close(); err != nil {
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+			return os.Rename(part, path)
+		},
+		abort: func() {
+			f.Close()
+			os.Remove(part)
+		},
+	}, nil
+}
+
+// WriteArchive writes everything below dir to w as an archive in format
+// and returns the number of files in it
+func WriteArchive(w io.Writer, dir, format string) (int, error) {
+	aw, err := newArchiveWriter(w, format)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	err = walk(dir, func(path, name string, info os.FileInfo) error {
+		if !info.IsDir() {
+			n++
+		}
+		return aw.add(path, name, info)
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, aw.close()
+}
+
+// walk calls add with the path below dir, with forward slashes, of each
+// directory and regular file below dir
+func walk(dir string, add func(path, name string, info os.FileInfo) error) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir || !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return add(path, filepath.ToSlash(rel), info)
+	})
+}
+
+// archiveWriter adds files to an archive one at a time, each after the
+// directories it is in
+type archiveWriter struct {
+	zip  *zip.Writer
+	tar  *tar.Writer
+	comp io.WriteCloser  // Compressing the tar; nil = none
+	dirs map[string]bool // Added, by name
+}
+
+func newArchiveWriter(w io.Writer, format string) (*archiveWriter, error) {
+	a := &archiveWriter{dirs: make(map[string]bool)}
+	switch format {
+	case FormatZip:
+		a.zip = zip.NewWriter(w)
+		return a, nil
+	case FormatTar:
+	case FormatTarGz:
+		a.comp = gzip.NewWriter(w)
+	case FormatTarZst:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		a.comp = zw
+	default:
+		return nil, fmt.Errorf("unknown archive format %q", format)
+	}
+	if a.comp != nil {
+		w = a.comp
+	}
+	a.tar = tar.NewWriter(w)
+	return a, nil
+}
+
+// add adds the file or directory at path to the archive as name, a path
+// with forward slashes, after the directories it is in that were not added
+// yet
+func (a *archiveWriter) add(path, name string, info os.FileInfo) error {
+	if info.IsDir() && a.dirs[name] {
+		return nil
+	}
+	if i := strings.LastIndex(name, "/"); i >= 0 && !a.dirs[name[:i]] {
+		dir := filepath.Dir(path)
+		dirInfo, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		if err := a.add(dir, name[:i], dirInfo); err != nil {
+			return err
+		}
+	}
+	if info.IsDir() {
+		a.dirs[name] = true
+	}
+	if a.zip != nil {
+		return a.addZip(path, name, info)
+	}
+	return a.addTar(path, name, info)
+}
+
+// addZip adds a file or directory to a ZIP archive
+func (a *archiveWriter) addZip(path, name string, info os.FileInfo) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+		_, err := a.zip.CreateHeader(header)
+		return err
+	}
+	header.Method = zip.Deflate
+	if stored[strings.ToLower(filepath.Ext(name))] {
+		header.Method = zip.Store
+	}
+	out, err := a.zip.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	return copyFile(out, path)
+}
+
+// addTar adds a file or directory to a tar archive
+func (a *archiveWriter) addTar(path, name string, info os.FileInfo) error {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	header.Uname, header.Gname = "", ""
+	header.Format = tar.FormatPAX
+	if err := a.tar.WriteHeader(header); err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+	return copyFile(a.tar, path)
+}
+
+// close finishes the archive, but not the writer it was written to
+func (a *archiveWriter) close() error {
+	if a.zip != nil {
+		return a.zip.Close()
+	}
+	if err := a.tar.Close(); err != nil {
+		return err
+	}
+	if a.comp != nil {
+		return a.comp.Close()
+	}
+	return nil
+}
+
+// copyFile copies the content of the file at path to w
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
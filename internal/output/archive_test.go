@@ -0,0 +1,111 @@
+package output
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// makeOutput writes a small output directory
+func makeOutput(t *testing.T) (string, map[string]string) {
+	dir := filepath.Join(t.TempDir(), "out")
+	files := map[string]string{
+		"session.json":            `{"version": 1}`,
+		"JPEG/carved_000001.jpg":  "\xFF\xD8\xFF\xE0 photo",
+		"partition1/Users/é.docx": "document",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, files
+}
+
+func TestArchive(t *testing.T) {
+	dir, files := makeOutput(t)
+	for _, name := range []string{"out.zip", "out.tar", "out.tar.gz", "out.tar.zst"} {
+		path := filepath.Join(t.TempDir(), name)
+		n, err := Archive(dir, path, nil)
+		if err != nil || n != len(files) {
+			t.Fatalf("%s: expected %d files archived, got %d (%v)", name, len(files), n, err)
+		}
+		if _, err := os.Stat(path + partSuffix); !os.IsNotExist(err) {
+			t.Errorf("%s: the partial archive was left behind", name)
+		}
+
+		got := make(map[string]string)
+		format, _ := ArchiveFormat(path)
+		if format == FormatZip {
+			zr, err := zip.OpenReader(path)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			for _, f := range zr.File {
+				if f.FileInfo().IsDir() {
+					continue
+				}
+				rc, _ := f.Open()
+				data, _ := io.ReadAll(rc)
+				rc.Close()
+				got[f.Name] = string(data)
+				if (f.Name != "session.json") != (f.Method == zip.Store) {
+					t.Errorf("%s: unexpected method %d for %s", name, f.Method, f.Name)
+				}
+			}
+			zr.Close()
+		} else {
+			f, _ := os.Open(path)
+			var r io.Reader = f
+			switch format {
+			case FormatTarGz:
+				r, _ = gzip.NewReader(f)
+			case FormatTarZst:
+				zr, _ := zstd.NewReader(f)
+				defer zr.Close()
+				r = zr
+			}
+			tr := tar.NewReader(r)
+			for {
+				h, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				if h.Typeflag == tar.TypeReg {
+					data, _ := io.ReadAll(tr)
+					got[h.Name] = string(data)
+				}
+			}
+			f.Close()
+		}
+		for file, content := range files {
+			if got[file] != content {
+				t.Errorf("%s: expected %s to hold %q, got %q", name, file, content, got[file])
+			}
+		}
+	}
+}
+
+func TestArchiveRejects(t *testing.T) {
+	dir, _ := makeOutput(t)
+	if _, err := Archive(dir, filepath.Join(dir, "out.zip"), nil); err == nil {
+		t.Error("Expected an archive inside the directory it archives to be rejected")
+	}
+	if _, err := Archive(dir, filepath.Join(t.TempDir(), "out.rar"), nil); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+	if _, err := Archive(dir, filepath.Join(filepath.Dir(dir), "out-archive.zip"), nil); err != nil {
+		t.Errorf("Expected an archive next to the directory to be written, got %v", err)
+	}
+}
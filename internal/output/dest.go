@@ -0,0 +1,167 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// Destination is a remote store the files of an output directory are sent
+// to as a run finishes with them
+type Destination interface {
+	// Put stores what r holds under name, a path with forward slashes
+	Put(name string, r io.Reader) error
+	Close() error
+	String() string
+}
+
+// OpenDestination returns the destination a URL names
+func OpenDestination(rawURL string) (Destination, error) {
+	switch {
+	case strings.HasPrefix(rawURL, "s3://"):
+		return ParseS3(rawURL)
+	case strings.HasPrefix(rawURL, "sftp://"):
+		return DialSFTP(rawURL)
+	}
+	return nil, fmt.Errorf("unsupported destination %q (want s3://bucket/prefix or sftp://user@host/path)", rawURL)
+}
+
+// Upload sends every file below dir to d, named by its path below dir, and
+// returns the number sent. With recipients, each is encrypted for them on
+// the way and named with AgeSuffix added.
+func Upload(dir string, d Destination, recipients []age.Recipient) (int, error) {
+	return OpenUpload(dir, d, recipients).Close()
+}
+
+// OpenUpload starts sending the files below dir to d, each named by its
+// path below dir as it is sent. With recipients, each is encrypted for them
+// on the way and named with AgeSuffix added.
+func OpenUpload(dir string, d Destination, recipients []age.Recipient) *Sender {
+	return &Sender{
+		dir:   dir,
+		where: d.String(),
+		send: func(path, name string, info os.FileInfo) error {
+			if info.IsDir() {
+				return nil
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			var r io.Reader = f
+			if len(recipients) > 0 {
+				name += AgeSuffix
+				pr := encryptReader(f, recipients)
+				defer pr.Close() // Stops the encryption if the upload failed
+				r = pr
+			}
+			if err := d.Put(name, r); err != nil {
+				return fmt.Errorf("uploading %s: %w", name, err)
+			}
+			return nil
+		},
+		finish: func() error { return nil },
+	}
+}
+
+// encryptReader returns a reader of what r holds, encrypted for the
+// recipients
+func encryptReader(r io.Reader, recipients []age.Recipient) *io.PipeReader {
+	pr, pw := io.Pipe()
+	go func() {
+		enc, err := encrypt(pw, recipients)
+		if err == nil {
+			if _, err = io.Copy(enc, r); err == nil {
+				err = enc.Close()
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// UploadArchive streams an archive of everything below dir to d as name,
+// in the format its name gives and encrypted for the recipients if there
+// are any, without writing it locally, and returns the number of files in
+// it
+func UploadArchive(dir string, d Destination, name string, recipients []age.Recipient) (int, error) {
+	s, err := OpenUploadArchive(dir, d, name, recipients)
+	if err != nil {
+		return 0, err
+	}
+	return s.Close()
+}
+
+// errAborted stops an archive being uploaded when it is dropped
+var errAborted = errors.New("archive dropped")
+
+// OpenUploadArchive starts streaming an archive of the files below dir to
+// d as name, in the format its name gives and encrypted for the recipients
+// if there are any, without writing it locally. Each file is added to it as
+// it is sent, and the upload completes once it is closed.
+func OpenUploadArchive(dir string, d Destination, name string, recipients []age.Recipient) (*Sender, error) {
+	format, err := ArchiveFormat(name)
+	if err != nil {
+		return nil, err
+	}
+	name = filepath.ToSlash(name)
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := d.Put(name, pr)
+		pr.CloseWithError(err) // Stops the archive if the upload failed
+		done <- err
+	}()
+	enc, err := encrypt(pw, recipients)
+	if err != nil {
+		pw.CloseWithError(err)
+		<-done
+		return nil, err
+	}
+	aw, err := newArchiveWriter(enc, format)
+	if err != nil {
+		pw.CloseWithError(err)
+		<-done
+		return nil, err
+	}
+	// The upload ends once, however often it is waited for
+	var uploaded error
+	ended := false
+	wait := func() error {
+		if !ended {
+			uploaded, ended = <-done, true
+		}
+		return uploaded
+	}
+	return &Sender{
+		dir:   dir,
+		where: d.String(),
+		send:  aw.add, // Fails with the upload's error once it failed
+		finish: func() error {
+			err := aw.close()
+			if err == nil {
+				err = enc.Close()
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				wait()
+				return err
+			}
+			pw.Close()
+			if err := wait(); err != nil {
+				return fmt.Errorf("uploading %s: %w", name, err)
+			}
+			return nil
+		},
+		abort: func() {
+			pw.CloseWithError(errAborted)
+			wait()
+		},
+	}, nil
+}
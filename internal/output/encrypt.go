@@ -0,0 +1,142 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// Recovered files are often someone's private papers and photos, so the
+// output can be encrypted with age (https://age-encryption.org), to one or
+// more public keys or to a passphrase:
+//
+//	-encrypt age:age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p
+//	-encrypt age:age1...,age1...      (any of the keys can decrypt)
+//	-encrypt passphrase               (taken from RECOVER_PASSPHRASE)
+//
+// An archive is encrypted as it is written, and named with .age added;
+// without an archive, each file is encrypted to a copy with .age added as
+// soon as the run is done with it, and the clear one removed. The run
+// itself reads and writes clear files, so each is in the clear on the
+// local drive from when it is written until then. Either opens with
+//
+//	age -d -i key.txt out.tar.zst.age > out.tar.zst
+
+// AgeSuffix is added to the names of encrypted files
+const AgeSuffix = ".age"
+
+// PassphraseEnv holds the passphrase for -encrypt passphrase
+const PassphraseEnv = "RECOVER_PASSPHRASE"
+
+// ParseEncryption parses the -encrypt flag into the recipients to encrypt
+// to; it returns none for ""
+func ParseEncryption(spec string) ([]age.Recipient, error) {
+	switch {
+	case spec == "":
+		return nil, nil
+	case spec == "passphrase":
+		passphrase := os.Getenv(PassphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("-encrypt passphrase needs the passphrase in %s", PassphraseEnv)
+		}
+		r, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return []age.Recipient{r}, nil
+	case strings.HasPrefix(spec, "age:"):
+		var recipients []age.Recipient
+		for _, key := range strings.Split(strings.TrimPrefix(spec, "age:"), ",") {
+			r, err := age.ParseX25519Recipient(strings.TrimSpace(key))
+			if err != nil {
+				return nil, fmt.Errorf("invalid age recipient %q: %w", key, err)
+			}
+			recipients = append(recipients, r)
+		}
+		return recipients, nil
+	}
+	return nil, fmt.Errorf("unknown encryption %q (want age:<recipient> or passphrase)", spec)
+}
+
+// encrypt returns a writer that encrypts to w for the recipients, or passes
+// writes on when there are none; closing it finishes the encryption but
+// does not close w
+func encrypt(w io.Writer, recipients []age.Recipient) (io.WriteCloser, error) {
+	if len(recipients) == 0 {
+		return nopCloser{w}, nil
+	}
+	return age.Encrypt(w, recipients...)
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// EncryptDir replaces every file below dir with a copy encrypted for the
+// recipients, named with AgeSuffix added, and returns the number encrypted
+func EncryptDir(dir string, recipients []age.Recipient) (int, error) {
+	return OpenEncryptDir(dir, recipients).Close()
+}
+
+// OpenEncryptDir starts replacing the files below dir with copies encrypted
+// for the recipients, named with AgeSuffix added, each as it is sent; the
+// files encrypted already are left as they are. Aborting it still encrypts
+// what it can of the rest, so a failed run leaves no more in the clear.
+func OpenEncryptDir(dir string, recipients []age.Recipient) *Sender {
+	skip := func(name string) bool { return strings.HasSuffix(name, AgeSuffix) }
+	return &Sender{
+		dir:   dir,
+		where: dir,
+		send: func(path, name string, info os.FileInfo) error {
+			if info.IsDir() {
+				return nil
+			}
+			if err := encryptFile(path, recipients); err != nil {
+				return fmt.Errorf("encrypting %s: %w", path, err)
+			}
+			return nil
+		},
+		skip:   skip,
+		finish: func() error { return nil },
+		abort: func() {
+			walk(dir, func(path, name string, info os.FileInfo) error {
+				if !info.IsDir() && !skip(name) {
+					encryptFile(path, recipients)
+				}
+				return nil
+			})
+		},
+	}
+}
+
+// encryptFile encrypts the file at path to path+AgeSuffix and removes it
+func encryptFile(path string, recipients []age.Recipient) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(path+AgeSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	enc, err := encrypt(out, recipients)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(enc, in); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,177 @@
+package output
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+// decrypt returns what data decrypts to with identity
+func decrypt(t *testing.T, data []byte, identity age.Identity) []byte {
+	r, err := age.Decrypt(bytes.NewReader(data), identity)
+	if err != nil {
+		t.Fatalf("Failed to decrypt: %v", err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Failed to decrypt: %v", err)
+	}
+	return plain
+}
+
+func TestParseEncryption(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	other, _ := age.GenerateX25519Identity()
+	key := identity.Recipient().String()
+
+	if recipients, err := ParseEncryption(""); err != nil || recipients != nil {
+		t.Errorf("Expected no recipients for no encryption, got %v (%v)", recipients, err)
+	}
+	recipients, err := ParseEncryption("age:" + key + ", " + other.Recipient().String())
+	if err != nil || len(recipients) != 2 {
+		t.Fatalf("Expected two recipients, got %v (%v)", recipients, err)
+	}
+	for _, spec := range []string{"age:nonsense", "gpg:" + key, "age:"} {
+		if _, err := ParseEncryption(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+
+	t.Setenv(PassphraseEnv, "")
+	if _, err := ParseEncryption("passphrase"); err == nil || !strings.Contains(err.Error(), PassphraseEnv) {
+		t.Errorf("Expected a missing passphrase to be reported, got %v", err)
+	}
+	t.Setenv(PassphraseEnv, "correct horse battery staple")
+	if recipients, err := ParseEncryption("passphrase"); err != nil || len(recipients) != 1 {
+		t.Errorf("Expected a passphrase recipient, got %v (%v)", recipients, err)
+	}
+}
+
+func TestEncryptArchive(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	recipients := []age.Recipient{identity.Recipient()}
+	dir, files := makeOutput(t)
+
+	path := filepath.Join(t.TempDir(), "out.tar"+AgeSuffix)
+	if n, err := Archive(dir, path, recipients); err != nil || n != len(files) {
+		t.Fatalf("Expected %d files archived, got %d (%v)", len(files), n, err)
+	}
+	data, _ := os.ReadFile(path)
+	if bytes.Contains(data, []byte("photo")) {
+		t.Error("Expected no clear text in the archive")
+	}
+	tr := tar.NewReader(bytes.NewReader(decrypt(t, data, identity)))
+	got := 0
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Invalid archive: %v", err)
+		}
+		if h.Typeflag == tar.TypeReg {
+			content, _ := io.ReadAll(tr)
+			if string(content) != files[h.Name] {
+				t.Errorf("Expected %s to hold %q, got %q", h.Name, files[h.Name], content)
+			}
+			got++
+		}
+	}
+	if got != len(files) {
+		t.Errorf("Expected %d files in the archive, got %d", len(files), got)
+	}
+
+	dest := make(memoryDestination)
+	if _, err := UploadArchive(dir, dest, "out.zip"+AgeSuffix, recipients); err != nil {
+		t.Fatalf("Failed to upload an encrypted archive: %v", err)
+	}
+	if plain := decrypt(t, dest["out.zip"+AgeSuffix], identity); !bytes.HasPrefix(plain, []byte("PK")) {
+		t.Errorf("Expected a zip archive, got %q", plain[:min(len(plain), 8)])
+	}
+}
+
+func TestEncryptFiles(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	recipients := []age.Recipient{identity.Recipient()}
+
+	dir, files := makeOutput(t)
+	dest := make(memoryDestination)
+	if n, err := Upload(dir, dest, recipients); err != nil || n != len(files) {
+		t.Fatalf("Expected %d files uploaded, got %d (%v)", len(files), n, err)
+	}
+	for name, content := range files {
+		if plain := decrypt(t, dest[name+AgeSuffix], identity); string(plain) != content {
+			t.Errorf("Expected %s to hold %q, got %q", name, content, plain)
+		}
+	}
+
+	if n, err := EncryptDir(dir, recipients); err != nil || n != len(files) {
+		t.Fatalf("Expected %d files encrypted, got %d (%v)", len(files), n, err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected the clear %s to be removed", name)
+		}
+		data, err := os.ReadFile(path + AgeSuffix)
+		if err != nil {
+			t.Errorf("Missing %s: %v", name+AgeSuffix, err)
+			continue
+		}
+		if plain := decrypt(t, data, identity); string(plain) != content {
+			t.Errorf("Expected %s to hold %q, got %q", name, content, plain)
+		}
+	}
+	// Encrypting again leaves encrypted files alone
+	if n, err := EncryptDir(dir, recipients); err != nil || n != 0 {
+		t.Errorf("Expected nothing left to encrypt, got %d (%v)", n, err)
+	}
+}
+
+func TestEncryptAsSent(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	dir, files := makeOutput(t)
+	s := OpenEncryptDir(dir, []age.Recipient{identity.Recipient()})
+	photo := filepath.Join(dir, "JPEG", "carved_000001.jpg")
+	if err := s.Send(photo); err != nil {
+		t.Fatalf("Failed to send a file: %v", err)
+	}
+	if _, err := os.Stat(photo); !os.IsNotExist(err) {
+		t.Error("Expected the clear file removed once sent")
+	}
+	data, err := os.ReadFile(photo + AgeSuffix)
+	if err != nil {
+		t.Fatalf("Expected the file encrypted once sent: %v", err)
+	}
+	if plain := decrypt(t, data, identity); string(plain) != files["JPEG/carved_000001.jpg"] {
+		t.Errorf("Expected the photo's content, got %q", plain)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "session.json")); err != nil {
+		t.Error("Expected a file not sent yet to stay in the clear until closed")
+	}
+	// The rest is encrypted on close, the file sent once
+	if n, err := s.Close(); err != nil || n != len(files) {
+		t.Fatalf("Expected %d files encrypted, got %d (%v)", len(files), n, err)
+	}
+	for name := range files {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Errorf("Expected the clear %s to be removed", name)
+		}
+	}
+
+	// A failed run still has the rest encrypted
+	dir, files = makeOutput(t)
+	OpenEncryptDir(dir, []age.Recipient{identity.Recipient()}).Abort()
+	for name := range files {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)) + AgeSuffix); err != nil {
+			t.Errorf("Expected %s encrypted when aborted: %v", name, err)
+		}
+	}
+}
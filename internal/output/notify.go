@@ -0,0 +1,350 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A run that takes all night can say how it ended, to webhooks that are
+// posted its summary as JSON and to mailboxes that are sent it by email.
+// They are named by URLs:
+//
+//	https://hooks.example.com/recover
+//	smtp://alerts@mail.example.com:587?from=recover@example.com&to=ops@example.com,lab@example.com
+//	file:///var/log/recover/summary.json
+//
+// A file is written the summary as JSON, for a script or batch run to read
+// once the run has ended. Webhooks and mail can also be set in a YAML
+// file, which also takes the headers a webhook wants:
+//
+//	webhooks:
+//	  - url: https://hooks.example.com/recover
+//	    headers:
+//	      Authorization: Bearer 0123abcd
+//	email:
+//	  server: mail.example.com:587
+//	  username: alerts
+//	  from: recover@example.com
+//	  to: [ops@example.com]
+//
+// The mail password is taken from SMTPPasswordEnv rather than from a URL or
+// file that others may read. Mail is sent with STARTTLS when the server
+// offers it, and a password only over TLS or to the local host.
+
+// SMTPPasswordEnv is the environment variable the mail password is read from
+const SMTPPasswordEnv = "RECOVER_SMTP_PASSWORD"
+
+// How a run ended
+const (
+	StatusCompleted   = "completed"
+	StatusFailed      = "failed"
+	StatusInterrupted = "interrupted"
+)
+
+// Summary is what a run tells its notifiers when it ends
+type Summary struct {
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	Host        string    `json:"host"`
+	Source      string    `json:"source"`
+	Output      string    `json:"output,omitempty"`      // Directory the files were written to, unless only staged there
+	Archive     string    `json:"archive,omitempty"`     // Or streamed into
+	Destination string    `json:"destination,omitempty"` // And sent to
+	Reports     []string  `json:"reports,omitempty"`     // Session record, manifests and reports written
+	Recovered   int       `json:"recovered"`
+	Skipped     int       `json:"skipped,omitempty"`    // For the output limit
+	Unverified  int       `json:"unverified,omitempty"` // Did not match the source when read back
+	Started     time.Time `json:"started"`
+	Finished    time.Time `json:"finished"`
+}
+
+// Subject is a line saying how the run ended
+func (s Summary) Subject() string {
+	if s.Status == StatusCompleted {
+		return fmt.Sprintf("recover %s on %s: %d files from %s", s.Status, s.Host, s.Recovered, s.Source)
+	}
+	return fmt.Sprintf("recover %s on %s: %s", s.Status, s.Host, s.Source)
+}
+
+// Text is the summary as lines for a person to read
+func (s Summary) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Status:     %s\n", s.Status)
+	if s.Error != "" {
+		fmt.Fprintf(&b, "Error:      %s\n", s.Error)
+	}
+	fmt.Fprintf(&b, "Host:       %s\n", s.Host)
+	fmt.Fprintf(&b, "Source:     %s\n", s.Source)
+	fmt.Fprintf(&b, "Output:     %s\n", s.Output)
+	if s.Archive != "" {
+		fmt.Fprintf(&b, "Archive:    %s\n", s.Archive)
+	}
+	if s.Destination != "" {
+		fmt.Fprintf(&b, "Sent to:    %s\n", s.Destination)
+	}
+	fmt.Fprintf(&b, "Recovered:  %d\n", s.Recovered)
+	if s.Skipped > 0 {
+		fmt.Fprintf(&b, "Skipped:    %d\n", s.Skipped)
+	}
+	if s.Unverified > 0 {
+		fmt.Fprintf(&b, "Unverified: %d\n", s.Unverified)
+	}
+	fmt.Fprintf(&b, "Started:    %s\n", s.Started.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Finished:   %s (%s)\n", s.Finished.Format(time.RFC3339), s.Finished.Sub(s.Started).Round(time.Second))
+	for _, r := range s.Reports {
+		fmt.Fprintf(&b, "Report:     %s\n", r)
+	}
+	return b.String()
+}
+
+// Notifier is told how a run ended
+type Notifier interface {
+	Notify(ctx context.Context, s Summary) error
+	String() string
+}
+
+// notifyTimeout bounds each notification, so that a server that does not
+// answer does not keep a finished run from exiting
+const notifyTimeout = 30 * time.Second
+
+// Notify tells every notifier how a run ended, and returns the errors of
+// those that could not be told
+func Notify(ctx context.Context, notifiers []Notifier, s Summary) error {
+	var errs []error
+	for _, n := range notifiers {
+		nctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+		if err := n.Notify(nctx, s); err != nil {
+			errs = append(errs, fmt.Errorf("notifying %s: %w", n, err))
+		}
+		cancel()
+	}
+	return errors.Join(errs...)
+}
+
+// ParseNotifier returns the notifier a URL names
+func ParseNotifier(rawURL string) (Notifier, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return nil, fmt.Errorf("webhook %q has no host", rawURL)
+		}
+		return &Webhook{URL: rawURL}, nil
+	case "smtp":
+		q := u.Query()
+		m := &Mail{
+			Server: u.Host,
+			From:   q.Get("from"),
+			To:     splitList(q.Get("to")),
+		}
+		if u.User != nil {
+			m.Username = u.User.Username()
+			if _, set := u.User.Password(); set {
+				return nil, fmt.Errorf("put the mail password in $%s, not in the URL", SMTPPasswordEnv)
+			}
+		}
+		if err := m.check(); err != nil {
+			return nil, err
+		}
+		return m, nil
+	case "file":
+		if u.Path == "" || u.Host != "" {
+			return nil, fmt.Errorf("summary file %q is not file:///absolute/path", rawURL)
+		}
+		return &File{Path: u.Path}, nil
+	}
+	return nil, fmt.Errorf("unsupported notification %q (want https://host/path, smtp://user@host:port?from=...&to=... or file:///path)", rawURL)
+}
+
+// notifyConfig is the form of a notification file
+type notifyConfig struct {
+	Webhooks []struct {
+		URL     string            `yaml:"url"`
+		Headers map[string]string `yaml:"headers"`
+	} `yaml:"webhooks"`
+	Email *struct {
+		Server   string   `yaml:"server"`
+		Username string   `yaml:"username"`
+		From     string   `yaml:"from"`
+		To       []string `yaml:"to"`
+	} `yaml:"email"`
+}
+
+// LoadNotifiers reads the notifiers a YAML or JSON file sets
+func LoadNotifiers(path string) ([]Notifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notification file: %w", err)
+	}
+	var cfg notifyConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: invalid notification file: %w", path, err)
+	}
+
+	var notifiers []Notifier
+	for i, w := range cfg.Webhooks {
+		n, err := ParseNotifier(w.URL)
+		if err != nil {
+			return nil, fmt.Errorf("%s: webhook %d: %w", path, i+1, err)
+		}
+		hook, ok := n.(*Webhook)
+		if !ok {
+			return nil, fmt.Errorf("%s: webhook %d: %q is not an http(s) URL", path, i+1, w.URL)
+		}
+		hook.Headers = w.Headers
+		notifiers = append(notifiers, hook)
+	}
+	if e := cfg.Email; e != nil {
+		m := &Mail{Server: e.Server, Username: e.Username, From: e.From, To: e.To}
+		if err := m.check(); err != nil {
+			return nil, fmt.Errorf("%s: email: %w", path, err)
+		}
+		notifiers = append(notifiers, m)
+	}
+	return notifiers, nil
+}
+
+// Webhook is a URL a summary is posted to as JSON
+type Webhook struct {
+	URL     string
+	Headers map[string]string
+}
+
+func (w *Webhook) Notify(ctx context.Context, s Summary) error {
+	body, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// String names the webhook without its path, which may hold a token
+func (w *Webhook) String() string {
+	if u, err := url.Parse(w.URL); err == nil {
+		return u.Scheme + "://" + u.Host
+	}
+	return "webhook"
+}
+
+// Mail is a mail server, and who a summary is sent to through it
+type Mail struct {
+	Server   string // host:port
+	Username string // To log in as, with the password from SMTPPasswordEnv; "" to send without
+	From     string
+	To       []string
+}
+
+func (m *Mail) check() error {
+	switch {
+	case m.Server == "":
+		return fmt.Errorf("no mail server")
+	case m.From == "":
+		return fmt.Errorf("no sender (from) for mail")
+	case len(m.To) == 0:
+		return fmt.Errorf("no recipients (to) for mail")
+	}
+	return nil
+}
+
+func (m *Mail) Notify(ctx context.Context, s Summary) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", headerValue(s.Subject()))
+	fmt.Fprintf(&msg, "Date: %s\r\n", s.Finished.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(s.Text(), "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		host := m.Server
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", m.Username, os.Getenv(SMTPPasswordEnv), host)
+	}
+	// SendMail takes no context, so one that ends leaves it to finish on
+	// its own
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(m.Server, auth, m.From, m.To, msg.Bytes()) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *Mail) String() string {
+	return "smtp://" + m.Server
+}
+
+// File is a file a summary is written to as JSON
+type File struct {
+	Path string
+}
+
+// Notify writes the summary to a temporary file renamed over the file, so
+// that a reader never sees half of it
+func (f *File) Notify(ctx context.Context, s Summary) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := f.Path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.Path)
+}
+
+func (f *File) String() string {
+	return "file://" + f.Path
+}
+
+// headerValue keeps a mail header on one line
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
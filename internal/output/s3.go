@@ -0,0 +1,358 @@
+package output
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Files can be sent to a bucket of Amazon S3 or of a store that speaks its
+// API (MinIO, Ceph, Cloudflare R2, Backblaze B2, ...), named by a URL:
+//
+//	s3://bucket/cases/2024-017
+//
+// The store and the credentials are taken from the environment, as the AWS
+// tools take them:
+//
+//	AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY   credentials
+//	AWS_SESSION_TOKEN                          for temporary credentials
+//	AWS_REGION or AWS_DEFAULT_REGION           region (us-east-1)
+//	AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL    a store other than AWS, such as http://minio:9000
+//
+// A file is read a part at a time and sent in one request when it fits in
+// a part, or else as a multipart upload, so files of any size, and
+// archives streamed as they are written, go up without being kept whole in
+// memory or on disk. Requests that fail for the network or the store are
+// tried again with a growing pause; an upload that fails for good is
+// aborted, so the store does not keep its parts.
+
+// S3 is a bucket, and a prefix below which files are put
+type S3 struct {
+	Endpoint  string // Scheme and host, such as https://s3.eu-west-1.amazonaws.com
+	PathStyle bool   // Address the bucket in the path rather than the host name, as most other stores want
+	Region    string
+	Bucket    string
+	Prefix    string // Without a leading or trailing slash
+
+	AccessKey, SecretKey, SessionToken string
+
+	PartSize int64 // Size of the parts of a multipart upload, doubled every 1000 parts
+	Retries  int   // Times to try a request again
+
+	client *http.Client
+	now    func() time.Time
+	pause  func(attempt int) // Waits before trying again
+}
+
+// S3 limits
+const (
+	DefaultPartSize = 16 << 20 // 16 MB; at least 5 MB but the last
+	DefaultRetries  = 4
+)
+
+// ParseS3 returns the bucket an s3:// URL names, with the store and
+// credentials in the environment
+func ParseS3(rawURL string) (*S3, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 URL %q (want s3://bucket/prefix)", rawURL)
+	}
+	s := &S3{
+		Region:       firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		Bucket:       u.Host,
+		Prefix:       strings.Trim(u.Path, "/"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		PartSize:     DefaultPartSize,
+		Retries:      DefaultRetries,
+	}
+	if s.Region == "" {
+		s.Region = "us-east-1"
+	}
+	if s.Endpoint = strings.TrimRight(firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"), "/"); s.Endpoint != "" {
+		s.PathStyle = true
+	} else {
+		s.Endpoint = "https://s3." + s.Region + ".amazonaws.com"
+	}
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return nil, fmt.Errorf("no S3 credentials: set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return s, nil
+}
+
+// firstEnv returns the first of the environment variables that is set
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (s *S3) String() string {
+	return "s3://" + s.Bucket + "/" + s.Prefix
+}
+
+// Close does nothing; every request stands alone
+func (s *S3) Close() error {
+	return nil
+}
+
+// Put uploads what r holds as the object name, below the prefix
+func (s *S3) Put(name string, r io.Reader) error {
+	key := strings.TrimPrefix(s.Prefix+"/"+name, "/")
+	partSize := s.partSize()
+	part := make([]byte, partSize)
+	n, err := io.ReadFull(r, part)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		_, err := s.do("PUT", key, nil, part[:n], nil)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// Too large for one request
+	resp, err := s.do("POST", key, url.Values{"uploads": {""}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(resp, &initiated); err != nil || initiated.UploadID == "" {
+		return fmt.Errorf("starting upload of %s: unexpected response %q", key, resp)
+	}
+	upload := url.Values{"uploadId": {initiated.UploadID}}
+
+	type completedPart struct {
+		PartNumber int
+		ETag       string
+	}
+	var parts []completedPart
+	for number := 1; n > 0; number++ {
+		query := url.Values{"uploadId": upload["uploadId"], "partNumber": {strconv.Itoa(number)}}
+		var etag string
+		_, err := s.do("PUT", key, query, part[:n], func(h http.Header) { etag = h.Get("ETag") })
+		if err != nil {
+			s.do("DELETE", key, upload, nil, nil)
+			return err
+		}
+		parts = append(parts, completedPart{number, etag})
+
+		if number%1000 == 0 {
+			partSize *= 2 // Parts may differ in size; there may be no more than 10000
+			part = make([]byte, partSize)
+		}
+		n, err = io.ReadFull(r, part)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			s.do("DELETE", key, upload, nil, nil)
+			return err
+		}
+	}
+
+	body, _ := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	resp, err = s.do("POST", key, upload, body, nil)
+	if err == nil && bytes.Contains(resp, []byte("<Error>")) {
+		err = fmt.Errorf("completing upload of %s: %s", key, resp) // Failures can come with 200 OK
+	}
+	if err != nil {
+		s.do("DELETE", key, upload, nil, nil)
+	}
+	return err
+}
+
+func (s *S3) partSize() int64 {
+	if s.PartSize > 0 {
+		return s.PartSize
+	}
+	return DefaultPartSize
+}
+
+// do sends a signed request, trying again when it fails for the network
+// or the store, and returns the response body; header, if not nil, is
+// given the response headers
+func (s *S3) do(method, key string, query url.Values, body []byte, header func(http.Header)) ([]byte, error) {
+	var lastErr error
+	for attempt := 0; attempt <= s.Retries; attempt++ {
+		if attempt > 0 {
+			s.wait(attempt)
+		}
+		req, err := s.request(method, key, query, body)
+		if err != nil {
+			return nil, err
+		}
+		client := s.client
+		if client == nil {
+			client = http.DefaultClient
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		switch {
+		case err != nil:
+			lastErr = err
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			if header != nil {
+				header(resp.Header)
+			}
+			return data, nil
+		case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+			lastErr = fmt.Errorf("%s %s: %s", method, key, resp.Status)
+		default:
+			return nil, fmt.Errorf("%s %s: %s: %s", method, key, resp.Status, bytes.TrimSpace(data))
+		}
+	}
+	return nil, lastErr
+}
+
+// wait pauses before trying a request again
+func (s *S3) wait(attempt int) {
+	if s.pause != nil {
+		s.pause(attempt)
+		return
+	}
+	time.Sleep(time.Duration(1<<(attempt-1)) * time.Second)
+}
+
+// request builds a signed request for the object key
+func (s *S3) request(method, key string, query url.Values, body []byte) (*http.Request, error) {
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	path := "/" + key
+	if s.PathStyle {
+		path = "/" + s.Bucket + path
+	} else {
+		endpoint.Host = s.Bucket + "." + endpoint.Host
+	}
+	u := *endpoint
+	u.Path = path
+	u.RawPath = uriEncode(path, false)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if method == "POST" && body != nil {
+		req.Header.Set("Content-Type", "application/xml")
+	}
+	s.sign(req, body)
+	return req, nil
+}
+
+// sign signs a request with AWS Signature Version 4, over its host, the
+// headers set on it and the SHA-256 of body
+func (s *S3) sign(req *http.Request, body []byte) {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	day := t.Format("20060102")
+	sum := sha256.Sum256(body)
+	payload := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	request := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		req.URL.RawQuery,
+		canonical.String(),
+		signed,
+		payload,
+	}, "\n")
+	scope := day + "/" + s.Region + "/s3/aws4_request"
+	requestSum := sha256.Sum256([]byte(request))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestSum[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), day)
+	for _, part := range []string{s.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signed, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode percent-encodes s as signing wants it: every byte but letters,
+// digits and -._~, and but / unless encodeSlash is set
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// canonicalQuery encodes a query string sorted by name, as signing wants it
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var pairs []string
+	for _, name := range names {
+		for _, v := range query[name] {
+			pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
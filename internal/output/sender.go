@@ -0,0 +1,128 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// A run hands each file to its Sender as soon as it is done with it, so an
+// archive or upload grows as the run goes instead of the whole output being
+// written to a directory first and sent once the run ends. Files that are
+// written last, such as reports and manifests, and any not handed over are
+// sent when the Sender is closed. Sending from a staging directory removes
+// each file once sent, so the directory holds little more than the files
+// being worked on.
+
+// Sender sends the files below an output directory on, one at a time or a
+// whole directory at a time as they are given to it, and the rest when it
+// is closed
+type Sender struct {
+	dir    string
+	where  string                                          // As String gives it
+	send   func(path, name string, info os.FileInfo) error // Sends a file or directory, name being its path below dir with forward slashes
+	skip   func(name string) bool                          // Files below dir not to send; nil = none
+	finish func() error                                    // Completes what was sent, once all of it is
+	abort  func()                                          // Drops what was sent; nil = nothing to drop
+	remove bool                                            // Files are removed once sent
+	sent   map[string]bool                                 // Names of the files sent and kept
+	n      int                                             // Files sent
+	err    error                                           // Of the first send that failed; the rest fail with it
+	done   bool                                            // Closed or aborted
+}
+
+// RemoveSent makes the sender remove each file once it is sent, as from a
+// staging directory
+func (s *Sender) RemoveSent() {
+	s.remove = true
+}
+
+func (s *Sender) String() string {
+	return s.where
+}
+
+// Send sends the file at path, or every file below the directory at path,
+// which must be below the output directory. Once a send fails, every later
+// one fails with its error, since what was sent may be cut short.
+func (s *Sender) Send(path string) error {
+	if s.done {
+		return fmt.Errorf("sending %s after the output was closed", path)
+	}
+	if s.err != nil {
+		return s.err
+	}
+	rel, err := filepath.Rel(s.dir, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return fmt.Errorf("%s is not below %s", path, s.dir)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		s.err = walk(path, func(path, name string, info os.FileInfo) error {
+			return s.sendOne(path, filepath.ToSlash(filepath.Join(rel, filepath.FromSlash(name))), info)
+		})
+	} else {
+		s.err = s.sendOne(path, filepath.ToSlash(rel), info)
+	}
+	return s.err
+}
+
+// sendOne sends a file or directory unless it was sent already
+func (s *Sender) sendOne(path, name string, info os.FileInfo) error {
+	if s.sent[name] || !info.IsDir() && s.skip != nil && s.skip(name) {
+		return nil
+	}
+	if err := s.send(path, name, info); err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+	s.n++
+	if s.remove {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if s.sent == nil {
+		s.sent = make(map[string]bool)
+	}
+	s.sent[name] = true
+	return nil
+}
+
+// Close sends the files below the output directory not sent yet and
+// completes what was sent, and returns the number of files sent in all.
+// Once it fails, what was sent is dropped, as by Abort.
+func (s *Sender) Close() (int, error) {
+	if s.done {
+		return s.n, s.err
+	}
+	if s.err == nil {
+		s.err = walk(s.dir, s.sendOne)
+	}
+	if s.err == nil {
+		s.err = s.finish()
+	}
+	if s.err != nil {
+		s.Abort()
+		return s.n, s.err
+	}
+	s.done = true
+	return s.n, nil
+}
+
+// Abort drops what was sent, when that can be done, as when the run that
+// sent it failed; it does nothing once the sender is closed
+func (s *Sender) Abort() {
+	if s.done {
+		return
+	}
+	s.done = true
+	if s.abort != nil {
+		s.abort()
+	}
+}
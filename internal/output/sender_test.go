@@ -0,0 +1,202 @@
+package output
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tarContents returns the files in the tar archive at path by name, and
+// its directories with a trailing slash
+func tarContents(t *testing.T, path string) map[string]string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got := make(map[string]string)
+	tr := tar.NewReader(f)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return got
+		}
+		if err != nil {
+			t.Fatalf("Invalid archive: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		got[h.Name] = string(data)
+	}
+}
+
+func TestSendArchive(t *testing.T) {
+	dir, files := makeOutput(t)
+	path := filepath.Join(t.TempDir(), "out.tar")
+	s, err := OpenArchive(dir, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RemoveSent()
+	photo := filepath.Join(dir, "JPEG", "carved_000001.jpg")
+	if err := s.Send(photo); err != nil {
+		t.Fatalf("Failed to send a file: %v", err)
+	}
+	if _, err := os.Stat(photo); !os.IsNotExist(err) {
+		t.Error("Expected a file sent from a staging directory to be removed")
+	}
+	if err := s.Send(filepath.Join(dir, "partition1")); err != nil {
+		t.Fatalf("Failed to send a directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "partition1", "Users", "é.docx")); !os.IsNotExist(err) {
+		t.Error("Expected the files of a directory sent to be removed")
+	}
+	if err := s.Send(filepath.Join(filepath.Dir(dir), "elsewhere.txt")); err == nil {
+		t.Error("Expected a file outside the output directory to be refused")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected the archive to keep its .part name until closed")
+	}
+
+	n, err := s.Close()
+	if err != nil || n != len(files) {
+		t.Fatalf("Expected %d files archived, got %d (%v)", len(files), n, err)
+	}
+	got := tarContents(t, path)
+	for name, content := range files {
+		if got[name] != content {
+			t.Errorf("Expected %s to hold %q, got %q", name, content, got[name])
+		}
+	}
+	for _, name := range []string{"JPEG/", "partition1/", "partition1/Users/"} {
+		if _, ok := got[name]; !ok {
+			t.Errorf("Expected the directory %s in the archive, got %v", name, got)
+		}
+	}
+	if len(got) != len(files)+3 {
+		t.Errorf("Expected each file and directory once, got %v", got)
+	}
+}
+
+func TestSendKeeps(t *testing.T) {
+	dir, files := makeOutput(t)
+	path := filepath.Join(t.TempDir(), "out.tar")
+	s, err := OpenArchive(dir, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := filepath.Join(dir, "session.json")
+	if err := s.Send(doc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(doc); err != nil {
+		t.Errorf("Expected a file sent from an output directory to be kept, got %v", err)
+	}
+	// Sent once, though still there when the rest is
+	if n, err := s.Close(); err != nil || n != len(files) {
+		t.Fatalf("Expected %d files archived, got %d (%v)", len(files), n, err)
+	}
+	if got := tarContents(t, path); len(got) != len(files)+3 {
+		t.Errorf("Expected each file and directory once, got %v", got)
+	}
+}
+
+func TestSendAbort(t *testing.T) {
+	dir, _ := makeOutput(t)
+	path := filepath.Join(t.TempDir(), "out.zip")
+	s, err := OpenArchive(dir, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(filepath.Join(dir, "session.json")); err != nil {
+		t.Fatal(err)
+	}
+	s.Abort()
+	for _, p := range []string{path, path + partSuffix} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("Expected no %s left after the archive was dropped", p)
+		}
+	}
+	if err := s.Send(filepath.Join(dir, "session.json")); err == nil {
+		t.Error("Expected a send after the archive was dropped to fail")
+	}
+	s.Abort() // Does nothing again
+}
+
+func TestSendUpload(t *testing.T) {
+	dir, files := makeOutput(t)
+	dest := make(memoryDestination)
+	s := OpenUpload(dir, dest, nil)
+	s.RemoveSent()
+	photo := filepath.Join(dir, "JPEG", "carved_000001.jpg")
+	if err := s.Send(photo); err != nil {
+		t.Fatalf("Failed to send a file: %v", err)
+	}
+	if string(dest["JPEG/carved_000001.jpg"]) != files["JPEG/carved_000001.jpg"] {
+		t.Errorf("Expected the file uploaded once sent, got %q", dest["JPEG/carved_000001.jpg"])
+	}
+	if _, err := os.Stat(photo); !os.IsNotExist(err) {
+		t.Error("Expected a file uploaded from a staging directory to be removed")
+	}
+	if n, err := s.Close(); err != nil || n != len(files) {
+		t.Fatalf("Expected %d files uploaded, got %d (%v)", len(files), n, err)
+	}
+	for name, content := range files {
+		if string(dest[name]) != content {
+			t.Errorf("Expected %s to hold %q, got %q", name, content, dest[name])
+		}
+	}
+}
+
+// failingDestination takes nothing, failing each upload once it has read
+// what it is given
+type failingDestination struct{ err error }
+
+func (d failingDestination) Put(name string, r io.Reader) error {
+	io.Copy(io.Discard, r)
+	return d.err
+}
+
+func (failingDestination) Close() error { return nil }
+
+func (failingDestination) String() string { return "failing" }
+
+func TestSendUploadArchive(t *testing.T) {
+	dir, files := makeOutput(t)
+	dest := make(memoryDestination)
+	s, err := OpenUploadArchive(dir, dest, "out.tar", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RemoveSent()
+	if err := s.Send(filepath.Join(dir, "partition1")); err != nil {
+		t.Fatalf("Failed to send a directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "partition1", "Users", "é.docx")); !os.IsNotExist(err) {
+		t.Error("Expected a file streamed from a staging directory to be removed")
+	}
+	if n, err := s.Close(); err != nil || n != len(files) {
+		t.Fatalf("Expected %d files archived, got %d (%v)", len(files), n, err)
+	}
+	path := filepath.Join(t.TempDir(), "out.tar")
+	os.WriteFile(path, dest["out.tar"], 0644)
+	got := tarContents(t, path)
+	for name, content := range files {
+		if got[name] != content {
+			t.Errorf("Expected %s to hold %q, got %q", name, content, got[name])
+		}
+	}
+
+	// An upload that fails fails the archive, and is not waited for again
+	dir, _ = makeOutput(t)
+	s, err = OpenUploadArchive(dir, failingDestination{io.ErrUnexpectedEOF}, "out.zip", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Close(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected the upload's error, got %v", err)
+	}
+	s.Abort()
+}
@@ -0,0 +1,165 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Files can also be sent over SFTP, to a NAS or any host running an SSH
+// server, each written there as it is read, named by a URL:
+//
+//	sftp://anna@nas.lab/volume1/evidence/2024-017
+//	sftp://anna@nas.lab:2222/~/evidence          (relative to the home directory)
+//
+// The host must be in ~/.ssh/known_hosts, as after a first ssh to it; a host
+// whose key is unknown or has changed is refused. The user is logged in
+// with the keys of a running ssh-agent, then ~/.ssh/id_ed25519, id_ecdsa
+// and id_rsa if they have no passphrase, then the password in
+// RECOVER_SFTP_PASSWORD or the URL.
+
+// SFTP is a directory on an SFTP server
+type SFTP struct {
+	URL    string // As given, without the password
+	Dir    string // Directory files are put below
+	client *sftp.Client
+	conn   io.Closer
+	agent  net.Conn // To the ssh-agent logged in with, or nil
+}
+
+// DialSFTP connects to the server an sftp:// URL names
+func DialSFTP(rawURL string) (*SFTP, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "sftp" || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid SFTP URL %q (want sftp://user@host/path)", rawURL)
+	}
+	user := u.User.Username()
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "22")
+	}
+
+	home, _ := os.UserHomeDir()
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("reading known hosts: %w (ssh to %s once to add its key)", err, u.Hostname())
+	}
+	auth, agentConn := sshAuth(u, home)
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+	}
+	conn, err := ssh.Dial("tcp", host, config)
+	if err != nil {
+		closeAgent(agentConn)
+		return nil, fmt.Errorf("connecting to %s: %w", host, err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		closeAgent(agentConn)
+		return nil, fmt.Errorf("starting SFTP on %s: %w", host, err)
+	}
+
+	dir := u.Path
+	if dir == "" || dir == "/" || dir == "/~" || strings.HasPrefix(dir, "/~/") {
+		dir = strings.TrimPrefix(strings.TrimPrefix(dir, "/~"), "/")
+		if dir == "" {
+			dir = "."
+		}
+	}
+	u.User = url.User(user)
+	return &SFTP{URL: u.String(), Dir: dir, client: client, conn: conn, agent: agentConn}, nil
+}
+
+// sshAuth returns the ways to log in to try, in order, and the connection
+// to the ssh-agent among them, or nil, for the caller to close
+func sshAuth(u *url.URL, home string) ([]ssh.AuthMethod, net.Conn) {
+	var methods []ssh.AuthMethod
+	var agentConn net.Conn
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			agentConn = conn
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		key, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		if signer, err := ssh.ParsePrivateKey(key); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	password, ok := u.User.Password()
+	if env := os.Getenv("RECOVER_SFTP_PASSWORD"); env != "" {
+		password, ok = env, true
+	}
+	if ok {
+		methods = append(methods, ssh.Password(password))
+	}
+	return methods, agentConn
+}
+
+func closeAgent(conn net.Conn) {
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+func (s *SFTP) String() string {
+	return s.URL
+}
+
+// Put writes what r holds to the file name below the directory, making the
+// directories it is in. It is written as it is read under a .part name and
+// renamed once complete, so a file cut short, as an archive streamed from a
+// run that failed, never has the name of a whole one.
+func (s *SFTP) Put(name string, r io.Reader) error {
+	target := path.Join(s.Dir, name)
+	if err := s.client.MkdirAll(path.Dir(target)); err != nil {
+		return err
+	}
+	part := target + partSuffix
+	f, err := s.client.Create(part)
+	if err != nil {
+		return err
+	}
+	_, err = f.ReadFrom(r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = s.client.PosixRename(part, target)
+	}
+	if err != nil {
+		s.client.Remove(part)
+	}
+	return err
+}
+
+// Close ends the session, and the connection to the ssh-agent
+func (s *SFTP) Close() error {
+	s.client.Close()
+	closeAgent(s.agent)
+	return s.conn.Close()
+}
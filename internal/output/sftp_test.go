@@ -0,0 +1,117 @@
+package output
+
+import (
+	"io"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// memorySFTP returns an SFTP destination served from memory
+func memorySFTP(t *testing.T, dir string) *SFTP {
+	serverConn, clientConn := net.Pipe()
+	server := sftp.NewRequestServer(serverConn, sftp.InMemHandler())
+	go server.Serve()
+	client, err := sftp.NewClientPipe(clientConn, clientConn)
+	if err != nil {
+		t.Fatalf("Failed to start SFTP client: %v", err)
+	}
+	s := &SFTP{URL: "sftp://anna@nas" + dir, Dir: dir, client: client, conn: server}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSFTPPut(t *testing.T) {
+	s := memorySFTP(t, "/evidence/2024-017")
+	dir, files := makeOutput(t)
+	if n, err := Upload(dir, s, nil); err != nil || n != len(files) {
+		t.Fatalf("Expected %d files uploaded, got %d (%v)", len(files), n, err)
+	}
+	for name, content := range files {
+		f, err := s.client.Open("/evidence/2024-017/" + name)
+		if err != nil {
+			t.Errorf("Missing %s: %v", name, err)
+			continue
+		}
+		data, _ := io.ReadAll(f)
+		f.Close()
+		if string(data) != content {
+			t.Errorf("Expected %s to hold %q, got %q", name, content, data)
+		}
+	}
+}
+
+func TestSFTPStreams(t *testing.T) {
+	s := memorySFTP(t, "/evidence")
+	dir, files := makeOutput(t)
+	archive, err := OpenUploadArchive(dir, s, "laptop.tar", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive.RemoveSent()
+	if err := archive.Send(filepath.Join(dir, "JPEG")); err != nil {
+		t.Fatalf("Failed to stream a directory: %v", err)
+	}
+	// Written on the server as it goes, under its .part name
+	if _, err := s.client.Stat("/evidence/laptop.tar" + partSuffix); err != nil {
+		t.Errorf("Expected the archive being streamed on the server, got %v", err)
+	}
+	if n, err := archive.Close(); err != nil || n != len(files) {
+		t.Fatalf("Expected %d files archived, got %d (%v)", len(files), n, err)
+	}
+	if _, err := s.client.Stat("/evidence/laptop.tar"); err != nil {
+		t.Errorf("Expected the archive complete on the server, got %v", err)
+	}
+
+	// One cut short is dropped
+	archive, err = OpenUploadArchive(dir, s, "cut.tar", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive.Abort()
+	for _, name := range []string{"cut.tar", "cut.tar" + partSuffix} {
+		if _, err := s.client.Stat("/evidence/" + name); err == nil {
+			t.Errorf("Expected no %s left on the server", name)
+		}
+	}
+}
+
+func TestDialSFTPURL(t *testing.T) {
+	for _, url := range []string{"sftp://", "sftp:///path", "s3://bucket"} {
+		if _, err := DialSFTP(url); err == nil || !strings.Contains(err.Error(), "invalid SFTP URL") {
+			t.Errorf("Expected %q to be rejected as invalid, got %v", url, err)
+		}
+	}
+}
+
+func TestSFTPClosesAgent(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %v", sock, err)
+	}
+	defer l.Close()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+	methods, conn := sshAuth(&url.URL{}, t.TempDir())
+	if conn == nil || len(methods) != 1 {
+		t.Fatalf("Expected the agent to be logged in with, got %d methods and %v", len(methods), conn)
+	}
+	agentSide, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agentSide.Close()
+
+	s := memorySFTP(t, "/")
+	s.agent = conn
+	s.Close()
+	agentSide.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := agentSide.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected Close to close the agent's connection, got %v", err)
+	}
+}
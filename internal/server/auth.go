@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Any client of the service can read every device of the machine, so it
+// listens on the loopback interface unless told otherwise, and only serves
+// other machines over TLS to clients that authenticate: with the bearer
+// token in TokenEnv, to gRPC and HTTP alike, or a certificate signed by the
+// CA recover serve is given with -tls-client-ca.
+
+// TokenEnv is the environment variable the token clients must give is read
+// from
+const TokenEnv = "RECOVER_SERVE_TOKEN"
+
+// tokenCookie holds the token of a browser, which cannot give it in a
+// header when it loads an image or a download
+const tokenCookie = "recover_token"
+
+// Listen listens on addr, on the loopback interface when it names no host,
+// as ":9000" does. An address other machines can reach is refused unless
+// secure: served over TLS to clients that must authenticate.
+func Listen(addr string, secure bool) (net.Listener, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		addr = net.JoinHostPort("127.0.0.1", port)
+	} else if !secure && !loopback(host) {
+		return nil, fmt.Errorf("%s can be reached from other machines: serve it with -tls-cert and -tls-key, to clients that give the token in $%s or a certificate signed by -tls-client-ca", addr, TokenEnv)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// loopback reports whether a host is only reachable from this machine
+func loopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// validToken reports whether an Authorization header gives token, in a
+// time that does not tell how much of it matched
+func validToken(header, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(header), []byte("Bearer "+token)) == 1
+}
+
+// GRPCToken returns the options that make a gRPC server refuse, as
+// Unauthenticated, calls whose authorization metadata is not
+// "Bearer <token>", as rpc.Token sends it
+func GRPCToken(token string) []grpc.ServerOption {
+	check := func(ctx context.Context) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, v := range md.Get("authorization") {
+			if validToken(v, token) {
+				return nil
+			}
+		}
+		return status.Error(codes.Unauthenticated, "missing or wrong token")
+	}
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := check(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := check(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+}
+
+// RequireToken returns h, answering 401 to requests that do not give token
+// as "Authorization: Bearer <token>". A browser logs in by opening a page
+// with ?token=<token>, which is kept in a cookie only this site is sent,
+// and sends it from then on. With no token, h is returned as it is.
+func RequireToken(token string, h http.Handler) http.Handler {
+	if token == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if validToken(r.Header.Get("Authorization"), token) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if c, err := r.Cookie(tokenCookie); err == nil && validToken("Bearer "+c.Value, token) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		q := r.URL.Query()
+		if r.Method == http.MethodGet && q.Has("token") && validToken("Bearer "+q.Get("token"), token) {
+			http.SetCookie(w, &http.Cookie{
+				Name:     tokenCookie,
+				Value:    q.Get("token"),
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+			// Off the address bar and the history
+			q.Del("token")
+			u := *r.URL
+			u.RawQuery = q.Encode()
+			http.Redirect(w, r, u.RequestURI(), http.StatusSeeOther)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, errors.New("missing or wrong token"))
+	})
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/shubham/recovery/pkg/rpc"
+)
+
+func TestListen(t *testing.T) {
+	lis, err := Listen(":0", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := lis.Addr().(*net.TCPAddr).IP
+	lis.Close()
+	if !ip.IsLoopback() {
+		t.Errorf("Expected an address with no host to be served on the loopback interface, got %v", ip)
+	}
+
+	for _, addr := range []string{"127.0.0.1:0", "localhost:0"} {
+		lis, err := Listen(addr, false)
+		if err != nil {
+			t.Errorf("Expected %s to be served, got %v", addr, err)
+			continue
+		}
+		lis.Close()
+	}
+	for _, addr := range []string{"0.0.0.0:0", "[::]:0", "192.0.2.1:0", "lab-3:0"} {
+		if _, err := Listen(addr, false); err == nil || !strings.Contains(err.Error(), TokenEnv) {
+			t.Errorf("Expected %s to be refused without authentication, got %v", addr, err)
+		}
+	}
+	lis, err = Listen("0.0.0.0:0", true)
+	if err != nil {
+		t.Fatalf("Expected every interface to be served with authentication, got %v", err)
+	}
+	lis.Close()
+}
+
+func TestGRPCToken(t *testing.T) {
+	m := NewManager(t.TempDir())
+	defer m.Close()
+	lis := bufconn.Listen(1 << 20)
+	srv := NewGRPC(m, GRPCToken("s3cret")...)
+	go srv.Serve(lis)
+	defer srv.Stop()
+	dial := func(opts ...grpc.DialOption) rpc.RecoveryClient {
+		opts = append(opts,
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+			grpc.WithTransportCredentials(insecure.NewCredentials()))
+		conn, err := grpc.NewClient("passthrough:///bufnet", opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return rpc.NewRecoveryClient(conn)
+	}
+	ctx := context.Background()
+
+	for name, client := range map[string]rpc.RecoveryClient{
+		"no token":    dial(),
+		"wrong token": dial(grpc.WithPerRPCCredentials(rpc.Token{Value: "guess", Insecure: true})),
+	} {
+		if _, err := client.ListJobs(ctx, &rpc.ListJobsRequest{}); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("%s: expected Unauthenticated, got %v", name, err)
+		}
+		stream, err := client.WatchJob(ctx, &rpc.WatchJobRequest{Id: "1"})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("%s: expected the stream to be Unauthenticated, got %v", name, err)
+		}
+	}
+
+	client := dial(grpc.WithPerRPCCredentials(rpc.Token{Value: "s3cret", Insecure: true}))
+	if _, err := client.ListJobs(ctx, &rpc.ListJobsRequest{}); err != nil {
+		t.Errorf("Expected the token to be accepted, got %v", err)
+	}
+	if _, err := client.GetJob(ctx, &rpc.GetJobRequest{Id: "1"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound past the token, got %v", err)
+	}
+
+	// The token is only sent in the clear when a client allows it
+	_, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(rpc.Token{Value: "s3cret"}))
+	if err == nil {
+		t.Error("Expected the token to be withheld from a connection without TLS")
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	m := NewManager(t.TempDir())
+	defer m.Close()
+	srv := httptest.NewServer(RequireToken("s3cret", NewWebHandler(m)))
+	defer srv.Close()
+
+	get := func(client *http.Client, path, auth string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("GET", srv.URL+path, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	for _, auth := range []string{"", "Bearer guess", "s3cret", "Basic s3cret"} {
+		if resp := get(http.DefaultClient, "/api/v1/jobs", auth); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%q: expected 401, got %d", auth, resp.StatusCode)
+		}
+	}
+	if resp := get(http.DefaultClient, "/api/v1/jobs", "Bearer s3cret"); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the token to be accepted, got %d", resp.StatusCode)
+	}
+	if resp := get(http.DefaultClient, "/?token=guess", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong token in the address to be refused, got %d", resp.StatusCode)
+	}
+
+	// A browser logs in once, and is sent on without the token
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{Jar: jar}
+	resp := get(browser, "/?token=s3cret&tab=files", "")
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.RequestURI() != "/?tab=files" {
+		t.Fatalf("Expected to land on /?tab=files, got %d at %s", resp.StatusCode, resp.Request.URL)
+	}
+	if resp := get(browser, "/api/v1/jobs", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the cookie to be accepted, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	devices "github.com/shubham/recovery/internal/device"
+	"github.com/shubham/recovery/pkg/recovery"
+	"github.com/shubham/recovery/pkg/rpc"
+)
+
+// defaultPageSize is the number of files ListFiles returns when not asked
+// for another
+const defaultPageSize = 1000
+
+// NewGRPC returns a gRPC server of the Recovery service of package rpc,
+// running its jobs with m
+func NewGRPC(m *Manager, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(opts...)
+	rpc.RegisterRecoveryServer(s, &grpcService{m: m})
+	return s
+}
+
+type grpcService struct {
+	rpc.UnimplementedRecoveryServer
+	m *Manager
+}
+
+func (s *grpcService) ListDevices(ctx context.Context, req *rpc.ListDevicesRequest) (*rpc.ListDevicesResponse, error) {
+	list, err := devices.List()
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	resp := &rpc.ListDevicesResponse{}
+	for _, d := range list {
+		resp.Devices = append(resp.Devices, &rpc.Device{
+			Path:       d.Path,
+			Name:       d.Name,
+			Size:       d.Size,
+			Filesystem: d.Filesystem,
+			Mountpoint: d.Mountpoint,
+			Removable:  d.Removable,
+		})
+	}
+	return resp, nil
+}
+
+func (s *grpcService) StartScan(ctx context.Context, req *rpc.StartScanRequest) (*rpc.Job, error) {
+	if req.Device == "" {
+		return nil, status.Error(codes.InvalidArgument, "no device")
+	}
+	job, err := s.m.StartScan(req.Device)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return jobProto(job), nil
+}
+
+func (s *grpcService) RecoverFiles(ctx context.Context, req *rpc.RecoverFilesRequest) (*rpc.Job, error) {
+	ids := make([]int, len(req.FileIds))
+	for i, id := range req.FileIds {
+		ids[i] = int(id)
+	}
+	job, err := s.m.StartRecover(req.ScanId, ids, req.Output)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return jobProto(job), nil
+}
+
+func (s *grpcService) GetJob(ctx context.Context, req *rpc.GetJobRequest) (*rpc.Job, error) {
+	job, err := s.m.Job(req.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return jobProto(job), nil
+}
+
+func (s *grpcService) ListJobs(ctx context.Context, req *rpc.ListJobsRequest) (*rpc.ListJobsResponse, error) {
+	resp := &rpc.ListJobsResponse{}
+	for _, job := range s.m.Jobs() {
+		resp.Jobs = append(resp.Jobs, jobProto(job))
+	}
+	return resp, nil
+}
+
+func (s *grpcService) WatchJob(req *rpc.WatchJobRequest, stream rpc.Recovery_WatchJobServer) error {
+	events, stop, err := s.m.Watch(req.Id)
+	if err != nil {
+		return grpcError(err)
+	}
+	defer stop()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				// The job ended; its final state may have been dropped
+				job, err := s.m.Job(req.Id)
+				if err != nil {
+					return grpcError(err)
+				}
+				return stream.Send(&rpc.JobEvent{Job: jobProto(job)})
+			}
+			if err := stream.Send(&rpc.JobEvent{Job: jobProto(e.Job), Message: e.Message}); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+func (s *grpcService) CancelJob(ctx context.Context, req *rpc.CancelJobRequest) (*rpc.Job, error) {
+	job, err := s.m.Cancel(req.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return jobProto(job), nil
+}
+
+func (s *grpcService) ListFiles(ctx context.Context, req *rpc.ListFilesRequest) (*rpc.ListFilesResponse, error) {
+	files, err := s.m.Files(req.ScanId)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	files = FileFilter{Deleted: req.DeletedOnly}.Filter(files)
+	start := 0
+	if req.PageToken != "" {
+		if start, err = strconv.Atoi(req.PageToken); err != nil || start < 0 || start > len(files) {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+	}
+	size := int(req.PageSize)
+	if size <= 0 {
+		size = defaultPageSize
+	}
+	end := min(start+size, len(files))
+
+	resp := &rpc.ListFilesResponse{Total: int64(len(files))}
+	for _, f := range files[start:end] {
+		resp.Files = append(resp.Files, fileProto(f))
+	}
+	if end < len(files) {
+		resp.NextPageToken = strconv.Itoa(end)
+	}
+	return resp, nil
+}
+
+// grpcError gives an error of the manager its gRPC status
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrNoJob):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrNotScan), errors.Is(err, ErrInvalid):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrScanNotDone), errors.Is(err, ErrNotDone), errors.Is(err, ErrInUse):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, os.ErrNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, os.ErrPermission):
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func jobProto(j Job) *rpc.Job {
+	return &rpc.Job{
+		Id:     j.ID,
+		Kind:   j.Kind,
+		State:  j.State,
+		Error:  j.Error,
+		Device: j.Device,
+		ScanId: j.Scan,
+		Output: j.Output,
+		Progress: &rpc.Progress{
+			Phase: j.Progress.Phase,
+			Done:  j.Progress.Scanned,
+			Total: j.Progress.Total,
+			Found: j.Progress.Found,
+			Item:  j.Progress.Item,
+		},
+		Files:     int64(j.Files),
+		Deleted:   int64(j.Deleted),
+		Recovered: int64(j.Recovered),
+		Failed:    int64(j.Failed),
+		Created:   timestamp(j.Created),
+		Started:   timestamp(j.Started),
+		Finished:  timestamp(j.Finished),
+	}
+}
+
+func fileProto(f recovery.File) *rpc.File {
+	p := &rpc.File{
+		Id:          int64(f.ID),
+		Volume:      f.Volume,
+		Filesystem:  f.Filesystem,
+		Path:        f.Path,
+		Dir:         f.Dir,
+		Deleted:     f.Deleted,
+		Size:        f.Size,
+		Inode:       f.Inode,
+		Created:     timestamp(f.Created),
+		Modified:    timestamp(f.Modified),
+		Changed:     timestamp(f.Changed),
+		Accessed:    timestamp(f.Accessed),
+		Recoverable: f.Recoverable,
+	}
+	for _, e := range f.Extents {
+		p.Extents = append(p.Extents, &rpc.Extent{Offset: e.Offset, Length: e.Length})
+	}
+	return p
+}
+
+// timestamp converts a time, leaving the zero time unset
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
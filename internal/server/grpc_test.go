@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/shubham/recovery/pkg/rpc"
+)
+
+func TestGRPC(t *testing.T) {
+	m := NewManager(t.TempDir())
+	defer m.Close()
+	lis := bufconn.Listen(1 << 20)
+	srv := NewGRPC(m)
+	go srv.Serve(lis)
+	defer srv.Stop()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := rpc.NewRecoveryClient(conn)
+	ctx := context.Background()
+
+	scan, err := client.StartScan(ctx, &rpc.StartScanRequest{Device: writeImage(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.WatchJob(ctx, &rpc.WatchJobRequest{Id: scan.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last *rpc.JobEvent
+	for {
+		e, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = e
+	}
+	if last == nil || last.Job.State != StateCompleted || last.Job.Deleted != 1 || last.Job.Finished == nil {
+		t.Fatalf("Expected the watch to end with the completed scan, got %v", last)
+	}
+
+	page, err := client.ListFiles(ctx, &rpc.ListFilesRequest{ScanId: scan.Id, DeletedOnly: true, PageSize: 10})
+	if err != nil || page.Total != 1 || len(page.Files) != 1 || page.NextPageToken != "" {
+		t.Fatalf("Expected one page of one deleted file, got %v (%v)", page, err)
+	}
+	if f := page.Files[0]; f.Path != "?OTES.TXT" || f.Size != int64(len(notes)) || len(f.Extents) != 1 {
+		t.Errorf("Unexpected file %v", f)
+	}
+
+	rec, err := client.RecoverFiles(ctx, &rpc.RecoverFilesRequest{ScanId: scan.Id, FileIds: []int64{page.Files[0].Id}, Output: "case-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, m, rec.Id)
+	rec, err = client.GetJob(ctx, &rpc.GetJobRequest{Id: rec.Id})
+	if err != nil || rec.State != StateCompleted || rec.Recovered != 1 || rec.ScanId != scan.Id {
+		t.Errorf("Expected a completed recovery of one file, got %v (%v)", rec, err)
+	}
+
+	_, err = client.GetJob(ctx, &rpc.GetJobRequest{Id: "99"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+	_, err = client.ListFiles(ctx, &rpc.ListFilesRequest{ScanId: rec.Id})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for the files of a recovery, got %v", err)
+	}
+}
@@ -0,0 +1,531 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	devices "github.com/shubham/recovery/internal/device"
+	"github.com/shubham/recovery/pkg/recovery"
+)
+
+// The HTTP API answers with JSON, and takes it, as application/json, in the
+// bodies of POSTs:
+//
+//	GET  /api/v1/devices                 storage devices of the machine
+//	POST /api/v1/scans                   {"device": "/dev/sdb"}: start a scan
+//	GET  /api/v1/jobs                    every job
+//	GET  /api/v1/jobs/{id}               a job, to poll
+//	POST /api/v1/jobs/{id}/cancel        stop a job, keeping what it wrote
+//	DELETE /api/v1/jobs/{id}             forget a job that has ended, closing a scan's source
+//	GET  /api/v1/jobs/{id}/files         files of a scan, a page at a time
+//	GET  /api/v1/jobs/{id}/files/{file}/content   data of a file of a scan, to preview or download
+//	POST /api/v1/jobs/{id}/recover       {"ids": [3, 8], "output": "case-1"}: recover files of a scan
+//	GET  /api/v1/jobs/{id}/report        files of a scan or results of a recovery, as JSON or ?format=csv
+//
+// Files are filtered with deleted=true, path=<glob>, recoverable=complete,
+// min_size and max_size, and paged with offset and limit (1000 by default).
+// An error is answered as {"error": "..."} with its status. A request that
+// changes anything is refused with 403 when a browser says another site
+// made it, so that no page can drive the service through a browser that
+// can reach it.
+
+// NewHandler returns the HTTP API, running its jobs with m
+func NewHandler(m *Manager) http.Handler {
+	h := &httpAPI{m: m}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/devices", h.devices)
+	mux.HandleFunc("POST /api/v1/scans", h.startScan)
+	mux.HandleFunc("GET /api/v1/jobs", h.jobs)
+	mux.HandleFunc("GET /api/v1/jobs/{id}", h.job)
+	mux.HandleFunc("POST /api/v1/jobs/{id}/cancel", h.cancel)
+	mux.HandleFunc("DELETE /api/v1/jobs/{id}", h.remove)
+	mux.HandleFunc("GET /api/v1/jobs/{id}/files", h.files)
+	mux.HandleFunc("GET /api/v1/jobs/{id}/files/{file}/content", h.content)
+	mux.HandleFunc("POST /api/v1/jobs/{id}/recover", h.recover)
+	mux.HandleFunc("GET /api/v1/jobs/{id}/report", h.report)
+	return sameOrigin(mux)
+}
+
+// sameOrigin refuses the requests of other sites that would change
+// anything: those a browser marks with a Sec-Fetch-Site other than
+// same-origin, or with an Origin whose host is not the one asked.
+// Clients other than browsers send neither, and are let through.
+func sameOrigin(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			h.ServeHTTP(w, r)
+			return
+		}
+		cross := false
+		if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+			cross = site != "same-origin" && site != "none"
+		} else if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			cross = err != nil || u.Host != r.Host
+		}
+		if cross {
+			writeError(w, http.StatusForbidden, errors.New("cross-origin request refused"))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+type httpAPI struct {
+	m *Manager
+}
+
+// jobJSON is the form of a Job the HTTP API gives
+type jobJSON struct {
+	ID        string       `json:"id"`
+	Kind      string       `json:"kind"`
+	State     string       `json:"state"`
+	Error     string       `json:"error,omitempty"`
+	Device    string       `json:"device"`
+	Scan      string       `json:"scan,omitempty"`
+	Output    string       `json:"output,omitempty"`
+	Progress  progressJSON `json:"progress"`
+	Files     int          `json:"files"`
+	Deleted   int          `json:"deleted,omitempty"`
+	Recovered int          `json:"recovered,omitempty"`
+	Failed    int          `json:"failed,omitempty"`
+	Created   time.Time    `json:"created"`
+	Started   *time.Time   `json:"started,omitempty"`
+	Finished  *time.Time   `json:"finished,omitempty"`
+}
+
+type progressJSON struct {
+	Phase string `json:"phase,omitempty"`
+	Done  int64  `json:"done"`
+	Total int64  `json:"total"`
+	Found int64  `json:"found"`
+	Item  string `json:"item,omitempty"`
+}
+
+func toJobJSON(j Job) jobJSON {
+	return jobJSON{
+		ID:        j.ID,
+		Kind:      j.Kind,
+		State:     j.State,
+		Error:     j.Error,
+		Device:    j.Device,
+		Scan:      j.Scan,
+		Output:    j.Output,
+		Progress:  progressJSON{Phase: j.Progress.Phase, Done: j.Progress.Scanned, Total: j.Progress.Total, Found: j.Progress.Found, Item: j.Progress.Item},
+		Files:     j.Files,
+		Deleted:   j.Deleted,
+		Recovered: j.Recovered,
+		Failed:    j.Failed,
+		Created:   j.Created,
+		Started:   optionalTime(j.Started),
+		Finished:  optionalTime(j.Finished),
+	}
+}
+
+type extentJSON struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// fileJSON is the form of a recovery.File the HTTP API gives
+type fileJSON struct {
+	ID          int          `json:"id"`
+	Volume      string       `json:"volume"`
+	Filesystem  string       `json:"filesystem"`
+	Path        string       `json:"path"`
+	Dir         bool         `json:"dir,omitempty"`
+	Deleted     bool         `json:"deleted"`
+	Size        int64        `json:"size"`
+	Inode       uint64       `json:"inode,omitempty"`
+	Created     *time.Time   `json:"created,omitempty"`
+	Modified    *time.Time   `json:"modified,omitempty"`
+	Changed     *time.Time   `json:"changed,omitempty"`
+	Accessed    *time.Time   `json:"accessed,omitempty"`
+	Extents     []extentJSON `json:"extents,omitempty"`
+	Recoverable string       `json:"recoverable,omitempty"`
+}
+
+func toFileJSON(f recovery.File) fileJSON {
+	fj := fileJSON{
+		ID:          f.ID,
+		Volume:      f.Volume,
+		Filesystem:  f.Filesystem,
+		Path:        f.Path,
+		Dir:         f.Dir,
+		Deleted:     f.Deleted,
+		Size:        f.Size,
+		Inode:       f.Inode,
+		Created:     optionalTime(f.Created),
+		Modified:    optionalTime(f.Modified),
+		Changed:     optionalTime(f.Changed),
+		Accessed:    optionalTime(f.Accessed),
+		Recoverable: f.Recoverable,
+	}
+	for _, e := range f.Extents {
+		fj.Extents = append(fj.Extents, extentJSON{Offset: e.Offset, Length: e.Length})
+	}
+	return fj
+}
+
+// resultJSON is the form of a recovery.Result the HTTP API gives
+type resultJSON struct {
+	ID     int    `json:"id"`
+	File   string `json:"file"` // Path in its volume
+	Path   string `json:"path,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	MD5    string `json:"md5,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func toResultJSON(r recovery.Result) resultJSON {
+	rj := resultJSON{ID: r.File.ID, File: r.File.Path, Path: r.Path, Size: r.Size, MD5: r.MD5, SHA256: r.SHA256}
+	if r.Err != nil {
+		rj.Error = r.Err.Error()
+	}
+	return rj
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (h *httpAPI) devices(w http.ResponseWriter, r *http.Request) {
+	list, err := devices.List()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	type deviceJSON struct {
+		Path       string `json:"path"`
+		Name       string `json:"name"`
+		Size       int64  `json:"size"`
+		Filesystem string `json:"filesystem,omitempty"`
+		Mountpoint string `json:"mountpoint,omitempty"`
+		Removable  bool   `json:"removable"`
+	}
+	out := []deviceJSON{}
+	for _, d := range list {
+		out = append(out, deviceJSON{d.Path, d.Name, d.Size, d.Filesystem, d.Mountpoint, d.Removable})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"devices": out})
+}
+
+func (h *httpAPI) startScan(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Device string `json:"device"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Device == "" {
+		writeError(w, http.StatusBadRequest, errors.New("no device"))
+		return
+	}
+	job, err := h.m.StartScan(req.Device)
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	writeJob(w, http.StatusAccepted, job)
+}
+
+func (h *httpAPI) jobs(w http.ResponseWriter, r *http.Request) {
+	out := []jobJSON{}
+	for _, job := range h.m.Jobs() {
+		out = append(out, toJobJSON(job))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"jobs": out})
+}
+
+func (h *httpAPI) job(w http.ResponseWriter, r *http.Request) {
+	job, err := h.m.Job(r.PathValue("id"))
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	writeJob(w, http.StatusOK, job)
+}
+
+func (h *httpAPI) cancel(w http.ResponseWriter, r *http.Request) {
+	job, err := h.m.Cancel(r.PathValue("id"))
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	writeJob(w, http.StatusOK, job)
+}
+
+func (h *httpAPI) remove(w http.ResponseWriter, r *http.Request) {
+	job, err := h.m.Remove(r.PathValue("id"))
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	writeJob(w, http.StatusOK, job)
+}
+
+func (h *httpAPI) files(w http.ResponseWriter, r *http.Request) {
+	files, err := h.m.Files(r.PathValue("id"))
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	q := r.URL.Query()
+	filter, err := parseFilter(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	offset, err := queryInt(q.Get("offset"), 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("offset: %w", err))
+		return
+	}
+	limit, err := queryInt(q.Get("limit"), defaultPageSize)
+	if err != nil || limit <= 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("limit must be a positive number"))
+		return
+	}
+
+	files = filter.Filter(files)
+	start := min(int(offset), len(files))
+	end := min(start+int(limit), len(files))
+	page := struct {
+		Files  []fileJSON `json:"files"`
+		Total  int        `json:"total"`
+		Offset int        `json:"offset"`
+		Next   *int       `json:"next"` // Offset of the next page; null after the last
+	}{Files: []fileJSON{}, Total: len(files), Offset: start}
+	for _, f := range files[start:end] {
+		page.Files = append(page.Files, toFileJSON(f))
+	}
+	if end < len(files) {
+		page.Next = &end
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// previewTypes are the content types a file is shown as in the browser; it
+// is downloaded as anything else, since HTML or a script from the source
+// must not run with the API's origin
+var previewTypes = map[string]string{
+	".jpg": "image/jpeg", ".jpeg": "image/jpeg", ".png": "image/png", ".gif": "image/gif",
+	".bmp": "image/bmp", ".webp": "image/webp", ".txt": "text/plain; charset=utf-8",
+	".log": "text/plain; charset=utf-8", ".csv": "text/plain; charset=utf-8", ".pdf": "application/pdf",
+}
+
+func (h *httpAPI) content(w http.ResponseWriter, r *http.Request) {
+	fileID, err := strconv.Atoi(r.PathValue("file"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid file id %q", r.PathValue("file")))
+		return
+	}
+	f, data, err := h.m.Open(r.Context(), r.PathValue("id"), fileID)
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	defer data.Close()
+	name := path.Base(f.Path)
+	contentType, preview := previewTypes[strings.ToLower(path.Ext(name))]
+	disposition := "inline"
+	if !preview || r.URL.Query().Get("download") != "" {
+		contentType, disposition = "application/octet-stream", "attachment"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": name}))
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	io.Copy(w, data)
+}
+
+func (h *httpAPI) recover(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs    []int  `json:"ids"`
+		Output string `json:"output"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if len(req.IDs) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("no file ids"))
+		return
+	}
+	job, err := h.m.StartRecover(r.PathValue("id"), req.IDs, req.Output)
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	writeJob(w, http.StatusAccepted, job)
+}
+
+func (h *httpAPI) report(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	job, err := h.m.Job(id)
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown report format %q (want json or csv)", format))
+		return
+	}
+
+	var header []string
+	var rows [][]string
+	var body any
+	switch job.Kind {
+	case KindScan:
+		files, err := h.m.Files(id)
+		if err != nil {
+			writeManagerError(w, err)
+			return
+		}
+		out := make([]fileJSON, len(files))
+		header = []string{"id", "volume", "filesystem", "path", "dir", "deleted", "size", "inode", "modified", "recoverable"}
+		for i, f := range files {
+			out[i] = toFileJSON(f)
+			rows = append(rows, []string{
+				strconv.Itoa(f.ID), f.Volume, f.Filesystem, f.Path, strconv.FormatBool(f.Dir), strconv.FormatBool(f.Deleted),
+				strconv.FormatInt(f.Size, 10), strconv.FormatUint(f.Inode, 10), csvTime(f.Modified), f.Recoverable,
+			})
+		}
+		body = map[string]any{"job": toJobJSON(job), "files": out}
+	default:
+		results, err := h.m.Results(id)
+		if err != nil {
+			writeManagerError(w, err)
+			return
+		}
+		out := make([]resultJSON, len(results))
+		header = []string{"id", "file", "path", "size", "md5", "sha256", "error"}
+		for i, res := range results {
+			rj := toResultJSON(res)
+			out[i] = rj
+			rows = append(rows, []string{strconv.Itoa(rj.ID), rj.File, rj.Path, strconv.FormatInt(rj.Size, 10), rj.MD5, rj.SHA256, rj.Error})
+		}
+		body = map[string]any{"job": toJobJSON(job), "results": out}
+	}
+
+	name := fmt.Sprintf("%s-%s", job.Kind, job.ID)
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, name))
+		cw := csv.NewWriter(w)
+		cw.Write(header)
+		cw.WriteAll(rows)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, name))
+	writeJSON(w, http.StatusOK, body)
+}
+
+// parseFilter reads a FileFilter from the query of a files request
+func parseFilter(q url.Values) (FileFilter, error) {
+	get := q.Get
+	var ff FileFilter
+	var err error
+	if v := get("deleted"); v != "" {
+		if ff.Deleted, err = strconv.ParseBool(v); err != nil {
+			return ff, fmt.Errorf("deleted: %w", err)
+		}
+	}
+	ff.Path = get("path")
+	if _, err := path.Match(ff.Path, ""); err != nil {
+		return ff, fmt.Errorf("path: %w", err)
+	}
+	ff.Recoverable = get("recoverable")
+	if ff.MinSize, err = queryInt(get("min_size"), 0); err != nil {
+		return ff, fmt.Errorf("min_size: %w", err)
+	}
+	if ff.MaxSize, err = queryInt(get("max_size"), 0); err != nil {
+		return ff, fmt.Errorf("max_size: %w", err)
+	}
+	return ff, nil
+}
+
+// queryInt parses a non-negative number of a query, or returns def for ""
+func queryInt(v string, def int64) (int64, error) {
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a number of zero or more", v)
+	}
+	return n, nil
+}
+
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// maxRequestBody bounds the JSON of a request
+const maxRequestBody = 1 << 20
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	// A form a browser may post from any site is not taken for JSON
+	if t, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); t != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, errors.New("the request body must be application/json"))
+		return false
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeJob(w http.ResponseWriter, status int, job Job) {
+	writeJSON(w, status, toJobJSON(job))
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// writeManagerError answers an error of the manager with its status
+func writeManagerError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrNoJob), errors.Is(err, ErrNoFile), errors.Is(err, os.ErrNotExist):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrNotScan), errors.Is(err, ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrScanNotDone), errors.Is(err, ErrNotDone), errors.Is(err, ErrInUse):
+		status = http.StatusConflict
+	case errors.Is(err, os.ErrPermission):
+		status = http.StatusForbidden
+	}
+	writeError(w, status, err)
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk/disktest"
+)
+
+func TestHTTP(t *testing.T) {
+	m := NewManager(t.TempDir())
+	defer m.Close()
+	srv := httptest.NewServer(NewHandler(m))
+	defer srv.Close()
+
+	do := func(method, path, body string, want int, v any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != want {
+			var e struct{ Error string }
+			json.NewDecoder(resp.Body).Decode(&e)
+			t.Fatalf("%s %s: expected %d, got %d (%s)", method, path, want, resp.StatusCode, e.Error)
+		}
+		if v != nil {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatalf("%s %s: %v", method, path, err)
+			}
+		}
+	}
+
+	var scan jobJSON
+	body, _ := json.Marshal(map[string]string{"device": writeImage(t)})
+	do("POST", "/api/v1/scans", string(body), http.StatusAccepted, &scan)
+	wait(t, m, scan.ID)
+	do("GET", "/api/v1/jobs/"+scan.ID, "", http.StatusOK, &scan)
+	if scan.State != StateCompleted || scan.Deleted != 1 || scan.Finished == nil {
+		t.Fatalf("Expected a completed scan, got %+v", scan)
+	}
+
+	var page struct {
+		Files []fileJSON
+		Total int
+		Next  *int
+	}
+	do("GET", "/api/v1/jobs/"+scan.ID+"/files?deleted=true&path=*.TXT&limit=5", "", http.StatusOK, &page)
+	if page.Total != 1 || len(page.Files) != 1 || page.Next != nil || page.Files[0].Path != "?OTES.TXT" {
+		t.Fatalf("Expected one page of one file, got %+v", page)
+	}
+	do("GET", "/api/v1/jobs/"+scan.ID+"/files?min_size=100000", "", http.StatusOK, &page)
+	if page.Total != 0 || page.Files == nil {
+		t.Errorf("Expected an empty list of files over 100000 bytes, got %+v", page)
+	}
+	do("GET", "/api/v1/jobs/"+scan.ID+"/files?path=[", "", http.StatusBadRequest, nil)
+
+	var rec jobJSON
+	notesID := strconv.Itoa(disktest.NotesID)
+	do("POST", "/api/v1/jobs/"+scan.ID+"/recover", `{"ids": [`+notesID+`], "output": "case-1"}`, http.StatusAccepted, &rec)
+	wait(t, m, rec.ID)
+	var report struct {
+		Job     jobJSON
+		Results []resultJSON
+	}
+	do("GET", "/api/v1/jobs/"+rec.ID+"/report", "", http.StatusOK, &report)
+	if report.Job.Recovered != 1 || len(report.Results) != 1 || report.Results[0].Path != "_OTES.TXT" || report.Results[0].SHA256 == "" {
+		t.Errorf("Unexpected recovery report %+v", report)
+	}
+
+	resp, err := http.Get(srv.URL + "/api/v1/jobs/" + scan.ID + "/report?format=csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	resp.Body.Close()
+	if err != nil || len(rows) != 2 || rows[0][0] != "id" || rows[1][3] != "?OTES.TXT" {
+		t.Errorf("Unexpected CSV report %v (%v)", rows, err)
+	}
+
+	resp, err = http.Get(srv.URL + "/api/v1/jobs/" + scan.ID + "/files/" + notesID + "/content")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(data) != string(notes) || resp.Header.Get("Content-Type") != "text/plain; charset=utf-8" ||
+		resp.Header.Get("Content-Disposition") != `inline; filename="?OTES.TXT"` {
+		t.Errorf("Unexpected content %q with headers %v", data, resp.Header)
+	}
+	do("GET", "/api/v1/jobs/"+scan.ID+"/files/99/content", "", http.StatusNotFound, nil)
+
+	do("GET", "/api/v1/jobs/99", "", http.StatusNotFound, nil)
+	do("GET", "/api/v1/jobs/"+rec.ID+"/files", "", http.StatusBadRequest, nil)
+	do("POST", "/api/v1/jobs/"+scan.ID+"/recover", `{"ids": [`+notesID+`], "output": "/etc"}`, http.StatusBadRequest, nil)
+	do("POST", "/api/v1/scans", `{"device": 1}`, http.StatusBadRequest, nil)
+
+	// A form, as any site can make a browser post, is not taken for JSON
+	resp, err = http.Post(srv.URL+"/api/v1/scans", "text/plain", strings.NewReader(`{"device": "/dev/sda"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for a body that is not JSON, got %d", resp.StatusCode)
+	}
+
+	var jobs struct{ Jobs []jobJSON }
+	do("GET", "/api/v1/jobs", "", http.StatusOK, &jobs)
+	if len(jobs.Jobs) != 2 {
+		t.Errorf("Expected two jobs, got %+v", jobs)
+	}
+
+	do("DELETE", "/api/v1/jobs/"+scan.ID, "", http.StatusOK, &scan)
+	do("GET", "/api/v1/jobs/"+scan.ID, "", http.StatusNotFound, nil)
+	do("DELETE", "/api/v1/jobs/"+scan.ID, "", http.StatusNotFound, nil)
+}
+
+func TestSameOrigin(t *testing.T) {
+	m := NewManager(t.TempDir())
+	defer m.Close()
+	srv := httptest.NewServer(NewHandler(m))
+	defer srv.Close()
+	scan, err := m.StartScan(writeImage(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, m, scan.ID)
+
+	for _, c := range []struct {
+		method, path string
+		header       map[string]string
+		want         int
+	}{
+		{"POST", "/jobs/" + scan.ID + "/cancel", map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"POST", "/jobs/" + scan.ID + "/cancel", map[string]string{"Sec-Fetch-Site": "same-site"}, http.StatusForbidden},
+		{"POST", "/jobs/" + scan.ID + "/cancel", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"DELETE", "/jobs/" + scan.ID, map[string]string{"Origin": "http://localhost.evil.example"}, http.StatusForbidden},
+		{"GET", "/jobs/" + scan.ID, map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusOK},
+		{"POST", "/jobs/" + scan.ID + "/cancel", map[string]string{"Sec-Fetch-Site": "same-origin"}, http.StatusOK},
+		{"POST", "/jobs/" + scan.ID + "/cancel", map[string]string{"Origin": srv.URL}, http.StatusOK},
+		{"POST", "/jobs/" + scan.ID + "/cancel", nil, http.StatusOK},
+	} {
+		req, _ := http.NewRequest(c.method, srv.URL+"/api/v1"+c.path, nil)
+		for k, v := range c.header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.want {
+			t.Errorf("%s %s with %v: expected %d, got %d", c.method, c.path, c.header, c.want, resp.StatusCode)
+		}
+	}
+	if _, err := m.Job(scan.ID); err != nil {
+		t.Errorf("Expected the scan kept from the other site, got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// The metrics are read from the manager's jobs when Prometheus scrapes
+// them, so they need no bookkeeping as the jobs run. A job stalled on a
+// failing drive is told by recover_job_last_progress_timestamp_seconds:
+//
+//	time() - recover_job_last_progress_timestamp_seconds > 600
+
+var (
+	descBytesRead = prometheus.NewDesc("recover_read_bytes_total",
+		"Bytes read from the devices scanned, by device.", []string{"device"}, nil)
+	descReadErrors = prometheus.NewDesc("recover_read_errors_total",
+		"Reads of the devices scanned that failed, by device.", []string{"device"}, nil)
+	descFilesFound = prometheus.NewDesc("recover_files_found_total",
+		"Files and directories listed by the scans that completed.", nil, nil)
+	descDeletedFound = prometheus.NewDesc("recover_deleted_files_found_total",
+		"Deleted files and directories listed by the scans that completed.", nil, nil)
+	descRecovered = prometheus.NewDesc("recover_files_recovered_total",
+		"Files recovered by the recoveries that ended.", nil, nil)
+	descRecoverFailed = prometheus.NewDesc("recover_files_failed_total",
+		"Files the recoveries that ended could not recover.", nil, nil)
+	descJobs = prometheus.NewDesc("recover_jobs",
+		"Jobs, by kind and state.", []string{"kind", "state"}, nil)
+	descDuration = prometheus.NewDesc("recover_job_duration_seconds",
+		"How long the jobs that ended ran, by kind.", []string{"kind"}, nil)
+	descThroughput = prometheus.NewDesc("recover_job_read_bytes_per_second",
+		"Bytes a running job has read a second since it started.", []string{"job", "kind", "device"}, nil)
+	descProgressed = prometheus.NewDesc("recover_job_last_progress_timestamp_seconds",
+		"When the progress of a running job last moved, in seconds since the epoch.", []string{"job", "kind", "device"}, nil)
+)
+
+// durationBuckets are the bounds of recover_job_duration_seconds, from a
+// second to a day, as a scan of a large failing drive can take
+var durationBuckets = []float64{1, 10, 60, 300, 900, 1800, 3600, 3 * 3600, 6 * 3600, 12 * 3600, 24 * 3600}
+
+// metrics is the prometheus.Collector of a manager's jobs
+type metrics struct {
+	m *Manager
+}
+
+// Describe gives every metric, those of running jobs included, which a
+// scrape with none running would not collect
+func (c metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		descBytesRead, descReadErrors, descFilesFound, descDeletedFound, descRecovered,
+		descRecoverFailed, descJobs, descDuration, descThroughput, descProgressed,
+	} {
+		ch <- d
+	}
+}
+
+func (c metrics) Collect(ch chan<- prometheus.Metric) {
+	c.m.mu.Lock()
+	jobs := append([]*job(nil), c.m.jobs...)
+	c.m.mu.Unlock()
+
+	type count struct{ kind, state string }
+	counts := make(map[count]int)
+	for _, kind := range []string{KindScan, KindRecover} {
+		for _, state := range []string{StateQueued, StateRunning, StateCompleted, StateFailed, StateCanceled} {
+			counts[count{kind, state}] = 0
+		}
+	}
+	type stats struct{ bytes, errors int64 }
+	devices := make(map[string]stats)
+	var found, deleted, recovered, failed int
+	durations := map[string][]float64{KindScan: nil, KindRecover: nil}
+	now := time.Now()
+
+	for _, j := range jobs {
+		j.mu.Lock()
+		info, readFrom := j.info, j.readFrom
+		j.mu.Unlock()
+		counts[count{info.Kind, info.State}]++
+		if j.source != nil {
+			st := j.source.Stats()
+			d := devices[info.Device]
+			d.bytes += st.Bytes
+			d.errors += st.Errors
+			devices[info.Device] = d
+		}
+		switch {
+		case info.Kind == KindScan && info.State == StateCompleted:
+			found += info.Files
+			deleted += info.Deleted
+		case info.Kind == KindRecover && info.Done():
+			recovered += info.Recovered
+			failed += info.Failed
+		}
+		if info.Done() && !info.Started.IsZero() {
+			durations[info.Kind] = append(durations[info.Kind], info.Finished.Sub(info.Started).Seconds())
+		}
+		if info.State == StateRunning {
+			source := j.source
+			if source == nil {
+				scan, _ := c.m.get(info.Scan)
+				source = scan.source
+			}
+			elapsed := now.Sub(info.Started).Seconds()
+			if elapsed > 0 {
+				ch <- prometheus.MustNewConstMetric(descThroughput, prometheus.GaugeValue,
+					float64(source.Stats().Bytes-readFrom)/elapsed, info.ID, info.Kind, info.Device)
+			}
+			ch <- prometheus.MustNewConstMetric(descProgressed, prometheus.GaugeValue,
+				float64(info.Progressed.UnixNano())/1e9, info.ID, info.Kind, info.Device)
+		}
+	}
+
+	for device, d := range devices {
+		ch <- prometheus.MustNewConstMetric(descBytesRead, prometheus.CounterValue, float64(d.bytes), device)
+		ch <- prometheus.MustNewConstMetric(descReadErrors, prometheus.CounterValue, float64(d.errors), device)
+	}
+	ch <- prometheus.MustNewConstMetric(descFilesFound, prometheus.CounterValue, float64(found))
+	ch <- prometheus.MustNewConstMetric(descDeletedFound, prometheus.CounterValue, float64(deleted))
+	ch <- prometheus.MustNewConstMetric(descRecovered, prometheus.CounterValue, float64(recovered))
+	ch <- prometheus.MustNewConstMetric(descRecoverFailed, prometheus.CounterValue, float64(failed))
+	for k, n := range counts {
+		ch <- prometheus.MustNewConstMetric(descJobs, prometheus.GaugeValue, float64(n), k.kind, k.state)
+	}
+	for kind, ds := range durations {
+		buckets := make(map[float64]uint64, len(durationBuckets))
+		var sum float64
+		for _, b := range durationBuckets {
+			buckets[b] = 0
+			for _, d := range ds {
+				if d <= b {
+					buckets[b]++
+				}
+			}
+		}
+		for _, d := range ds {
+			sum += d
+		}
+		ch <- prometheus.MustNewConstHistogram(descDuration, uint64(len(ds)), sum, buckets, kind)
+	}
+}
+
+// NewMetricsHandler returns the metrics of m's jobs, with those of the
+// process, for Prometheus to scrape at /metrics
+func NewMetricsHandler(m *Manager) http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(metrics{m}, collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	return mux
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shubham/recovery/internal/disk/disktest"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewManager(t.TempDir())
+	defer m.Close()
+	scan, err := m.StartScan(writeImage(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, m, scan.ID)
+	rec, err := m.StartRecover(scan.ID, []int{disktest.NotesID}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, m, rec.ID)
+
+	srv := httptest.NewServer(NewMetricsHandler(m))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	text := string(body)
+	for _, want := range []string{
+		`recover_files_found_total 1`,
+		`recover_deleted_files_found_total 1`,
+		`recover_files_recovered_total 1`,
+		`recover_files_failed_total 0`,
+		`recover_jobs{kind="scan",state="completed"} 1`,
+		`recover_jobs{kind="recover",state="running"} 0`,
+		`recover_job_duration_seconds_count{kind="recover"} 1`,
+		`recover_job_duration_seconds_bucket{kind="scan",le="86400"} 1`,
+		`recover_read_errors_total{device="` + scan.Device + `"} 0`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %s in the metrics", want)
+		}
+	}
+	if strings.Contains(text, `recover_read_bytes_total{device="`+scan.Device+`"} 0`) {
+		t.Error("Expected the bytes read from the image to be counted")
+	}
+}
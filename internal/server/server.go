@@ -0,0 +1,621 @@
+// Package server runs the engine as a long-running service, for the
+// "recover serve" command: jobs that scan devices and recover the files
+// they list, started, watched and canceled by clients over the network.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shubham/recovery/pkg/recovery"
+)
+
+// Kinds of job
+const (
+	KindScan    = "scan"
+	KindRecover = "recover"
+)
+
+// States of a job
+const (
+	StateQueued    = "queued"
+	StateRunning   = "running"
+	StateCompleted = "completed"
+	StateFailed    = "failed"
+	StateCanceled  = "canceled"
+)
+
+var (
+	// ErrNoJob is the error for a job ID the manager does not know
+	ErrNoJob = errors.New("no such job")
+	// ErrNotScan is the error for files asked of a job that is not a scan
+	ErrNotScan = errors.New("job is not a scan")
+	// ErrScanNotDone is the error for files asked of a scan that has not
+	// completed
+	ErrScanNotDone = errors.New("scan has not completed")
+	// ErrNotDone is the error for results asked of a job still running
+	ErrNotDone = errors.New("job has not ended")
+	// ErrNoFile is the error for a file ID a scan did not list
+	ErrNoFile = errors.New("no such file")
+	// ErrInvalid is the error for a request that asks for what cannot be
+	ErrInvalid = errors.New("invalid request")
+	// ErrInUse is the error for removing a scan that a recovery or a
+	// reader from Open still reads
+	ErrInUse = errors.New("scan is in use")
+)
+
+// Job is a scan or recovery as clients see it
+type Job struct {
+	ID       string
+	Kind     string
+	State    string
+	Error    string // Why it failed
+	Device   string
+	Scan     string // ID of the scan a recovery recovers from
+	Output   string // Directory a recovery writes to
+	Progress recovery.Progress
+
+	Files     int // Listed by a scan, directories included, or to be recovered by a recovery
+	Deleted   int // Of those a scan listed
+	Recovered int // Of a recovery: files recovered
+	Failed    int // And files that could not be
+
+	Created    time.Time
+	Started    time.Time
+	Progressed time.Time // When its progress last moved, for telling it has stalled
+	Finished   time.Time
+}
+
+// Done reports whether the job has ended
+func (j Job) Done() bool {
+	return j.State == StateCompleted || j.State == StateFailed || j.State == StateCanceled
+}
+
+// Event is a change of a job: its progress, its state, or a line it printed
+type Event struct {
+	Job     Job
+	Message string // "" for a change of progress or state
+}
+
+// progressInterval is how often progress is passed to watchers at most;
+// the engine reports it after every block read
+const progressInterval = 250 * time.Millisecond
+
+// job is a Job with what running it takes
+type job struct {
+	mu       sync.Mutex
+	info     Job
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	watchers map[chan Event]struct{}
+	lastSent time.Time
+	readFrom int64 // Bytes read from its source before it started
+
+	// Of a scan: the source it keeps open, which one job at a time reads,
+	// and the files it listed; removed is closed once it is removed, to
+	// the jobs that were waiting to read it
+	source  *recovery.Source
+	busy    chan struct{}
+	removed chan struct{}
+	files   []recovery.File
+
+	// Of a recovery: what became of each file
+	results []recovery.Result
+}
+
+func (j *job) snapshot() Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.info
+}
+
+// update changes the job with fn and tells its watchers
+func (j *job) update(fn func(*Job)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(&j.info)
+	j.send(Event{Job: j.info})
+}
+
+// send passes an event to the watchers that have room for it; one that
+// falls behind misses events, and reads the job's state at the end
+func (j *job) send(e Event) {
+	for w := range j.watchers {
+		select {
+		case w <- e:
+		default:
+		}
+	}
+}
+
+// Progress and Message make a job the ProgressReporter of its source
+func (j *job) Progress(p recovery.Progress) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	last := j.info.Progress
+	j.info.Progress = p
+	if p.Phase != last.Phase || p.Scanned != last.Scanned || p.Found != last.Found {
+		j.info.Progressed = time.Now()
+	}
+	if p.Phase == last.Phase && time.Since(j.lastSent) < progressInterval {
+		return
+	}
+	j.lastSent = time.Now()
+	j.send(Event{Job: j.info})
+}
+
+func (j *job) Message(text string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.send(Event{Job: j.info, Message: text})
+}
+
+// Manager runs the jobs of a service
+type Manager struct {
+	outputDir string
+
+	mu     sync.Mutex
+	jobs   []*job
+	byID   map[string]*job
+	nextID int
+	wg     sync.WaitGroup
+}
+
+// NewManager returns a manager whose recoveries write below outputDir
+func NewManager(outputDir string) *Manager {
+	return &Manager{outputDir: outputDir, byID: make(map[string]*job)}
+}
+
+// OutputDir returns the directory recoveries write below
+func (m *Manager) OutputDir() string {
+	return m.outputDir
+}
+
+// add registers a new job and returns it
+func (m *Manager) add(info Job) *job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	info.ID = strconv.Itoa(m.nextID)
+	info.State = StateQueued
+	info.Created = time.Now()
+	j := &job{info: info, done: make(chan struct{}), watchers: make(map[chan Event]struct{})}
+	j.ctx, j.cancel = context.WithCancel(context.Background())
+	m.jobs = append(m.jobs, j)
+	m.byID[info.ID] = j
+	return j
+}
+
+func (m *Manager) get(id string) (*job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j := m.byID[id]
+	if j == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoJob, id)
+	}
+	return j, nil
+}
+
+// Job returns a job by its ID
+func (m *Manager) Job(id string) (Job, error) {
+	j, err := m.get(id)
+	if err != nil {
+		return Job{}, err
+	}
+	return j.snapshot(), nil
+}
+
+// Jobs returns every job, in the order they were started
+func (m *Manager) Jobs() []Job {
+	m.mu.Lock()
+	jobs := append([]*job(nil), m.jobs...)
+	m.mu.Unlock()
+	infos := make([]Job, len(jobs))
+	for i, j := range jobs {
+		infos[i] = j.snapshot()
+	}
+	return infos
+}
+
+// StartScan starts listing the files of a device or image, live and
+// deleted. The scan keeps the source open for recoveries of its files
+// until it is removed or the manager is closed.
+func (m *Manager) StartScan(device string) (Job, error) {
+	src, err := recovery.Open(device)
+	if err != nil {
+		return Job{}, err
+	}
+	j := m.add(Job{Kind: KindScan, Device: device})
+	j.source = src
+	j.busy = make(chan struct{}, 1)
+	j.removed = make(chan struct{})
+	m.run(j, nil, func(ctx context.Context) error {
+		files, err := src.Scan(ctx)
+		if err != nil {
+			return err
+		}
+		deleted := 0
+		for _, f := range files {
+			if f.Deleted {
+				deleted++
+			}
+		}
+		j.mu.Lock()
+		j.files = files
+		j.info.Files, j.info.Deleted = len(files), deleted
+		j.mu.Unlock()
+		return nil
+	})
+	return j.snapshot(), nil
+}
+
+// Files returns the files a completed scan listed
+func (m *Manager) Files(scanID string) ([]recovery.File, error) {
+	j, err := m.get(scanID)
+	if err != nil {
+		return nil, err
+	}
+	info := j.snapshot()
+	switch {
+	case info.Kind != KindScan:
+		return nil, fmt.Errorf("%w: %s", ErrNotScan, scanID)
+	case info.State != StateCompleted:
+		return nil, fmt.Errorf("%w: %s is %s", ErrScanNotDone, scanID, info.State)
+	}
+	return j.files, nil
+}
+
+// Open returns a file a completed scan listed, and a reader of its data as
+// a recovery would write it. The reader has the scan's source to itself,
+// as a job does: Open waits for the jobs reading it, or for ctx, and the
+// next job waits for the reader to be closed.
+func (m *Manager) Open(ctx context.Context, scanID string, fileID int) (recovery.File, io.ReadCloser, error) {
+	files, err := m.Files(scanID)
+	if err != nil {
+		return recovery.File{}, nil, err
+	}
+	i := slices.IndexFunc(files, func(f recovery.File) bool { return f.ID == fileID })
+	if i < 0 {
+		return recovery.File{}, nil, fmt.Errorf("%w: scan %s has no file %d", ErrNoFile, scanID, fileID)
+	}
+	f := files[i]
+	if f.Dir {
+		return recovery.File{}, nil, fmt.Errorf("%w: %s is a directory", ErrInvalid, f.Path)
+	}
+	scan, _ := m.get(scanID)
+	select {
+	case scan.busy <- struct{}{}:
+	case <-scan.removed:
+		return recovery.File{}, nil, fmt.Errorf("%w: %s", ErrNoJob, scanID)
+	case <-ctx.Done():
+		return recovery.File{}, nil, ctx.Err()
+	}
+	r, err := scan.source.Open(f)
+	if err != nil {
+		<-scan.busy
+		return recovery.File{}, nil, err
+	}
+	return f, &heldReader{Reader: r, busy: scan.busy}, nil
+}
+
+// heldReader is a reader of a scan's source that lets the next job read it
+// once closed
+type heldReader struct {
+	io.Reader
+	busy chan struct{}
+	once sync.Once
+}
+
+func (h *heldReader) Close() error {
+	h.once.Do(func() { <-h.busy })
+	return nil
+}
+
+// Results returns what became of each file of a recovery that has ended
+func (m *Manager) Results(recoverID string) ([]recovery.Result, error) {
+	j, err := m.get(recoverID)
+	if err != nil {
+		return nil, err
+	}
+	info := j.snapshot()
+	switch {
+	case info.Kind != KindRecover:
+		return nil, fmt.Errorf("%w: %s is not a recovery", ErrInvalid, recoverID)
+	case !info.Done():
+		return nil, fmt.Errorf("%w: recovery %s is %s", ErrNotDone, recoverID, info.State)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.results, nil
+}
+
+// FileFilter chooses among the files of a scan; its zero value chooses all
+type FileFilter struct {
+	Deleted     bool   // Only deleted files and directories
+	Path        string // Only those whose path matches this glob, as path.Match matches
+	Recoverable string // Only those with this much of their data left, such as complete
+	MinSize     int64
+	MaxSize     int64 // 0 = no limit
+}
+
+// Match reports whether the filter chooses f
+func (ff FileFilter) Match(f recovery.File) bool {
+	switch {
+	case ff.Deleted && !f.Deleted:
+		return false
+	case ff.Recoverable != "" && f.Recoverable != ff.Recoverable:
+		return false
+	case f.Size < ff.MinSize, ff.MaxSize > 0 && f.Size > ff.MaxSize:
+		return false
+	case ff.Path != "":
+		if ok, _ := path.Match(ff.Path, f.Path); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter returns the files the filter chooses
+func (ff FileFilter) Filter(files []recovery.File) []recovery.File {
+	if ff == (FileFilter{}) {
+		return files
+	}
+	var chosen []recovery.File
+	for _, f := range files {
+		if ff.Match(f) {
+			chosen = append(chosen, f)
+		}
+	}
+	return chosen
+}
+
+// StartRecover starts recovering the files of a completed scan with the
+// given IDs to dir, a directory below the manager's output directory that
+// is the new job's ID when "". It waits its turn behind the other jobs
+// reading the scan's source.
+func (m *Manager) StartRecover(scanID string, ids []int, dir string) (Job, error) {
+	files, err := m.Files(scanID)
+	if err != nil {
+		return Job{}, err
+	}
+	byID := make(map[int]recovery.File, len(files))
+	for _, f := range files {
+		byID[f.ID] = f
+	}
+	chosen := make([]recovery.File, 0, len(ids))
+	for _, id := range ids {
+		f, ok := byID[id]
+		if !ok {
+			return Job{}, fmt.Errorf("%w: scan %s has no file %d", ErrInvalid, scanID, id)
+		}
+		chosen = append(chosen, f)
+	}
+	if dir != "" && !filepath.IsLocal(dir) {
+		return Job{}, fmt.Errorf("%w: output %q is not a directory below the output directory", ErrInvalid, dir)
+	}
+
+	scan, _ := m.get(scanID)
+	j := m.add(Job{Kind: KindRecover, Device: scan.snapshot().Device, Scan: scanID, Files: len(chosen)})
+	j.mu.Lock()
+	if dir == "" {
+		dir = j.info.ID
+	}
+	output := filepath.Join(m.outputDir, dir)
+	j.info.Output = output
+	j.mu.Unlock()
+	m.run(j, scan, func(ctx context.Context) error {
+		if err := os.MkdirAll(output, 0755); err != nil {
+			return err
+		}
+		results, err := scan.source.Recover(ctx, chosen, output)
+		recovered, failed := 0, 0
+		for _, r := range results {
+			if r.Err != nil {
+				failed++
+			} else {
+				recovered++
+			}
+		}
+		j.update(func(info *Job) { info.Recovered, info.Failed = recovered, failed })
+		j.mu.Lock()
+		j.results = results
+		j.mu.Unlock()
+		return err
+	})
+	return j.snapshot(), nil
+}
+
+// run runs fn as j in the background, reading the source of scan, or of j
+// when it is the scan, once no other job is
+func (m *Manager) run(j *job, scan *job, fn func(ctx context.Context) error) {
+	if scan == nil {
+		scan = j
+	}
+	ctx := j.ctx
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer j.cancel()
+		err := ctx.Err()
+		select {
+		case scan.busy <- struct{}{}:
+			defer func() { <-scan.busy }()
+			j.mu.Lock()
+			j.readFrom = scan.source.Stats().Bytes
+			j.mu.Unlock()
+			j.update(func(info *Job) {
+				info.State = StateRunning
+				info.Started = time.Now()
+				info.Progressed = info.Started
+			})
+			scan.source.SetReporter(j)
+			err = fn(ctx)
+			scan.source.SetReporter(nil)
+		case <-scan.removed:
+			err = fmt.Errorf("%w: scan %s was removed", ErrNoJob, scan.snapshot().ID)
+		case <-ctx.Done():
+		}
+
+		j.mu.Lock()
+		switch {
+		case errors.Is(err, context.Canceled):
+			j.info.State = StateCanceled
+		case err != nil:
+			j.info.State = StateFailed
+			j.info.Error = err.Error()
+		default:
+			j.info.State = StateCompleted
+		}
+		j.info.Finished = time.Now()
+		j.send(Event{Job: j.info})
+		for w := range j.watchers {
+			close(w)
+		}
+		j.watchers = nil
+		close(j.done)
+		j.mu.Unlock()
+	}()
+}
+
+// Watch returns the events of a job as it runs, on a channel closed once
+// it ends, and a function to stop watching it sooner. The channel drops
+// events a watcher is too slow to take; Job gives the state at the end.
+func (m *Manager) Watch(id string) (<-chan Event, func(), error) {
+	j, err := m.get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	w := make(chan Event, 64)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.watchers == nil {
+		close(w) // Already ended
+		return w, func() {}, nil
+	}
+	j.watchers[w] = struct{}{}
+	w <- Event{Job: j.info}
+	stop := func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if _, ok := j.watchers[w]; ok {
+			delete(j.watchers, w)
+			close(w)
+		}
+	}
+	return w, stop, nil
+}
+
+// Wait waits for a job to end and returns its final state
+func (m *Manager) Wait(ctx context.Context, id string) (Job, error) {
+	j, err := m.get(id)
+	if err != nil {
+		return Job{}, err
+	}
+	select {
+	case <-j.done:
+		return j.snapshot(), nil
+	case <-ctx.Done():
+		return Job{}, ctx.Err()
+	}
+}
+
+// Cancel stops a job, keeping what it wrote, and returns its state
+func (m *Manager) Cancel(id string) (Job, error) {
+	j, err := m.get(id)
+	if err != nil {
+		return Job{}, err
+	}
+	j.cancel()
+	<-j.done
+	return j.snapshot(), nil
+}
+
+// Remove forgets a job that has ended, returning its final state, and
+// closes the source of a scan. A scan is kept while a recovery of it has
+// not ended or a reader from Open is open.
+func (m *Manager) Remove(id string) (Job, error) {
+	m.mu.Lock()
+	j := m.byID[id]
+	if j == nil {
+		m.mu.Unlock()
+		return Job{}, fmt.Errorf("%w: %s", ErrNoJob, id)
+	}
+	info := j.snapshot()
+	if !info.Done() {
+		m.mu.Unlock()
+		return Job{}, fmt.Errorf("%w: %s is %s", ErrNotDone, id, info.State)
+	}
+	if j.source != nil {
+		for _, r := range m.jobs {
+			if r := r.snapshot(); r.Scan == id && !r.Done() {
+				m.mu.Unlock()
+				return Job{}, fmt.Errorf("%w: recovery %s is %s", ErrInUse, r.ID, r.State)
+			}
+		}
+		// Held for good: the source is closed
+		select {
+		case j.busy <- struct{}{}:
+		default:
+			m.mu.Unlock()
+			return Job{}, fmt.Errorf("%w: a file of %s is being read", ErrInUse, id)
+		}
+	}
+	delete(m.byID, id)
+	for i, other := range m.jobs {
+		if other == j {
+			m.jobs = append(m.jobs[:i], m.jobs[i+1:]...)
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	if j.source == nil {
+		return info, nil
+	}
+	close(j.removed)
+	return info, j.source.Close()
+}
+
+// Expire removes the jobs that ended more than age ago, as Remove does,
+// keeping the scans still in use, and returns how many it removed
+func (m *Manager) Expire(age time.Duration) int {
+	removed := 0
+	for _, info := range m.Jobs() {
+		if !info.Done() || time.Since(info.Finished) < age {
+			continue
+		}
+		if _, err := m.Remove(info.ID); err == nil {
+			removed++
+		}
+	}
+	return removed
+}
+
+// Close cancels the jobs still running, waits for them and closes the
+// sources of the scans
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	jobs := append([]*job(nil), m.jobs...)
+	m.mu.Unlock()
+	for _, j := range jobs {
+		j.cancel()
+	}
+	m.wg.Wait()
+	var errs []error
+	for _, j := range jobs {
+		if j.source != nil {
+			errs = append(errs, j.source.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shubham/recovery/internal/disk/disktest"
+)
+
+// notes is the content of the deleted file of writeImage
+var notes = disktest.Notes
+
+// writeImage writes a FAT32 volume listing a deleted NOTES.TXT, and
+// returns its path
+func writeImage(t *testing.T) string {
+	return disktest.Write(t, "usb.img", disktest.Deleted(notes))
+}
+
+func wait(t *testing.T, m *Manager, id string) Job {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	job, err := m.Wait(ctx, id)
+	if err != nil {
+		t.Fatalf("Job %s did not end: %v", id, err)
+	}
+	return job
+}
+
+func TestScanAndRecover(t *testing.T) {
+	outputDir := t.TempDir()
+	m := NewManager(outputDir)
+	defer m.Close()
+
+	scan, err := m.StartScan(writeImage(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, _, err := m.Watch(scan.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan = wait(t, m, scan.ID)
+	if scan.State != StateCompleted || scan.Files != 1 || scan.Deleted != 1 {
+		t.Fatalf("Expected a completed scan listing one deleted file, got %+v", scan)
+	}
+	var last Event
+	for e := range events {
+		last = e
+	}
+	if last.Job.State != StateCompleted {
+		t.Errorf("Expected the watch to end with the completed scan, got %+v", last.Job)
+	}
+
+	files, err := m.Files(scan.ID)
+	if err != nil || len(files) != 1 || files[0].Path != "?OTES.TXT" {
+		t.Fatalf("Unexpected files %+v (%v)", files, err)
+	}
+	rec, err := m.StartRecover(scan.ID, []int{files[0].ID}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = wait(t, m, rec.ID)
+	if rec.State != StateCompleted || rec.Recovered != 1 || rec.Output != filepath.Join(outputDir, rec.ID) {
+		t.Fatalf("Expected a completed recovery of one file, got %+v", rec)
+	}
+	if got, err := os.ReadFile(filepath.Join(rec.Output, "_OTES.TXT")); err != nil || !bytes.Equal(got, notes) {
+		t.Errorf("The notes were not recovered (%v)", err)
+	}
+	if jobs := m.Jobs(); len(jobs) != 2 || jobs[0].ID != scan.ID || jobs[1].ID != rec.ID {
+		t.Errorf("Expected the scan and the recovery, got %+v", jobs)
+	}
+
+	// Requests for what cannot be are refused
+	if _, err := m.StartRecover(scan.ID, []int{disktest.NotesID + 1}, ""); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected ErrInvalid for a file the scan did not list, got %v", err)
+	}
+	if _, err := m.StartRecover(scan.ID, []int{disktest.NotesID}, "../elsewhere"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected ErrInvalid for an output outside the output directory, got %v", err)
+	}
+	if _, err := m.Files(rec.ID); !errors.Is(err, ErrNotScan) {
+		t.Errorf("Expected ErrNotScan, got %v", err)
+	}
+	if _, err := m.Job("99"); !errors.Is(err, ErrNoJob) {
+		t.Errorf("Expected ErrNoJob, got %v", err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	m := NewManager(t.TempDir())
+	defer m.Close()
+	scan, err := m.StartScan(writeImage(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, m, scan.ID)
+
+	// A recovery queued behind another job reading the source is canceled
+	// before it starts
+	s, _ := m.get(scan.ID)
+	s.busy <- struct{}{}
+	rec, err := m.StartRecover(scan.ID, []int{disktest.NotesID}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.State != StateQueued {
+		t.Errorf("Expected the recovery queued, got %s", rec.State)
+	}
+	rec, err = m.Cancel(rec.ID)
+	<-s.busy
+	if err != nil || rec.State != StateCanceled || !rec.Started.IsZero() {
+		t.Errorf("Expected the recovery canceled before it started, got %+v (%v)", rec, err)
+	}
+}
+
+// TestOpenWhileRecovering reads a file of a scan while recoveries from it
+// run, which under -race shows the two share the source safely
+func TestOpenWhileRecovering(t *testing.T) {
+	m := NewManager(t.TempDir())
+	defer m.Close()
+	scan, err := m.StartScan(writeImage(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, m, scan.ID)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 10 {
+			rec, err := m.StartRecover(scan.ID, []int{disktest.NotesID}, "")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if rec = wait(t, m, rec.ID); rec.State != StateCompleted {
+				t.Errorf("Expected the recovery to complete, got %+v", rec)
+			}
+		}
+	}()
+	for range 10 {
+		_, r, err := m.Open(context.Background(), scan.ID, disktest.NotesID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(got, notes) {
+			t.Errorf("Expected the notes, got %d bytes (%v)", len(got), err)
+		}
+	}
+	<-done
+
+	// The reader holds the source until it is closed
+	_, r, err := m.Open(context.Background(), scan.ID, disktest.NotesID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := m.Open(ctx, scan.ID, disktest.NotesID); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Open to wait for the reader before, got %v", err)
+	}
+	r.Close()
+}
+
+func TestRemove(t *testing.T) {
+	m := NewManager(t.TempDir())
+	defer m.Close()
+	scan, err := m.StartScan(writeImage(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, m, scan.ID)
+
+	// A scan is kept while a file of it is read, or a recovery of it waits
+	_, r, err := m.Open(context.Background(), scan.ID, disktest.NotesID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Remove(scan.ID); !errors.Is(err, ErrInUse) {
+		t.Errorf("Expected the scan kept while a file is read, got %v", err)
+	}
+	rec, err := m.StartRecover(scan.ID, []int{disktest.NotesID}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Remove(rec.ID); !errors.Is(err, ErrNotDone) {
+		t.Errorf("Expected a queued recovery kept, got %v", err)
+	}
+	r.Close()
+	if _, err := m.Remove(scan.ID); err != nil && !errors.Is(err, ErrInUse) {
+		t.Errorf("Expected the scan kept while the recovery runs, got %v", err)
+	}
+	wait(t, m, rec.ID)
+
+	if _, err := m.Remove(scan.ID); err != nil {
+		t.Fatalf("Expected the scan removed, got %v", err)
+	}
+	if _, err := m.Files(scan.ID); !errors.Is(err, ErrNoJob) {
+		t.Errorf("Expected the scan forgotten, got %v", err)
+	}
+	if _, err := m.Remove(scan.ID); !errors.Is(err, ErrNoJob) {
+		t.Errorf("Expected a second removal to find no job, got %v", err)
+	}
+	if jobs := m.Jobs(); len(jobs) != 1 || jobs[0].ID != rec.ID {
+		t.Errorf("Expected the recovery to outlive its scan, got %+v", jobs)
+	}
+	if results, err := m.Results(rec.ID); err != nil || len(results) != 1 {
+		t.Errorf("Expected the recovery's results, got %v (%v)", results, err)
+	}
+
+	// Expire keeps what ended too recently
+	if n := m.Expire(time.Hour); n != 0 || len(m.Jobs()) != 1 {
+		t.Errorf("Expected nothing expired, got %d", n)
+	}
+	if n := m.Expire(0); n != 1 || len(m.Jobs()) != 0 {
+		t.Errorf("Expected the recovery expired, got %d and %+v", n, m.Jobs())
+	}
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// The browser UI is a single page run on the HTTP API, built into the binary
+//
+//go:embed web
+var webFiles embed.FS
+
+// NewWebHandler returns the browser UI at / together with the HTTP API it
+// calls at /api/v1, running its jobs with m
+func NewWebHandler(m *Manager) http.Handler {
+	static, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		panic(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/", NewHandler(m))
+	files := http.FileServerFS(static)
+	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		files.ServeHTTP(w, r)
+	}))
+	return mux
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWeb(t *testing.T) {
+	m := NewManager(t.TempDir())
+	defer m.Close()
+	srv := httptest.NewServer(NewWebHandler(m))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(page), "<title>Recovery</title>") {
+		t.Fatalf("Expected the UI, got %d: %.200s", resp.StatusCode, page)
+	}
+
+	resp, err = http.Get(srv.URL + "/api/v1/jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected the API under /api/v1, got %d (%s)", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
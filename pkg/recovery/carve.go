@@ -0,0 +1,139 @@
+package recovery
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/shubham/recovery/internal/carver"
+)
+
+// CarveOptions are the settings of a carve
+type CarveOptions struct {
+	Types     []string // Formats to carve, by name ("JPEG") or extension (".jpg"); nil = all Types
+	FreeOnly  bool     // Carve only the space the FAT32 and NTFS volumes have not allocated
+	SkipEmpty bool     // Skip blocks of zeros or of one repeated byte
+	MinSize   int64    // Drop carved files smaller than this many bytes, when writing them
+	Validate  bool     // Check the structure of the carved files of formats that can be checked
+	ScanOnly  bool     // Find the files without writing them, for Open to read
+
+	// Receives the progress of the scan after every block read, in place
+	// of the source's ProgressReporter (nil = report it there)
+	Progress func(Progress)
+
+	Session  bool // Record the carve in the session manifest in the output directory
+	Manifest bool // List the digests of the carved files in hash manifests there
+}
+
+// Carved is a file a carve found by its signature and wrote
+type Carved struct {
+	Type   string // Format name, such as JPEG
+	Offset int64  // Of its first byte on the source
+	Size   int64  // 0 with ScanOnly
+	Path   string // Written to, below the output directory; "" with ScanOnly
+	MD5    string
+	SHA256 string
+	Valid  bool // With Validate, its structure was checked and found whole
+
+	source *Source
+	file   carver.CarvedFile
+}
+
+// Types returns the names of the formats a carve can find
+func Types() []string {
+	names := make([]string, 0, len(carver.Signatures))
+	seen := make(map[string]bool)
+	for _, sig := range carver.Signatures {
+		if !seen[sig.Name] {
+			seen[sig.Name] = true
+			names = append(names, sig.Name)
+		}
+	}
+	return names
+}
+
+// Carve scans the whole source, or with FreeOnly its free space, for files
+// by their signatures and writes them to outputDir, one directory a format.
+// When some could not be written, the error is a *PartialRecoveryError and
+// the files are those that were.
+func (s *Source) Carve(ctx context.Context, outputDir string, opts CarveOptions) ([]Carved, error) {
+	defer s.within(ctx)()
+	var carved []carver.CarvedFile
+	o := carver.Options{
+		SkipEmpty: opts.SkipEmpty,
+		FreeOnly:  opts.FreeOnly,
+		MinSize:   opts.MinSize,
+		Session:   opts.Session,
+		Manifest:  opts.Manifest,
+		Carved:    &carved,
+	}
+	if opts.Validate {
+		o.Validate = carver.ValidateReport
+	}
+	if opts.Types != nil {
+		o.Signatures = []carver.FileSignature{}
+		for _, sig := range carver.Signatures {
+			if wanted(sig, opts.Types) {
+				o.Signatures = append(o.Signatures, sig)
+			}
+		}
+	}
+	if opts.Progress != nil {
+		defer s.reportScan(opts.Progress)()
+	}
+	_, err := carver.Recover(s.r, outputDir, opts.ScanOnly, o)
+	var partial *PartialRecoveryError
+	if err != nil && !errors.As(err, &partial) {
+		return nil, err
+	}
+
+	var files []Carved
+	for _, c := range carved {
+		if c.Path == "" && !opts.ScanOnly {
+			continue // Dropped, or folded into another
+		}
+		f := Carved{
+			Type:   c.Signature.Name,
+			Offset: c.Offset,
+			Size:   c.Size,
+			Path:   c.Path,
+			MD5:    c.MD5,
+			SHA256: c.SHA256,
+			Valid:  c.Verdict == carver.Valid,
+			source: s,
+			file:   c,
+		}
+		if c.Type != "" {
+			f.Type = c.Type
+		}
+		if rel, err := filepath.Rel(outputDir, c.Path); err == nil && c.Path != "" {
+			f.Path = rel
+		}
+		files = append(files, f)
+	}
+	return files, err
+}
+
+// OpenCarved returns a reader of the bytes of a file a carve of the source
+// found, as the carve writes them
+func (s *Source) OpenCarved(c Carved) (io.Reader, error) {
+	if c.source != s {
+		return nil, ErrNotCarved
+	}
+	return carver.NewCarver(s.r).OpenFile(c.file)
+}
+
+// ErrNotCarved is the error opening a file a carve of another source found
+var ErrNotCarved = errors.New("file is not from a carve of this source")
+
+// wanted reports whether a signature is of one of the types named
+func wanted(sig carver.FileSignature, types []string) bool {
+	for _, t := range types {
+		if strings.EqualFold(t, sig.Name) || strings.EqualFold(t, sig.Extension) {
+			return true
+		}
+	}
+	return false
+}
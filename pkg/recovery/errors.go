@@ -0,0 +1,32 @@
+package recovery
+
+import "github.com/shubham/recovery/internal/disk"
+
+// Errors a caller can branch on with errors.Is and errors.As, to say what
+// went wrong and what to try next
+var (
+	// ErrUnsupportedFilesystem: the source, or the filesystem asked for, is
+	// not FAT32 or NTFS. Its files can still be carved.
+	ErrUnsupportedFilesystem = disk.ErrUnsupportedFilesystem
+
+	// ErrCorruptBootSector matches every *BootSectorError
+	ErrCorruptBootSector = disk.ErrCorruptBootSector
+)
+
+type (
+	// BootSectorError: the boot sector of a volume is damaged, or is not of
+	// the filesystem asked for. Its files can still be carved.
+	BootSectorError = disk.BootSectorError
+
+	// ReadError: the source failed a read, as a failing drive does. Imaging
+	// it with a tool that retries and skips bad areas, such as ddrescue,
+	// and recovering from the image may get past it.
+	ReadError = disk.ReadError
+
+	// PartialRecoveryError: RecoverDeleted wrote some of the files, with
+	// their manifests, but could not recover those it lists
+	PartialRecoveryError = disk.PartialRecoveryError
+
+	// FileError is why a file could not be recovered
+	FileError = disk.FileError
+)
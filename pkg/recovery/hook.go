@@ -0,0 +1,62 @@
+package recovery
+
+import (
+	"path/filepath"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// RecoveredFile is a file a run of the source wrote, as a Hook is told of
+// it
+type RecoveredFile struct {
+	Path     string // Written to
+	Original string // Path within its volume, with forward slashes; "" for a carved file
+	Source   string // NTFS or FAT32, or "carved"
+	Type     string // Format of a carved file, such as JPEG
+	Offset   int64  // Of a carved file's first byte on the source
+	Size     int64
+	MD5      string
+	SHA256   string
+}
+
+// Hook is told of each file the runs of a source recover, once it is
+// written, to pass it on: to an antivirus scan, OCR or an evidence system.
+// An error is reported, and the run goes on.
+type Hook interface {
+	Recovered(f RecoveredFile) error
+}
+
+// HookFunc is a function used as a Hook
+type HookFunc func(f RecoveredFile) error
+
+func (fn HookFunc) Recovered(f RecoveredFile) error {
+	return fn(f)
+}
+
+// SetHook has h told of each file the runs of the source recover, or none
+// with nil
+func (s *Source) SetHook(h Hook) {
+	if h == nil {
+		s.r.SetHook(nil)
+		return
+	}
+	s.r.SetHook(hook{h})
+}
+
+// hook passes the files the engine recovers to a Hook
+type hook struct {
+	h Hook
+}
+
+func (h hook) Recovered(f disk.WrittenFile) error {
+	return h.h.Recovered(RecoveredFile{
+		Path:     f.Path,
+		Original: filepath.ToSlash(f.Original),
+		Source:   f.Source,
+		Type:     f.Type,
+		Offset:   f.Offset,
+		Size:     f.Size,
+		MD5:      f.MD5,
+		SHA256:   f.SHA256,
+	})
+}
@@ -0,0 +1,98 @@
+package recovery
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// Filter chooses the files the runs of a source list and recover, and by
+// size the carvings they keep; its zero value keeps every deleted file
+type Filter struct {
+	Include []string // Globs of the paths or names to keep, e.g. "*.jpg" or "Users/*/Documents"; nil = all
+	Exclude []string // Globs of those to leave out, e.g. "*.tmp"
+	Path    string   // Regular expression the path within its volume must match, without case; "" = any
+	MinSize int64    // Bytes; 0 = no minimum
+	MaxSize int64    // Bytes; 0 = no maximum
+
+	// The times a file is kept for, After included and Before not; zero
+	// for no bound. A file whose time is unknown is left out.
+	ModifiedAfter, ModifiedBefore time.Time
+	CreatedAfter, CreatedBefore   time.Time
+
+	Live bool // Take the files in use as well as the deleted ones
+}
+
+// SetFilter makes the runs of the source list and recover only the files
+// f keeps; an invalid glob or expression is an error, and leaves the
+// filter as it was
+func (s *Source) SetFilter(f Filter) error {
+	include, err := disk.ParsePatterns(strings.Join(f.Include, ","))
+	if err != nil {
+		return fmt.Errorf("include: %w", err)
+	}
+	exclude, err := disk.ParsePatterns(strings.Join(f.Exclude, ","))
+	if err != nil {
+		return fmt.Errorf("exclude: %w", err)
+	}
+	filter := &disk.Filter{
+		Include:        include,
+		Exclude:        exclude,
+		MinSize:        f.MinSize,
+		MaxSize:        f.MaxSize,
+		ModifiedAfter:  f.ModifiedAfter,
+		ModifiedBefore: f.ModifiedBefore,
+		CreatedAfter:   f.CreatedAfter,
+		CreatedBefore:  f.CreatedBefore,
+	}
+	if f.Path != "" {
+		if filter.Path, err = disk.ParsePathRegex(f.Path); err != nil {
+			return fmt.Errorf("path: %w", err)
+		}
+	}
+	if f.MaxSize > 0 && f.MaxSize < f.MinSize {
+		return fmt.Errorf("maximum size %d is below the minimum %d", f.MaxSize, f.MinSize)
+	}
+	s.r.SetFilter(filter)
+	s.r.SetLiveFiles(f.Live)
+	return nil
+}
+
+// Output is how the runs of a source write the files they recover; its
+// zero value writes them as they are, one at a time, with no limit
+type Output struct {
+	Compress string // "zstd" to compress each file, adding .zst to its name; "" or "none" for none
+	Sync     bool   // Flush each file to stable storage before the next
+	Verify   bool   // Read each file back and check its digest against the source
+	Workers  int    // Files written at once; 1 or less writes one at a time
+	Limit    int64  // Bytes written at most, the files past it being skipped; 0 = no limit
+}
+
+// SetOutput sets how the runs of the source write what they recover; an
+// unknown compression is an error, and leaves the output as it was
+func (s *Source) SetOutput(o Output) error {
+	compression, err := disk.ParseCompression(o.Compress)
+	if err != nil {
+		return err
+	}
+	s.r.Compress(compression)
+	s.r.SyncOutput(o.Sync)
+	s.r.VerifyOutput(o.Verify)
+	s.r.SetWorkers(o.Workers)
+	s.r.LimitOutput(o.Limit)
+	return nil
+}
+
+// OutputStats is what the runs of a source could not write as asked
+type OutputStats struct {
+	Skipped    []string // Files left out for the Limit of the Output, by the path they would have had
+	Unverified int      // Files written that did not verify against the source
+}
+
+// OutputStats returns what the runs of the source have left out or could
+// not verify so far
+func (s *Source) OutputStats() OutputStats {
+	return OutputStats{Skipped: s.r.Skipped(), Unverified: s.r.Unverified()}
+}
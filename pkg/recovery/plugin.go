@@ -0,0 +1,83 @@
+package recovery
+
+import (
+	"fmt"
+	"io"
+	"plugin"
+
+	"github.com/shubham/recovery/internal/carver"
+)
+
+// Formats the engine does not know can be added to every carve without
+// changing it: a program embedding it calls RegisterSignature, and the
+// recover command loads Go plugins whose init functions do, built with
+//
+//	go build -buildmode=plugin -o acme.so ./acme
+//
+// against the same release of this module and the same Go toolchain:
+//
+//	package main
+//
+//	import "github.com/shubham/recovery/pkg/recovery"
+//
+//	func init() {
+//		err := recovery.RegisterSignature(recovery.Signature{
+//			Name: "ACME", Extension: ".acme", Header: []byte("ACME\x00\x01"),
+//			MaxSize: 64 << 20, Size: acmeSize, Validate: validateACME,
+//		})
+//		if err != nil {
+//			panic(err)
+//		}
+//	}
+
+// Signature is a file format a carve finds by the bytes it starts with
+type Signature struct {
+	Name      string // Format name, which also names the directory its carvings are written to
+	Extension string // With the dot, such as ".acme"
+	Header    []byte
+	Offset    int    // Of the header in the file
+	Footer    []byte // Optional; a carving ends after the first one
+	Alignment int64  // Only match files starting on this boundary (0 = any offset)
+	MinSize   int64  // Carvings smaller than this are false positives
+	MaxSize   int64  // Largest carving (0 = 10MB)
+
+	// Verify checks the bytes at a header hit further (nil = none)
+	Verify func(data []byte) bool
+
+	// Size works out the length of a file from its structure, reading at
+	// most limit bytes of r from its start, or returns 0 for the footer or
+	// MaxSize to end it instead (nil = always)
+	Size func(r io.ReaderAt, limit int64) int64
+
+	// Validate checks the structure of a carving of size bytes, when a
+	// carve validates them (nil = left unchecked)
+	Validate func(r io.ReaderAt, size int64) error
+}
+
+// RegisterSignature adds a format to those every carve finds and Types
+// lists, before the carves that should find it start
+func RegisterSignature(sig Signature) error {
+	return carver.RegisterSignature(carver.FileSignature{
+		Name:      sig.Name,
+		Extension: sig.Extension,
+		Header:    sig.Header,
+		Offset:    sig.Offset,
+		Footer:    sig.Footer,
+		Alignment: sig.Alignment,
+		MinSize:   sig.MinSize,
+		MaxSize:   sig.MaxSize,
+		Verify:    sig.Verify,
+		Sizer:     sig.Size,
+		Validate:  sig.Validate,
+	})
+}
+
+// LoadPlugin opens a Go plugin, whose init functions register the
+// signatures it brings. Plugins load where the platform supports them:
+// Linux, macOS and FreeBSD, in a build with cgo.
+func LoadPlugin(path string) error {
+	if _, err := plugin.Open(path); err != nil {
+		return fmt.Errorf("failed to load plugin %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package recovery
+
+import "github.com/shubham/recovery/internal/disk"
+
+// Progress is how far a phase of a run has come
+type Progress struct {
+	Phase   string // What the run is doing, such as "carving scan", "MFT scan" or "NTFS recovery"
+	Scanned int64  // Done so far of Total, in the phase's unit: bytes, records or files
+	Total   int64  // 0 when not known
+	Found   int64  // Files found, or recovered, so far
+	Item    string // What is being worked on, such as the file being written; "" for none
+}
+
+// ProgressReporter receives what the runs of a source do as they go: the
+// progress of each phase, as often as it is made, and the lines the
+// recover command prints, with their newlines
+type ProgressReporter interface {
+	Progress(p Progress)
+	Message(text string)
+}
+
+// SetReporter makes the runs of the source report to rep instead of
+// printing to standard output; nil restores printing
+func (s *Source) SetReporter(rep ProgressReporter) {
+	if rep == nil {
+		s.r.SetReporter(nil)
+		return
+	}
+	s.r.SetReporter(reporter{rep})
+}
+
+// reporter passes what the engine reports to a ProgressReporter
+type reporter struct {
+	rep ProgressReporter
+}
+
+func (r reporter) Progress(p disk.Progress) {
+	r.rep.Progress(Progress{Phase: p.Phase, Scanned: p.Current, Total: p.Total, Found: p.Found, Item: p.Item})
+}
+
+func (r reporter) Message(text string) {
+	r.rep.Message(text)
+}
+
+// scanReporter passes the progress of a carving scan to a function, and
+// the rest to the reporter it stands in for
+type scanReporter struct {
+	disk.ProgressReporter
+	fn func(Progress)
+}
+
+func (r scanReporter) Progress(p disk.Progress) {
+	if p.Phase != "carving scan" {
+		r.ProgressReporter.Progress(p)
+		return
+	}
+	r.fn(Progress{Phase: p.Phase, Scanned: p.Current, Total: p.Total, Found: p.Found, Item: p.Item})
+}
+
+// reportScan passes the progress of the source's carving scans to fn until
+// the function it returns is called
+func (s *Source) reportScan(fn func(Progress)) func() {
+	prev := s.r.Reporter()
+	s.r.SetReporter(scanReporter{prev, fn})
+	return func() { s.r.SetReporter(prev) }
+}
@@ -0,0 +1,161 @@
+// Package recovery is the supported API of the recovery engine, for
+// programs that embed it: it opens a device or disk image, detects its
+// filesystems, lists the files on them, recovers the ones chosen and carves
+// files out of the raw space by their signatures.
+//
+//	src, err := recovery.Open("/dev/sdb")
+//	if err != nil {
+//		return err
+//	}
+//	defer src.Close()
+//	files, err := src.Scan(ctx)
+//	...
+//	var deleted []recovery.File
+//	for _, f := range files {
+//		if f.Deleted && !f.Dir {
+//			deleted = append(deleted, f)
+//		}
+//	}
+//	results, err := src.Recover(ctx, deleted, "./recovered")
+//
+// The runs that read the source take a context: once it is done, their
+// reads fail and they return its error promptly, keeping what was written.
+//
+// The types here are kept stable across releases; the engine behind them,
+// under internal/, is not. Progress and findings of long runs are printed
+// to standard output, as the recover command shows them, unless the source
+// is given a ProgressReporter of its own.
+package recovery
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/shubham/recovery/internal/carver"
+	"github.com/shubham/recovery/internal/disk"
+
+	// The filesystems recovered from, which register themselves
+	_ "github.com/shubham/recovery/internal/fat32"
+	_ "github.com/shubham/recovery/internal/ntfs"
+)
+
+// Filesystems a source or volume can be detected as; Filesystems lists
+// every one that can be recovered from
+const (
+	NTFS  = "ntfs"
+	FAT32 = "fat32"
+)
+
+// Filesystems returns the names of the filesystems files can be recovered
+// from, NTFS and FAT32 among them
+func Filesystems() []string {
+	var names []string
+	for _, fs := range disk.Filesystems() {
+		names = append(names, fs.Name())
+	}
+	return names
+}
+
+// Source is a device or disk image to recover from. Reads of it are never
+// writes: nothing here changes the source.
+type Source struct {
+	r       *disk.Reader
+	volumes []carver.VolumeFiles // Listed by the last Scan
+}
+
+// Open opens a device, such as /dev/sdb or \\.\PhysicalDrive1, or a raw
+// disk image for reading
+func Open(path string) (*Source, error) {
+	r, err := disk.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Source{r: r}, nil
+}
+
+// NewSource reads a source of size bytes from r, such as an image in a
+// format the caller decodes; name is how it is reported
+func NewSource(r io.ReaderAt, size int64, name string) *Source {
+	return &Source{r: disk.NewReader(r, size, name)}
+}
+
+// Close closes the device or image Open opened
+func (s *Source) Close() error {
+	return s.r.Close()
+}
+
+// Path returns the path the source was opened with
+func (s *Source) Path() string {
+	return s.r.Path()
+}
+
+// Size returns the size of the source in bytes
+func (s *Source) Size() int64 {
+	return s.r.Size()
+}
+
+// ReadAt reads the source at an offset, as the runs read it; the Extents
+// of a File say where its data lies
+func (s *Source) ReadAt(p []byte, off int64) (int, error) {
+	return s.r.ReadAt(p, off)
+}
+
+// ReadStats is what the reads of a source have done since it was opened
+type ReadStats struct {
+	Bytes  int64 // Read
+	Errors int64 // Reads the device failed
+}
+
+// Stats returns what the reads of the source have done so far, for
+// monitoring; it may be called while a run reads the source
+func (s *Source) Stats() ReadStats {
+	st := s.r.Stats()
+	return ReadStats{Bytes: st.Bytes, Errors: st.Errors}
+}
+
+// Filesystem detects the filesystem that starts the source, NTFS or FAT32
+// among those that can be recovered from; a partitioned disk has none, and
+// its volumes are listed by Volumes
+func (s *Source) Filesystem() (string, error) {
+	defer s.r.Purpose("filesystem detection")()
+	return disk.DetectFilesystem(s.r)
+}
+
+// RecoverDeleted recovers every deleted file of a source holding a single
+// filesystem, detected when filesystem is "", to outputDir, with hash
+// manifests, and returns the number recovered. With scanOnly, the files
+// are only listed. When some files could not be recovered, the error is a
+// *PartialRecoveryError and the number is of those that were.
+func (s *Source) RecoverDeleted(ctx context.Context, filesystem, outputDir string, scanOnly bool) (int, error) {
+	defer s.within(ctx)()
+	if filesystem == "" {
+		fs, err := s.Filesystem()
+		if err != nil {
+			return 0, err
+		}
+		filesystem = fs
+	}
+	fs := disk.LookupFilesystem(filesystem)
+	if fs == nil {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedFilesystem, filesystem)
+	}
+	return fs.Recover(s.r, outputDir, scanOnly)
+}
+
+// WriteSession records what the source holds, and what a recovery by
+// RecoverDeleted wrote to outputDir, in the session manifest there, which
+// later runs resume from
+func (s *Source) WriteSession(ctx context.Context, outputDir string, scanOnly bool) error {
+	defer s.within(ctx)()
+	_, err := carver.WriteSession(s.r, outputDir, carver.SessionFilesystem, nil, scanOnly)
+	return err
+}
+
+// within makes the reads of the source stop once ctx is done, until the
+// function it returns is called
+func (s *Source) within(ctx context.Context) func() {
+	prev := s.r.Context()
+	s.r.SetContext(ctx)
+	return func() { s.r.SetContext(prev) }
+}
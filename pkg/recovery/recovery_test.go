@@ -0,0 +1,361 @@
+package recovery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shubham/recovery/internal/carver"
+	"github.com/shubham/recovery/internal/disk/disktest"
+)
+
+// makeSource builds a FAT32 volume whose root directory lists a deleted
+// NOTES.TXT; free cluster 9 holds a PNG nothing lists
+func makeSource(t *testing.T) ([]byte, []byte, []byte) {
+	notes := disktest.Notes
+	data := disktest.Deleted(notes)
+
+	var buf bytes.Buffer
+	img := image.NewGray(image.Rect(0, 0, 32, 32))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 7)
+	}
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	copy(disktest.Cluster(data, 9), buf.Bytes())
+	return data, notes, buf.Bytes()
+}
+
+func TestScanAndRecover(t *testing.T) {
+	data, notes, _ := makeSource(t)
+	path := filepath.Join(t.TempDir(), "usb.img")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+	src, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer src.Close()
+
+	if fs, err := src.Filesystem(); err != nil || fs != FAT32 {
+		t.Errorf("Expected FAT32, got %q (%v)", fs, err)
+	}
+	files, err := src.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	var deleted []File
+	for _, f := range files {
+		if f.Deleted && !f.Dir {
+			deleted = append(deleted, f)
+		}
+	}
+	if len(deleted) != 1 {
+		t.Fatalf("Expected one deleted file, got %+v", files)
+	}
+	f := deleted[0]
+	if f.ID != disktest.NotesID || f.Path != "?OTES.TXT" || f.Size != int64(len(notes)) || f.Filesystem != FAT32 || f.Recoverable != "complete" {
+		t.Errorf("Unexpected file %+v", f)
+	}
+	if want := int64(34*512 + 3*4096); len(f.Extents) != 1 || f.Extents[0].Offset != want {
+		t.Errorf("Expected the file at %d, got %+v", want, f.Extents)
+	}
+	volumes, err := src.Volumes()
+	if err != nil || len(volumes) != 1 || volumes[0].Deleted != 1 {
+		t.Errorf("Expected one volume with a deleted file, got %+v (%v)", volumes, err)
+	}
+
+	outputDir := t.TempDir()
+	results, err := src.Recover(context.Background(), deleted, outputDir)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("Recover failed: %+v (%v)", results, err)
+	}
+	if r := results[0]; r.Err != nil || r.Path != "_OTES.TXT" || r.Size != int64(len(notes)) {
+		t.Errorf("Unexpected result %+v", r)
+	}
+	if got, err := os.ReadFile(filepath.Join(outputDir, "_OTES.TXT")); err != nil || !bytes.Equal(got, notes) {
+		t.Errorf("The notes were not recovered (%v)", err)
+	}
+	if st := src.Stats(); st.Bytes < int64(len(notes)) || st.Errors != 0 {
+		t.Errorf("Expected the reads counted without errors, got %+v", st)
+	}
+
+	// Files of another source are refused
+	other := NewSource(bytes.NewReader(data), int64(len(data)), "copy.img")
+	if _, err := other.Recover(context.Background(), deleted, outputDir); !errors.Is(err, ErrNotScanned) {
+		t.Errorf("Expected ErrNotScanned, got %v", err)
+	}
+}
+
+func TestCarve(t *testing.T) {
+	data, _, pic := makeSource(t)
+	src := NewSource(bytes.NewReader(data), int64(len(data)), "usb.img")
+
+	outputDir := t.TempDir()
+	var last Progress
+	carved, err := src.Carve(context.Background(), outputDir, CarveOptions{
+		Types:    []string{".png"},
+		Validate: true,
+		Progress: func(p Progress) { last = p },
+	})
+	if err != nil {
+		t.Fatalf("Carve failed: %v", err)
+	}
+	if len(carved) != 1 {
+		t.Fatalf("Expected the PNG to be carved, got %+v", carved)
+	}
+	c := carved[0]
+	if c.Type != "PNG" || c.Offset != 34*512+7*4096 || c.Size != int64(len(pic)) || !c.Valid {
+		t.Errorf("Unexpected carving %+v", c)
+	}
+	if got, err := os.ReadFile(filepath.Join(outputDir, c.Path)); err != nil || !bytes.Equal(got, pic) {
+		t.Errorf("The PNG was not written to %s (%v)", c.Path, err)
+	}
+	if last.Total != int64(len(data)) || last.Found != 1 {
+		t.Errorf("Expected progress to the end of the source, got %+v", last)
+	}
+}
+
+func TestFilesystems(t *testing.T) {
+	names := strings.Join(Filesystems(), " ")
+	if !strings.Contains(names, NTFS) || !strings.Contains(names, FAT32) {
+		t.Errorf("Expected NTFS and FAT32 to be registered, got %s", names)
+	}
+}
+
+func TestSetHook(t *testing.T) {
+	data, notes, pic := makeSource(t)
+	src := NewSource(bytes.NewReader(data), int64(len(data)), "usb.img")
+	src.SetReporter(&recorder{})
+	var got []RecoveredFile
+	src.SetHook(HookFunc(func(f RecoveredFile) error {
+		got = append(got, f)
+		return nil
+	}))
+
+	outputDir := t.TempDir()
+	if _, err := src.RecoverDeleted(context.Background(), "", outputDir, false); err != nil {
+		t.Fatalf("RecoverDeleted failed: %v", err)
+	}
+	if _, err := src.Carve(context.Background(), outputDir, CarveOptions{Types: []string{".png"}}); err != nil {
+		t.Fatalf("Carve failed: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Expected the notes and the PNG, got %+v", got)
+	}
+	if f := got[0]; f.Source != FAT32 || f.Original != "?OTES.TXT" || f.Size != int64(len(notes)) || f.SHA256 == "" || !strings.HasPrefix(f.Path, outputDir) {
+		t.Errorf("Unexpected recovered file %+v", f)
+	}
+	if f := got[1]; f.Source != "carved" || f.Type != "PNG" || f.Offset != 34*512+7*4096 || f.Size != int64(len(pic)) {
+		t.Errorf("Unexpected carved file %+v", f)
+	}
+}
+
+func TestRegisterSignature(t *testing.T) {
+	defer func(sigs []carver.FileSignature) { carver.Signatures = sigs }(carver.Signatures)
+	data := make([]byte, 64*1024)
+	copy(data[8192:], "ACME\x00\x01")
+	src := NewSource(bytes.NewReader(data), int64(len(data)), "acme.img")
+
+	err := RegisterSignature(Signature{
+		Name: "ACME", Extension: ".acme", Header: []byte("ACME\x00\x01"),
+		Size:     func(r io.ReaderAt, limit int64) int64 { return 100 },
+		Validate: func(r io.ReaderAt, size int64) error { return nil },
+	})
+	if err != nil {
+		t.Fatalf("RegisterSignature failed: %v", err)
+	}
+	if err := RegisterSignature(Signature{Name: "Empty"}); err == nil {
+		t.Error("Expected a signature without a header to be refused")
+	}
+	if types := Types(); types[len(types)-1] != "ACME" {
+		t.Errorf("Expected ACME among the types, got %v", types)
+	}
+
+	carved, err := src.Carve(context.Background(), t.TempDir(), CarveOptions{Types: []string{".acme"}, Validate: true})
+	if err != nil || len(carved) != 1 {
+		t.Fatalf("Expected the ACME file to be carved, got %+v (%v)", carved, err)
+	}
+	if c := carved[0]; c.Type != "ACME" || c.Offset != 8192 || c.Size != 100 || !c.Valid {
+		t.Errorf("Unexpected carving %+v", c)
+	}
+
+	if err := LoadPlugin(filepath.Join(t.TempDir(), "missing.so")); err == nil {
+		t.Error("Expected an error loading a missing plugin")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	data, notes, pic := makeSource(t)
+	src := NewSource(bytes.NewReader(data), int64(len(data)), "usb.img")
+
+	files, err := src.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	for _, f := range files {
+		if f.Path != "?OTES.TXT" {
+			continue
+		}
+		r, err := src.Open(f)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, notes) {
+			t.Errorf("Expected the notes, got %d bytes (%v)", len(got), err)
+		}
+	}
+	other := NewSource(bytes.NewReader(data), int64(len(data)), "copy.img")
+	if _, err := other.Open(files[0]); !errors.Is(err, ErrNotScanned) {
+		t.Errorf("Expected ErrNotScanned, got %v", err)
+	}
+
+	// Carved without writing, then streamed
+	outputDir := t.TempDir()
+	carved, err := src.Carve(context.Background(), outputDir, CarveOptions{Types: []string{".png"}, ScanOnly: true})
+	if err != nil || len(carved) != 1 || carved[0].Path != "" {
+		t.Fatalf("Expected the PNG to be found and not written, got %+v (%v)", carved, err)
+	}
+	r, err := src.OpenCarved(carved[0])
+	if err != nil {
+		t.Fatalf("OpenCarved failed: %v", err)
+	}
+	if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, pic) {
+		t.Errorf("Expected the PNG, got %d bytes (%v)", len(got), err)
+	}
+	if entries, _ := os.ReadDir(outputDir); len(entries) != 0 {
+		t.Errorf("Expected nothing written, got %v", entries)
+	}
+	if _, err := other.OpenCarved(carved[0]); !errors.Is(err, ErrNotCarved) {
+		t.Errorf("Expected ErrNotCarved, got %v", err)
+	}
+}
+
+func TestSetReporter(t *testing.T) {
+	data, _, _ := makeSource(t)
+	src := NewSource(bytes.NewReader(data), int64(len(data)), "usb.img")
+	rep := &recorder{}
+	src.SetReporter(rep)
+
+	if n, err := src.RecoverDeleted(context.Background(), "", t.TempDir(), false); err != nil || n != 1 {
+		t.Fatalf("RecoverDeleted failed: %d (%v)", n, err)
+	}
+	if !rep.saw("FAT32 recovery", "?OTES.TXT") || !strings.Contains(rep.messages, "Recovered: ") {
+		t.Errorf("Expected the recovery of the notes to be reported, got %+v and %q", rep.progress, rep.messages)
+	}
+
+	// A carve's own Progress takes the scan; the rest still goes to the reporter
+	*rep = recorder{}
+	var scanned int
+	if _, err := src.Carve(context.Background(), t.TempDir(), CarveOptions{Progress: func(Progress) { scanned++ }}); err != nil {
+		t.Fatalf("Carve failed: %v", err)
+	}
+	if scanned == 0 || rep.saw("carving scan", "") || !rep.saw("carved file extraction", "PNG at offset 46080") {
+		t.Errorf("Expected the scan on Progress and the extraction on the reporter, got %d and %+v", scanned, rep.progress)
+	}
+	if !strings.Contains(rep.messages, "Found 1 potential files") {
+		t.Errorf("Expected the carve's messages on the reporter, got %q", rep.messages)
+	}
+}
+
+// recorder is a ProgressReporter that keeps what it is told
+type recorder struct {
+	progress []Progress
+	messages string
+}
+
+func (r *recorder) Progress(p Progress) { r.progress = append(r.progress, p) }
+func (r *recorder) Message(text string) { r.messages += text }
+
+// saw reports whether progress of a phase was reported, working on item
+// unless that is ""
+func (r *recorder) saw(phase, item string) bool {
+	for _, p := range r.progress {
+		if p.Phase == phase && (item == "" || p.Item == item) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCancelled(t *testing.T) {
+	data, _, _ := makeSource(t)
+	src := NewSource(bytes.NewReader(data), int64(len(data)), "usb.img")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := src.Scan(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Scan to be cancelled, got %v", err)
+	}
+	if _, err := src.Carve(ctx, t.TempDir(), CarveOptions{Progress: func(Progress) {}}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Carve to be cancelled, got %v", err)
+	}
+
+	// The context of a run does not outlast it
+	if files, err := src.Scan(context.Background()); err != nil || len(files) == 0 {
+		t.Errorf("Expected a later scan to list the files, got %d (%v)", len(files), err)
+	}
+}
+
+func TestSetFilter(t *testing.T) {
+	data, notes, _ := makeSource(t)
+	src := NewSource(bytes.NewReader(data), int64(len(data)), "usb.img")
+	src.SetReporter(&recorder{})
+
+	for _, c := range []struct {
+		filter Filter
+		want   int
+	}{
+		{Filter{}, 1},
+		{Filter{Include: []string{"*.txt"}}, 1},
+		{Filter{Exclude: []string{"*.TXT"}}, 0},
+		{Filter{Path: "^notes"}, 0},
+		{Filter{MinSize: int64(len(notes)) + 1}, 0},
+	} {
+		if err := src.SetFilter(c.filter); err != nil {
+			t.Fatalf("SetFilter(%+v) failed: %v", c.filter, err)
+		}
+		if n, err := src.RecoverDeleted(context.Background(), "", t.TempDir(), true); err != nil || n != c.want {
+			t.Errorf("Expected %d files with %+v, got %d (%v)", c.want, c.filter, n, err)
+		}
+	}
+
+	for _, bad := range []Filter{
+		{Include: []string{"[a"}},
+		{Path: "("},
+		{MinSize: 10, MaxSize: 5},
+	} {
+		if err := src.SetFilter(bad); err == nil {
+			t.Errorf("Expected %+v to be refused", bad)
+		}
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	data, _, _ := makeSource(t)
+	src := NewSource(bytes.NewReader(data), int64(len(data)), "usb.img")
+	src.SetReporter(&recorder{})
+
+	if err := src.SetOutput(Output{Compress: "gzip"}); err == nil {
+		t.Error("Expected an unknown compression to be refused")
+	}
+	if err := src.SetOutput(Output{Verify: true, Limit: 1}); err != nil {
+		t.Fatalf("SetOutput failed: %v", err)
+	}
+	outputDir := t.TempDir()
+	if n, err := src.RecoverDeleted(context.Background(), "", outputDir, false); err != nil || n != 0 {
+		t.Errorf("Expected the notes to be skipped for the limit, got %d (%v)", n, err)
+	}
+	if st := src.OutputStats(); len(st.Skipped) != 1 || !strings.HasSuffix(st.Skipped[0], "OTES.TXT") || st.Unverified != 0 {
+		t.Errorf("Expected the notes skipped, got %+v", st)
+	}
+}
@@ -0,0 +1,197 @@
+package recovery
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/shubham/recovery/internal/carver"
+	"github.com/shubham/recovery/internal/disk"
+)
+
+// Volume is a FAT32 or NTFS volume of a source: a partition, or the whole
+// source when it has no partition table
+type Volume struct {
+	Name       string // partitionN, or "" for the whole source
+	Offset     int64  // On the source
+	Size       int64
+	Filesystem string // NTFS or FAT32
+	Files      int    // Listed by the filesystem, directories included
+	Deleted    int
+}
+
+// Extent is a range of bytes on a source
+type Extent struct {
+	Offset int64
+	Length int64
+}
+
+// File is a file or directory a filesystem of a source lists, live or
+// deleted
+type File struct {
+	ID         int    // Offset on the source of its MFT record or directory entry, the same on every scan
+	Volume     string // Name of its volume
+	Filesystem string // NTFS or FAT32
+	Path       string // Within its volume, with forward slashes
+	Dir        bool
+	Deleted    bool
+	Size       int64
+	Inode      uint64 // MFT record number on NTFS, 0 on FAT32
+
+	// Times the filesystem keeps, zero when it does not
+	Created  time.Time
+	Modified time.Time
+	Changed  time.Time
+	Accessed time.Time
+
+	Extents     []Extent // Where its data lies on the source, in file order; none when kept in the MFT record
+	Recoverable string   // How much of its data is left: complete, partial, overwritten, none or damaged; "" for directories
+
+	source *Source
+	volume int // Of the scan that listed it
+	index  int // In its volume
+}
+
+// Scan lists the files and directories of the source's FAT32 and NTFS
+// volumes, live and deleted, in the order scan reports give them
+func (s *Source) Scan(ctx context.Context) ([]File, error) {
+	defer s.within(ctx)()
+	defer s.r.Purpose("file listing")()
+	volumes := carver.ListVolumes(s.r)
+	if err := ctx.Err(); err != nil {
+		return nil, err // The last complete scan is kept
+	}
+	s.volumes = volumes
+	var files []File
+	for vi, v := range s.volumes {
+		for i, e := range v.Files {
+			f := File{
+				ID:          v.Entries[i].ID,
+				Volume:      v.Volume.Name,
+				Filesystem:  v.Volume.Filesystem,
+				Path:        filepath.ToSlash(e.Path),
+				Dir:         e.Dir,
+				Deleted:     e.Deleted,
+				Size:        e.Size,
+				Inode:       e.Inode,
+				Created:     unixTime(e.Created),
+				Modified:    unixTime(e.Modified),
+				Changed:     unixTime(e.Changed),
+				Accessed:    unixTime(e.Accessed),
+				Recoverable: v.Entries[i].Recoverable,
+				source:      s,
+				volume:      vi,
+				index:       i,
+			}
+			for _, ext := range e.Extents {
+				f.Extents = append(f.Extents, Extent{Offset: v.Volume.Offset + ext.Offset, Length: ext.Length})
+			}
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// Volumes returns the FAT32 and NTFS volumes of the source as the last Scan
+// found them, scanning it if none has
+func (s *Source) Volumes() ([]Volume, error) {
+	if s.volumes == nil {
+		if _, err := s.Scan(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+	volumes := make([]Volume, len(s.volumes))
+	for i, v := range s.volumes {
+		volumes[i] = Volume{
+			Name:       v.Volume.Name,
+			Offset:     v.Volume.Offset,
+			Size:       v.Volume.Size,
+			Filesystem: v.Volume.Filesystem,
+			Files:      v.Volume.Files,
+			Deleted:    v.Volume.Deleted,
+		}
+	}
+	return volumes, nil
+}
+
+// Result is the outcome of recovering a file
+type Result struct {
+	File   File
+	Path   string // Written to, below the output directory; "" when it failed
+	Size   int64
+	MD5    string
+	SHA256 string
+	Err    error // Why it could not be recovered
+}
+
+// ErrNotScanned is the error recovering a file the last Scan of the source
+// did not list
+var ErrNotScanned = errors.New("file is not from the last scan of this source")
+
+// Recover recovers files the last Scan listed to outputDir, each below the
+// name of its volume at its path there, and returns what became of each.
+// Two files with the same path are both kept, the later with a number
+// added to its name. A directory is created with nothing in it. Once ctx is
+// done, the results of the files recovered so far are returned with its
+// error.
+func (s *Source) Recover(ctx context.Context, files []File, outputDir string) ([]Result, error) {
+	for _, f := range files {
+		if f.source != s || f.volume >= len(s.volumes) || f.index >= len(s.volumes[f.volume].Files) {
+			return nil, ErrNotScanned
+		}
+	}
+	defer s.within(ctx)()
+	defer s.r.Purpose("selective recovery")()
+	names := disk.NewNames()
+	results := make([]Result, len(files))
+	for i, f := range files {
+		if err := ctx.Err(); err != nil {
+			return results[:i], err
+		}
+		v := s.volumes[f.volume]
+		rel := names.Claim(filepath.Join(f.Volume, filepath.FromSlash(f.Path)))
+		result := Result{File: f}
+		if f.Dir {
+			if result.Err = os.MkdirAll(filepath.Join(outputDir, rel), 0755); result.Err == nil {
+				result.Path = rel
+			}
+			results[i] = result
+			continue
+		}
+		rel = s.r.OutputPath(rel)
+		path := filepath.Join(outputDir, rel)
+		digest, err := v.Recover(v.Files[f.index], path)
+		if err != nil {
+			result.Err = err
+		} else {
+			result.Path = rel
+			result.Size, result.MD5, result.SHA256 = digest.Size, digest.MD5, digest.SHA256
+			s.r.Recovered(disk.WrittenFile{Path: path, Original: f.Path, Source: f.Filesystem, Digest: digest})
+			s.r.Finished(path)
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+// Open returns a reader of the data of a file the last Scan listed, as
+// Recover would write it, to stream it elsewhere than to a file: to a
+// network connection, or only through a hash
+func (s *Source) Open(f File) (io.Reader, error) {
+	if f.source != s || f.volume >= len(s.volumes) || f.index >= len(s.volumes[f.volume].Files) {
+		return nil, ErrNotScanned
+	}
+	v := s.volumes[f.volume]
+	return v.Open(v.Files[f.index])
+}
+
+// unixTime converts Unix seconds, 0 being unknown
+func unixTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0).UTC()
+}
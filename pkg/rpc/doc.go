@@ -0,0 +1,18 @@
+// Package rpc is the gRPC API of the recovery service that
+// "recover serve -grpc" runs, for controllers that orchestrate many
+// recovery machines: it lists a machine's devices, starts scans of them,
+// streams their progress, pages through the files they list and recovers
+// the ones chosen. The code is generated from recovery.proto.
+//
+// A service other machines can reach is served over TLS, to clients that
+// give the token it was started with on each call, or a certificate:
+//
+//	creds := credentials.NewClientTLSFromCert(pool, "lab-3")
+//	conn, err := grpc.NewClient("lab-3:9000", grpc.WithTransportCredentials(creds),
+//		grpc.WithPerRPCCredentials(rpc.Token{Value: os.Getenv("RECOVER_SERVE_TOKEN")}))
+//	...
+//	client := rpc.NewRecoveryClient(conn)
+//	job, err := client.StartScan(ctx, &rpc.StartScanRequest{Device: "/dev/sdb"})
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative recovery.proto
@@ -0,0 +1,22 @@
+package rpc
+
+import "context"
+
+// Token gives the token a service run with $RECOVER_SERVE_TOKEN asks its
+// clients for, on every call of a connection made with
+// grpc.WithPerRPCCredentials. It is only sent over TLS unless Insecure is
+// set, for a service on the local host.
+type Token struct {
+	Value    string
+	Insecure bool
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials
+func (t Token) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.Value}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials
+func (t Token) RequireTransportSecurity() bool {
+	return !t.Insecure
+}